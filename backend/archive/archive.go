@@ -0,0 +1,502 @@
+// Package archive implements a read only backend showing archives as
+// directories
+package archive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/configstruct"
+	"github.com/rclone/rclone/fs/fspath"
+	"github.com/rclone/rclone/fs/hash"
+	libarchive "github.com/rclone/rclone/lib/archive"
+)
+
+var errorReadOnly = errors.New("archive remotes are read only")
+
+// Register with Fs
+func init() {
+	fs.Register(&fs.RegInfo{
+		Name:        "archive",
+		Description: "Read archives (zip, 7z, tar) as directories",
+		NewFs:       NewFs,
+		Options: []fs.Option{{
+			Name:     "remote",
+			Required: true,
+			Help: `Remote holding the archives (e.g. myRemote:path or myRemote:path/file.zip).
+
+Archives in this remote are shown as directories with the same name
+as the archive. Normally should contain a ':' and a path, e.g.
+"myremote:path/to/dir", "myremote:bucket" or maybe "myremote:" (not
+recommended).`,
+		}},
+	})
+}
+
+// Options defines the configuration for this backend
+type Options struct {
+	Remote string `config:"remote"`
+}
+
+// Fs represents archives in a wrapped fs.Fs shown as directories
+type Fs struct {
+	name     string
+	root     string
+	opt      Options
+	features *fs.Features
+	base     fs.Fs  // the remote holding the archives
+	prefix   string // path in base the remote option points to
+	mu       sync.Mutex
+	indexes  map[string]*index // cached archive indexes by path in base
+}
+
+// archive is an archive found in the base remote
+type archive struct {
+	o   fs.Object
+	idx *index
+}
+
+// splitRemote splits remote at the first path element which looks
+// like an archive so the base can be made from a directory which
+// exists, returning the remote for the base and the path of the
+// archive in it.
+func splitRemote(remote string) (baseRemote, prefix string, err error) {
+	fsName, fsPath, err := fspath.SplitFs(remote)
+	if err != nil {
+		return "", "", err
+	}
+	elements := strings.Split(fsPath, "/")
+	for i, element := range elements {
+		if libarchive.FormatOf(element) != libarchive.FormatNone {
+			return fsName + strings.Join(elements[:i], "/"), strings.Join(elements[i:], "/"), nil
+		}
+	}
+	return remote, "", nil
+}
+
+// NewFs constructs an Fs from the path.
+//
+// The returned Fs is the actual Fs, referenced by remote in the config
+func NewFs(ctx context.Context, name, root string, m configmap.Mapper) (fs.Fs, error) {
+	opt := new(Options)
+	err := configstruct.Set(m, opt)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(opt.Remote, name+":") {
+		return nil, errors.New("can't point archive remote at itself - check the value of the remote setting")
+	}
+	baseRemote, prefix, err := splitRemote(opt.Remote)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse remote %q: %w", opt.Remote, err)
+	}
+	base, err := cache.Get(ctx, baseRemote)
+	if err == fs.ErrorIsFile {
+		_, basePath, _ := fspath.SplitFs(baseRemote)
+		prefix = path.Join(path.Base(basePath), prefix)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to make remote %q to wrap: %w", baseRemote, err)
+	}
+	f := &Fs{
+		name:    name,
+		root:    strings.Trim(root, "/"),
+		opt:     *opt,
+		base:    base,
+		prefix:  prefix,
+		indexes: map[string]*index{},
+	}
+	cache.PinUntilFinalized(f.base, f)
+	f.features = (&fs.Features{
+		CanHaveEmptyDirectories: true,
+	}).Fill(ctx, f)
+
+	// Check to see if the root points to a file
+	if full := f.full(""); full != "" {
+		isFile, err := f.isFile(ctx, full)
+		if err != nil {
+			return nil, err
+		}
+		if isFile {
+			if f.root != "" {
+				f.root = path.Dir(f.root)
+				if f.root == "." {
+					f.root = ""
+				}
+			} else {
+				f.prefix = path.Dir(f.prefix)
+				if f.prefix == "." {
+					f.prefix = ""
+				}
+			}
+			return f, fs.ErrorIsFile
+		}
+	}
+	return f, nil
+}
+
+// full returns the path in base of remote
+func (f *Fs) full(remote string) string {
+	return strings.Trim(path.Join(f.prefix, f.root, remote), "/")
+}
+
+// rel returns the remote for the path in base
+func (f *Fs) rel(full string) string {
+	root := f.full("")
+	if root == "" {
+		return full
+	}
+	return strings.TrimPrefix(strings.TrimPrefix(full, root), "/")
+}
+
+// isFile returns true if the path in base is a file which isn't an
+// archive or a file in an archive
+func (f *Fs) isFile(ctx context.Context, full string) (bool, error) {
+	arc, inner, err := f.split(ctx, full)
+	if err != nil {
+		return false, err
+	}
+	if arc != nil {
+		m := arc.idx.members[inner]
+		return inner != "" && m != nil && !m.isDir, nil
+	}
+	_, err = f.base.NewObject(ctx, full)
+	return err == nil, nil
+}
+
+// split finds the archive the path in base is in and returns the path
+// inside the archive, or nil if it isn't in an archive
+func (f *Fs) split(ctx context.Context, full string) (arc *archive, inner string, err error) {
+	if full == "" {
+		return nil, "", nil
+	}
+	elements := strings.Split(full, "/")
+	for i, element := range elements {
+		format := libarchive.FormatOf(element)
+		if format == libarchive.FormatNone {
+			continue
+		}
+		arcPath := strings.Join(elements[:i+1], "/")
+		o, err := f.base.NewObject(ctx, arcPath)
+		if errors.Is(err, fs.ErrorObjectNotFound) || errors.Is(err, fs.ErrorIsDir) || errors.Is(err, fs.ErrorNotAFile) {
+			// a directory which looks like an archive
+			continue
+		} else if err != nil {
+			return nil, "", err
+		}
+		idx, err := f.getIndex(ctx, arcPath, o, format)
+		if err != nil {
+			return nil, "", err
+		}
+		return &archive{o: o, idx: idx}, strings.Join(elements[i+1:], "/"), nil
+	}
+	return nil, "", nil
+}
+
+// getIndex returns the index of the archive o, reading it if it isn't
+// cached or the archive has changed
+func (f *Fs) getIndex(ctx context.Context, arcPath string, o fs.Object, format libarchive.Format) (*index, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	idx := f.indexes[arcPath]
+	if idx != nil && idx.size == o.Size() && idx.modTime.Equal(o.ModTime(ctx)) {
+		return idx, nil
+	}
+	fs.Debugf(o, "Reading archive index")
+	idx, err := newIndex(ctx, o, format)
+	if err != nil {
+		return nil, err
+	}
+	f.indexes[arcPath] = idx
+	return idx, nil
+}
+
+// Name of the remote (as passed into NewFs)
+func (f *Fs) Name() string {
+	return f.name
+}
+
+// Root of the remote (as passed into NewFs)
+func (f *Fs) Root() string {
+	return f.root
+}
+
+// String converts this Fs to a string
+func (f *Fs) String() string {
+	return fmt.Sprintf("archive root '%s'", f.root)
+}
+
+// Features returns the optional features of this Fs
+func (f *Fs) Features() *fs.Features {
+	return f.features
+}
+
+// Precision of the ModTimes in this Fs
+//
+// Zip archives store DOS times which only have a precision of 2s, so
+// use that unless the root is inside an archive of another format.
+func (f *Fs) Precision() time.Duration {
+	precision := 2 * time.Second
+	for _, element := range strings.Split(f.full(""), "/") {
+		if format := libarchive.FormatOf(element); format != libarchive.FormatNone {
+			if format != libarchive.FormatZip {
+				precision = time.Second
+			}
+			break
+		}
+	}
+	if p := f.base.Precision(); p > precision {
+		return p
+	}
+	return precision
+}
+
+// Hashes returns the supported hash sets.
+//
+// Files in zip and 7z archives have CRC-32 checksums.
+func (f *Fs) Hashes() hash.Set {
+	hashes := f.base.Hashes()
+	hashes.Add(hash.CRC32)
+	return hashes
+}
+
+// List the objects and directories in dir into entries.  The
+// entries can be returned in any order but should be for a
+// complete directory.
+//
+// dir should be "" to list the root, and should not have
+// trailing slashes.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err error) {
+	full := f.full(dir)
+	arc, inner, err := f.split(ctx, full)
+	if err != nil {
+		return nil, err
+	}
+	if arc != nil {
+		return f.listArchive(arc, dir, inner)
+	}
+	baseEntries, err := f.base.List(ctx, full)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range baseEntries {
+		remote := f.rel(entry.Remote())
+		switch x := entry.(type) {
+		case fs.Object:
+			if libarchive.FormatOf(remote) != libarchive.FormatNone {
+				entries = append(entries, fs.NewDir(remote, x.ModTime(ctx)))
+			} else {
+				entries = append(entries, &Object{f: f, remote: remote, o: x})
+			}
+		case fs.Directory:
+			d := fs.NewDirCopy(ctx, x)
+			d.SetRemote(remote)
+			entries = append(entries, d)
+		}
+	}
+	return entries, nil
+}
+
+// listArchive lists the directory inner of an archive
+func (f *Fs) listArchive(arc *archive, dir, inner string) (entries fs.DirEntries, err error) {
+	if inner != "" {
+		m := arc.idx.members[inner]
+		if m == nil {
+			return nil, fs.ErrorDirNotFound
+		}
+		if !m.isDir {
+			return nil, fs.ErrorIsFile
+		}
+	}
+	for _, m := range arc.idx.children[inner] {
+		remote := path.Join(dir, path.Base(m.name))
+		if m.isDir {
+			entries = append(entries, fs.NewDir(remote, m.modTime))
+		} else {
+			entries = append(entries, &Object{f: f, remote: remote, arc: arc, m: m})
+		}
+	}
+	return entries, nil
+}
+
+// NewObject finds the Object at remote.  If it can't be found
+// it returns the error ErrorObjectNotFound.
+func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
+	full := f.full(remote)
+	arc, inner, err := f.split(ctx, full)
+	if err != nil {
+		return nil, err
+	}
+	if arc == nil {
+		o, err := f.base.NewObject(ctx, full)
+		if err != nil {
+			return nil, err
+		}
+		return &Object{f: f, remote: remote, o: o}, nil
+	}
+	if inner == "" {
+		return nil, fs.ErrorIsDir
+	}
+	m := arc.idx.members[inner]
+	if m == nil {
+		return nil, fs.ErrorObjectNotFound
+	}
+	if m.isDir {
+		return nil, fs.ErrorIsDir
+	}
+	return &Object{f: f, remote: remote, arc: arc, m: m}, nil
+}
+
+// Put in to the remote path with the modTime given of the given size
+//
+// archive remotes are read only
+func (f *Fs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	return nil, errorReadOnly
+}
+
+// Mkdir makes the root directory of the Fs object
+//
+// archive remotes are read only
+func (f *Fs) Mkdir(ctx context.Context, dir string) error {
+	return errorReadOnly
+}
+
+// Rmdir removes the root directory of the Fs object
+//
+// archive remotes are read only
+func (f *Fs) Rmdir(ctx context.Context, dir string) error {
+	return errorReadOnly
+}
+
+// UnWrap returns the Fs that this Fs is wrapping
+func (f *Fs) UnWrap() fs.Fs {
+	return f.base
+}
+
+// Object describes a file in the base remote or in an archive
+type Object struct {
+	f      *Fs
+	remote string
+	o      fs.Object // the file in the base remote if not in an archive
+	arc    *archive  // the archive holding the file
+	m      *member   // the file in the archive
+}
+
+// Fs returns the parent Fs
+func (o *Object) Fs() fs.Info {
+	return o.f
+}
+
+// String returns a description of the Object
+func (o *Object) String() string {
+	if o == nil {
+		return "<nil>"
+	}
+	return o.remote
+}
+
+// Remote returns the remote path
+func (o *Object) Remote() string {
+	return o.remote
+}
+
+// Hash returns the selected checksum of the file
+//
+// Files in archives only have a CRC-32 and only in zip and 7z
+// archives.
+func (o *Object) Hash(ctx context.Context, ht hash.Type) (string, error) {
+	if o.o != nil {
+		return o.o.Hash(ctx, ht)
+	}
+	if ht == hash.CRC32 {
+		return o.m.crc, nil
+	}
+	return "", nil
+}
+
+// Size returns the size of the file
+func (o *Object) Size() int64 {
+	if o.o != nil {
+		return o.o.Size()
+	}
+	return o.m.size
+}
+
+// ModTime returns the modification time of the file
+func (o *Object) ModTime(ctx context.Context) time.Time {
+	if o.o != nil {
+		return o.o.ModTime(ctx)
+	}
+	return o.m.modTime
+}
+
+// SetModTime sets the modification time of the file
+//
+// archive remotes are read only
+func (o *Object) SetModTime(ctx context.Context, modTime time.Time) error {
+	return errorReadOnly
+}
+
+// Storable returns whether this object is storable
+func (o *Object) Storable() bool {
+	return true
+}
+
+// Open an object for read
+func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (io.ReadCloser, error) {
+	if o.o != nil {
+		return o.o.Open(ctx, options...)
+	}
+	var offset, limit int64 = 0, -1
+	for _, option := range options {
+		switch x := option.(type) {
+		case *fs.SeekOption:
+			offset = x.Offset
+		case *fs.RangeOption:
+			offset, limit = x.Decode(o.m.size)
+		default:
+			if option.Mandatory() {
+				fs.Logf(o, "Unsupported mandatory option: %v", option)
+			}
+		}
+	}
+	return o.arc.idx.open(ctx, o.arc.o, o.m, offset, limit)
+}
+
+// Update the object with the contents of the io.Reader
+//
+// archive remotes are read only
+func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	return errorReadOnly
+}
+
+// Remove an object
+//
+// archive remotes are read only
+func (o *Object) Remove(ctx context.Context) error {
+	return errorReadOnly
+}
+
+// UnWrap returns the wrapped Object or nil if the file is in an
+// archive
+func (o *Object) UnWrap() fs.Object {
+	return o.o
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Fs        = (*Fs)(nil)
+	_ fs.UnWrapper = (*Fs)(nil)
+	_ fs.Object    = (*Object)(nil)
+)
@@ -0,0 +1,407 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testTime  = time.Date(2022, 3, 4, 5, 6, 7, 0, time.UTC)
+	testFiles = []struct {
+		name     string
+		contents string
+	}{
+		{"hello.txt", "hello world"},
+		{"dir/big.txt", strings.Repeat("0123456789", 10000)},
+		{"dir/sub/empty.txt", ""},
+	}
+)
+
+// makeZip makes a zip archive of the test files
+func makeZip(t *testing.T) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	_, err := zw.CreateHeader(&zip.FileHeader{Name: "dir/", Modified: testTime})
+	require.NoError(t, err)
+	for i, file := range testFiles {
+		method := zip.Deflate
+		if i == 0 {
+			method = zip.Store
+		}
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: file.name, Method: method, Modified: testTime})
+		require.NoError(t, err)
+		_, err = io.WriteString(w, file.contents)
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+// makeTar makes a tar archive of the test files
+func makeTar(t *testing.T) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0755, ModTime: testTime}))
+	for _, file := range testFiles {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: "./" + file.name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(file.contents)), ModTime: testTime}))
+		_, err := io.WriteString(tw, file.contents)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	return buf.Bytes()
+}
+
+// put7zNumber appends the 7z encoding of n to buf
+func put7zNumber(buf *bytes.Buffer, n uint64) {
+	if n < 0x80 {
+		buf.WriteByte(byte(n))
+		return
+	}
+	buf.WriteByte(0xFF)
+	_ = binary.Write(buf, binary.LittleEndian, n)
+}
+
+// make7z makes a 7z archive of the test files with the non empty
+// files stored in one solid block
+func make7z(t *testing.T) []byte {
+	type entry struct {
+		name     string
+		contents string
+		isDir    bool
+	}
+	entries := []entry{{name: "dir", isDir: true}}
+	for _, file := range testFiles {
+		entries = append(entries, entry{name: file.name, contents: file.contents})
+	}
+	var data bytes.Buffer
+	var sizes, crcs []uint32
+	for _, e := range entries {
+		if e.contents != "" {
+			data.WriteString(e.contents)
+			sizes = append(sizes, uint32(len(e.contents)))
+			crcs = append(crcs, crc32.ChecksumIEEE([]byte(e.contents)))
+		}
+	}
+
+	var h bytes.Buffer
+	h.Write([]byte{0x01, 0x04})             // Header, MainStreamsInfo
+	h.Write([]byte{0x06, 0x00, 0x01, 0x09}) // PackInfo at 0 with 1 stream, Size
+	put7zNumber(&h, uint64(data.Len()))
+	h.WriteByte(0x00)
+	h.Write([]byte{0x07, 0x0B, 0x01, 0x00, 0x01, 0x01, 0x00, 0x0C}) // UnpackInfo with 1 folder with 1 Copy coder
+	put7zNumber(&h, uint64(data.Len()))
+	h.WriteByte(0x00)
+	h.Write([]byte{0x08, 0x0D}) // SubStreamsInfo, NumUnpackStream
+	put7zNumber(&h, uint64(len(sizes)))
+	h.WriteByte(0x09)
+	for _, size := range sizes[:len(sizes)-1] {
+		put7zNumber(&h, uint64(size))
+	}
+	h.Write([]byte{0x0A, 0x01})
+	for _, crc := range crcs {
+		_ = binary.Write(&h, binary.LittleEndian, crc)
+	}
+	h.Write([]byte{0x00, 0x00}) // end of SubStreamsInfo and MainStreamsInfo
+
+	h.WriteByte(0x05) // FilesInfo
+	put7zNumber(&h, uint64(len(entries)))
+	var emptyStream, emptyFile byte
+	var nEmpty int
+	for i, e := range entries {
+		if e.contents == "" {
+			emptyStream |= 0x80 >> i
+			if !e.isDir {
+				emptyFile |= 0x80 >> nEmpty
+			}
+			nEmpty++
+		}
+	}
+	h.Write([]byte{0x0E, 0x01, emptyStream, 0x0F, 0x01, emptyFile})
+	var names bytes.Buffer
+	names.WriteByte(0x00)
+	for _, e := range entries {
+		for _, r := range e.name {
+			_ = binary.Write(&names, binary.LittleEndian, uint16(r))
+		}
+		_ = binary.Write(&names, binary.LittleEndian, uint16(0))
+	}
+	h.WriteByte(0x11)
+	put7zNumber(&h, uint64(names.Len()))
+	h.Write(names.Bytes())
+	h.WriteByte(0x14)
+	put7zNumber(&h, uint64(2+8*len(entries)))
+	h.Write([]byte{0x01, 0x00})
+	for range entries {
+		_ = binary.Write(&h, binary.LittleEndian, uint64(testTime.UnixNano()/100+116444736000000000))
+	}
+	h.WriteByte(0x15)
+	put7zNumber(&h, uint64(2+4*len(entries)))
+	h.Write([]byte{0x01, 0x00})
+	for _, e := range entries {
+		attr := uint32(0x20)
+		if e.isDir {
+			attr = 0x10
+		}
+		_ = binary.Write(&h, binary.LittleEndian, attr)
+	}
+	h.Write([]byte{0x00, 0x00}) // end of FilesInfo and Header
+
+	var start bytes.Buffer
+	_ = binary.Write(&start, binary.LittleEndian, uint64(data.Len()))
+	_ = binary.Write(&start, binary.LittleEndian, uint64(h.Len()))
+	_ = binary.Write(&start, binary.LittleEndian, crc32.ChecksumIEEE(h.Bytes()))
+	var out bytes.Buffer
+	out.Write([]byte{'7', 'z', 0xBC, 0xAF, 0x27, 0x1C, 0x00, 0x04})
+	_ = binary.Write(&out, binary.LittleEndian, crc32.ChecksumIEEE(start.Bytes()))
+	out.Write(start.Bytes())
+	out.Write(data.Bytes())
+	out.Write(h.Bytes())
+	return out.Bytes()
+}
+
+// makeTestDir makes a directory of archives and returns its path
+func makeTestDir(t *testing.T) string {
+	dir := t.TempDir()
+	tarData := makeTar(t)
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	_, err := gw.Write(tarData)
+	require.NoError(t, err)
+	require.NoError(t, gw.Close())
+	var zst bytes.Buffer
+	zw, err := zstd.NewWriter(&zst)
+	require.NoError(t, err)
+	_, err = zw.Write(tarData)
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	for name, data := range map[string][]byte{
+		"test.zip":     makeZip(t),
+		"test.7z":      make7z(t),
+		"test.tar":     tarData,
+		"test.tar.gz":  gz.Bytes(),
+		"test.tar.zst": zst.Bytes(),
+		"plain.txt":    []byte("not an archive"),
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), data, 0666))
+	}
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "notarchive.zip"), 0777))
+	return dir
+}
+
+// newFs makes an archive remote of remote with root
+func newFs(t *testing.T, remote, root string) (fs.Fs, error) {
+	return fs.NewFs(context.Background(), fmt.Sprintf(`:archive,remote="%s":%s`, remote, root))
+}
+
+// names returns the sorted remotes of entries
+func names(entries fs.DirEntries) (out []string) {
+	for _, entry := range entries {
+		out = append(out, entry.Remote())
+	}
+	sort.Strings(out)
+	return out
+}
+
+// readAll reads the object with options
+func readAll(t *testing.T, o fs.Object, options ...fs.OpenOption) string {
+	in, err := o.Open(context.Background(), options...)
+	require.NoError(t, err)
+	data, err := io.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	return string(data)
+}
+
+func TestList(t *testing.T) {
+	ctx := context.Background()
+	dir := makeTestDir(t)
+	f, err := newFs(t, dir, "")
+	require.NoError(t, err)
+
+	entries, err := f.List(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"notarchive.zip", "plain.txt", "test.7z", "test.tar", "test.tar.gz", "test.tar.zst", "test.zip"}, names(entries))
+	for _, entry := range entries {
+		_, isObject := entry.(fs.Object)
+		assert.Equal(t, entry.Remote() == "plain.txt", isObject, entry.Remote())
+	}
+
+	entries, err = f.List(ctx, "notarchive.zip")
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	_, err = f.List(ctx, "test.zip/missing")
+	assert.ErrorIs(t, err, fs.ErrorDirNotFound)
+}
+
+func TestArchives(t *testing.T) {
+	ctx := context.Background()
+	dir := makeTestDir(t)
+	f, err := newFs(t, dir, "")
+	require.NoError(t, err)
+
+	for _, archive := range []string{"test.zip", "test.7z", "test.tar", "test.tar.gz", "test.tar.zst"} {
+		t.Run(archive, func(t *testing.T) {
+			entries, err := f.List(ctx, archive)
+			require.NoError(t, err)
+			assert.Equal(t, []string{archive + "/dir", archive + "/hello.txt"}, names(entries))
+
+			entries, err = f.List(ctx, archive+"/dir")
+			require.NoError(t, err)
+			assert.Equal(t, []string{archive + "/dir/big.txt", archive + "/dir/sub"}, names(entries))
+
+			for _, file := range testFiles {
+				o, err := f.NewObject(ctx, archive+"/"+file.name)
+				require.NoError(t, err)
+				assert.Equal(t, int64(len(file.contents)), o.Size())
+				assert.True(t, testTime.Equal(o.ModTime(ctx)), o.ModTime(ctx))
+				assert.Equal(t, file.contents, readAll(t, o))
+			}
+
+			o, err := f.NewObject(ctx, archive+"/dir/big.txt")
+			require.NoError(t, err)
+			assert.Equal(t, "5678901", readAll(t, o, &fs.RangeOption{Start: 50005, End: 50011}))
+			assert.Equal(t, "456789", readAll(t, o, &fs.SeekOption{Offset: 99994}))
+
+			_, err = f.NewObject(ctx, archive+"/dir")
+			assert.ErrorIs(t, err, fs.ErrorIsDir)
+			_, err = f.NewObject(ctx, archive+"/missing")
+			assert.ErrorIs(t, err, fs.ErrorObjectNotFound)
+		})
+	}
+}
+
+func TestHash(t *testing.T) {
+	ctx := context.Background()
+	dir := makeTestDir(t)
+	f, err := newFs(t, dir, "")
+	require.NoError(t, err)
+
+	o, err := f.NewObject(ctx, "test.zip/hello.txt")
+	require.NoError(t, err)
+	sum, err := o.Hash(ctx, hash.CRC32)
+	require.NoError(t, err)
+	assert.Equal(t, "0d4a1185", sum)
+
+	o, err = f.NewObject(ctx, "test.7z/hello.txt")
+	require.NoError(t, err)
+	sum, err = o.Hash(ctx, hash.CRC32)
+	require.NoError(t, err)
+	assert.Equal(t, "0d4a1185", sum)
+
+	o, err = f.NewObject(ctx, "test.tar/hello.txt")
+	require.NoError(t, err)
+	sum, err = o.Hash(ctx, hash.CRC32)
+	require.NoError(t, err)
+	assert.Equal(t, "", sum)
+}
+
+func TestRoots(t *testing.T) {
+	ctx := context.Background()
+	dir := makeTestDir(t)
+
+	// root inside an archive
+	f, err := newFs(t, dir, "test.zip/dir")
+	require.NoError(t, err)
+	entries, err := f.List(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"big.txt", "sub"}, names(entries))
+
+	// remote pointing at an archive
+	f, err = newFs(t, filepath.Join(dir, "test.tar"), "")
+	require.NoError(t, err)
+	entries, err = f.List(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dir", "hello.txt"}, names(entries))
+
+	// remote pointing at a file in an archive
+	f, err = newFs(t, filepath.Join(dir, "test.tar", "dir", "big.txt"), "")
+	assert.Equal(t, fs.ErrorIsFile, err)
+	o, err := f.NewObject(ctx, "big.txt")
+	require.NoError(t, err)
+	assert.Equal(t, testFiles[1].contents, readAll(t, o))
+
+	// root pointing at a file in an archive
+	f, err = newFs(t, dir, "test.zip/hello.txt")
+	assert.Equal(t, fs.ErrorIsFile, err)
+	assert.Equal(t, "test.zip", f.Root())
+
+	// root pointing at a plain file
+	f, err = newFs(t, dir, "plain.txt")
+	assert.Equal(t, fs.ErrorIsFile, err)
+	assert.Equal(t, "", f.Root())
+	o, err = f.NewObject(ctx, "plain.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "not an archive", readAll(t, o))
+}
+
+func TestPrecision(t *testing.T) {
+	dir := makeTestDir(t)
+	for _, test := range []struct {
+		root string
+		want time.Duration
+	}{
+		{"", 2 * time.Second},
+		{"test.zip/dir", 2 * time.Second},
+		{"test.tar", time.Second},
+		{"test.7z", time.Second},
+	} {
+		f, err := newFs(t, dir, test.root)
+		require.NoError(t, err)
+		assert.Equal(t, test.want, f.Precision(), test.root)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	ctx := context.Background()
+	dir := makeTestDir(t)
+	f, err := newFs(t, dir, "")
+	require.NoError(t, err)
+
+	src := object.NewStaticObjectInfo("new.txt", testTime, 1, true, nil, nil)
+	_, err = f.Put(ctx, strings.NewReader("x"), src)
+	assert.Equal(t, errorReadOnly, err)
+	assert.Equal(t, errorReadOnly, f.Mkdir(ctx, "newdir"))
+	o, err := f.NewObject(ctx, "test.zip/hello.txt")
+	require.NoError(t, err)
+	assert.Equal(t, errorReadOnly, o.Remove(ctx))
+}
+
+func TestIndexContext(t *testing.T) {
+	dir := makeTestDir(t)
+	f, err := newFs(t, dir, "")
+	require.NoError(t, err)
+
+	// The index is cached so later calls mustn't use the context it
+	// was read with
+	for _, archive := range []string{"test.zip", "test.7z"} {
+		ctx, cancel := context.WithCancel(context.Background())
+		_, err = f.List(ctx, archive)
+		require.NoError(t, err)
+		cancel()
+		o, err := f.NewObject(context.Background(), archive+"/hello.txt")
+		require.NoError(t, err)
+		assert.Equal(t, "hello world", readAll(t, o))
+	}
+}
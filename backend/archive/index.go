@@ -0,0 +1,445 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bodgit/sevenzip"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/chunkedreader"
+	libarchive "github.com/rclone/rclone/lib/archive"
+	"github.com/rclone/rclone/lib/readers"
+)
+
+// member is a file or directory inside an archive
+type member struct {
+	name    string // path inside the archive
+	size    int64
+	modTime time.Time
+	isDir   bool
+	seq     int       // number of the tar header or 7z entry
+	offset  int64     // offset of the data in an uncompressed tar or zip or -1 if not known
+	zf      *zip.File // the zip entry
+	crc     string    // CRC-32 as hex or "" if not known
+}
+
+// index of the members of an archive
+type index struct {
+	format   libarchive.Format
+	size     int64     // size of the archive when indexed
+	modTime  time.Time // modification time of the archive when indexed
+	members  map[string]*member
+	children map[string][]*member // members of each directory
+	zipMu    sync.Mutex           // held while zr is in use
+	zr       *libarchive.ReaderAt // reader for the zip local headers
+}
+
+// add a member to the index, making its parent directories if needed
+func (idx *index) add(m *member) {
+	if old := idx.members[m.name]; old != nil {
+		if old.isDir && m.isDir {
+			return
+		}
+		// a later entry replaces an earlier one
+		idx.remove(old)
+	}
+	idx.members[m.name] = m
+	dir := path.Dir(m.name)
+	if dir == "." {
+		dir = ""
+	}
+	idx.children[dir] = append(idx.children[dir], m)
+	if dir != "" && idx.members[dir] == nil {
+		idx.add(&member{name: dir, isDir: true, modTime: m.modTime, offset: -1})
+	}
+}
+
+// remove a member from the index
+func (idx *index) remove(m *member) {
+	delete(idx.members, m.name)
+	dir := path.Dir(m.name)
+	if dir == "." {
+		dir = ""
+	}
+	children := idx.children[dir]
+	for i := range children {
+		if children[i] == m {
+			idx.children[dir] = append(children[:i], children[i+1:]...)
+			break
+		}
+	}
+}
+
+// sort the children of each directory by name
+func (idx *index) sort() {
+	for _, children := range idx.children {
+		sort.Slice(children, func(i, j int) bool {
+			return children[i].name < children[j].name
+		})
+	}
+}
+
+// newIndex reads the index of the archive o
+func newIndex(ctx context.Context, o fs.Object, format libarchive.Format) (idx *index, err error) {
+	idx = &index{
+		format:   format,
+		size:     o.Size(),
+		modTime:  o.ModTime(ctx),
+		members:  map[string]*member{},
+		children: map[string][]*member{},
+	}
+	switch format {
+	case libarchive.FormatZip:
+		err = idx.readZip(ctx, o)
+	case libarchive.FormatTar:
+		err = idx.readTar(ctx, o)
+	case libarchive.FormatTarGz, libarchive.FormatTarZstd:
+		err = idx.readCompressedTar(ctx, o)
+	case libarchive.Format7z:
+		err = idx.read7z(ctx, o)
+	default:
+		err = errors.New("unknown archive format")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index of archive %q: %w", o.Remote(), err)
+	}
+	idx.sort()
+	return idx, nil
+}
+
+// readZip reads the central directory of a zip archive
+//
+// The reader is kept to read the local headers of the members when
+// they are opened, with the context of each call.
+func (idx *index) readZip(ctx context.Context, o fs.Object) error {
+	idx.zr = libarchive.NewReaderAt(ctx, o)
+	defer func() {
+		_ = idx.zr.Close()
+		idx.zr.SetContext(nil)
+	}()
+	zr, err := zip.NewReader(idx.zr, o.Size())
+	if err != nil && !errors.Is(err, zip.ErrInsecurePath) {
+		return err
+	}
+	for _, zf := range zr.File {
+		name := libarchive.CleanName(zf.Name)
+		if name == "" {
+			continue
+		}
+		isDir := strings.HasSuffix(zf.Name, "/")
+		if !isDir && !zf.Mode().IsRegular() {
+			continue
+		}
+		idx.add(&member{
+			name:    name,
+			size:    int64(zf.UncompressedSize64),
+			modTime: zf.Modified,
+			isDir:   isDir,
+			offset:  -1,
+			zf:      zf,
+			crc:     fmt.Sprintf("%08x", zf.CRC32),
+		})
+	}
+	return nil
+}
+
+// read7z reads the header of a 7z archive
+func (idx *index) read7z(ctx context.Context, o fs.Object) (err error) {
+	ra := libarchive.NewReaderAt(ctx, o)
+	defer fs.CheckClose(ra, &err)
+	zr, err := sevenzip.NewReader(ra, o.Size())
+	if err != nil {
+		return err
+	}
+	for seq, zf := range zr.File {
+		name := libarchive.CleanName(zf.Name)
+		if name == "" {
+			continue
+		}
+		isDir := zf.FileInfo().IsDir()
+		if !isDir && !zf.Mode().IsRegular() {
+			continue
+		}
+		m := &member{
+			name:    name,
+			size:    int64(zf.UncompressedSize),
+			modTime: zf.Modified,
+			isDir:   isDir,
+			seq:     seq,
+			offset:  -1,
+		}
+		if m.modTime.IsZero() {
+			m.modTime = idx.modTime
+		}
+		// The CRC is 0 if the archive doesn't have one
+		if !isDir && (zf.CRC32 != 0 || m.size == 0) {
+			m.crc = fmt.Sprintf("%08x", zf.CRC32)
+		}
+		idx.add(m)
+	}
+	return nil
+}
+
+// seekReader tracks the offset of a chunked reader so archive/tar
+// can skip the data of members without reading it
+type seekReader struct {
+	ctx context.Context
+	cr  *chunkedreader.ChunkedReader
+	pos int64
+}
+
+// Read from the chunked reader
+func (r *seekReader) Read(p []byte) (n int, err error) {
+	n, err = r.cr.Read(p)
+	r.pos += int64(n)
+	return n, err
+}
+
+// Seek relative to the current offset only, which is all archive/tar
+// needs. Short skips are read rather than starting a new chunk.
+func (r *seekReader) Seek(offset int64, whence int) (int64, error) {
+	if whence != io.SeekCurrent {
+		return r.pos, errors.New("can only seek from the current offset")
+	}
+	switch {
+	case offset == 0:
+	case offset > 0 && offset < libarchive.InitialChunkSize:
+		n, err := io.CopyN(io.Discard, r.cr, offset)
+		r.pos += n
+		if err != nil {
+			return r.pos, err
+		}
+	default:
+		if _, err := r.cr.RangeSeek(r.ctx, r.pos+offset, io.SeekStart, -1); err != nil {
+			return r.pos, err
+		}
+		r.pos += offset
+	}
+	return r.pos, nil
+}
+
+// addTar adds the tar header hdr to the index
+func (idx *index) addTar(hdr *tar.Header, seq int, offset int64) {
+	name := libarchive.CleanName(hdr.Name)
+	if name == "" {
+		return
+	}
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		idx.add(&member{name: name, isDir: true, modTime: hdr.ModTime, seq: seq, offset: -1})
+	case tar.TypeReg:
+		idx.add(&member{name: name, size: hdr.Size, modTime: hdr.ModTime, seq: seq, offset: offset})
+	}
+}
+
+// readTar reads the headers of an uncompressed tar archive seeking
+// past the data of each member
+func (idx *index) readTar(ctx context.Context, o fs.Object) (err error) {
+	cr := chunkedreader.New(ctx, o, libarchive.InitialChunkSize, libarchive.MaxChunkSize)
+	defer fs.CheckClose(cr, &err)
+	sr := &seekReader{ctx: ctx, cr: cr}
+	tr := tar.NewReader(sr)
+	for seq := 0; ; seq++ {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		idx.addTar(hdr, seq, sr.pos)
+	}
+}
+
+// readCompressedTar reads the headers of a compressed tar archive.
+//
+// The whole archive has to be read as there is no way of seeking in
+// the compressed stream.
+func (idx *index) readCompressedTar(ctx context.Context, o fs.Object) (err error) {
+	in, err := o.Open(ctx)
+	if err != nil {
+		return err
+	}
+	defer fs.CheckClose(in, &err)
+	dr, err := libarchive.Decompress(idx.format, in)
+	if err != nil {
+		return err
+	}
+	defer fs.CheckClose(dr, &err)
+	tr := tar.NewReader(dr)
+	for seq := 0; ; seq++ {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		idx.addTar(hdr, seq, -1)
+	}
+}
+
+// open the member m of archive o reading from offset for limit bytes
+// or to the end if limit is -1
+func (idx *index) open(ctx context.Context, o fs.Object, m *member, offset, limit int64) (rc io.ReadCloser, err error) {
+	if limit < 0 || offset+limit > m.size {
+		limit = m.size - offset
+	}
+	if limit <= 0 {
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+	switch {
+	case m.zf != nil:
+		return idx.openZip(ctx, o, m, offset, limit)
+	case idx.format == libarchive.Format7z:
+		return open7z(ctx, o, m, offset, limit)
+	case m.offset >= 0:
+		return openRange(ctx, o, m.offset+offset, limit)
+	default:
+		return idx.openCompressedTar(ctx, o, m, offset, limit)
+	}
+}
+
+// openRange opens the part of o from offset for limit bytes
+func openRange(ctx context.Context, o fs.Object, offset, limit int64) (io.ReadCloser, error) {
+	cr := chunkedreader.New(ctx, o, libarchive.InitialChunkSize, libarchive.MaxChunkSize)
+	if _, err := cr.RangeSeek(ctx, offset, io.SeekStart, limit); err != nil {
+		_ = cr.Close()
+		return nil, err
+	}
+	return readers.NewLimitedReadCloser(cr, limit), nil
+}
+
+// skipReadCloser discards the start of the data and closes both the
+// reader and the underlying reader
+type skipReadCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+// Close all the readers
+func (r *skipReadCloser) Close() (err error) {
+	for _, c := range r.closers {
+		if closeErr := c.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// skip discards offset bytes from in and returns a reader for limit
+// bytes of what follows
+func skip(in io.Reader, offset, limit int64, closers ...io.Closer) (io.ReadCloser, error) {
+	r := &skipReadCloser{Reader: io.LimitReader(in, limit), closers: closers}
+	if offset > 0 {
+		if _, err := io.CopyN(io.Discard, in, offset); err != nil {
+			_ = r.Close()
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// zipDataOffset returns the offset of the data of the zip member m
+//
+// This reads the local header of the member with ctx the first time
+// and remembers it.
+func (idx *index) zipDataOffset(ctx context.Context, m *member) (offset int64, err error) {
+	idx.zipMu.Lock()
+	defer idx.zipMu.Unlock()
+	if m.offset >= 0 {
+		return m.offset, nil
+	}
+	idx.zr.SetContext(ctx)
+	defer func() {
+		_ = idx.zr.Close()
+		idx.zr.SetContext(nil)
+	}()
+	offset, err = m.zf.DataOffset()
+	if err != nil {
+		return -1, err
+	}
+	m.offset = offset
+	return offset, nil
+}
+
+// openZip opens a zip member, reading only its compressed data
+func (idx *index) openZip(ctx context.Context, o fs.Object, m *member, offset, limit int64) (io.ReadCloser, error) {
+	dataOffset, err := idx.zipDataOffset(ctx, m)
+	if err != nil {
+		return nil, err
+	}
+	if m.zf.Flags&0x1 != 0 {
+		return nil, errors.New("encrypted zip members are not supported")
+	}
+	if m.zf.Method == zip.Store {
+		return openRange(ctx, o, dataOffset+offset, limit)
+	}
+	dcomp := libarchive.ZipDecompressor(m.zf.Method)
+	if dcomp == nil {
+		return nil, fmt.Errorf("unsupported zip compression method %d", m.zf.Method)
+	}
+	raw, err := openRange(ctx, o, dataOffset, int64(m.zf.CompressedSize64))
+	if err != nil {
+		return nil, err
+	}
+	rc := dcomp(raw)
+	return skip(rc, offset, limit, rc, raw)
+}
+
+// open7z opens a member of a 7z archive
+//
+// The header is read again with a reader using ctx so nothing is kept
+// from one call to the next. Members stored in solid blocks are
+// decompressed from the start of the block.
+func open7z(ctx context.Context, o fs.Object, m *member, offset, limit int64) (io.ReadCloser, error) {
+	ra := libarchive.NewReaderAt(ctx, o)
+	zr, err := sevenzip.NewReader(ra, o.Size())
+	if err != nil {
+		_ = ra.Close()
+		return nil, err
+	}
+	if m.seq >= len(zr.File) {
+		_ = ra.Close()
+		return nil, errors.New("member not found in archive")
+	}
+	rc, err := zr.File[m.seq].Open()
+	if err != nil {
+		_ = ra.Close()
+		return nil, err
+	}
+	return skip(rc, offset, limit, rc, ra)
+}
+
+// openCompressedTar opens a member of a compressed tar by reading the
+// archive from the start up to the member
+func (idx *index) openCompressedTar(ctx context.Context, o fs.Object, m *member, offset, limit int64) (rc io.ReadCloser, err error) {
+	in, err := o.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	dr, err := libarchive.Decompress(idx.format, in)
+	if err != nil {
+		_ = in.Close()
+		return nil, err
+	}
+	tr := tar.NewReader(dr)
+	for seq := 0; seq <= m.seq; seq++ {
+		if _, err = tr.Next(); err != nil {
+			_ = dr.Close()
+			_ = in.Close()
+			if err == io.EOF {
+				err = errors.New("member not found in archive")
+			}
+			return nil, err
+		}
+	}
+	return skip(tr, offset, limit, dr, in)
+}
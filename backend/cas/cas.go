@@ -0,0 +1,656 @@
+// Package cas provides a wrapping backend which stores the contents of
+// files once under their hash with manifests mapping paths to hashes
+package cas
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/configstruct"
+	"github.com/rclone/rclone/fs/fspath"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/lib/random"
+)
+
+// Layout of the store
+const (
+	objectsDir      = "objects"   // content of files by hash
+	manifestsDir    = "manifests" // manifests by path
+	tempDir         = "tmp"       // uploads in progress
+	manifestVersion = 1
+)
+
+// Register with Fs
+func init() {
+	fs.Register(&fs.RegInfo{
+		Name:        "cas",
+		Description: "Content addressed storage with deduplication",
+		NewFs:       NewFs,
+		CommandHelp: commandHelp,
+		MetadataInfo: &fs.MetadataInfo{
+			System: systemMetadataInfo,
+			Help: `User metadata is stored in the manifest of the file so doesn't
+depend on the remote the store is in.`,
+		},
+		Options: []fs.Option{{
+			Name:     "remote",
+			Required: true,
+			Help: `Remote to keep the store in (e.g. myRemote:path).
+
+The contents of files are stored under "objects" and the manifests
+mapping paths to contents under "manifests" in this path. Files are
+only deduplicated against other files in the same store.
+
+Normally should contain a ':' and a path, e.g. "myremote:path/to/dir",
+"myremote:bucket" or maybe "myremote:" (not recommended).`,
+		}, {
+			Name:    "hash_type",
+			Default: "sha256",
+			Help: `Checksum used to address the contents of files.
+
+Files with the same checksum are stored once, so this should be a
+cryptographic checksum. Don't change this once files are stored -
+files stored with a different checksum can't be read.`,
+			Examples: []fs.OptionExample{{
+				Value: "sha256",
+				Help:  "SHA-256",
+			}, {
+				Value: "sha1",
+				Help:  "SHA-1",
+			}, {
+				Value: "md5",
+				Help:  "MD5 - not recommended as collisions can be made",
+			}},
+			Advanced: true,
+		}},
+	})
+}
+
+// Options defines the configuration for this backend
+type Options struct {
+	Remote   string `config:"remote"`
+	HashType string `config:"hash_type"`
+}
+
+// Fs represents a content addressed store
+type Fs struct {
+	name     string
+	root     string
+	opt      Options
+	features *fs.Features
+	store    fs.Fs     // the root of the store
+	base     fs.Fs     // the manifests for root
+	hashType hash.Type // the hash addressing the contents
+	wrapper  fs.Fs
+}
+
+// NewFs constructs an Fs from the remote:path string
+func NewFs(ctx context.Context, name, root string, m configmap.Mapper) (fs.Fs, error) {
+	opt := new(Options)
+	err := configstruct.Set(m, opt)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(opt.Remote, name+":") {
+		return nil, errors.New("can't point cas remote at itself - check the value of the remote setting")
+	}
+	var hashType hash.Type
+	if err = hashType.Set(opt.HashType); err != nil {
+		return nil, err
+	}
+	if hashType == hash.None {
+		return nil, errors.New("hash_type must be set")
+	}
+	store, err := cache.Get(ctx, opt.Remote)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make remote %q for the store: %w", opt.Remote, err)
+	}
+	base, err := cache.Get(ctx, fspath.JoinRootPath(opt.Remote, path.Join(manifestsDir, root)))
+	if err != nil && err != fs.ErrorIsFile {
+		return nil, fmt.Errorf("failed to make remote %q for the manifests: %w", opt.Remote, err)
+	}
+	f := &Fs{
+		name:     name,
+		root:     root,
+		opt:      *opt,
+		store:    store,
+		base:     base,
+		hashType: hashType,
+	}
+	// Correct root if definitely pointing to a file
+	if err == fs.ErrorIsFile {
+		f.root = path.Dir(f.root)
+		if f.root == "." || f.root == "/" {
+			f.root = ""
+		}
+	}
+	f.features = (&fs.Features{
+		CaseInsensitive:         true,
+		DuplicateFiles:          false,
+		CanHaveEmptyDirectories: true,
+		BucketBased:             true,
+		BucketBasedRootOK:       true,
+	}).Fill(ctx, f).Mask(ctx, base).WrapsFs(f, base)
+	// These are done with the manifests so don't depend on the store
+	f.features.ReadMimeType = true
+	f.features.WriteMimeType = true
+	f.features.ReadMetadata = true
+	f.features.WriteMetadata = true
+	f.features.UserMetadata = true
+	f.features.Copy = f.Copy
+	f.features.Move = f.Move
+	if store.Features().PutStream == nil {
+		f.features.PutStream = nil
+	}
+	cache.PinUntilFinalized(f.base, f)
+	return f, err
+}
+
+// Name of the remote (as passed into NewFs)
+func (f *Fs) Name() string { return f.name }
+
+// Root of the remote (as passed into NewFs)
+func (f *Fs) Root() string { return f.root }
+
+// Features returns the optional features of this Fs
+func (f *Fs) Features() *fs.Features { return f.features }
+
+// Hashes returns the supported hash sets.
+func (f *Fs) Hashes() hash.Set { return hash.NewHashSet(f.hashType) }
+
+// Precision of the ModTimes in this Fs
+func (f *Fs) Precision() time.Duration { return time.Nanosecond }
+
+// String returns a description of the FS
+func (f *Fs) String() string {
+	return fmt.Sprintf("cas root '%s'", f.root)
+}
+
+// UnWrap returns the Fs that this Fs is wrapping
+func (f *Fs) UnWrap() fs.Fs { return f.base }
+
+// WrapFs returns the Fs that is wrapping this Fs
+func (f *Fs) WrapFs() fs.Fs { return f.wrapper }
+
+// SetWrapper sets the Fs that is wrapping this Fs
+func (f *Fs) SetWrapper(wrapper fs.Fs) { f.wrapper = wrapper }
+
+// blobPath returns the path in the store of the contents with sum
+func blobPath(sum string) string {
+	if len(sum) <= 2 {
+		return path.Join(objectsDir, sum)
+	}
+	return path.Join(objectsDir, sum[:2], sum[2:])
+}
+
+// sameStore returns whether src is in the same store as f
+func (f *Fs) sameStore(src fs.Object) (*Object, bool) {
+	srcObj, ok := src.(*Object)
+	if !ok {
+		return nil, false
+	}
+	return srcObj, f.sameStoreAs(srcObj.fs)
+}
+
+// sameStoreAs returns whether other uses the same store as f
+//
+// The stores are compared by their config as the store isn't pinned
+// in the cache so the same store may be made more than once.
+func (f *Fs) sameStoreAs(other *Fs) bool {
+	return fs.ConfigString(other.store) == fs.ConfigString(f.store) && other.hashType == f.hashType
+}
+
+// List the objects and directories in dir into entries.
+//
+// The manifests of the objects aren't read until they are needed.
+func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err error) {
+	entries, err = f.base.List(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	for i, entry := range entries {
+		if mo, ok := entry.(fs.Object); ok {
+			entries[i] = f.newObject(mo)
+		}
+	}
+	return entries, nil
+}
+
+// NewObject finds the Object at remote.
+func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
+	mo, err := f.base.NewObject(ctx, remote)
+	if err != nil {
+		return nil, err
+	}
+	return f.newObject(mo), nil
+}
+
+// touchBlob sets the modification time of contents being reused by
+// another file to now so gc doesn't remove them before the manifest
+// of the file is written
+func (f *Fs) touchBlob(ctx context.Context, blob fs.Object) error {
+	err := blob.SetModTime(ctx, time.Now())
+	if errors.Is(err, fs.ErrorCantSetModTime) || errors.Is(err, fs.ErrorCantSetModTimeWithoutDelete) {
+		fs.Debugf(blob, "cas: can't refresh modification time of reused contents: %v", err)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("cas: failed to refresh modification time of reused contents: %w", err)
+	}
+	return nil
+}
+
+// putBlob stores the contents read from in if they aren't stored
+// already, returning their sum and size
+func (f *Fs) putBlob(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (sum string, size int64, err error) {
+	// Skip the upload if the contents are known to be stored
+	if sum, err = src.Hash(ctx, f.hashType); err == nil && sum != "" {
+		if blob, err := f.store.NewObject(ctx, blobPath(sum)); err == nil && (src.Size() < 0 || blob.Size() == src.Size()) {
+			fs.Debugf(src, "cas: contents already stored as %s", sum)
+			if err = f.touchBlob(ctx, blob); err != nil {
+				return "", -1, err
+			}
+			return sum, blob.Size(), nil
+		}
+	}
+	if f.store.Features().Move == nil {
+		return f.putBlobSpooled(ctx, in, src, options...)
+	}
+
+	// Upload to a temporary name while hashing then move into place
+	hasher, err := hash.NewMultiHasherTypes(hash.NewHashSet(f.hashType))
+	if err != nil {
+		return "", -1, err
+	}
+	tmpName := path.Join(tempDir, random.String(24))
+	tmpInfo := object.NewStaticObjectInfo(tmpName, time.Now(), src.Size(), true, nil, f.store)
+	put := f.store.Put
+	if src.Size() < 0 {
+		put = f.store.Features().PutStream
+	}
+	tmp, err := put(ctx, io.TeeReader(in, hasher), tmpInfo, options...)
+	if err != nil {
+		return "", -1, err
+	}
+	removeTmp := func() {
+		if err := tmp.Remove(ctx); err != nil {
+			fs.Errorf(tmp, "cas: failed to remove temporary upload: %v", err)
+		}
+	}
+	size = hasher.Size()
+	if src.Size() >= 0 && size != src.Size() {
+		removeTmp()
+		return "", -1, fmt.Errorf("cas: upload was %d bytes but expected %d", size, src.Size())
+	}
+	sum = hasher.Sums()[f.hashType]
+	if blob, err := f.store.NewObject(ctx, blobPath(sum)); err == nil {
+		fs.Debugf(src, "cas: contents already stored as %s", sum)
+		removeTmp()
+		if err = f.touchBlob(ctx, blob); err != nil {
+			return "", -1, err
+		}
+		return sum, size, nil
+	}
+	if _, err = f.store.Features().Move(ctx, tmp, blobPath(sum)); err != nil {
+		removeTmp()
+		return "", -1, fmt.Errorf("cas: failed to move upload into place: %w", err)
+	}
+	return sum, size, nil
+}
+
+// putBlobSpooled stores the contents read from in by copying them to
+// a local file to find their sum first, for stores which can't move
+func (f *Fs) putBlobSpooled(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (sum string, size int64, err error) {
+	spool, err := os.CreateTemp("", "rclone-cas-")
+	if err != nil {
+		return "", -1, err
+	}
+	defer func() {
+		_ = spool.Close()
+		_ = os.Remove(spool.Name())
+	}()
+	hasher, err := hash.NewMultiHasherTypes(hash.NewHashSet(f.hashType))
+	if err != nil {
+		return "", -1, err
+	}
+	size, err = io.Copy(io.MultiWriter(spool, hasher), in)
+	if err != nil {
+		return "", -1, err
+	}
+	if src.Size() >= 0 && size != src.Size() {
+		return "", -1, fmt.Errorf("cas: read %d bytes but expected %d", size, src.Size())
+	}
+	sum = hasher.Sums()[f.hashType]
+	if blob, err := f.store.NewObject(ctx, blobPath(sum)); err == nil {
+		fs.Debugf(src, "cas: contents already stored as %s", sum)
+		if err = f.touchBlob(ctx, blob); err != nil {
+			return "", -1, err
+		}
+		return sum, size, nil
+	}
+	if _, err = spool.Seek(0, io.SeekStart); err != nil {
+		return "", -1, err
+	}
+	blobInfo := object.NewStaticObjectInfo(blobPath(sum), time.Now(), size, true, nil, f.store)
+	if _, err = f.store.Put(ctx, spool, blobInfo, options...); err != nil {
+		return "", -1, err
+	}
+	return sum, size, nil
+}
+
+// put stores the contents and writes the manifest for src
+func (f *Fs) put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (*Object, error) {
+	meta, err := fs.GetMetadataOptions(ctx, f, src, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata from source object: %w", err)
+	}
+	sum, size, err := f.putBlob(ctx, in, src, options...)
+	if err != nil {
+		return nil, err
+	}
+	m := &manifest{
+		Hash:     sum,
+		Size:     size,
+		ModTime:  src.ModTime(ctx),
+		MimeType: fs.MimeType(ctx, src),
+	}
+	if err = m.setMetadata(meta); err != nil {
+		return nil, err
+	}
+	return f.putManifest(ctx, src.Remote(), m)
+}
+
+// Put in to the remote path with the modTime given of the given size
+func (f *Fs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	return f.put(ctx, in, src, options...)
+}
+
+// PutStream uploads to the remote path with the modTime given of indeterminate size
+func (f *Fs) PutStream(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	return f.put(ctx, in, src, options...)
+}
+
+// Mkdir makes the directory (container, bucket)
+func (f *Fs) Mkdir(ctx context.Context, dir string) error {
+	return f.base.Mkdir(ctx, dir)
+}
+
+// Rmdir removes the directory (container, bucket) if empty
+func (f *Fs) Rmdir(ctx context.Context, dir string) error {
+	return f.base.Rmdir(ctx, dir)
+}
+
+// Purge all files in the directory specified
+//
+// Only the manifests are removed - use the gc command to remove the
+// contents no longer referenced.
+func (f *Fs) Purge(ctx context.Context, dir string) error {
+	do := f.base.Features().Purge
+	if do == nil {
+		return fs.ErrorCantPurge
+	}
+	return do(ctx, dir)
+}
+
+// Copy src to this remote using server-side copy operations.
+//
+// This only writes a new manifest so takes the same time whatever the
+// size of the file.
+func (f *Fs) Copy(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	srcObj, ok := f.sameStore(src)
+	if !ok {
+		fs.Debugf(src, "Can't copy - not in the same store")
+		return nil, fs.ErrorCantCopy
+	}
+	m, err := srcObj.manifest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := fs.GetMetadataOptions(ctx, f, src, fs.MetadataAsOpenOptions(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("copy: failed to read metadata: %w", err)
+	}
+	mCopy := m.clone()
+	if err = mCopy.setMetadata(meta); err != nil {
+		return nil, err
+	}
+	return f.putManifest(ctx, remote, mCopy)
+}
+
+// Move src to this remote using server-side move operations.
+func (f *Fs) Move(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	srcObj, ok := f.sameStore(src)
+	if !ok {
+		fs.Debugf(src, "Can't move - not in the same store")
+		return nil, fs.ErrorCantMove
+	}
+	dst, err := f.Copy(ctx, src, remote)
+	if err != nil {
+		return nil, err
+	}
+	if err = srcObj.mo.Remove(ctx); err != nil {
+		return nil, fmt.Errorf("move: failed to remove source manifest: %w", err)
+	}
+	return dst, nil
+}
+
+// DirMove moves src, srcRemote to this remote at dstRemote
+// using server-side move operations.
+func (f *Fs) DirMove(ctx context.Context, src fs.Fs, srcRemote, dstRemote string) error {
+	do := f.base.Features().DirMove
+	if do == nil {
+		return fs.ErrorCantDirMove
+	}
+	srcFs, ok := src.(*Fs)
+	if !ok || !f.sameStoreAs(srcFs) {
+		fs.Debugf(srcFs, "Can't move directory - not in the same store")
+		return fs.ErrorCantDirMove
+	}
+	return do(ctx, srcFs.base, srcRemote, dstRemote)
+}
+
+// About gets quota information from the Fs
+func (f *Fs) About(ctx context.Context) (*fs.Usage, error) {
+	do := f.store.Features().About
+	if do == nil {
+		return nil, errors.New("not supported by underlying remote")
+	}
+	return do(ctx)
+}
+
+// Shutdown the backend, closing any background tasks and any
+// cached connections.
+func (f *Fs) Shutdown(ctx context.Context) error {
+	do := f.store.Features().Shutdown
+	if do == nil {
+		return nil
+	}
+	return do(ctx)
+}
+
+// Object describes a file in the store
+type Object struct {
+	fs *Fs
+	mo fs.Object // the manifest object
+
+	mu sync.Mutex
+	m  *manifest // the manifest or nil if not read yet
+}
+
+// newObject makes an Object from the manifest object mo
+func (f *Fs) newObject(mo fs.Object) *Object {
+	return &Object{fs: f, mo: mo}
+}
+
+// Fs returns read only access to the Fs that this object is part of
+func (o *Object) Fs() fs.Info { return o.fs }
+
+// Remote returns the remote path
+func (o *Object) Remote() string { return o.mo.Remote() }
+
+// String returns a description of the Object
+func (o *Object) String() string {
+	if o == nil {
+		return "<nil>"
+	}
+	return o.Remote()
+}
+
+// UnWrap returns the manifest object
+func (o *Object) UnWrap() fs.Object { return o.mo }
+
+// Storable returns whether this object is storable
+func (o *Object) Storable() bool { return true }
+
+// Size returns the size of the file, reading the manifest if
+// necessary, or -1 if it couldn't be read
+func (o *Object) Size() int64 {
+	m, err := o.manifest(context.TODO())
+	if err != nil {
+		fs.Errorf(o, "Failed to read size: %v", err)
+		return -1
+	}
+	return m.Size
+}
+
+// ModTime returns the modification time of the file
+func (o *Object) ModTime(ctx context.Context) time.Time {
+	m, err := o.manifest(ctx)
+	if err != nil {
+		fs.Errorf(o, "Failed to read modification time: %v", err)
+		return o.mo.ModTime(ctx)
+	}
+	return m.ModTime
+}
+
+// Hash returns the selected checksum of the file
+func (o *Object) Hash(ctx context.Context, ht hash.Type) (string, error) {
+	if ht != o.fs.hashType {
+		return "", hash.ErrUnsupported
+	}
+	m, err := o.manifest(ctx)
+	if err != nil {
+		return "", err
+	}
+	return m.Hash, nil
+}
+
+// MimeType of the Object if known, "" otherwise
+func (o *Object) MimeType(ctx context.Context) string {
+	m, err := o.manifest(ctx)
+	if err != nil {
+		return ""
+	}
+	return m.MimeType
+}
+
+// Metadata returns metadata for an object
+func (o *Object) Metadata(ctx context.Context) (fs.Metadata, error) {
+	m, err := o.manifest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return m.getMetadata(), nil
+}
+
+// SetMetadata sets metadata for an Object
+func (o *Object) SetMetadata(ctx context.Context, metadata fs.Metadata) error {
+	return o.change(ctx, func(m *manifest) error {
+		return m.setMetadata(metadata)
+	})
+}
+
+// SetModTime sets the modification time of the file
+func (o *Object) SetModTime(ctx context.Context, modTime time.Time) error {
+	return o.change(ctx, func(m *manifest) error {
+		m.ModTime = modTime
+		return nil
+	})
+}
+
+// change rewrites the manifest after changing it with fn
+func (o *Object) change(ctx context.Context, fn func(m *manifest) error) error {
+	m, err := o.manifest(ctx)
+	if err != nil {
+		return err
+	}
+	m = m.clone()
+	if err = fn(m); err != nil {
+		return err
+	}
+	return o.updateManifest(ctx, m)
+}
+
+// Open an object for read
+func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (io.ReadCloser, error) {
+	m, err := o.manifest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	blob, err := o.fs.store.NewObject(ctx, blobPath(m.Hash))
+	if err != nil {
+		return nil, fmt.Errorf("cas: contents %s of %q missing: %w", m.Hash, o.Remote(), err)
+	}
+	return blob.Open(ctx, options...)
+}
+
+// Update in to the object with the modTime given of the given size
+func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	meta, err := fs.GetMetadataOptions(ctx, o.fs, src, options)
+	if err != nil {
+		return fmt.Errorf("failed to read metadata from source object: %w", err)
+	}
+	sum, size, err := o.fs.putBlob(ctx, in, src, options...)
+	if err != nil {
+		return err
+	}
+	m := &manifest{
+		Hash:     sum,
+		Size:     size,
+		ModTime:  src.ModTime(ctx),
+		MimeType: fs.MimeType(ctx, src),
+	}
+	if err = m.setMetadata(meta); err != nil {
+		return err
+	}
+	return o.updateManifest(ctx, m)
+}
+
+// Remove an object
+//
+// Only the manifest is removed - use the gc command to remove the
+// contents if no longer referenced.
+func (o *Object) Remove(ctx context.Context) error {
+	return o.mo.Remove(ctx)
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Fs              = (*Fs)(nil)
+	_ fs.Purger          = (*Fs)(nil)
+	_ fs.Copier          = (*Fs)(nil)
+	_ fs.Mover           = (*Fs)(nil)
+	_ fs.DirMover        = (*Fs)(nil)
+	_ fs.PutStreamer     = (*Fs)(nil)
+	_ fs.Abouter         = (*Fs)(nil)
+	_ fs.Shutdowner      = (*Fs)(nil)
+	_ fs.Commander       = (*Fs)(nil)
+	_ fs.UnWrapper       = (*Fs)(nil)
+	_ fs.Wrapper         = (*Fs)(nil)
+	_ fs.Object          = (*Object)(nil)
+	_ fs.ObjectUnWrapper = (*Object)(nil)
+	_ fs.MimeTyper       = (*Object)(nil)
+	_ fs.Metadataer      = (*Object)(nil)
+	_ fs.SetMetadataer   = (*Object)(nil)
+)
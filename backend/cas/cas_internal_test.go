@@ -0,0 +1,248 @@
+package cas
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var t1 = time.Date(2023, 4, 5, 6, 7, 8, 0, time.UTC)
+
+// newFs makes a cas remote with a store in a temporary directory
+func newFs(t *testing.T, root string) (*Fs, string) {
+	dir := t.TempDir()
+	f, err := fs.NewFs(context.Background(), fmt.Sprintf(`:cas,remote="%s":%s`, dir, root))
+	require.NoError(t, err)
+	return f.(*Fs), dir
+}
+
+// put uploads contents to remote
+func put(t *testing.T, f fs.Fs, remote, contents string) fs.Object {
+	src := object.NewStaticObjectInfo(remote, t1, int64(len(contents)), true, nil, nil)
+	o, err := f.Put(context.Background(), strings.NewReader(contents), src)
+	require.NoError(t, err)
+	return o
+}
+
+// read returns the contents of remote
+func read(t *testing.T, f fs.Fs, remote string) string {
+	o, err := f.NewObject(context.Background(), remote)
+	require.NoError(t, err)
+	in, err := o.Open(context.Background())
+	require.NoError(t, err)
+	data, err := io.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	return string(data)
+}
+
+// blobs returns the number of contents stored in the store in dir
+func blobs(t *testing.T, dir string) (n int) {
+	err := filepath.Walk(filepath.Join(dir, objectsDir), func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			n++
+		}
+		return err
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return 0
+	}
+	require.NoError(t, err)
+	return n
+}
+
+func TestDedup(t *testing.T) {
+	f, dir := newFs(t, "")
+	put(t, f, "a.txt", "hello")
+	put(t, f, "dir/b.txt", "hello")
+	put(t, f, "c.txt", "world")
+	assert.Equal(t, 2, blobs(t, dir))
+
+	// contents are stored under their hash
+	sum := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	_, err := os.Stat(filepath.Join(dir, objectsDir, sum[:2], sum[2:]))
+	require.NoError(t, err)
+	o, err := f.NewObject(context.Background(), "dir/b.txt")
+	require.NoError(t, err)
+	got, err := o.Hash(context.Background(), hash.SHA256)
+	require.NoError(t, err)
+	assert.Equal(t, sum, got)
+	assert.Equal(t, int64(5), o.Size())
+	assert.Equal(t, t1, o.ModTime(context.Background()))
+	assert.Equal(t, "hello", read(t, f, "dir/b.txt"))
+
+	// no temporary uploads are left behind
+	entries, err := os.ReadDir(filepath.Join(dir, tempDir))
+	require.NoError(t, err)
+	assert.Len(t, entries, 0)
+}
+
+// errorReader fails if read
+type errorReader struct{}
+
+func (errorReader) Read([]byte) (int, error) {
+	return 0, errors.New("shouldn't be read")
+}
+
+func TestSkipUpload(t *testing.T) {
+	ctx := context.Background()
+	f, dir := newFs(t, "")
+	put(t, f, "a.txt", "hello")
+
+	// contents with a known hash already stored aren't read
+	hashes := map[hash.Type]string{hash.SHA256: "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"}
+	src := object.NewStaticObjectInfo("b.txt", t1, 5, true, hashes, nil)
+	_, err := f.Put(ctx, errorReader{}, src)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", read(t, f, "b.txt"))
+	assert.Equal(t, 1, blobs(t, dir))
+}
+
+func TestCopySnapshot(t *testing.T) {
+	ctx := context.Background()
+	f, dir := newFs(t, "")
+	put(t, f, "files/a.txt", "hello")
+	put(t, f, "files/b.txt", "world")
+
+	// copying a directory only writes manifests
+	src, err := fs.NewFs(ctx, fmt.Sprintf(`:cas,remote="%s":files`, dir))
+	require.NoError(t, err)
+	dst, err := fs.NewFs(ctx, fmt.Sprintf(`:cas,remote="%s":snapshots/1`, dir))
+	require.NoError(t, err)
+	for _, remote := range []string{"a.txt", "b.txt"} {
+		o, err := src.NewObject(ctx, remote)
+		require.NoError(t, err)
+		_, err = dst.Features().Copy(ctx, o, remote)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 2, blobs(t, dir))
+
+	// changing the original doesn't change the snapshot
+	put(t, f, "files/a.txt", "changed")
+	assert.Equal(t, "changed", read(t, src, "a.txt"))
+	assert.Equal(t, "hello", read(t, dst, "a.txt"))
+}
+
+func TestGC(t *testing.T) {
+	ctx := context.Background()
+	f, dir := newFs(t, "")
+	put(t, f, "a.txt", "hello")
+	put(t, f, "b.txt", "hello")
+	put(t, f, "c.txt", "world")
+	for _, remote := range []string{"a.txt", "c.txt"} {
+		o, err := f.NewObject(ctx, remote)
+		require.NoError(t, err)
+		require.NoError(t, o.Remove(ctx))
+	}
+	assert.Equal(t, 2, blobs(t, dir))
+
+	// recent contents are kept
+	out, err := f.Command(ctx, "gc", nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, &gcStats{Kept: 2}, out)
+	assert.Equal(t, 2, blobs(t, dir))
+
+	out, err = f.Command(ctx, "gc", nil, map[string]string{"age": "0"})
+	require.NoError(t, err)
+	assert.Equal(t, &gcStats{Kept: 1, Removed: 1, RemovedBytes: 5}, out)
+	assert.Equal(t, 1, blobs(t, dir))
+	assert.Equal(t, "hello", read(t, f, "b.txt"))
+
+	// an unreadable manifest stops gc removing anything
+	require.NoError(t, os.WriteFile(filepath.Join(dir, manifestsDir, "bad.txt"), []byte("potato"), 0666))
+	o, err := f.NewObject(ctx, "b.txt")
+	require.NoError(t, err)
+	require.NoError(t, operations.DeleteFile(ctx, o))
+	_, err = f.Command(ctx, "gc", nil, map[string]string{"age": "0"})
+	assert.Error(t, err)
+	assert.Equal(t, 1, blobs(t, dir))
+}
+
+func TestBadManifest(t *testing.T) {
+	ctx := context.Background()
+	f, dir := newFs(t, "")
+	put(t, f, "a.txt", "hello")
+
+	// a store written with a different hash can't be read
+	f2, err := fs.NewFs(ctx, fmt.Sprintf(`:cas,remote="%s",hash_type=sha1:`, dir))
+	require.NoError(t, err)
+	o, err := f2.NewObject(ctx, "a.txt")
+	require.NoError(t, err)
+	_, err = o.Open(ctx)
+	assert.ErrorContains(t, err, "hash_type")
+}
+
+func TestGCReused(t *testing.T) {
+	ctx := context.Background()
+	f, dir := newFs(t, "")
+	o := put(t, f, "a.txt", "hello")
+	require.NoError(t, o.Remove(ctx))
+
+	// make the unreferenced contents old
+	sum := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	blob := filepath.Join(dir, objectsDir, sum[:2], sum[2:])
+	old := time.Now().Add(-2 * time.Hour)
+	require.NoError(t, os.Chtimes(blob, old, old))
+
+	// reusing the contents refreshes their modification time so gc
+	// doesn't remove them
+	put(t, f, "b.txt", "hello")
+	info, err := os.Stat(blob)
+	require.NoError(t, err)
+	assert.True(t, info.ModTime().After(old.Add(time.Hour)))
+	require.NoError(t, os.Remove(filepath.Join(dir, manifestsDir, "b.txt")))
+	out, err := f.Command(ctx, "gc", nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, &gcStats{Kept: 1}, out)
+	assert.Equal(t, 1, blobs(t, dir))
+
+	// the same happens when the upload is skipped
+	require.NoError(t, os.Chtimes(blob, old, old))
+	hashes := map[hash.Type]string{hash.SHA256: sum}
+	src := object.NewStaticObjectInfo("c.txt", t1, 5, true, hashes, nil)
+	_, err = f.Put(ctx, errorReader{}, src)
+	require.NoError(t, err)
+	info, err = os.Stat(blob)
+	require.NoError(t, err)
+	assert.True(t, info.ModTime().After(old.Add(time.Hour)))
+}
+
+func TestSizeLazy(t *testing.T) {
+	ctx := context.Background()
+	f, dir := newFs(t, "")
+	put(t, f, "a.txt", "hello")
+	put(t, f, "b.txt", "hello world")
+	entries, err := f.List(ctx, "")
+	require.NoError(t, err)
+	require.Equal(t, 2, len(entries))
+	sort.Sort(entries)
+
+	// the manifests are only read when the size is needed and
+	// are kept once read
+	assert.Equal(t, int64(5), entries[0].Size())
+	require.NoError(t, os.RemoveAll(filepath.Join(dir, manifestsDir)))
+	assert.Equal(t, int64(5), entries[0].Size())
+	assert.Equal(t, int64(-1), entries[1].Size())
+
+	// a manifest which can't be read has an unknown size
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, manifestsDir), 0777))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, manifestsDir, "bad.txt"), []byte("potato"), 0666))
+	o, err := f.NewObject(ctx, "bad.txt")
+	require.NoError(t, err)
+	assert.Equal(t, int64(-1), o.Size())
+}
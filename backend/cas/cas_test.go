@@ -0,0 +1,53 @@
+// Test the cas backend on a local store
+package cas_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rclone/rclone/backend/cas"
+	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/fstest/fstests"
+
+	_ "github.com/rclone/rclone/backend/all" // for integration tests
+)
+
+// TestIntegration runs integration tests against the remote
+func TestIntegration(t *testing.T) {
+	opt := fstests.Opt{
+		RemoteName: *fstest.RemoteName,
+		NilObject:  (*cas.Object)(nil),
+		UnimplementableFsMethods: []string{
+			"OpenWriterAt",
+			"OpenChunkWriter",
+			"PutUnchecked",
+			"ListR",
+			"HardLink",
+			"MkdirMetadata",
+			"ChangeNotify",
+			"DirCacheFlush",
+			"PublicLink",
+			"MergeDirs",
+			"DirSetModTime",
+			"CleanUp",
+			"UserInfo",
+			"Disconnect",
+		},
+		UnimplementableObjectMethods: []string{
+			"ID",
+			"SetTier",
+			"GetTier",
+		},
+	}
+	if *fstest.RemoteName == "" {
+		tempDir := filepath.Join(os.TempDir(), "rclone-cas-test")
+		opt.ExtraConfig = []fstests.ExtraConfigItem{
+			{Name: "TestCas", Key: "type", Value: "cas"},
+			{Name: "TestCas", Key: "remote", Value: tempDir},
+		}
+		opt.RemoteName = "TestCas:"
+		opt.QuickTestOK = true
+	}
+	fstests.Run(t, &opt)
+}
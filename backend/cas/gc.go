@@ -0,0 +1,174 @@
+package cas
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fs/walk"
+	"golang.org/x/sync/errgroup"
+)
+
+var commandHelp = []fs.CommandHelp{{
+	Name:  "gc",
+	Short: "Remove the contents of files no longer referenced.",
+	Long: `This reads all the manifests in the store and removes the stored
+contents which no manifest refers to, along with any abandoned
+uploads.
+
+Usage Example:
+
+    rclone backend gc cas:
+    rclone backend gc -o age=24h cas:
+    rclone backend gc --dry-run cas:
+
+This works on the whole store, not just the path given, as contents
+are shared between all the paths in it.
+
+Only contents stored longer ago than the "age" option (default 1h)
+are removed so uploads in progress aren't removed before their
+manifests are written. Contents reused by a file since being stored
+are kept too as their modification time is refreshed. If the store
+can't set modification times don't run gc while files are written.
+
+It returns the number of contents kept and removed and the bytes
+freed.
+`,
+	Opts: map[string]string{
+		"age": "Only remove contents stored longer ago than this (default 1h)",
+	},
+}}
+
+// Command the backend to run a named command
+//
+// The command run is name
+// args may be used to read arguments from
+// opts may be used to read optional arguments from
+//
+// The result should be capable of being JSON encoded
+// If it is a string or a []string it will be shown to the user
+// otherwise it will be JSON encoded and shown to the user like that
+func (f *Fs) Command(ctx context.Context, name string, arg []string, opt map[string]string) (out interface{}, err error) {
+	switch name {
+	case "gc":
+		age := time.Hour
+		if s, ok := opt["age"]; ok {
+			age, err = fs.ParseDuration(s)
+			if err != nil {
+				return nil, fmt.Errorf("bad age: %w", err)
+			}
+		}
+		return f.gc(ctx, age)
+	default:
+		return nil, fs.ErrorCommandNotFound
+	}
+}
+
+// gcStats is the result of the gc command
+type gcStats struct {
+	Kept         int64 `json:"kept"`
+	Removed      int64 `json:"removed"`
+	RemovedBytes int64 `json:"removedBytes"`
+}
+
+// referenced returns the set of hashes the manifests in the store
+// refer to
+//
+// It fails if any manifest can't be read so that contents still in use
+// are never removed.
+func (f *Fs) referenced(ctx context.Context) (map[string]struct{}, error) {
+	var (
+		mu   sync.Mutex
+		refs = map[string]struct{}{}
+	)
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(fs.GetConfig(ctx).Checkers)
+	err := walk.ListR(ctx, f.store, manifestsDir, true, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+		entries.ForObject(func(mo fs.Object) {
+			g.Go(func() error {
+				m, err := f.readManifest(gCtx, mo)
+				if err != nil {
+					return fmt.Errorf("%q: %w", mo.Remote(), err)
+				}
+				mu.Lock()
+				refs[m.Hash] = struct{}{}
+				mu.Unlock()
+				return nil
+			})
+		})
+		return nil
+	})
+	if errors.Is(err, fs.ErrorDirNotFound) {
+		err = nil
+	}
+	if gErr := g.Wait(); err == nil {
+		err = gErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifests: %w", err)
+	}
+	return refs, nil
+}
+
+// gc removes the contents not referenced by any manifest and
+// abandoned uploads stored longer than age ago
+func (f *Fs) gc(ctx context.Context, age time.Duration) (*gcStats, error) {
+	refs, err := f.referenced(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cutoff := time.Now().Add(-age)
+	stats := new(gcStats)
+	var unreferenced []fs.Object
+	for _, dir := range []string{objectsDir, tempDir} {
+		err = walk.ListR(ctx, f.store, dir, true, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+			entries.ForObject(func(o fs.Object) {
+				if dir == objectsDir {
+					sum := strings.ReplaceAll(strings.TrimPrefix(o.Remote(), objectsDir+"/"), "/", "")
+					if _, found := refs[sum]; found {
+						stats.Kept++
+						return
+					}
+				}
+				if o.ModTime(ctx).After(cutoff) {
+					fs.Debugf(o, "cas: keeping unreferenced contents as too new")
+					stats.Kept++
+					return
+				}
+				unreferenced = append(unreferenced, o)
+			})
+			return nil
+		})
+		if err != nil && !errors.Is(err, fs.ErrorDirNotFound) {
+			return nil, fmt.Errorf("failed to list %q: %w", path.Join(f.opt.Remote, dir), err)
+		}
+	}
+	for _, o := range unreferenced {
+		// Contents reused by a file written since they were listed
+		// have had their modification time refreshed
+		o, err := f.store.NewObject(ctx, o.Remote())
+		if errors.Is(err, fs.ErrorObjectNotFound) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if o.ModTime(ctx).After(cutoff) {
+			fs.Debugf(o, "cas: keeping contents reused since listed")
+			stats.Kept++
+			continue
+		}
+		if err = operations.DeleteFile(ctx, o); err != nil {
+			return nil, err
+		}
+		stats.Removed++
+		stats.RemovedBytes += o.Size()
+	}
+	fs.Infof(f, "cas: kept %d and removed %d contents freeing %v", stats.Kept, stats.Removed, fs.SizeSuffix(stats.RemovedBytes))
+	return stats, nil
+}
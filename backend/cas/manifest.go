@@ -0,0 +1,175 @@
+package cas
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/object"
+)
+
+// system metadata stored in the manifest
+var systemMetadataInfo = map[string]fs.MetadataHelp{
+	"mtime": {
+		Help:    "Time of last modification",
+		Type:    "RFC 3339",
+		Example: "2006-01-02T15:04:05.999999999Z07:00",
+	},
+	"content-type": {
+		Help:    "MIME type of the object",
+		Type:    "string",
+		Example: "text/plain",
+	},
+}
+
+// manifest maps a path to the contents stored under their hash
+type manifest struct {
+	Version  int         `json:"version"`
+	HashType string      `json:"hash_type"`
+	Hash     string      `json:"hash"`
+	Size     int64       `json:"size"`
+	ModTime  time.Time   `json:"modtime"`
+	MimeType string      `json:"mime_type,omitempty"`
+	Metadata fs.Metadata `json:"metadata,omitempty"`
+}
+
+// clone returns a copy of m which can be changed independently
+func (m *manifest) clone() *manifest {
+	c := *m
+	if m.Metadata != nil {
+		c.Metadata = make(fs.Metadata, len(m.Metadata))
+		for k, v := range m.Metadata {
+			c.Metadata[k] = v
+		}
+	}
+	return &c
+}
+
+// setMetadata merges metadata into m
+func (m *manifest) setMetadata(metadata fs.Metadata) error {
+	for k, v := range metadata {
+		switch k {
+		case "mtime":
+			modTime, err := time.Parse(time.RFC3339Nano, v)
+			if err != nil {
+				return fmt.Errorf("failed to parse metadata %s: %q: %w", k, v, err)
+			}
+			m.ModTime = modTime
+		case "content-type":
+			m.MimeType = v
+		default:
+			if m.Metadata == nil {
+				m.Metadata = make(fs.Metadata, len(metadata))
+			}
+			m.Metadata[k] = v
+		}
+	}
+	return nil
+}
+
+// getMetadata returns the user and system metadata in m
+func (m *manifest) getMetadata() fs.Metadata {
+	metadata := make(fs.Metadata, len(m.Metadata)+2)
+	for k, v := range m.Metadata {
+		metadata[k] = v
+	}
+	metadata["mtime"] = m.ModTime.Format(time.RFC3339Nano)
+	if m.MimeType != "" {
+		metadata["content-type"] = m.MimeType
+	}
+	return metadata
+}
+
+// encode m for storing in the manifest object for remote
+func (f *Fs) encodeManifest(remote string, m *manifest) ([]byte, fs.ObjectInfo, error) {
+	m.Version = manifestVersion
+	m.HashType = f.hashType.String()
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	return data, object.NewStaticObjectInfo(remote, m.ModTime, int64(len(data)), true, nil, f.base), nil
+}
+
+// decodeManifest reads the manifest in data
+func (f *Fs) decodeManifest(data []byte) (*manifest, error) {
+	m := new(manifest)
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("failed to decode manifest: %w", err)
+	}
+	if m.Version != manifestVersion {
+		return nil, fmt.Errorf("unknown manifest version %d", m.Version)
+	}
+	if m.HashType != f.hashType.String() {
+		return nil, fmt.Errorf("manifest uses hash_type %q but remote is configured with %q", m.HashType, f.hashType)
+	}
+	if m.Hash == "" {
+		return nil, errors.New("manifest has no hash")
+	}
+	return m, nil
+}
+
+// putManifest writes the manifest m for remote
+func (f *Fs) putManifest(ctx context.Context, remote string, m *manifest) (*Object, error) {
+	data, info, err := f.encodeManifest(remote, m)
+	if err != nil {
+		return nil, err
+	}
+	mo, err := f.base.Put(ctx, bytes.NewReader(data), info)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return &Object{fs: f, mo: mo, m: m}, nil
+}
+
+// updateManifest replaces the manifest of o with m
+func (o *Object) updateManifest(ctx context.Context, m *manifest) error {
+	data, info, err := o.fs.encodeManifest(o.Remote(), m)
+	if err != nil {
+		return err
+	}
+	if err = o.mo.Update(ctx, bytes.NewReader(data), info); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	o.mu.Lock()
+	o.m = m
+	o.mu.Unlock()
+	return nil
+}
+
+// manifest returns the manifest of o, reading it if necessary
+func (o *Object) manifest(ctx context.Context) (*manifest, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.m != nil {
+		return o.m, nil
+	}
+	m, err := o.fs.readManifest(ctx, o.mo)
+	if err != nil {
+		return nil, fmt.Errorf("%q: %w", o.Remote(), err)
+	}
+	o.m = m
+	return m, nil
+}
+
+// readManifest reads the manifest in the object mo
+func (f *Fs) readManifest(ctx context.Context, mo fs.Object) (*manifest, error) {
+	in, err := mo.Open(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open manifest: %w", err)
+	}
+	var buf bytes.Buffer
+	_, err = buf.ReadFrom(in)
+	closeErr := in.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	if closeErr != nil {
+		return nil, fmt.Errorf("failed to close manifest: %w", closeErr)
+	}
+	return f.decodeManifest(buf.Bytes())
+}
@@ -181,6 +181,11 @@ type Cipher struct {
 	dirNameEncrypt  bool
 	passBadBlocks   bool // if set passed bad blocks as zeroed blocks
 	encryptedSuffix string
+	envelope        bool        // if set write files in the envelope format
+	recipients      []recipient // data keys are wrapped for these
+	identities      []identity  // data keys can be unwrapped with these
+	maxNameLength   int         // encrypted segments longer than this are shortened if > 0
+	longNames       longNames   // encrypted segments for short names
 }
 
 // newCipher initialises the cipher.  If salt is "" then it uses a built in salt val
@@ -199,6 +204,10 @@ func newCipher(mode NameEncryptionMode, password, salt string, dirNameEncrypt bo
 	if err != nil {
 		return nil, err
 	}
+	err = c.setEnvelope(false, false, nil, "")
+	if err != nil {
+		return nil, err
+	}
 	return c, nil
 }
 
@@ -520,6 +529,9 @@ func (c *Cipher) encryptFileName(in string) string {
 		if hasVersion {
 			segments[i] = version.Add(segments[i], t)
 		}
+
+		// Replace the segment with a short name if too long
+		segments[i] = c.shorten(segments[i])
 	}
 	return strings.Join(segments, "/")
 }
@@ -551,6 +563,12 @@ func (c *Cipher) decryptFileName(in string) (string, error) {
 			continue
 		}
 
+		// Replace a short name with the segment it stands for
+		segments[i], err = c.lengthen(segments[i])
+		if err != nil {
+			return "", err
+		}
+
 		// Strip version string so that only the non-versioned part
 		// of the file name gets decrypted/deobfuscated
 		hasVersion := false
@@ -682,6 +700,7 @@ type encrypter struct {
 	mu       sync.Mutex
 	in       io.Reader
 	c        *Cipher
+	header   *fileHeader
 	nonce    nonce
 	buf      *[blockSize]byte
 	readBuf  *[blockSize]byte
@@ -691,27 +710,27 @@ type encrypter struct {
 }
 
 // newEncrypter creates a new file handle encrypting on the fly
-func (c *Cipher) newEncrypter(in io.Reader, nonce *nonce) (*encrypter, error) {
+//
+// If header is nil then a new one is made with a random nonce.
+func (c *Cipher) newEncrypter(in io.Reader, header *fileHeader) (*encrypter, error) {
+	if header == nil {
+		var err error
+		header, err = c.newFileHeader()
+		if err != nil {
+			return nil, err
+		}
+	}
 	fh := &encrypter{
 		in:      in,
 		c:       c,
+		header:  header,
+		nonce:   header.nonce,
 		buf:     c.getBlock(),
 		readBuf: c.getBlock(),
-		bufSize: fileHeaderSize,
-	}
-	// Initialise nonce
-	if nonce != nil {
-		fh.nonce = *nonce
-	} else {
-		err := fh.nonce.fromReader(c.cryptoRand)
-		if err != nil {
-			return nil, err
-		}
+		bufSize: len(header.raw),
 	}
-	// Copy magic into buffer
-	copy((*fh.buf)[:], fileMagicBytes)
-	// Copy nonce into buffer
-	copy((*fh.buf)[fileMagicSize:], fh.nonce[:])
+	// Copy the header into buffer
+	copy((*fh.buf)[:], header.raw)
 	return fh, nil
 }
 
@@ -734,7 +753,7 @@ func (fh *encrypter) Read(p []byte) (n int, err error) {
 		// possibly err != nil here, but we will process the
 		// data and the next call to ReadFill will return 0, err
 		// Encrypt the block using the nonce
-		secretbox.Seal((*fh.buf)[:0], readBuf[:n], fh.nonce.pointer(), &fh.c.dataKey)
+		secretbox.Seal((*fh.buf)[:0], readBuf[:n], fh.nonce.pointer(), fh.header.key)
 		fh.bufIndex = 0
 		fh.bufSize = blockHeaderSize + n
 		fh.nonce.increment()
@@ -777,6 +796,7 @@ func (c *Cipher) EncryptData(in io.Reader) (io.Reader, error) {
 type decrypter struct {
 	mu           sync.Mutex
 	rc           io.ReadCloser
+	header       *fileHeader
 	nonce        nonce
 	initialNonce nonce
 	c            *Cipher
@@ -807,21 +827,47 @@ func (c *Cipher) newDecrypter(rc io.ReadCloser) (*decrypter, error) {
 	} else if err != io.EOF && err != nil {
 		return nil, fh.finishAndClose(err)
 	}
+	fh.header = &fileHeader{
+		key: &c.dataKey,
+	}
 	// check the magic
-	if !bytes.Equal(readBuf[:fileMagicSize], fileMagicBytes) {
+	switch {
+	case bytes.Equal(readBuf[:fileMagicSize], fileMagicBytes):
+	case bytes.Equal(readBuf[:fileMagicSize], envelopeMagicBytes):
+		// Read the rest of the envelope header and unwrap the data key
+		readBuf = (*fh.readBuf)[:envelopeHeaderSize]
+		n, err = readers.ReadFill(fh.rc, readBuf[fileHeaderSize:])
+		if n < envelopeHeaderSize-fileHeaderSize && err == io.EOF {
+			return nil, fh.finishAndClose(ErrorEncryptedFileTooShort)
+		} else if err != io.EOF && err != nil {
+			return nil, fh.finishAndClose(err)
+		}
+		fh.header.key, err = c.unwrapKey(readBuf)
+		if err != nil {
+			return nil, fh.finishAndClose(err)
+		}
+	default:
 		return nil, fh.finishAndClose(ErrorEncryptedBadMagic)
 	}
+	fh.header.raw = append([]byte(nil), readBuf...)
 	// retrieve the nonce
-	fh.nonce.fromBuf(readBuf[fileMagicSize:])
+	fh.header.nonce.fromBuf(readBuf[fileMagicSize:])
+	fh.nonce = fh.header.nonce
 	fh.initialNonce = fh.nonce
 	return fh, nil
 }
 
 // newDecrypterSeek creates a new file handle decrypting on the fly
-func (c *Cipher) newDecrypterSeek(ctx context.Context, open OpenRangeSeek, offset, limit int64) (fh *decrypter, err error) {
+//
+// headerSize is the size of the header of the file if known or 0 if
+// not, in which case enough is read for a header in either format.
+func (c *Cipher) newDecrypterSeek(ctx context.Context, open OpenRangeSeek, offset, limit, headerSize int64) (fh *decrypter, err error) {
 	var rc io.ReadCloser
 	doRangeSeek := false
 	setLimit := false
+	if headerSize <= 0 {
+		headerSize = envelopeHeaderSize
+	}
 	// Open initially with no seek
 	if offset == 0 && limit < 0 {
 		// If no offset or limit then open whole file
@@ -829,11 +875,11 @@ func (c *Cipher) newDecrypterSeek(ctx context.Context, open OpenRangeSeek, offse
 	} else if offset == 0 {
 		// If no offset open the header + limit worth of the file
 		_, underlyingLimit, _, _ := calculateUnderlying(offset, limit)
-		rc, err = open(ctx, 0, int64(fileHeaderSize)+underlyingLimit)
+		rc, err = open(ctx, 0, headerSize+underlyingLimit)
 		setLimit = true
 	} else {
 		// Otherwise just read the header to start with
-		rc, err = open(ctx, 0, int64(fileHeaderSize))
+		rc, err = open(ctx, 0, headerSize)
 		doRangeSeek = true
 	}
 	if err != nil {
@@ -877,7 +923,7 @@ func (fh *decrypter) fillBuffer() (err error) {
 		return ErrorEncryptedFileBadHeader
 	}
 	// Decrypt the block using the nonce
-	_, ok := secretbox.Open((*fh.buf)[:0], (*readBuf)[:n], fh.nonce.pointer(), &fh.c.dataKey)
+	_, ok := secretbox.Open((*fh.buf)[:0], (*readBuf)[:n], fh.nonce.pointer(), fh.header.key)
 	if !ok {
 		if err != nil && err != io.EOF {
 			return err // return pending error as it is likely more accurate
@@ -988,6 +1034,8 @@ func (fh *decrypter) RangeSeek(ctx context.Context, offset int64, whence int, li
 	}
 
 	underlyingOffset, underlyingLimit, discard, blocks := calculateUnderlying(offset, limit)
+	// Allow for envelope headers being bigger than the standard header
+	underlyingOffset += int64(len(fh.header.raw) - fileHeaderSize)
 
 	// Move the nonce on the correct number of blocks from the start
 	fh.nonce = fh.initialNonce
@@ -1110,26 +1158,40 @@ func (c *Cipher) DecryptData(rc io.ReadCloser) (io.ReadCloser, error) {
 //
 // You must use this form of DecryptData if you might want to Seek the file handle
 func (c *Cipher) DecryptDataSeek(ctx context.Context, open OpenRangeSeek, offset, limit int64) (ReadSeekCloser, error) {
-	out, err := c.newDecrypterSeek(ctx, open, offset, limit)
+	return c.decryptDataSeek(ctx, open, offset, limit, 0)
+}
+
+// decryptDataSeek is DecryptDataSeek for a file whose header is
+// headerSize bytes long, or 0 if that isn't known
+func (c *Cipher) decryptDataSeek(ctx context.Context, open OpenRangeSeek, offset, limit, headerSize int64) (ReadSeekCloser, error) {
+	out, err := c.newDecrypterSeek(ctx, open, offset, limit, headerSize)
 	if err != nil {
 		return nil, err
 	}
 	return out, nil
 }
 
-// EncryptedSize calculates the size of the data when encrypted
+// EncryptedSize calculates the size of the data when encrypted in the
+// format the cipher writes new files in
 func (c *Cipher) EncryptedSize(size int64) int64 {
 	blocks, residue := size/blockDataSize, size%blockDataSize
-	encryptedSize := int64(fileHeaderSize) + blocks*(blockHeaderSize+blockDataSize)
+	encryptedSize := c.headerSize() + blocks*(blockHeaderSize+blockDataSize)
 	if residue != 0 {
 		encryptedSize += blockHeaderSize + residue
 	}
 	return encryptedSize
 }
 
-// DecryptedSize calculates the size of the data when decrypted
+// DecryptedSize calculates the size of the data when decrypted for a
+// file in the standard format
 func (c *Cipher) DecryptedSize(size int64) (int64, error) {
-	size -= int64(fileHeaderSize)
+	return c.decryptedSize(size, int64(fileHeaderSize))
+}
+
+// decryptedSize calculates the size of the data when decrypted for a
+// file with a header of headerSize bytes
+func (c *Cipher) decryptedSize(size int64, headerSize int64) (int64, error) {
+	size -= headerSize
 	if size < 0 {
 		return 0, ErrorEncryptedFileTooShort
 	}
@@ -1345,7 +1345,7 @@ func TestNewDecrypterSeekLimit(t *testing.T) {
 			if offset+limit > len(plaintext) {
 				continue
 			}
-			rc, err := c.DecryptDataSeek(context.Background(), open, int64(offset), int64(limit))
+			rc, err := c.decryptDataSeek(context.Background(), open, int64(offset), int64(limit), int64(fileHeaderSize))
 			assert.NoError(t, err)
 
 			check(rc, offset, limit)
@@ -3,11 +3,13 @@ package crypt
 
 import (
 	"context"
+	"crypto/rand"
 	"errors"
 	"fmt"
 	"io"
 	"path"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/rclone/rclone/fs"
@@ -171,6 +173,83 @@ Setting suffix to "none" will result in an empty suffix. This may be useful
 when the path length is critical.`,
 			Default:  ".bin",
 			Advanced: true,
+		}, {
+			Name: "max_name_length",
+			Help: `Maximum length of an encrypted file or directory name.
+
+Encrypted names are longer than the names they encrypt, so they may
+exceed the limit on name length of the remote (often 255 bytes).
+
+If this is set then any encrypted name longer than this many bytes is
+stored under a short name made from a hash of it, with a small sidecar
+object holding the full encrypted name next to it. These are resolved
+transparently when listing.
+
+Set to 0 to disable. Files stored with short names can still be read
+when this is 0.`,
+			Default:  0,
+			Advanced: true,
+		}, {
+			Name: "envelope",
+			Help: `If set, write files in the envelope format.
+
+In the envelope format each file is encrypted with its own random key
+which is stored in the file header wrapped for each of the recipients.
+The recipients are the password (unless envelope_no_password is set)
+and the keys in envelope_recipients.
+
+Files in either format can be read whether or not this is set. Use
+the "rewrap" backend command to convert existing files to the
+envelope format.`,
+			Default:  false,
+			Advanced: true,
+		}, {
+			Name: "envelope_recipients",
+			Help: `Comma separated list of public keys to wrap file keys for.
+
+These are X25519 public keys as made by the "keygen" backend command
+and look like "x25519-pub:..."
+
+Anyone with the matching private key can decrypt the file data.`,
+			Default:  fs.CommaSepList{},
+			Advanced: true,
+		}, {
+			Name: "envelope_private_key",
+			Help: `Private key to unwrap file keys with.
+
+This is an X25519 private key as made by the "keygen" backend command
+and looks like "x25519-key:..."
+
+It can decrypt files wrapped for the matching public key in
+envelope_recipients.`,
+			IsPassword: true,
+			Advanced:   true,
+		}, {
+			Name: "envelope_no_password",
+			Help: `If set, don't wrap file keys for the password.
+
+Use this to write files which can only be decrypted with the private
+keys matching envelope_recipients, for example on a machine which
+should be able to upload but not read back.
+
+File names are still encrypted with the password.`,
+			Default:  false,
+			Advanced: true,
+		}, {
+			Name: "envelope_detect",
+			Help: `If set, read the header of each file to find its size.
+
+Files in the envelope format have a bigger header than files in the
+standard format, so the size of a file can't always be worked out
+from the size of the encrypted file without knowing its format. When
+the size fits either format this reads the start of the file the
+first time its size is needed, which takes a request per file.
+
+This is always done if envelope or envelope_private_key are set, so
+only needs setting on remotes without them which read files written
+in the envelope format by other remotes.`,
+			Default:  false,
+			Advanced: true,
 		}},
 	})
 }
@@ -205,6 +284,21 @@ func newCipherForConfig(opt *Options) (*Cipher, error) {
 	}
 	cipher.setEncryptedSuffix(opt.Suffix)
 	cipher.setPassBadBlocks(opt.PassBadBlocks)
+	var privateKey string
+	if opt.EnvelopePrivateKey != "" {
+		privateKey, err = obscure.Reveal(opt.EnvelopePrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt envelope_private_key: %w", err)
+		}
+	}
+	err = cipher.setMaxNameLength(opt.MaxNameLength)
+	if err != nil {
+		return nil, err
+	}
+	err = cipher.setEnvelope(opt.Envelope, opt.EnvelopeNoPassword, opt.EnvelopeRecipients, privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("bad envelope config: %w", err)
+	}
 	return cipher, nil
 }
 
@@ -255,13 +349,7 @@ func NewFs(ctx context.Context, name, rpath string, m configmap.Mapper) (fs.Fs,
 	if err != fs.ErrorIsFile && err != nil {
 		return nil, fmt.Errorf("failed to make remote %q to wrap: %w", remote, err)
 	}
-	f := &Fs{
-		Fs:     wrappedFs,
-		name:   name,
-		root:   rpath,
-		opt:    *opt,
-		cipher: cipher,
-	}
+	f := wrapFs(ctx, wrappedFs, name, rpath, opt, cipher)
 	cache.PinUntilFinalized(f.Fs, f)
 	// Correct root if definitely pointing to a file
 	if err == fs.ErrorIsFile {
@@ -270,6 +358,18 @@ func NewFs(ctx context.Context, name, rpath string, m configmap.Mapper) (fs.Fs,
 			f.root = ""
 		}
 	}
+	return f, err
+}
+
+// wrapFs makes an Fs encrypting wrappedFs with cipher
+func wrapFs(ctx context.Context, wrappedFs fs.Fs, name, root string, opt *Options, cipher *Cipher) *Fs {
+	f := &Fs{
+		Fs:     wrappedFs,
+		name:   name,
+		root:   root,
+		opt:    *opt,
+		cipher: cipher,
+	}
 	// the features here are ones we could support, and they are
 	// ANDed with the ones from wrappedFs
 	f.features = (&fs.Features{
@@ -292,24 +392,29 @@ func NewFs(ctx context.Context, name, rpath string, m configmap.Mapper) (fs.Fs,
 		DirModTimeUpdatesOnWrite: true,
 		PartialUploads:           true,
 	}).Fill(ctx, f).Mask(ctx, wrappedFs).WrapsFs(f, wrappedFs)
-
-	return f, err
+	return f
 }
 
 // Options defines the configuration for this backend
 type Options struct {
-	Remote                  string `config:"remote"`
-	FilenameEncryption      string `config:"filename_encryption"`
-	DirectoryNameEncryption bool   `config:"directory_name_encryption"`
-	NoDataEncryption        bool   `config:"no_data_encryption"`
-	Password                string `config:"password"`
-	Password2               string `config:"password2"`
-	ServerSideAcrossConfigs bool   `config:"server_side_across_configs"`
-	ShowMapping             bool   `config:"show_mapping"`
-	PassBadBlocks           bool   `config:"pass_bad_blocks"`
-	FilenameEncoding        string `config:"filename_encoding"`
-	Suffix                  string `config:"suffix"`
-	StrictNames             bool   `config:"strict_names"`
+	Remote                  string          `config:"remote"`
+	FilenameEncryption      string          `config:"filename_encryption"`
+	DirectoryNameEncryption bool            `config:"directory_name_encryption"`
+	NoDataEncryption        bool            `config:"no_data_encryption"`
+	Password                string          `config:"password"`
+	Password2               string          `config:"password2"`
+	ServerSideAcrossConfigs bool            `config:"server_side_across_configs"`
+	ShowMapping             bool            `config:"show_mapping"`
+	PassBadBlocks           bool            `config:"pass_bad_blocks"`
+	FilenameEncoding        string          `config:"filename_encoding"`
+	Suffix                  string          `config:"suffix"`
+	StrictNames             bool            `config:"strict_names"`
+	MaxNameLength           int             `config:"max_name_length"`
+	Envelope                bool            `config:"envelope"`
+	EnvelopeRecipients      fs.CommaSepList `config:"envelope_recipients"`
+	EnvelopePrivateKey      string          `config:"envelope_private_key"`
+	EnvelopeNoPassword      bool            `config:"envelope_no_password"`
+	EnvelopeDetect          bool            `config:"envelope_detect"`
 }
 
 // Fs represents a wrapped fs.Fs
@@ -321,6 +426,7 @@ type Fs struct {
 	opt      Options
 	features *fs.Features // optional features
 	cipher   *Cipher
+	sidecars sidecars // long name sidecars known to exist
 }
 
 // Name of the remote (as passed into NewFs)
@@ -385,6 +491,16 @@ func (f *Fs) encryptEntries(ctx context.Context, entries fs.DirEntries) (newEntr
 	errors := 0
 	var firsterr error
 	for _, entry := range entries {
+		remote := entry.Remote()
+		if _, isObject := entry.(fs.Object); isObject && isSidecar(path.Base(remote)) {
+			f.sidecars.setKnown(remote, true)
+			continue
+		}
+		// Read the sidecars for any long names - if they can't be
+		// read the name is reported as undecryptable below
+		if err := f.resolveLongNames(ctx, remote); err != nil {
+			fs.Debugf(remote, "Failed to read long name: %v", err)
+		}
 		switch x := entry.(type) {
 		case fs.Object:
 			err = f.add(&newEntries, x)
@@ -464,8 +580,13 @@ type putFn func(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ..
 func (f *Fs) put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options []fs.OpenOption, put putFn) (fs.Object, error) {
 	ci := fs.GetConfig(ctx)
 
+	err := f.writeLongNames(ctx, f.cipher.EncryptFileName(src.Remote()))
+	if err != nil {
+		return nil, err
+	}
+
 	if f.opt.NoDataEncryption {
-		o, err := put(ctx, in, f.newObjectInfo(src, nonce{}), options...)
+		o, err := put(ctx, in, f.newObjectInfo(src, nil), options...)
 		if err == nil && o != nil {
 			o = f.newObject(o)
 		}
@@ -500,7 +621,7 @@ func (f *Fs) put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options [
 	}
 
 	// Transfer the data
-	o, err := put(ctx, wrappedIn, f.newObjectInfo(src, encrypter.nonce), options...)
+	o, err := put(ctx, wrappedIn, f.newObjectInfo(src, encrypter.header), options...)
 	if err != nil {
 		return nil, err
 	}
@@ -552,7 +673,12 @@ func (f *Fs) Hashes() hash.Set {
 //
 // Shouldn't return an error if it already exists
 func (f *Fs) Mkdir(ctx context.Context, dir string) error {
-	return f.Fs.Mkdir(ctx, f.cipher.EncryptDirName(dir))
+	encryptedDir := f.cipher.EncryptDirName(dir)
+	err := f.writeLongNames(ctx, encryptedDir)
+	if err != nil {
+		return err
+	}
+	return f.Fs.Mkdir(ctx, encryptedDir)
 }
 
 // MkdirMetadata makes the root directory of the Fs object
@@ -561,7 +687,12 @@ func (f *Fs) MkdirMetadata(ctx context.Context, dir string, metadata fs.Metadata
 	if do == nil {
 		return nil, fs.ErrorNotImplemented
 	}
-	newDir, err := do(ctx, f.cipher.EncryptDirName(dir), metadata)
+	encryptedDir := f.cipher.EncryptDirName(dir)
+	err := f.writeLongNames(ctx, encryptedDir)
+	if err != nil {
+		return nil, err
+	}
+	newDir, err := do(ctx, encryptedDir, metadata)
 	if err != nil {
 		return nil, err
 	}
@@ -590,7 +721,12 @@ func (f *Fs) DirSetModTime(ctx context.Context, dir string, modTime time.Time) e
 //
 // Return an error if it doesn't exist or isn't empty
 func (f *Fs) Rmdir(ctx context.Context, dir string) error {
-	return f.Fs.Rmdir(ctx, f.cipher.EncryptDirName(dir))
+	encryptedDir := f.cipher.EncryptDirName(dir)
+	err := f.Fs.Rmdir(ctx, encryptedDir)
+	if err != nil {
+		return err
+	}
+	return f.removeLongName(ctx, encryptedDir)
 }
 
 // Purge all files in the directory specified
@@ -604,7 +740,12 @@ func (f *Fs) Purge(ctx context.Context, dir string) error {
 	if do == nil {
 		return fs.ErrorCantPurge
 	}
-	return do(ctx, f.cipher.EncryptDirName(dir))
+	encryptedDir := f.cipher.EncryptDirName(dir)
+	err := do(ctx, encryptedDir)
+	if err != nil {
+		return err
+	}
+	return f.removeLongName(ctx, encryptedDir)
 }
 
 // Copy src to this remote using server-side copy operations.
@@ -625,11 +766,16 @@ func (f *Fs) Copy(ctx context.Context, src fs.Object, remote string) (fs.Object,
 	if !ok {
 		return nil, fs.ErrorCantCopy
 	}
-	oResult, err := do(ctx, o.Object, f.cipher.EncryptFileName(remote))
+	encryptedRemote := f.cipher.EncryptFileName(remote)
+	err := f.writeLongNames(ctx, encryptedRemote)
+	if err != nil {
+		return nil, err
+	}
+	oResult, err := do(ctx, o.Object, encryptedRemote)
 	if err != nil {
 		return nil, err
 	}
-	return f.newObject(oResult), nil
+	return f.newObjectWithHeader(oResult, o), nil
 }
 
 // Move src to this remote using server-side move operations.
@@ -650,11 +796,23 @@ func (f *Fs) Move(ctx context.Context, src fs.Object, remote string) (fs.Object,
 	if !ok {
 		return nil, fs.ErrorCantMove
 	}
-	oResult, err := do(ctx, o.Object, f.cipher.EncryptFileName(remote))
+	encryptedRemote := f.cipher.EncryptFileName(remote)
+	err := f.writeLongNames(ctx, encryptedRemote)
 	if err != nil {
 		return nil, err
 	}
-	return f.newObject(oResult), nil
+	srcRemote := o.Object.Remote()
+	oResult, err := do(ctx, o.Object, encryptedRemote)
+	if err != nil {
+		return nil, err
+	}
+	if srcRemote != encryptedRemote || o.f != f {
+		err = o.f.removeLongName(ctx, srcRemote)
+		if err != nil {
+			fs.Errorf(o, "Failed to tidy up after move: %v", err)
+		}
+	}
+	return f.newObjectWithHeader(oResult, o), nil
 }
 
 // DirMove moves src, srcRemote to this remote at dstRemote
@@ -675,7 +833,21 @@ func (f *Fs) DirMove(ctx context.Context, src fs.Fs, srcRemote, dstRemote string
 		fs.Debugf(srcFs, "Can't move directory - not same remote type")
 		return fs.ErrorCantDirMove
 	}
-	return do(ctx, srcFs.Fs, f.cipher.EncryptDirName(srcRemote), f.cipher.EncryptDirName(dstRemote))
+	encryptedSrcRemote := srcFs.cipher.EncryptDirName(srcRemote)
+	encryptedDstRemote := f.cipher.EncryptDirName(dstRemote)
+	err := f.writeLongNames(ctx, encryptedDstRemote)
+	if err != nil {
+		return err
+	}
+	err = do(ctx, srcFs.Fs, encryptedSrcRemote, encryptedDstRemote)
+	if err != nil {
+		return err
+	}
+	err = srcFs.removeLongName(ctx, encryptedSrcRemote)
+	if err != nil {
+		fs.Errorf(srcFs, "Failed to tidy up after directory move: %v", err)
+	}
+	return nil
 }
 
 // PutUnchecked uploads the object
@@ -687,11 +859,15 @@ func (f *Fs) PutUnchecked(ctx context.Context, in io.Reader, src fs.ObjectInfo,
 	if do == nil {
 		return nil, errors.New("can't PutUnchecked")
 	}
+	err := f.writeLongNames(ctx, f.cipher.EncryptFileName(src.Remote()))
+	if err != nil {
+		return nil, err
+	}
 	wrappedIn, encrypter, err := f.cipher.encryptData(in)
 	if err != nil {
 		return nil, err
 	}
-	o, err := do(ctx, wrappedIn, f.newObjectInfo(src, encrypter.nonce))
+	o, err := do(ctx, wrappedIn, f.newObjectInfo(src, encrypter.header))
 	if err != nil {
 		return nil, err
 	}
@@ -744,11 +920,12 @@ func (f *Fs) DecryptFileName(encryptedFileName string) (string, error) {
 	return f.cipher.DecryptFileName(encryptedFileName)
 }
 
-// computeHashWithNonce takes the nonce and encrypts the contents of
-// src with it, and calculates the hash given by HashType on the fly
+// computeHashWithHeader takes the file header and encrypts the
+// contents of src with it, and calculates the hash given by HashType
+// on the fly
 //
 // Note that we break lots of encapsulation in this function.
-func (f *Fs) computeHashWithNonce(ctx context.Context, nonce nonce, src fs.Object, hashType hash.Type) (hashStr string, err error) {
+func (f *Fs) computeHashWithHeader(ctx context.Context, header *fileHeader, src fs.Object, hashType hash.Type) (hashStr string, err error) {
 	// Open the src for input
 	in, err := src.Open(ctx)
 	if err != nil {
@@ -756,8 +933,8 @@ func (f *Fs) computeHashWithNonce(ctx context.Context, nonce nonce, src fs.Objec
 	}
 	defer fs.CheckClose(in, &err)
 
-	// Now encrypt the src with the nonce
-	out, err := f.cipher.newEncrypter(in, &nonce)
+	// Now encrypt the src with the header
+	out, err := f.cipher.newEncrypter(in, header)
 	if err != nil {
 		return "", fmt.Errorf("failed to make encrypter: %w", err)
 	}
@@ -785,8 +962,9 @@ func (f *Fs) ComputeHash(ctx context.Context, o *Object, src fs.Object, hashType
 	}
 
 	// Read the nonce - opening the file is sufficient to read the nonce in
-	// use a limited read so we only read the header
-	in, err := o.Object.Open(ctx, &fs.RangeOption{Start: 0, End: int64(fileHeaderSize) - 1})
+	// use a limited read so we only read the header, which may be
+	// in either format
+	in, err := o.Object.Open(ctx, &fs.RangeOption{Start: 0, End: envelopeHeaderSize - 1})
 	if err != nil {
 		return "", fmt.Errorf("failed to open object to read nonce: %w", err)
 	}
@@ -795,7 +973,8 @@ func (f *Fs) ComputeHash(ctx context.Context, o *Object, src fs.Object, hashType
 		_ = in.Close()
 		return "", fmt.Errorf("failed to open object to read nonce: %w", err)
 	}
-	nonce := d.nonce
+	header := d.header
+	nonce := header.nonce
 	// fs.Debugf(o, "Read nonce % 2x", nonce)
 
 	// Check nonce isn't all zeros
@@ -815,7 +994,7 @@ func (f *Fs) ComputeHash(ctx context.Context, o *Object, src fs.Object, hashType
 		return "", fmt.Errorf("failed to close nonce read: %w", err)
 	}
 
-	return f.computeHashWithNonce(ctx, nonce, src, hashType)
+	return f.computeHashWithHeader(ctx, header, src, hashType)
 }
 
 // MergeDirs merges the contents of all the directories passed
@@ -913,6 +1092,66 @@ Usage Example:
     rclone rc backend/command command=decode fs=crypt: encryptedfile1 [encryptedfile2...]
 `,
 	},
+	{
+		Name:  "keygen",
+		Short: "Generate a key pair for envelope encryption",
+		Long: `This generates a new X25519 key pair for use with envelope
+encryption and returns it.
+
+Add the public key to envelope_recipients on the remotes which should
+encrypt files for it and set the private key as envelope_private_key
+on the remotes which should be able to decrypt them.
+
+Usage Example:
+
+    rclone backend keygen crypt:
+`,
+	},
+	{
+		Name:  "rewrap",
+		Short: "Rewrap file keys for the current recipients",
+		Long: `This rewrites the headers of the files in the envelope format in the
+given directories (or the whole remote if none are given) so that
+their file keys are wrapped for the currently configured recipients.
+
+Use this after changing envelope_recipients or envelope_no_password to
+grant or revoke access to existing files. The file data isn't
+re-encrypted, so this is much quicker than copying the files again.
+
+If the underlying remote can write files in place (eg local or sftp)
+only the header of each file is written, otherwise each file is
+uploaded again with the new header. The new file is uploaded under a
+temporary name then moved over the old one.
+
+Files in the standard format are encrypted again with a new file key
+in the envelope format, so this can be used to convert existing files
+to the envelope format.
+
+Use the "new_password" option to change the password. The file keys
+are wrapped with the new password and the file and directory names
+are encrypted with it, so the files are renamed on the underlying
+remote. Afterwards update the password in the config to read them.
+
+Note that revoking a recipient this way only stops it decrypting the
+files from the remote - anyone who has already unwrapped a file key
+could still decrypt old copies of the file.
+
+Usage Example:
+
+    rclone backend rewrap crypt: [dir1 dir2...]
+    rclone backend rewrap -o new_password=secret crypt:
+    rclone rc backend/command command=rewrap fs=crypt: [dir1 dir2...]
+
+Use the --dry-run flag to see which files would be rewritten.
+
+It returns the number of files rewrapped, re-encrypted from the
+standard format, skipped and which had errors.
+`,
+		Opts: map[string]string{
+			"new_password":  "Password to rewrap the files for and encrypt their names with",
+			"new_password2": "Salt to use with new_password - the old salt is kept if not set",
+		},
+	},
 }
 
 // Command the backend to run a named command
@@ -943,6 +1182,17 @@ func (f *Fs) Command(ctx context.Context, name string, arg []string, opt map[str
 			out = append(out, encryptedFileName)
 		}
 		return out, nil
+	case "keygen":
+		publicKey, privateKey, err := generateKeys(rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate keys: %w", err)
+		}
+		return map[string]string{
+			"public_key":  publicKey,
+			"private_key": privateKey,
+		}, nil
+	case "rewrap":
+		return f.rewrap(ctx, arg, opt)
 	default:
 		return nil, fs.ErrorCommandNotFound
 	}
@@ -953,13 +1203,28 @@ func (f *Fs) Command(ctx context.Context, name string, arg []string, opt map[str
 // This decrypts the remote name and decrypts the data
 type Object struct {
 	fs.Object
-	f *Fs
+	f          *Fs
+	remote     string     // decrypted name of the object
+	mu         sync.Mutex // protects headerSize
+	headerSize int64      // size of the file header or 0 if not known
 }
 
+// newObject wraps o, decrypting its name
+//
+// The name is decrypted now as decrypting long names needs their
+// sidecars, which are only remembered for a while after being read.
 func (f *Fs) newObject(o fs.Object) *Object {
+	remote := o.Remote()
+	decryptedName, err := f.cipher.DecryptFileName(remote)
+	if err != nil {
+		fs.Debugf(remote, "Undecryptable file name: %v", err)
+	} else {
+		remote = decryptedName
+	}
 	return &Object{
 		Object: o,
 		f:      f,
+		remote: remote,
 	}
 }
 
@@ -978,21 +1243,35 @@ func (o *Object) String() string {
 
 // Remote returns the remote path
 func (o *Object) Remote() string {
-	remote := o.Object.Remote()
-	decryptedName, err := o.f.cipher.DecryptFileName(remote)
+	return o.remote
+}
+
+// Remove an object and its long name sidecar if it has one
+func (o *Object) Remove(ctx context.Context) error {
+	err := o.Object.Remove(ctx)
 	if err != nil {
-		fs.Debugf(remote, "Undecryptable file name: %v", err)
-		return remote
+		return err
 	}
-	return decryptedName
+	return o.f.removeLongName(ctx, o.Object.Remote())
 }
 
 // Size returns the size of the file
+//
+// If the format of files is being detected and the size doesn't say
+// which format the file is in, this reads the start of it. If that
+// fails the size is returned as -1 for unknown.
 func (o *Object) Size() int64 {
 	size := o.Object.Size()
 	if !o.f.opt.NoDataEncryption {
-		var err error
-		size, err = o.f.cipher.DecryptedSize(size)
+		headerSize, err := o.readHeaderSize(context.TODO())
+		if err != nil {
+			fs.Errorf(o, "Failed to find size: %v", err)
+			return -1
+		}
+		if headerSize == 0 {
+			headerSize = o.f.cipher.headerSize()
+		}
+		size, err = o.f.cipher.decryptedSize(size, headerSize)
 		if err != nil {
 			fs.Debugf(o, "Bad size for decrypt: %v", err)
 		}
@@ -1017,6 +1296,10 @@ func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (rc io.Read
 		return o.Object.Open(ctx, options...)
 	}
 
+	headerSize, err := o.readHeaderSize(ctx)
+	if err != nil {
+		return nil, err
+	}
 	var openOptions []fs.OpenOption
 	var offset, limit int64 = 0, -1
 	for _, option := range options {
@@ -1030,7 +1313,7 @@ func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (rc io.Read
 			openOptions = append(openOptions, option)
 		}
 	}
-	rc, err = o.f.cipher.DecryptDataSeek(ctx, func(ctx context.Context, underlyingOffset, underlyingLimit int64) (io.ReadCloser, error) {
+	rc, err = o.f.cipher.decryptDataSeek(ctx, func(ctx context.Context, underlyingOffset, underlyingLimit int64) (io.ReadCloser, error) {
 		if underlyingOffset == 0 && underlyingLimit < 0 {
 			// Open with no seek
 			return o.Object.Open(ctx, openOptions...)
@@ -1045,7 +1328,7 @@ func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (rc io.Read
 		}
 		newOpenOptions := append(openOptions, &fs.RangeOption{Start: underlyingOffset, End: end})
 		return o.Object.Open(ctx, newOpenOptions...)
-	}, offset, limit)
+	}, offset, limit, headerSize)
 	if err != nil {
 		return nil, err
 	}
@@ -1058,6 +1341,12 @@ func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, op
 		return o.Object, o.Object.Update(ctx, in, src, options...)
 	}
 	_, err := o.f.put(ctx, in, src, options, update)
+	if err == nil {
+		// Rewritten in the format new files are written in
+		o.mu.Lock()
+		o.headerSize = o.f.cipher.headerSize()
+		o.mu.Unlock()
+	}
 	return err
 }
 
@@ -1107,15 +1396,15 @@ func (f *Fs) Shutdown(ctx context.Context) error {
 // This encrypts the remote name and adjusts the size
 type ObjectInfo struct {
 	fs.ObjectInfo
-	f     *Fs
-	nonce nonce
+	f      *Fs
+	header *fileHeader
 }
 
-func (f *Fs) newObjectInfo(src fs.ObjectInfo, nonce nonce) *ObjectInfo {
+func (f *Fs) newObjectInfo(src fs.ObjectInfo, header *fileHeader) *ObjectInfo {
 	return &ObjectInfo{
 		ObjectInfo: src,
 		f:          f,
-		nonce:      nonce,
+		header:     header,
 	}
 }
 
@@ -1160,7 +1449,11 @@ func (o *ObjectInfo) Hash(ctx context.Context, hash hash.Type) (string, error) {
 	if srcObj.Fs().Features().IsLocal {
 		// Read the data and encrypt it to calculate the hash
 		fs.Debugf(o, "Computing %v hash of encrypted source", hash)
-		return o.f.computeHashWithNonce(ctx, o.nonce, srcObj, hash)
+		header := o.header
+		if header == nil {
+			header = o.f.cipher.zeroHeader()
+		}
+		return o.f.computeHashWithHeader(ctx, header, srcObj, hash)
 	}
 	return "", nil
 }
@@ -61,7 +61,7 @@ func testObjectInfo(t *testing.T, f *Fs, wrap bool) {
 	var outBuf bytes.Buffer
 	enc, err := f.cipher.newEncrypter(inBuf, nil)
 	require.NoError(t, err)
-	nonce := enc.nonce // read the nonce at the start
+	header := enc.header // read the header at the start
 	_, err = io.Copy(&outBuf, enc)
 	require.NoError(t, err)
 
@@ -71,9 +71,9 @@ func testObjectInfo(t *testing.T, f *Fs, wrap bool) {
 		oi = fs.NewOverrideRemote(oi, "new_remote")
 	}
 
-	// wrap the object in a crypt for upload using the nonce we
+	// wrap the object in a crypt for upload using the header we
 	// saved from the encrypter
-	src := f.newObjectInfo(oi, nonce)
+	src := f.newObjectInfo(oi, header)
 
 	// Test ObjectInfo methods
 	if !f.opt.NoDataEncryption {
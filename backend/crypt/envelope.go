@@ -0,0 +1,720 @@
+// Envelope encryption
+//
+// Files in the envelope format are encrypted with a random data key
+// per file. The data key is wrapped for each recipient and the
+// wrapped keys are stored in the file header. The header is a fixed
+// size so the size of the encrypted file can still be calculated from
+// the size of the plaintext.
+//
+// The header is laid out like this
+//
+//	magic          8 bytes "RCLONE\x00\x02"
+//	nonce         24 bytes nonce for the first data block
+//	count          1 byte  number of stanzas
+//	stanzas       89 bytes each
+//	padding       zeros up to envelopeHeaderSize bytes
+//
+// Each stanza is
+//
+//	type           1 byte  stanzaTypePassword or stanzaTypeX25519
+//	id             8 bytes identifies the key which can unwrap it
+//	body          80 bytes the wrapped data key
+//
+// The data blocks which follow are exactly as in the version 1
+// format, except that they are sealed with the data key.
+
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/obscure"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/fs/walk"
+	"github.com/rclone/rclone/lib/random"
+	"github.com/rclone/rclone/lib/readers"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/nacl/box"
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+// Envelope constants
+const (
+	envelopeMagic      = "RCLONE\x00\x02"
+	envelopeHeaderSize = 1024
+	stanzaTypePassword = 1
+	stanzaTypeX25519   = 2
+	stanzaIDSize       = 8
+	stanzaBodySize     = box.AnonymousOverhead + 32
+	stanzaSize         = 1 + stanzaIDSize + stanzaBodySize
+	stanzaOffset       = fileHeaderSize + 1
+	maxRecipients      = (envelopeHeaderSize - stanzaOffset) / stanzaSize
+	publicKeyPrefix    = "x25519-pub:"
+	privateKeyPrefix   = "x25519-key:"
+)
+
+// Envelope errors
+var (
+	ErrorEnvelopeNoKey         = errors.New("can't unwrap the file key - no matching password or private key")
+	ErrorEnvelopeBadHeader     = errors.New("bad envelope header")
+	ErrorEnvelopeNoRecipients  = errors.New("envelope encryption needs at least one recipient")
+	ErrorEnvelopeNotAnEnvelope = errors.New("file isn't in the envelope format")
+)
+
+// Global variables
+var (
+	envelopeMagicBytes = []byte(envelopeMagic)
+	keyEncoding        = base64.RawURLEncoding
+)
+
+// fileHeader describes the header of an encrypted file
+type fileHeader struct {
+	nonce nonce     // nonce for the first data block
+	key   *[32]byte // key to seal the data blocks with
+	raw   []byte    // the header as stored at the start of the file
+}
+
+// recipient can wrap a data key so that a matching identity can
+// unwrap it
+type recipient interface {
+	// wrap seals dataKey into stanza which is stanzaSize bytes
+	wrap(stanza []byte, dataKey *[32]byte, rand io.Reader) error
+}
+
+// identity can unwrap data keys wrapped by a recipient
+type identity interface {
+	// unwrap returns the data key from stanza if it can open it
+	unwrap(stanza []byte) (*[32]byte, bool)
+}
+
+// keyID makes the id for a stanza from some public material
+func keyID(label string, key []byte) (id [stanzaIDSize]byte) {
+	sum := sha256.Sum256(append([]byte(label), key...))
+	copy(id[:], sum[:])
+	return id
+}
+
+// passwordKey is a key encryption key derived from the password
+//
+// It is both a recipient and an identity.
+type passwordKey struct {
+	id  [stanzaIDSize]byte
+	key [32]byte
+}
+
+// newPasswordKey derives a passwordKey from the data key made from
+// the password
+func newPasswordKey(dataKey *[32]byte) *passwordKey {
+	k := &passwordKey{
+		key: sha256.Sum256(append([]byte("rclone envelope password key"), dataKey[:]...)),
+	}
+	k.id = keyID("rclone envelope password id", k.key[:])
+	return k
+}
+
+// wrap seals dataKey into stanza
+func (k *passwordKey) wrap(stanza []byte, dataKey *[32]byte, rand io.Reader) error {
+	var n nonce
+	err := n.fromReader(rand)
+	if err != nil {
+		return err
+	}
+	stanza[0] = stanzaTypePassword
+	copy(stanza[1:], k.id[:])
+	copy(stanza[1+stanzaIDSize:], n[:])
+	secretbox.Seal(stanza[1+stanzaIDSize+fileNonceSize:1+stanzaIDSize+fileNonceSize], dataKey[:], n.pointer(), &k.key)
+	return nil
+}
+
+// unwrap returns the data key from stanza if it can open it
+func (k *passwordKey) unwrap(stanza []byte) (*[32]byte, bool) {
+	if stanza[0] != stanzaTypePassword || !bytes.Equal(stanza[1:1+stanzaIDSize], k.id[:]) {
+		return nil, false
+	}
+	var n nonce
+	n.fromBuf(stanza[1+stanzaIDSize:])
+	body := stanza[1+stanzaIDSize+fileNonceSize : 1+stanzaIDSize+fileNonceSize+secretbox.Overhead+32]
+	out, ok := secretbox.Open(nil, body, n.pointer(), &k.key)
+	if !ok || len(out) != 32 {
+		return nil, false
+	}
+	var dataKey [32]byte
+	copy(dataKey[:], out)
+	return &dataKey, true
+}
+
+// x25519Recipient wraps data keys for the holder of an X25519 private key
+type x25519Recipient struct {
+	id  [stanzaIDSize]byte
+	pub [32]byte
+}
+
+// newX25519Recipient makes a recipient from the public key
+func newX25519Recipient(pub *[32]byte) *x25519Recipient {
+	return &x25519Recipient{
+		id:  keyID("rclone envelope x25519 id", pub[:]),
+		pub: *pub,
+	}
+}
+
+// wrap seals dataKey into stanza
+func (r *x25519Recipient) wrap(stanza []byte, dataKey *[32]byte, rand io.Reader) error {
+	stanza[0] = stanzaTypeX25519
+	copy(stanza[1:], r.id[:])
+	_, err := box.SealAnonymous(stanza[1+stanzaIDSize:1+stanzaIDSize], dataKey[:], &r.pub, rand)
+	return err
+}
+
+// x25519Identity unwraps data keys wrapped for its public key
+type x25519Identity struct {
+	x25519Recipient
+	priv [32]byte
+}
+
+// unwrap returns the data key from stanza if it can open it
+func (i *x25519Identity) unwrap(stanza []byte) (*[32]byte, bool) {
+	if stanza[0] != stanzaTypeX25519 || !bytes.Equal(stanza[1:1+stanzaIDSize], i.id[:]) {
+		return nil, false
+	}
+	out, ok := box.OpenAnonymous(nil, stanza[1+stanzaIDSize:stanzaSize], &i.pub, &i.priv)
+	if !ok || len(out) != 32 {
+		return nil, false
+	}
+	var dataKey [32]byte
+	copy(dataKey[:], out)
+	return &dataKey, true
+}
+
+// parseKey decodes a key with the given prefix
+func parseKey(s, prefix string) (key [32]byte, err error) {
+	encoded, ok := strings.CutPrefix(strings.TrimSpace(s), prefix)
+	if !ok {
+		return key, fmt.Errorf("key %q should start with %q", s, prefix)
+	}
+	decoded, err := keyEncoding.DecodeString(encoded)
+	if err != nil {
+		return key, fmt.Errorf("failed to decode key %q: %w", s, err)
+	}
+	if len(decoded) != len(key) {
+		return key, fmt.Errorf("key %q should be %d bytes long but is %d", s, len(key), len(decoded))
+	}
+	copy(key[:], decoded)
+	return key, nil
+}
+
+// generateKeys makes a new X25519 key pair returning the public and
+// private keys in text form
+func generateKeys(rand io.Reader) (publicKey, privateKey string, err error) {
+	pub, priv, err := box.GenerateKey(rand)
+	if err != nil {
+		return "", "", err
+	}
+	return publicKeyPrefix + keyEncoding.EncodeToString(pub[:]), privateKeyPrefix + keyEncoding.EncodeToString(priv[:]), nil
+}
+
+// setEnvelope configures envelope encryption for the cipher
+//
+// If envelope is set new files will be written in the envelope
+// format for the recipients. The password is a recipient unless
+// noPassword is set, as is each of publicKeys.
+//
+// Files in the envelope format can be read if they were wrapped for
+// the password or the privateKey if set, whether or not envelope is
+// set.
+func (c *Cipher) setEnvelope(envelope bool, noPassword bool, publicKeys []string, privateKey string) error {
+	password := newPasswordKey(&c.dataKey)
+	c.envelope = envelope
+	c.recipients = nil
+	c.identities = []identity{password}
+	if !noPassword {
+		c.recipients = append(c.recipients, password)
+	}
+	for _, publicKey := range publicKeys {
+		pub, err := parseKey(publicKey, publicKeyPrefix)
+		if err != nil {
+			return err
+		}
+		c.recipients = append(c.recipients, newX25519Recipient(&pub))
+	}
+	if privateKey != "" {
+		priv, err := parseKey(privateKey, privateKeyPrefix)
+		if err != nil {
+			return err
+		}
+		var pub [32]byte
+		curve25519.ScalarBaseMult(&pub, &priv)
+		c.identities = append(c.identities, &x25519Identity{
+			x25519Recipient: *newX25519Recipient(&pub),
+			priv:            priv,
+		})
+	}
+	if !envelope {
+		return nil
+	}
+	if len(c.recipients) == 0 {
+		return ErrorEnvelopeNoRecipients
+	}
+	if len(c.recipients) > maxRecipients {
+		return fmt.Errorf("envelope encryption supports at most %d recipients but %d configured", maxRecipients, len(c.recipients))
+	}
+	return nil
+}
+
+// headerSize returns the size of the header of files written by the
+// cipher
+func (c *Cipher) headerSize() int64 {
+	if c.envelope {
+		return envelopeHeaderSize
+	}
+	return int64(fileHeaderSize)
+}
+
+// newFileHeader makes the header for a new file with a random nonce
+// and, if using envelope encryption, a random data key
+func (c *Cipher) newFileHeader() (*fileHeader, error) {
+	h := &fileHeader{
+		key: &c.dataKey,
+	}
+	err := h.nonce.fromReader(c.cryptoRand)
+	if err != nil {
+		return nil, err
+	}
+	if !c.envelope {
+		h.raw = make([]byte, fileHeaderSize)
+		copy(h.raw, fileMagicBytes)
+		copy(h.raw[fileMagicSize:], h.nonce[:])
+		return h, nil
+	}
+	h.key = new([32]byte)
+	_, err = io.ReadFull(c.cryptoRand, h.key[:])
+	if err != nil {
+		return nil, fmt.Errorf("short read of data key: %w", err)
+	}
+	h.raw, err = c.envelopeHeader(&h.nonce, h.key)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// zeroHeader returns a version 1 header with an all zero nonce
+func (c *Cipher) zeroHeader() *fileHeader {
+	h := &fileHeader{
+		key: &c.dataKey,
+		raw: make([]byte, fileHeaderSize),
+	}
+	copy(h.raw, fileMagicBytes)
+	return h
+}
+
+// envelopeHeader makes an envelope header with dataKey wrapped for
+// each of the recipients
+func (c *Cipher) envelopeHeader(n *nonce, dataKey *[32]byte) ([]byte, error) {
+	raw := make([]byte, envelopeHeaderSize)
+	copy(raw, envelopeMagicBytes)
+	copy(raw[fileMagicSize:], n[:])
+	raw[fileHeaderSize] = byte(len(c.recipients))
+	for i, r := range c.recipients {
+		start := stanzaOffset + i*stanzaSize
+		err := r.wrap(raw[start:start+stanzaSize], dataKey, c.cryptoRand)
+		if err != nil {
+			return nil, fmt.Errorf("failed to wrap data key: %w", err)
+		}
+	}
+	return raw, nil
+}
+
+// unwrapKey finds the data key in the envelope header raw using the
+// identities of the cipher
+func (c *Cipher) unwrapKey(raw []byte) (*[32]byte, error) {
+	if len(raw) < envelopeHeaderSize {
+		return nil, ErrorEncryptedFileTooShort
+	}
+	count := int(raw[fileHeaderSize])
+	if count > maxRecipients {
+		return nil, ErrorEnvelopeBadHeader
+	}
+	for i := 0; i < count; i++ {
+		start := stanzaOffset + i*stanzaSize
+		stanza := raw[start : start+stanzaSize]
+		for _, id := range c.identities {
+			if dataKey, ok := id.unwrap(stanza); ok {
+				return dataKey, nil
+			}
+		}
+	}
+	return nil, ErrorEnvelopeNoKey
+}
+
+// rewrapHeader reads the envelope header raw with the identities of
+// the cipher and returns a new header with the same data key and
+// nonce wrapped for the recipients of dst
+func (c *Cipher) rewrapHeader(raw []byte, dst *Cipher) ([]byte, error) {
+	if len(raw) < fileMagicSize || !bytes.Equal(raw[:fileMagicSize], envelopeMagicBytes) {
+		return nil, ErrorEnvelopeNotAnEnvelope
+	}
+	if !dst.envelope {
+		return nil, errors.New("envelope encryption isn't enabled")
+	}
+	dataKey, err := c.unwrapKey(raw)
+	if err != nil {
+		return nil, err
+	}
+	var n nonce
+	n.fromBuf(raw[fileMagicSize:])
+	return dst.envelopeHeader(&n, dataKey)
+}
+
+// headerSizeOf returns the size of the header of a file starting with
+// magic
+func headerSizeOf(magic []byte) int64 {
+	if bytes.HasPrefix(magic, envelopeMagicBytes) {
+		return envelopeHeaderSize
+	}
+	return int64(fileHeaderSize)
+}
+
+// detectFormats returns true if the header of each file should be
+// read to find its size
+func (f *Fs) detectFormats() bool {
+	return !f.opt.NoDataEncryption && (f.opt.Envelope || f.opt.EnvelopePrivateKey != "" || f.opt.EnvelopeDetect)
+}
+
+// headerSizeFromSize returns the size of the header of a file with
+// the encrypted size given if only one format fits that size, or 0 if
+// it could be in either.
+func (c *Cipher) headerSizeFromSize(size int64) int64 {
+	_, errV1 := c.decryptedSize(size, int64(fileHeaderSize))
+	_, errEnvelope := c.decryptedSize(size, envelopeHeaderSize)
+	switch {
+	case errV1 == nil && errEnvelope != nil:
+		return int64(fileHeaderSize)
+	case errV1 != nil && errEnvelope == nil:
+		return envelopeHeaderSize
+	}
+	return 0
+}
+
+// readHeaderSize returns the size of the header of o
+//
+// If formats are being detected and the size of o doesn't say which
+// format it is in, the magic at the start of it is read to find out.
+// Otherwise it returns 0 if it isn't known, in which case the file is
+// in the format new files are written in.
+func (o *Object) readHeaderSize(ctx context.Context) (int64, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.headerSize != 0 || !o.f.detectFormats() {
+		return o.headerSize, nil
+	}
+	size := o.Object.Size()
+	if size < int64(fileHeaderSize) {
+		return int64(fileHeaderSize), nil
+	}
+	o.headerSize = o.f.cipher.headerSizeFromSize(size)
+	if o.headerSize != 0 {
+		return o.headerSize, nil
+	}
+	in, err := o.Object.Open(ctx, &fs.RangeOption{Start: 0, End: int64(fileMagicSize) - 1})
+	if err != nil {
+		return 0, fmt.Errorf("failed to read header to find format: %w", err)
+	}
+	magic := make([]byte, fileMagicSize)
+	n, err := readers.ReadFill(in, magic)
+	_ = in.Close()
+	if err != nil && err != io.EOF {
+		return 0, fmt.Errorf("failed to read header to find format: %w", err)
+	}
+	o.headerSize = headerSizeOf(magic[:n])
+	return o.headerSize, nil
+}
+
+// newObjectWithHeader makes an Object for o which is a server-side
+// copy of src so has the same header
+func (f *Fs) newObjectWithHeader(o fs.Object, src *Object) *Object {
+	obj := f.newObject(o)
+	src.mu.Lock()
+	obj.headerSize = src.headerSize
+	src.mu.Unlock()
+	return obj
+}
+
+// rewrapTarget returns the remote files should be rewritten to. This
+// is f unless a new password is given in opt, when it is a remote on
+// the same underlying remote using the new password.
+func (f *Fs) rewrapTarget(ctx context.Context, opt map[string]string) (*Fs, error) {
+	newPassword, ok := opt["new_password"]
+	if !ok {
+		if _, ok := opt["new_password2"]; ok {
+			return nil, errors.New("new_password2 needs new_password to be set")
+		}
+		return f, nil
+	}
+	if newPassword == "" {
+		return nil, errors.New("new_password can't be empty")
+	}
+	newOpt := f.opt
+	var err error
+	newOpt.Password, err = obscure.Obscure(newPassword)
+	if err != nil {
+		return nil, err
+	}
+	if newPassword2, ok := opt["new_password2"]; ok {
+		newOpt.Password2 = ""
+		if newPassword2 != "" {
+			newOpt.Password2, err = obscure.Obscure(newPassword2)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	cipher, err := newCipherForConfig(&newOpt)
+	if err != nil {
+		return nil, err
+	}
+	return wrapFs(ctx, f.Fs, f.name, f.root, &newOpt, cipher), nil
+}
+
+// readHeader reads the header of the encrypted object o returning up
+// to envelopeHeaderSize bytes of it
+func readHeader(ctx context.Context, o fs.Object) ([]byte, error) {
+	in, err := o.Open(ctx, &fs.RangeOption{Start: 0, End: envelopeHeaderSize - 1})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	raw := make([]byte, envelopeHeaderSize)
+	n, err := readers.ReadFill(in, raw)
+	_ = in.Close()
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	return raw[:n], nil
+}
+
+// rewrapObject rewrites the encrypted file o to dst so its data key is
+// wrapped for the recipients of dst, returning true if the data had
+// to be encrypted again.
+//
+// Files in the envelope format keep their data blocks. If the name is
+// unchanged and the underlying object can be written in place then
+// only the header is written, otherwise the file is uploaded again
+// with the new header.
+//
+// Files in the standard format are sealed with the key made from the
+// password, which can't be given to other recipients, so they are
+// encrypted again with a new data key in the envelope format.
+func (f *Fs) rewrapObject(ctx context.Context, dst *Fs, o *Object) (reencrypted bool, err error) {
+	raw, err := readHeader(ctx, o.Object)
+	if err != nil {
+		return false, err
+	}
+	o.mu.Lock()
+	o.headerSize = headerSizeOf(raw)
+	o.mu.Unlock()
+	var (
+		in   io.Reader
+		size int64
+	)
+	switch {
+	case bytes.HasPrefix(raw, envelopeMagicBytes):
+		newRaw, err := f.cipher.rewrapHeader(raw, dst.cipher)
+		if err != nil {
+			return false, err
+		}
+		if dst == f {
+			if do, ok := o.Object.(fs.InPlaceWriter); ok {
+				return false, do.WriteAt(ctx, newRaw, 0)
+			}
+		}
+		rc, err := o.Object.Open(ctx, &fs.RangeOption{Start: envelopeHeaderSize, End: -1})
+		if err != nil {
+			return false, fmt.Errorf("failed to open for re-upload: %w", err)
+		}
+		defer fs.CheckClose(rc, &err)
+		in = io.MultiReader(bytes.NewReader(newRaw), rc)
+		size = o.Object.Size()
+	case bytes.HasPrefix(raw, fileMagicBytes):
+		if !dst.cipher.envelope {
+			return false, errors.New("envelope encryption isn't enabled")
+		}
+		rc, err := o.Open(ctx)
+		if err != nil {
+			return false, fmt.Errorf("failed to open for re-encryption: %w", err)
+		}
+		defer fs.CheckClose(rc, &err)
+		in, err = dst.cipher.newEncrypter(rc, nil)
+		if err != nil {
+			return false, err
+		}
+		size = dst.cipher.EncryptedSize(o.Size())
+		reencrypted = true
+	default:
+		return false, ErrorEncryptedBadMagic
+	}
+	return reencrypted, f.replaceObject(ctx, dst, o, in, size)
+}
+
+// replaceObject writes size bytes from in to the file for o in dst and
+// removes o if that has a different name
+//
+// The new contents are written to a temporary name first if they
+// replace o so o can be read while they are written.
+func (f *Fs) replaceObject(ctx context.Context, dst *Fs, o *Object, in io.Reader, size int64) error {
+	srcRemote := o.Object.Remote()
+	dstRemote := dst.cipher.EncryptFileName(o.Remote())
+	remote := dstRemote
+	if dstRemote == srcRemote {
+		remote = path.Join(path.Dir(srcRemote), "rclone-rewrap-"+random.String(8)+".tmp")
+	} else if err := dst.writeLongNames(ctx, dstRemote); err != nil {
+		return err
+	}
+	src := object.NewStaticObjectInfo(remote, o.Object.ModTime(ctx), size, true, nil, f.Fs)
+	newObj, err := f.Fs.Put(ctx, in, src)
+	if err != nil {
+		return fmt.Errorf("failed to upload: %w", err)
+	}
+	if dstRemote == srcRemote {
+		err = f.moveOver(ctx, newObj, o.Object)
+		if err != nil {
+			return fmt.Errorf("failed to replace with rewrapped file %q: %w", remote, err)
+		}
+		return nil
+	}
+	err = o.Object.Remove(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to remove after rewrap: %w", err)
+	}
+	return f.removeLongName(ctx, srcRemote)
+}
+
+// moveOver replaces the underlying object dst with src, removing src
+//
+// If the backend can move server-side dst is moved out of the way
+// first and only removed once src has replaced it, otherwise src is
+// copied over dst with Update. Either way dst is left alone if the
+// replacement fails.
+func (f *Fs) moveOver(ctx context.Context, src, dst fs.Object) (err error) {
+	remote := dst.Remote()
+	if doMove := f.Fs.Features().Move; doMove != nil {
+		old, err := doMove(ctx, dst, strings.TrimSuffix(src.Remote(), ".tmp")+".old")
+		if err == nil {
+			_, err = doMove(ctx, src, remote)
+			if err != nil {
+				if _, undoErr := doMove(ctx, old, remote); undoErr != nil {
+					fs.Errorf(old, "Failed to move back to %q: %v", remote, undoErr)
+				}
+				return err
+			}
+			return old.Remove(ctx)
+		} else if err != fs.ErrorCantMove {
+			return err
+		}
+	}
+	in, err := src.Open(ctx)
+	if err != nil {
+		return err
+	}
+	info := object.NewStaticObjectInfo(remote, src.ModTime(ctx), src.Size(), true, nil, f.Fs)
+	err = dst.Update(ctx, in, info)
+	_ = in.Close()
+	if err != nil {
+		return err
+	}
+	return src.Remove(ctx)
+}
+
+// skipRewrap returns true if subject shouldn't be changed as --dry-run
+// is set
+func skipRewrap(ctx context.Context, subject interface{}) bool {
+	if !fs.GetConfig(ctx).DryRun {
+		return false
+	}
+	fs.Logf(subject, "Not rewrapping as --dry-run is set")
+	return true
+}
+
+// rewrap rewrites all the files in dirs so their data keys are wrapped
+// for the current recipients, or the recipients with a new password
+// if one is given in opt
+func (f *Fs) rewrap(ctx context.Context, dirs []string, opt map[string]string) (out map[string]int, err error) {
+	if f.opt.NoDataEncryption {
+		return nil, errors.New("rewrap can't be used with no_data_encryption")
+	}
+	dst, err := f.rewrapTarget(ctx, opt)
+	if err != nil {
+		return nil, err
+	}
+	if !dst.cipher.envelope {
+		return nil, errors.New("rewrap needs envelope encryption to be enabled")
+	}
+	if len(dirs) == 0 {
+		dirs = []string{""}
+	}
+	out = map[string]int{"rewrapped": 0, "reencrypted": 0, "skipped": 0, "errors": 0}
+	var oldDirs []string // directories whose names change with the password
+	for _, dir := range dirs {
+		err = walk.ListR(ctx, f, dir, true, -1, walk.ListAll, func(entries fs.DirEntries) error {
+			for _, entry := range entries {
+				switch x := entry.(type) {
+				case fs.Directory:
+					if dst == f || f.cipher.EncryptDirName(x.Remote()) == dst.cipher.EncryptDirName(x.Remote()) {
+						continue
+					}
+					if skipRewrap(ctx, x) {
+						continue
+					}
+					if err := dst.Mkdir(ctx, x.Remote()); err != nil {
+						fs.Errorf(x, "Failed to make directory for rewrap: %v", err)
+						out["errors"]++
+						continue
+					}
+					oldDirs = append(oldDirs, x.Remote())
+				case *Object:
+					if skipRewrap(ctx, x) {
+						out["skipped"]++
+						continue
+					}
+					reencrypted, err := f.rewrapObject(ctx, dst, x)
+					switch {
+					case err != nil:
+						fs.Errorf(x, "Failed to rewrap: %v", err)
+						out["errors"]++
+					case reencrypted:
+						fs.Infof(x, "Re-encrypted in the envelope format")
+						out["reencrypted"]++
+					default:
+						fs.Infof(x, "Rewrapped data key")
+						out["rewrapped"]++
+					}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return out, err
+		}
+	}
+	// Remove the directories left empty, deepest first
+	sort.Slice(oldDirs, func(i, j int) bool {
+		return strings.Count(oldDirs[i], "/") > strings.Count(oldDirs[j], "/")
+	})
+	for _, dir := range oldDirs {
+		if err := f.Rmdir(ctx, dir); err != nil {
+			fs.Errorf(dir, "Failed to remove directory after rewrap: %v", err)
+		}
+	}
+	if out["errors"] != 0 {
+		return out, fmt.Errorf("failed to rewrap %d files", out["errors"])
+	}
+	return out, nil
+}
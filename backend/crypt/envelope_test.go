@@ -0,0 +1,431 @@
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"testing"
+	"time"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/obscure"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/lib/random"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newEnvelopeCipher makes a cipher with the password "potato"
+func newEnvelopeCipher(t *testing.T, envelope, noPassword bool, publicKeys []string, privateKey string) *Cipher {
+	c, err := newCipher(NameEncryptionStandard, "potato", "", true, nil)
+	require.NoError(t, err)
+	require.NoError(t, c.setEnvelope(envelope, noPassword, publicKeys, privateKey))
+	return c
+}
+
+// encrypt data with c
+func encrypt(t *testing.T, c *Cipher, data []byte) []byte {
+	in, err := c.EncryptData(bytes.NewReader(data))
+	require.NoError(t, err)
+	out, err := io.ReadAll(in)
+	require.NoError(t, err)
+	return out
+}
+
+// decrypt data with c
+func decrypt(c *Cipher, data []byte) ([]byte, error) {
+	rc, err := c.DecryptData(io.NopCloser(bytes.NewReader(data)))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rc.Close() }()
+	return io.ReadAll(rc)
+}
+
+func TestEnvelopeKeys(t *testing.T) {
+	publicKey, privateKey, err := generateKeys(rand.Reader)
+	require.NoError(t, err)
+	assert.Contains(t, publicKey, publicKeyPrefix)
+	assert.Contains(t, privateKey, privateKeyPrefix)
+
+	_, err = parseKey(publicKey, publicKeyPrefix)
+	require.NoError(t, err)
+	_, err = parseKey(publicKey, privateKeyPrefix)
+	assert.Error(t, err)
+	_, err = parseKey(publicKeyPrefix+"AAAA", publicKeyPrefix)
+	assert.Error(t, err)
+
+	c, err := newCipher(NameEncryptionStandard, "potato", "", true, nil)
+	require.NoError(t, err)
+	assert.Equal(t, ErrorEnvelopeNoRecipients, c.setEnvelope(true, true, nil, ""))
+	keys := make([]string, maxRecipients)
+	for i := range keys {
+		keys[i] = publicKey
+	}
+	assert.Error(t, c.setEnvelope(true, false, keys, ""))
+	assert.NoError(t, c.setEnvelope(true, true, keys, ""))
+}
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	publicKey, privateKey, err := generateKeys(rand.Reader)
+	require.NoError(t, err)
+	data := []byte(random.String(3*blockDataSize + 100))
+
+	// Encrypt for the password and the public key
+	c := newEnvelopeCipher(t, true, false, []string{publicKey}, "")
+	encrypted := encrypt(t, c, data)
+	assert.Equal(t, c.EncryptedSize(int64(len(data))), int64(len(encrypted)))
+	assert.Equal(t, envelopeMagicBytes, encrypted[:fileMagicSize])
+	size, err := c.decryptedSize(int64(len(encrypted)), envelopeHeaderSize)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(data)), size)
+
+	// Each file gets its own key
+	assert.NotEqual(t, encrypted[envelopeHeaderSize:], encrypt(t, c, data)[envelopeHeaderSize:])
+
+	// Decrypt with the password whether envelope is set or not
+	for _, envelope := range []bool{true, false} {
+		got, err := decrypt(newEnvelopeCipher(t, envelope, false, nil, ""), encrypted)
+		require.NoError(t, err)
+		assert.Equal(t, data, got)
+	}
+
+	// Decrypt with the private key only
+	got, err := decrypt(newEnvelopeCipher(t, false, false, nil, privateKey), encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, data, got)
+
+	// Seek into the file
+	open := func(ctx context.Context, offset, limit int64) (io.ReadCloser, error) {
+		end := int64(len(encrypted))
+		if limit >= 0 && offset+limit < end {
+			end = offset + limit
+		}
+		return io.NopCloser(bytes.NewReader(encrypted[offset:end])), nil
+	}
+	for _, offset := range []int64{0, 1, blockDataSize, 2*blockDataSize + 7} {
+		rc, err := c.DecryptDataSeek(context.Background(), open, offset, 50)
+		require.NoError(t, err)
+		got, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+		assert.Equal(t, data[offset:offset+50], got, offset)
+	}
+
+	// Encrypt for the public key only
+	c = newEnvelopeCipher(t, true, true, []string{publicKey}, "")
+	encrypted = encrypt(t, c, data)
+	_, err = decrypt(c, encrypted)
+	assert.Equal(t, ErrorEnvelopeNoKey, err)
+	got, err = decrypt(newEnvelopeCipher(t, false, false, nil, privateKey), encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, data, got)
+}
+
+func TestEnvelopeRewrapHeader(t *testing.T) {
+	publicKey, privateKey, err := generateKeys(rand.Reader)
+	require.NoError(t, err)
+	data := []byte(random.String(1000))
+
+	c := newEnvelopeCipher(t, true, false, nil, "")
+	encrypted := encrypt(t, c, data)
+
+	// Version 1 files have no header to rewrap
+	_, err = c.rewrapHeader(encrypt(t, newEnvelopeCipher(t, false, false, nil, ""), data), c)
+	assert.Equal(t, ErrorEnvelopeNotAnEnvelope, err)
+
+	// Revoke the password and add the public key
+	c2 := newEnvelopeCipher(t, true, true, []string{publicKey}, "")
+	raw, err := c.rewrapHeader(encrypted, c2)
+	require.NoError(t, err)
+	assert.Equal(t, envelopeHeaderSize, len(raw))
+	assert.Equal(t, encrypted[:fileHeaderSize], raw[:fileHeaderSize], "nonce should be unchanged")
+	rewrapped := append(raw, encrypted[envelopeHeaderSize:]...)
+
+	_, err = decrypt(c, rewrapped)
+	assert.Equal(t, ErrorEnvelopeNoKey, err)
+	got, err := decrypt(newEnvelopeCipher(t, false, false, nil, privateKey), rewrapped)
+	require.NoError(t, err)
+	assert.Equal(t, data, got)
+}
+
+func TestHeaderSizeFromSize(t *testing.T) {
+	c := newEnvelopeCipher(t, false, false, nil, "")
+	for _, test := range []struct {
+		size int64
+		want int64
+	}{
+		{32, 32},                                 // empty version 1 file
+		{32 + 16 + 100, 32},                      // too short for an envelope
+		{1024, 0},                                // could be either
+		{1024 + 16 + 1, 0},                       // could be either
+		{1024 + blockSize + 10, 32},              // last envelope block is bad
+		{32 + blockSize + 5, envelopeHeaderSize}, // last version 1 block is bad
+		{32 + 10, 0},                             // neither
+	} {
+		assert.Equal(t, test.want, c.headerSizeFromSize(test.size), test.size)
+	}
+}
+
+func TestEnvelopeRewrapCommand(t *testing.T) {
+	ctx := context.Background()
+	publicKey, privateKey, err := generateKeys(rand.Reader)
+	require.NoError(t, err)
+	remote := fmt.Sprintf(":crypt,remote='%s',password='%s',envelope:", t.TempDir(), obscure.MustObscure("potato"))
+	f, err := fs.NewFs(ctx, remote)
+	require.NoError(t, err)
+	cf := f.(*Fs)
+
+	obj := uploadFile(t, f, "dir/file.txt", "hello world")
+	modTime := obj.ModTime(ctx)
+
+	// Add the public key as a recipient and revoke the password
+	require.NoError(t, cf.cipher.setEnvelope(true, true, []string{publicKey}, ""))
+	out, err := cf.Command(ctx, "rewrap", []string{"dir"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"rewrapped": 1, "reencrypted": 0, "skipped": 0, "errors": 0}, out)
+
+	// Check the file is the same size and mod time and can only be
+	// read with the private key
+	obj, err = f.NewObject(ctx, "dir/file.txt")
+	require.NoError(t, err)
+	assert.Equal(t, int64(len("hello world")), obj.Size())
+	assert.True(t, modTime.Equal(obj.ModTime(ctx)))
+	_, err = obj.Open(ctx)
+	assert.ErrorIs(t, err, ErrorEnvelopeNoKey)
+
+	f, err = fs.NewFs(ctx, fmt.Sprintf("%s,envelope_private_key='%s':", remote[:len(remote)-1], obscure.MustObscure(privateKey)))
+	require.NoError(t, err)
+	obj, err = f.NewObject(ctx, "dir/file.txt")
+	require.NoError(t, err)
+	rc, err := obj.Open(ctx)
+	require.NoError(t, err)
+	got, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+	assert.Equal(t, "hello world", string(got))
+}
+
+// putFile uploads contents to remote in f
+func putFile(t *testing.T, f fs.Fs, remote, contents string) fs.Object {
+	src := object.NewStaticObjectInfo(remote, time.Now(), int64(len(contents)), true, nil, nil)
+	obj, err := f.Put(context.Background(), bytes.NewBufferString(contents), src)
+	require.NoError(t, err)
+	return obj
+}
+
+// readFile reads the contents of remote in f
+func readFile(t *testing.T, f fs.Fs, remote string) string {
+	ctx := context.Background()
+	obj, err := f.NewObject(ctx, remote)
+	require.NoError(t, err)
+	rc, err := obj.Open(ctx)
+	require.NoError(t, err)
+	data, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+	return string(data)
+}
+
+// listSizes returns the sizes of the files in the root of f
+func listSizes(t *testing.T, f fs.Fs) map[string]int64 {
+	entries, err := f.List(context.Background(), "")
+	require.NoError(t, err)
+	sizes := map[string]int64{}
+	for _, entry := range entries {
+		sizes[entry.Remote()] = entry.Size()
+	}
+	return sizes
+}
+
+func TestEnvelopeMixedFormats(t *testing.T) {
+	ctx := context.Background()
+	base := fmt.Sprintf(":crypt,remote='%s',password='%s'", t.TempDir(), obscure.MustObscure("potato"))
+	fv1, err := fs.NewFs(ctx, base+":")
+	require.NoError(t, err)
+	fenv, err := fs.NewFs(ctx, base+",envelope:")
+	require.NoError(t, err)
+
+	v1Contents := random.String(blockDataSize + 100)
+	envContents := random.String(100)
+	putFile(t, fv1, "v1.txt", v1Contents)
+	putFile(t, fenv, "env.txt", envContents)
+	want := map[string]int64{"v1.txt": int64(len(v1Contents)), "env.txt": int64(len(envContents))}
+
+	// Both formats have the right sizes when listed, read singly and
+	// read back whether envelope is set or not
+	fdetect, err := fs.NewFs(ctx, base+",envelope_detect:")
+	require.NoError(t, err)
+	for _, f := range []fs.Fs{fenv, fdetect} {
+		assert.Equal(t, want, listSizes(t, f), f.String())
+		for remote, size := range want {
+			obj, err := f.NewObject(ctx, remote)
+			require.NoError(t, err)
+			assert.Equal(t, size, obj.Size(), remote)
+		}
+		assert.Equal(t, v1Contents, readFile(t, f, "v1.txt"))
+		assert.Equal(t, envContents, readFile(t, f, "env.txt"))
+	}
+
+	// Ranges can be read from either format without detection
+	for remote, contents := range map[string]string{"v1.txt": v1Contents, "env.txt": envContents} {
+		obj, err := fv1.NewObject(ctx, remote)
+		require.NoError(t, err)
+		for _, start := range []int64{0, 5} {
+			rc, err := obj.Open(ctx, &fs.RangeOption{Start: start, End: start + 9})
+			require.NoError(t, err)
+			got, err := io.ReadAll(rc)
+			require.NoError(t, err)
+			require.NoError(t, rc.Close())
+			assert.Equal(t, contents[start:start+10], string(got), remote)
+		}
+	}
+
+	// The hashes of the underlying files can be computed in either format
+	cf := fenv.(*Fs)
+	for remote, contents := range map[string]string{"v1.txt": v1Contents, "env.txt": envContents} {
+		obj, err := cf.NewObject(ctx, remote)
+		require.NoError(t, err)
+		o := obj.(*Object)
+		src := object.NewStaticObjectInfo(remote, time.Now(), int64(len(contents)), true, nil, nil)
+		got, err := cf.ComputeHash(ctx, o, &memoryObject{src, contents}, hash.MD5)
+		require.NoError(t, err)
+		wantHash, err := o.Object.Hash(ctx, hash.MD5)
+		require.NoError(t, err)
+		assert.Equal(t, wantHash, got, remote)
+	}
+}
+
+// memoryObject is an fs.Object whose contents are held in memory
+type memoryObject struct {
+	fs.ObjectInfo
+	contents string
+}
+
+// Open returns the contents
+func (o *memoryObject) Open(ctx context.Context, options ...fs.OpenOption) (io.ReadCloser, error) {
+	return io.NopCloser(bytes.NewBufferString(o.contents)), nil
+}
+
+// SetModTime isn't supported
+func (o *memoryObject) SetModTime(ctx context.Context, t time.Time) error {
+	return fs.ErrorCantSetModTime
+}
+
+// Update isn't supported
+func (o *memoryObject) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	return errors.New("not supported")
+}
+
+// Remove isn't supported
+func (o *memoryObject) Remove(ctx context.Context) error {
+	return errors.New("not supported")
+}
+
+func TestEnvelopeRewrapMigrate(t *testing.T) {
+	ctx := context.Background()
+	base := fmt.Sprintf(":crypt,remote='%s',password='%s'", t.TempDir(), obscure.MustObscure("potato"))
+	fv1, err := fs.NewFs(ctx, base+":")
+	require.NoError(t, err)
+	contents := random.String(2*blockDataSize + 10)
+	putFile(t, fv1, "dir/file.txt", contents)
+
+	f, err := fs.NewFs(ctx, base+",envelope:")
+	require.NoError(t, err)
+	out, err := f.Features().Command(ctx, "rewrap", nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"rewrapped": 0, "reencrypted": 1, "skipped": 0, "errors": 0}, out)
+
+	// The file is now in the envelope format and nothing is left behind
+	obj, err := f.NewObject(ctx, "dir/file.txt")
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(contents)), obj.Size())
+	assert.Equal(t, int64(envelopeHeaderSize), obj.(*Object).headerSize)
+	assert.Equal(t, contents, readFile(t, f, "dir/file.txt"))
+	entries, err := f.(*Fs).Fs.List(ctx, path.Dir(obj.(*Object).Object.Remote()))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	// Rewrapping again only rewrites the header
+	out, err = f.Features().Command(ctx, "rewrap", nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"rewrapped": 1, "reencrypted": 0, "skipped": 0, "errors": 0}, out)
+	assert.Equal(t, contents, readFile(t, f, "dir/file.txt"))
+}
+
+func TestEnvelopeRewrapNewPassword(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	remote := func(password string) string {
+		return fmt.Sprintf(":crypt,remote='%s',password='%s',envelope:", dir, obscure.MustObscure(password))
+	}
+	fv1, err := fs.NewFs(ctx, fmt.Sprintf(":crypt,remote='%s',password='%s':", dir, obscure.MustObscure("potato")))
+	require.NoError(t, err)
+	putFile(t, fv1, "dir/v1.txt", "version 1")
+	f, err := fs.NewFs(ctx, remote("potato"))
+	require.NoError(t, err)
+	putFile(t, f, "dir/env.txt", "envelope")
+
+	out, err := f.Features().Command(ctx, "rewrap", nil, map[string]string{"new_password": "carrot"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"rewrapped": 1, "reencrypted": 1, "skipped": 0, "errors": 0}, out)
+
+	// The files can be read with the new password only
+	fnew, err := fs.NewFs(ctx, remote("carrot"))
+	require.NoError(t, err)
+	assert.Equal(t, "version 1", readFile(t, fnew, "dir/v1.txt"))
+	assert.Equal(t, "envelope", readFile(t, fnew, "dir/env.txt"))
+	f, err = fs.NewFs(ctx, remote("potato"))
+	require.NoError(t, err)
+	entries, err := f.List(ctx, "")
+	assert.True(t, err != nil || len(entries) == 0, "old password shouldn't list anything")
+
+	// The underlying remote only holds the renamed files
+	flocal, err := fs.NewFs(ctx, dir)
+	require.NoError(t, err)
+	entries, err = flocal.List(ctx, "")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	entries, err = flocal.List(ctx, entries[0].Remote())
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	// The target is a complete remote
+	dst, err := fnew.(*Fs).rewrapTarget(ctx, map[string]string{"new_password": "x"})
+	require.NoError(t, err)
+	require.NotNil(t, dst.Features())
+	assert.Equal(t, fnew.Features().Move == nil, dst.Features().Move == nil)
+
+	_, err = fnew.Features().Command(ctx, "rewrap", nil, map[string]string{"new_password2": "x"})
+	assert.Error(t, err)
+}
+
+func TestMoveOver(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	f, err := fs.NewFs(ctx, fmt.Sprintf(":crypt,remote='%s',password='%s':", dir, obscure.MustObscure("potato")))
+	require.NoError(t, err)
+	cf := f.(*Fs)
+	flocal := cf.Fs
+
+	// src replaces dst
+	dst := putFile(t, flocal, "file", "old")
+	src := putFile(t, flocal, "rclone-rewrap-1.tmp", "new")
+	require.NoError(t, cf.moveOver(ctx, src, dst))
+	assert.Equal(t, "new", readFile(t, flocal, "file"))
+	assert.Equal(t, map[string]int64{"file": 3}, listSizes(t, flocal))
+
+	// dst is left alone if src can't replace it
+	dst = putFile(t, flocal, "file", "old")
+	src = putFile(t, flocal, "rclone-rewrap-2.tmp", "new")
+	require.NoError(t, src.Remove(ctx))
+	assert.Error(t, cf.moveOver(ctx, src, dst))
+	assert.Equal(t, "old", readFile(t, flocal, "file"))
+	assert.Equal(t, map[string]int64{"file": 3}, listSizes(t, flocal))
+}
@@ -0,0 +1,269 @@
+// Long file name support
+//
+// Encrypted names are longer than the names they encrypt, so they can
+// exceed the limits of the underlying remote on the length of a
+// path segment. If max_name_length is set then any encrypted segment
+// longer than it is replaced with a short name made from a hash of
+// the encrypted segment and a sidecar object holding the encrypted
+// segment is stored next to it.
+//
+// For an encrypted segment LONG this stores
+//
+//	<hash>.lfn       the file or directory
+//	<hash>.lfn.name  a sidecar object containing LONG
+//
+// The short name is a function of the encrypted segment so it can be
+// found without reading the sidecar. The sidecar is only needed to
+// decrypt the short name when listing.
+
+package crypt
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/lib/cache"
+)
+
+// Long name constants
+const (
+	longNameHashSize      = 20
+	longNameSuffix        = ".lfn"
+	longNameSidecarSuffix = ".name"
+	longNameSize          = 2*longNameHashSize + len(longNameSuffix)
+	longNameSidecarSize   = longNameSize + len(longNameSidecarSuffix)
+	maxSidecarSize        = 64 * 1024
+)
+
+// ErrorLongNameNotFound is returned when the sidecar for a short name
+// can't be found
+var ErrorLongNameNotFound = errors.New("long name sidecar not found")
+
+// shortName returns the short name for the encrypted segment
+func shortName(segment string) string {
+	sum := sha256.Sum256([]byte(segment))
+	return hex.EncodeToString(sum[:longNameHashSize]) + longNameSuffix
+}
+
+// isShortName returns true if segment is a short name
+func isShortName(segment string) bool {
+	if len(segment) != longNameSize || !strings.HasSuffix(segment, longNameSuffix) {
+		return false
+	}
+	_, err := hex.DecodeString(segment[:2*longNameHashSize])
+	return err == nil
+}
+
+// isSidecar returns true if leaf is the name of a sidecar object
+func isSidecar(leaf string) bool {
+	return len(leaf) == longNameSidecarSize && strings.HasSuffix(leaf, longNameSidecarSuffix) && isShortName(leaf[:longNameSize])
+}
+
+// longNames maps short names to the encrypted segments they stand for
+//
+// Names not used for a while are forgotten so the map doesn't grow
+// without limit. They are read from the sidecars again if needed.
+type longNames struct {
+	once  sync.Once
+	names *cache.Cache
+}
+
+// cache returns the cache of names, making it if necessary
+func (l *longNames) cache() *cache.Cache {
+	l.once.Do(func() {
+		l.names = cache.New()
+	})
+	return l.names
+}
+
+// add remembers that short stands for long
+func (l *longNames) add(short, long string) {
+	l.cache().Put(short, long)
+}
+
+// get returns the encrypted segment short stands for
+func (l *longNames) get(short string) (long string, found bool) {
+	value, found := l.cache().GetMaybe(short)
+	if !found {
+		return "", false
+	}
+	return value.(string), true
+}
+
+// setMaxNameLength sets the length above which encrypted segments are
+// replaced with short names, or 0 to leave them as they are
+func (c *Cipher) setMaxNameLength(maxNameLength int) error {
+	if maxNameLength != 0 && maxNameLength < longNameSidecarSize {
+		return fmt.Errorf("max_name_length must be 0 or at least %d", longNameSidecarSize)
+	}
+	c.maxNameLength = maxNameLength
+	return nil
+}
+
+// shorten returns a short name for the encrypted segment if it is too
+// long, otherwise the segment
+func (c *Cipher) shorten(segment string) string {
+	if c.maxNameLength <= 0 || len(segment) <= c.maxNameLength {
+		return segment
+	}
+	short := shortName(segment)
+	c.longNames.add(short, segment)
+	return short
+}
+
+// lengthen returns the encrypted segment for a short name, otherwise
+// the segment
+func (c *Cipher) lengthen(segment string) (string, error) {
+	if !isShortName(segment) {
+		return segment, nil
+	}
+	long, found := c.longNames.get(segment)
+	if !found {
+		return "", ErrorLongNameNotFound
+	}
+	return long, nil
+}
+
+// sidecars records the sidecar objects known to exist
+//
+// Sidecars not used for a while are forgotten and checked for again.
+type sidecars struct {
+	once  sync.Once
+	known *cache.Cache
+}
+
+// cache returns the cache of known sidecars, making it if necessary
+func (s *sidecars) cache() *cache.Cache {
+	s.once.Do(func() {
+		s.known = cache.New()
+	})
+	return s.known
+}
+
+// isKnown returns true if the sidecar at remote is known to exist
+func (s *sidecars) isKnown(remote string) bool {
+	_, found := s.cache().GetMaybe(remote)
+	return found
+}
+
+// setKnown records whether the sidecar at remote exists
+func (s *sidecars) setKnown(remote string, known bool) {
+	if !known {
+		s.cache().Delete(remote)
+		return
+	}
+	s.cache().Put(remote, struct{}{})
+}
+
+// readLongName reads the sidecar for the short name at the end of the
+// encrypted path remote
+func (f *Fs) readLongName(ctx context.Context, remote string) (err error) {
+	sidecar := remote + longNameSidecarSuffix
+	o, err := f.Fs.NewObject(ctx, sidecar)
+	if errors.Is(err, fs.ErrorObjectNotFound) {
+		return fmt.Errorf("%s: %w", sidecar, ErrorLongNameNotFound)
+	} else if err != nil {
+		return fmt.Errorf("failed to find long name sidecar: %w", err)
+	}
+	in, err := o.Open(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to open long name sidecar: %w", err)
+	}
+	defer fs.CheckClose(in, &err)
+	data, err := io.ReadAll(io.LimitReader(in, maxSidecarSize))
+	if err != nil {
+		return fmt.Errorf("failed to read long name sidecar: %w", err)
+	}
+	long := string(data)
+	short := path.Base(remote)
+	if shortName(long) != short {
+		return fmt.Errorf("%s: long name sidecar doesn't match its name", sidecar)
+	}
+	f.cipher.longNames.add(short, long)
+	f.sidecars.setKnown(sidecar, true)
+	return nil
+}
+
+// resolveLongNames reads the sidecars for any short names in the
+// encrypted path remote which aren't known yet
+func (f *Fs) resolveLongNames(ctx context.Context, remote string) error {
+	segments := strings.Split(remote, "/")
+	for i, segment := range segments {
+		if !isShortName(segment) {
+			continue
+		}
+		if _, found := f.cipher.longNames.get(segment); found {
+			continue
+		}
+		err := f.readLongName(ctx, path.Join(segments[:i+1]...))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeLongNames makes sure the sidecars exist for all the short names
+// in the encrypted path remote
+func (f *Fs) writeLongNames(ctx context.Context, remote string) error {
+	if f.cipher.maxNameLength <= 0 {
+		return nil
+	}
+	segments := strings.Split(remote, "/")
+	for i, segment := range segments {
+		if !isShortName(segment) {
+			continue
+		}
+		sidecar := path.Join(segments[:i+1]...) + longNameSidecarSuffix
+		if f.sidecars.isKnown(sidecar) {
+			continue
+		}
+		long, err := f.cipher.lengthen(segment)
+		if err != nil {
+			return err
+		}
+		_, err = f.Fs.NewObject(ctx, sidecar)
+		if errors.Is(err, fs.ErrorObjectNotFound) {
+			src := object.NewStaticObjectInfo(sidecar, time.Now(), int64(len(long)), true, nil, f.Fs)
+			_, err = f.Fs.Put(ctx, strings.NewReader(long), src)
+			if err != nil {
+				return fmt.Errorf("failed to write long name sidecar: %w", err)
+			}
+		} else if err != nil {
+			return fmt.Errorf("failed to find long name sidecar: %w", err)
+		}
+		f.sidecars.setKnown(sidecar, true)
+	}
+	return nil
+}
+
+// removeLongName removes the sidecar for the encrypted path remote if
+// it ends in a short name
+func (f *Fs) removeLongName(ctx context.Context, remote string) error {
+	if !isShortName(path.Base(remote)) {
+		return nil
+	}
+	sidecar := remote + longNameSidecarSuffix
+	f.sidecars.setKnown(sidecar, false)
+	o, err := f.Fs.NewObject(ctx, sidecar)
+	if errors.Is(err, fs.ErrorObjectNotFound) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to find long name sidecar: %w", err)
+	}
+	err = o.Remove(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to remove long name sidecar: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package crypt
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/obscure"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/fs/walk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShortName(t *testing.T) {
+	short := shortName("potato")
+	assert.Equal(t, longNameSize, len(short))
+	assert.True(t, isShortName(short))
+	assert.True(t, isSidecar(short+longNameSidecarSuffix))
+	assert.False(t, isSidecar(short))
+	assert.False(t, isShortName("potato"))
+	assert.False(t, isShortName(strings.Repeat("x", 2*longNameHashSize)+longNameSuffix))
+}
+
+func TestCipherLongNames(t *testing.T) {
+	enc, err := NewNameEncoding("base32")
+	require.NoError(t, err)
+	c, err := newCipher(NameEncryptionStandard, "potato", "", true, enc)
+	require.NoError(t, err)
+	assert.Error(t, c.setMaxNameLength(10))
+	require.NoError(t, c.setMaxNameLength(100))
+
+	long := strings.Repeat("a", 100)
+	encrypted := c.EncryptFileName("short/" + long + "/file")
+	segments := strings.Split(encrypted, "/")
+	require.Equal(t, 3, len(segments))
+	assert.False(t, isShortName(segments[0]))
+	assert.True(t, isShortName(segments[1]))
+	assert.False(t, isShortName(segments[2]))
+
+	decrypted, err := c.DecryptFileName(encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "short/"+long+"/file", decrypted)
+
+	// A cipher which hasn't seen the long name can't decrypt it
+	c2, err := newCipher(NameEncryptionStandard, "potato", "", true, enc)
+	require.NoError(t, err)
+	_, err = c2.DecryptFileName(encrypted)
+	assert.Equal(t, ErrorLongNameNotFound, err)
+}
+
+func TestLongNames(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	remote := fmt.Sprintf(":crypt,remote='%s',password='%s',max_name_length=100:", dir, obscure.MustObscure("potato"))
+	f, err := fs.NewFs(ctx, remote)
+	require.NoError(t, err)
+
+	longDir := strings.Repeat("d", 80)
+	longFile := strings.Repeat("f", 80)
+	names := []string{
+		"short.txt",
+		longFile,
+		longDir + "/short.txt",
+		longDir + "/" + longFile,
+	}
+	for _, name := range names {
+		src := object.NewStaticObjectInfo(name, time.Now(), int64(len(name)), true, nil, nil)
+		_, err := f.Put(ctx, strings.NewReader(name), src)
+		require.NoError(t, err)
+	}
+
+	// Check the underlying names are all short enough
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		require.NoError(t, err)
+		assert.LessOrEqual(t, len(info.Name()), 100, path)
+		return nil
+	})
+	require.NoError(t, err)
+
+	// Check a new Fs which hasn't seen the names can list them
+	list := func(f fs.Fs) (got []string) {
+		err := walk.ListR(ctx, f, "", true, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+			entries.ForObject(func(o fs.Object) {
+				got = append(got, o.Remote())
+			})
+			return nil
+		})
+		require.NoError(t, err)
+		sort.Strings(got)
+		return got
+	}
+	f2, err := fs.NewFs(ctx, remote)
+	require.NoError(t, err)
+	want := append([]string{}, names...)
+	sort.Strings(want)
+	assert.Equal(t, want, list(f2))
+
+	f3, err := fs.NewFs(ctx, remote)
+	require.NoError(t, err)
+	o, err := f3.NewObject(ctx, longDir+"/"+longFile)
+	require.NoError(t, err)
+	assert.Equal(t, longDir+"/"+longFile, o.Remote())
+
+	// Names which have been forgotten are read from the sidecars again
+	cf := f.(*Fs)
+	cf.cipher.longNames.cache().Clear()
+	cf.sidecars.cache().Clear()
+	o, err = f.NewObject(ctx, longDir+"/"+longFile)
+	require.NoError(t, err)
+	assert.Equal(t, longDir+"/"+longFile, o.Remote())
+	assert.Equal(t, want, list(f))
+
+	// Objects keep their names after the names have been forgotten
+	cf.cipher.longNames.cache().Clear()
+	cf.sidecars.cache().Clear()
+	assert.Equal(t, longDir+"/"+longFile, o.Remote())
+
+	// Removing the objects should remove the sidecars
+	for _, name := range names {
+		o, err := f.NewObject(ctx, name)
+		require.NoError(t, err)
+		require.NoError(t, o.Remove(ctx))
+	}
+	require.NoError(t, f.Rmdir(ctx, longDir))
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(entries))
+}
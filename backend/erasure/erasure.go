@@ -0,0 +1,1179 @@
+// Package erasure implements a backend which splits objects into
+// Reed-Solomon coded shards stored across several remotes
+package erasure
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"path"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/configstruct"
+	"github.com/rclone/rclone/fs/fspath"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/object"
+	"golang.org/x/sync/errgroup"
+)
+
+// Each object is stored on every upstream as a small metadata object
+// named after the object and a shard named after the object with
+// shardSuffix, the number of the shard and the ID of the version of
+// the object appended. The metadata object is the same on every
+// upstream so the object can be listed and described while any
+// upstream is left.
+//
+// Each version of an object has its own shards, so updates write the
+// new shards alongside the old ones and switch to them by writing the
+// metadata.
+const (
+	shardSuffix     = ".rclone_shard."
+	maxMetadataSize = 1023
+	metadataVersion = 1
+	maxShards       = 256
+)
+
+// shardRegexp matches the names of shards, with or without an ID
+var shardRegexp = regexp.MustCompile(`^(.+)` + regexp.QuoteMeta(shardSuffix) + `([0-9]+)(\.[0-9a-f]+)?$`)
+
+// idRegexp matches the IDs of versions of objects
+var idRegexp = regexp.MustCompile(`^[0-9a-f]{1,64}$`)
+
+// standard erasure errors
+var (
+	ErrMetaTooBig  = errors.New("metadata is too big")
+	ErrMetaUnknown = errors.New("unknown metadata, please upgrade rclone")
+)
+
+// Register with Fs
+func init() {
+	fs.Register(&fs.RegInfo{
+		Name:        "erasure",
+		Description: "Split files into erasure coded shards stored on several remotes",
+		NewFs:       NewFs,
+		CommandHelp: commandHelp,
+		Options: []fs.Option{{
+			Name: "upstreams",
+			Help: `List of space separated upstreams, one for each shard.
+
+Can be 'remote1:dir remote2:dir remote3:dir' or
+'"remote1:dir with space" remote2:dir', etc.
+
+The order of the upstreams matters as shard i is always stored on
+upstream i, so don't change it once files have been stored.`,
+			Required: true,
+		}, {
+			Name: "parity_shards",
+			Help: `Number of parity shards.
+
+Each file is split into as many shards as there are upstreams. This
+many of them hold parity and the rest hold the data. Any this many
+upstreams can be lost and the files can still be read.`,
+			Default: 1,
+		}, {
+			Name: "stripe_size",
+			Help: `Size of the data in each stripe.
+
+Files are encoded in stripes of this much data which is split evenly
+between the data shards. Reads fetch whole stripes so smaller stripes
+make ranged reads cheaper at the cost of more work encoding.`,
+			Advanced: true,
+			Default:  fs.Mebi,
+		}, {
+			Name:     "meta_format",
+			Advanced: true,
+			Hide:     fs.OptionHideCommandLine,
+			Default:  "simplejson",
+			Help: `Format of the metadata object.
+
+Metadata is a small JSON file named after the file, stored on every
+upstream.`,
+			Examples: []fs.OptionExample{{
+				Value: "simplejson",
+				Help: `Simple JSON describes the layout of the shards.
+
+It has the following fields: ver, size, data, parity, block, id, md5, sha1.`,
+			}},
+		}},
+	})
+}
+
+// Options defines the configuration for this backend
+type Options struct {
+	Upstreams    fs.SpaceSepList `config:"upstreams"`
+	ParityShards int             `config:"parity_shards"`
+	StripeSize   fs.SizeSuffix   `config:"stripe_size"`
+	MetaFormat   string          `config:"meta_format"`
+}
+
+// Fs represents a set of upstreams holding erasure coded shards
+type Fs struct {
+	name      string
+	root      string
+	opt       Options
+	features  *fs.Features // optional features
+	upstreams []fs.Fs      // upstream i holds shard i
+	k         int          // number of data shards
+	m         int          // number of parity shards
+	block     int64        // size of the blocks of a full stripe
+}
+
+// NewFs constructs an Fs from the path, container:path
+func NewFs(ctx context.Context, name, root string, m configmap.Mapper) (fs.Fs, error) {
+	opt := new(Options)
+	err := configstruct.Set(m, opt)
+	if err != nil {
+		return nil, err
+	}
+	if opt.MetaFormat != "simplejson" {
+		return nil, fmt.Errorf("unsupported meta format %q", opt.MetaFormat)
+	}
+	n := len(opt.Upstreams)
+	if n < 2 || n > maxShards {
+		return nil, fmt.Errorf("erasure needs between 2 and %d upstreams - check the value of the upstreams setting", maxShards)
+	}
+	if opt.ParityShards < 1 || opt.ParityShards >= n {
+		return nil, fmt.Errorf("parity_shards must be at least 1 and less than the number of upstreams (%d)", n)
+	}
+	if opt.StripeSize <= 0 {
+		return nil, errors.New("stripe_size must be positive")
+	}
+	for _, u := range opt.Upstreams {
+		if strings.HasPrefix(u, name+":") {
+			return nil, errors.New("can't point erasure remote at itself - check the value of the upstreams setting")
+		}
+	}
+	root = strings.Trim(root, "/")
+	f := &Fs{
+		name:      name,
+		root:      root,
+		opt:       *opt,
+		upstreams: make([]fs.Fs, n),
+		m:         opt.ParityShards,
+		k:         n - opt.ParityShards,
+	}
+	f.block = (int64(opt.StripeSize) + int64(f.k) - 1) / int64(f.k)
+
+	// Make the upstreams, correcting the root if it points to a file
+	isFile := false
+	errs := f.forEachUpstream(func(i int, _ fs.Fs) (err error) {
+		f.upstreams[i], err = cache.Get(ctx, fspath.JoinRootPath(opt.Upstreams[i], root))
+		return err
+	})
+	for i, err := range errs {
+		if err == fs.ErrorIsFile {
+			isFile = true
+			errs[i] = nil
+		}
+	}
+	if isFile {
+		f.root = path.Dir(root)
+		if f.root == "." || f.root == "/" {
+			f.root = ""
+		}
+		for i := range opt.Upstreams {
+			if errs[i] == nil {
+				f.upstreams[i], errs[i] = cache.Get(ctx, fspath.JoinRootPath(opt.Upstreams[i], f.root))
+			}
+		}
+	}
+	// Carry on without the upstreams which couldn't be made as long
+	// as there are enough of the others to read and write files
+	for i, err := range errs {
+		if err != nil {
+			f.upstreams[i] = newUnavailable(opt.Upstreams[i], err)
+		}
+	}
+	err = f.tolerate(errs, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make upstreams: %w", err)
+	}
+	// Pin the upstreams into the cache until f is garbage collected
+	for _, u := range f.upstreams {
+		if !isUnavailable(u) {
+			cache.Pin(u)
+		}
+	}
+	runtime.SetFinalizer(f, func(f *Fs) {
+		for _, u := range f.upstreams {
+			if !isUnavailable(u) {
+				cache.Unpin(u)
+			}
+		}
+	})
+
+	f.features = (&fs.Features{
+		CaseInsensitive:         true,
+		DuplicateFiles:          false,
+		ReadMimeType:            false,
+		WriteMimeType:           false,
+		CanHaveEmptyDirectories: true,
+		BucketBased:             true,
+	}).Fill(ctx, f)
+	for _, u := range f.upstreams {
+		if !isUnavailable(u) {
+			f.features = f.features.Mask(ctx, u)
+		}
+	}
+	// show that we wrap other backends
+	f.features.Overlay = true
+
+	if isFile {
+		return f, fs.ErrorIsFile
+	}
+	return f, nil
+}
+
+// Name of the remote (as passed into NewFs)
+func (f *Fs) Name() string {
+	return f.name
+}
+
+// Root of the remote (as passed into NewFs)
+func (f *Fs) Root() string {
+	return f.root
+}
+
+// String converts this Fs to a string
+func (f *Fs) String() string {
+	return fmt.Sprintf("erasure root '%s'", f.root)
+}
+
+// Features returns the optional features of this Fs
+func (f *Fs) Features() *fs.Features {
+	return f.features
+}
+
+// Precision is the greatest precision of all the upstreams
+func (f *Fs) Precision() time.Duration {
+	var precision time.Duration
+	for _, u := range f.upstreams {
+		if !isUnavailable(u) && u.Precision() > precision {
+			precision = u.Precision()
+		}
+	}
+	return precision
+}
+
+// Hashes returns the supported hash sets.
+//
+// The hashes are computed on upload and stored in the metadata.
+func (f *Fs) Hashes() hash.Set {
+	return hash.NewHashSet(hash.MD5, hash.SHA1)
+}
+
+// shardName returns the name of shard i of the version id of remote
+func shardName(remote string, i int, id string) string {
+	return remote + shardSuffix + strconv.Itoa(i) + "." + id
+}
+
+// newID makes the ID for a new version of an object. IDs sort in the
+// order they were made.
+func newID() string {
+	return fmt.Sprintf("%016x%04x", time.Now().UnixNano(), rand.Intn(1<<16))
+}
+
+// isShardName returns true if remote is the name of a shard
+func isShardName(remote string) bool {
+	return shardRegexp.MatchString(remote)
+}
+
+// forEachUpstream runs fn on each upstream concurrently, returning
+// the errors
+func (f *Fs) forEachUpstream(fn func(i int, u fs.Fs) error) []error {
+	errs := make([]error, len(f.upstreams))
+	var wg sync.WaitGroup
+	for i, u := range f.upstreams {
+		wg.Add(1)
+		go func(i int, u fs.Fs) {
+			defer wg.Done()
+			errs[i] = fn(i, u)
+		}(i, u)
+	}
+	wg.Wait()
+	return errs
+}
+
+// tolerate returns an error if more upstreams failed than there are
+// parity shards, ignoring the errors which ignore returns true for
+func (f *Fs) tolerate(errs []error, ignore func(error) bool) error {
+	var failed []error
+	for i, err := range errs {
+		if err == nil || (ignore != nil && ignore(err)) {
+			continue
+		}
+		failed = append(failed, fmt.Errorf("%s: %w", fs.ConfigString(f.upstreams[i]), err))
+	}
+	if len(failed) > f.m {
+		return errors.Join(failed...)
+	}
+	for _, err := range failed {
+		fs.Errorf(f, "Ignoring failed upstream: %v", err)
+	}
+	return nil
+}
+
+// errUnavailable is returned by every operation on an upstream which
+// couldn't be made
+var errUnavailable = errors.New("upstream unavailable")
+
+// unavailable stands in for an upstream which couldn't be made so the
+// others can be used without it. Everything done with it fails.
+type unavailable struct {
+	name string // name of the upstream's config
+	root string // root of the upstream
+	err  error  // why it couldn't be made
+}
+
+// newUnavailable makes a stand in for upstream which couldn't be made
+// because of err
+func newUnavailable(upstream string, err error) *unavailable {
+	u := &unavailable{
+		name: "local",
+		root: upstream,
+		err:  fmt.Errorf("%w: %v", errUnavailable, err),
+	}
+	if parsed, parseErr := fspath.Parse(upstream); parseErr == nil {
+		if parsed.Name != "" {
+			u.name = parsed.Name
+		}
+		u.root = parsed.Path
+	}
+	return u
+}
+
+// isUnavailable returns true if u stands in for an upstream which
+// couldn't be made
+func isUnavailable(u fs.Fs) bool {
+	_, ok := u.(*unavailable)
+	return ok
+}
+
+// Name of the upstream
+func (u *unavailable) Name() string {
+	return u.name
+}
+
+// Root of the upstream
+func (u *unavailable) Root() string {
+	return u.root
+}
+
+// String converts this upstream to a string
+func (u *unavailable) String() string {
+	return u.name + ":" + u.root
+}
+
+// Precision of the upstream isn't known
+func (u *unavailable) Precision() time.Duration {
+	return fs.ModTimeNotSupported
+}
+
+// Hashes of the upstream aren't known
+func (u *unavailable) Hashes() hash.Set {
+	return hash.Set(hash.None)
+}
+
+// Features of the upstream aren't known
+func (u *unavailable) Features() *fs.Features {
+	return &fs.Features{}
+}
+
+// List fails as the upstream is unavailable
+func (u *unavailable) List(ctx context.Context, dir string) (fs.DirEntries, error) {
+	return nil, u.err
+}
+
+// NewObject fails as the upstream is unavailable
+func (u *unavailable) NewObject(ctx context.Context, remote string) (fs.Object, error) {
+	return nil, u.err
+}
+
+// Put fails as the upstream is unavailable
+func (u *unavailable) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	return nil, u.err
+}
+
+// Mkdir fails as the upstream is unavailable
+func (u *unavailable) Mkdir(ctx context.Context, dir string) error {
+	return u.err
+}
+
+// Rmdir fails as the upstream is unavailable
+func (u *unavailable) Rmdir(ctx context.Context, dir string) error {
+	return u.err
+}
+
+// List the objects and directories in dir into entries.
+func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err error) {
+	lists := make([]fs.DirEntries, len(f.upstreams))
+	errs := f.forEachUpstream(func(i int, u fs.Fs) (err error) {
+		lists[i], err = u.List(ctx, dir)
+		return err
+	})
+	notFound := 0
+	for _, err := range errs {
+		if errors.Is(err, fs.ErrorDirNotFound) || errors.Is(err, errUnavailable) {
+			notFound++
+		}
+	}
+	if notFound == len(f.upstreams) {
+		return nil, fs.ErrorDirNotFound
+	}
+	err = f.tolerate(errs, func(err error) bool { return errors.Is(err, fs.ErrorDirNotFound) })
+	if err != nil {
+		return nil, err
+	}
+
+	// Merge the listings
+	dirs := make(map[string]fs.Directory)
+	metas := make(map[string][]fs.Object)
+	var names []string
+	for i, list := range lists {
+		for _, entry := range list {
+			remote := entry.Remote()
+			switch x := entry.(type) {
+			case fs.Directory:
+				if _, found := dirs[remote]; !found {
+					dirs[remote] = x
+					names = append(names, remote)
+				}
+			case fs.Object:
+				if isShardName(remote) {
+					continue
+				}
+				if metas[remote] == nil {
+					metas[remote] = make([]fs.Object, len(f.upstreams))
+					names = append(names, remote)
+				}
+				metas[remote][i] = x
+			}
+		}
+	}
+
+	// Read the metadata
+	objs := make(map[string]*Object, len(metas))
+	var mu sync.Mutex
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(fs.GetConfig(ctx).Checkers)
+	for remote, meta := range metas {
+		remote, meta := remote, meta
+		g.Go(func() error {
+			o, err := f.newObject(gCtx, remote, meta)
+			if err != nil {
+				fs.Errorf(remote, "Skipping file: %v", err)
+				return nil
+			}
+			mu.Lock()
+			objs[remote] = o
+			mu.Unlock()
+			return nil
+		})
+	}
+	err = g.Wait()
+	if err != nil {
+		return nil, err
+	}
+	for _, remote := range names {
+		if d, found := dirs[remote]; found {
+			entries = append(entries, fs.NewDirCopy(ctx, d).SetRemote(remote))
+		} else if o, found := objs[remote]; found {
+			entries = append(entries, o)
+		}
+	}
+	return entries, nil
+}
+
+// NewObject finds the Object at remote.
+func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
+	if isShardName(remote) {
+		return nil, fs.ErrorObjectNotFound
+	}
+	meta := make([]fs.Object, len(f.upstreams))
+	errs := f.forEachUpstream(func(i int, u fs.Fs) (err error) {
+		meta[i], err = u.NewObject(ctx, remote)
+		return err
+	})
+	found := false
+	for _, o := range meta {
+		if o != nil {
+			found = true
+		}
+	}
+	if !found {
+		for _, err := range errs {
+			if err != nil && !errors.Is(err, fs.ErrorObjectNotFound) && !errors.Is(err, errUnavailable) {
+				return nil, err
+			}
+		}
+		return nil, fs.ErrorObjectNotFound
+	}
+	err := f.tolerate(errs, func(err error) bool { return errors.Is(err, fs.ErrorObjectNotFound) })
+	if err != nil {
+		return nil, err
+	}
+	return f.newObject(ctx, remote, meta)
+}
+
+// newObject makes an Object from the metadata objects found on the
+// upstreams
+//
+// The metadata is read from every upstream it was found on and the
+// newest version is used, as an upstream which was unavailable while
+// the object was updated may have the metadata of an older version.
+func (f *Fs) newObject(ctx context.Context, remote string, meta []fs.Object) (o *Object, err error) {
+	copies := make([]*Object, len(meta))
+	errs := f.forEachUpstream(func(i int, _ fs.Fs) error {
+		if meta[i] == nil {
+			return nil
+		}
+		c := &Object{
+			f:      f,
+			remote: remote,
+			meta:   meta,
+		}
+		err := c.readMetadata(ctx, meta[i])
+		if err != nil {
+			return err
+		}
+		copies[i] = c
+		return nil
+	})
+	for i, c := range copies {
+		if errors.Is(errs[i], ErrMetaUnknown) {
+			return nil, errs[i]
+		} else if errs[i] != nil {
+			fs.Debugf(meta[i], "Failed to read metadata: %v", errs[i])
+			err = errs[i]
+		}
+		if c != nil && (o == nil || c.id > o.id) {
+			o = c
+		}
+	}
+	if o == nil {
+		return nil, fmt.Errorf("%s: no readable metadata: %w", remote, err)
+	}
+	o.ids = make([]string, len(meta))
+	for i, c := range copies {
+		if c != nil {
+			o.ids[i] = c.id
+		}
+	}
+	return o, nil
+}
+
+// Put the shards and metadata of src read from in to the upstreams,
+// replacing the version old if set
+//
+// The shards are written under a new ID so the old version can still
+// be read until the metadata is switched to the new one. Writes
+// succeed as long as no more upstreams fail than there are parity
+// shards, leaving the rebuild command to repair the rest.
+func (f *Fs) put(ctx context.Context, in io.Reader, src fs.ObjectInfo, remote string, old *Object, options ...fs.OpenOption) (*Object, error) {
+	if isShardName(remote) {
+		return nil, fmt.Errorf("can't store %q as its name looks like a shard", remote)
+	}
+	size := src.Size()
+	if size < 0 {
+		return nil, errors.New("erasure can't upload files of unknown size")
+	}
+	l := &layout{k: f.k, m: f.m, block: f.block, size: size}
+	modTime := src.ModTime(ctx)
+
+	// Compute the hashes as the data is read
+	hasher, err := hash.NewMultiHasherTypes(f.Hashes())
+	if err != nil {
+		return nil, err
+	}
+	in = io.TeeReader(in, hasher)
+
+	want := make([]bool, l.n())
+	for i := range want {
+		want[i] = true
+	}
+	id := newID()
+	shards, errs, err := f.putShards(ctx, remote, id, modTime, l, in, want)
+	if err == nil {
+		err = f.tolerate(errs, nil)
+	}
+	if err != nil {
+		removeObjects(ctx, shards)
+		return nil, err
+	}
+
+	// Write the metadata to every upstream
+	sums := hasher.Sums()
+	o := &Object{
+		f:       f,
+		remote:  remote,
+		size:    size,
+		modTime: modTime,
+		k:       l.k,
+		m:       l.m,
+		block:   l.block,
+		id:      id,
+		md5:     sums[hash.MD5],
+		sha1:    sums[hash.SHA1],
+		meta:    make([]fs.Object, l.n()),
+		ids:     make([]string, l.n()),
+	}
+	// Find the version being replaced, which may not be old if the
+	// object has been updated elsewhere
+	var prev []*Object
+	if old != nil {
+		prev = old.versions(ctx)
+	} else if cur, err := f.NewObject(ctx, remote); err == nil {
+		prev = []*Object{cur.(*Object)}
+	}
+	if len(prev) > 0 {
+		old = prev[len(prev)-1]
+		copy(o.meta, old.meta)
+		copy(o.ids, old.ids)
+	}
+	errs = o.writeMetadata(ctx, nil, options...)
+	err = f.tolerate(errs, nil)
+	if err != nil {
+		o.undoMetadata(ctx, old, errs)
+		removeObjects(ctx, shards)
+		return nil, err
+	}
+	f.removeShards(ctx, remote, prev, id)
+	return o, nil
+}
+
+// undoMetadata puts back the metadata of old, or removes the metadata
+// if old is nil, on the upstreams the metadata of o was written to
+// successfully according to errs
+func (o *Object) undoMetadata(ctx context.Context, old *Object, errs []error) {
+	restore := make([]bool, len(errs))
+	for i, err := range errs {
+		if err != nil || o.meta[i] == nil {
+			continue
+		}
+		if old != nil && old.meta[i] != nil {
+			restore[i] = true
+		} else if err := o.meta[i].Remove(ctx); err != nil {
+			fs.Errorf(o, "Failed to remove metadata after failed upload: %v", err)
+		}
+	}
+	if old == nil {
+		return
+	}
+	for _, err := range old.writeMetadata(ctx, restore) {
+		if err != nil {
+			fs.Errorf(old, "Failed to restore metadata after failed upload: %v", err)
+		}
+	}
+}
+
+// removeObjects removes the objects which aren't nil, logging errors
+func removeObjects(ctx context.Context, objs []fs.Object) {
+	for _, o := range objs {
+		if o == nil {
+			continue
+		}
+		if err := o.Remove(ctx); err != nil {
+			fs.Errorf(o, "Failed to remove after failed upload: %v", err)
+		}
+	}
+}
+
+// shardWriter writes to a shard upload, discarding the writes after
+// the upload fails so the other shards can carry on
+type shardWriter struct {
+	w      io.Writer
+	failed bool
+}
+
+// Write p to the upload
+func (w *shardWriter) Write(p []byte) (int, error) {
+	if !w.failed {
+		if _, err := w.w.Write(p); err != nil {
+			w.failed = true
+		}
+	}
+	return len(p), nil
+}
+
+// putShards encodes the data read from in and uploads the shards
+// which are wanted to their upstreams under the ID given, returning
+// the shards uploaded and the error uploading each one.
+//
+// The error returned is set if the data couldn't be encoded.
+func (f *Fs) putShards(ctx context.Context, remote, id string, modTime time.Time, l *layout, in io.Reader, want []bool) (shards []fs.Object, errs []error, err error) {
+	writers := make([]io.Writer, l.n())
+	var pipeWriters []*io.PipeWriter
+	shards = make([]fs.Object, l.n())
+	errs = make([]error, l.n())
+	var wg sync.WaitGroup
+	for i, u := range f.upstreams {
+		if !want[i] {
+			continue
+		}
+		pr, pw := io.Pipe()
+		writers[i] = &shardWriter{w: pw}
+		pipeWriters = append(pipeWriters, pw)
+		wg.Add(1)
+		go func(i int, u fs.Fs) {
+			defer wg.Done()
+			info := object.NewStaticObjectInfo(shardName(remote, i, id), modTime, l.shardSize(), true, nil, u)
+			var err error
+			shards[i], err = u.Put(ctx, pr, info)
+			// Stop the encoder writing to this shard if the upload failed
+			_ = pr.CloseWithError(err)
+			if err != nil {
+				errs[i] = fmt.Errorf("failed to upload shard %d: %w", i, err)
+			}
+		}(i, u)
+	}
+	err = encode(l, in, writers)
+	for _, pw := range pipeWriters {
+		_ = pw.CloseWithError(err)
+	}
+	wg.Wait()
+	return shards, errs, err
+}
+
+// Put in to the remote path with the modTime given of the given size
+//
+// May create the object even if it returns an error - if so
+// will return the object and the error, otherwise will return
+// nil and the error
+func (f *Fs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	return f.put(ctx, in, src, src.Remote(), nil, options...)
+}
+
+// Mkdir makes the directory on all the upstreams
+func (f *Fs) Mkdir(ctx context.Context, dir string) error {
+	errs := f.forEachUpstream(func(i int, u fs.Fs) error {
+		return u.Mkdir(ctx, dir)
+	})
+	return f.tolerate(errs, nil)
+}
+
+// Rmdir removes the directory from all the upstreams
+func (f *Fs) Rmdir(ctx context.Context, dir string) error {
+	errs := f.forEachUpstream(func(i int, u fs.Fs) error {
+		return u.Rmdir(ctx, dir)
+	})
+	notFound := 0
+	for _, err := range errs {
+		if errors.Is(err, fs.ErrorDirNotFound) || errors.Is(err, errUnavailable) {
+			notFound++
+		}
+	}
+	if notFound == len(f.upstreams) {
+		return fs.ErrorDirNotFound
+	}
+	for _, err := range errs {
+		if err != nil && !errors.Is(err, fs.ErrorDirNotFound) && !errors.Is(err, errUnavailable) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Shutdown the backend, closing any background tasks and any
+// cached connections.
+func (f *Fs) Shutdown(ctx context.Context) error {
+	errs := f.forEachUpstream(func(i int, u fs.Fs) error {
+		if do := u.Features().Shutdown; do != nil {
+			return do(ctx)
+		}
+		return nil
+	})
+	return errors.Join(errs...)
+}
+
+// Object describes an object made of shards on the upstreams
+type Object struct {
+	f       *Fs
+	remote  string
+	size    int64
+	modTime time.Time
+	k       int         // number of data shards
+	m       int         // number of parity shards
+	block   int64       // size of the blocks of a full stripe
+	id      string      // ID of this version of the object
+	md5     string      // MD5 of the data if known
+	sha1    string      // SHA1 of the data if known
+	meta    []fs.Object // metadata object on each upstream, nil if missing
+	ids     []string    // ID in the metadata on each upstream, "" if unreadable
+}
+
+// Meta format `simplejson`
+type metaSimpleJSON struct {
+	// required core fields
+	Version *int   `json:"ver"`
+	Size    *int64 `json:"size"`   // size of the data
+	Data    *int   `json:"data"`   // number of data shards
+	Parity  *int   `json:"parity"` // number of parity shards
+	Block   *int64 `json:"block"`  // size of the blocks of a full stripe
+	ID      string `json:"id"`     // ID of the version of the shards
+	// optional extra fields
+	MD5  string `json:"md5,omitempty"`
+	SHA1 string `json:"sha1,omitempty"`
+}
+
+// marshalSimpleJSON makes the metadata for the object
+func (o *Object) marshalSimpleJSON() ([]byte, error) {
+	version := metadataVersion
+	metadata := metaSimpleJSON{
+		Version: &version,
+		Size:    &o.size,
+		Data:    &o.k,
+		Parity:  &o.m,
+		Block:   &o.block,
+		ID:      o.id,
+		MD5:     o.md5,
+		SHA1:    o.sha1,
+	}
+	data, err := json.Marshal(&metadata)
+	if err == nil && len(data) > maxMetadataSize {
+		return nil, ErrMetaTooBig
+	}
+	return data, err
+}
+
+// unmarshalSimpleJSON parses the metadata into the object
+func (o *Object) unmarshalSimpleJSON(data []byte) error {
+	if len(data) < 2 || data[0] != '{' || data[len(data)-1] != '}' {
+		return errors.New("invalid json")
+	}
+	var metadata metaSimpleJSON
+	err := json.Unmarshal(data, &metadata)
+	if err != nil {
+		return err
+	}
+	if metadata.Version == nil || metadata.Size == nil || metadata.Data == nil || metadata.Parity == nil || metadata.Block == nil {
+		return errors.New("missing required field")
+	}
+	if *metadata.Version > metadataVersion {
+		return ErrMetaUnknown
+	}
+	if *metadata.Version < 1 {
+		return errors.New("wrong version")
+	}
+	if *metadata.Size < 0 {
+		return errors.New("negative file size")
+	}
+	if *metadata.Data < 1 || *metadata.Parity < 0 || *metadata.Data+*metadata.Parity != len(o.f.upstreams) {
+		return fmt.Errorf("metadata has %d data and %d parity shards but there are %d upstreams", *metadata.Data, *metadata.Parity, len(o.f.upstreams))
+	}
+	if *metadata.Block < 1 {
+		return errors.New("wrong block size")
+	}
+	if !idRegexp.MatchString(metadata.ID) {
+		return errors.New("wrong id")
+	}
+	if metadata.MD5 != "" {
+		if _, err = hex.DecodeString(metadata.MD5); len(metadata.MD5) != 32 || err != nil {
+			return errors.New("wrong md5 hash")
+		}
+	}
+	if metadata.SHA1 != "" {
+		if _, err = hex.DecodeString(metadata.SHA1); len(metadata.SHA1) != 40 || err != nil {
+			return errors.New("wrong sha1 hash")
+		}
+	}
+	o.size = *metadata.Size
+	o.k = *metadata.Data
+	o.m = *metadata.Parity
+	o.block = *metadata.Block
+	o.id = metadata.ID
+	o.md5 = metadata.MD5
+	o.sha1 = metadata.SHA1
+	return nil
+}
+
+// readMetadata reads the metadata of the object from metaObject
+func (o *Object) readMetadata(ctx context.Context, metaObject fs.Object) (err error) {
+	if metaObject.Size() > maxMetadataSize {
+		return ErrMetaTooBig
+	}
+	in, err := metaObject.Open(ctx)
+	if err != nil {
+		return err
+	}
+	defer fs.CheckClose(in, &err)
+	data, err := io.ReadAll(io.LimitReader(in, maxMetadataSize+1))
+	if err != nil {
+		return err
+	}
+	if len(data) > maxMetadataSize {
+		return ErrMetaTooBig
+	}
+	err = o.unmarshalSimpleJSON(data)
+	if err != nil {
+		return err
+	}
+	o.modTime = metaObject.ModTime(ctx)
+	return nil
+}
+
+// writeMetadata writes the metadata of the object to the upstreams
+// which want it, or all of them if want is nil, returning the error
+// writing to each upstream
+func (o *Object) writeMetadata(ctx context.Context, want []bool, options ...fs.OpenOption) []error {
+	data, err := o.marshalSimpleJSON()
+	if err != nil {
+		errs := make([]error, len(o.f.upstreams))
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+	return o.f.forEachUpstream(func(i int, u fs.Fs) (err error) {
+		if want != nil && !want[i] {
+			return nil
+		}
+		info := object.NewStaticObjectInfo(o.remote, o.modTime, int64(len(data)), true, nil, u)
+		if o.meta[i] != nil {
+			err = o.meta[i].Update(ctx, bytes.NewReader(data), info, options...)
+		} else {
+			o.meta[i], err = u.Put(ctx, bytes.NewReader(data), info, options...)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write metadata: %w", err)
+		}
+		if o.ids != nil {
+			o.ids[i] = o.id
+		}
+		return nil
+	})
+}
+
+// versions returns o and the version of it stored now if that is
+// different, as the object may have been updated elsewhere
+func (o *Object) versions(ctx context.Context) []*Object {
+	cur, err := o.f.NewObject(ctx, o.remote)
+	if err != nil || cur.(*Object).id == o.id {
+		return []*Object{o}
+	}
+	return []*Object{o, cur.(*Object)}
+}
+
+// shardIDs returns the IDs of the shards of the versions which may be
+// on upstream i
+func shardIDs(versions []*Object, i int) (ids []string) {
+	seen := make(map[string]bool)
+	add := func(id string) {
+		if id != "" && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	for _, v := range versions {
+		add(v.id)
+		if v.ids != nil {
+			add(v.ids[i])
+		}
+	}
+	return ids
+}
+
+// removeShard removes shard i of the version id of remote if it
+// exists
+func (f *Fs) removeShard(ctx context.Context, remote string, i int, id string) error {
+	shard, err := f.upstreams[i].NewObject(ctx, shardName(remote, i, id))
+	if err == nil {
+		err = shard.Remove(ctx)
+	}
+	if errors.Is(err, fs.ErrorObjectNotFound) {
+		return nil
+	}
+	return err
+}
+
+// removeShards removes the shards of the versions of remote apart
+// from those of keep, logging errors
+func (f *Fs) removeShards(ctx context.Context, remote string, versions []*Object, keep string) {
+	f.forEachUpstream(func(i int, u fs.Fs) error {
+		for _, id := range shardIDs(versions, i) {
+			if id == keep {
+				continue
+			}
+			if err := f.removeShard(ctx, remote, i, id); err != nil {
+				fs.Errorf(remote, "Failed to remove old shard %d from %s: %v", i, fs.ConfigString(u), err)
+			}
+		}
+		return nil
+	})
+}
+
+// layout returns the layout of the shards of the object
+func (o *Object) layout() *layout {
+	return &layout{k: o.k, m: o.m, block: o.block, size: o.size}
+}
+
+// Fs returns the parent Fs
+func (o *Object) Fs() fs.Info {
+	return o.f
+}
+
+// Return a string version
+func (o *Object) String() string {
+	if o == nil {
+		return "<nil>"
+	}
+	return o.remote
+}
+
+// Remote returns the remote path
+func (o *Object) Remote() string {
+	return o.remote
+}
+
+// Size returns the size of the data
+func (o *Object) Size() int64 {
+	return o.size
+}
+
+// ModTime returns the modification time of the object
+func (o *Object) ModTime(ctx context.Context) time.Time {
+	return o.modTime
+}
+
+// Hash returns the selected checksum of the data
+func (o *Object) Hash(ctx context.Context, ht hash.Type) (string, error) {
+	switch ht {
+	case hash.MD5:
+		return o.md5, nil
+	case hash.SHA1:
+		return o.sha1, nil
+	}
+	return "", hash.ErrUnsupported
+}
+
+// Storable returns whether object is storable
+func (o *Object) Storable() bool {
+	return true
+}
+
+// SetModTime sets the modification time of the metadata objects
+func (o *Object) SetModTime(ctx context.Context, modTime time.Time) error {
+	errs := o.f.forEachUpstream(func(i int, u fs.Fs) error {
+		if o.meta[i] == nil {
+			return nil
+		}
+		return o.meta[i].SetModTime(ctx, modTime)
+	})
+	err := errors.Join(errs...)
+	if err != nil {
+		return err
+	}
+	o.modTime = modTime
+	return nil
+}
+
+// openShard opens shard i of the object from offset to end
+func (o *Object) openShard(ctx context.Context, i int, offset, end int64) (io.ReadCloser, error) {
+	shard, err := o.f.upstreams[i].NewObject(ctx, shardName(o.remote, i, o.id))
+	if err != nil {
+		return nil, err
+	}
+	if shard.Size() != o.layout().shardSize() {
+		return nil, fmt.Errorf("shard is %d bytes but should be %d", shard.Size(), o.layout().shardSize())
+	}
+	return shard.Open(ctx, &fs.RangeOption{Start: offset, End: end - 1})
+}
+
+// Open an object for read, reading only the stripes needed for the
+// range asked for
+func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (io.ReadCloser, error) {
+	var offset, limit int64 = 0, -1
+	for _, option := range options {
+		switch x := option.(type) {
+		case *fs.SeekOption:
+			offset = x.Offset
+		case *fs.RangeOption:
+			offset, limit = x.Decode(o.size)
+		default:
+			if option.Mandatory() {
+				fs.Logf(o, "Unsupported mandatory option: %v", option)
+			}
+		}
+	}
+	end := o.size
+	if limit >= 0 && offset+limit < end {
+		end = offset + limit
+	}
+	if offset > end {
+		offset = end
+	}
+	l := o.layout()
+	shardEnd := l.shardSize()
+	if end > 0 {
+		// Only read up to the end of the last stripe needed
+		last := (end - 1) / l.stripeData()
+		shardEnd = l.blockEnd(last)
+	}
+	d, err := newDecoder(l, func(ctx context.Context, i int, offset int64) (io.ReadCloser, error) {
+		return o.openShard(ctx, i, offset, shardEnd)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newStripeReader(ctx, d, offset, end), nil
+}
+
+// Update the object with the contents of the io.Reader, modTime and size
+func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	newO, err := o.f.put(ctx, in, src, o.remote, o, options...)
+	if err != nil {
+		return err
+	}
+	*o = *newO
+	return nil
+}
+
+// Remove the metadata and shards from all the upstreams
+func (o *Object) Remove(ctx context.Context) error {
+	versions := o.versions(ctx)
+	errs := o.f.forEachUpstream(func(i int, u fs.Fs) error {
+		for _, id := range shardIDs(versions, i) {
+			err := o.f.removeShard(ctx, o.remote, i, id)
+			if err != nil {
+				return err
+			}
+		}
+		meta := o.meta[i]
+		for _, v := range versions {
+			if meta == nil {
+				meta = v.meta[i]
+			}
+		}
+		if meta == nil {
+			return nil
+		}
+		err := meta.Remove(ctx)
+		if err != nil && !errors.Is(err, fs.ErrorObjectNotFound) {
+			return err
+		}
+		o.meta[i] = nil
+		return nil
+	})
+	return errors.Join(errs...)
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Fs         = (*Fs)(nil)
+	_ fs.Fs         = (*unavailable)(nil)
+	_ fs.Commander  = (*Fs)(nil)
+	_ fs.Shutdowner = (*Fs)(nil)
+	_ fs.Object     = (*Object)(nil)
+)
@@ -0,0 +1,384 @@
+package erasure
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/lib/random"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLayout(t *testing.T) {
+	for _, test := range []struct {
+		k, size   int64
+		block     int64
+		stripes   int64
+		shardSize int64
+	}{
+		{k: 3, block: 10, size: 0, stripes: 0, shardSize: 0},
+		{k: 3, block: 10, size: 1, stripes: 1, shardSize: 5},
+		{k: 3, block: 10, size: 4, stripes: 1, shardSize: 6},
+		{k: 3, block: 10, size: 30, stripes: 1, shardSize: 14},
+		{k: 3, block: 10, size: 31, stripes: 2, shardSize: 19},
+		{k: 3, block: 10, size: 65, stripes: 3, shardSize: 34},
+	} {
+		l := layout{k: int(test.k), m: 2, block: test.block, size: test.size}
+		what := fmt.Sprintf("%+v", test)
+		assert.Equal(t, test.stripes, l.stripes(), what)
+		assert.Equal(t, test.shardSize, l.shardSize(), what)
+	}
+}
+
+// newTestFs makes an erasure Fs with 3 data shards and 2 parity
+// shards on local directories
+func newTestFs(t *testing.T) (*Fs, []string) {
+	var dirs []string
+	for i := 0; i < 5; i++ {
+		dirs = append(dirs, t.TempDir())
+	}
+	f, err := fs.NewFs(context.Background(), fmt.Sprintf(":erasure,upstreams='%s',parity_shards=2,stripe_size=100:", strings.Join(dirs, " ")))
+	require.NoError(t, err)
+	return f.(*Fs), dirs
+}
+
+// put data into f at remote
+func put(t *testing.T, f fs.Fs, remote string, data []byte) fs.Object {
+	src := object.NewStaticObjectInfo(remote, time.Now(), int64(len(data)), true, nil, nil)
+	o, err := f.Put(context.Background(), bytes.NewReader(data), src)
+	require.NoError(t, err)
+	return o
+}
+
+// shardPath returns the path of shard i of o in dir
+func shardPath(o fs.Object, dir string, i int) string {
+	return filepath.Join(dir, shardName(o.Remote(), i, o.(*Object).id))
+}
+
+// read the range of o
+func read(o fs.Object, options ...fs.OpenOption) ([]byte, error) {
+	in, err := o.Open(context.Background(), options...)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(in)
+	closeErr := in.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return data, err
+}
+
+func TestLoseShards(t *testing.T) {
+	ctx := context.Background()
+	f, dirs := newTestFs(t)
+	data := []byte(random.String(1234))
+	obj := put(t, f, "file.bin", data)
+
+	// Lose two upstreams completely
+	require.NoError(t, os.RemoveAll(dirs[0]))
+	require.NoError(t, os.Remove(shardPath(obj, dirs[3], 3)))
+
+	o, err := f.NewObject(ctx, "file.bin")
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(data)), o.Size())
+	got, err := read(o)
+	require.NoError(t, err)
+	assert.Equal(t, data, got)
+
+	// Check ranged reads
+	for _, r := range []fs.RangeOption{
+		{Start: 0, End: 0},
+		{Start: 5, End: 150},
+		{Start: 99, End: 100},
+		{Start: 1200, End: -1},
+		{Start: -1, End: 10},
+	} {
+		got, err := read(o, &r)
+		require.NoError(t, err)
+		offset, limit := r.Decode(int64(len(data)))
+		end := int64(len(data))
+		if limit >= 0 {
+			end = offset + limit
+		}
+		assert.Equal(t, data[offset:end], got, r.String())
+	}
+
+	// Losing another shard is too many
+	require.NoError(t, os.Remove(shardPath(obj, dirs[1], 1)))
+	_, err = read(o)
+	assert.ErrorIs(t, err, ErrorTooManyShardsLost)
+}
+
+func TestScrubRebuild(t *testing.T) {
+	ctx := context.Background()
+	f, dirs := newTestFs(t)
+	data := []byte(random.String(1000))
+	obj := put(t, f, "dir/file.bin", data)
+
+	scrub := func(full bool) map[string]interface{} {
+		opt := map[string]string{}
+		if full {
+			opt["full"] = "true"
+		}
+		out, err := f.Command(ctx, "scrub", nil, opt)
+		require.NoError(t, err)
+		return out.(map[string]interface{})
+	}
+	out := scrub(true)
+	assert.Equal(t, 1, out["ok"])
+
+	// Corrupt a shard in a way which doesn't change its size
+	shard := shardPath(obj, dirs[4], 4)
+	shardData, err := os.ReadFile(shard)
+	require.NoError(t, err)
+	shardData[10] ^= 0xFF
+	require.NoError(t, os.WriteFile(shard, shardData, 0666))
+	assert.Equal(t, 1, scrub(false)["ok"])
+	out = scrub(true)
+	assert.Equal(t, []string{fmt.Sprintf("shard 4 on %s: corrupted", dirs[4])}, out["damaged"].(map[string][]string)["dir/file.bin"])
+
+	rebuilt, err := f.Command(ctx, "rebuild", nil, map[string]string{"full": ""})
+	require.NoError(t, err)
+	assert.Equal(t, 1, rebuilt.(map[string]interface{})["rebuilt"])
+	assert.Equal(t, 1, scrub(true)["ok"])
+
+	// Remove a shard and the metadata from an upstream
+	require.NoError(t, os.Remove(shardPath(obj, dirs[2], 2)))
+	require.NoError(t, os.Remove(filepath.Join(dirs[2], "dir", "file.bin")))
+	out = scrub(false)
+	assert.Equal(t, 0, out["ok"])
+	assert.Equal(t, 2, len(out["damaged"].(map[string][]string)["dir/file.bin"]))
+
+	rebuilt, err = f.Command(ctx, "rebuild", nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, rebuilt.(map[string]interface{})["rebuilt"])
+	assert.Equal(t, 1, scrub(true)["ok"])
+
+	// Check the data can be read from the rebuilt shards alone
+	require.NoError(t, os.RemoveAll(filepath.Join(dirs[0], "dir")))
+	require.NoError(t, os.RemoveAll(filepath.Join(dirs[1], "dir")))
+	o, err := f.NewObject(ctx, "dir/file.bin")
+	require.NoError(t, err)
+	got, err := read(o)
+	require.NoError(t, err)
+	assert.Equal(t, data, got)
+}
+
+func TestShardNames(t *testing.T) {
+	f, dirs := newTestFs(t)
+	put(t, f, "file.txt", []byte("hello"))
+	assert.True(t, isShardName(shardName("file.txt", 12, newID())))
+	assert.True(t, isShardName("file.txt"+shardSuffix+"12"))
+	assert.False(t, isShardName("file.txt"))
+
+	// Shards aren't listed
+	entries, err := f.List(context.Background(), "")
+	require.NoError(t, err)
+	require.Equal(t, 1, len(entries))
+	assert.Equal(t, "file.txt", entries[0].Remote())
+	assert.Equal(t, int64(5), entries[0].Size())
+
+	// Files can't be stored with shard names
+	src := object.NewStaticObjectInfo(shardName("file.txt", 0, newID()), time.Now(), 1, true, nil, nil)
+	_, err = f.Put(context.Background(), strings.NewReader("x"), src)
+	assert.Error(t, err)
+
+	// The metadata is the same on every upstream
+	var metas []string
+	for _, dir := range dirs {
+		meta, err := os.ReadFile(filepath.Join(dir, "file.txt"))
+		require.NoError(t, err)
+		metas = append(metas, string(meta))
+	}
+	for _, meta := range metas[1:] {
+		assert.Equal(t, metas[0], meta)
+	}
+	assert.Contains(t, metas[0], `"data":3`)
+}
+
+// errorReader returns the data then an error
+type errorReader struct {
+	data []byte
+}
+
+// Read the data then return an error
+func (r *errorReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, errors.New("read failed")
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+// countFiles returns the number of files under dir
+func countFiles(t *testing.T, dir string) (n int) {
+	require.NoError(t, filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			n++
+		}
+		return err
+	}))
+	return n
+}
+
+func TestUpdateFailed(t *testing.T) {
+	ctx := context.Background()
+	f, dirs := newTestFs(t)
+	data := []byte(random.String(1000))
+	o := put(t, f, "file.bin", data)
+
+	// Update with a source which fails part way through
+	newData := []byte(random.String(1000))
+	src := object.NewStaticObjectInfo("file.bin", time.Now(), int64(len(newData)), true, nil, nil)
+	err := o.Update(ctx, &errorReader{data: newData[:500]}, src)
+	require.Error(t, err)
+
+	// The old version can still be read and nothing is left behind
+	o, err = f.NewObject(ctx, "file.bin")
+	require.NoError(t, err)
+	got, err := read(o)
+	require.NoError(t, err)
+	assert.Equal(t, data, got)
+	for _, dir := range dirs {
+		assert.Equal(t, 2, countFiles(t, dir), dir)
+	}
+
+	// A successful update replaces the shards
+	require.NoError(t, o.Update(ctx, bytes.NewReader(newData), src))
+	got, err = read(o)
+	require.NoError(t, err)
+	assert.Equal(t, newData, got)
+	for _, dir := range dirs {
+		assert.Equal(t, 2, countFiles(t, dir), dir)
+	}
+}
+
+func TestCorruptedShardRead(t *testing.T) {
+	f, dirs := newTestFs(t)
+	data := []byte(random.String(1000))
+	o := put(t, f, "file.bin", data)
+
+	// Corrupt a data shard without changing its size
+	shard := shardPath(o, dirs[1], 1)
+	shardData, err := os.ReadFile(shard)
+	require.NoError(t, err)
+	shardData[len(shardData)/2] ^= 0xFF
+	require.NoError(t, os.WriteFile(shard, shardData, 0666))
+
+	// The data is read from the parity shards instead
+	got, err := read(o)
+	require.NoError(t, err)
+	assert.Equal(t, data, got)
+	got, err = read(o, &fs.RangeOption{Start: 500, End: 599})
+	require.NoError(t, err)
+	assert.Equal(t, data[500:600], got)
+}
+
+func TestDegradedWrite(t *testing.T) {
+	ctx := context.Background()
+	f, dirs := newTestFs(t)
+	oldData := []byte(random.String(1000))
+	put(t, f, "dir/file.bin", oldData)
+
+	// Make upstream 0 unavailable by putting a file in place of it
+	require.NoError(t, os.Rename(dirs[0], dirs[0]+".bak"))
+	require.NoError(t, os.WriteFile(dirs[0], nil, 0666))
+
+	// Update the file and write a new one
+	data := []byte(random.String(1234))
+	o := put(t, f, "dir/file.bin", data)
+	put(t, f, "dir/new.bin", data)
+	got, err := read(o)
+	require.NoError(t, err)
+	assert.Equal(t, data, got)
+
+	// Bring upstream 0 back with the old version on it
+	require.NoError(t, os.Remove(dirs[0]))
+	require.NoError(t, os.Rename(dirs[0]+".bak", dirs[0]))
+	o, err = f.NewObject(ctx, "dir/file.bin")
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(data)), o.Size())
+	got, err = read(o)
+	require.NoError(t, err)
+	assert.Equal(t, data, got)
+
+	out, err := f.Command(ctx, "scrub", nil, nil)
+	require.NoError(t, err)
+	damaged := out.(map[string]interface{})["damaged"].(map[string][]string)
+	assert.Equal(t, []string{
+		fmt.Sprintf("metadata on %s: is for an older version", dirs[0]),
+		fmt.Sprintf("shard 0 on %s: missing", dirs[0]),
+	}, damaged["dir/file.bin"])
+	assert.Equal(t, 2, len(damaged["dir/new.bin"]))
+
+	// Rebuild replaces the old version on upstream 0
+	out, err = f.Command(ctx, "rebuild", nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, out.(map[string]interface{})["rebuilt"])
+	out, err = f.Command(ctx, "scrub", nil, map[string]string{"full": ""})
+	require.NoError(t, err)
+	assert.Equal(t, 2, out.(map[string]interface{})["ok"])
+	assert.Equal(t, 4, countFiles(t, dirs[0]))
+	require.NoError(t, os.Remove(shardPath(o, dirs[1], 1)))
+	require.NoError(t, os.Remove(shardPath(o, dirs[2], 2)))
+	got, err = read(o)
+	require.NoError(t, err)
+	assert.Equal(t, data, got)
+
+	// Writes fail if more upstreams than parity shards are unavailable
+	for _, dir := range dirs[:3] {
+		require.NoError(t, os.RemoveAll(dir))
+		require.NoError(t, os.WriteFile(dir, nil, 0666))
+	}
+	src := object.NewStaticObjectInfo("dir/other.bin", time.Now(), int64(len(data)), true, nil, nil)
+	_, err = f.Put(ctx, bytes.NewReader(data), src)
+	assert.Error(t, err)
+	for _, dir := range dirs[3:] {
+		assert.Equal(t, 4, countFiles(t, dir), dir)
+	}
+}
+
+func TestUnavailableUpstream(t *testing.T) {
+	ctx := context.Background()
+	f, dirs := newTestFs(t)
+	data := []byte(random.String(1234))
+	put(t, f, "dir/file.bin", data)
+
+	// Replace upstream 4 with one which can't be made
+	newFs := func(upstreams ...string) (fs.Fs, error) {
+		return fs.NewFs(ctx, fmt.Sprintf(":erasure,upstreams='%s',parity_shards=2,stripe_size=100:", strings.Join(upstreams, " ")))
+	}
+	f2, err := newFs(dirs[0], dirs[1], dirs[2], dirs[3], "erasure-test-missing:dir")
+	require.NoError(t, err)
+	o, err := f2.NewObject(ctx, "dir/file.bin")
+	require.NoError(t, err)
+	got, err := read(o)
+	require.NoError(t, err)
+	assert.Equal(t, data, got)
+	entries, err := f2.List(ctx, "dir")
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(entries))
+	_, err = f2.NewObject(ctx, "dir/missing.bin")
+	assert.ErrorIs(t, err, fs.ErrorObjectNotFound)
+	_, err = f2.List(ctx, "missing")
+	assert.ErrorIs(t, err, fs.ErrorDirNotFound)
+	put(t, f2, "dir/new.bin", data)
+	assert.Equal(t, 4, countFiles(t, dirs[3]))
+
+	// Fewer usable upstreams than data shards is an error
+	_, err = newFs(dirs[0], dirs[1], "erasure-test-missing:a", "erasure-test-missing:b", "erasure-test-missing:c")
+	assert.Error(t, err)
+}
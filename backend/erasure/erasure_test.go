@@ -0,0 +1,78 @@
+// Test Erasure filesystem interface
+package erasure_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rclone/rclone/backend/erasure"
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/fstest/fstests"
+)
+
+var (
+	unimplementableFsMethods     = []string{"UnWrap", "WrapFs", "SetWrapper", "UserInfo", "Disconnect", "PublicLink", "PutUnchecked", "MergeDirs", "OpenWriterAt", "OpenChunkWriter", "HardLink", "PutStream", "Copy", "Move", "DirMove", "Purge", "ListR", "About", "CleanUp", "ChangeNotify", "DirCacheFlush", "DirSetModTime", "MkdirMetadata"}
+	unimplementableObjectMethods = []string{"MimeType", "ID", "GetTier", "SetTier", "Metadata", "SetMetadata", "UnWrap"}
+	unimplementableDirMethods    = []string{"Metadata", "SetMetadata", "SetModTime"}
+)
+
+// TestIntegration runs integration tests against the remote
+func TestIntegration(t *testing.T) {
+	if *fstest.RemoteName == "" {
+		t.Skip("Skipping as -remote not set")
+	}
+	fstests.Run(t, &fstests.Opt{
+		RemoteName:                   *fstest.RemoteName,
+		NilObject:                    (*erasure.Object)(nil),
+		UnimplementableFsMethods:     unimplementableFsMethods,
+		UnimplementableObjectMethods: unimplementableObjectMethods,
+	})
+}
+
+func TestLocal(t *testing.T) {
+	if *fstest.RemoteName != "" {
+		t.Skip("Skipping as -remote set")
+	}
+	upstreams := t.TempDir() + " " + t.TempDir() + " " + t.TempDir()
+	name := "TestErasure"
+	fstests.Run(t, &fstests.Opt{
+		RemoteName: name + ":",
+		NilObject:  (*erasure.Object)(nil),
+		ExtraConfig: []fstests.ExtraConfigItem{
+			{Name: name, Key: "type", Value: "erasure"},
+			{Name: name, Key: "upstreams", Value: upstreams},
+			{Name: name, Key: "parity_shards", Value: "1"},
+			{Name: name, Key: "stripe_size", Value: "1000"},
+		},
+		UnimplementableFsMethods:        unimplementableFsMethods,
+		UnimplementableObjectMethods:    unimplementableObjectMethods,
+		UnimplementableDirectoryMethods: unimplementableDirMethods,
+		QuickTestOK:                     true,
+	})
+}
+
+func TestParity2(t *testing.T) {
+	if *fstest.RemoteName != "" {
+		t.Skip("Skipping as -remote set")
+	}
+	var dirs []string
+	for i := 0; i < 5; i++ {
+		dirs = append(dirs, t.TempDir())
+	}
+	name := "TestErasureParity2"
+	fstests.Run(t, &fstests.Opt{
+		RemoteName: name + ":",
+		NilObject:  (*erasure.Object)(nil),
+		ExtraConfig: []fstests.ExtraConfigItem{
+			{Name: name, Key: "type", Value: "erasure"},
+			{Name: name, Key: "upstreams", Value: strings.Join(dirs, " ")},
+			{Name: name, Key: "parity_shards", Value: "2"},
+			{Name: name, Key: "stripe_size", Value: "999"},
+		},
+		UnimplementableFsMethods:        unimplementableFsMethods,
+		UnimplementableObjectMethods:    unimplementableObjectMethods,
+		UnimplementableDirectoryMethods: unimplementableDirMethods,
+		QuickTestOK:                     true,
+	})
+}
@@ -0,0 +1,372 @@
+package erasure
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/walk"
+	"storj.io/infectious"
+)
+
+var commandHelp = []fs.CommandHelp{{
+	Name:  "scrub",
+	Short: "Check the shards and metadata of files for damage.",
+	Long: `This checks that every upstream has the metadata and a shard of the
+right size for each file in the directories given, or the root if
+none are given.
+
+Usage Example:
+
+    rclone backend scrub erasure: [dir...]
+    rclone backend scrub -o full erasure: [dir...]
+
+With the "full" option every shard is read to check the parity
+matches the data, find any corrupted shards and check the data
+against the checksums in the metadata. This reads all the data.
+
+It returns the number of files which are ok, and the damage found
+to files which can be rebuilt and those which can't.
+`,
+	Opts: map[string]string{
+		"full": "Read all the shards to find corruption",
+	},
+}, {
+	Name:  "rebuild",
+	Short: "Rebuild damaged shards and metadata.",
+	Long: `This scrubs the files in the directories given, or the root if none
+are given, and rebuilds the shards and metadata which are damaged or
+missing from the shards which are left.
+
+Usage Example:
+
+    rclone backend rebuild erasure: [dir...]
+    rclone backend rebuild -o full erasure: [dir...]
+
+Use this after an upstream has been replaced or was unavailable while
+files were written. Shards and metadata of older versions of the
+files left on upstreams which were unavailable are replaced. The
+"full" option is as for the scrub command.
+
+It returns the number of files rebuilt, which were ok and which
+couldn't be rebuilt.
+`,
+	Opts: map[string]string{
+		"full": "Read all the shards to find corruption",
+	},
+}}
+
+// damage describes what is wrong with the shards and metadata of an
+// object
+type damage struct {
+	meta   []string // why the metadata on each upstream is bad or ""
+	shards []string // why the shard on each upstream is bad or ""
+	data   string   // why the data is bad or ""
+}
+
+// lost returns the number of shards which are bad
+func (d *damage) lost() (n int) {
+	for _, reason := range d.shards {
+		if reason != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// ok returns true if nothing is damaged
+func (d *damage) ok() bool {
+	for i := range d.shards {
+		if d.shards[i] != "" || d.meta[i] != "" {
+			return false
+		}
+	}
+	return d.data == ""
+}
+
+// reasons returns the damage as a list of strings
+func (d *damage) reasons(f *Fs) (reasons []string) {
+	for i := range d.shards {
+		name := fs.ConfigString(f.upstreams[i])
+		if d.meta[i] != "" {
+			reasons = append(reasons, fmt.Sprintf("metadata on %s: %s", name, d.meta[i]))
+		}
+		if d.shards[i] != "" {
+			reasons = append(reasons, fmt.Sprintf("shard %d on %s: %s", i, name, d.shards[i]))
+		}
+	}
+	if d.data != "" {
+		reasons = append(reasons, d.data)
+	}
+	return reasons
+}
+
+// scrubObject checks the metadata and shards of o, reading all the
+// shards if full is set
+func (f *Fs) scrubObject(ctx context.Context, o *Object, full bool) (*damage, error) {
+	l := o.layout()
+	d := &damage{
+		meta:   make([]string, l.n()),
+		shards: make([]string, l.n()),
+	}
+	errs := f.forEachUpstream(func(i int, u fs.Fs) error {
+		if o.meta[i] == nil {
+			d.meta[i] = "missing"
+		} else if o.ids[i] == "" {
+			d.meta[i] = "can't be read"
+		} else if o.ids[i] != o.id {
+			d.meta[i] = "is for an older version"
+		} else if full {
+			check := &Object{f: f}
+			if err := check.readMetadata(ctx, o.meta[i]); err != nil {
+				d.meta[i] = err.Error()
+			} else if *check.layout() != *l || check.id != o.id || check.md5 != o.md5 || check.sha1 != o.sha1 {
+				d.meta[i] = "doesn't match the other copies"
+			}
+		}
+		shard, err := u.NewObject(ctx, shardName(o.remote, i, o.id))
+		if errors.Is(err, fs.ErrorObjectNotFound) {
+			d.shards[i] = "missing"
+		} else if err != nil {
+			return err
+		} else if shard.Size() != l.shardSize() {
+			d.shards[i] = fmt.Sprintf("is %d bytes but should be %d", shard.Size(), l.shardSize())
+		}
+		return nil
+	})
+	err := errors.Join(errs...)
+	if err != nil {
+		return nil, err
+	}
+	if full && d.lost() <= l.m {
+		err = f.verifyObject(ctx, o, d)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// verifyObject reads all the shards of o which aren't known to be
+// bad to find corrupted shards and checks the data against the hashes
+// in the metadata
+func (f *Fs) verifyObject(ctx context.Context, o *Object, d *damage) (err error) {
+	l := o.layout()
+	dec, err := newDecoder(l, func(ctx context.Context, i int, offset int64) (io.ReadCloser, error) {
+		return o.openShard(ctx, i, offset, l.shardSize())
+	})
+	if err != nil {
+		return err
+	}
+	defer fs.CheckClose(dec, &err)
+	for i, reason := range d.shards {
+		if reason != "" {
+			dec.failed[i] = errors.New(reason)
+		}
+	}
+	hasher, err := hash.NewMultiHasherTypes(f.Hashes())
+	if err != nil {
+		return err
+	}
+	corrupt := make([]bool, l.n())
+	for s := int64(0); s < l.stripes(); s++ {
+		shares := dec.readShares(ctx, s, 0)
+		if len(shares) > l.k {
+			// Correct the shares and see which ones changed
+			corrected := make([]infectious.Share, len(shares))
+			for i := range shares {
+				corrected[i] = shares[i].DeepCopy()
+			}
+			err := dec.fec.Correct(corrected)
+			if errors.Is(err, infectious.NotEnoughShares) {
+				d.data = fmt.Sprintf("stripe %d is corrupted but too few shards are left to find which", s)
+				return nil
+			} else if err != nil {
+				d.data = fmt.Sprintf("stripe %d can't be corrected: %v", s, err)
+				return nil
+			}
+			for _, share := range corrected {
+				for _, orig := range shares {
+					if orig.Number == share.Number && !bytes.Equal(orig.Data, share.Data) {
+						corrupt[share.Number] = true
+					}
+				}
+			}
+			shares = corrected
+		}
+		data, err := dec.rebuild(s, shares)
+		if err != nil {
+			d.data = fmt.Sprintf("stripe %d can't be read: %v", s, err)
+			return nil
+		}
+		_, _ = hasher.Write(data)
+	}
+	for i, failErr := range dec.failed {
+		if errors.Is(failErr, errCorrupted) {
+			d.shards[i] = "corrupted"
+		} else if failErr != nil && d.shards[i] == "" {
+			d.shards[i] = failErr.Error()
+		} else if corrupt[i] {
+			d.shards[i] = "corrupted"
+		}
+	}
+	sums := hasher.Sums()
+	if (o.md5 != "" && sums[hash.MD5] != o.md5) || (o.sha1 != "" && sums[hash.SHA1] != o.sha1) {
+		d.data = "data doesn't match its checksum"
+	}
+	return nil
+}
+
+// rebuildObject rewrites the damaged shards and metadata of o from
+// the shards which are left
+func (f *Fs) rebuildObject(ctx context.Context, o *Object, d *damage) (err error) {
+	l := o.layout()
+	if d.lost() > l.m {
+		return ErrorTooManyShardsLost
+	}
+	if d.data != "" {
+		return errors.New(d.data)
+	}
+	if d.lost() > 0 {
+		dec, err := newDecoder(l, func(ctx context.Context, i int, offset int64) (io.ReadCloser, error) {
+			return o.openShard(ctx, i, offset, l.shardSize())
+		})
+		if err != nil {
+			return err
+		}
+		for i, reason := range d.shards {
+			if reason != "" {
+				dec.failed[i] = errors.New(reason)
+			}
+		}
+		in := newStripeReader(ctx, dec, 0, l.size)
+		defer fs.CheckClose(in, &err)
+		want := make([]bool, l.n())
+		for i := range want {
+			want[i] = d.shards[i] != ""
+		}
+		_, errs, err := f.putShards(ctx, o.remote, o.id, o.modTime, l, in, want)
+		if err != nil {
+			return err
+		}
+		if err = errors.Join(errs...); err != nil {
+			return err
+		}
+	}
+	want := make([]bool, l.n())
+	for i := range want {
+		want[i] = d.meta[i] != "" || d.shards[i] != ""
+	}
+	stale := append([]string(nil), o.ids...)
+	err = errors.Join(o.writeMetadata(ctx, want)...)
+	if err != nil {
+		return err
+	}
+	// Remove the shards of older versions the metadata pointed to
+	for i, id := range stale {
+		if want[i] && id != "" && id != o.id {
+			if err := f.removeShard(ctx, o.remote, i, id); err != nil {
+				fs.Errorf(o, "Failed to remove old shard %d: %v", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// scrub checks or rebuilds the objects in dirs
+func (f *Fs) scrub(ctx context.Context, dirs []string, full, rebuild bool) (out map[string]interface{}, err error) {
+	if len(dirs) == 0 {
+		dirs = []string{""}
+	}
+	var (
+		ok            int
+		rebuilt       int
+		errorCount    int
+		damaged       = map[string][]string{}
+		unrecoverable = map[string][]string{}
+	)
+	for _, dir := range dirs {
+		err = walk.ListR(ctx, f, dir, true, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+			var err error
+			entries.ForObject(func(obj fs.Object) {
+				if err != nil {
+					return
+				}
+				o, isObject := obj.(*Object)
+				if !isObject {
+					return
+				}
+				d, scrubErr := f.scrubObject(ctx, o, full)
+				if errors.Is(scrubErr, context.Canceled) {
+					err = scrubErr
+					return
+				}
+				switch {
+				case scrubErr != nil:
+					fs.Errorf(o, "Failed to scrub: %v", scrubErr)
+					errorCount++
+				case d.ok():
+					ok++
+				case d.lost() > o.m || d.data != "":
+					fs.Errorf(o, "Can't be rebuilt: %v", d.reasons(f))
+					unrecoverable[o.remote] = d.reasons(f)
+				case rebuild:
+					rebuildErr := f.rebuildObject(ctx, o, d)
+					if rebuildErr != nil {
+						fs.Errorf(o, "Failed to rebuild: %v", rebuildErr)
+						errorCount++
+					} else {
+						fs.Infof(o, "Rebuilt: %v", d.reasons(f))
+						rebuilt++
+					}
+				default:
+					fs.Logf(o, "Damaged: %v", d.reasons(f))
+					damaged[o.remote] = d.reasons(f)
+				}
+			})
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if rebuild {
+		return map[string]interface{}{
+			"ok":            ok,
+			"rebuilt":       rebuilt,
+			"unrecoverable": unrecoverable,
+			"errors":        errorCount,
+		}, nil
+	}
+	return map[string]interface{}{
+		"ok":            ok,
+		"damaged":       damaged,
+		"unrecoverable": unrecoverable,
+		"errors":        errorCount,
+	}, nil
+}
+
+// Command the backend to run a named command
+//
+// The command run is name
+// args may be used to read arguments from
+// opts may be used to read optional arguments from
+//
+// The result should be capable of being JSON encoded
+// If it is a string or a []string it will be shown to the user
+// otherwise it will be JSON encoded and shown to the user like that
+func (f *Fs) Command(ctx context.Context, name string, arg []string, opt map[string]string) (out interface{}, err error) {
+	_, full := opt["full"]
+	switch name {
+	case "scrub":
+		return f.scrub(ctx, arg, full, false)
+	case "rebuild":
+		return f.scrub(ctx, arg, full, true)
+	default:
+		return nil, fs.ErrorCommandNotFound
+	}
+}
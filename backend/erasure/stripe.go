@@ -0,0 +1,325 @@
+package erasure
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/rclone/rclone/fs"
+	"storj.io/infectious"
+)
+
+// Objects are split into stripes of k*block bytes of data. Each
+// stripe is split into k data blocks and m parity blocks are computed
+// from them. Block i of every stripe is appended to shard i, so shard
+// i is stored on upstream i.
+//
+// The last stripe is shortened so the padding on the end of the
+// object is less than k bytes. Its blocks are ceil(rem/k) bytes long
+// where rem is the data left for the last stripe.
+//
+// Each block is followed in the shard by its CRC-32C checksum so
+// corrupted blocks are found when they are read.
+
+// checksumSize is the size of the checksum after each block
+const checksumSize = crc32.Size
+
+// crcTable is the table for the checksums of blocks
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrorTooManyShardsLost is returned when fewer than k shards can be
+// read
+var ErrorTooManyShardsLost = errors.New("too many shards lost to reconstruct the data")
+
+// errCorrupted is returned when a block doesn't match its checksum
+var errCorrupted = errors.New("corrupted")
+
+// layout describes how an object is split into stripes
+type layout struct {
+	k     int   // number of data shards
+	m     int   // number of parity shards
+	block int64 // size of the blocks of a full stripe
+	size  int64 // size of the data
+}
+
+// n returns the total number of shards
+func (l *layout) n() int {
+	return l.k + l.m
+}
+
+// stripeData returns the size of the data in a full stripe
+func (l *layout) stripeData() int64 {
+	return int64(l.k) * l.block
+}
+
+// stripes returns the number of stripes
+func (l *layout) stripes() int64 {
+	return (l.size + l.stripeData() - 1) / l.stripeData()
+}
+
+// dataSize returns the size of the data in stripe s
+func (l *layout) dataSize(s int64) int64 {
+	rem := l.size - s*l.stripeData()
+	if rem > l.stripeData() {
+		return l.stripeData()
+	}
+	return rem
+}
+
+// blockSize returns the size of the blocks of stripe s
+func (l *layout) blockSize(s int64) int64 {
+	return (l.dataSize(s) + int64(l.k) - 1) / int64(l.k)
+}
+
+// blockOffset returns the offset of the block of stripe s in each
+// shard
+func (l *layout) blockOffset(s int64) int64 {
+	return s * (l.block + checksumSize)
+}
+
+// blockEnd returns the offset of the end of the block of stripe s,
+// including its checksum, in each shard
+func (l *layout) blockEnd(s int64) int64 {
+	return l.blockOffset(s) + l.blockSize(s) + checksumSize
+}
+
+// shardSize returns the size of each shard
+func (l *layout) shardSize() int64 {
+	nStripes := l.stripes()
+	if nStripes == 0 {
+		return 0
+	}
+	return l.blockEnd(nStripes - 1)
+}
+
+// newFEC makes the Reed-Solomon coder for the layout
+func (l *layout) newFEC() (*infectious.FEC, error) {
+	return infectious.NewFEC(l.k, l.n())
+}
+
+// encode reads the data from in and writes the shards to out.
+//
+// out should have a writer for each shard or nil if that shard isn't
+// wanted.
+func encode(l *layout, in io.Reader, out []io.Writer) error {
+	fec, err := l.newFEC()
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, l.stripeData())
+	for s := int64(0); s < l.stripes(); s++ {
+		dataSize, blockSize := l.dataSize(s), l.blockSize(s)
+		stripe := buf[:int64(l.k)*blockSize]
+		_, err = io.ReadFull(in, stripe[:dataSize])
+		if err != nil {
+			return fmt.Errorf("failed to read stripe %d: %w", s, err)
+		}
+		for i := dataSize; i < int64(len(stripe)); i++ {
+			stripe[i] = 0
+		}
+		err = fec.Encode(stripe, func(share infectious.Share) {
+			if err != nil || out[share.Number] == nil {
+				return
+			}
+			_, err = out[share.Number].Write(share.Data)
+			if err != nil {
+				return
+			}
+			var sum [checksumSize]byte
+			binary.BigEndian.PutUint32(sum[:], crc32.Checksum(share.Data, crcTable))
+			_, err = out[share.Number].Write(sum[:])
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openShardFn opens shard i for reading from offset to the end of
+// the range being read
+type openShardFn func(ctx context.Context, i int, offset int64) (io.ReadCloser, error)
+
+// decoder reads stripes from the shards, reconstructing the data
+// from the parity shards if any of the data shards can't be read
+type decoder struct {
+	l       *layout
+	fec     *infectious.FEC
+	open    openShardFn
+	readers []io.ReadCloser // open shards, nil if not open
+	failed  []error         // why shards failed, nil if they haven't
+	buf     []byte
+}
+
+// newDecoder makes a decoder which reads shards with open
+func newDecoder(l *layout, open openShardFn) (*decoder, error) {
+	fec, err := l.newFEC()
+	if err != nil {
+		return nil, err
+	}
+	return &decoder{
+		l:       l,
+		fec:     fec,
+		open:    open,
+		readers: make([]io.ReadCloser, l.n()),
+		failed:  make([]error, l.n()),
+		buf:     make([]byte, l.stripeData()),
+	}, nil
+}
+
+// fail marks shard i as failed
+func (d *decoder) fail(i int, err error) {
+	if d.readers[i] != nil {
+		_ = d.readers[i].Close()
+		d.readers[i] = nil
+	}
+	d.failed[i] = err
+}
+
+// readBlock reads the block of stripe s from shard i followed by its
+// checksum into block, checking the block against the checksum
+//
+// The shard is opened if necessary. Shards must be read stripe by
+// stripe once opened.
+func (d *decoder) readBlock(ctx context.Context, i int, s int64, block []byte) (err error) {
+	if d.readers[i] == nil {
+		d.readers[i], err = d.open(ctx, i, d.l.blockOffset(s))
+		if err != nil {
+			d.fail(i, err)
+			return err
+		}
+	}
+	_, err = io.ReadFull(d.readers[i], block)
+	if err != nil {
+		d.fail(i, err)
+		return err
+	}
+	n := len(block) - checksumSize
+	if crc32.Checksum(block[:n], crcTable) != binary.BigEndian.Uint32(block[n:]) {
+		err = fmt.Errorf("block of stripe %d is %w", s, errCorrupted)
+		d.fail(i, err)
+		return err
+	}
+	return nil
+}
+
+// readShares reads the blocks of stripe s from the shards.
+//
+// It reads from the first want shards which haven't failed, or from
+// all of them if want is 0. The shards which failed can be found in
+// d.failed afterwards.
+func (d *decoder) readShares(ctx context.Context, s int64, want int) (shares []infectious.Share) {
+	blockSize := d.l.blockSize(s)
+	for i := 0; i < d.l.n(); i++ {
+		if want > 0 && len(shares) >= want {
+			break
+		}
+		if d.failed[i] != nil {
+			continue
+		}
+		block := make([]byte, blockSize+checksumSize)
+		err := d.readBlock(ctx, i, s, block)
+		if err != nil {
+			fs.Debugf(nil, "erasure: shard %d failed: %v", i, err)
+			continue
+		}
+		shares = append(shares, infectious.Share{Number: i, Data: block[:blockSize]})
+	}
+	return shares
+}
+
+// rebuild reconstructs the data of stripe s from shares
+func (d *decoder) rebuild(s int64, shares []infectious.Share) ([]byte, error) {
+	blockSize := d.l.blockSize(s)
+	stripe := d.buf[:int64(d.l.k)*blockSize]
+	if len(shares) < d.l.k {
+		return nil, ErrorTooManyShardsLost
+	}
+	err := d.fec.Rebuild(shares, func(share infectious.Share) {
+		copy(stripe[int64(share.Number)*blockSize:], share.Data)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stripe[:d.l.dataSize(s)], nil
+}
+
+// readStripe reads the data of stripe s, reading as few shards as
+// possible.
+//
+// The returned slice is only valid until the next call.
+func (d *decoder) readStripe(ctx context.Context, s int64) ([]byte, error) {
+	return d.rebuild(s, d.readShares(ctx, s, d.l.k))
+}
+
+// Close the open shards
+func (d *decoder) Close() (err error) {
+	for i, rc := range d.readers {
+		if rc != nil {
+			if closeErr := rc.Close(); closeErr != nil && err == nil {
+				err = closeErr
+			}
+			d.readers[i] = nil
+		}
+	}
+	return err
+}
+
+// stripeReader is an io.ReadCloser reading the data between offset
+// and end from a decoder
+type stripeReader struct {
+	ctx context.Context
+	d   *decoder
+	s   int64  // next stripe to read
+	pos int64  // offset of the start of stripe s in the data
+	off int64  // offset to start reading from
+	end int64  // offset to stop reading at
+	buf []byte // data read but not returned yet
+}
+
+// newStripeReader reads the data between offset and end
+func newStripeReader(ctx context.Context, d *decoder, offset, end int64) *stripeReader {
+	s := offset / d.l.stripeData()
+	return &stripeReader{
+		ctx: ctx,
+		d:   d,
+		s:   s,
+		pos: s * d.l.stripeData(),
+		off: offset,
+		end: end,
+	}
+}
+
+// Read data into p
+func (r *stripeReader) Read(p []byte) (n int, err error) {
+	for len(r.buf) == 0 {
+		if r.pos >= r.end {
+			return 0, io.EOF
+		}
+		data, err := r.d.readStripe(r.ctx, r.s)
+		if err != nil {
+			return 0, err
+		}
+		start, stop := int64(0), int64(len(data))
+		if r.off > r.pos {
+			start = r.off - r.pos
+		}
+		if r.pos+stop > r.end {
+			stop = r.end - r.pos
+		}
+		r.buf = data[start:stop]
+		r.pos += int64(len(data))
+		r.s++
+	}
+	n = copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// Close the reader
+func (r *stripeReader) Close() error {
+	return r.d.Close()
+}
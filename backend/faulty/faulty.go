@@ -0,0 +1,655 @@
+// Package faulty provides a wrapping backend which injects faults
+// into the operations on another remote for resilience testing
+package faulty
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/configstruct"
+	"github.com/rclone/rclone/fs/fspath"
+	"github.com/rclone/rclone/fs/hash"
+)
+
+// Register with Fs
+func init() {
+	fs.Register(&fs.RegInfo{
+		Name:        "faulty",
+		Description: "Inject faults into another remote for testing",
+		NewFs:       NewFs,
+		MetadataInfo: &fs.MetadataInfo{
+			Help: `Any metadata supported by the underlying remote is read and written.`,
+		},
+		Options: []fs.Option{{
+			Name:     "remote",
+			Required: true,
+			Help: `Remote to inject faults into (e.g. myRemote:path).
+
+Normally should contain a ':' and a path, e.g. "myremote:path/to/dir",
+"myremote:bucket" or maybe "myremote:" (not recommended).`,
+		}, {
+			Name:    "operations",
+			Default: fs.CommaSepList{},
+			Help: `Comma separated list of operations to inject faults into.
+
+Leave blank for all operations. The operations are list, newobject,
+put, open, update, remove, mkdir, rmdir, purge, copy, move, dirmove,
+setmodtime, setmetadata and hash.`,
+		}, {
+			Name:    "paths",
+			Default: fs.CommaSepList{},
+			Help: `Comma separated list of glob patterns of the paths to inject faults into.
+
+Leave blank for all paths. The patterns are matched against the path
+relative to the root of the remote using the same rules as rclone
+filters, e.g. "*.jpg" or "/dir/**".`,
+		}, {
+			Name:    "seed",
+			Default: int64(0),
+			Help: `Seed for choosing which operations fail.
+
+With the same seed the same faults are injected into the same
+sequence of operations on each path, so test runs can be repeated.
+Use 0 to choose a different seed each time.`,
+		}, {
+			Name:    "error_rate",
+			Default: 0.0,
+			Help:    `Probability between 0 and 1 of an operation returning an error.`,
+		}, {
+			Name:    "error_type",
+			Default: "retry",
+			Help:    `Type of the errors returned by error_rate.`,
+			Examples: []fs.OptionExample{{
+				Value: "retry",
+				Help:  "Error which should be retried",
+			}, {
+				Value: "noretry",
+				Help:  "Error which shouldn't be retried",
+			}, {
+				Value: "fatal",
+				Help:  "Error which should stop the whole run",
+			}},
+		}, {
+			Name:    "rate_limit_rate",
+			Default: 0.0,
+			Help: `Probability between 0 and 1 of an operation being rate limited.
+
+Rate limited operations return an error asking for the operation to
+be retried after retry_after.`,
+		}, {
+			Name:     "retry_after",
+			Default:  fs.Duration(time.Second),
+			Advanced: true,
+			Help:     `Time rate limited operations ask to be retried after.`,
+		}, {
+			Name:    "latency",
+			Default: fs.Duration(0),
+			Help:    `Delay added to each operation.`,
+		}, {
+			Name:     "latency_jitter",
+			Default:  fs.Duration(0),
+			Advanced: true,
+			Help:     `Maximum random delay added to each operation on top of latency.`,
+		}, {
+			Name:    "truncate_rate",
+			Default: 0.0,
+			Help: `Probability between 0 and 1 of a read ending early.
+
+The data is cut off at a random point and the read returns EOF as
+if the object was shorter.`,
+		}, {
+			Name:    "corrupt_rate",
+			Default: 0.0,
+			Help: `Probability between 0 and 1 of a read returning a corrupted byte.
+
+One byte at a random point in the data is changed.`,
+		}, {
+			Name:    "list_delay",
+			Default: fs.Duration(0),
+			Help: `Time for changes to appear in listings.
+
+Simulates an eventually consistent remote. New objects don't appear
+in listings and removed objects still appear in listings until this
+long after they were written or removed.`,
+		}},
+	})
+}
+
+// Options defines the configuration for this backend
+type Options struct {
+	Remote        string          `config:"remote"`
+	Operations    fs.CommaSepList `config:"operations"`
+	Paths         fs.CommaSepList `config:"paths"`
+	Seed          int64           `config:"seed"`
+	ErrorRate     float64         `config:"error_rate"`
+	ErrorType     string          `config:"error_type"`
+	RateLimitRate float64         `config:"rate_limit_rate"`
+	RetryAfter    fs.Duration     `config:"retry_after"`
+	Latency       fs.Duration     `config:"latency"`
+	LatencyJitter fs.Duration     `config:"latency_jitter"`
+	TruncateRate  float64         `config:"truncate_rate"`
+	CorruptRate   float64         `config:"corrupt_rate"`
+	ListDelay     fs.Duration     `config:"list_delay"`
+}
+
+// Fs represents a remote with faults injected
+type Fs struct {
+	fs.Fs
+	name     string
+	root     string
+	opt      Options
+	features *fs.Features
+	wrapper  fs.Fs
+	inj      *injector
+}
+
+// NewFs constructs an Fs from the remote:path string
+func NewFs(ctx context.Context, name, root string, m configmap.Mapper) (fs.Fs, error) {
+	opt := new(Options)
+	err := configstruct.Set(m, opt)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(opt.Remote, name+":") {
+		return nil, errors.New("can't point faulty remote at itself - check the value of the remote setting")
+	}
+	inj, err := newInjector(opt)
+	if err != nil {
+		return nil, err
+	}
+	baseFs, err := cache.Get(ctx, fspath.JoinRootPath(opt.Remote, root))
+	if err != nil && err != fs.ErrorIsFile {
+		return nil, fmt.Errorf("failed to make remote %q to wrap: %w", opt.Remote, err)
+	}
+	f := &Fs{
+		Fs:   baseFs,
+		name: name,
+		root: root,
+		opt:  *opt,
+		inj:  inj,
+	}
+	// Correct root if definitely pointing to a file
+	if err == fs.ErrorIsFile {
+		f.root = path.Dir(f.root)
+		if f.root == "." || f.root == "/" {
+			f.root = ""
+		}
+	}
+	f.features = (&fs.Features{
+		CaseInsensitive:          true,
+		DuplicateFiles:           true,
+		ReadMimeType:             true,
+		WriteMimeType:            true,
+		CanHaveEmptyDirectories:  true,
+		BucketBased:              true,
+		BucketBasedRootOK:        true,
+		SetTier:                  true,
+		GetTier:                  true,
+		ReadMetadata:             true,
+		WriteMetadata:            true,
+		UserMetadata:             true,
+		ReadDirMetadata:          true,
+		WriteDirMetadata:         true,
+		WriteDirSetModTime:       true,
+		UserDirMetadata:          true,
+		DirModTimeUpdatesOnWrite: true,
+		PartialUploads:           true,
+	}).Fill(ctx, f).Mask(ctx, baseFs).WrapsFs(f, baseFs)
+	cache.PinUntilFinalized(f.Fs, f)
+	return f, err
+}
+
+// Name of the remote (as passed into NewFs)
+func (f *Fs) Name() string { return f.name }
+
+// Root of the remote (as passed into NewFs)
+func (f *Fs) Root() string { return f.root }
+
+// Features returns the optional features of this Fs
+func (f *Fs) Features() *fs.Features { return f.features }
+
+// Hashes returns the supported hash sets.
+func (f *Fs) Hashes() hash.Set { return f.Fs.Hashes() }
+
+// String returns a description of the FS
+func (f *Fs) String() string {
+	return fmt.Sprintf("faulty root '%s'", f.root)
+}
+
+// UnWrap returns the Fs that this Fs is wrapping
+func (f *Fs) UnWrap() fs.Fs { return f.Fs }
+
+// WrapFs returns the Fs that is wrapping this Fs
+func (f *Fs) WrapFs() fs.Fs { return f.wrapper }
+
+// SetWrapper sets the Fs that is wrapping this Fs
+func (f *Fs) SetWrapper(wrapper fs.Fs) { f.wrapper = wrapper }
+
+// List the objects and directories in dir into entries.
+func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err error) {
+	if err = f.inj.inject(ctx, opList, dir); err != nil {
+		return nil, err
+	}
+	entries, err = f.Fs.List(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	for i, entry := range entries {
+		if o, ok := entry.(fs.Object); ok {
+			entries[i] = f.wrapObject(o)
+		}
+	}
+	return f.inj.delayListing(dir, entries), nil
+}
+
+// NewObject finds the Object at remote.
+func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
+	if err := f.inj.inject(ctx, opNewObject, remote); err != nil {
+		return nil, err
+	}
+	o, err := f.Fs.NewObject(ctx, remote)
+	if err != nil {
+		return nil, err
+	}
+	return f.wrapObject(o), nil
+}
+
+// exists returns whether remote exists if listings are being delayed
+func (f *Fs) exists(ctx context.Context, remote string) bool {
+	if !f.inj.delaying(remote) {
+		return true
+	}
+	_, err := f.Fs.NewObject(ctx, remote)
+	return err == nil
+}
+
+// put uploads with the function given
+func (f *Fs) put(ctx context.Context, do func(context.Context, io.Reader, fs.ObjectInfo, ...fs.OpenOption) (fs.Object, error), in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	remote := src.Remote()
+	if err := f.inj.inject(ctx, opPut, remote); err != nil {
+		return nil, err
+	}
+	existed := f.exists(ctx, remote)
+	o, err := do(ctx, in, src, options...)
+	if err != nil {
+		return nil, err
+	}
+	if !existed {
+		f.inj.created(remote)
+	}
+	return f.wrapObject(o), nil
+}
+
+// Put in to the remote path with the modTime given of the given size
+func (f *Fs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	return f.put(ctx, f.Fs.Put, in, src, options...)
+}
+
+// PutStream uploads to the remote path with the modTime given of indeterminate size
+func (f *Fs) PutStream(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	do := f.Fs.Features().PutStream
+	if do == nil {
+		return nil, errors.New("PutStream not supported")
+	}
+	return f.put(ctx, do, in, src, options...)
+}
+
+// Mkdir makes the directory (container, bucket)
+func (f *Fs) Mkdir(ctx context.Context, dir string) error {
+	if err := f.inj.inject(ctx, opMkdir, dir); err != nil {
+		return err
+	}
+	return f.Fs.Mkdir(ctx, dir)
+}
+
+// MkdirMetadata makes the directory passed in as dir with the metadata given
+func (f *Fs) MkdirMetadata(ctx context.Context, dir string, metadata fs.Metadata) (fs.Directory, error) {
+	do := f.Fs.Features().MkdirMetadata
+	if do == nil {
+		return nil, fs.ErrorNotImplemented
+	}
+	if err := f.inj.inject(ctx, opMkdir, dir); err != nil {
+		return nil, err
+	}
+	return do(ctx, dir, metadata)
+}
+
+// Rmdir removes the directory (container, bucket) if empty
+func (f *Fs) Rmdir(ctx context.Context, dir string) error {
+	if err := f.inj.inject(ctx, opRmdir, dir); err != nil {
+		return err
+	}
+	return f.Fs.Rmdir(ctx, dir)
+}
+
+// Purge all files in the directory specified
+func (f *Fs) Purge(ctx context.Context, dir string) error {
+	do := f.Fs.Features().Purge
+	if do == nil {
+		return fs.ErrorCantPurge
+	}
+	if err := f.inj.inject(ctx, opPurge, dir); err != nil {
+		return err
+	}
+	return do(ctx, dir)
+}
+
+// Copy src to this remote using server-side copy operations.
+func (f *Fs) Copy(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	do := f.Fs.Features().Copy
+	if do == nil {
+		return nil, fs.ErrorCantCopy
+	}
+	srcObj, ok := src.(*Object)
+	if !ok {
+		return nil, fs.ErrorCantCopy
+	}
+	if err := f.inj.inject(ctx, opCopy, remote); err != nil {
+		return nil, err
+	}
+	existed := f.exists(ctx, remote)
+	o, err := do(ctx, srcObj.Object, remote)
+	if err != nil {
+		return nil, err
+	}
+	if !existed {
+		f.inj.created(remote)
+	}
+	return f.wrapObject(o), nil
+}
+
+// Move src to this remote using server-side move operations.
+func (f *Fs) Move(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	do := f.Fs.Features().Move
+	if do == nil {
+		return nil, fs.ErrorCantMove
+	}
+	srcObj, ok := src.(*Object)
+	if !ok {
+		return nil, fs.ErrorCantMove
+	}
+	if err := f.inj.inject(ctx, opMove, remote); err != nil {
+		return nil, err
+	}
+	existed := f.exists(ctx, remote)
+	o, err := do(ctx, srcObj.Object, remote)
+	if err != nil {
+		return nil, err
+	}
+	srcObj.f.inj.removed(srcObj)
+	if !existed {
+		f.inj.created(remote)
+	}
+	return f.wrapObject(o), nil
+}
+
+// DirMove moves src, srcRemote to this remote at dstRemote using server-side move operations.
+func (f *Fs) DirMove(ctx context.Context, src fs.Fs, srcRemote, dstRemote string) error {
+	do := f.Fs.Features().DirMove
+	if do == nil {
+		return fs.ErrorCantDirMove
+	}
+	srcFs, ok := src.(*Fs)
+	if !ok {
+		return fs.ErrorCantDirMove
+	}
+	if err := f.inj.inject(ctx, opDirMove, dstRemote); err != nil {
+		return err
+	}
+	return do(ctx, srcFs.Fs, srcRemote, dstRemote)
+}
+
+// DirSetModTime sets the directory modtime for dir
+func (f *Fs) DirSetModTime(ctx context.Context, dir string, modTime time.Time) error {
+	do := f.Fs.Features().DirSetModTime
+	if do == nil {
+		return fs.ErrorNotImplemented
+	}
+	if err := f.inj.inject(ctx, opSetModTime, dir); err != nil {
+		return err
+	}
+	return do(ctx, dir, modTime)
+}
+
+// CleanUp the trash in the Fs
+func (f *Fs) CleanUp(ctx context.Context) error {
+	if do := f.Fs.Features().CleanUp; do != nil {
+		return do(ctx)
+	}
+	return errors.New("not supported by underlying remote")
+}
+
+// About gets quota information from the Fs
+func (f *Fs) About(ctx context.Context) (*fs.Usage, error) {
+	if do := f.Fs.Features().About; do != nil {
+		return do(ctx)
+	}
+	return nil, errors.New("not supported by underlying remote")
+}
+
+// ChangeNotify calls the passed function with a path that has had changes.
+func (f *Fs) ChangeNotify(ctx context.Context, notifyFunc func(string, fs.EntryType), pollIntervalChan <-chan time.Duration) {
+	if do := f.Fs.Features().ChangeNotify; do != nil {
+		do(ctx, notifyFunc, pollIntervalChan)
+	}
+}
+
+// DirCacheFlush resets the directory cache - used in testing
+// as an optional interface
+func (f *Fs) DirCacheFlush() {
+	if do := f.Fs.Features().DirCacheFlush; do != nil {
+		do()
+	}
+}
+
+// PublicLink generates a public link to the remote path (usually readable by anyone)
+func (f *Fs) PublicLink(ctx context.Context, remote string, expire fs.Duration, unlink bool) (string, error) {
+	if do := f.Fs.Features().PublicLink; do != nil {
+		return do(ctx, remote, expire, unlink)
+	}
+	return "", errors.New("PublicLink not supported")
+}
+
+// UserInfo returns info about the connected user
+func (f *Fs) UserInfo(ctx context.Context) (map[string]string, error) {
+	if do := f.Fs.Features().UserInfo; do != nil {
+		return do(ctx)
+	}
+	return nil, fs.ErrorNotImplemented
+}
+
+// Disconnect the current user
+func (f *Fs) Disconnect(ctx context.Context) error {
+	if do := f.Fs.Features().Disconnect; do != nil {
+		return do(ctx)
+	}
+	return fs.ErrorNotImplemented
+}
+
+// MergeDirs merges the contents of all the directories passed
+// in into the first one and rmdirs the other directories.
+func (f *Fs) MergeDirs(ctx context.Context, dirs []fs.Directory) error {
+	if do := f.Fs.Features().MergeDirs; do != nil {
+		return do(ctx, dirs)
+	}
+	return errors.New("MergeDirs not supported")
+}
+
+// Shutdown the backend, closing any background tasks and any
+// cached connections.
+func (f *Fs) Shutdown(ctx context.Context) error {
+	if do := f.Fs.Features().Shutdown; do != nil {
+		return do(ctx)
+	}
+	return nil
+}
+
+// Object describes an object with faults injected
+type Object struct {
+	fs.Object
+	f *Fs
+}
+
+// wrapObject wraps an object from the wrapped remote
+func (f *Fs) wrapObject(o fs.Object) *Object {
+	return &Object{Object: o, f: f}
+}
+
+// Fs returns read only access to the Fs that this object is part of
+func (o *Object) Fs() fs.Info { return o.f }
+
+// UnWrap returns the wrapped Object
+func (o *Object) UnWrap() fs.Object { return o.Object }
+
+// Return a string version
+func (o *Object) String() string {
+	if o == nil {
+		return "<nil>"
+	}
+	return o.Object.String()
+}
+
+// Open an object for read
+func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (io.ReadCloser, error) {
+	if err := o.f.inj.inject(ctx, opOpen, o.Remote()); err != nil {
+		return nil, err
+	}
+	in, err := o.Object.Open(ctx, options...)
+	if err != nil {
+		return nil, err
+	}
+	return o.f.inj.wrapReader(o.Remote(), o.Size(), in), nil
+}
+
+// Update in to the object with the modTime given of the given size
+func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	if err := o.f.inj.inject(ctx, opUpdate, o.Remote()); err != nil {
+		return err
+	}
+	return o.Object.Update(ctx, in, src, options...)
+}
+
+// Remove an object
+func (o *Object) Remove(ctx context.Context) error {
+	if err := o.f.inj.inject(ctx, opRemove, o.Remote()); err != nil {
+		return err
+	}
+	err := o.Object.Remove(ctx)
+	if err != nil {
+		return err
+	}
+	o.f.inj.removed(o)
+	return nil
+}
+
+// SetModTime sets the modification time of the object
+func (o *Object) SetModTime(ctx context.Context, modTime time.Time) error {
+	if err := o.f.inj.inject(ctx, opSetModTime, o.Remote()); err != nil {
+		return err
+	}
+	return o.Object.SetModTime(ctx, modTime)
+}
+
+// Hash returns the selected checksum of the object
+func (o *Object) Hash(ctx context.Context, ht hash.Type) (string, error) {
+	if err := o.f.inj.inject(ctx, opHash, o.Remote()); err != nil {
+		return "", err
+	}
+	return o.Object.Hash(ctx, ht)
+}
+
+// ID returns the ID of the Object if possible
+func (o *Object) ID() string {
+	if do, ok := o.Object.(fs.IDer); ok {
+		return do.ID()
+	}
+	return ""
+}
+
+// MimeType of an Object if known, "" otherwise
+func (o *Object) MimeType(ctx context.Context) string {
+	if do, ok := o.Object.(fs.MimeTyper); ok {
+		return do.MimeType(ctx)
+	}
+	return ""
+}
+
+// GetTier returns the Tier of the Object if possible
+func (o *Object) GetTier() string {
+	if do, ok := o.Object.(fs.GetTierer); ok {
+		return do.GetTier()
+	}
+	return ""
+}
+
+// SetTier set the Tier of the Object if possible
+func (o *Object) SetTier(tier string) error {
+	if do, ok := o.Object.(fs.SetTierer); ok {
+		return do.SetTier(tier)
+	}
+	return errors.New("SetTier not supported")
+}
+
+// Metadata returns metadata for an object
+//
+// It should return nil if there is no Metadata
+func (o *Object) Metadata(ctx context.Context) (fs.Metadata, error) {
+	do, ok := o.Object.(fs.Metadataer)
+	if !ok {
+		return nil, nil
+	}
+	return do.Metadata(ctx)
+}
+
+// SetMetadata sets metadata for an Object
+//
+// It should return fs.ErrorNotImplemented if it can't set metadata
+func (o *Object) SetMetadata(ctx context.Context, metadata fs.Metadata) error {
+	do, ok := o.Object.(fs.SetMetadataer)
+	if !ok {
+		return fs.ErrorNotImplemented
+	}
+	if err := o.f.inj.inject(ctx, opSetMetadata, o.Remote()); err != nil {
+		return err
+	}
+	return do.SetMetadata(ctx, metadata)
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Fs              = (*Fs)(nil)
+	_ fs.Purger          = (*Fs)(nil)
+	_ fs.PutStreamer     = (*Fs)(nil)
+	_ fs.Copier          = (*Fs)(nil)
+	_ fs.Mover           = (*Fs)(nil)
+	_ fs.DirMover        = (*Fs)(nil)
+	_ fs.DirSetModTimer  = (*Fs)(nil)
+	_ fs.MkdirMetadataer = (*Fs)(nil)
+	_ fs.CleanUpper      = (*Fs)(nil)
+	_ fs.Abouter         = (*Fs)(nil)
+	_ fs.ChangeNotifier  = (*Fs)(nil)
+	_ fs.DirCacheFlusher = (*Fs)(nil)
+	_ fs.PublicLinker    = (*Fs)(nil)
+	_ fs.UserInfoer      = (*Fs)(nil)
+	_ fs.Disconnecter    = (*Fs)(nil)
+	_ fs.MergeDirser     = (*Fs)(nil)
+	_ fs.Shutdowner      = (*Fs)(nil)
+	_ fs.UnWrapper       = (*Fs)(nil)
+	_ fs.Wrapper         = (*Fs)(nil)
+	_ fs.Object          = (*Object)(nil)
+	_ fs.ObjectUnWrapper = (*Object)(nil)
+	_ fs.IDer            = (*Object)(nil)
+	_ fs.MimeTyper       = (*Object)(nil)
+	_ fs.GetTierer       = (*Object)(nil)
+	_ fs.SetTierer       = (*Object)(nil)
+	_ fs.Metadataer      = (*Object)(nil)
+	_ fs.SetMetadataer   = (*Object)(nil)
+)
@@ -0,0 +1,191 @@
+package faulty
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/fserrors"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var t1 = time.Date(2023, 4, 5, 6, 7, 8, 0, time.UTC)
+
+// newFs makes a faulty remote wrapping a temporary directory with
+// the files given and the config string opts
+func newFs(t *testing.T, opts string, files ...string) (fs.Fs, string) {
+	dir := t.TempDir()
+	for _, file := range files {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, filepath.Dir(file)), 0777))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, file), []byte(strings.Repeat("x", 100)), 0666))
+	}
+	f, err := fs.NewFs(context.Background(), fmt.Sprintf(`:faulty,remote="%s"%s:`, dir, opts))
+	require.NoError(t, err)
+	return f, dir
+}
+
+// listErrors returns which of n attempts to list dir give errors
+func listErrors(t *testing.T, f fs.Fs, dir string, n int) (out []bool) {
+	for i := 0; i < n; i++ {
+		_, err := f.List(context.Background(), dir)
+		out = append(out, err != nil)
+	}
+	return out
+}
+
+func TestBadOptions(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	for _, opts := range []string{
+		"operations=potato",
+		"error_rate=1.5",
+		"error_type=wobbly",
+		"paths='{{'",
+	} {
+		_, err := fs.NewFs(ctx, fmt.Sprintf(`:faulty,remote="%s",%s:`, dir, opts))
+		assert.Error(t, err, opts)
+	}
+}
+
+func TestErrorTypes(t *testing.T) {
+	ctx := context.Background()
+	for _, test := range []struct {
+		errorType string
+		check     func(error) bool
+	}{
+		{"retry", fserrors.IsRetryError},
+		{"noretry", fserrors.IsNoRetryError},
+		{"fatal", fserrors.IsFatalError},
+	} {
+		f, _ := newFs(t, ",error_rate=1,error_type="+test.errorType)
+		_, err := f.List(ctx, "")
+		require.Error(t, err)
+		assert.ErrorIs(t, err, errInjected)
+		assert.True(t, test.check(err), test.errorType)
+	}
+
+	f, _ := newFs(t, ",rate_limit_rate=1,retry_after=1m")
+	_, err := f.List(ctx, "")
+	require.Error(t, err)
+	assert.True(t, fserrors.IsRetryAfterError(err))
+	assert.WithinDuration(t, time.Now().Add(time.Minute), fserrors.RetryAfterErrorTime(err), 10*time.Second)
+}
+
+func TestDeterministic(t *testing.T) {
+	f1, _ := newFs(t, ",error_rate=0.5,seed=42")
+	f2, _ := newFs(t, ",error_rate=0.5,seed=42")
+	f3, _ := newFs(t, ",error_rate=0.5,seed=43")
+	errs := listErrors(t, f1, "", 64)
+	assert.Equal(t, errs, listErrors(t, f2, "", 64))
+	assert.NotEqual(t, errs, listErrors(t, f3, "", 64))
+	failed := 0
+	for _, e := range errs {
+		if e {
+			failed++
+		}
+	}
+	assert.True(t, failed > 16 && failed < 48, failed)
+}
+
+func TestOperationsAndPaths(t *testing.T) {
+	ctx := context.Background()
+	f, _ := newFs(t, ",error_rate=1,operations=open,paths='*.jpg'", "a.jpg", "a.txt", "dir/b.jpg")
+
+	// list and newobject aren't in operations
+	entries, err := f.List(ctx, "")
+	require.NoError(t, err)
+	assert.Len(t, entries, 3)
+	jpg, err := f.NewObject(ctx, "dir/b.jpg")
+	require.NoError(t, err)
+	txt, err := f.NewObject(ctx, "a.txt")
+	require.NoError(t, err)
+
+	_, err = jpg.Open(ctx)
+	assert.ErrorIs(t, err, errInjected)
+	in, err := txt.Open(ctx)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+}
+
+func TestTruncateAndCorrupt(t *testing.T) {
+	ctx := context.Background()
+	want := strings.Repeat("x", 100)
+	read := func(f fs.Fs) string {
+		o, err := f.NewObject(ctx, "file.txt")
+		require.NoError(t, err)
+		in, err := o.Open(ctx)
+		require.NoError(t, err)
+		data, err := io.ReadAll(in)
+		require.NoError(t, err)
+		require.NoError(t, in.Close())
+		return string(data)
+	}
+
+	f, _ := newFs(t, ",truncate_rate=1", "file.txt")
+	got := read(f)
+	assert.True(t, len(got) < len(want), len(got))
+	assert.True(t, strings.HasPrefix(want, got))
+
+	f, _ = newFs(t, ",corrupt_rate=1", "file.txt")
+	got = read(f)
+	assert.Equal(t, len(want), len(got))
+	assert.NotEqual(t, want, got)
+	differ := 0
+	for i := range got {
+		if got[i] != want[i] {
+			differ++
+		}
+	}
+	assert.Equal(t, 1, differ)
+}
+
+func TestListDelay(t *testing.T) {
+	ctx := context.Background()
+	f, _ := newFs(t, ",list_delay=200ms", "old.txt")
+	names := func() (out []string) {
+		entries, err := f.List(ctx, "")
+		require.NoError(t, err)
+		for _, entry := range entries {
+			out = append(out, entry.Remote())
+		}
+		return out
+	}
+
+	src := object.NewStaticObjectInfo("new.txt", t1, 5, true, nil, nil)
+	_, err := f.Put(ctx, strings.NewReader("hello"), src)
+	require.NoError(t, err)
+	old, err := f.NewObject(ctx, "old.txt")
+	require.NoError(t, err)
+	require.NoError(t, old.Remove(ctx))
+
+	// new objects can be read but aren't listed and removed ones are
+	_, err = f.NewObject(ctx, "new.txt")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"old.txt"}, names())
+
+	time.Sleep(300 * time.Millisecond)
+	assert.Equal(t, []string{"new.txt"}, names())
+}
+
+func TestLatency(t *testing.T) {
+	ctx := context.Background()
+	f, _ := newFs(t, ",latency=50ms")
+	start := time.Now()
+	_, err := f.List(ctx, "")
+	require.NoError(t, err)
+	assert.True(t, time.Since(start) >= 50*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = f.List(ctx, "")
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,39 @@
+// Test the faulty backend with no faults injected
+package faulty_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rclone/rclone/backend/faulty"
+	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/fstest/fstests"
+
+	_ "github.com/rclone/rclone/backend/all" // for integration tests
+)
+
+// TestIntegration runs integration tests against the remote
+func TestIntegration(t *testing.T) {
+	opt := fstests.Opt{
+		RemoteName: *fstest.RemoteName,
+		NilObject:  (*faulty.Object)(nil),
+		UnimplementableFsMethods: []string{
+			"OpenWriterAt",
+			"OpenChunkWriter",
+			"PutUnchecked",
+			"ListR",
+			"HardLink",
+		},
+	}
+	if *fstest.RemoteName == "" {
+		tempDir := filepath.Join(os.TempDir(), "rclone-faulty-test")
+		opt.ExtraConfig = []fstests.ExtraConfigItem{
+			{Name: "TestFaulty", Key: "type", Value: "faulty"},
+			{Name: "TestFaulty", Key: "remote", Value: tempDir},
+		}
+		opt.RemoteName = "TestFaulty:"
+		opt.QuickTestOK = true
+	}
+	fstests.Run(t, &opt)
+}
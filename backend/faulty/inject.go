@@ -0,0 +1,321 @@
+package faulty
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math/rand"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/filter"
+	"github.com/rclone/rclone/fs/fserrors"
+)
+
+// Operations faults can be injected into
+const (
+	opList        = "list"
+	opNewObject   = "newobject"
+	opPut         = "put"
+	opOpen        = "open"
+	opUpdate      = "update"
+	opRemove      = "remove"
+	opMkdir       = "mkdir"
+	opRmdir       = "rmdir"
+	opPurge       = "purge"
+	opCopy        = "copy"
+	opMove        = "move"
+	opDirMove     = "dirmove"
+	opSetModTime  = "setmodtime"
+	opSetMetadata = "setmetadata"
+	opHash        = "hash"
+)
+
+// operations is all the operations faults can be injected into
+var operations = []string{
+	opList, opNewObject, opPut, opOpen, opUpdate, opRemove, opMkdir, opRmdir,
+	opPurge, opCopy, opMove, opDirMove, opSetModTime, opSetMetadata, opHash,
+}
+
+// Kinds of fault, used to make the choices for each independent
+const (
+	faultLatency   = "latency"
+	faultRateLimit = "ratelimit"
+	faultError     = "error"
+	faultTruncate  = "truncate"
+	faultCorrupt   = "corrupt"
+)
+
+// errInjected is the error at the root of all injected errors
+var errInjected = errors.New("faulty: injected error")
+
+// pending is a change which hasn't appeared in listings yet
+type pending struct {
+	until time.Time // when the change appears
+	stale fs.Object // object to keep showing or nil to hide the object
+}
+
+// injector decides which faults to inject
+type injector struct {
+	opt   *Options
+	seed  uint64
+	ops   map[string]struct{} // operations to inject into or nil for all
+	paths []*regexp.Regexp    // paths to inject into or nil for all
+
+	mu      sync.Mutex
+	counts  map[string]uint64  // number of choices made for each key
+	pending map[string]pending // changes not in listings yet by path
+}
+
+// newInjector makes an injector from the options
+func newInjector(opt *Options) (*injector, error) {
+	inj := &injector{
+		opt:     opt,
+		seed:    uint64(opt.Seed),
+		counts:  map[string]uint64{},
+		pending: map[string]pending{},
+	}
+	if inj.seed == 0 {
+		inj.seed = rand.Uint64()
+	}
+	if len(opt.Operations) > 0 {
+		inj.ops = map[string]struct{}{}
+		for _, op := range opt.Operations {
+			op = strings.ToLower(strings.TrimSpace(op))
+			found := false
+			for _, known := range operations {
+				found = found || op == known
+			}
+			if !found {
+				return nil, fmt.Errorf("unknown operation %q in operations - must be one of %s", op, strings.Join(operations, ", "))
+			}
+			inj.ops[op] = struct{}{}
+		}
+	}
+	for _, glob := range opt.Paths {
+		re, err := filter.GlobToRegexp(glob, false)
+		if err != nil {
+			return nil, fmt.Errorf("bad glob %q in paths: %w", glob, err)
+		}
+		inj.paths = append(inj.paths, re)
+	}
+	for _, rate := range []float64{opt.ErrorRate, opt.RateLimitRate, opt.TruncateRate, opt.CorruptRate} {
+		if rate < 0 || rate > 1 {
+			return nil, fmt.Errorf("rate %g must be between 0 and 1", rate)
+		}
+	}
+	switch opt.ErrorType {
+	case "retry", "noretry", "fatal":
+	default:
+		return nil, fmt.Errorf("unknown error_type %q - must be retry, noretry or fatal", opt.ErrorType)
+	}
+	return inj, nil
+}
+
+// matches returns whether faults should be injected into op on remote
+func (inj *injector) matches(op, remote string) bool {
+	if inj.ops != nil {
+		if _, found := inj.ops[op]; !found {
+			return false
+		}
+	}
+	if inj.paths == nil {
+		return true
+	}
+	for _, re := range inj.paths {
+		if re.MatchString(remote) {
+			return true
+		}
+	}
+	return false
+}
+
+// chance returns a number in [0, 1) for the next choice of kind for
+// op on remote.
+//
+// The numbers depend only on the seed and how many choices have been
+// made for the same kind, op and remote before, so they are repeatable
+// however the operations on different paths are interleaved.
+func (inj *injector) chance(kind, op, remote string) float64 {
+	key := kind + "\x00" + op + "\x00" + remote
+	inj.mu.Lock()
+	n := inj.counts[key]
+	inj.counts[key] = n + 1
+	inj.mu.Unlock()
+	var buf [16]byte
+	binary.LittleEndian.PutUint64(buf[:8], inj.seed)
+	binary.LittleEndian.PutUint64(buf[8:], n)
+	h := fnv.New64a()
+	_, _ = h.Write(buf[:])
+	_, _ = h.Write([]byte(key))
+	return float64(h.Sum64()>>11) / (1 << 53)
+}
+
+// happens returns whether a fault of kind with probability rate
+// happens to op on remote
+func (inj *injector) happens(rate float64, kind, op, remote string) bool {
+	return rate > 0 && inj.chance(kind, op, remote) < rate
+}
+
+// inject adds latency to op on remote and returns an error if one
+// should be injected
+func (inj *injector) inject(ctx context.Context, op, remote string) error {
+	if !inj.matches(op, remote) {
+		return nil
+	}
+	delay := time.Duration(inj.opt.Latency)
+	if inj.opt.LatencyJitter > 0 {
+		delay += time.Duration(inj.chance(faultLatency, op, remote) * float64(inj.opt.LatencyJitter))
+	}
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if inj.happens(inj.opt.RateLimitRate, faultRateLimit, op, remote) {
+		fs.Debugf(remote, "faulty: injecting rate limit into %s", op)
+		return fserrors.RetryError(fmt.Errorf("faulty: injected rate limit on %s: %w", op, fserrors.NewErrorRetryAfter(time.Duration(inj.opt.RetryAfter))))
+	}
+	if inj.happens(inj.opt.ErrorRate, faultError, op, remote) {
+		fs.Debugf(remote, "faulty: injecting %s error into %s", inj.opt.ErrorType, op)
+		err := fmt.Errorf("%w on %s", errInjected, op)
+		switch inj.opt.ErrorType {
+		case "noretry":
+			return fserrors.NoRetryError(err)
+		case "fatal":
+			return fserrors.FatalError(err)
+		}
+		return fserrors.RetryError(err)
+	}
+	return nil
+}
+
+// wrapReader wraps in, the data of remote of size bytes, to truncate
+// or corrupt it if required
+func (inj *injector) wrapReader(remote string, size int64, in io.ReadCloser) io.ReadCloser {
+	if !inj.matches(opOpen, remote) || size <= 0 {
+		return in
+	}
+	fr := &faultyReader{ReadCloser: in, truncate: -1, corrupt: -1}
+	if inj.happens(inj.opt.TruncateRate, faultTruncate, opOpen, remote) {
+		fr.truncate = int64(inj.chance(faultTruncate, opOpen, remote) * float64(size))
+		fs.Debugf(remote, "faulty: truncating read at %d bytes", fr.truncate)
+	}
+	if inj.happens(inj.opt.CorruptRate, faultCorrupt, opOpen, remote) {
+		fr.corrupt = int64(inj.chance(faultCorrupt, opOpen, remote) * float64(size))
+		fs.Debugf(remote, "faulty: corrupting byte %d of read", fr.corrupt)
+	}
+	if fr.truncate < 0 && fr.corrupt < 0 {
+		return in
+	}
+	return fr
+}
+
+// faultyReader truncates or corrupts the data read through it
+type faultyReader struct {
+	io.ReadCloser
+	pos      int64 // offset of the next byte read
+	truncate int64 // offset to end the data at or -1
+	corrupt  int64 // offset of the byte to corrupt or -1
+}
+
+// Read bytes into p
+func (r *faultyReader) Read(p []byte) (n int, err error) {
+	if r.truncate >= 0 {
+		if r.pos >= r.truncate {
+			return 0, io.EOF
+		}
+		if remaining := r.truncate - r.pos; int64(len(p)) > remaining {
+			p = p[:remaining]
+		}
+	}
+	n, err = r.ReadCloser.Read(p)
+	if r.corrupt >= r.pos && r.corrupt < r.pos+int64(n) {
+		p[r.corrupt-r.pos] ^= 0xFF
+	}
+	r.pos += int64(n)
+	return n, err
+}
+
+// delaying returns whether changes to remote are delayed in listings
+func (inj *injector) delaying(remote string) bool {
+	return inj.opt.ListDelay > 0 && inj.matches(opList, remote)
+}
+
+// created hides the new object remote from listings for a while
+func (inj *injector) created(remote string) {
+	if !inj.delaying(remote) {
+		return
+	}
+	inj.mu.Lock()
+	inj.pending[remote] = pending{until: time.Now().Add(time.Duration(inj.opt.ListDelay))}
+	inj.mu.Unlock()
+}
+
+// removed keeps showing the removed object o in listings for a while
+func (inj *injector) removed(o *Object) {
+	remote := o.Remote()
+	if !inj.delaying(remote) {
+		return
+	}
+	inj.mu.Lock()
+	if p, found := inj.pending[remote]; found && p.stale == nil {
+		// never appeared in listings so doesn't need to disappear
+		delete(inj.pending, remote)
+	} else {
+		inj.pending[remote] = pending{until: time.Now().Add(time.Duration(inj.opt.ListDelay)), stale: o}
+	}
+	inj.mu.Unlock()
+}
+
+// delayListing returns the entries of dir as they would be listed if
+// changes took a while to appear
+func (inj *injector) delayListing(dir string, entries fs.DirEntries) fs.DirEntries {
+	if inj.opt.ListDelay <= 0 {
+		return entries
+	}
+	inj.mu.Lock()
+	defer inj.mu.Unlock()
+	if len(inj.pending) == 0 {
+		return entries
+	}
+	now := time.Now()
+	for remote, p := range inj.pending {
+		if now.After(p.until) {
+			delete(inj.pending, remote)
+		}
+	}
+	listed := make(map[string]struct{}, len(entries))
+	out := entries[:0]
+	for _, entry := range entries {
+		remote := entry.Remote()
+		if p, found := inj.pending[remote]; found && p.stale == nil {
+			if _, isObject := entry.(fs.Object); isObject {
+				continue
+			}
+		}
+		listed[remote] = struct{}{}
+		out = append(out, entry)
+	}
+	for remote, p := range inj.pending {
+		if p.stale == nil {
+			continue
+		}
+		if _, found := listed[remote]; found {
+			continue
+		}
+		if parent := path.Dir(remote); parent == dir || (parent == "." && dir == "") {
+			out = append(out, p.stale)
+		}
+	}
+	return out
+}
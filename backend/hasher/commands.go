@@ -36,6 +36,14 @@ func (f *Fs) Command(ctx context.Context, name string, arg []string, opt map[str
 			return nil, errors.New("please provide checksum type and path to sum file")
 		}
 		return nil, f.dbImport(ctx, arg[0], arg[1], sticky)
+	case "scrub":
+		sopt, err := f.parseScrubOptions(opt)
+		if err != nil {
+			return nil, err
+		}
+		return f.scrub(ctx, arg, sopt)
+	case "damaged":
+		return f.damaged(ctx)
 	default:
 		return nil, fs.ErrorCommandNotFound
 	}
@@ -70,6 +78,31 @@ Usage Example:
 Usage Example:
     rclone backend stickyimport hasher:subdir md5 remote:path/to/sum.md5
 `,
+}, {
+	Name:  "scrub",
+	Short: "Verify data against cached checksums",
+	Long: `Read files in the given directories (or the whole remote) and check
+their checksums against the cache and the hashes of the base remote.
+Damaged files are recorded in the cache and reported. Files with no
+cached checksums have them filled in.
+Usage Example:
+    rclone backend scrub hasher:subdir [dir...]
+    rclone backend scrub -o rate=1M -o age=30d hasher:
+`,
+	Opts: map[string]string{
+		"rate":   "Maximum bytes per second to read, overrides --hasher-scrub-rate",
+		"age":    "Skip files scrubbed more recently than this",
+		"native": "Compare cached checksums with the hashes of the base remote without reading the data if it has any",
+	},
+}, {
+	Name:  "damaged",
+	Short: "List damaged files",
+	Long: `List files which scrub found not matching their checksums, with the
+reason and when they were scrubbed. Records are cleared when the
+file is changed or scrubbed again successfully.
+Usage Example:
+    rclone backend damaged hasher:
+`,
 }}
 
 func (f *Fs) dbDump(ctx context.Context, full bool, root string) error {
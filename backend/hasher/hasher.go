@@ -50,16 +50,26 @@ func init() {
 			Advanced: true,
 			Default:  fs.SizeSuffix(0),
 			Help:     "Auto-update checksum for files smaller than this size (disabled by default).",
+		}, {
+			Name:     "scrub_rate",
+			Advanced: true,
+			Default:  fs.SizeSuffix(0),
+			Help: `Maximum rate to read data at when scrubbing (0 = no limit).
+
+This limits how fast the scrub command reads the base remote, in
+bytes per second, so it can run in the background. It can be
+overridden with the "rate" option of the command.`,
 		}},
 	})
 }
 
 // Options defines the configuration for this backend
 type Options struct {
-	Remote   string          `config:"remote"`
-	Hashes   fs.CommaSepList `config:"hashes"`
-	AutoSize fs.SizeSuffix   `config:"auto_size"`
-	MaxAge   fs.Duration     `config:"max_age"`
+	Remote    string          `config:"remote"`
+	Hashes    fs.CommaSepList `config:"hashes"`
+	AutoSize  fs.SizeSuffix   `config:"auto_size"`
+	MaxAge    fs.Duration     `config:"max_age"`
+	ScrubRate fs.SizeSuffix   `config:"scrub_rate"`
 }
 
 // Fs represents a wrapped fs.Fs
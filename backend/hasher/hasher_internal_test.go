@@ -5,9 +5,11 @@ import (
 	"fmt"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/config/obscure"
+	"github.com/rclone/rclone/fs/hash"
 	"github.com/rclone/rclone/fs/operations"
 	"github.com/rclone/rclone/fstest"
 	"github.com/rclone/rclone/fstest/fstests"
@@ -69,12 +71,72 @@ func (f *Fs) testUploadFromCrypt(t *testing.T) {
 	_ = operations.Purge(ctx, f, dirName)
 }
 
+func (f *Fs) testScrub(t *testing.T) {
+	if f.opt.MaxAge == 0 {
+		t.Skip("scrub needs the checksum cache")
+	}
+	if f.fpHash != hash.None || !f.fpTime {
+		t.Skip("can't damage the data without changing the fingerprint")
+	}
+	ctx := context.Background()
+	const dirName = "scrub_1"
+	const fileName = dirName + "/file"
+	defer func() {
+		_ = operations.Purge(ctx, f, dirName)
+	}()
+
+	// upload a file and cache its checksums
+	o := putFile(ctx, t, f, fileName, "good data")
+	sumBefore, err := o.Hash(ctx, f.keepHashes.GetOne())
+	require.NoError(t, err)
+	require.NotEmpty(t, sumBefore)
+
+	sopt := scrubOptions{rate: 1024}
+	out, err := f.scrub(ctx, []string{dirName}, sopt)
+	require.NoError(t, err)
+	assert.Equal(t, 1, out["ok"].(int)+out["new"].(int))
+	assert.Empty(t, out["damaged"])
+
+	// skip files scrubbed recently
+	sopt.age = fs.Duration(time.Hour)
+	out, err = f.scrub(ctx, []string{dirName}, sopt)
+	require.NoError(t, err)
+	assert.Equal(t, 1, out["skipped"])
+	sopt.age = 0
+
+	// damage the data behind the back of hasher keeping size and time
+	putFile(ctx, t, f.Fs, fileName, "evil data")
+	out, err = f.scrub(ctx, []string{dirName}, sopt)
+	require.NoError(t, err)
+	assert.Equal(t, 0, out["ok"])
+	damaged := out["damaged"].(map[string]string)
+	assert.Contains(t, damaged[fileName], sumBefore)
+
+	// the damage is recorded and the good checksum is kept
+	list, err := f.damaged(ctx)
+	require.NoError(t, err)
+	assert.Contains(t, list, fileName)
+	o, err = f.NewObject(ctx, fileName)
+	require.NoError(t, err)
+	_ = o.(*Object).updateHashes(ctx)
+	sumAfter, err := o.Hash(ctx, f.keepHashes.GetOne())
+	require.NoError(t, err)
+	assert.Equal(t, sumBefore, sumAfter)
+
+	// uploading the file again clears the damage
+	putFile(ctx, t, f, fileName, "new data!")
+	list, err = f.damaged(ctx)
+	require.NoError(t, err)
+	assert.NotContains(t, list, fileName)
+}
+
 // InternalTest dispatches all internal tests
 func (f *Fs) InternalTest(t *testing.T) {
 	if !kv.Supported() {
 		t.Skip("hasher is not supported on this OS")
 	}
 	t.Run("UploadFromCrypt", f.testUploadFromCrypt)
+	t.Run("Scrub", f.testScrub)
 }
 
 var _ fstests.InternalTester = (*Fs)(nil)
@@ -23,9 +23,11 @@ const (
 type hashMap map[hash.Type]string
 
 type hashRecord struct {
-	Fp      string // fingerprint
-	Hashes  operations.HashSums
-	Created time.Time
+	Fp       string // fingerprint
+	Hashes   operations.HashSums
+	Created  time.Time
+	Scrubbed time.Time // last verified by scrub
+	Bad      string    // why scrub found the data damaged or ""
 }
 
 func (r *hashRecord) encode(key string) ([]byte, error) {
@@ -190,12 +192,18 @@ func (op *kvPut) Do(ctx context.Context, b kv.Bucket) (err error) {
 		}
 	}
 	if len(r.Hashes) == 0 {
-		r.Created = time.Now()
-		r.Hashes = operations.HashSums{}
-		r.Fp = op.fp
+		r = hashRecord{
+			Fp:      op.fp,
+			Hashes:  operations.HashSums{},
+			Created: time.Now(),
+		}
 	}
 
 	for hashType, hashVal := range op.hashes {
+		// Keep the known good hashes of damaged data as evidence
+		if r.Bad != "" && r.Hashes[hashType] != "" {
+			continue
+		}
 		r.Hashes[hashType] = hashVal
 	}
 	if data, err = r.encode(op.key); err != nil {
@@ -207,6 +215,86 @@ func (op *kvPut) Do(ctx context.Context, b kv.Bucket) (err error) {
 	return err
 }
 
+// kvRecord: get the whole record for a key
+type kvRecord struct {
+	key   string
+	rec   hashRecord
+	found bool
+}
+
+func (op *kvRecord) Do(ctx context.Context, b kv.Bucket) error {
+	data := b.Get([]byte(op.key))
+	if len(data) == 0 {
+		return nil
+	}
+	if err := op.rec.decode(op.key, data); err != nil {
+		return nil
+	}
+	op.found = true
+	return nil
+}
+
+// kvScrubbed: record the result of scrubbing an object
+type kvScrubbed struct {
+	key    string
+	fp     string
+	bad    string
+	hashes operations.HashSums // added to the record if missing
+}
+
+func (op *kvScrubbed) Do(ctx context.Context, b kv.Bucket) (err error) {
+	data := b.Get([]byte(op.key))
+	var r hashRecord
+	if len(data) > 0 {
+		err = r.decode(op.key, data)
+	}
+	if len(data) == 0 || err != nil || !(r.Fp == anyFingerprint || r.Fp == op.fp) {
+		r = hashRecord{
+			Fp:      op.fp,
+			Created: time.Now(),
+		}
+	}
+	if r.Hashes == nil {
+		r.Hashes = operations.HashSums{}
+	}
+	for hashType, hashVal := range op.hashes {
+		if r.Hashes[hashType] == "" {
+			r.Hashes[hashType] = hashVal
+		}
+	}
+	r.Scrubbed = time.Now()
+	r.Bad = op.bad
+	if data, err = r.encode(op.key); err != nil {
+		return fmt.Errorf("marshal failed: %w", err)
+	}
+	if err = b.Put([]byte(op.key), data); err != nil {
+		return fmt.Errorf("put failed: %w", err)
+	}
+	return nil
+}
+
+// kvDamaged: find the records under root which scrub found damaged
+type kvDamaged struct {
+	root    string
+	damaged map[string]hashRecord
+}
+
+func (op *kvDamaged) Do(ctx context.Context, b kv.Bucket) error {
+	op.damaged = map[string]hashRecord{}
+	return b.ForEach(func(bkey, data []byte) error {
+		key := string(bkey)
+		if !(op.root == "" || key == op.root || strings.HasPrefix(key, op.root+"/")) {
+			return nil
+		}
+		var r hashRecord
+		if err := r.decode(key, data); err != nil || r.Bad == "" {
+			return nil
+		}
+		op.damaged[strings.TrimPrefix(key[len(op.root):], "/")] = r
+		return nil
+	})
+}
+
 // kvDump: dump the database.
 // Note: long dump can cause concurrent operations to fail.
 type kvDump struct {
@@ -281,6 +369,8 @@ func (f *Fs) dumpLine(r *hashRecord, path string, include bool, err error) strin
 		status = "ext"
 	case err != nil:
 		status = "bad"
+	case r.Bad != "":
+		status = "rot"
 	case r.Fp == anyFingerprint:
 		status = "stk"
 	default:
@@ -0,0 +1,277 @@
+package hasher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fs/walk"
+	"github.com/rclone/rclone/lib/kv"
+	"golang.org/x/time/rate"
+)
+
+// scrubOptions control a scrub run
+type scrubOptions struct {
+	rate   fs.SizeSuffix // bytes per second to read or 0 for no limit
+	age    fs.Duration   // skip objects scrubbed more recently than this
+	native bool          // compare with the remote's hashes without reading the data
+}
+
+// parseScrubOptions reads the options of the scrub command
+func (f *Fs) parseScrubOptions(opt map[string]string) (sopt scrubOptions, err error) {
+	sopt.rate = f.opt.ScrubRate
+	if val, found := opt["rate"]; found {
+		if err = sopt.rate.Set(val); err != nil {
+			return sopt, fmt.Errorf("bad rate: %w", err)
+		}
+	}
+	if val, found := opt["age"]; found {
+		if err = sopt.age.Set(val); err != nil {
+			return sopt, fmt.Errorf("bad age: %w", err)
+		}
+	}
+	_, sopt.native = opt["native"]
+	return sopt, nil
+}
+
+// rateReader limits the rate data is read from the underlying reader
+type rateReader struct {
+	ctx     context.Context
+	in      io.Reader
+	limiter *rate.Limiter
+}
+
+// newRateReader reads from in at no more than bps bytes per second
+func newRateReader(ctx context.Context, in io.Reader, bps fs.SizeSuffix) io.Reader {
+	if bps <= 0 {
+		return in
+	}
+	burst := int(bps)
+	if burst > 1024*1024 {
+		burst = 1024 * 1024
+	}
+	return &rateReader{
+		ctx:     ctx,
+		in:      in,
+		limiter: rate.NewLimiter(rate.Limit(bps), burst),
+	}
+}
+
+// Read at most burst bytes then wait for the limiter
+func (r *rateReader) Read(p []byte) (n int, err error) {
+	if len(p) > r.limiter.Burst() {
+		p = p[:r.limiter.Burst()]
+	}
+	n, err = r.in.Read(p)
+	if n > 0 {
+		if waitErr := r.limiter.WaitN(r.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+// Results of scrubbing a single object
+const (
+	scrubOK      = "ok"
+	scrubNew     = "new"
+	scrubSkipped = "skipped"
+	scrubBad     = "bad"
+)
+
+// scrubObject verifies the data of o against the cached checksums and
+// the hashes of the base remote and records the result in the database.
+//
+// It returns the result and why the object is bad if it is.
+func (f *Fs) scrubObject(ctx context.Context, o *Object, sopt scrubOptions) (result, reason string, err error) {
+	fp := o.fingerprint(ctx)
+	if fp == "" {
+		return "", "", errors.New("fingerprint failed")
+	}
+	key := path.Join(f.Fs.Root(), o.Remote())
+	op := &kvRecord{key: key}
+	if err = f.db.Do(false, op); err != nil {
+		return "", "", err
+	}
+	// Cached checksums are compared regardless of max_age as long
+	// as the object hasn't been changed since
+	var cached operations.HashSums
+	if op.found && (op.rec.Fp == anyFingerprint || op.rec.Fp == fp) {
+		if sopt.age > 0 && time.Since(op.rec.Scrubbed) < time.Duration(sopt.age) {
+			return scrubSkipped, op.rec.Bad, nil
+		}
+		cached = op.rec.Hashes
+	}
+
+	var (
+		sums      hashMap
+		mismatch  []string
+		compared  int
+		remoteSum = func(ht hash.Type) string {
+			if !f.passHashes.Contains(ht) && !f.slowHashes.Contains(ht) {
+				return ""
+			}
+			sum, _ := o.Object.Hash(ctx, ht)
+			return sum
+		}
+	)
+	check := func(ht hash.Type, got, want, from string) {
+		if got == "" || want == "" {
+			return
+		}
+		compared++
+		if !hash.Equals(got, want) {
+			mismatch = append(mismatch, fmt.Sprintf("%v is %s but %s is %s", ht, got, from, want))
+		}
+	}
+
+	if sopt.native {
+		// Compare the cached checksums with the remote's hashes
+		for _, ht := range f.passHashes.Array() {
+			check(ht, remoteSum(ht), cached[ht.String()], "cached")
+		}
+	}
+	if compared == 0 {
+		types := f.keepHashes
+		types.Add(f.passHashes.Array()...)
+		sums, err = f.readHashes(ctx, o, types, sopt.rate)
+		if err != nil {
+			return "", "", err
+		}
+		for ht, sum := range sums {
+			want, from := cached[ht.String()], "cached"
+			if want == "" {
+				want, from = remoteSum(ht), "remote"
+			}
+			check(ht, sum, want, from)
+		}
+	}
+	sort.Strings(mismatch)
+	reason = strings.Join(mismatch, ", ")
+
+	fill := operations.HashSums{}
+	for ht, sum := range sums {
+		if f.keepHashes.Contains(ht) {
+			fill[ht.String()] = sum
+		}
+	}
+	err = f.db.Do(true, &kvScrubbed{
+		key:    key,
+		fp:     fp,
+		bad:    reason,
+		hashes: fill,
+	})
+	switch {
+	case err != nil:
+		return "", "", err
+	case reason != "":
+		return scrubBad, reason, nil
+	case len(cached) == 0:
+		return scrubNew, "", nil
+	}
+	return scrubOK, "", nil
+}
+
+// readHashes reads the data of o from the base remote at no more
+// than bps bytes per second and returns its hashes
+func (f *Fs) readHashes(ctx context.Context, o *Object, types hash.Set, bps fs.SizeSuffix) (sums hashMap, err error) {
+	hasher, err := hash.NewMultiHasherTypes(types)
+	if err != nil {
+		return nil, err
+	}
+	in, err := o.Object.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer fs.CheckClose(in, &err)
+	if _, err = io.Copy(hasher, newRateReader(ctx, in, bps)); err != nil {
+		return nil, err
+	}
+	return hasher.Sums(), nil
+}
+
+// scrub verifies the objects in dirs
+func (f *Fs) scrub(ctx context.Context, dirs []string, sopt scrubOptions) (out map[string]interface{}, err error) {
+	if f.db == nil {
+		return nil, errors.New("scrub needs the checksum cache but it is disabled with max_age = 0")
+	}
+	if len(dirs) == 0 {
+		dirs = []string{""}
+	}
+	counts := map[string]int{scrubOK: 0, scrubNew: 0, scrubSkipped: 0}
+	errorCount := 0
+	bad := map[string]string{}
+	for _, dir := range dirs {
+		err = walk.ListR(ctx, f, dir, true, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+			var err error
+			entries.ForObject(func(obj fs.Object) {
+				o, isObject := obj.(*Object)
+				if err != nil || !isObject {
+					return
+				}
+				tr := accounting.Stats(ctx).NewCheckingTransfer(obj, "scrubbing")
+				result, reason, scrubErr := f.scrubObject(ctx, o, sopt)
+				tr.Done(ctx, scrubErr)
+				switch {
+				case errors.Is(scrubErr, context.Canceled):
+					err = scrubErr
+				case scrubErr != nil:
+					fs.Errorf(o, "Failed to scrub: %v", scrubErr)
+					errorCount++
+				case reason != "":
+					if result == scrubBad {
+						fs.Errorf(o, "Damaged: %s", reason)
+					}
+					bad[o.Remote()] = reason
+				default:
+					counts[result]++
+				}
+			})
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	fs.Infof(f, "Scrub summary: %d ok, %d new, %d skipped, %d damaged, %d errors",
+		counts[scrubOK], counts[scrubNew], counts[scrubSkipped], len(bad), errorCount)
+	return map[string]interface{}{
+		"ok":      counts[scrubOK],
+		"new":     counts[scrubNew],
+		"skipped": counts[scrubSkipped],
+		"damaged": bad,
+		"errors":  errorCount,
+	}, nil
+}
+
+// damaged returns the objects which scrub has found damaged
+func (f *Fs) damaged(ctx context.Context) (map[string]interface{}, error) {
+	if f.db == nil {
+		return nil, kv.ErrInactive
+	}
+	op := &kvDamaged{root: f.Fs.Root()}
+	err := f.db.Do(false, op)
+	if err == kv.ErrEmpty {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]interface{}, len(op.damaged))
+	for remote, r := range op.damaged {
+		out[remote] = map[string]interface{}{
+			"reason":   r.Bad,
+			"scrubbed": r.Scrubbed,
+		}
+	}
+	return out, nil
+}
@@ -5,6 +5,7 @@
 package http
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -15,6 +16,7 @@ import (
 	"path"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/rclone/rclone/fs"
@@ -93,6 +95,62 @@ sizes of any files, and some files that don't exist may be in the listing.`,
 			Name:    "no_escape",
 			Help:    "Do not escape URL metacharacters in path names.",
 			Default: false,
+		}, {
+			Name: "index_format",
+			Help: `Format of the directory index pages.
+
+By default rclone works out the format from the Content-Type of the
+index page, asking for JSON so servers like Caddy which can send it
+do. The structured formats give accurate sizes and
+modification times without needing a HEAD request for each file.
+
+S3 bucket listings can only be detected automatically from the
+root of the bucket, so set this to "s3" if the url points to an S3
+bucket.`,
+			Default: indexFormatAuto,
+			Examples: []fs.OptionExample{{
+				Value: indexFormatAuto,
+				Help:  "Choose the format from the Content-Type of the index page.",
+			}, {
+				Value: indexFormatHTML,
+				Help:  "HTML pages with links to the files and directories.",
+			}, {
+				Value: indexFormatJSON,
+				Help:  "JSON from nginx \"autoindex_format json\" or Caddy's file browser.",
+			}, {
+				Value: indexFormatXML,
+				Help:  "XML from nginx \"autoindex_format xml\".",
+			}, {
+				Value: indexFormatS3,
+				Help:  "S3 ListObjects XML from the bucket at the url.",
+			}},
+			Advanced: true,
+		}, {
+			Name: "write",
+			Help: `Allow uploads with PUT and deletes with DELETE.
+
+Normally http remotes are read only. Set this to upload files with
+HTTP PUT requests and delete them with HTTP DELETE requests which is
+supported by many artifact servers without needing full WebDAV.
+
+Directories are implicit so they are created when a file is uploaded
+into them and don't need to be created or removed.
+
+The server's modification times can't be set so rclone will compare
+files by size only.`,
+			Default:  false,
+			Advanced: true,
+		}, {
+			Name: "chunk_size",
+			Help: `Upload chunk size when write is set.
+
+Files larger than this are uploaded in chunks of this size, each in
+its own PUT request with a Content-Range header saying which part of
+the file it is. The server must support this to reassemble the file.
+
+Set to 0 to upload files in a single PUT request.`,
+			Default:  fs.SizeSuffix(0),
+			Advanced: true,
 		}},
 	}
 	fs.Register(fsi)
@@ -100,11 +158,14 @@ sizes of any files, and some files that don't exist may be in the listing.`,
 
 // Options defines the configuration for this backend
 type Options struct {
-	Endpoint string          `config:"url"`
-	NoSlash  bool            `config:"no_slash"`
-	NoHead   bool            `config:"no_head"`
-	Headers  fs.CommaSepList `config:"headers"`
-	NoEscape bool            `config:"no_escape"`
+	Endpoint    string          `config:"url"`
+	NoSlash     bool            `config:"no_slash"`
+	NoHead      bool            `config:"no_head"`
+	Headers     fs.CommaSepList `config:"headers"`
+	NoEscape    bool            `config:"no_escape"`
+	IndexFormat string          `config:"index_format"`
+	Write       bool            `config:"write"`
+	ChunkSize   fs.SizeSuffix   `config:"chunk_size"`
 }
 
 // Fs stores the interface to the remote HTTP files
@@ -116,7 +177,9 @@ type Fs struct {
 	ci          *fs.ConfigInfo // global config
 	endpoint    *url.URL
 	endpointURL string // endpoint as a string
+	prefix      string // path of the endpoint relative to the url configured
 	httpClient  *http.Client
+	isS3        atomic.Bool // set if the index has been detected as an S3 bucket listing
 }
 
 // Object is a remote object that has been stat'd (so it exists, but is not necessarily open for reading)
@@ -222,6 +285,12 @@ func (f *Fs) httpConnection(ctx context.Context, opt *Options) (isFile bool, err
 		return false, errors.New("odd number of headers supplied")
 	}
 
+	switch opt.IndexFormat {
+	case "", indexFormatAuto, indexFormatHTML, indexFormatJSON, indexFormatXML, indexFormatS3:
+	default:
+		return false, fmt.Errorf("unknown index_format %q", opt.IndexFormat)
+	}
+
 	if !strings.HasSuffix(opt.Endpoint, "/") {
 		opt.Endpoint += "/"
 	}
@@ -249,6 +318,7 @@ func (f *Fs) httpConnection(ctx context.Context, opt *Options) (isFile bool, err
 	f.httpClient = client
 	f.endpoint = u
 	f.endpointURL = u.String()
+	f.prefix = strings.TrimPrefix(u.Path, base.Path)
 	return isFile, nil
 }
 
@@ -270,7 +340,7 @@ func NewFs(ctx context.Context, name, root string, m configmap.Mapper) (fs.Fs, e
 		ci:   ci,
 	}
 	f.features = (&fs.Features{
-		CanHaveEmptyDirectories: true,
+		CanHaveEmptyDirectories: !opt.Write,
 	}).Fill(ctx, f)
 
 	// Make the http connection
@@ -312,7 +382,12 @@ func (f *Fs) Features() *fs.Features {
 }
 
 // Precision is the remote http file system's modtime precision, which we have no way of knowing. We estimate at 1s
+//
+// If writing is enabled then the modtimes are set by the server on upload so can't be used.
 func (f *Fs) Precision() time.Duration {
+	if f.opt.Write {
+		return fs.ModTimeNotSupported
+	}
 	return time.Second
 }
 
@@ -436,7 +511,11 @@ func (f *Fs) addHeaders(req *http.Request) {
 }
 
 // Read the directory passed in
-func (f *Fs) readDir(ctx context.Context, dir string) (names []string, err error) {
+func (f *Fs) readDir(ctx context.Context, dir string) (entries []listEntry, err error) {
+	format := f.opt.IndexFormat
+	if format == indexFormatS3 || f.isS3.Load() {
+		return f.readDirS3(ctx, dir)
+	}
 	URL := f.url(dir)
 	u, err := url.Parse(URL)
 	if err != nil {
@@ -450,6 +529,15 @@ func (f *Fs) readDir(ctx context.Context, dir string) (names []string, err error
 	if err != nil {
 		return nil, fmt.Errorf("readDir failed: %w", err)
 	}
+	switch format {
+	case "", indexFormatAuto:
+		// Ask for JSON from servers like Caddy which can send it
+		req.Header.Set("Accept", "application/json, text/html;q=0.9, */*;q=0.8")
+	case indexFormatJSON:
+		req.Header.Set("Accept", "application/json")
+	case indexFormatXML:
+		req.Header.Set("Accept", "application/xml")
+	}
 	f.addHeaders(req)
 	res, err := f.httpClient.Do(req)
 	if err == nil {
@@ -463,17 +551,45 @@ func (f *Fs) readDir(ctx context.Context, dir string) (names []string, err error
 		return nil, fmt.Errorf("failed to readDir: %w", err)
 	}
 
-	contentType := strings.SplitN(res.Header.Get("Content-Type"), ";", 2)[0]
-	switch contentType {
-	case "text/html":
-		names, err = parse(u, res.Body)
-		if err != nil {
-			return nil, fmt.Errorf("readDir: %w", err)
+	var in io.Reader = res.Body
+	if format == "" || format == indexFormatAuto {
+		contentType := strings.SplitN(res.Header.Get("Content-Type"), ";", 2)[0]
+		switch contentType {
+		case "text/html":
+			format = indexFormatHTML
+		case "application/json":
+			format = indexFormatJSON
+		case "application/xml", "text/xml":
+			data, err := io.ReadAll(res.Body)
+			if err != nil {
+				return nil, fmt.Errorf("failed to readDir: %w", err)
+			}
+			if xmlRoot(data) == "ListBucketResult" {
+				fs.Debugf(f, "Detected S3 bucket listing - using S3 requests for listings")
+				f.isS3.Store(true)
+				return f.readDirS3(ctx, dir)
+			}
+			in = bytes.NewReader(data)
+			format = indexFormatXML
+		default:
+			return nil, fmt.Errorf("can't parse content type %q", contentType)
 		}
-	default:
-		return nil, fmt.Errorf("can't parse content type %q", contentType)
 	}
-	return names, nil
+
+	switch format {
+	case indexFormatHTML:
+		var names []string
+		names, err = parse(u, in)
+		entries = namesToEntries(names)
+	case indexFormatJSON:
+		entries, err = parseJSON(in)
+	case indexFormatXML:
+		entries, err = parseXML(in)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("readDir: %w", err)
+	}
+	return entries, nil
 }
 
 // List the objects and directories in dir into entries.  The
@@ -489,7 +605,7 @@ func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err e
 	if !strings.HasSuffix(dir, "/") && dir != "" {
 		dir += "/"
 	}
-	names, err := f.readDir(ctx, dir)
+	listing, err := f.readDir(ctx, dir)
 	if err != nil {
 		return nil, fmt.Errorf("error listing %q: %w", dir, err)
 	}
@@ -525,13 +641,25 @@ func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err e
 			}
 		}()
 	}
-	for _, name := range names {
-		isDir := name[len(name)-1] == '/'
-		name = strings.TrimRight(name, "/")
-		remote := path.Join(dir, name)
-		if isDir {
-			add(fs.NewDir(remote, time.Time{}))
-		} else {
+	for _, entry := range listing {
+		remote := path.Join(dir, strings.TrimRight(entry.name, "/"))
+		switch {
+		case entry.isDir():
+			modTime := time.Time{}
+			if entry.hasInfo && !entry.modTime.Equal(timeUnset) {
+				modTime = entry.modTime
+			}
+			add(fs.NewDir(remote, modTime))
+		case entry.hasInfo:
+			// The index told us the size and modtime so no need for a HEAD
+			add(&Object{
+				fs:          f,
+				remote:      remote,
+				size:        entry.size,
+				modTime:     entry.modTime,
+				contentType: fs.MimeTypeFromName(remote),
+			})
+		default:
 			in <- remote
 		}
 	}
@@ -546,12 +674,19 @@ func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err e
 // will return the object and the error, otherwise will return
 // nil and the error
 func (f *Fs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
-	return nil, errorReadOnly
+	if !f.opt.Write {
+		return nil, errorReadOnly
+	}
+	o := &Object{
+		fs:     f,
+		remote: src.Remote(),
+	}
+	return o, o.Update(ctx, in, src, options...)
 }
 
 // PutStream uploads to the remote path with the modTime given of indeterminate size
 func (f *Fs) PutStream(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
-	return nil, errorReadOnly
+	return f.Put(ctx, in, src, options...)
 }
 
 // Fs is the filesystem this remote http file object is located within
@@ -644,6 +779,9 @@ func (o *Object) decodeMetadata(ctx context.Context, res *http.Response) error {
 //
 // it also updates the info field
 func (o *Object) SetModTime(ctx context.Context, modTime time.Time) error {
+	if o.fs.opt.Write {
+		return fs.ErrorCantSetModTime
+	}
 	return errorReadOnly
 }
 
@@ -684,23 +822,111 @@ func (f *Fs) Hashes() hash.Set {
 }
 
 // Mkdir makes the root directory of the Fs object
+//
+// Directories are implicit when writing so this does nothing.
 func (f *Fs) Mkdir(ctx context.Context, dir string) error {
-	return errorReadOnly
+	if !f.opt.Write {
+		return errorReadOnly
+	}
+	return nil
 }
 
 // Remove a remote http file object
 func (o *Object) Remove(ctx context.Context) error {
-	return errorReadOnly
+	if !o.fs.opt.Write {
+		return errorReadOnly
+	}
+	req, err := http.NewRequestWithContext(ctx, "DELETE", o.url(), nil)
+	if err != nil {
+		return fmt.Errorf("Remove failed: %w", err)
+	}
+	o.fs.addHeaders(req)
+	res, err := o.fs.httpClient.Do(req)
+	if err == nil && res.StatusCode == http.StatusNotFound {
+		_ = res.Body.Close()
+		return fs.ErrorObjectNotFound
+	}
+	err = statusError(res, err)
+	if err != nil {
+		return fmt.Errorf("Remove failed: %w", err)
+	}
+	return res.Body.Close()
 }
 
 // Rmdir removes the root directory of the Fs object
+//
+// Directories are implicit when writing so this does nothing.
 func (f *Fs) Rmdir(ctx context.Context, dir string) error {
-	return errorReadOnly
+	if !f.opt.Write {
+		return errorReadOnly
+	}
+	return nil
+}
+
+// put uploads size bytes of in to the object with a PUT request.
+//
+// size may be -1 for an unknown size and contentRange is sent as the
+// Content-Range header if set.
+func (o *Object) put(ctx context.Context, in io.Reader, size int64, contentRange, contentType string, options []fs.OpenOption) error {
+	req, err := http.NewRequestWithContext(ctx, "PUT", o.url(), in)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	if size == 0 {
+		req.Body = http.NoBody
+	}
+	if contentRange != "" {
+		req.Header.Set("Content-Range", contentRange)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for k, v := range fs.OpenOptionHeaders(options) {
+		req.Header.Add(k, v)
+	}
+	o.fs.addHeaders(req)
+	res, err := o.fs.httpClient.Do(req)
+	err = statusError(res, err)
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
 }
 
 // Update in to the object with the modTime given of the given size
-func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
-	return errorReadOnly
+func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (err error) {
+	if !o.fs.opt.Write {
+		return errorReadOnly
+	}
+	size := src.Size()
+	contentType := fs.MimeType(ctx, src)
+	chunkSize := int64(o.fs.opt.ChunkSize)
+	if chunkSize > 0 && size > chunkSize {
+		for offset := int64(0); offset < size; offset += chunkSize {
+			n := chunkSize
+			if offset+n > size {
+				n = size - offset
+			}
+			contentRange := fmt.Sprintf("bytes %d-%d/%d", offset, offset+n-1, size)
+			err = o.put(ctx, io.LimitReader(in, n), n, contentRange, contentType, options)
+			if err != nil {
+				return fmt.Errorf("Update failed to upload chunk %s: %w", contentRange, err)
+			}
+		}
+	} else {
+		err = o.put(ctx, in, size, "", contentType, options)
+		if err != nil {
+			return fmt.Errorf("Update failed: %w", err)
+		}
+	}
+	if o.fs.opt.NoHead {
+		o.size = size
+		o.modTime = src.ModTime(ctx)
+		o.contentType = contentType
+		return nil
+	}
+	return o.head(ctx)
 }
 
 // MimeType of an Object if known, "" otherwise
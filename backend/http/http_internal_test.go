@@ -19,6 +19,7 @@ import (
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/config/configfile"
 	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/object"
 	"github.com/rclone/rclone/fstest"
 	"github.com/rclone/rclone/lib/rest"
 	"github.com/stretchr/testify/assert"
@@ -508,3 +509,220 @@ func TestFsNoSlashRoots(t *testing.T) {
 		}
 	}
 }
+
+func TestWrite(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	fileServer := http.FileServer(http.Dir(dir))
+
+	// Handler which writes PUT requests into dir, reassembling
+	// them if they have a Content-Range and deletes with DELETE
+	var ranges []string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := filepath.Join(dir, filepath.FromSlash(r.URL.Path))
+		switch r.Method {
+		case "PUT":
+			flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+			var start int64
+			if contentRange := r.Header.Get("Content-Range"); contentRange != "" {
+				ranges = append(ranges, contentRange)
+				_, err := fmt.Sscanf(contentRange, "bytes %d-", &start)
+				require.NoError(t, err)
+				if start > 0 {
+					flags = os.O_WRONLY
+				}
+			}
+			require.NoError(t, os.MkdirAll(filepath.Dir(name), 0777))
+			out, err := os.OpenFile(name, flags, 0666)
+			require.NoError(t, err)
+			_, err = out.Seek(start, io.SeekStart)
+			require.NoError(t, err)
+			_, err = io.Copy(out, r.Body)
+			require.NoError(t, err)
+			require.NoError(t, out.Close())
+			w.WriteHeader(http.StatusCreated)
+		case "DELETE":
+			err := os.Remove(name)
+			if os.IsNotExist(err) {
+				http.Error(w, "Not found", http.StatusNotFound)
+				return
+			}
+			require.NoError(t, err)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			fileServer.ServeHTTP(w, r)
+		}
+	})
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	configfile.Install()
+	m := configmap.Simple{
+		"type": "http",
+		"url":  ts.URL,
+	}
+
+	// Read only by default
+	f, err := NewFs(ctx, remoteName, "", m)
+	require.NoError(t, err)
+	src := object.NewStaticObjectInfo("potato.txt", time.Now(), 5, true, nil, nil)
+	_, err = f.Put(ctx, strings.NewReader("hello"), src)
+	assert.Equal(t, errorReadOnly, err)
+	assert.Equal(t, errorReadOnly, f.Mkdir(ctx, "dir"))
+
+	m["write"] = "true"
+	m["chunk_size"] = "4B"
+	f, err = NewFs(ctx, remoteName, "", m)
+	require.NoError(t, err)
+	assert.False(t, f.Features().CanHaveEmptyDirectories)
+	assert.NoError(t, f.Mkdir(ctx, "dir"))
+
+	// Upload in one piece
+	src = object.NewStaticObjectInfo("dir/small.txt", time.Now(), 3, true, nil, nil)
+	o, err := f.Put(ctx, strings.NewReader("abc"), src)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), o.Size())
+	assert.Nil(t, ranges)
+
+	// Upload in chunks
+	src = object.NewStaticObjectInfo("dir/big.txt", time.Now(), 10, true, nil, nil)
+	o, err = f.Put(ctx, strings.NewReader("0123456789"), src)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), o.Size())
+	assert.Equal(t, []string{"bytes 0-3/10", "bytes 4-7/10", "bytes 8-9/10"}, ranges)
+	data, err := os.ReadFile(filepath.Join(dir, "dir", "big.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789", string(data))
+
+	// Check it can be read back
+	o, err = f.NewObject(ctx, "dir/big.txt")
+	require.NoError(t, err)
+	in, err := o.Open(ctx)
+	require.NoError(t, err)
+	data, err = io.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	assert.Equal(t, "0123456789", string(data))
+
+	// Delete it
+	require.NoError(t, o.Remove(ctx))
+	_, err = os.Stat(filepath.Join(dir, "dir", "big.txt"))
+	assert.True(t, os.IsNotExist(err))
+	assert.Equal(t, fs.ErrorObjectNotFound, o.Remove(ctx))
+	assert.NoError(t, f.Rmdir(ctx, "dir"))
+}
+
+func TestIndexFormats(t *testing.T) {
+	ctx := context.Background()
+	modTime := fstest.Time("2023-04-05T06:07:08Z")
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NotEqual(t, "HEAD", r.Method, "shouldn't HEAD %s", r.URL.Path)
+		switch r.URL.Path {
+		case "/nginx-json/":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = io.WriteString(w, `[
+{ "name":"dir", "type":"directory", "mtime":"Wed, 05 Apr 2023 06:07:08 GMT" },
+{ "name":"file.txt", "type":"file", "mtime":"Wed, 05 Apr 2023 06:07:08 GMT", "size":42 }
+]`)
+		case "/caddy/":
+			// Caddy only sends JSON if asked for it
+			if !strings.Contains(r.Header.Get("Accept"), "application/json") {
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				_, _ = io.WriteString(w, `<a href="./dir/">dir/</a><a href="./file.txt">file.txt</a>`)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = io.WriteString(w, `[
+{"name":"dir","size":4096,"url":"./dir/","mod_time":"2023-04-05T06:07:08Z","mode":2147484141,"is_dir":true,"is_symlink":false},
+{"name":"file.txt","size":42,"url":"./file.txt","mod_time":"2023-04-05T06:07:08Z","mode":420,"is_dir":false,"is_symlink":false}
+]`)
+		case "/nginx-xml/":
+			w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+			_, _ = io.WriteString(w, `<?xml version="1.0"?>
+<list>
+<directory mtime="2023-04-05T06:07:08Z">dir</directory>
+<file mtime="2023-04-05T06:07:08Z" size="42">file.txt</file>
+</list>`)
+		case "/bucket/":
+			// S3 ListObjects in two pages
+			w.Header().Set("Content-Type", "application/xml")
+			query := r.URL.Query()
+			if query.Get("prefix") == "" {
+				// Initial request to detect the format
+				_, _ = io.WriteString(w, `<ListBucketResult><IsTruncated>false</IsTruncated></ListBucketResult>`)
+				return
+			}
+			assert.Equal(t, "sub/", query.Get("prefix"))
+			assert.Equal(t, "/", query.Get("delimiter"))
+			if query.Get("marker") == "" {
+				_, _ = io.WriteString(w, `<ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+<IsTruncated>true</IsTruncated>
+<CommonPrefixes><Prefix>sub/dir/</Prefix></CommonPrefixes>
+</ListBucketResult>`)
+				return
+			}
+			assert.Equal(t, "sub/dir/", query.Get("marker"))
+			_, _ = io.WriteString(w, `<ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+<IsTruncated>false</IsTruncated>
+<Contents><Key>sub/</Key><LastModified>2023-04-05T06:07:08.000Z</LastModified><Size>0</Size></Contents>
+<Contents><Key>sub/file.txt</Key><LastModified>2023-04-05T06:07:08.000Z</LastModified><Size>42</Size></Contents>
+</ListBucketResult>`)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	configfile.Install()
+	for _, test := range []struct {
+		url    string
+		format string
+		dir    string
+	}{
+		{url: "/nginx-json/"},
+		{url: "/caddy/"},
+		{url: "/caddy/", format: "json"},
+		{url: "/nginx-xml/"},
+		{url: "/bucket/", dir: "sub"},
+		{url: "/bucket/", format: "s3", dir: "sub"},
+	} {
+		t.Run(test.url+test.format, func(t *testing.T) {
+			m := configmap.Simple{
+				"type":         "http",
+				"url":          ts.URL + test.url,
+				"index_format": test.format,
+			}
+			f, err := NewFs(ctx, remoteName, "", m)
+			require.NoError(t, err)
+			if test.dir != "" && test.format == "" {
+				// List the root to detect the format
+				_, err = f.List(ctx, "")
+				require.NoError(t, err)
+			}
+			entries, err := f.List(ctx, test.dir)
+			require.NoError(t, err)
+			sort.Sort(entries)
+			require.Equal(t, 2, len(entries))
+
+			d, ok := entries[0].(fs.Directory)
+			require.True(t, ok)
+			assert.Equal(t, path.Join(test.dir, "dir"), d.Remote())
+
+			o, ok := entries[1].(*Object)
+			require.True(t, ok)
+			assert.Equal(t, path.Join(test.dir, "file.txt"), o.Remote())
+			assert.Equal(t, int64(42), o.Size())
+			assert.True(t, modTime.Equal(o.ModTime(ctx)))
+			assert.Equal(t, "text/plain; charset=utf-8", o.MimeType(ctx))
+		})
+	}
+
+	// Check bad formats are rejected
+	_, err := NewFs(ctx, remoteName, "", configmap.Simple{
+		"type":         "http",
+		"url":          ts.URL + "/nginx-json/",
+		"index_format": "potato",
+	})
+	assert.ErrorContains(t, err, "unknown index_format")
+}
@@ -0,0 +1,245 @@
+// Parsers for structured directory index formats
+
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+)
+
+// Values for the index_format option
+const (
+	indexFormatAuto = "auto"
+	indexFormatHTML = "html"
+	indexFormatJSON = "json"
+	indexFormatXML  = "xml"
+	indexFormatS3   = "s3"
+)
+
+// listEntry is an entry in a directory listing
+type listEntry struct {
+	name    string    // leaf name with a trailing / if it is a directory
+	size    int64     // size of the file if hasInfo is set
+	modTime time.Time // modification time if hasInfo is set
+	hasInfo bool      // set if size and modTime are known
+}
+
+// isDir returns true if the entry is a directory
+func (e *listEntry) isDir() bool {
+	return strings.HasSuffix(e.name, "/")
+}
+
+// namesToEntries converts names from an HTML page into listEntry
+func namesToEntries(names []string) []listEntry {
+	entries := make([]listEntry, len(names))
+	for i, name := range names {
+		entries[i] = listEntry{name: name}
+	}
+	return entries
+}
+
+// parseIndexTime parses the time formats found in index pages,
+// returning timeUnset if it can't be parsed.
+func parseIndexTime(s string) time.Time {
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t
+	}
+	if t, err := http.ParseTime(s); err == nil {
+		return t
+	}
+	return timeUnset
+}
+
+// addEntry adds an entry to entries if name is a valid leaf name
+func addEntry(entries []listEntry, name string, isDir bool, size int64, modTime string) []listEntry {
+	name = strings.TrimSuffix(name, "/")
+	if name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+		return entries
+	}
+	if isDir {
+		name += "/"
+		size = -1
+	}
+	return append(entries, listEntry{
+		name:    name,
+		size:    size,
+		modTime: parseIndexTime(modTime),
+		hasInfo: true,
+	})
+}
+
+// jsonIndexEntry is an entry in a JSON index page.
+//
+// This decodes both nginx "autoindex_format json" and Caddy browse
+// output which have different field names.
+type jsonIndexEntry struct {
+	Name    string `json:"name"`
+	Size    int64  `json:"size"`
+	Type    string `json:"type"`     // nginx - "directory", "file" or "other"
+	MTime   string `json:"mtime"`    // nginx - RFC1123
+	IsDir   bool   `json:"is_dir"`   // Caddy
+	ModTime string `json:"mod_time"` // Caddy - RFC3339
+}
+
+// parseJSON parses a JSON directory index
+func parseJSON(in io.Reader) (entries []listEntry, err error) {
+	var items []jsonIndexEntry
+	err = json.NewDecoder(in).Decode(&items)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse JSON index: %w", err)
+	}
+	for _, item := range items {
+		modTime := item.MTime
+		if modTime == "" {
+			modTime = item.ModTime
+		}
+		entries = addEntry(entries, item.Name, item.IsDir || item.Type == "directory", item.Size, modTime)
+	}
+	return entries, nil
+}
+
+// xmlIndex is an nginx "autoindex_format xml" index
+type xmlIndex struct {
+	XMLName xml.Name `xml:"list"`
+	Items   []struct {
+		XMLName xml.Name
+		MTime   string `xml:"mtime,attr"`
+		Size    int64  `xml:"size,attr"`
+		Name    string `xml:",chardata"`
+	} `xml:",any"`
+}
+
+// parseXML parses an nginx XML directory index
+func parseXML(in io.Reader) (entries []listEntry, err error) {
+	var index xmlIndex
+	err = xml.NewDecoder(in).Decode(&index)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse XML index: %w", err)
+	}
+	for _, item := range index.Items {
+		entries = addEntry(entries, item.Name, item.XMLName.Local == "directory", item.Size, item.MTime)
+	}
+	return entries, nil
+}
+
+// s3ListResult is the result of an S3 ListObjects call
+type s3ListResult struct {
+	XMLName     xml.Name `xml:"ListBucketResult"`
+	IsTruncated bool
+	NextMarker  string
+	Contents    []struct {
+		Key          string
+		LastModified string
+		Size         int64
+	}
+	CommonPrefixes []struct {
+		Prefix string
+	}
+}
+
+// parseS3 parses an S3 ListObjects result for the directory prefix
+//
+// It returns the marker to read the next page with or "" if there
+// isn't one.
+func parseS3(in io.Reader, prefix string) (entries []listEntry, marker string, err error) {
+	var result s3ListResult
+	err = xml.NewDecoder(in).Decode(&result)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to parse S3 listing: %w", err)
+	}
+	for _, item := range result.Contents {
+		if name, ok := strings.CutPrefix(item.Key, prefix); ok {
+			entries = addEntry(entries, name, false, item.Size, item.LastModified)
+		}
+		marker = item.Key
+	}
+	for _, item := range result.CommonPrefixes {
+		if name, ok := strings.CutPrefix(item.Prefix, prefix); ok {
+			entries = addEntry(entries, name, true, -1, "")
+		}
+		if item.Prefix > marker {
+			marker = item.Prefix
+		}
+	}
+	if !result.IsTruncated {
+		return entries, "", nil
+	}
+	if result.NextMarker != "" {
+		marker = result.NextMarker
+	}
+	if marker == "" {
+		return nil, "", errors.New("S3 listing truncated without a marker")
+	}
+	return entries, marker, nil
+}
+
+// xmlRoot returns the name of the root element of the XML document
+func xmlRoot(data []byte) string {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return ""
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name.Local
+		}
+	}
+}
+
+// readDirS3 reads the directory dir by listing the bucket at the url
+// configured with S3 ListObjects requests
+func (f *Fs) readDirS3(ctx context.Context, dir string) (entries []listEntry, err error) {
+	base, err := url.Parse(f.opt.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to readDir: %w", err)
+	}
+	prefix := f.prefix + dir
+	marker := ""
+	for {
+		query := url.Values{}
+		query.Set("delimiter", "/")
+		query.Set("prefix", prefix)
+		if marker != "" {
+			query.Set("marker", marker)
+		}
+		u := *base
+		u.RawQuery = query.Encode()
+		req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+		if err != nil {
+			return nil, fmt.Errorf("readDir failed: %w", err)
+		}
+		f.addHeaders(req)
+		res, err := f.httpClient.Do(req)
+		err = statusError(res, err)
+		if err != nil {
+			return nil, fmt.Errorf("failed to readDir: %w", err)
+		}
+		var page []listEntry
+		page, marker, err = parseS3(res.Body, prefix)
+		_ = res.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("readDir: %w", err)
+		}
+		entries = append(entries, page...)
+		if marker == "" {
+			break
+		}
+	}
+	// S3 has no directories so an empty listing means not found
+	if len(entries) == 0 && dir != "" {
+		return nil, fs.ErrorDirNotFound
+	}
+	return entries, nil
+}
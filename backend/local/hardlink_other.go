@@ -0,0 +1,14 @@
+// Hard link reading functions
+
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+
+package local
+
+import "os"
+
+// readHardLinkID turns a valid os.FileInfo into an ID shared by all
+// the hard links to the same inode, returning "" if the file isn't a
+// regular file with more than one link.
+func readHardLinkID(fi os.FileInfo) string {
+	return ""
+}
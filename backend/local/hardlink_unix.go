@@ -0,0 +1,25 @@
+// Hard link reading functions
+
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+
+package local
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// readHardLinkID turns a valid os.FileInfo into an ID shared by all
+// the hard links to the same inode, returning "" if the file isn't a
+// regular file with more than one link.
+func readHardLinkID(fi os.FileInfo) string {
+	if !fi.Mode().IsRegular() {
+		return ""
+	}
+	statT, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok || statT.Nlink <= 1 {
+		return ""
+	}
+	return fmt.Sprintf("%x:%x", uint64(statT.Dev), uint64(statT.Ino)) // nolint: unconvert
+}
@@ -27,6 +27,7 @@ import (
 	"github.com/rclone/rclone/fs/hash"
 	"github.com/rclone/rclone/lib/encoder"
 	"github.com/rclone/rclone/lib/file"
+	"github.com/rclone/rclone/lib/random"
 	"github.com/rclone/rclone/lib/readers"
 	"golang.org/x/text/unicode/norm"
 )
@@ -215,12 +216,18 @@ Use this flag to disable preallocation.`,
 			Advanced: true,
 		}, {
 			Name: "no_sparse",
-			Help: `Disable sparse files for multi-thread downloads.
+			Help: `Disable sparse files.
 
 On Windows platforms rclone will make sparse files when doing
 multi-thread downloads. This avoids long pauses on large files where
 the OS zeros the file. However sparse files may be undesirable as they
-cause disk fragmentation and can be slow to work with.`,
+cause disk fragmentation and can be slow to work with.
+
+Rclone will also preserve the holes in sparse source files when
+copying them to the local disk where the source can report them (eg
+the local backend on Linux, macOS and FreeBSD).
+
+Setting this flag disables both of these.`,
 			Default:  false,
 			Advanced: true,
 		}, {
@@ -326,6 +333,7 @@ type Object struct {
 	mode    os.FileMode
 	modTime time.Time
 	hashes  map[hash.Type]string // Hashes
+	linkID  string               // ID shared by hard links to the same file or ""
 	// these are read only and don't need the mutex held
 	translatedLink bool // Is this object a translated link
 }
@@ -380,6 +388,7 @@ func NewFs(ctx context.Context, name, root string, m configmap.Mapper) (fs.Fs, e
 		UserMetadata:             xattrSupported, // can only R/W general purpose metadata if xattrs are supported
 		FilterAware:              true,
 		PartialUploads:           true,
+		SparseFiles:              !opt.NoSparse,
 	}).Fill(ctx, f)
 	if opt.FollowSymlinks {
 		f.lstat = os.Stat
@@ -926,6 +935,71 @@ func (f *Fs) Move(ctx context.Context, src fs.Object, remote string) (fs.Object,
 	return dstObj, nil
 }
 
+// HardLink makes a hard link to src at remote.
+//
+// Any existing object at remote is replaced.
+//
+// If it isn't possible then return fs.ErrorCantHardLink
+func (f *Fs) HardLink(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	srcObj, ok := src.(*Object)
+	if !ok {
+		fs.Debugf(src, "Can't hard link - not same remote type")
+		return nil, fs.ErrorCantHardLink
+	}
+	if srcObj.translatedLink {
+		fs.Debugf(src, "Can't hard link - source is a translated symlink")
+		return nil, fs.ErrorCantHardLink
+	}
+
+	// Temporary Object under construction
+	dstObj := f.newObject(remote)
+
+	// Check it is a file if it exists
+	err := dstObj.lstat()
+	dstObj.fs.objectMetaMu.RLock()
+	dstObjMode := dstObj.mode
+	dstObj.fs.objectMetaMu.RUnlock()
+	if os.IsNotExist(err) {
+		// OK
+	} else if err != nil {
+		return nil, err
+	} else if !dstObj.fs.isRegular(dstObjMode) {
+		// It isn't a file
+		return nil, errors.New("can't hard link onto non-file")
+	}
+
+	// Create destination
+	err = dstObj.mkdirAll()
+	if err != nil {
+		return nil, err
+	}
+
+	// Link to a temporary name then rename it over any existing file
+	tmpPath := dstObj.path + ".rclone-link-" + random.String(8)
+	err = os.Link(srcObj.path, tmpPath)
+	if os.IsNotExist(err) || os.IsPermission(err) {
+		return nil, err
+	} else if err != nil {
+		// probably trying to link across file system boundaries
+		// or the file system doesn't support hard links
+		fs.Debugf(src, "Can't hard link: %v", err)
+		return nil, fs.ErrorCantHardLink
+	}
+	err = os.Rename(tmpPath, dstObj.path)
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return nil, err
+	}
+
+	// Update the info
+	err = dstObj.lstat()
+	if err != nil {
+		return nil, err
+	}
+
+	return dstObj, nil
+}
+
 // DirMove moves src, srcRemote to this remote at dstRemote
 // using server-side move operations.
 //
@@ -1042,6 +1116,55 @@ func (o *Object) Remote() string {
 	return o.remote
 }
 
+// HardLinkID returns an ID which is shared by all the Objects which
+// are hard links to the same file, or "" if it isn't hard linked.
+func (o *Object) HardLinkID() string {
+	o.fs.objectMetaMu.RLock()
+	defer o.fs.objectMetaMu.RUnlock()
+	return o.linkID
+}
+
+// Holes returns the regions of the file which are holes in ascending
+// order or nil if the file isn't sparse.
+func (o *Object) Holes(ctx context.Context) ([]fs.Extent, error) {
+	if o.translatedLink {
+		return nil, nil
+	}
+	return readHoles(o.path, o.Size())
+}
+
+// WriteAt overwrites part of the file in place keeping its size and
+// modification time
+func (o *Object) WriteAt(ctx context.Context, p []byte, off int64) (err error) {
+	if o.translatedLink {
+		return errors.New("can't write in place to a translated link")
+	}
+	o.fs.objectMetaMu.RLock()
+	size, modTime := o.size, o.modTime
+	o.fs.objectMetaMu.RUnlock()
+	if off < 0 || off+int64(len(p)) > size {
+		return fmt.Errorf("can't write %d bytes at offset %d beyond the end of the file", len(p), off)
+	}
+	o.clearHashCache()
+	out, err := file.OpenFile(o.path, os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+	_, err = out.WriteAt(p, off)
+	closeErr := out.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	err = o.setTimes(modTime, modTime)
+	if err != nil {
+		return err
+	}
+	return o.lstat()
+}
+
 // Hash returns the requested hash of a file as a lowercase hex string
 func (o *Object) Hash(ctx context.Context, r hash.Type) (string, error) {
 	// Check that the underlying file hasn't changed
@@ -1299,6 +1422,21 @@ func (o *Object) mkdirAll() error {
 	return file.MkdirAll(dir, 0777)
 }
 
+// sparseWriteCloser closes the SparseWriter then the file
+type sparseWriteCloser struct {
+	*file.SparseWriter
+	f *os.File
+}
+
+func (s sparseWriteCloser) Close() error {
+	err := s.SparseWriter.Close()
+	closeErr := s.f.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return err
+}
+
 type nopWriterCloser struct {
 	*bytes.Buffer
 }
@@ -1312,6 +1450,7 @@ func (nwc nopWriterCloser) Close() error {
 func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (err error) {
 	var out io.WriteCloser
 	var hasher *hash.MultiHasher
+	var holes []fs.Extent
 
 	for _, option := range options {
 		switch x := option.(type) {
@@ -1322,6 +1461,10 @@ func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, op
 					return err
 				}
 			}
+		case *fs.SparseOption:
+			if !o.fs.opt.NoSparse {
+				holes = x.Holes
+			}
 		}
 	}
 
@@ -1352,18 +1495,31 @@ func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, op
 				return err
 			}
 		}
-		if !o.fs.opt.NoPreAllocate {
-			// Pre-allocate the file for performance reasons
-			err = file.PreAllocate(src.Size(), f)
+		if len(holes) > 0 {
+			// Leave holes in the file where the source has them
+			// which means not pre-allocating it
+			err = file.SetSparse(f)
 			if err != nil {
-				fs.Debugf(o, "Failed to pre-allocate: %v", err)
-				if err == file.ErrDiskFull {
-					_ = f.Close()
-					return err
+				fs.Debugf(o, "Failed to set sparse: %v", err)
+			}
+			out = sparseWriteCloser{
+				SparseWriter: file.NewSparseWriter(f, holes),
+				f:            f,
+			}
+		} else {
+			if !o.fs.opt.NoPreAllocate {
+				// Pre-allocate the file for performance reasons
+				err = file.PreAllocate(src.Size(), f)
+				if err != nil {
+					fs.Debugf(o, "Failed to pre-allocate: %v", err)
+					if err == file.ErrDiskFull {
+						_ = f.Close()
+						return err
+					}
 				}
 			}
+			out = f
 		}
-		out = f
 	} else {
 		out = nopWriterCloser{&symlinkData}
 	}
@@ -1488,6 +1644,7 @@ func (o *Object) setMetadata(info os.FileInfo) {
 	o.size = info.Size()
 	o.modTime = readTime(o.fs.opt.TimeType, info)
 	o.mode = info.Mode()
+	o.linkID = readHardLinkID(info)
 	o.fs.objectMetaMu.Unlock()
 	// Read the size of the link.
 	//
@@ -1639,7 +1796,11 @@ var (
 	_ fs.OpenWriterAter  = &Fs{}
 	_ fs.DirSetModTimer  = &Fs{}
 	_ fs.MkdirMetadataer = &Fs{}
+	_ fs.HardLinker      = &Fs{}
 	_ fs.Object          = &Object{}
+	_ fs.HardLinkIDer    = &Object{}
+	_ fs.Holer           = &Object{}
+	_ fs.InPlaceWriter   = &Object{}
 	_ fs.Metadataer      = &Object{}
 	_ fs.SetMetadataer   = &Object{}
 	_ fs.Directory       = &Directory{}
@@ -196,6 +196,88 @@ func TestSymlink(t *testing.T) {
 	require.NoError(t, in.Close())
 }
 
+func TestHardLink(t *testing.T) {
+	ctx := context.Background()
+	r := fstest.NewRun(t)
+	f := r.Flocal.(*Fs)
+
+	modTime := fstest.Time("2001-02-03T04:05:10.123123123Z")
+	file1 := r.WriteFile("file.txt", "hello", modTime)
+	file2 := r.WriteFile("dir/other.txt", "potato", modTime)
+	file3 := fstest.NewItem("dir/other.txt", "hello", modTime)
+
+	o1, err := f.NewObject(ctx, file1.Path)
+	require.NoError(t, err)
+	assert.Equal(t, "", o1.(*Object).HardLinkID())
+
+	// Link over the top of an existing file
+	o3, err := f.HardLink(ctx, o1, file2.Path)
+	if err == fs.ErrorCantHardLink {
+		t.Skip("Hard links not supported")
+	}
+	require.NoError(t, err)
+	assert.Equal(t, file2.Path, o3.Remote())
+	r.CheckLocalItems(t, file1, file3)
+
+	fi1, err := os.Stat(filepath.Join(f.root, file1.Path))
+	require.NoError(t, err)
+	fi3, err := os.Stat(filepath.Join(f.root, file3.Path))
+	require.NoError(t, err)
+	assert.True(t, os.SameFile(fi1, fi3))
+
+	if runtime.GOOS != "windows" && runtime.GOOS != "plan9" && runtime.GOOS != "js" {
+		o1, err = f.NewObject(ctx, file1.Path)
+		require.NoError(t, err)
+		id := o1.(*Object).HardLinkID()
+		assert.NotEqual(t, "", id)
+		assert.Equal(t, id, o3.(*Object).HardLinkID())
+	}
+}
+
+func TestSparseCopy(t *testing.T) {
+	ctx := context.Background()
+	r := fstest.NewRun(t)
+	fLocal := r.Flocal.(*Fs)
+	fRemote, ok := r.Fremote.(*Fs)
+	if !ok {
+		t.Skip("Remote is not local")
+	}
+
+	// Make a file with data at the start and in the middle
+	const MiB = 1024 * 1024
+	data := bytes.Repeat([]byte("sparse"), 10000)
+	require.NoError(t, os.MkdirAll(fLocal.root, 0777))
+	f, err := os.Create(filepath.Join(fLocal.root, "sparse"))
+	require.NoError(t, err)
+	_, err = f.Write(data)
+	require.NoError(t, err)
+	_, err = f.WriteAt(data, 2*MiB)
+	require.NoError(t, err)
+	require.NoError(t, f.Truncate(4*MiB))
+	require.NoError(t, f.Close())
+
+	src, err := fLocal.NewObject(ctx, "sparse")
+	require.NoError(t, err)
+	holes, err := src.(*Object).Holes(ctx)
+	require.NoError(t, err)
+	if len(holes) == 0 {
+		t.Skip("Sparse files not supported")
+	}
+
+	dst, err := operations.Copy(ctx, fRemote, nil, "sparse", src)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4*MiB), dst.Size())
+	dstHoles, err := dst.(*Object).Holes(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, holes, dstHoles)
+
+	want, err := os.ReadFile(filepath.Join(fLocal.root, "sparse"))
+	require.NoError(t, err)
+	got, err := os.ReadFile(filepath.Join(fRemote.root, "sparse"))
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(want, got))
+}
+
 func TestSymlinkError(t *testing.T) {
 	m := configmap.Simple{
 		"links":      "true",
@@ -0,0 +1,14 @@
+// Sparse file reading functions
+
+//go:build !darwin && !freebsd && !linux
+
+package local
+
+import "github.com/rclone/rclone/fs"
+
+// readHoles reads the holes in the file at path of the given size
+// using SEEK_HOLE and SEEK_DATA, returning nil if there aren't any or
+// the file system doesn't support finding them.
+func readHoles(path string, size int64) (holes []fs.Extent, err error) {
+	return nil, nil
+}
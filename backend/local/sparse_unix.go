@@ -0,0 +1,50 @@
+// Sparse file reading functions
+
+//go:build darwin || freebsd || linux
+
+package local
+
+import (
+	"errors"
+	"os"
+
+	"github.com/rclone/rclone/fs"
+	"golang.org/x/sys/unix"
+)
+
+// readHoles reads the holes in the file at path of the given size
+// using SEEK_HOLE and SEEK_DATA, returning nil if there aren't any or
+// the file system doesn't support finding them.
+func readHoles(path string, size int64) (holes []fs.Extent, err error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fs.CheckClose(in, &err)
+	fd := int(in.Fd())
+	var pos int64
+	for pos < size {
+		hole, err := unix.Seek(fd, pos, unix.SEEK_HOLE)
+		if errors.Is(err, unix.ENXIO) {
+			break
+		} else if errors.Is(err, unix.EINVAL) {
+			// SEEK_HOLE not supported by this file system
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if hole >= size {
+			break
+		}
+		data, err := unix.Seek(fd, hole, unix.SEEK_DATA)
+		if errors.Is(err, unix.ENXIO) || data > size {
+			// hole extends to the end of the file
+			data = size
+		} else if err != nil {
+			return nil, err
+		}
+		holes = append(holes, fs.Extent{Offset: hole, Length: data - hole})
+		pos = data
+	}
+	return holes, nil
+}
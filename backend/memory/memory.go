@@ -4,8 +4,7 @@ package memory
 import (
 	"bytes"
 	"context"
-	"crypto/md5"
-	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"path"
@@ -22,23 +21,66 @@ import (
 )
 
 var (
-	hashType = hash.MD5
 	// the object storage is persistent
 	buckets = newBucketsInfo()
 )
 
+// system metadata stored by the backend
+var systemMetadataInfo = map[string]fs.MetadataHelp{
+	"mtime": {
+		Help:    "Time of last modification",
+		Type:    "RFC 3339",
+		Example: "2006-01-02T15:04:05.999999999Z07:00",
+	},
+	"content-type": {
+		Help:    "MIME type of the object",
+		Type:    "string",
+		Example: "text/plain",
+	},
+}
+
 // Register with Fs
 func init() {
 	fs.Register(&fs.RegInfo{
 		Name:        "memory",
 		Description: "In memory object storage system.",
 		NewFs:       NewFs,
-		Options:     []fs.Option{},
+		CommandHelp: commandHelp,
+		MetadataInfo: &fs.MetadataInfo{
+			System: systemMetadataInfo,
+			Help: `User metadata is stored as is, with any keys and values. It is
+kept as long as the object is, and saved in snapshots.`,
+		},
+		Options: []fs.Option{{
+			Name:     "hashes",
+			Default:  fs.CommaSepList{"md5"},
+			Advanced: true,
+			Help: `Comma separated list of supported checksum types.
+
+The checksums are calculated when first asked for and kept with the
+object. Use this to make the memory backend stand in for a cloud
+backend with different checksums, e.g. "sha1" or "md5,sha256". Use
+"none" for no checksums.`,
+		}, {
+			Name:     "snapshot",
+			Advanced: true,
+			Help: `File to load objects from and save them to.
+
+If set the objects and buckets in the file are loaded into memory
+when the remote is first used and all objects and buckets in memory
+are saved to it when rclone exits, so they survive restarts. They can
+also be saved and loaded with the "save" and "load" backend commands.
+
+Note that objects in memory are shared by all memory remotes.`,
+		}},
 	})
 }
 
 // Options defines the configuration for this backend
-type Options struct{}
+type Options struct {
+	Hashes   fs.CommaSepList `config:"hashes"`
+	Snapshot string          `config:"snapshot"`
+}
 
 // Fs represents a remote memory server
 type Fs struct {
@@ -48,6 +90,7 @@ type Fs struct {
 	rootBucket    string       // bucket part of root (if any)
 	rootDirectory string       // directory part of root (if any)
 	features      *fs.Features // optional features
+	hashes        hash.Set     // supported checksum types
 }
 
 // bucketsInfo holds info about all the buckets
@@ -158,12 +201,170 @@ func (bi *bucketInfo) isEmpty() (empty bool) {
 	return empty
 }
 
+// moveObjectData moves an object from (srcBucket, srcPath) to
+// (dstBucket, dstPath) returning the object data or nil if not found
+func (bi *bucketsInfo) moveObjectData(srcBucket, srcPath, dstBucket, dstPath string) (od *objectData) {
+	bi.mu.Lock()
+	defer bi.mu.Unlock()
+	src := bi.buckets[srcBucket]
+	if src == nil {
+		return nil
+	}
+	dst := bi.makeBucketLocked(dstBucket)
+	unlock := lockBuckets(src, dst)
+	defer unlock()
+	od = src.objects[srcPath]
+	if od == nil {
+		return nil
+	}
+	delete(src.objects, srcPath)
+	dst.objects[dstPath] = od
+	return od
+}
+
+// moveDir moves all the objects in the directory (srcBucket,
+// srcPath) to (dstBucket, dstPath)
+//
+// If srcPath is "" the source bucket is removed afterwards.
+func (bi *bucketsInfo) moveDir(srcBucket, srcPath, dstBucket, dstPath string) error {
+	bi.mu.Lock()
+	defer bi.mu.Unlock()
+	src := bi.buckets[srcBucket]
+	if src == nil {
+		return fs.ErrorDirNotFound
+	}
+	if srcBucket == dstBucket && srcPath == dstPath {
+		return fs.ErrorDirExists
+	}
+	dst := bi.makeBucketLocked(dstBucket)
+	unlock := lockBuckets(src, dst)
+	defer unlock()
+	srcPrefix, dstPrefix := dirPrefix(srcPath), dirPrefix(dstPath)
+	for absPath := range dst.objects {
+		if strings.HasPrefix(absPath, dstPrefix) {
+			return fs.ErrorDirExists
+		}
+	}
+	found := false
+	for absPath, od := range src.objects {
+		if strings.HasPrefix(absPath, srcPrefix) {
+			delete(src.objects, absPath)
+			dst.objects[dstPrefix+absPath[len(srcPrefix):]] = od
+			found = true
+		}
+	}
+	if srcPath == "" {
+		delete(bi.buckets, srcBucket)
+	} else if !found {
+		return fs.ErrorDirNotFound
+	}
+	return nil
+}
+
+// makeBucketLocked returns the bucket or makes it - call with the lock held
+func (bi *bucketsInfo) makeBucketLocked(name string) (b *bucketInfo) {
+	b = bi.buckets[name]
+	if b == nil {
+		b = newBucketInfo()
+		bi.buckets[name] = b
+	}
+	return b
+}
+
+// lockBuckets locks src and dst, which may be the same, returning a
+// function to unlock them
+func lockBuckets(src, dst *bucketInfo) (unlock func()) {
+	src.mu.Lock()
+	if dst == src {
+		return src.mu.Unlock
+	}
+	dst.mu.Lock()
+	return func() {
+		dst.mu.Unlock()
+		src.mu.Unlock()
+	}
+}
+
+// dirPrefix returns the prefix of the objects in dir
+func dirPrefix(dir string) string {
+	if dir == "" {
+		return ""
+	}
+	return dir + "/"
+}
+
 // the object data and metadata
 type objectData struct {
-	modTime  time.Time
-	hash     string
-	mimeType string
-	data     []byte
+	data []byte
+
+	mu       sync.Mutex           // protects the fields below
+	modTime  time.Time            // modification time
+	mimeType string               // MIME type
+	hashes   map[hash.Type]string // checksums calculated so far
+	metadata fs.Metadata          // user metadata
+}
+
+// clone returns a copy of the object data
+func (od *objectData) clone() *objectData {
+	od.mu.Lock()
+	defer od.mu.Unlock()
+	newOd := &objectData{
+		modTime:  od.modTime,
+		mimeType: od.mimeType,
+		data:     od.data,
+		hashes:   make(map[hash.Type]string, len(od.hashes)),
+	}
+	for k, v := range od.hashes {
+		newOd.hashes[k] = v
+	}
+	if od.metadata != nil {
+		newOd.metadata = make(fs.Metadata, len(od.metadata))
+		newOd.metadata.Merge(od.metadata)
+	}
+	return newOd
+}
+
+// hash returns the checksum of type t, calculating it if necessary
+func (od *objectData) hash(t hash.Type) (string, error) {
+	od.mu.Lock()
+	defer od.mu.Unlock()
+	if sum, ok := od.hashes[t]; ok {
+		return sum, nil
+	}
+	sums, err := hash.StreamTypes(bytes.NewReader(od.data), hash.NewHashSet(t))
+	if err != nil {
+		return "", err
+	}
+	if od.hashes == nil {
+		od.hashes = make(map[hash.Type]string, 1)
+	}
+	od.hashes[t] = sums[t]
+	return sums[t], nil
+}
+
+// setMetadata merges metadata into the object data, setting the
+// modification time and MIME type from it if present
+func (od *objectData) setMetadata(metadata fs.Metadata) error {
+	od.mu.Lock()
+	defer od.mu.Unlock()
+	for k, v := range metadata {
+		switch k {
+		case "mtime":
+			modTime, err := time.Parse(time.RFC3339Nano, v)
+			if err != nil {
+				return fmt.Errorf("failed to parse metadata %s: %q: %w", k, v, err)
+			}
+			od.modTime = modTime
+		case "content-type":
+			od.mimeType = v
+		default:
+			if od.metadata == nil {
+				od.metadata = make(fs.Metadata, len(metadata))
+			}
+			od.metadata[k] = v
+		}
+	}
+	return nil
 }
 
 // Object describes a memory object
@@ -233,11 +434,26 @@ func NewFs(ctx context.Context, name, root string, m configmap.Mapper) (fs.Fs, e
 		opt:  *opt,
 	}
 	f.setRoot(root)
+	for _, hashName := range opt.Hashes {
+		var ht hash.Type
+		if err := ht.Set(hashName); err != nil {
+			return nil, fmt.Errorf("invalid token %q in hash string %q", hashName, opt.Hashes.String())
+		}
+		f.hashes.Add(ht)
+	}
+	if opt.Snapshot != "" {
+		if err := useSnapshot(opt.Snapshot); err != nil {
+			return nil, err
+		}
+	}
 	f.features = (&fs.Features{
 		ReadMimeType:      true,
 		WriteMimeType:     true,
 		BucketBased:       true,
 		BucketBasedRootOK: true,
+		ReadMetadata:      true,
+		WriteMetadata:     true,
+		UserMetadata:      true,
 	}).Fill(ctx, f)
 	if f.rootBucket != "" && f.rootDirectory != "" {
 		od := buckets.getObjectData(f.rootBucket, f.rootDirectory)
@@ -288,8 +504,10 @@ func (f *Fs) list(ctx context.Context, bucket, directory, prefix string, addBuck
 	b.mu.RLock()
 	defer b.mu.RUnlock()
 	dirs := make(map[string]struct{})
+	found := false
 	for absPath, od := range b.objects {
 		if strings.HasPrefix(absPath, directory) {
+			found = true
 			remote := absPath[len(prefix):]
 			if !recurse {
 				localPath := absPath[len(directory):]
@@ -321,6 +539,9 @@ func (f *Fs) list(ctx context.Context, bucket, directory, prefix string, addBuck
 			}
 		}
 	}
+	if !found && directory != "" {
+		return fs.ErrorDirNotFound
+	}
 	return nil
 }
 
@@ -433,14 +654,14 @@ func (f *Fs) ListR(ctx context.Context, dir string, callback fs.ListRCallback) (
 // The new object may have been created if an error is returned
 func (f *Fs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
 	// Temporary Object under construction
-	fs := &Object{
+	o := &Object{
 		fs:     f,
 		remote: src.Remote(),
 		od: &objectData{
 			modTime: src.ModTime(ctx),
 		},
 	}
-	return fs, fs.Update(ctx, in, src, options...)
+	return o, o.Update(ctx, in, src, options...)
 }
 
 // PutStream uploads to the remote path with the modTime given of indeterminate size
@@ -493,14 +714,77 @@ func (f *Fs) Copy(ctx context.Context, src fs.Object, remote string) (fs.Object,
 	if od == nil {
 		return nil, fs.ErrorObjectNotFound
 	}
-	odCopy := *od
-	buckets.updateObjectData(dstBucket, dstPath, &odCopy)
+	meta, err := fs.GetMetadataOptions(ctx, f, src, fs.MetadataAsOpenOptions(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("copy: failed to read metadata: %w", err)
+	}
+	odCopy := od.clone()
+	if err = odCopy.setMetadata(meta); err != nil {
+		return nil, err
+	}
+	buckets.updateObjectData(dstBucket, dstPath, odCopy)
 	return f.NewObject(ctx, remote)
 }
 
+// Move src to this remote using server-side move operations.
+//
+// This is stored with the remote path given.
+//
+// It returns the destination Object and a possible error.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantMove
+func (f *Fs) Move(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	srcObj, ok := src.(*Object)
+	if !ok {
+		fs.Debugf(src, "Can't move - not same remote type")
+		return nil, fs.ErrorCantMove
+	}
+	srcBucket, srcPath := srcObj.split()
+	dstBucket, dstPath := f.split(remote)
+	if dstBucket == "" {
+		return nil, fs.ErrorCantMove
+	}
+	meta, err := fs.GetMetadataOptions(ctx, f, src, fs.MetadataAsOpenOptions(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("move: failed to read metadata: %w", err)
+	}
+	od := buckets.moveObjectData(srcBucket, srcPath, dstBucket, dstPath)
+	if od == nil {
+		return nil, fs.ErrorObjectNotFound
+	}
+	if err = od.setMetadata(meta); err != nil {
+		return nil, err
+	}
+	return f.newObject(remote, od), nil
+}
+
+// DirMove moves src, srcRemote to this remote at dstRemote
+// using server-side move operations.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantDirMove
+//
+// If destination exists then return fs.ErrorDirExists
+func (f *Fs) DirMove(ctx context.Context, src fs.Fs, srcRemote, dstRemote string) error {
+	srcFs, ok := src.(*Fs)
+	if !ok {
+		fs.Debugf(srcFs, "Can't move directory - not same remote type")
+		return fs.ErrorCantDirMove
+	}
+	srcBucket, srcPath := srcFs.split(srcRemote)
+	dstBucket, dstPath := f.split(dstRemote)
+	if srcBucket == "" || dstBucket == "" {
+		return fs.ErrorCantDirMove
+	}
+	return buckets.moveDir(srcBucket, srcPath, dstBucket, dstPath)
+}
+
 // Hashes returns the supported hash sets.
 func (f *Fs) Hashes() hash.Set {
-	return hash.Set(hashType)
+	return f.hashes
 }
 
 // ------------------------------------------------------------
@@ -525,14 +809,10 @@ func (o *Object) Remote() string {
 
 // Hash returns the hash of an object returning a lowercase hex string
 func (o *Object) Hash(ctx context.Context, t hash.Type) (string, error) {
-	if t != hashType {
+	if !o.fs.hashes.Contains(t) {
 		return "", hash.ErrUnsupported
 	}
-	if o.od.hash == "" {
-		sum := md5.Sum(o.od.data)
-		o.od.hash = hex.EncodeToString(sum[:])
-	}
-	return o.od.hash, nil
+	return o.od.hash(t)
 }
 
 // Size returns the size of an object in bytes
@@ -547,11 +827,15 @@ func (o *Object) Size() int64 {
 //
 // SHA-1 will also be updated once the request has completed.
 func (o *Object) ModTime(ctx context.Context) (result time.Time) {
+	o.od.mu.Lock()
+	defer o.od.mu.Unlock()
 	return o.od.modTime
 }
 
 // SetModTime sets the modification time of the local fs object
 func (o *Object) SetModTime(ctx context.Context, modTime time.Time) error {
+	o.od.mu.Lock()
+	defer o.od.mu.Unlock()
 	o.od.modTime = modTime
 	return nil
 }
@@ -598,12 +882,19 @@ func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, op
 	if err != nil {
 		return fmt.Errorf("failed to update memory object: %w", err)
 	}
-	o.od = &objectData{
+	meta, err := fs.GetMetadataOptions(ctx, o.fs, src, options)
+	if err != nil {
+		return fmt.Errorf("failed to read metadata from source object: %w", err)
+	}
+	od := &objectData{
 		data:     data,
-		hash:     "",
 		modTime:  src.ModTime(ctx),
 		mimeType: fs.MimeType(ctx, src),
 	}
+	if err = od.setMetadata(meta); err != nil {
+		return err
+	}
+	o.od = od
 	buckets.updateObjectData(bucket, bucketPath, o.od)
 	return nil
 }
@@ -620,15 +911,72 @@ func (o *Object) Remove(ctx context.Context) error {
 
 // MimeType of an Object if known, "" otherwise
 func (o *Object) MimeType(ctx context.Context) string {
+	o.od.mu.Lock()
+	defer o.od.mu.Unlock()
 	return o.od.mimeType
 }
 
+// Metadata returns metadata for an object
+//
+// It should return nil if there is no Metadata
+func (o *Object) Metadata(ctx context.Context) (metadata fs.Metadata, err error) {
+	o.od.mu.Lock()
+	defer o.od.mu.Unlock()
+	metadata = make(fs.Metadata, len(o.od.metadata)+2)
+	metadata.Merge(o.od.metadata)
+	metadata["mtime"] = o.od.modTime.Format(time.RFC3339Nano)
+	if o.od.mimeType != "" {
+		metadata["content-type"] = o.od.mimeType
+	}
+	return metadata, nil
+}
+
+// SetMetadata sets metadata for an Object
+//
+// It should return fs.ErrorNotImplemented if it can't set metadata
+func (o *Object) SetMetadata(ctx context.Context, metadata fs.Metadata) error {
+	return o.od.setMetadata(metadata)
+}
+
+// Command the backend to run a named command
+//
+// The command run is name
+// args may be used to read arguments from
+// opts may be used to read optional arguments from
+//
+// The result should be capable of being JSON encoded
+// If it is a string or a []string it will be shown to the user
+// otherwise it will be JSON encoded and shown to the user like that
+func (f *Fs) Command(ctx context.Context, name string, arg []string, opt map[string]string) (out interface{}, err error) {
+	switch name {
+	case "save", "load":
+		fileName := f.opt.Snapshot
+		if len(arg) > 0 {
+			fileName = arg[0]
+		}
+		if fileName == "" {
+			return nil, errors.New("need a snapshot file name as an argument or in the snapshot option")
+		}
+		if name == "save" {
+			return nil, saveSnapshot(fileName)
+		}
+		return nil, loadSnapshot(fileName)
+	default:
+		return nil, fs.ErrorCommandNotFound
+	}
+}
+
 // Check the interfaces are satisfied
 var (
-	_ fs.Fs          = &Fs{}
-	_ fs.Copier      = &Fs{}
-	_ fs.PutStreamer = &Fs{}
-	_ fs.ListRer     = &Fs{}
-	_ fs.Object      = &Object{}
-	_ fs.MimeTyper   = &Object{}
+	_ fs.Fs            = &Fs{}
+	_ fs.Copier        = &Fs{}
+	_ fs.Mover         = &Fs{}
+	_ fs.DirMover      = &Fs{}
+	_ fs.PutStreamer   = &Fs{}
+	_ fs.ListRer       = &Fs{}
+	_ fs.Commander     = &Fs{}
+	_ fs.Object        = &Object{}
+	_ fs.MimeTyper     = &Object{}
+	_ fs.Metadataer    = &Object{}
+	_ fs.SetMetadataer = &Object{}
 )
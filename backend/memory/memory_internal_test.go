@@ -3,12 +3,18 @@ package memory
 import (
 	"context"
 	"fmt"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/object"
 	"github.com/rclone/rclone/fs/operations"
 	"github.com/rclone/rclone/fstest"
 	"github.com/rclone/rclone/fstest/fstests"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -37,4 +43,54 @@ func testPurgeListDeadlock(t *testing.T) {
 	require.NoError(t, operations.Purge(ctx, r.Fremote, ""))
 }
 
+func TestHashes(t *testing.T) {
+	ctx := context.Background()
+	f, err := fs.NewFs(ctx, ":memory,hashes='sha1,crc32':hashes")
+	require.NoError(t, err)
+	assert.Equal(t, hash.NewHashSet(hash.SHA1, hash.CRC32), f.Hashes())
+
+	src := object.NewStaticObjectInfo("file.txt", t1, 5, true, nil, nil)
+	o, err := f.Put(ctx, strings.NewReader("hello"), src)
+	require.NoError(t, err)
+	sum, err := o.Hash(ctx, hash.CRC32)
+	require.NoError(t, err)
+	assert.Equal(t, "3610a686", sum)
+	_, err = o.Hash(ctx, hash.MD5)
+	assert.Equal(t, hash.ErrUnsupported, err)
+
+	_, err = fs.NewFs(ctx, ":memory,hashes=potato:")
+	assert.Error(t, err)
+}
+
+func TestSnapshot(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	ci.Metadata = true
+	fileName := filepath.Join(t.TempDir(), "snapshot.json")
+	f, err := fs.NewFs(ctx, ":memory:snapshot")
+	require.NoError(t, err)
+	metadata := fs.Metadata{"potato": "jersey", "content-type": "text/plain"}
+	src := object.NewStaticObjectInfo("dir/file.txt", t1, 5, true, nil, nil).WithMetadata(metadata)
+	_, err = f.Put(ctx, strings.NewReader("hello"), src)
+	require.NoError(t, err)
+
+	do := f.Features().Command
+	_, err = do(ctx, "save", []string{fileName}, nil)
+	require.NoError(t, err)
+	require.NoError(t, operations.Purge(ctx, f, ""))
+	_, err = f.NewObject(ctx, "dir/file.txt")
+	assert.Equal(t, fs.ErrorObjectNotFound, err)
+
+	_, err = do(ctx, "load", []string{fileName}, nil)
+	require.NoError(t, err)
+	o, err := f.NewObject(ctx, "dir/file.txt")
+	require.NoError(t, err)
+	fstest.CheckEntryMetadata(ctx, t, f, o, metadata)
+	assert.True(t, t1.Equal(o.ModTime(ctx)))
+	assert.Equal(t, int64(5), o.Size())
+
+	_, err = do(ctx, "save", nil, nil)
+	assert.Error(t, err)
+}
+
 var _ fstests.InternalTester = (*Fs)(nil)
@@ -0,0 +1,156 @@
+package memory
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/atexit"
+)
+
+var commandHelp = []fs.CommandHelp{{
+	Name:  "save",
+	Short: "Save all objects in memory to a snapshot file.",
+	Long: `This saves all the buckets and objects held by all memory remotes to
+the file given, or the file in the snapshot option if none is given.
+
+    rclone backend save :memory: /tmp/memory.json
+
+The file is replaced atomically.
+`,
+}, {
+	Name:  "load",
+	Short: "Load objects from a snapshot file into memory.",
+	Long: `This loads the buckets and objects in the file given, or the file in
+the snapshot option if none is given, replacing any objects in memory
+with the same names.
+
+    rclone backend load :memory: /tmp/memory.json
+`,
+}}
+
+// snapshotObject is an object as stored in a snapshot file
+type snapshotObject struct {
+	ModTime  time.Time   `json:"modTime"`
+	MimeType string      `json:"mimeType,omitempty"`
+	Metadata fs.Metadata `json:"metadata,omitempty"`
+	Data     []byte      `json:"data"`
+}
+
+// snapshot is the contents of a snapshot file - the objects in each
+// bucket indexed by path
+type snapshot map[string]map[string]snapshotObject
+
+var (
+	snapshotsMu sync.Mutex
+	snapshots   = map[string]struct{}{} // snapshot files in use
+)
+
+// useSnapshot loads the snapshot file the first time it is used and
+// arranges for it to be saved when rclone exits
+func useSnapshot(fileName string) error {
+	snapshotsMu.Lock()
+	defer snapshotsMu.Unlock()
+	if _, found := snapshots[fileName]; found {
+		return nil
+	}
+	err := loadSnapshot(fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		fs.Debugf(nil, "memory: snapshot %q not found - starting empty", fileName)
+	} else if err != nil {
+		return err
+	}
+	snapshots[fileName] = struct{}{}
+	atexit.Register(func() {
+		if err := saveSnapshot(fileName); err != nil {
+			fs.Errorf(nil, "memory: %v", err)
+		}
+	})
+	return nil
+}
+
+// loadSnapshot loads the objects in fileName into memory
+func loadSnapshot(fileName string) error {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return fmt.Errorf("failed to load snapshot: %w", err)
+	}
+	var snap snapshot
+	if err = json.Unmarshal(data, &snap); err != nil {
+		return fmt.Errorf("failed to load snapshot %q: %w", fileName, err)
+	}
+	objects := 0
+	for bucketName, bucketObjects := range snap {
+		b := buckets.makeBucket(bucketName)
+		b.mu.Lock()
+		for bucketPath, so := range bucketObjects {
+			b.objects[bucketPath] = &objectData{
+				modTime:  so.ModTime,
+				mimeType: so.MimeType,
+				metadata: so.Metadata,
+				data:     so.Data,
+			}
+			objects++
+		}
+		b.mu.Unlock()
+	}
+	fs.Debugf(nil, "memory: loaded %d objects in %d buckets from snapshot %q", objects, len(snap), fileName)
+	return nil
+}
+
+// saveSnapshot saves all the objects in memory to fileName
+func saveSnapshot(fileName string) (err error) {
+	snap := snapshot{}
+	buckets.mu.RLock()
+	for bucketName, b := range buckets.buckets {
+		bucketObjects := map[string]snapshotObject{}
+		b.mu.RLock()
+		for bucketPath, od := range b.objects {
+			od.mu.Lock()
+			metadata := make(fs.Metadata, len(od.metadata))
+			metadata.Merge(od.metadata)
+			bucketObjects[bucketPath] = snapshotObject{
+				ModTime:  od.modTime,
+				MimeType: od.mimeType,
+				Metadata: metadata,
+				Data:     od.data,
+			}
+			od.mu.Unlock()
+		}
+		b.mu.RUnlock()
+		snap[bucketName] = bucketObjects
+	}
+	buckets.mu.RUnlock()
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return fmt.Errorf("failed to save snapshot: %w", err)
+	}
+	// Write to a temporary file and rename so the snapshot is
+	// never left half written
+	tmp, err := os.CreateTemp(filepath.Dir(fileName), filepath.Base(fileName)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to save snapshot: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+	if _, err = tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to save snapshot: %w", err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save snapshot: %w", err)
+	}
+	if err = os.Rename(tmp.Name(), fileName); err != nil {
+		return fmt.Errorf("failed to save snapshot: %w", err)
+	}
+	fs.Debugf(nil, "memory: saved %d buckets to snapshot %q", len(snap), fileName)
+	return nil
+}
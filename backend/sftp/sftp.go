@@ -28,7 +28,9 @@ import (
 	"github.com/rclone/rclone/fs/config/obscure"
 	"github.com/rclone/rclone/fs/hash"
 	"github.com/rclone/rclone/lib/env"
+	lfile "github.com/rclone/rclone/lib/file"
 	"github.com/rclone/rclone/lib/pacer"
+	"github.com/rclone/rclone/lib/random"
 	"github.com/rclone/rclone/lib/readers"
 	sshagent "github.com/xanzy/ssh-agent"
 	"golang.org/x/crypto/ssh"
@@ -1099,6 +1101,7 @@ func NewFsWithConnection(ctx context.Context, f *Fs, name string, root string, m
 		CanHaveEmptyDirectories:  true,
 		SlowHash:                 true,
 		PartialUploads:           true,
+		SparseFiles:              true,
 		DirModTimeUpdatesOnWrite: true, // indicate writing files to a directory updates its modtime
 	}).Fill(ctx, f)
 	if !opt.CopyIsHardlink {
@@ -1503,6 +1506,67 @@ func (f *Fs) Copy(ctx context.Context, src fs.Object, remote string) (fs.Object,
 	return dstObj, nil
 }
 
+// HardLink makes a hard link to src at remote using the
+// hardlink@openssh.com extension.
+//
+// Any existing object at remote is replaced.
+//
+// If it isn't possible then return fs.ErrorCantHardLink
+func (f *Fs) HardLink(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	srcObj, ok := src.(*Object)
+	if !ok {
+		fs.Debugf(src, "Can't hard link - not same remote type")
+		return nil, fs.ErrorCantHardLink
+	}
+	err := f.mkParentDir(ctx, remote)
+	if err != nil {
+		return nil, fmt.Errorf("HardLink mkParentDir failed: %w", err)
+	}
+	c, err := f.getSftpConnection(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("HardLink: %w", err)
+	}
+	if _, ok := c.sftpClient.HasExtension("hardlink@openssh.com"); !ok {
+		f.putSftpConnection(&c, nil)
+		fs.Debugf(f, "Can't hard link - server doesn't support hardlink@openssh.com")
+		return nil, fs.ErrorCantHardLink
+	}
+	srcPath, dstPath := srcObj.path(), path.Join(f.absRoot, remote)
+	if _, ok := c.sftpClient.HasExtension("posix-rename@openssh.com"); ok {
+		// Link to a temporary name then rename it over any existing file
+		tmpPath := dstPath + ".rclone-link-" + random.String(8)
+		err = c.sftpClient.Link(srcPath, tmpPath)
+		if err == nil {
+			err = c.sftpClient.PosixRename(tmpPath, dstPath)
+			if err != nil {
+				_ = c.sftpClient.Remove(tmpPath)
+			}
+		}
+	} else {
+		// If haven't got PosixRename then remove the destination first
+		err = c.sftpClient.Remove(dstPath)
+		if err != nil && !errors.Is(err, iofs.ErrNotExist) {
+			fs.Errorf(f, "HardLink: Failed to remove existing file %q: %v", dstPath, err)
+		}
+		err = c.sftpClient.Link(srcPath, dstPath)
+	}
+	f.putSftpConnection(&c, err)
+	if err != nil {
+		if sftpErr, ok := err.(*sftp.StatusError); ok {
+			if sftpErr.FxCode() == sftp.ErrSSHFxOpUnsupported {
+				// Remote doesn't support Link
+				return nil, fs.ErrorCantHardLink
+			}
+		}
+		return nil, fmt.Errorf("HardLink failed: %w", err)
+	}
+	dstObj, err := f.NewObject(ctx, remote)
+	if err != nil {
+		return nil, fmt.Errorf("HardLink NewObject failed: %w", err)
+	}
+	return dstObj, nil
+}
+
 // DirMove moves src, srcRemote to this remote at dstRemote
 // using server-side move operations.
 //
@@ -2135,6 +2199,34 @@ func (sr *sizeReader) Size() int64 {
 	return sr.size
 }
 
+// WriteAt overwrites part of the remote file in place keeping its size
+// and modification time
+func (o *Object) WriteAt(ctx context.Context, p []byte, off int64) error {
+	if off < 0 || off+int64(len(p)) > o.size {
+		return fmt.Errorf("can't write %d bytes at offset %d beyond the end of the file", len(p), off)
+	}
+	// Clear the hash cache since we are about to change the object
+	o.md5sum = nil
+	o.sha1sum = nil
+	c, err := o.fs.getSftpConnection(ctx)
+	if err != nil {
+		return fmt.Errorf("WriteAt: %w", err)
+	}
+	file, err := c.sftpClient.OpenFile(o.path(), os.O_WRONLY)
+	if err == nil {
+		_, err = file.WriteAt(p, off)
+		closeErr := file.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}
+	o.fs.putSftpConnection(&c, err)
+	if err != nil {
+		return fmt.Errorf("WriteAt: %w", err)
+	}
+	return o.SetModTime(ctx, o.modTime)
+}
+
 // Update a remote sftp file using the data <in> and ModTime from <src>
 func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
 	o.fs.addSession() // Show session in use
@@ -2167,7 +2259,22 @@ func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, op
 			fs.Debugf(src, "Removed after failed upload: %v", err)
 		}
 	}
-	_, err = file.ReadFrom(&sizeReader{Reader: in, size: src.Size()})
+	var holes []fs.Extent
+	for _, option := range options {
+		if x, ok := option.(*fs.SparseOption); ok {
+			holes = x.Holes
+		}
+	}
+	if len(holes) > 0 {
+		// Leave holes in the file where the source has them
+		w := lfile.NewSparseWriter(file, holes)
+		_, err = io.Copy(w, in)
+		if err == nil {
+			err = w.Close()
+		}
+	} else {
+		_, err = file.ReadFrom(&sizeReader{Reader: in, size: src.Size()})
+	}
 	if err != nil {
 		o.fs.putSftpConnection(&c, err)
 		remove()
@@ -2223,9 +2330,11 @@ var (
 	_ fs.PutStreamer    = &Fs{}
 	_ fs.Mover          = &Fs{}
 	_ fs.Copier         = &Fs{}
+	_ fs.HardLinker     = &Fs{}
 	_ fs.DirMover       = &Fs{}
 	_ fs.DirSetModTimer = &Fs{}
 	_ fs.Abouter        = &Fs{}
 	_ fs.Shutdowner     = &Fs{}
 	_ fs.Object         = &Object{}
+	_ fs.InPlaceWriter  = &Object{}
 )
@@ -83,7 +83,9 @@ func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, op
 	}
 	if len(entries) == 1 {
 		obj := entries[0].(*upstream.Object)
-		return obj.Update(ctx, in, src, options...)
+		err := obj.Update(ctx, in, src, options...)
+		obj.UpstreamFs().RecordResult(err)
+		return err
 	}
 	// Multi-threading
 	readers, errChan := multiReader(len(entries), in)
@@ -91,6 +93,7 @@ func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, op
 	multithread(len(entries), func(i int) {
 		if o, ok := entries[i].(*upstream.Object); ok {
 			err := o.Update(ctx, readers[i], src, options...)
+			o.UpstreamFs().RecordResult(err)
 			if err != nil {
 				errs[i] = fmt.Errorf("%s: %w", o.UpstreamFs().Name(), err)
 				if len(entries) > 1 {
@@ -103,6 +106,9 @@ func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, op
 		}
 	})
 	errs[len(entries)] = <-errChan
+	if o.fs.isMirror() {
+		return o.fs.mirrorErrors(o.Remote(), errs, len(entries))
+	}
 	return errs.Err()
 }
 
@@ -116,6 +122,7 @@ func (o *Object) Remove(ctx context.Context) error {
 	multithread(len(entries), func(i int) {
 		if o, ok := entries[i].(*upstream.Object); ok {
 			err := o.Remove(ctx)
+			o.UpstreamFs().RecordResult(err)
 			if err != nil {
 				errs[i] = fmt.Errorf("%s: %w", o.UpstreamFs().Name(), err)
 			}
@@ -123,7 +130,11 @@ func (o *Object) Remove(ctx context.Context) error {
 			errs[i] = fs.ErrorNotAFile
 		}
 	})
-	return errs.Err()
+	err = errs.Err()
+	if err == nil {
+		o.fs.divergence.remove(o.Remote())
+	}
+	return err
 }
 
 // SetModTime sets the metadata on the object to set the modification date
@@ -200,6 +211,9 @@ func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (io.ReadClo
 		o.Object = newObj
 		o.co = append(o.co, newObj) // FIXME should this append or overwrite or update?
 	}
+	if o.fs.isMirror() {
+		return o.openMirror(ctx, options...)
+	}
 	return o.Object.Object.Open(ctx, options...)
 }
 
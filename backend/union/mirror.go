@@ -0,0 +1,330 @@
+package union
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/backend/union/policy"
+	"github.com/rclone/rclone/backend/union/upstream"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fs/walk"
+)
+
+var commandHelp = []fs.CommandHelp{{
+	Name:  "repair",
+	Short: "Re-replicate files which are missing or mismatched on some upstreams.",
+	Long: `This command is only available with the mirror create policy.
+
+It checks every file in the directories given (or the root if none
+are) and finds the newest copy. That copy is copied to any upstream
+holding a copy which doesn't match it and to the healthiest upstreams
+without a copy until there are as many copies as the replicas option
+asks for.
+
+Usage Example:
+
+    rclone backend repair union: [dir...]
+
+It returns a count of the files repaired, already ok and which
+failed.
+`,
+}, {
+	Name:  "status",
+	Short: "Show the health of the upstreams and any divergent files.",
+	Long: `This command is only available with the mirror create policy.
+
+It shows the number of consecutive failures of each upstream and the
+files which have been seen to be missing or mismatched on some
+upstreams since rclone started, with the reason why.
+
+Usage Example:
+
+    rclone backend status union:
+`,
+}}
+
+// divergence records files which are known not to be replicated
+// properly
+type divergence struct {
+	mu    sync.Mutex
+	paths map[string]string // path to reason
+}
+
+// add records that remote has diverged
+func (d *divergence) add(remote, reason string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.paths == nil {
+		d.paths = make(map[string]string)
+	}
+	d.paths[remote] = reason
+}
+
+// remove records that remote is replicated properly
+func (d *divergence) remove(remote string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.paths, remote)
+}
+
+// get returns a copy of the divergent paths
+func (d *divergence) get() map[string]string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	paths := make(map[string]string, len(d.paths))
+	for remote, reason := range d.paths {
+		paths[remote] = reason
+	}
+	return paths
+}
+
+// isMirror returns true if the Fs is using the mirror create policy
+func (f *Fs) isMirror() bool {
+	_, ok := f.createPolicy.(*policy.Mirror)
+	return ok
+}
+
+// sameObject returns true if a and b look like the same content
+func (f *Fs) sameObject(ctx context.Context, a, b fs.Object) bool {
+	if a.Size() != b.Size() {
+		return false
+	}
+	dt := a.ModTime(ctx).Sub(b.ModTime(ctx))
+	if dt < 0 {
+		dt = -dt
+	}
+	return dt < time.Second || dt <= f.Precision()
+}
+
+// checkReplicas records the object as divergent if it has too few
+// or mismatched copies
+func (f *Fs) checkReplicas(ctx context.Context, o *Object) {
+	if !f.isMirror() {
+		return
+	}
+	remote := o.Remote()
+	for _, e := range o.candidates() {
+		if co, ok := e.(*upstream.Object); ok && !f.sameObject(ctx, o.Object, co) {
+			f.divergence.add(remote, fmt.Sprintf("copy on %s doesn't match copy on %s", co.UpstreamFs().Name(), o.UpstreamFs().Name()))
+			return
+		}
+	}
+	if n := policy.Replicas(f.upstreams); len(o.candidates()) < n {
+		f.divergence.add(remote, fmt.Sprintf("%d of %d copies found", len(o.candidates()), n))
+	}
+}
+
+// mirrorErrors logs and records the errors from writing remote to
+// some of the upstreams in mirror mode.
+//
+// errs has an error for each of the n upstreams followed by the
+// error from reading the source. It returns an error only if all the
+// writes failed or the source couldn't be read.
+func (f *Fs) mirrorErrors(remote string, errs Errors, n int) error {
+	failed := 0
+	for _, err := range errs[:n] {
+		if err != nil {
+			failed++
+		}
+	}
+	if failed == 0 || failed == n || errs[n] != nil {
+		return errs.Err()
+	}
+	err := errs.Err()
+	fs.Errorf(remote, "Failed to write %d of %d copies: %v", failed, n, err)
+	f.divergence.add(remote, err.Error())
+	return nil
+}
+
+// failoverCandidates returns the copies of o other than the one in
+// use which match it, healthiest first
+func (o *Object) failoverCandidates(ctx context.Context) (objs []*upstream.Object) {
+	for _, e := range o.candidates() {
+		co, ok := e.(*upstream.Object)
+		if !ok || co == o.Object || !o.fs.sameObject(ctx, o.Object, co) {
+			continue
+		}
+		objs = append(objs, co)
+	}
+	sort.SliceStable(objs, func(i, j int) bool {
+		return objs[i].UpstreamFs().Failures() < objs[j].UpstreamFs().Failures()
+	})
+	return objs
+}
+
+// openMirror opens the object for read, failing over to the other
+// copies if the open fails
+func (o *Object) openMirror(ctx context.Context, options ...fs.OpenOption) (in io.ReadCloser, err error) {
+	for _, co := range append([]*upstream.Object{o.Object}, o.failoverCandidates(ctx)...) {
+		in, err = co.Object.Open(ctx, options...)
+		co.UpstreamFs().RecordResult(err)
+		if err == nil {
+			return &healthReader{ReadCloser: in, u: co.UpstreamFs()}, nil
+		}
+		if errors.Is(err, context.Canceled) {
+			return nil, err
+		}
+		fs.Errorf(o, "Failed to open copy on %s, trying next copy: %v", co.UpstreamFs().Name(), err)
+	}
+	return nil, err
+}
+
+// healthReader records read errors against the upstream
+type healthReader struct {
+	io.ReadCloser
+	u *upstream.Fs
+}
+
+// Read bytes from the underlying reader
+func (r *healthReader) Read(p []byte) (n int, err error) {
+	n, err = r.ReadCloser.Read(p)
+	if err != nil && err != io.EOF {
+		r.u.RecordResult(err)
+	}
+	return n, err
+}
+
+// repairObject copies the newest copy of o to the upstreams which
+// are missing it or have a mismatched copy.
+//
+// It returns true if anything was copied.
+func (f *Fs) repairObject(ctx context.Context, o *Object) (repaired bool, err error) {
+	good, err := (&policy.Mirror{}).SearchEntries(o.candidates()...)
+	if err != nil {
+		return false, err
+	}
+	src := good.(*upstream.Object)
+	have := make(map[*upstream.Fs]*upstream.Object)
+	copies := 0
+	for _, e := range o.candidates() {
+		co, ok := e.(*upstream.Object)
+		if !ok {
+			continue
+		}
+		have[co.UpstreamFs()] = co
+		if f.sameObject(ctx, src, co) {
+			copies++
+		}
+	}
+	var targets []*upstream.Fs
+	for u, co := range have {
+		if u.IsWritable() && !f.sameObject(ctx, src, co) {
+			targets = append(targets, u)
+		}
+	}
+	for _, u := range policy.ByHealth(f.upstreams) {
+		if copies+len(targets) >= policy.Replicas(f.upstreams) {
+			break
+		}
+		if _, found := have[u]; !found && u.IsCreatable() {
+			targets = append(targets, u)
+		}
+	}
+	var errs []error
+	for _, u := range targets {
+		var dst fs.Object
+		if co := have[u]; co != nil {
+			dst = co.Object
+		}
+		_, err := operations.Copy(ctx, u, dst, src.Remote(), src.Object)
+		u.RecordResult(err)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", u.Name(), err))
+			continue
+		}
+		fs.Infof(src, "Repaired copy on %s", u.Name())
+		repaired = true
+	}
+	if len(errs) > 0 {
+		return repaired, Errors(errs).Err()
+	}
+	return repaired, nil
+}
+
+// repair the objects in dirs
+func (f *Fs) repair(ctx context.Context, dirs []string) (out map[string]int, err error) {
+	if len(dirs) == 0 {
+		dirs = []string{""}
+	}
+	var mu sync.Mutex
+	out = map[string]int{"repaired": 0, "ok": 0, "errors": 0}
+	for _, dir := range dirs {
+		err = walk.ListR(ctx, f, dir, true, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+			for _, entry := range entries {
+				o, ok := entry.(*Object)
+				if !ok {
+					continue
+				}
+				repaired, err := f.repairObject(ctx, o)
+				mu.Lock()
+				switch {
+				case err != nil:
+					fs.Errorf(o, "Failed to repair: %v", err)
+					f.divergence.add(o.Remote(), err.Error())
+					out["errors"]++
+				case repaired:
+					f.divergence.remove(o.Remote())
+					out["repaired"]++
+				default:
+					f.divergence.remove(o.Remote())
+					out["ok"]++
+				}
+				mu.Unlock()
+			}
+			return nil
+		})
+		if err != nil {
+			return out, err
+		}
+	}
+	return out, nil
+}
+
+// status returns the health of the upstreams and the divergent files
+func (f *Fs) status() map[string]interface{} {
+	upstreams := make(map[string]int64, len(f.upstreams))
+	for _, u := range f.upstreams {
+		upstreams[fs.ConfigString(u)] = u.Failures()
+	}
+	return map[string]interface{}{
+		"upstreams": upstreams,
+		"divergent": f.divergence.get(),
+	}
+}
+
+// Command the backend to run a named command
+//
+// The command run is name
+// args may be used to read arguments from
+// opts may be used to read optional arguments from
+//
+// The result should be capable of being JSON encoded
+// If it is a string or a []string it will be shown to the user
+// otherwise it will be JSON encoded and shown to the user like that
+func (f *Fs) Command(ctx context.Context, name string, arg []string, opt map[string]string) (out interface{}, err error) {
+	switch name {
+	case "repair":
+		if !f.isMirror() {
+			return nil, errors.New("repair needs the mirror create policy")
+		}
+		return f.repair(ctx, arg)
+	case "status":
+		if !f.isMirror() {
+			return nil, errors.New("status needs the mirror create policy")
+		}
+		return f.status(), nil
+	default:
+		return nil, fs.ErrorCommandNotFound
+	}
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Commander = (*Fs)(nil)
+)
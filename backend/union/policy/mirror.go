@@ -0,0 +1,123 @@
+package policy
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/rclone/rclone/backend/union/upstream"
+	"github.com/rclone/rclone/fs"
+)
+
+func init() {
+	registerPolicy("mirror", &Mirror{})
+}
+
+// Mirror keeps copies of each file on several upstreams
+// Action category: same as epall.
+// Create category: apply to the healthiest upstreams, as many as the
+// replicas option says or all of them if it is 0.
+// Search category: the healthiest upstream with the newest copy.
+type Mirror struct {
+	EpAll
+}
+
+// Replicas returns the number of copies the mirror policy should
+// keep of each file on upstreams
+func Replicas(upstreams []*upstream.Fs) int {
+	if len(upstreams) == 0 {
+		return 0
+	}
+	n := upstreams[0].Opt.Replicas
+	if n <= 0 || n > len(upstreams) {
+		n = len(upstreams)
+	}
+	return n
+}
+
+// ByHealth sorts upstreams with the healthiest first, keeping the
+// configured order for those which are equally healthy
+func ByHealth(upstreams []*upstream.Fs) []*upstream.Fs {
+	upstreams = append([]*upstream.Fs(nil), upstreams...)
+	sort.SliceStable(upstreams, func(i, j int) bool {
+		return upstreams[i].Failures() < upstreams[j].Failures()
+	})
+	return upstreams
+}
+
+// mirror chooses the healthiest upstreams to create on
+func (p *Mirror) mirror(upstreams []*upstream.Fs) []*upstream.Fs {
+	return ByHealth(upstreams)[:Replicas(upstreams)]
+}
+
+// mirrorEntries chooses the healthiest entry with the newest content
+func (p *Mirror) mirrorEntries(entries []upstream.Entry) upstream.Entry {
+	ctx := context.Background()
+	newest := entries[0]
+	for _, e := range entries[1:] {
+		if e.ModTime(ctx).After(newest.ModTime(ctx)) {
+			newest = e
+		}
+	}
+	best := newest
+	for _, e := range entries {
+		if e.Size() != newest.Size() || !sameTime(e.ModTime(ctx), newest.ModTime(ctx)) {
+			continue
+		}
+		if e.UpstreamFs().Failures() < best.UpstreamFs().Failures() {
+			best = e
+		}
+	}
+	return best
+}
+
+// sameTime returns true if the times are within a second of each
+// other which is the worst precision of the upstreams we expect
+func sameTime(a, b time.Time) bool {
+	dt := a.Sub(b)
+	return dt < time.Second && dt > -time.Second
+}
+
+// Create category policy, governing the creation of files and directories
+func (p *Mirror) Create(ctx context.Context, upstreams []*upstream.Fs, path string) ([]*upstream.Fs, error) {
+	if len(upstreams) == 0 {
+		return nil, fs.ErrorObjectNotFound
+	}
+	upstreams = filterNC(upstreams)
+	if len(upstreams) == 0 {
+		return nil, fs.ErrorPermissionDenied
+	}
+	return p.mirror(upstreams), nil
+}
+
+// CreateEntries is CREATE category policy but receiving a set of candidate entries
+func (p *Mirror) CreateEntries(entries ...upstream.Entry) ([]upstream.Entry, error) {
+	if len(entries) == 0 {
+		return nil, fs.ErrorObjectNotFound
+	}
+	entries = filterNCEntries(entries)
+	if len(entries) == 0 {
+		return nil, fs.ErrorPermissionDenied
+	}
+	return entries, nil
+}
+
+// Search category policy, governing the access to files and directories
+func (p *Mirror) Search(ctx context.Context, upstreams []*upstream.Fs, path string) (*upstream.Fs, error) {
+	if len(upstreams) == 0 {
+		return nil, fs.ErrorObjectNotFound
+	}
+	upstreams, err := p.epall(ctx, upstreams, path)
+	if err != nil {
+		return nil, err
+	}
+	return ByHealth(upstreams)[0], nil
+}
+
+// SearchEntries is SEARCH category policy but receiving a set of candidate entries
+func (p *Mirror) SearchEntries(entries ...upstream.Entry) (upstream.Entry, error) {
+	if len(entries) == 0 {
+		return nil, fs.ErrorObjectNotFound
+	}
+	return p.mirrorEntries(entries), nil
+}
@@ -33,6 +33,7 @@ func init() {
 		MetadataInfo: &fs.MetadataInfo{
 			Help: `Any metadata supported by the underlying remote is read and written.`,
 		},
+		CommandHelp: commandHelp,
 		Options: []fs.Option{{
 			Name:     "upstreams",
 			Help:     "List of space separated upstreams.\n\nCan be 'upstreama:test/dir upstreamb:', '\"upstreama:test/space:ro dir\" upstreamb:', etc.",
@@ -61,6 +62,14 @@ If a remote has less than this much free space then it won't be
 considered for use in lfs or eplfs policies.`,
 			Advanced: true,
 			Default:  fs.Gibi,
+		}, {
+			Name: "replicas",
+			Help: `Number of upstreams to write each file to for the mirror policy.
+
+When the create policy is mirror each new file is written to this
+many of the healthiest upstreams. Set to 0 to write to all of them.`,
+			Advanced: true,
+			Default:  0,
 		}},
 	}
 	fs.Register(fsi)
@@ -77,6 +86,7 @@ type Fs struct {
 	actionPolicy policy.Policy  // policy for ACTION
 	createPolicy policy.Policy  // policy for CREATE
 	searchPolicy policy.Policy  // policy for SEARCH
+	divergence   divergence     // files not replicated properly in mirror mode
 }
 
 // Wrap candidate objects in to a union Object
@@ -548,6 +558,7 @@ func (f *Fs) put(ctx context.Context, in io.Reader, src fs.ObjectInfo, stream bo
 		} else {
 			o, err = u.Put(ctx, in, src, options...)
 		}
+		u.RecordResult(err)
 		if err != nil {
 			return nil, err
 		}
@@ -567,6 +578,7 @@ func (f *Fs) put(ctx context.Context, in io.Reader, src fs.ObjectInfo, stream bo
 		} else {
 			o, err = u.Put(ctx, readers[i], src, options...)
 		}
+		u.RecordResult(err)
 		if err != nil {
 			errs[i] = fmt.Errorf("%s: %w", u.Name(), err)
 			if len(upstreams) > 1 {
@@ -578,10 +590,15 @@ func (f *Fs) put(ctx context.Context, in io.Reader, src fs.ObjectInfo, stream bo
 		objs[i] = u.WrapObject(o)
 	})
 	errs[len(upstreams)] = <-errChan
-	err = errs.Err()
+	if f.isMirror() {
+		err = f.mirrorErrors(srcPath, errs, len(upstreams))
+	} else {
+		err = errs.Err()
+	}
 	if err != nil {
 		return nil, err
 	}
+	objs = filterEntries(objs)
 	e, err := f.wrapEntries(objs...)
 	return e.(*Object), err
 }
@@ -782,6 +799,7 @@ func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
 	multithread(len(f.upstreams), func(i int) {
 		u := f.upstreams[i]
 		o, err := u.NewObject(ctx, remote)
+		u.RecordResult(err)
 		if err != nil && err != fs.ErrorObjectNotFound {
 			errs[i] = fmt.Errorf("%s: %w", u.Name(), err)
 			return
@@ -801,6 +819,12 @@ func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
 	if err != nil {
 		return nil, err
 	}
+	f.checkReplicas(ctx, e.(*Object))
+	if f.isMirror() && errs.Err() != nil {
+		// Another copy can be used instead of the one we couldn't read
+		fs.Errorf(remote, "Failed to find some copies: %v", errs.Err())
+		return e.(*Object), nil
+	}
 	return e.(*Object), errs.Err()
 }
 
@@ -1043,6 +1067,16 @@ func parentDir(absPath string) string {
 	return parent
 }
 
+// filterEntries returns the entries which aren't nil
+func filterEntries(entries []upstream.Entry) (out []upstream.Entry) {
+	for _, e := range entries {
+		if e != nil {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
 func multithread(num int, fn func(int)) {
 	var wg sync.WaitGroup
 	for i := 0; i < num; i++ {
@@ -7,7 +7,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/rclone/rclone/backend/union/upstream"
 	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
 	"github.com/rclone/rclone/fs/object"
 	"github.com/rclone/rclone/fs/operations"
 	"github.com/rclone/rclone/fstest"
@@ -87,6 +89,12 @@ func TestMoveCopy(t *testing.T) {
 	}
 	ctx := context.Background()
 	dirs := MakeTestDirs(t, 1)
+
+	// Disable Move on the cached :memory: remote the union will use
+	memoryFs, err := cache.Get(ctx, ":memory:bucket")
+	require.NoError(t, err)
+	memoryFs.Features().Disable("Move")
+
 	fsString := fmt.Sprintf(":union,upstreams='%s :memory:bucket':", dirs[0])
 	f, err := fs.NewFs(ctx, fsString)
 	require.NoError(t, err)
@@ -156,3 +164,67 @@ func TestMoveCopy(t *testing.T) {
 		})
 	})
 }
+
+// This tests the mirror policy keeps the replicas, fails over on read
+// and repairs missing copies
+func TestMirror(t *testing.T) {
+	if *fstest.RemoteName != "" {
+		t.Skip("Skipping as -remote set")
+	}
+	ctx := context.Background()
+	dirs := MakeTestDirs(t, 3)
+	fsString := fmt.Sprintf(":union,upstreams='%s %s %s',action_policy=mirror,create_policy=mirror,search_policy=mirror,replicas=2:", dirs[0], dirs[1], dirs[2])
+	f, err := fs.NewFs(ctx, fsString)
+	require.NoError(t, err)
+	unionFs := f.(*Fs)
+
+	// copies returns the upstreams holding the file
+	copies := func(remote string) (us []*upstream.Fs) {
+		for _, u := range unionFs.upstreams {
+			if _, err := u.NewObject(ctx, remote); err == nil {
+				us = append(us, u)
+			}
+		}
+		return us
+	}
+
+	contents := random.String(50)
+	file := fstest.NewItem("file.txt", contents, time.Now())
+	_ = fstests.PutTestContents(ctx, t, f, &file, contents, true)
+	us := copies(file.Path)
+	require.Equal(t, 2, len(us))
+
+	t.Run("Failover", func(t *testing.T) {
+		o, err := f.NewObject(ctx, file.Path)
+		require.NoError(t, err)
+		bad := o.(*Object).UpstreamFs()
+		badObj, err := bad.NewObject(ctx, file.Path)
+		require.NoError(t, err)
+		require.NoError(t, badObj.Remove(ctx))
+
+		// The object still points at the removed copy
+		assert.Equal(t, contents, fstests.ReadObject(ctx, t, o, -1))
+	})
+
+	t.Run("Repair", func(t *testing.T) {
+		assert.Equal(t, 1, len(copies(file.Path)))
+		_, err := f.NewObject(ctx, file.Path)
+		require.NoError(t, err)
+		out, err := f.Features().Command(ctx, "status", nil, nil)
+		require.NoError(t, err)
+		assert.Contains(t, out.(map[string]interface{})["divergent"], file.Path)
+
+		out, err = f.Features().Command(ctx, "repair", nil, nil)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]int{"repaired": 1, "ok": 0, "errors": 0}, out)
+		assert.Equal(t, 2, len(copies(file.Path)))
+
+		out, err = f.Features().Command(ctx, "status", nil, nil)
+		require.NoError(t, err)
+		assert.NotContains(t, out.(map[string]interface{})["divergent"], file.Path)
+
+		out, err = f.Features().Command(ctx, "repair", nil, nil)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]int{"repaired": 0, "ok": 1, "errors": 0}, out)
+	})
+}
@@ -37,9 +37,10 @@ type Fs struct {
 	cacheExpiry atomic.Int64  // usage cache expiry time
 	cacheMutex  sync.RWMutex
 	cacheOnce   sync.Once
-	cacheUpdate bool // if the cache is updating
-	writeback   bool // writeback to this upstream
-	writebackFs *Fs  // if non zero, writeback to this upstream
+	cacheUpdate bool         // if the cache is updating
+	writeback   bool         // writeback to this upstream
+	writebackFs *Fs          // if non zero, writeback to this upstream
+	failures    atomic.Int64 // number of consecutive failed operations
 }
 
 // Directory describes a wrapped Directory
@@ -195,6 +196,27 @@ func (f *Fs) IsWritable() bool {
 	return f.writable
 }
 
+// RecordResult records the result of an operation on the upstream
+// for the health tracking used by the mirror policy.
+//
+// Errors which say an object or directory doesn't exist don't count
+// as failures.
+func (f *Fs) RecordResult(err error) {
+	switch {
+	case err == nil:
+		f.failures.Store(0)
+	case errors.Is(err, fs.ErrorObjectNotFound), errors.Is(err, fs.ErrorDirNotFound), errors.Is(err, context.Canceled):
+	default:
+		f.failures.Add(1)
+	}
+}
+
+// Failures returns the number of consecutive failed operations on
+// the upstream - the lower the healthier
+func (f *Fs) Failures() int64 {
+	return f.failures.Load()
+}
+
 // Put in to the remote path with the modTime given of the given size
 //
 // May create the object even if it returns an error - if so
@@ -31,9 +31,11 @@ docs = [
     "fichier.md",
     "alias.md",
     "s3.md",
+    "archive.md",
     "b2.md",
     "box.md",
     "cache.md",
+    "cas.md",
     "chunker.md",
     "sharefile.md",
     "crypt.md",
@@ -41,6 +43,8 @@ docs = [
     "combine.md",
     "dropbox.md",
     "filefabric.md",
+    "erasure.md",
+    "faulty.md",
     "ftp.md",
     "googlecloudstorage.md",
     "drive.md",
@@ -0,0 +1,50 @@
+// Package archive provides the archive command.
+package archive
+
+import (
+	"fmt"
+
+	"github.com/rclone/rclone/cmd"
+	libarchive "github.com/rclone/rclone/lib/archive"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	cmd.Root.AddCommand(archiveCommand)
+	archiveCommand.AddCommand(createCommand)
+	archiveCommand.AddCommand(extractCommand)
+}
+
+var archiveCommand = &cobra.Command{
+	Use:   "archive <action> [opts] <source> <destination>",
+	Short: `Create and extract archives on remotes.`,
+	Long: `Create archives from files on a remote or extract the files in an
+archive to a remote, streaming the data without staging it locally.
+
+The format of the archive is chosen from the extension of its name:
+
+- ` + "`.zip`" + ` - zip
+- ` + "`.tar`" + ` - tar
+- ` + "`.tar.gz`" + ` or ` + "`.tgz`" + ` - tar compressed with gzip
+- ` + "`.tar.zst`" + ` or ` + "`.tzst`" + ` - tar compressed with zstd
+
+Bundling many small files into a single archive can make storing them
+on remotes which are slow with lots of files much quicker.
+
+To read files out of archives without extracting them see the
+[archive](/archive/) backend and the ` + "`--archive-browse`" + ` flag.
+`,
+	Annotations: map[string]string{
+		"versionIntroduced": "v1.67",
+	},
+}
+
+// formatOf returns the format of an archive from its name
+func formatOf(name string) (libarchive.Format, error) {
+	format := libarchive.FormatOf(name)
+	switch format {
+	case libarchive.FormatNone, libarchive.Format7z:
+		return libarchive.FormatNone, fmt.Errorf("unknown archive format for %q: name should end in .zip, .tar, .tar.gz, .tgz, .tar.zst or .tzst", name)
+	}
+	return format, nil
+}
@@ -0,0 +1,115 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/filter"
+	"github.com/rclone/rclone/fstest"
+	libarchive "github.com/rclone/rclone/lib/archive"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	t1 = fstest.Time("2017-02-03T04:05:06Z")
+	t2 = fstest.Time("2018-03-04T05:06:07Z")
+)
+
+// TestMain drives the tests
+func TestMain(m *testing.M) {
+	fstest.TestMain(m)
+}
+
+func TestFormatOf(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		want libarchive.Format
+	}{
+		{"a.zip", libarchive.FormatZip},
+		{"dir/a.TAR", libarchive.FormatTar},
+		{"a.tar.gz", libarchive.FormatTarGz},
+		{"a.tgz", libarchive.FormatTarGz},
+		{"a.tar.zst", libarchive.FormatTarZstd},
+		{"a.tzst", libarchive.FormatTarZstd},
+	} {
+		got, err := formatOf(test.name)
+		require.NoError(t, err, test.name)
+		assert.Equal(t, test.want, got, test.name)
+	}
+	for _, name := range []string{"a.7z", "a.txt"} {
+		_, err := formatOf(name)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestCreateExtract(t *testing.T) {
+	ctx := context.Background()
+	r := fstest.NewRun(t)
+	file1 := r.WriteFile("hello.txt", "hello world", t1)
+	file2 := r.WriteFile("dir/big.txt", strings.Repeat("0123456789", 10000), t2)
+	file3 := r.WriteFile("dir/sub/empty.txt", "", t1)
+
+	for _, name := range []string{"test.zip", "test.tar", "test.tar.gz", "test.tar.zst"} {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, Create(ctx, r.Flocal, r.Fremote, name))
+			src, err := r.Fremote.NewObject(ctx, name)
+			require.NoError(t, err)
+
+			fdst, err := fs.NewFs(ctx, t.TempDir())
+			require.NoError(t, err)
+			require.NoError(t, Extract(ctx, src, fdst))
+			fstest.CheckListingWithPrecision(t, fdst, []fstest.Item{file1, file2, file3}, []string{"dir", "dir/sub"}, fs.GetModifyWindow(ctx, fdst))
+		})
+	}
+}
+
+func TestExtractFiltered(t *testing.T) {
+	ctx := context.Background()
+	r := fstest.NewRun(t)
+	file1 := r.WriteFile("hello.txt", "hello world", t1)
+	r.WriteFile("dir/skip.log", "skipped", t2)
+
+	require.NoError(t, Create(ctx, r.Flocal, r.Fremote, "test.tar"))
+	src, err := r.Fremote.NewObject(ctx, "test.tar")
+	require.NoError(t, err)
+
+	ctx, fi := filter.AddConfig(ctx)
+	require.NoError(t, fi.AddRule("- *.log"))
+	fdst, err := fs.NewFs(ctx, t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, Extract(ctx, src, fdst))
+	fstest.CheckListingWithPrecision(t, fdst, []fstest.Item{file1}, []string{"dir"}, fs.GetModifyWindow(ctx, fdst))
+}
+
+func TestExtractZipZstd(t *testing.T) {
+	ctx := context.Background()
+	r := fstest.NewRun(t)
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	zw.RegisterCompressor(libarchive.ZipMethodZstd, func(out io.Writer) (io.WriteCloser, error) {
+		return zstd.NewWriter(out)
+	})
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: "hello.txt", Method: libarchive.ZipMethodZstd, Modified: t1})
+	require.NoError(t, err)
+	_, err = w.Write([]byte("hello zstd"))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	r.WriteObject(ctx, "test.zip", buf.String(), t1)
+	src, err := r.Fremote.NewObject(ctx, "test.zip")
+	require.NoError(t, err)
+
+	fdst, err := fs.NewFs(ctx, t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, Extract(ctx, src, fdst))
+	file1 := fstest.NewItem("hello.txt", "hello zstd", t1)
+	fstest.CheckListingWithPrecision(t, fdst, []fstest.Item{file1}, nil, fs.GetModifyWindow(ctx, fdst))
+}
@@ -0,0 +1,282 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fs/walk"
+	libarchive "github.com/rclone/rclone/lib/archive"
+	"github.com/spf13/cobra"
+)
+
+var createCommand = &cobra.Command{
+	Use:   "create source:path dest:path/file.tar.zst",
+	Short: `Create an archive of files on a remote.`,
+	Long: `Create an archive on the destination of the files and directories
+in the source, for example
+
+    rclone archive create remote:photos remote:backups/photos.tar.zst
+
+The archive is streamed to the destination as it is made, so nothing
+is staged locally unless the destination doesn't support streaming
+uploads. Filters can be used to choose which files go in the archive.
+
+The modification times of the files are stored in the archive. If
+` + "`--metadata`" + ` is set the metadata of the files is also stored
+in tar archives. The ` + "`mode`, `uid`, `gid` and `atime`" + ` metadata
+are stored in the standard tar header fields and the rest in PAX
+records named ` + "`RCLONE.meta.<key>`" + `. Only the mode is stored in
+zip archives.
+
+Files of unknown size can't be stored in tar archives so are skipped.
+`,
+	Annotations: map[string]string{
+		"versionIntroduced": "v1.67",
+	},
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(2, 2, command, args)
+		fsrc := cmd.NewFsSrc(args)
+		fdst, dstFileName := cmd.NewFsDstFile(args[1:])
+		cmd.Run(false, true, command, func() error {
+			return Create(context.Background(), fsrc, fdst, dstFileName)
+		})
+	},
+}
+
+// archiveWriter writes the entries of an archive
+type archiveWriter interface {
+	addDir(ctx context.Context, d fs.Directory) error
+	addFile(ctx context.Context, o fs.Object, in io.Reader) error
+	Close() error
+}
+
+// Create makes an archive called dstFileName on fdst of the files in
+// fsrc. The format is chosen from the name of the archive.
+func Create(ctx context.Context, fsrc, fdst fs.Fs, dstFileName string) (err error) {
+	format, err := formatOf(dstFileName)
+	if err != nil {
+		return err
+	}
+	ci := fs.GetConfig(ctx)
+	var entries fs.DirEntries
+	err = walk.ListR(ctx, fsrc, "", false, ci.MaxDepth, walk.ListAll, func(batch fs.DirEntries) error {
+		entries = append(entries, batch...)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list source: %w", err)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Remote() < entries[j].Remote()
+	})
+
+	pr, pw := io.Pipe()
+	writeErr := make(chan error, 1)
+	go func() {
+		err := writeArchive(ctx, pw, format, entries)
+		_ = pw.CloseWithError(err)
+		writeErr <- err
+	}()
+	_, err = operations.Rcat(ctx, fdst, dstFileName, pr, time.Now(), nil)
+	_ = pr.CloseWithError(errors.New("upload of archive finished"))
+	if archiveErr := <-writeErr; archiveErr != nil {
+		return fmt.Errorf("failed to make archive: %w", archiveErr)
+	}
+	return err
+}
+
+// writeArchive writes an archive of the entries to out
+func writeArchive(ctx context.Context, out io.Writer, format libarchive.Format, entries fs.DirEntries) (err error) {
+	var aw archiveWriter
+	if format == libarchive.FormatZip {
+		aw = &zipWriter{zw: zip.NewWriter(out)}
+	} else {
+		cw, err := libarchive.Compress(format, out)
+		if err != nil {
+			return err
+		}
+		aw = &tarWriter{tw: tar.NewWriter(cw), cw: cw}
+	}
+	defer fs.CheckClose(aw, &err)
+	for _, entry := range entries {
+		switch x := entry.(type) {
+		case fs.Directory:
+			err = aw.addDir(ctx, x)
+		case fs.Object:
+			if x.Size() < 0 && format != libarchive.FormatZip {
+				fs.Errorf(x, "Skipping file of unknown size as it can't be stored in a tar archive")
+				continue
+			}
+			err = addObject(ctx, aw, x)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addObject adds the object o to the archive
+func addObject(ctx context.Context, aw archiveWriter, o fs.Object) (err error) {
+	tr := accounting.Stats(ctx).NewCheckingTransfer(o, "archiving")
+	defer func() {
+		tr.Done(ctx, err)
+	}()
+	in, err := operations.Open(ctx, o)
+	if err != nil {
+		return fmt.Errorf("failed to open %q: %w", o.Remote(), err)
+	}
+	defer fs.CheckClose(in, &err)
+	return aw.addFile(ctx, o, in)
+}
+
+// getMetadata returns the metadata of the entry if --metadata is set
+func getMetadata(ctx context.Context, entry fs.DirEntry) fs.Metadata {
+	if !fs.GetConfig(ctx).Metadata {
+		return nil
+	}
+	meta, err := fs.GetMetadata(ctx, entry)
+	if err != nil {
+		fs.Errorf(entry, "Failed to read metadata: %v", err)
+		return nil
+	}
+	return meta
+}
+
+// parseMode parses the mode from the metadata
+func parseMode(meta fs.Metadata, mode int64) int64 {
+	if s, ok := meta["mode"]; ok {
+		if m, err := strconv.ParseInt(s, 8, 64); err == nil {
+			return m & 07777
+		}
+	}
+	return mode
+}
+
+// tarWriter writes tar archives
+type tarWriter struct {
+	tw *tar.Writer
+	cw io.WriteCloser
+}
+
+// header makes a tar header for the entry from its metadata
+func (w *tarWriter) header(ctx context.Context, entry fs.DirEntry, mode int64) *tar.Header {
+	hdr := &tar.Header{
+		ModTime: entry.ModTime(ctx),
+		Mode:    mode,
+		Format:  tar.FormatPAX,
+	}
+	for k, v := range getMetadata(ctx, entry) {
+		switch k {
+		case "mode":
+			hdr.Mode = parseMode(fs.Metadata{k: v}, mode)
+		case "uid":
+			hdr.Uid, _ = strconv.Atoi(v)
+		case "gid":
+			hdr.Gid, _ = strconv.Atoi(v)
+		case "atime":
+			hdr.AccessTime, _ = time.Parse(time.RFC3339Nano, v)
+		case "mtime":
+			// stored as the modification time
+		default:
+			if hdr.PAXRecords == nil {
+				hdr.PAXRecords = map[string]string{}
+			}
+			hdr.PAXRecords["RCLONE.meta."+k] = v
+		}
+	}
+	return hdr
+}
+
+// addDir adds a directory to the archive
+func (w *tarWriter) addDir(ctx context.Context, d fs.Directory) error {
+	hdr := w.header(ctx, d, 0755)
+	hdr.Typeflag = tar.TypeDir
+	hdr.Name = d.Remote() + "/"
+	return w.tw.WriteHeader(hdr)
+}
+
+// addFile adds a file to the archive
+func (w *tarWriter) addFile(ctx context.Context, o fs.Object, in io.Reader) error {
+	hdr := w.header(ctx, o, 0644)
+	hdr.Typeflag = tar.TypeReg
+	hdr.Name = o.Remote()
+	hdr.Size = o.Size()
+	if err := w.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	n, err := io.Copy(w.tw, in)
+	if err != nil {
+		return fmt.Errorf("failed to archive %q: %w", o.Remote(), err)
+	}
+	if n != hdr.Size {
+		return fmt.Errorf("failed to archive %q: size changed from %d to %d", o.Remote(), hdr.Size, n)
+	}
+	return nil
+}
+
+// Close the archive
+func (w *tarWriter) Close() error {
+	if err := w.tw.Close(); err != nil {
+		return err
+	}
+	return w.cw.Close()
+}
+
+// zipWriter writes zip archives
+type zipWriter struct {
+	zw *zip.Writer
+}
+
+// addDir adds a directory to the archive
+func (w *zipWriter) addDir(ctx context.Context, d fs.Directory) error {
+	hdr := &zip.FileHeader{
+		Name:     d.Remote() + "/",
+		Method:   zip.Store,
+		Modified: d.ModTime(ctx),
+	}
+	hdr.SetMode(os.ModeDir | os.FileMode(parseMode(getMetadata(ctx, d), 0755)))
+	_, err := w.zw.CreateHeader(hdr)
+	return err
+}
+
+// addFile adds a file to the archive
+func (w *zipWriter) addFile(ctx context.Context, o fs.Object, in io.Reader) error {
+	hdr := &zip.FileHeader{
+		Name:     o.Remote(),
+		Method:   zip.Deflate,
+		Modified: o.ModTime(ctx),
+	}
+	hdr.SetMode(os.FileMode(parseMode(getMetadata(ctx, o), 0644)))
+	out, err := w.zw.CreateHeader(hdr)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		return fmt.Errorf("failed to archive %q: %w", o.Remote(), err)
+	}
+	return nil
+}
+
+// Close the archive
+func (w *zipWriter) Close() error {
+	return w.zw.Close()
+}
+
+// check interfaces
+var (
+	_ archiveWriter = (*tarWriter)(nil)
+	_ archiveWriter = (*zipWriter)(nil)
+)
@@ -0,0 +1,232 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/filter"
+	"github.com/rclone/rclone/fs/operations"
+	libarchive "github.com/rclone/rclone/lib/archive"
+	"github.com/spf13/cobra"
+)
+
+var extractCommand = &cobra.Command{
+	Use:   "extract source:path/file.tar.zst dest:path",
+	Short: `Extract the files in an archive to a remote.`,
+	Long: `Extract the files and directories in an archive on the source to
+the destination, for example
+
+    rclone archive extract remote:backups/photos.tar.zst remote:photos
+
+The archive is read as it is extracted, so nothing is staged locally.
+Tar archives are read once from start to end. Zip archives are read
+with ranged reads, starting with the central directory at the end.
+
+Filters can be used to choose which files are extracted. Existing
+files in the destination are overwritten.
+
+The modification times of the files are restored. If ` + "`--metadata`" + `
+is set the metadata stored in tar archives by ` + "`rclone archive create`" + `
+is restored too, along with the mode, owner and access time of files
+in any tar archive.
+`,
+	Annotations: map[string]string{
+		"versionIntroduced": "v1.67",
+	},
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(2, 2, command, args)
+		fsrc, srcFileName := cmd.NewFsFile(args[0])
+		if srcFileName == "" {
+			log.Fatalf("%q is not a file", args[0])
+		}
+		fdst := cmd.NewFsDir(args[1:])
+		cmd.Run(false, true, command, func() error {
+			ctx := context.Background()
+			src, err := fsrc.NewObject(ctx, srcFileName)
+			if err != nil {
+				return err
+			}
+			return Extract(ctx, src, fdst)
+		})
+	},
+}
+
+// Extract extracts the files in the archive src to fdst. The format
+// is chosen from the name of the archive.
+func Extract(ctx context.Context, src fs.Object, fdst fs.Fs) (err error) {
+	format, err := formatOf(src.Remote())
+	if err != nil {
+		return err
+	}
+	if format == libarchive.FormatZip {
+		return extractZip(ctx, src, fdst)
+	}
+	return extractTar(ctx, src, fdst, format)
+}
+
+// extractor creates files and directories in the destination
+type extractor struct {
+	fdst fs.Fs
+	fi   *filter.Filter
+	dirs map[string]time.Time // modification times of directories
+}
+
+// newExtractor makes an extractor for fdst
+func newExtractor(ctx context.Context, fdst fs.Fs) *extractor {
+	return &extractor{
+		fdst: fdst,
+		fi:   filter.GetConfig(ctx),
+		dirs: map[string]time.Time{},
+	}
+}
+
+// dir creates the directory name
+func (e *extractor) dir(ctx context.Context, name string, modTime time.Time) error {
+	if !e.fi.IncludeRemote(name + "/") {
+		return nil
+	}
+	e.dirs[name] = modTime
+	return operations.Mkdir(ctx, e.fdst, name)
+}
+
+// file creates the file name from in
+func (e *extractor) file(ctx context.Context, name string, in io.Reader, size int64, modTime time.Time, meta fs.Metadata) error {
+	if !e.fi.Include(name, size, modTime, meta) {
+		fs.Debugf(name, "Excluded from extract")
+		return nil
+	}
+	_, err := operations.RcatSize(ctx, e.fdst, name, io.NopCloser(in), size, modTime, meta)
+	if err != nil {
+		return fmt.Errorf("failed to extract %q: %w", name, err)
+	}
+	return nil
+}
+
+// finish sets the modification times of the directories now their
+// contents have been written
+func (e *extractor) finish(ctx context.Context) {
+	if !e.fdst.Features().CanHaveEmptyDirectories {
+		return
+	}
+	for name, modTime := range e.dirs {
+		if _, err := operations.SetDirModTime(ctx, e.fdst, nil, name, modTime); err != nil {
+			fs.Debugf(name, "Failed to set directory modification time: %v", err)
+		}
+	}
+}
+
+// tarMetadata returns the metadata stored in a tar header
+func tarMetadata(hdr *tar.Header) fs.Metadata {
+	meta := fs.Metadata{
+		"mode":  strconv.FormatInt(0100000|hdr.Mode&07777, 8),
+		"uid":   strconv.Itoa(hdr.Uid),
+		"gid":   strconv.Itoa(hdr.Gid),
+		"mtime": hdr.ModTime.Format(time.RFC3339Nano),
+	}
+	if !hdr.AccessTime.IsZero() {
+		meta["atime"] = hdr.AccessTime.Format(time.RFC3339Nano)
+	}
+	for k, v := range hdr.PAXRecords {
+		if key, found := strings.CutPrefix(k, "RCLONE.meta."); found {
+			meta[key] = v
+		}
+	}
+	return meta
+}
+
+// extractTar extracts a tar archive reading it from start to end
+func extractTar(ctx context.Context, src fs.Object, fdst fs.Fs, format libarchive.Format) (err error) {
+	in, err := operations.Open(ctx, src)
+	if err != nil {
+		return err
+	}
+	defer fs.CheckClose(in, &err)
+	dr, err := libarchive.Decompress(format, in)
+	if err != nil {
+		return err
+	}
+	defer fs.CheckClose(dr, &err)
+	e := newExtractor(ctx, fdst)
+	tr := tar.NewReader(dr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("failed to read archive: %w", err)
+		}
+		name := libarchive.CleanName(hdr.Name)
+		if name == "" {
+			continue
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = e.dir(ctx, name, hdr.ModTime)
+		case tar.TypeReg:
+			err = e.file(ctx, name, tr, hdr.Size, hdr.ModTime, tarMetadata(hdr))
+		default:
+			fs.Logf(name, "Skipping archive entry of unsupported type %q", hdr.Typeflag)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	e.finish(ctx)
+	return nil
+}
+
+// extractZip extracts a zip archive reading the central directory
+// first
+func extractZip(ctx context.Context, src fs.Object, fdst fs.Fs) (err error) {
+	ra := libarchive.NewReaderAt(ctx, src)
+	defer fs.CheckClose(ra, &err)
+	zr, err := zip.NewReader(ra, src.Size())
+	if err != nil && !errors.Is(err, zip.ErrInsecurePath) {
+		return fmt.Errorf("failed to read archive: %w", err)
+	}
+	libarchive.RegisterZipDecompressors(zr)
+	e := newExtractor(ctx, fdst)
+	for _, zf := range zr.File {
+		name := libarchive.CleanName(zf.Name)
+		if name == "" {
+			continue
+		}
+		switch {
+		case strings.HasSuffix(zf.Name, "/"):
+			err = e.dir(ctx, name, zf.Modified)
+		case zf.Mode().IsRegular():
+			err = extractZipFile(ctx, e, zf, name)
+		default:
+			fs.Logf(name, "Skipping archive entry of unsupported type %v", zf.Mode().Type())
+		}
+		if err != nil {
+			return err
+		}
+	}
+	e.finish(ctx)
+	return nil
+}
+
+// extractZipFile extracts a single file from a zip archive
+func extractZipFile(ctx context.Context, e *extractor, zf *zip.File, name string) (err error) {
+	in, err := zf.Open()
+	if err != nil {
+		return fmt.Errorf("failed to open %q in archive: %w", name, err)
+	}
+	defer fs.CheckClose(in, &err)
+	meta := fs.Metadata{
+		"mode":  strconv.FormatInt(0100000|int64(zf.Mode().Perm()), 8),
+		"mtime": zf.Modified.Format(time.RFC3339Nano),
+	}
+	return e.file(ctx, name, in, int64(zf.UncompressedSize64), zf.Modified, meta)
+}
@@ -36,6 +36,7 @@ import (
 	"github.com/rclone/rclone/fs/rc/rcflags"
 	"github.com/rclone/rclone/fs/rc/rcserver"
 	fssync "github.com/rclone/rclone/fs/sync"
+	libarchive "github.com/rclone/rclone/lib/archive"
 	"github.com/rclone/rclone/lib/atexit"
 	"github.com/rclone/rclone/lib/buildinfo"
 	"github.com/rclone/rclone/lib/exitcode"
@@ -93,7 +94,7 @@ func NewFsFile(remote string) (fs.Fs, string) {
 		err = fs.CountError(err)
 		log.Fatalf("Failed to create file system for %q: %v", remote, err)
 	}
-	f, err := cache.Get(context.Background(), remote)
+	f, err := cache.Get(context.Background(), archiveBrowse(remote))
 	switch err {
 	case fs.ErrorIsFile:
 		cache.Pin(f) // pin indefinitely since it was on the CLI
@@ -108,6 +109,35 @@ func NewFsFile(remote string) (fs.Fs, string) {
 	return nil, ""
 }
 
+// archiveBrowse returns remote wrapped in the archive backend if
+// --archive-browse is set and it points at or inside an archive
+//
+// Other remotes are left alone so they can still be written to.
+func archiveBrowse(remote string) string {
+	if !fs.GetConfig(context.Background()).ArchiveBrowse || !inArchive(remote) {
+		return remote
+	}
+	if _, err := fs.Find("archive"); err != nil {
+		log.Fatalf("Can't use --archive-browse: %v", err)
+	}
+	return `:archive,remote="` + strings.ReplaceAll(remote, `"`, `""`) + `":`
+}
+
+// inArchive returns true if an element of the path of remote looks
+// like an archive
+func inArchive(remote string) bool {
+	_, fsPath, err := fspath.SplitFs(remote)
+	if err != nil {
+		return false
+	}
+	for _, element := range strings.Split(fsPath, "/") {
+		if libarchive.FormatOf(element) != libarchive.FormatNone {
+			return true
+		}
+	}
+	return false
+}
+
 // newFsFileAddFilter creates an src Fs from a name
 //
 // This works the same as NewFsFile however it adds filters to the Fs
@@ -613,6 +613,8 @@ func translateError(err error) (errc int) {
 		return -fuse.EROFS
 	case vfs.ENOSYS, fs.ErrorNotImplemented:
 		return -fuse.ENOSYS
+	case vfs.ENOSPC:
+		return -fuse.ENOSPC
 	case vfs.EINVAL:
 		return -fuse.EINVAL
 	}
@@ -98,6 +98,8 @@ func translateError(err error) error {
 		return fuse.Errno(syscall.EROFS)
 	case vfs.ENOSYS, fs.ErrorNotImplemented:
 		return syscall.ENOSYS
+	case vfs.ENOSPC:
+		return fuse.Errno(syscall.ENOSPC)
 	case vfs.EINVAL:
 		return fuse.Errno(syscall.EINVAL)
 	}
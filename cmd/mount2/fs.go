@@ -125,6 +125,8 @@ func translateError(err error) syscall.Errno {
 		return syscall.EROFS
 	case vfs.ENOSYS, fs.ErrorNotImplemented:
 		return syscall.ENOSYS
+	case vfs.ENOSPC:
+		return syscall.ENOSPC
 	case vfs.EINVAL:
 		return syscall.EINVAL
 	}
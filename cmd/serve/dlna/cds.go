@@ -14,11 +14,13 @@ import (
 	"path"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/anacrolix/dms/dlna"
 	"github.com/anacrolix/dms/upnp"
 	"github.com/rclone/rclone/cmd/serve/dlna/upnpav"
+	"github.com/rclone/rclone/cmd/serve/media"
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/vfs"
 )
@@ -57,20 +59,7 @@ func (cds *contentDirectoryService) cdsObjectToUpnpavObject(cdsObject object, fi
 		return
 	}
 
-	// Read the mime type from the fs.Object if possible,
-	// otherwise fall back to working out what it is from the file path.
-	var mimeType string
-	if o, ok := fileInfo.DirEntry().(fs.Object); ok {
-		mimeType = fs.MimeType(context.TODO(), o)
-		// If backend doesn't know what the mime type is then
-		// try getting it from the file name
-		if mimeType == "application/octet-stream" {
-			mimeType = fs.MimeTypeFromName(fileInfo.Name())
-		}
-	} else {
-		mimeType = fs.MimeTypeFromName(fileInfo.Name())
-	}
-
+	mimeType := media.MimeType(context.TODO(), fileInfo)
 	mediaType := mediaMimeTypeRegexp.FindStringSubmatch(mimeType)
 	if mediaType == nil {
 		return
@@ -80,23 +69,46 @@ func (cds *contentDirectoryService) cdsObjectToUpnpavObject(cdsObject object, fi
 	obj.Title = fileInfo.Name()
 	obj.Date = upnpav.Timestamp{Time: fileInfo.ModTime()}
 
+	resURL := &url.URL{
+		Scheme: "http",
+		Host:   host,
+		Path:   path.Join(resPath, cdsObject.Path),
+	}
+	var thumbURL string
+	if cds.media.CanThumbnail(mimeType) {
+		thumbURL = withQuery(resURL, "thumb="+strconv.Itoa(media.DefaultThumbnailSize))
+		obj.AlbumArtURI = thumbURL
+	}
+
 	item := upnpav.Item{
 		Object: obj,
 		Res:    make([]upnpav.Resource, 0, 1),
 	}
 
 	item.Res = append(item.Res, upnpav.Resource{
-		URL: (&url.URL{
-			Scheme: "http",
-			Host:   host,
-			Path:   path.Join(resPath, cdsObject.Path),
-		}).String(),
+		URL: resURL.String(),
 		ProtocolInfo: fmt.Sprintf("http-get:*:%s:%s", mimeType, dlna.ContentFeatures{
 			SupportRange: true,
 		}.String()),
 		Size: uint64(fileInfo.Size()),
 	})
 
+	if thumbURL != "" {
+		item.Res = append(item.Res, upnpav.Resource{
+			URL:          thumbURL,
+			ProtocolInfo: "http-get:*:image/jpeg:DLNA.ORG_PN=JPEG_TN",
+		})
+	}
+
+	if cds.media.CanTranscode(mimeType) {
+		item.Res = append(item.Res, upnpav.Resource{
+			URL: withQuery(resURL, "transcode=1"),
+			ProtocolInfo: fmt.Sprintf("http-get:*:%s:%s", cds.media.TranscodeMimeType(), dlna.ContentFeatures{
+				Transcoded: true,
+			}.String()),
+		})
+	}
+
 	for _, resource := range resources {
 		subtitleURL := (&url.URL{
 			Scheme: "http",
@@ -113,6 +125,13 @@ func (cds *contentDirectoryService) cdsObjectToUpnpavObject(cdsObject object, fi
 	return
 }
 
+// Returns u as a string with the query set to rawQuery.
+func withQuery(u *url.URL, rawQuery string) string {
+	withQuery := *u
+	withQuery.RawQuery = rawQuery
+	return withQuery.String()
+}
+
 // Returns all the upnpav objects in a directory.
 func (cds *contentDirectoryService) readContainer(o object, host string) (ret []interface{}, err error) {
 	node, err := cds.vfs.Stat(o.Path)
@@ -10,7 +10,6 @@ import (
 	"net"
 	"net/http"
 	"net/url"
-	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -23,6 +22,7 @@ import (
 	"github.com/rclone/rclone/cmd"
 	"github.com/rclone/rclone/cmd/serve/dlna/data"
 	"github.com/rclone/rclone/cmd/serve/dlna/dlnaflags"
+	"github.com/rclone/rclone/cmd/serve/media"
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/lib/systemd"
 	"github.com/rclone/rclone/vfs"
@@ -32,6 +32,7 @@ import (
 
 func init() {
 	dlnaflags.AddFlags(Command.Flags())
+	media.AddFlags(Command.Flags())
 	vfsflags.AddFlags(Command.Flags())
 }
 
@@ -46,11 +47,15 @@ supported. Service discovery uses UDP multicast packets (SSDP) and
 will thus only work on LANs.
 
 Rclone will list all files present in the remote, without filtering
-based on media formats or file extensions. Additionally, there is no
-media transcoding support. This means that some players might show
-files that they are not able to play back correctly.
+based on media formats or file extensions. This means that some players
+might show files that they are not able to play back correctly.
 
-` + dlnaflags.Help + vfs.Help(),
+If ` + "`--thumbnails`" + ` is set images are listed with a JPEG thumbnail as
+their album art. If ` + "`--transcode-command`" + ` is set videos are also
+offered transcoded by that command, which players can choose if they
+can't play the original format.
+
+` + dlnaflags.Help + media.Help + vfs.Help(),
 	Annotations: map[string]string{
 		"versionIntroduced": "v1.46",
 		"groups":            "Filter",
@@ -101,8 +106,9 @@ type server struct {
 	// Time interval between SSPD announces
 	AnnounceInterval time.Duration
 
-	f   fs.Fs
-	vfs *vfs.VFS
+	f     fs.Fs
+	vfs   *vfs.VFS
+	media *media.Service // for thumbnails and transcoding
 }
 
 func newServer(f fs.Fs, opt *dlnaflags.Options) (*server, error) {
@@ -135,6 +141,7 @@ func newServer(f fs.Fs, opt *dlnaflags.Options) (*server, error) {
 		httpListenAddr:   opt.ListenAddr,
 		f:                f,
 		vfs:              vfs.New(f, &vfsflags.Opt),
+		media:            media.New(&media.Opt),
 	}
 
 	s.services = map[string]UPnPService{
@@ -252,7 +259,8 @@ func (s *server) soapActionResponse(sa upnp.SoapAction, actionRequestXML []byte,
 	return service.Handle(sa.Action, actionRequestXML, r)
 }
 
-// Serves actual resources (media files).
+// Serves actual resources (media files), or their thumbnails or
+// transcoded versions.
 func (s *server) resourceHandler(w http.ResponseWriter, r *http.Request) {
 	remotePath := r.URL.Path
 	node, err := s.vfs.Stat(r.URL.Path)
@@ -260,19 +268,37 @@ func (s *server) resourceHandler(w http.ResponseWriter, r *http.Request) {
 		http.NotFound(w, r)
 		return
 	}
+	VFS := s.vfs.Session(vfs.AuditInfo{
+		Protocol:   "dlna",
+		RemoteAddr: r.RemoteAddr,
+	})
+
+	query := r.URL.Query()
+	if query.Has("thumb") {
+		s.media.ServeThumbnail(w, r, VFS, node)
+		return
+	}
+	transcode := query.Has("transcode")
 
-	w.Header().Set("Content-Length", strconv.FormatInt(node.Size(), 10))
+	if !transcode {
+		w.Header().Set("Content-Length", strconv.FormatInt(node.Size(), 10))
+	}
 
 	// add some DLNA specific headers
 	if r.Header.Get("getContentFeatures.dlna.org") != "" {
 		w.Header().Set("contentFeatures.dlna.org", dms_dlna.ContentFeatures{
-			SupportRange: true,
+			SupportRange: !transcode,
+			Transcoded:   transcode,
 		}.String())
 	}
 	w.Header().Set("transferMode.dlna.org", "Streaming")
 
-	file := node.(*vfs.File)
-	in, err := file.Open(os.O_RDONLY)
+	if transcode {
+		s.media.ServeTranscode(w, r, VFS, node)
+		return
+	}
+
+	in, err := VFS.Open(remotePath)
 	if err != nil {
 		serveError(node, w, "Could not open resource", err)
 		return
@@ -7,19 +7,25 @@ import (
 	"context"
 	"fmt"
 	"html"
+	"image"
+	"image/jpeg"
+	"image/png"
 	"io"
 	"net/http"
 	"os"
+	"runtime"
 	"strings"
 	"testing"
 
 	"github.com/anacrolix/dms/soap"
 
+	"github.com/rclone/rclone/fs/config"
 	"github.com/rclone/rclone/fs/config/configfile"
 	"github.com/rclone/rclone/vfs"
 
 	_ "github.com/rclone/rclone/backend/local"
 	"github.com/rclone/rclone/cmd/serve/dlna/dlnaflags"
+	"github.com/rclone/rclone/cmd/serve/media"
 	"github.com/rclone/rclone/fs"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -209,3 +215,87 @@ func TestContentDirectoryBrowseDirectChildren(t *testing.T) {
 	require.Contains(t, string(body), "/r/subdir/video.mp4")
 	require.Contains(t, string(body), "/r/subdir/video.srt")
 }
+
+// Check that thumbnails and transcoded videos are offered and served.
+func TestThumbnailsAndTranscoding(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs cat")
+	}
+	oldCacheDir := config.GetCacheDir()
+	require.NoError(t, config.SetCacheDir(t.TempDir()))
+	defer func() {
+		_ = config.SetCacheDir(oldCacheDir)
+	}()
+
+	dir := t.TempDir()
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, image.NewGray(image.Rect(0, 0, 320, 200))))
+	require.NoError(t, os.WriteFile(dir+"/image.png", buf.Bytes(), 0666))
+	require.NoError(t, os.WriteFile(dir+"/video.mp4", []byte("video data"), 0666))
+	f, err := fs.NewFs(context.Background(), dir)
+	require.NoError(t, err)
+
+	opt := dlnaflags.DefaultOpt
+	opt.ListenAddr = testBindAddress
+	s, err := newServer(f, &opt)
+	require.NoError(t, err)
+	s.media = media.New(&media.Options{
+		Thumbnails:        true,
+		TranscodeCommand:  fs.SpaceSepList{"cat"},
+		TranscodeMimeType: "video/mp2t",
+	})
+	require.NoError(t, s.Serve())
+	defer s.Close()
+	testURL := "http://" + s.HTTPConn.Addr().String()
+
+	req, err := http.NewRequest("POST", testURL+serviceControlURL, strings.NewReader(`
+<?xml version="1.0" encoding="utf-8"?>
+<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"
+            s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">
+    <s:Body>
+        <u:Browse xmlns:u="urn:schemas-upnp-org:service:ContentDirectory:1">
+            <ObjectID>0</ObjectID>
+            <BrowseFlag>BrowseDirectChildren</BrowseFlag>
+            <Filter>*</Filter>
+            <StartingIndex>0</StartingIndex>
+            <RequestedCount>0</RequestedCount>
+            <SortCriteria></SortCriteria>
+        </u:Browse>
+    </s:Body>
+</s:Envelope>`))
+	require.NoError(t, err)
+	req.Header.Set("SOAPACTION", `"urn:schemas-upnp-org:service:ContentDirectory:1#Browse"`)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	// expect the thumbnail as album art and a resource and the transcoded video
+	require.Contains(t, string(body), html.EscapeString("<upnp:albumArtURI>"+testURL+"/r/image.png?thumb=160</upnp:albumArtURI>"))
+	require.Contains(t, string(body), html.EscapeString(`protocolInfo="http-get:*:image/jpeg:DLNA.ORG_PN=JPEG_TN"`))
+	require.Contains(t, string(body), html.EscapeString(`protocolInfo="http-get:*:video/mp2t:DLNA.ORG_OP=00;DLNA.ORG_CI=1;`))
+	require.Contains(t, string(body), "/r/video.mp4?transcode=1")
+
+	// The thumbnail is a JPEG
+	resp, err = http.Get(testURL + resPath + "image.png?thumb=160")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "image/jpeg", resp.Header.Get("Content-Type"))
+	thumb, err := jpeg.DecodeConfig(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, 160, thumb.Width)
+	assert.Equal(t, 100, thumb.Height)
+
+	// cat transcodes the video to itself
+	resp, err = http.Get(testURL + resPath + "video.mp4?transcode=1")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "video/mp2t", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "Streaming", resp.Header.Get("transferMode.dlna.org"))
+	got, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, "video data", string(got))
+}
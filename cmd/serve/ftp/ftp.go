@@ -106,7 +106,7 @@ You can set a single username and password with the --user and --pass flags.
 	},
 	Run: func(command *cobra.Command, args []string) {
 		var f fs.Fs
-		if proxyflags.Opt.AuthProxy == "" {
+		if !proxyflags.Opt.Enabled() {
 			cmd.CheckArgs(1, 1, command, args)
 			f = cmd.NewFsSrc(args)
 		} else {
@@ -153,7 +153,7 @@ func newServer(ctx context.Context, f fs.Fs, opt *Options) (*driver, error) {
 		ctx: ctx,
 		opt: *opt,
 	}
-	if proxyflags.Opt.AuthProxy != "" {
+	if proxyflags.Opt.Enabled() {
 		d.proxy = proxy.New(ctx, &proxyflags.Opt)
 		d.userPass = make(map[string]string, 16)
 	} else {
@@ -260,10 +260,15 @@ func (d *driver) CheckPasswd(sctx *ftp.Context, user, pass string) (ok bool, err
 }
 
 // Get the VFS for this connection
-func (d *driver) getVFS(sctx *ftp.Context) (VFS *vfs.VFS, err error) {
+func (d *driver) getVFS(sctx *ftp.Context) (VFS *vfs.Session, err error) {
+	info := vfs.AuditInfo{
+		User:       sctx.Sess.LoginUser(),
+		Protocol:   "ftp",
+		RemoteAddr: sctx.Sess.RemoteAddr().String(),
+	}
 	if d.proxy == nil {
 		// If no proxy always use the same VFS
-		return d.globalVFS, nil
+		return d.globalVFS.Session(info), nil
 	}
 	user := sctx.Sess.LoginUser()
 	d.userPassMu.Lock()
@@ -276,11 +281,11 @@ func (d *driver) getVFS(sctx *ftp.Context) (VFS *vfs.VFS, err error) {
 	if err != nil {
 		return nil, err
 	}
-	VFS, _, err = d.proxy.Call(user, pass, false)
+	userVFS, _, err := d.proxy.Call(user, pass, false)
 	if err != nil {
 		return nil, fmt.Errorf("proxy login failed: %w", err)
 	}
-	return VFS, nil
+	return userVFS.Session(info), nil
 }
 
 // Stat get information on file or folder
@@ -366,11 +371,7 @@ func (d *driver) DeleteDir(sctx *ftp.Context, path string) (err error) {
 	if !node.IsDir() {
 		return errors.New("not a directory")
 	}
-	err = node.Remove()
-	if err != nil {
-		return err
-	}
-	return nil
+	return VFS.Remove(path)
 }
 
 // DeleteFile delete a file
@@ -387,11 +388,7 @@ func (d *driver) DeleteFile(sctx *ftp.Context, path string) (err error) {
 	if !node.IsFile() {
 		return errors.New("not a file")
 	}
-	err = node.Remove()
-	if err != nil {
-		return err
-	}
-	return nil
+	return VFS.Remove(path)
 }
 
 // Rename rename a file or folder
@@ -411,12 +408,7 @@ func (d *driver) MakeDir(sctx *ftp.Context, path string) (err error) {
 	if err != nil {
 		return err
 	}
-	dir, leaf, err := VFS.StatParent(path)
-	if err != nil {
-		return err
-	}
-	_, err = dir.Mkdir(leaf)
-	return err
+	return VFS.Mkdir(path, 0777)
 }
 
 // GetFile download a file
@@ -437,7 +429,7 @@ func (d *driver) GetFile(sctx *ftp.Context, path string, offset int64) (size int
 		return 0, nil, errors.New("not a file")
 	}
 
-	handle, err := node.Open(os.O_RDONLY)
+	handle, err := VFS.Open(path)
 	if err != nil {
 		return 0, nil, err
 	}
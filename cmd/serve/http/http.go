@@ -8,7 +8,7 @@ import (
 	"io"
 	"log"
 	"net/http"
-	"os"
+	"net/url"
 	"path"
 	"strconv"
 	"strings"
@@ -16,10 +16,12 @@ import (
 
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/cmd/serve/media"
 	"github.com/rclone/rclone/cmd/serve/proxy"
 	"github.com/rclone/rclone/cmd/serve/proxy/proxyflags"
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/config/flags"
 	libhttp "github.com/rclone/rclone/lib/http"
 	"github.com/rclone/rclone/lib/http/serve"
 	"github.com/rclone/rclone/lib/systemd"
@@ -30,9 +32,11 @@ import (
 
 // Options required for http server
 type Options struct {
-	Auth     libhttp.AuthConfig
-	HTTP     libhttp.Config
-	Template libhttp.TemplateConfig
+	Auth       libhttp.AuthConfig
+	HTTP       libhttp.Config
+	Template   libhttp.TemplateConfig
+	Share      libhttp.ShareConfig
+	AllowWrite bool // allow uploads, deletes, mkdir and renames
 }
 
 // DefaultOpt is the default values used for Options
@@ -40,6 +44,7 @@ var DefaultOpt = Options{
 	Auth:     libhttp.DefaultAuthCfg(),
 	HTTP:     libhttp.DefaultCfg(),
 	Template: libhttp.DefaultTemplateCfg(),
+	Share:    libhttp.DefaultShareCfg(),
 }
 
 // Opt is options set by command line flags
@@ -54,6 +59,9 @@ func init() {
 	libhttp.AddAuthFlagsPrefix(flagSet, flagPrefix, &Opt.Auth)
 	libhttp.AddHTTPFlagsPrefix(flagSet, flagPrefix, &Opt.HTTP)
 	libhttp.AddTemplateFlagsPrefix(flagSet, flagPrefix, &Opt.Template)
+	libhttp.AddShareFlagsPrefix(flagSet, flagPrefix, &Opt.Share)
+	flags.BoolVarP(flagSet, &Opt.AllowWrite, "allow-write", "", false, "Allow uploading, deleting, renaming and making directories", "")
+	media.AddFlags(flagSet)
 	vfsflags.AddFlags(flagSet)
 	proxyflags.AddFlags(flagSet)
 }
@@ -74,14 +82,60 @@ The server will log errors.  Use ` + "`-v`" + ` to see access logs.
 ` + "`--bwlimit`" + ` will be respected for file transfers.  Use ` + "`--stats`" + ` to
 control the stats printing.
 
-` + libhttp.Help(flagPrefix) + libhttp.TemplateHelp(flagPrefix) + libhttp.AuthHelp(flagPrefix) + vfs.Help() + proxy.Help,
+### Uploads
+
+By default the server is read only. Use ` + "`--allow-write`" + ` to allow
+files to be uploaded, deleted and renamed and directories to be made
+and deleted. The directory listings then let files be dragged and
+dropped in to upload them, or chosen with a button, and have buttons
+to make directories and delete and rename entries.
+
+The server also accepts these requests, e.g. from ` + "`curl`" + `:
+
+- ` + "`PUT /path/to/file`" + ` with the contents of the file in the body
+  to upload it.
+- ` + "`DELETE /path/to/file`" + ` or ` + "`DELETE /path/to/dir/`" + ` to delete a
+  file or an empty directory.
+- ` + "`POST /path/to/dir/`" + ` with a ` + "`multipart/form-data`" + ` body
+  to upload the files in it to the directory.
+- ` + "`POST`" + ` with an ` + "`action`" + ` form field of ` + "`mkdir`" + ` with a
+  ` + "`name`" + ` field to make a directory in the directory posted to,
+  ` + "`delete`" + ` to delete the file or directory posted to or
+  ` + "`rename`" + ` with a ` + "`to`" + ` field to rename it. ` + "`to`" + ` is
+  relative to the directory the file or directory is in.
+
+For example
+
+    curl -T file.txt http://localhost:8080/dir/file.txt
+    curl -F file=@file.txt http://localhost:8080/dir/
+    curl -d action=rename -d to=new.txt http://localhost:8080/dir/file.txt
+    curl -X DELETE http://localhost:8080/dir/new.txt
+
+Requests from web pages on other sites are refused.
+
+Writes are done through the VFS so respect ` + "`--read-only`" + ` and the VFS
+flags below. Set up authentication with the flags below before
+allowing writes. With ` + "`--auth-proxy` or `--users-file`" + ` each user writes
+to their own backend.
+
+### Thumbnail and transcode URLs
+
+If ` + "`--thumbnails`" + ` is set then a JPEG thumbnail of an image can be
+fetched by adding ` + "`?thumb=`" + ` to its URL, optionally with the size in
+pixels of the square it should fit in, e.g. ` + "`/photos/cat.jpg?thumb=320`" + `.
+The default size is 160 and the largest is 1024.
+
+If ` + "`--transcode-command`" + ` is set then videos can be fetched transcoded by
+adding ` + "`?transcode=1`" + ` to their URL.
+
+` + media.Help + libhttp.Help(flagPrefix) + libhttp.TemplateHelp(flagPrefix) + libhttp.AuthHelp(flagPrefix) + libhttp.ShareHelp(flagPrefix) + vfs.Help() + proxy.Help,
 	Annotations: map[string]string{
 		"versionIntroduced": "v1.39",
 		"groups":            "Filter",
 	},
 	Run: func(command *cobra.Command, args []string) {
 		var f fs.Fs
-		if proxyflags.Opt.AuthProxy == "" {
+		if !proxyflags.Opt.Enabled() {
 			cmd.CheckArgs(1, 1, command, args)
 			f = cmd.NewFsSrc(args)
 		} else {
@@ -108,23 +162,30 @@ type HTTP struct {
 	server *libhttp.Server
 	opt    Options
 	proxy  *proxy.Proxy
+	media  *media.Service  // for thumbnails and transcoding
 	ctx    context.Context // for global config
 }
 
 // Gets the VFS in use for this request
-func (s *HTTP) getVFS(ctx context.Context) (VFS *vfs.VFS, err error) {
+func (s *HTTP) getVFS(r *http.Request) (VFS *vfs.Session, err error) {
+	user, _ := libhttp.CtxGetUser(r.Context())
+	info := vfs.AuditInfo{
+		User:       user,
+		Protocol:   "http",
+		RemoteAddr: r.RemoteAddr,
+	}
 	if s._vfs != nil {
-		return s._vfs, nil
+		return s._vfs.Session(info), nil
 	}
-	value := libhttp.CtxGetAuth(ctx)
+	value := libhttp.CtxGetAuth(r.Context())
 	if value == nil {
 		return nil, errors.New("no VFS found in context")
 	}
-	VFS, ok := value.(*vfs.VFS)
+	userVFS, ok := value.(*vfs.VFS)
 	if !ok {
 		return nil, fmt.Errorf("context value is not VFS: %#v", value)
 	}
-	return VFS, nil
+	return userVFS.Session(info), nil
 }
 
 // auth does proxy authorization
@@ -138,12 +199,16 @@ func (s *HTTP) auth(user, pass string) (value interface{}, err error) {
 
 func run(ctx context.Context, f fs.Fs, opt Options) (s *HTTP, err error) {
 	s = &HTTP{
-		f:   f,
-		ctx: ctx,
-		opt: opt,
+		f:     f,
+		ctx:   ctx,
+		opt:   opt,
+		media: media.New(&media.Opt),
 	}
 
-	if proxyflags.Opt.AuthProxy != "" {
+	if proxyflags.Opt.Enabled() {
+		if opt.Share.Secret != "" {
+			return nil, errors.New("can't use --share-secret with --auth-proxy or --users-file")
+		}
 		s.proxy = proxy.New(ctx, &proxyflags.Opt)
 		// override auth
 		s.opt.Auth.CustomAuthFn = s.auth
@@ -155,6 +220,7 @@ func run(ctx context.Context, f fs.Fs, opt Options) (s *HTTP, err error) {
 		libhttp.WithConfig(s.opt.HTTP),
 		libhttp.WithAuth(s.opt.Auth),
 		libhttp.WithTemplate(s.opt.Template),
+		libhttp.WithShare(s.opt.Share),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to init server: %w", err)
@@ -167,6 +233,11 @@ func run(ctx context.Context, f fs.Fs, opt Options) (s *HTTP, err error) {
 	)
 	router.Get("/*", s.handler)
 	router.Head("/*", s.handler)
+	if s.opt.AllowWrite {
+		router.Post("/*", s.handlePost)
+		router.Put("/*", s.handlePut)
+		router.Delete("/*", s.handleDelete)
+	}
 
 	s.server.Serve()
 
@@ -186,7 +257,7 @@ func (s *HTTP) handler(w http.ResponseWriter, r *http.Request) {
 
 // serveDir serves a directory index at dirRemote
 func (s *HTTP) serveDir(w http.ResponseWriter, r *http.Request, dirRemote string) {
-	VFS, err := s.getVFS(r.Context())
+	VFS, err := s.getVFS(r)
 	if err != nil {
 		http.Error(w, "Root directory not found", http.StatusNotFound)
 		fs.Errorf(nil, "Failed to serve directory: %v", err)
@@ -214,6 +285,10 @@ func (s *HTTP) serveDir(w http.ResponseWriter, r *http.Request, dirRemote string
 
 	// Make the entries for display
 	directory := serve.NewDirectory(dirRemote, s.server.HTMLTemplate())
+	directory.Writable = s.opt.AllowWrite && !VFS.Opt.ReadOnly && !libhttp.IsShared(r)
+	if token, ok := libhttp.CtxGetShare(r.Context()); ok {
+		directory.SetQuery(url.Values{libhttp.ShareParam: {token}})
+	}
 	for _, node := range dirEntries {
 		if vfsflags.Opt.NoModTime {
 			directory.AddHTMLEntry(node.Path(), node.IsDir(), node.Size(), time.Time{})
@@ -234,7 +309,7 @@ func (s *HTTP) serveDir(w http.ResponseWriter, r *http.Request, dirRemote string
 
 // serveFile serves a file object at remote
 func (s *HTTP) serveFile(w http.ResponseWriter, r *http.Request, remote string) {
-	VFS, err := s.getVFS(r.Context())
+	VFS, err := s.getVFS(r)
 	if err != nil {
 		http.Error(w, "File not found", http.StatusNotFound)
 		fs.Errorf(nil, "Failed to serve file: %v", err)
@@ -262,6 +337,15 @@ func (s *HTTP) serveFile(w http.ResponseWriter, r *http.Request, remote string)
 	obj := entry.(fs.Object)
 	file := node.(*vfs.File)
 
+	// Serve a thumbnail or transcoded video if asked for
+	if query := r.URL.Query(); query.Has("thumb") {
+		s.media.ServeThumbnail(w, r, VFS, node)
+		return
+	} else if query.Has("transcode") {
+		s.media.ServeTranscode(w, r, VFS, node)
+		return
+	}
+
 	// Set content length if we know how long the object is
 	knownSize := obj.Size() >= 0
 	if knownSize {
@@ -285,7 +369,7 @@ func (s *HTTP) serveFile(w http.ResponseWriter, r *http.Request, remote string)
 	}
 
 	// open the object
-	in, err := file.Open(os.O_RDONLY)
+	in, err := VFS.Open(remote)
 	if err != nil {
 		serve.Error(remote, w, "Failed to open file", err)
 		return
@@ -1,10 +1,16 @@
 package http
 
 import (
+	"bytes"
 	"context"
 	"flag"
+	"image"
+	"image/jpeg"
+	"image/png"
 	"io"
+	"mime/multipart"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
@@ -12,10 +18,13 @@ import (
 	"time"
 
 	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/cmd/serve/media"
 	"github.com/rclone/rclone/cmd/serve/proxy/proxyflags"
 	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config"
 	"github.com/rclone/rclone/fs/filter"
 	libhttp "github.com/rclone/rclone/lib/http"
+	"github.com/rclone/rclone/vfs/vfsflags"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -32,12 +41,16 @@ const (
 )
 
 func start(ctx context.Context, t *testing.T, f fs.Fs) (s *HTTP, testURL string) {
-	opts := Options{
-		HTTP: libhttp.DefaultCfg(),
+	return startOpt(ctx, t, f, Options{
 		Template: libhttp.TemplateConfig{
 			Path: testTemplate,
 		},
-	}
+	})
+}
+
+// startOpt starts a server with the HTTP and Auth options set for testing
+func startOpt(ctx context.Context, t *testing.T, f fs.Fs, opts Options) (s *HTTP, testURL string) {
+	opts.HTTP = libhttp.DefaultCfg()
 	opts.HTTP.ListenAddr = []string{testBindAddress}
 	if proxyflags.Opt.AuthProxy == "" {
 		opts.Auth.BasicUser = testUser
@@ -267,3 +280,241 @@ func TestGET(t *testing.T) {
 func TestAuthProxy(t *testing.T) {
 	testGET(t, true)
 }
+
+// startWrite starts a server allowing writes to a temporary directory
+func startWrite(t *testing.T) (dir string, testURL string) {
+	ctx := context.Background()
+	dir = t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0777))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "old.txt"), []byte("old"), 0666))
+	f, err := fs.NewFs(ctx, dir)
+	require.NoError(t, err)
+	s, testURL := startOpt(ctx, t, f, Options{AllowWrite: true})
+	t.Cleanup(func() {
+		assert.NoError(t, s.server.Shutdown())
+	})
+	return dir, testURL
+}
+
+// do makes a request returning the status and body
+func do(t *testing.T, method, target, contentType string, body io.Reader, headers ...string) (int, string) {
+	req, err := http.NewRequest(method, target, body)
+	require.NoError(t, err)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	req.SetBasicAuth(testUser, testPass)
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	return resp.StatusCode, string(data)
+}
+
+// form posts the url encoded values to target
+func form(t *testing.T, target string, values url.Values) (int, string) {
+	return do(t, "POST", target, "application/x-www-form-urlencoded", strings.NewReader(values.Encode()))
+}
+
+func readFile(t *testing.T, name string) string {
+	data, err := os.ReadFile(name)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestWrite(t *testing.T) {
+	dir, testURL := startWrite(t)
+
+	// the listing offers uploads
+	status, body := do(t, "GET", testURL+"sub/", "", nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, "Upload files")
+	assert.Contains(t, body, `data-url="old.txt"`)
+
+	// PUT
+	status, _ = do(t, "PUT", testURL+"sub/put.txt", "", strings.NewReader("put"))
+	assert.Equal(t, http.StatusCreated, status)
+	assert.Equal(t, "put", readFile(t, filepath.Join(dir, "sub", "put.txt")))
+	status, _ = do(t, "PUT", testURL+"sub/put.txt", "", strings.NewReader("put2"))
+	assert.Equal(t, http.StatusNoContent, status)
+	assert.Equal(t, "put2", readFile(t, filepath.Join(dir, "sub", "put.txt")))
+	status, _ = do(t, "PUT", testURL+"nodir/put.txt", "", strings.NewReader("put"))
+	assert.Equal(t, http.StatusNotFound, status)
+
+	// multipart upload
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for _, name := range []string{"a.txt", "b.txt"} {
+		w, err := mw.CreateFormFile("file", name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte("contents of " + name))
+		require.NoError(t, err)
+	}
+	require.NoError(t, mw.Close())
+	status, _ = do(t, "POST", testURL+"sub/", mw.FormDataContentType(), &buf)
+	assert.Equal(t, http.StatusSeeOther, status)
+	assert.Equal(t, "contents of a.txt", readFile(t, filepath.Join(dir, "sub", "a.txt")))
+	assert.Equal(t, "contents of b.txt", readFile(t, filepath.Join(dir, "sub", "b.txt")))
+
+	// a failed upload leaves the existing file alone
+	buf.Reset()
+	mw = multipart.NewWriter(&buf)
+	w, err := mw.CreateFormFile("file", "old.txt")
+	require.NoError(t, err)
+	_, err = w.Write([]byte("truncated"))
+	require.NoError(t, err)
+	status, _ = do(t, "POST", testURL+"sub/", mw.FormDataContentType(), &buf)
+	assert.NotEqual(t, http.StatusSeeOther, status)
+	assert.Equal(t, "old", readFile(t, filepath.Join(dir, "sub", "old.txt")))
+	entries, err := os.ReadDir(filepath.Join(dir, "sub"))
+	require.NoError(t, err)
+	assert.Equal(t, 4, len(entries))
+
+	// mkdir
+	status, _ = form(t, testURL+"sub/", url.Values{"action": {"mkdir"}, "name": {"new"}})
+	assert.Equal(t, http.StatusSeeOther, status)
+	assert.DirExists(t, filepath.Join(dir, "sub", "new"))
+	status, _ = form(t, testURL+"sub/", url.Values{"action": {"mkdir"}, "name": {".."}})
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	// rename
+	status, _ = form(t, testURL+"sub/a.txt", url.Values{"action": {"rename"}, "to": {"new/c.txt"}})
+	assert.Equal(t, http.StatusSeeOther, status)
+	assert.Equal(t, "contents of a.txt", readFile(t, filepath.Join(dir, "sub", "new", "c.txt")))
+	assert.NoFileExists(t, filepath.Join(dir, "sub", "a.txt"))
+	status, _ = form(t, testURL+"sub/b.txt", url.Values{"action": {"rename"}, "to": {"../../escape.txt"}})
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	// delete
+	status, _ = form(t, testURL+"sub/b.txt", url.Values{"action": {"delete"}})
+	assert.Equal(t, http.StatusSeeOther, status)
+	assert.NoFileExists(t, filepath.Join(dir, "sub", "b.txt"))
+	status, _ = do(t, "DELETE", testURL+"sub/new/", "", nil)
+	assert.Equal(t, http.StatusConflict, status)
+	status, _ = do(t, "DELETE", testURL+"sub/new/c.txt", "", nil)
+	assert.Equal(t, http.StatusNoContent, status)
+	status, _ = do(t, "DELETE", testURL+"sub/new/", "", nil)
+	assert.Equal(t, http.StatusNoContent, status)
+	assert.NoDirExists(t, filepath.Join(dir, "sub", "new"))
+
+	// requests from other sites are refused
+	status, _ = do(t, "DELETE", testURL+"sub/old.txt", "", nil, "Origin", "https://example.com")
+	assert.Equal(t, http.StatusForbidden, status)
+	assert.FileExists(t, filepath.Join(dir, "sub", "old.txt"))
+}
+
+func TestWriteReadOnly(t *testing.T) {
+	vfsflags.Opt.ReadOnly = true
+	defer func() {
+		vfsflags.Opt.ReadOnly = false
+	}()
+	dir, testURL := startWrite(t)
+
+	status, body := do(t, "GET", testURL+"sub/", "", nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.NotContains(t, body, "Upload files")
+
+	status, _ = do(t, "PUT", testURL+"sub/put.txt", "", strings.NewReader("put"))
+	assert.Equal(t, http.StatusForbidden, status)
+	status, _ = do(t, "DELETE", testURL+"sub/old.txt", "", nil)
+	assert.Equal(t, http.StatusForbidden, status)
+	assert.FileExists(t, filepath.Join(dir, "sub", "old.txt"))
+}
+
+func TestShare(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0777))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "file.txt"), []byte("shared"), 0666))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "private.txt"), []byte("private"), 0666))
+	f, err := fs.NewFs(ctx, dir)
+	require.NoError(t, err)
+	const secret = "0123456789abcdef"
+	s, testURL := startOpt(ctx, t, f, Options{AllowWrite: true, Share: libhttp.ShareConfig{Secret: secret}})
+	defer func() {
+		assert.NoError(t, s.server.Shutdown())
+	}()
+
+	get := func(target string) (int, string) {
+		resp, err := http.Get(target)
+		require.NoError(t, err)
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return resp.StatusCode, string(data)
+	}
+
+	link, err := libhttp.NewShareLink(testURL, secret, "sub/", libhttp.ShareOptions{})
+	require.NoError(t, err)
+	token := link[strings.Index(link, "?share=")+len("?share="):]
+
+	// the listing links keep the token and can't be changed
+	status, body := get(link)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, `href="file.txt?share=`+token+`"`)
+	assert.NotContains(t, body, "Upload files")
+
+	status, body = get(testURL + "sub/file.txt?share=" + token)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "shared", body)
+
+	status, _ = get(testURL + "private.txt?share=" + token)
+	assert.Equal(t, http.StatusForbidden, status)
+	status, _ = get(testURL + "sub/file.txt")
+	assert.Equal(t, http.StatusUnauthorized, status)
+	status, _ = do(t, "DELETE", testURL+"sub/file.txt?share="+token, "", nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, status)
+	assert.FileExists(t, filepath.Join(dir, "sub", "file.txt"))
+}
+
+func TestThumbnail(t *testing.T) {
+	ctx := context.Background()
+	oldCacheDir := config.GetCacheDir()
+	require.NoError(t, config.SetCacheDir(t.TempDir()))
+	oldOpt := media.Opt
+	media.Opt.Thumbnails = true
+	defer func() {
+		media.Opt = oldOpt
+		_ = config.SetCacheDir(oldCacheDir)
+	}()
+
+	dir := t.TempDir()
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, image.NewGray(image.Rect(0, 0, 200, 400))))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "image.png"), buf.Bytes(), 0666))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "file.txt"), []byte("text"), 0666))
+	f, err := fs.NewFs(ctx, dir)
+	require.NoError(t, err)
+	s, testURL := startOpt(ctx, t, f, Options{})
+	defer func() {
+		assert.NoError(t, s.server.Shutdown())
+	}()
+
+	status, body := do(t, "GET", testURL+"image.png?thumb=64", "", nil)
+	require.Equal(t, http.StatusOK, status)
+	thumb, err := jpeg.DecodeConfig(strings.NewReader(body))
+	require.NoError(t, err)
+	assert.Equal(t, 32, thumb.Width)
+	assert.Equal(t, 64, thumb.Height)
+
+	// Without ?thumb the original is served
+	status, body = do(t, "GET", testURL+"image.png", "", nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, buf.String(), body)
+
+	status, _ = do(t, "GET", testURL+"image.png?thumb=2000", "", nil)
+	assert.Equal(t, http.StatusBadRequest, status)
+	status, _ = do(t, "GET", testURL+"file.txt?thumb=", "", nil)
+	assert.Equal(t, http.StatusNotFound, status)
+	status, _ = do(t, "GET", testURL+"image.png?transcode=1", "", nil)
+	assert.Equal(t, http.StatusNotFound, status)
+}
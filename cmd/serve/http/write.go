@@ -0,0 +1,293 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/http/serve"
+	"github.com/rclone/rclone/lib/random"
+	"github.com/rclone/rclone/vfs"
+)
+
+// maxFormValue is the largest form value, other than files, read
+const maxFormValue = 4096
+
+// Actions which can be POSTed
+const (
+	actionUpload = "upload"
+	actionMkdir  = "mkdir"
+	actionDelete = "delete"
+	actionRename = "rename"
+)
+
+// writeError writes the HTTP status for err from the VFS
+func writeError(w http.ResponseWriter, remote string, text string, err error) {
+	var status int
+	switch {
+	case errors.Is(err, vfs.ENOENT):
+		status = http.StatusNotFound
+	case errors.Is(err, vfs.EEXIST), errors.Is(err, vfs.ENOTEMPTY):
+		status = http.StatusConflict
+	case errors.Is(err, vfs.EROFS), errors.Is(err, vfs.EPERM):
+		status = http.StatusForbidden
+	case errors.Is(err, vfs.EINVAL):
+		status = http.StatusBadRequest
+	case errors.Is(err, vfs.ENOSPC):
+		status = http.StatusInsufficientStorage
+	default:
+		serve.Error(remote, w, text, err)
+		return
+	}
+	fs.Infof(remote, "%s: %v", text, err)
+	http.Error(w, fmt.Sprintf("%s: %v.", text, err), status)
+}
+
+// sameOrigin checks the request didn't come from a page on another
+// site, so a page elsewhere can't change files using the credentials
+// stored in the browser.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return r.Header.Get("Sec-Fetch-Site") != "cross-site"
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
+
+// writableVFS returns the VFS for the request if it can be written
+// to, writing an error to w if not
+func (s *HTTP) writableVFS(w http.ResponseWriter, r *http.Request) *vfs.Session {
+	if !sameOrigin(r) {
+		http.Error(w, "Cross origin request denied", http.StatusForbidden)
+		return nil
+	}
+	VFS, err := s.getVFS(r)
+	if err != nil {
+		http.Error(w, "Root directory not found", http.StatusNotFound)
+		fs.Errorf(nil, "Failed to write: %v", err)
+		return nil
+	}
+	if VFS.Opt.ReadOnly {
+		http.Error(w, "Remote is read only", http.StatusForbidden)
+		return nil
+	}
+	return VFS
+}
+
+// checkName checks leaf is a valid name for a new file or directory
+func checkName(leaf string) error {
+	if leaf == "" || leaf == "." || leaf == ".." || strings.ContainsAny(leaf, "/\\") {
+		return fmt.Errorf("invalid name %q: %w", leaf, vfs.EINVAL)
+	}
+	return nil
+}
+
+// upload writes in to the file remote, replacing it if it exists
+//
+// The data is written to a temporary file which is renamed over
+// remote once complete, so a failed upload leaves any existing file
+// alone.
+func upload(VFS *vfs.Session, remote string, in io.Reader) (err error) {
+	dir, leaf := path.Split(remote)
+	tmp := dir + "." + leaf + "." + random.String(8) + ".partial"
+	fd, err := VFS.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(fd, in)
+	closeErr := fd.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = VFS.Rename(tmp, remote)
+	}
+	if err != nil {
+		if removeErr := VFS.Remove(tmp); removeErr != nil {
+			fs.Debugf(tmp, "Failed to remove partial upload: %v", removeErr)
+		}
+		return err
+	}
+	fs.Infof(remote, "Uploaded file")
+	return nil
+}
+
+// handlePut uploads the body of the request to the file at the URL
+func (s *HTTP) handlePut(w http.ResponseWriter, r *http.Request) {
+	VFS := s.writableVFS(w, r)
+	if VFS == nil {
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/") {
+		http.Error(w, "Can't upload to a directory", http.StatusMethodNotAllowed)
+		return
+	}
+	remote := strings.Trim(r.URL.Path, "/")
+	_, existErr := VFS.Stat(remote)
+	if err := upload(VFS, remote, r.Body); err != nil {
+		writeError(w, remote, "Failed to upload file", err)
+		return
+	}
+	if existErr == nil {
+		w.WriteHeader(http.StatusNoContent)
+	} else {
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+// handleDelete removes the file or empty directory at the URL
+func (s *HTTP) handleDelete(w http.ResponseWriter, r *http.Request) {
+	VFS := s.writableVFS(w, r)
+	if VFS == nil {
+		return
+	}
+	remote := strings.Trim(r.URL.Path, "/")
+	if remote == "" {
+		http.Error(w, "Can't remove the root", http.StatusForbidden)
+		return
+	}
+	if err := VFS.Remove(remote); err != nil {
+		writeError(w, remote, "Failed to remove", err)
+		return
+	}
+	fs.Infof(remote, "Removed")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlePost does the action in a form POSTed to the URL
+//
+// Files in a multipart form are uploaded to the directory at the URL.
+// Otherwise the "action" field says what to do - make the directory
+// "name" in the directory at the URL, delete the file or directory at
+// the URL or rename it to "to".
+//
+// When done it redirects to the listing of the directory shown, so it
+// can be used from plain HTML forms.
+func (s *HTTP) handlePost(w http.ResponseWriter, r *http.Request) {
+	VFS := s.writableVFS(w, r)
+	if VFS == nil {
+		return
+	}
+	isDir := strings.HasSuffix(r.URL.Path, "/")
+	remote := strings.Trim(r.URL.Path, "/")
+	form := url.Values{}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		uploaded, err := s.postMultipart(VFS, r, remote, isDir, form)
+		if err != nil {
+			writeError(w, remote, "Failed to upload file", err)
+			return
+		}
+		if uploaded > 0 && form.Get("action") == "" {
+			form.Set("action", actionUpload)
+		}
+	} else {
+		r.Body = http.MaxBytesReader(w, r.Body, maxFormValue)
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+		form = r.PostForm
+	}
+
+	// Where to show when done
+	location := "./"
+	var err error
+	switch action := form.Get("action"); action {
+	case actionUpload:
+	case actionMkdir:
+		name := form.Get("name")
+		if !isDir {
+			err = fmt.Errorf("can't make a directory in a file: %w", vfs.EINVAL)
+		} else if err = checkName(name); err == nil {
+			err = VFS.Mkdir(path.Join(remote, name), 0777)
+		}
+		if err == nil {
+			fs.Infof(path.Join(remote, name), "Made directory")
+		}
+	case actionDelete:
+		if remote == "" {
+			http.Error(w, "Can't remove the root", http.StatusForbidden)
+			return
+		}
+		err = VFS.Remove(remote)
+		if err == nil {
+			fs.Infof(remote, "Removed")
+		}
+		if isDir {
+			location = "../"
+		}
+	case actionRename:
+		newRemote := path.Join(path.Dir(remote), form.Get("to"))
+		switch {
+		case remote == "":
+			http.Error(w, "Can't rename the root", http.StatusForbidden)
+			return
+		case form.Get("to") == "", newRemote == "." || newRemote == ".." || strings.HasPrefix(newRemote, "../"):
+			err = fmt.Errorf("invalid new name %q: %w", form.Get("to"), vfs.EINVAL)
+		default:
+			err = VFS.Rename(remote, newRemote)
+		}
+		if err == nil {
+			fs.Infof(remote, "Renamed to %q", newRemote)
+		}
+		if isDir {
+			location = "../"
+		}
+	default:
+		http.Error(w, fmt.Sprintf("Unknown action %q", action), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		writeError(w, remote, "Failed to "+form.Get("action"), err)
+		return
+	}
+	w.Header().Set("Location", location)
+	w.WriteHeader(http.StatusSeeOther)
+}
+
+// postMultipart uploads the files in the multipart form in r to the
+// directory remote, storing the other fields in form.
+//
+// It returns the number of files uploaded.
+func (s *HTTP) postMultipart(VFS *vfs.Session, r *http.Request, remote string, isDir bool, form url.Values) (uploaded int, err error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return 0, fmt.Errorf("%v: %w", err, vfs.EINVAL)
+	}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return uploaded, nil
+		} else if err != nil {
+			return uploaded, fmt.Errorf("%v: %w", err, vfs.EINVAL)
+		}
+		if part.FileName() == "" {
+			value, err := io.ReadAll(io.LimitReader(part, maxFormValue))
+			if err != nil {
+				return uploaded, err
+			}
+			form.Add(part.FormName(), string(value))
+			continue
+		}
+		if !isDir {
+			return uploaded, fmt.Errorf("can't upload files into a file: %w", vfs.EINVAL)
+		}
+		leaf := part.FileName()
+		if err = checkName(leaf); err != nil {
+			return uploaded, err
+		}
+		if err = upload(VFS, path.Join(remote, leaf), part); err != nil {
+			return uploaded, err
+		}
+		uploaded++
+	}
+}
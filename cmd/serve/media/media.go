@@ -0,0 +1,145 @@
+// Package media makes thumbnails of images and transcodes videos for
+// the serve commands
+package media
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config"
+	"github.com/rclone/rclone/fs/config/flags"
+	"github.com/rclone/rclone/vfs"
+	"github.com/spf13/pflag"
+	"golang.org/x/sync/semaphore"
+	"golang.org/x/sync/singleflight"
+)
+
+// Help contains text describing thumbnails and transcoding
+var Help = `### Thumbnails and transcoding
+
+Use ` + "`--thumbnails`" + ` to make thumbnails of JPEG, PNG and WebP images.
+These are resized in rclone without needing any other programs and are
+stored as JPEG files in the "vfsThumb" directory in rclone's cache
+directory (see ` + "`rclone help flags cache-dir`" + `) so they are only made
+once for each version of an image. This directory can be deleted at
+any time to free up the space. Decoding large images takes a lot of
+memory so only ` + "`--thumbnail-concurrency`" + ` thumbnails are made at once
+with other requests waiting for their turn.
+
+Use ` + "`--transcode-command`" + ` to give a command to convert videos into a
+format the client can play. The video is sent to the command on its
+standard input and it should write the converted video to its standard
+output, with ` + "`--transcode-mime-type`" + ` saying what type that is. The
+name of the video is in the ` + "`RCLONE_TRANSCODE_NAME`" + ` environment
+variable. The command is split into arguments at spaces, and an
+argument containing spaces can be put in double quotes, as with
+` + "`--password-command`" + `. For example with ffmpeg
+
+    --transcode-command "ffmpeg -loglevel error -i pipe:0 -c:v libx264 -c:a aac -f mpegts pipe:1" --transcode-mime-type video/mp2t
+
+Note that the converted video can't be seeked in and that some video
+formats can't be read from a pipe by ffmpeg.
+
+Only ` + "`--transcode-concurrency`" + ` transcode commands are run at once with
+other requests waiting for their turn. Videos can't be transcoded with
+share links as anyone with the link could use up the server's CPU.
+
+`
+
+// Options for thumbnails and transcoding
+type Options struct {
+	Thumbnails           bool            // make thumbnails of images
+	ThumbnailConcurrency int             // max number of thumbnails made at once
+	TranscodeCommand     fs.SpaceSepList // command to transcode videos with, empty for none
+	TranscodeMimeType    string          // the mime type of the output of the transcode command
+	TranscodeConcurrency int             // max number of transcode commands run at once
+}
+
+// DefaultOpt is the default values used for Options
+var DefaultOpt = Options{
+	ThumbnailConcurrency: 2,
+	TranscodeMimeType:    "video/mpeg",
+	TranscodeConcurrency: 2,
+}
+
+// Opt is options set by command line flags
+var Opt = DefaultOpt
+
+// AddFlags adds the flags for thumbnails and transcoding
+func AddFlags(flagSet *pflag.FlagSet) {
+	flags.BoolVarP(flagSet, &Opt.Thumbnails, "thumbnails", "", Opt.Thumbnails, "Make thumbnails of JPEG, PNG and WebP images", "")
+	flags.IntVarP(flagSet, &Opt.ThumbnailConcurrency, "thumbnail-concurrency", "", Opt.ThumbnailConcurrency, "Max number of thumbnails to make at once", "")
+	flags.FVarP(flagSet, &Opt.TranscodeCommand, "transcode-command", "", "Command to transcode videos with from stdin to stdout", "")
+	flags.StringVarP(flagSet, &Opt.TranscodeMimeType, "transcode-mime-type", "", Opt.TranscodeMimeType, "Mime type of the videos made by the transcode command", "")
+	flags.IntVarP(flagSet, &Opt.TranscodeConcurrency, "transcode-concurrency", "", Opt.TranscodeConcurrency, "Max number of transcode commands to run at once", "")
+}
+
+// Service makes thumbnails and transcodes files read from a VFS
+type Service struct {
+	opt          Options
+	cacheDir     string              // where thumbnails are stored
+	group        singleflight.Group  // so each thumbnail is only made once at a time
+	thumbnailSem *semaphore.Weighted // limits the images decoded at once
+	transcodeSem *semaphore.Weighted // limits the transcode commands run at once
+}
+
+// New makes a Service with the options passed in
+func New(opt *Options) *Service {
+	return &Service{
+		opt:          *opt,
+		cacheDir:     filepath.Join(config.GetCacheDir(), "vfsThumb"),
+		thumbnailSem: newSemaphore(opt.ThumbnailConcurrency),
+		transcodeSem: newSemaphore(opt.TranscodeConcurrency),
+	}
+}
+
+// newSemaphore makes a semaphore allowing n at once, or 1 if n is
+// less than that
+func newSemaphore(n int) *semaphore.Weighted {
+	if n < 1 {
+		n = 1
+	}
+	return semaphore.NewWeighted(int64(n))
+}
+
+// MimeType returns the mime type of node, or an empty string if it
+// isn't a file.
+func MimeType(ctx context.Context, node vfs.Node) string {
+	if !node.IsFile() {
+		return ""
+	}
+	// Read the mime type from the fs.Object if possible,
+	// otherwise work out what it is from the file name.
+	if o, ok := node.DirEntry().(fs.Object); ok {
+		if mimeType := fs.MimeType(ctx, o); mimeType != "application/octet-stream" {
+			return mimeType
+		}
+	}
+	return fs.MimeTypeFromName(node.Name())
+}
+
+// CanThumbnail returns true if thumbnails are enabled and one can be
+// made of a file with mimeType.
+func (s *Service) CanThumbnail(mimeType string) bool {
+	if !s.opt.Thumbnails {
+		return false
+	}
+	switch mimeType {
+	case "image/jpeg", "image/png", "image/webp":
+		return true
+	}
+	return false
+}
+
+// CanTranscode returns true if a transcode command is set and the
+// file with mimeType is a video.
+func (s *Service) CanTranscode(mimeType string) bool {
+	return len(s.opt.TranscodeCommand) != 0 && strings.HasPrefix(mimeType, "video/")
+}
+
+// TranscodeMimeType returns the mime type of transcoded videos
+func (s *Service) TranscodeMimeType() string {
+	return s.opt.TranscodeMimeType
+}
@@ -0,0 +1,230 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	libhttp "github.com/rclone/rclone/lib/http"
+	"github.com/rclone/rclone/vfs"
+	"github.com/rclone/rclone/vfs/vfscommon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestService makes a Service with opt caching thumbnails in a
+// temporary directory and a VFS on another one.
+func newTestService(t *testing.T, opt Options) (*Service, string, *vfs.Session) {
+	dir := t.TempDir()
+	f, err := fs.NewFs(context.Background(), dir)
+	require.NoError(t, err)
+	vfsOpt := vfscommon.DefaultOpt
+	v := vfs.New(f, &vfsOpt)
+	t.Cleanup(v.Shutdown)
+	s := New(&opt)
+	s.cacheDir = t.TempDir()
+	return s, dir, v.Session(vfs.AuditInfo{})
+}
+
+// writePNG writes a width x height PNG to path
+func writePNG(t *testing.T, path string, width, height int) {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0666))
+}
+
+func TestCan(t *testing.T) {
+	s := New(&Options{})
+	assert.False(t, s.CanThumbnail("image/png"))
+	assert.False(t, s.CanTranscode("video/mp4"))
+
+	s = New(&Options{Thumbnails: true, TranscodeCommand: fs.SpaceSepList{"cat"}})
+	for mimeType, want := range map[string]bool{
+		"image/jpeg": true,
+		"image/png":  true,
+		"image/webp": true,
+		"image/gif":  false,
+		"video/mp4":  false,
+	} {
+		assert.Equal(t, want, s.CanThumbnail(mimeType), mimeType)
+	}
+	assert.True(t, s.CanTranscode("video/mp4"))
+	assert.False(t, s.CanTranscode("audio/mpeg"))
+}
+
+func TestResize(t *testing.T) {
+	for _, test := range []struct {
+		width, height int
+		size          int
+		wantW, wantH  int
+	}{
+		{400, 200, 160, 160, 80},
+		{200, 400, 160, 80, 160},
+		{100, 50, 160, 100, 50},
+		{2000, 1, 100, 100, 1},
+	} {
+		got := resize(image.NewRGBA(image.Rect(0, 0, test.width, test.height)), test.size)
+		assert.Equal(t, image.Rect(0, 0, test.wantW, test.wantH), got.Bounds())
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	s, dir, VFS := newTestService(t, Options{Thumbnails: true})
+	writePNG(t, filepath.Join(dir, "image.png"), 300, 200)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bad.png"), []byte("not a png"), 0666))
+
+	node, err := VFS.Stat("image.png")
+	require.NoError(t, err)
+	thumb, err := s.Thumbnail(context.Background(), VFS, node, 150)
+	require.NoError(t, err)
+	img, err := jpeg.Decode(bytes.NewReader(thumb))
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 150, 100), img.Bounds())
+
+	// The second time comes from the cache
+	cachePath := s.cachePath(VFS, node, 150)
+	require.NoError(t, os.WriteFile(cachePath, []byte("cached"), 0666))
+	thumb, err = s.Thumbnail(context.Background(), VFS, node, 150)
+	require.NoError(t, err)
+	assert.Equal(t, "cached", string(thumb))
+
+	// Bad sizes and files which aren't images
+	_, err = s.Thumbnail(context.Background(), VFS, node, MaxThumbnailSize+1)
+	assert.Error(t, err)
+	node, err = VFS.Stat("bad.png")
+	require.NoError(t, err)
+	_, err = s.Thumbnail(context.Background(), VFS, node, 150)
+	assert.Error(t, err)
+}
+
+func TestServeThumbnail(t *testing.T) {
+	s, dir, VFS := newTestService(t, Options{Thumbnails: true})
+	writePNG(t, filepath.Join(dir, "image.png"), 400, 400)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "file.txt"), []byte("text"), 0666))
+
+	get := func(name, query string) *httptest.ResponseRecorder {
+		node, err := VFS.Stat(name)
+		require.NoError(t, err)
+		w := httptest.NewRecorder()
+		s.ServeThumbnail(w, httptest.NewRequest("GET", "/"+name+"?"+query, nil), VFS, node)
+		return w
+	}
+
+	w := get("image.png", "thumb=")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/jpeg", w.Header().Get("Content-Type"))
+	config, err := jpeg.DecodeConfig(w.Body)
+	require.NoError(t, err)
+	assert.Equal(t, DefaultThumbnailSize, config.Width)
+
+	w = get("image.png", "thumb=64")
+	require.Equal(t, http.StatusOK, w.Code)
+	config, err = jpeg.DecodeConfig(w.Body)
+	require.NoError(t, err)
+	assert.Equal(t, 64, config.Height)
+
+	assert.Equal(t, http.StatusBadRequest, get("image.png", "thumb=0").Code)
+	assert.Equal(t, http.StatusBadRequest, get("image.png", "thumb=x").Code)
+	assert.Equal(t, http.StatusNotFound, get("file.txt", "thumb=").Code)
+}
+
+func TestTranscode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs tr")
+	}
+	s, dir, VFS := newTestService(t, Options{TranscodeCommand: fs.SpaceSepList{"tr", "a-z", "A-Z"}, TranscodeMimeType: "video/mp2t"})
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "video.mp4"), []byte("hello video"), 0666))
+	node, err := VFS.Stat("video.mp4")
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	s.ServeTranscode(w, httptest.NewRequest("GET", "/video.mp4?transcode=1", nil), VFS, node)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "video/mp2t", w.Header().Get("Content-Type"))
+	assert.Equal(t, "HELLO VIDEO", w.Body.String())
+
+	// Arguments with spaces can be quoted
+	require.NoError(t, s.opt.TranscodeCommand.Set(`sh -c "tr a-z A-Z | tr V W"`))
+	w = httptest.NewRecorder()
+	s.ServeTranscode(w, httptest.NewRequest("GET", "/video.mp4?transcode=1", nil), VFS, node)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "HELLO WIDEO", w.Body.String())
+
+	// A failing command is reported if nothing was sent
+	s.opt.TranscodeCommand = fs.SpaceSepList{"false"}
+	w = httptest.NewRecorder()
+	s.ServeTranscode(w, httptest.NewRequest("GET", "/video.mp4?transcode=1", nil), VFS, node)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	// Share links can't transcode
+	const secret = "0123456789abcdef0123456789abcdef"
+	token, err := libhttp.NewShareToken(secret, "video.mp4", libhttp.ShareOptions{})
+	require.NoError(t, err)
+	handler := libhttp.MiddlewareShare(secret)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.ServeTranscode(w, r, VFS, node)
+	}))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/video.mp4?transcode=1&"+libhttp.ShareParam+"="+token, nil))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestConcurrency(t *testing.T) {
+	s, dir, VFS := newTestService(t, Options{Thumbnails: true, TranscodeCommand: fs.SpaceSepList{"cat"}})
+	writePNG(t, filepath.Join(dir, "image.png"), 100, 100)
+	node, err := VFS.Stat("image.png")
+	require.NoError(t, err)
+
+	// With every slot in use requests wait until cancelled
+	require.True(t, s.thumbnailSem.TryAcquire(1))
+	require.True(t, s.transcodeSem.TryAcquire(1))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = s.Thumbnail(ctx, VFS, node, 50)
+	assert.ErrorIs(t, err, context.Canceled)
+	err = s.Transcode(ctx, VFS, "image.png", io.Discard)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// Once the slots are free they work again
+	s.thumbnailSem.Release(1)
+	s.transcodeSem.Release(1)
+	_, err = s.Thumbnail(context.Background(), VFS, node, 50)
+	assert.NoError(t, err)
+
+	// A caller giving up doesn't stop others waiting for the same thumbnail
+	require.True(t, s.thumbnailSem.TryAcquire(1))
+	ctx, cancel = context.WithCancel(context.Background())
+	gaveUp := make(chan error, 1)
+	go func() {
+		_, err := s.Thumbnail(ctx, VFS, node, 60)
+		gaveUp <- err
+	}()
+	waited := make(chan error, 1)
+	go func() {
+		_, err := s.Thumbnail(context.Background(), VFS, node, 60)
+		waited <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	assert.ErrorIs(t, <-gaveUp, context.Canceled)
+	s.thumbnailSem.Release(1)
+	assert.NoError(t, <-waited)
+}
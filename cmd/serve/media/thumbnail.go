@@ -0,0 +1,216 @@
+package media
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	_ "image/png" // register the png decoder
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/http/serve"
+	"github.com/rclone/rclone/vfs"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // register the webp decoder
+)
+
+const (
+	// DefaultThumbnailSize is the size of thumbnails if not
+	// specified. This is the largest allowed by the DLNA
+	// JPEG_TN profile.
+	DefaultThumbnailSize = 160
+
+	// MaxThumbnailSize is the largest thumbnail which can be made
+	MaxThumbnailSize = 1024
+
+	// maxPixels is the largest image which will be decoded
+	maxPixels = 100_000_000
+
+	// thumbnailQuality is the JPEG quality of the thumbnails
+	thumbnailQuality = 85
+)
+
+// ErrTooBig is returned if the image is too big to make a thumbnail of
+var ErrTooBig = errors.New("image too big to make a thumbnail of")
+
+// Thumbnail returns a JPEG of the image at node which fits in a
+// square of size pixels. Images smaller than that aren't enlarged.
+//
+// The thumbnail is read from the cache if it has been made before
+// from the same version of the image.
+//
+// Only --thumbnail-concurrency thumbnails are made at once. Callers
+// asking for the same thumbnail share the work of making it, which
+// carries on if a caller gives up when its ctx is cancelled so the
+// others still get it.
+func (s *Service) Thumbnail(ctx context.Context, VFS *vfs.Session, node vfs.Node, size int) (thumb []byte, err error) {
+	if size <= 0 || size > MaxThumbnailSize {
+		return nil, fmt.Errorf("thumbnail size must be between 1 and %d", MaxThumbnailSize)
+	}
+	cachePath := s.cachePath(VFS, node, size)
+	thumb, err = os.ReadFile(cachePath)
+	if err == nil {
+		return thumb, nil
+	}
+	results := s.group.DoChan(cachePath, func() (interface{}, error) {
+		// Not using ctx as this is shared with the other callers
+		if err := s.thumbnailSem.Acquire(context.Background(), 1); err != nil {
+			return nil, err
+		}
+		defer s.thumbnailSem.Release(1)
+		thumb, err := makeThumbnail(VFS, node.Path(), size)
+		if err != nil {
+			return nil, err
+		}
+		if err := writeCacheFile(cachePath, thumb); err != nil {
+			fs.Errorf(node.Path(), "Failed to cache thumbnail: %v", err)
+		}
+		return thumb, nil
+	})
+	select {
+	case result := <-results:
+		if result.Err != nil {
+			return nil, result.Err
+		}
+		return result.Val.([]byte), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// cachePath returns the file in the cache for the thumbnail of node
+//
+// The name is a hash of everything which changes the thumbnail so a
+// new version of the image gets a new thumbnail.
+func (s *Service) cachePath(VFS *vfs.Session, node vfs.Node, size int) string {
+	h := sha256.New()
+	_, _ = fmt.Fprintf(h, "%s\x00%s\x00%d\x00%d\x00%d", fs.ConfigString(VFS.Fs()), node.Path(), node.ModTime().UnixNano(), node.Size(), size)
+	name := hex.EncodeToString(h.Sum(nil))
+	return filepath.Join(s.cacheDir, name[:2], name+".jpg")
+}
+
+// writeCacheFile writes data to path atomically so a partial file is
+// never read from the cache
+func writeCacheFile(path string, data []byte) (err error) {
+	if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(f.Name())
+		}
+	}()
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// makeThumbnail reads the image at remote and returns a thumbnail of
+// it as a JPEG
+func makeThumbnail(VFS *vfs.Session, remote string, size int) (thumb []byte, err error) {
+	in, err := VFS.Open(remote)
+	if err != nil {
+		return nil, err
+	}
+	defer fs.CheckClose(in, &err)
+
+	// Check the size first so huge images aren't decoded
+	config, _, err := image.DecodeConfig(bufio.NewReader(in))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+	if int64(config.Width)*int64(config.Height) > maxPixels {
+		return nil, ErrTooBig
+	}
+	if _, err = in.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	src, _, err := image.Decode(bufio.NewReader(in))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	var out bytes.Buffer
+	err = jpeg.Encode(&out, resize(src, size), &jpeg.Options{Quality: thumbnailQuality})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+	return out.Bytes(), nil
+}
+
+// resize returns src scaled to fit in a square of size pixels keeping
+// its aspect ratio, on a white background as JPEG can't be
+// transparent.
+func resize(src image.Image, size int) image.Image {
+	b := src.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if width > size || height > size {
+		if width >= height {
+			width, height = size, height*size/width
+		} else {
+			width, height = width*size/height, size
+		}
+		// Very thin images still need to be one pixel
+		if width < 1 {
+			width = 1
+		}
+		if height < 1 {
+			height = 1
+		}
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, b, draw.Over, nil)
+	return dst
+}
+
+// ServeThumbnail serves a thumbnail of the image at node using the
+// size in pixels from the "thumb" query parameter, or
+// DefaultThumbnailSize if it is empty.
+func (s *Service) ServeThumbnail(w http.ResponseWriter, r *http.Request, VFS *vfs.Session, node vfs.Node) {
+	if !s.CanThumbnail(MimeType(r.Context(), node)) {
+		http.Error(w, "Can't make a thumbnail of this file", http.StatusNotFound)
+		return
+	}
+	size := DefaultThumbnailSize
+	if value := r.URL.Query().Get("thumb"); value != "" {
+		var err error
+		size, err = strconv.Atoi(value)
+		if err != nil || size <= 0 || size > MaxThumbnailSize {
+			http.Error(w, fmt.Sprintf("Bad thumbnail size - must be between 1 and %d", MaxThumbnailSize), http.StatusBadRequest)
+			return
+		}
+	}
+	thumb, err := s.Thumbnail(r.Context(), VFS, node, size)
+	if errors.Is(err, ErrTooBig) {
+		http.Error(w, "Image too big to make a thumbnail of", http.StatusUnprocessableEntity)
+		return
+	} else if r.Context().Err() != nil {
+		// The client went away while waiting
+		return
+	} else if err != nil {
+		serve.Error(node.Path(), w, "Failed to make thumbnail", err)
+		return
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	http.ServeContent(w, r, "", node.ModTime(), bytes.NewReader(thumb))
+}
@@ -0,0 +1,103 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/rclone/rclone/fs"
+	libhttp "github.com/rclone/rclone/lib/http"
+	"github.com/rclone/rclone/lib/http/serve"
+	"github.com/rclone/rclone/vfs"
+)
+
+// Transcode runs the transcode command on the file at remote, writing
+// the transcoded video to out.
+//
+// Only --transcode-concurrency commands are run at once, waiting for
+// a turn until ctx is cancelled.
+func (s *Service) Transcode(ctx context.Context, VFS *vfs.Session, remote string, out io.Writer) (err error) {
+	cmdLine := s.opt.TranscodeCommand
+	if len(cmdLine) == 0 {
+		return errors.New("no transcode command set")
+	}
+	if err = s.transcodeSem.Acquire(ctx, 1); err != nil {
+		return err
+	}
+	defer s.transcodeSem.Release(1)
+	in, err := VFS.Open(remote)
+	if err != nil {
+		return err
+	}
+	defer fs.CheckClose(in, &err)
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, cmdLine[0], cmdLine[1:]...)
+	cmd.Env = append(os.Environ(), "RCLONE_TRANSCODE_NAME="+remote)
+	cmd.Stdin = in
+	cmd.Stdout = out
+	cmd.Stderr = &stderr
+	fs.Debugf(remote, "Transcoding with %q", cmdLine)
+	err = cmd.Run()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("transcode command failed: %w: %s", err, msg)
+		}
+		return fmt.Errorf("transcode command failed: %w", err)
+	}
+	return nil
+}
+
+// ServeTranscode serves the video at node transcoded with the
+// transcode command.
+//
+// As the length of the transcoded video isn't known it is streamed
+// without support for Range requests.
+//
+// Requests made with share links are refused as transcoding is
+// expensive and anyone with the link could start any number of them.
+func (s *Service) ServeTranscode(w http.ResponseWriter, r *http.Request, VFS *vfs.Session, node vfs.Node) {
+	if !s.CanTranscode(MimeType(r.Context(), node)) {
+		http.Error(w, "Can't transcode this file", http.StatusNotFound)
+		return
+	}
+	if libhttp.IsShared(r) {
+		http.Error(w, "Can't transcode with a share link", http.StatusForbidden)
+		return
+	}
+	w.Header().Set("Content-Type", s.opt.TranscodeMimeType)
+	if r.Method == "HEAD" {
+		return
+	}
+	out := &writeCounter{w: w}
+	err := s.Transcode(r.Context(), VFS, node.Path(), out)
+	if err != nil {
+		if r.Context().Err() != nil {
+			// The client went away
+			fs.Debugf(node.Path(), "Transcode stopped: %v", err)
+		} else if out.n == 0 {
+			serve.Error(node.Path(), w, "Failed to transcode", err)
+		} else {
+			// Too late to tell the client
+			fs.Errorf(node.Path(), "Failed to transcode after %d bytes: %v", out.n, err)
+		}
+	}
+}
+
+// writeCounter counts the bytes written through it
+type writeCounter struct {
+	w io.Writer
+	n int64
+}
+
+func (wc *writeCounter) Write(p []byte) (n int, err error) {
+	n, err = wc.w.Write(p)
+	wc.n += int64(n)
+	return n, err
+}
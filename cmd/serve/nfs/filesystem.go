@@ -16,7 +16,7 @@ import (
 
 // FS is our wrapper around the VFS to properly support billy.Filesystem interface
 type FS struct {
-	vfs *vfs.VFS
+	vfs *vfs.Session
 }
 
 // ReadDir implements read dir
@@ -109,7 +109,7 @@ func (f *FS) Readlink(link string) (string, error) {
 
 // Chmod changes the file modes
 func (f *FS) Chmod(name string, mode os.FileMode) error {
-	file, err := f.vfs.Open(name)
+	file, err := f.vfs.VFS.Open(name)
 	if err != nil {
 		return err
 	}
@@ -128,7 +128,7 @@ func (f *FS) Lchown(name string, uid, gid int) error {
 
 // Chown changes owner of the file
 func (f *FS) Chown(name string, uid, gid int) error {
-	file, err := f.vfs.Open(name)
+	file, err := f.vfs.VFS.Open(name)
 	if err != nil {
 		return err
 	}
@@ -36,7 +36,10 @@ type BackendAuthHandler struct {
 // Mount backs Mount RPC Requests, allowing for access control policies.
 func (h *BackendAuthHandler) Mount(ctx context.Context, conn net.Conn, req nfs.MountRequest) (status nfs.MountStatus, hndl billy.Filesystem, auths []nfs.AuthFlavor) {
 	status = nfs.MountStatusOk
-	hndl = &FS{vfs: h.vfs}
+	hndl = &FS{vfs: h.vfs.Session(vfs.AuditInfo{
+		Protocol:   "nfs",
+		RemoteAddr: conn.RemoteAddr().String(),
+	})}
 	auths = []nfs.AuthFlavor{nfs.AuthFlavorNull}
 	return
 }
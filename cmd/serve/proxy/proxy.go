@@ -104,22 +104,31 @@ before it takes effect.
 This can be used to build general purpose proxies to any kind of
 backend that rclone supports.  
 
-`, "|", "`", -1)
+`, "|", "`", -1) + usersHelp
 
 // Options is options for creating the proxy
 type Options struct {
 	AuthProxy string
+	UsersFile string
+}
+
+// Enabled returns true if users are looked up in an auth proxy
+// program or a users file
+func (opt *Options) Enabled() bool {
+	return opt.AuthProxy != "" || opt.UsersFile != ""
 }
 
 // DefaultOpt is the default values uses for Opt
 var DefaultOpt = Options{
 	AuthProxy: "",
+	UsersFile: "",
 }
 
 // Proxy represents a proxy to turn auth requests into a VFS
 type Proxy struct {
 	cmdLine  []string // broken down command line
 	vfsCache *libcache.Cache
+	users    *users          // users file if set
 	ctx      context.Context // for global config
 	Opt      Options
 }
@@ -132,12 +141,18 @@ type cacheEntry struct {
 
 // New creates a new proxy with the Options passed in
 func New(ctx context.Context, opt *Options) *Proxy {
-	return &Proxy{
+	p := &Proxy{
 		ctx:      ctx,
 		Opt:      *opt,
 		cmdLine:  strings.Fields(opt.AuthProxy),
 		vfsCache: libcache.New(),
 	}
+	if opt.UsersFile != "" {
+		p.users = newUsers(opt.UsersFile, func(user string) {
+			p.vfsCache.Delete(usersKeyPrefix + user)
+		})
+	}
+	return p
 }
 
 // run the proxy command returning a config map
@@ -256,6 +271,17 @@ func (p *Proxy) call(user, auth string, isPublicKey bool) (value interface{}, er
 // Call runs the auth proxy with the username and password/public key provided
 // returning a *vfs.VFS and the key used in the VFS cache.
 func (p *Proxy) Call(user, auth string, isPublicKey bool) (VFS *vfs.VFS, vfsKey string, err error) {
+	// Look in the users file first
+	if p.users != nil {
+		u, err := p.users.check(user, auth, isPublicKey)
+		if err == nil {
+			return p.callUsers(u)
+		}
+		if err != errUnknownUser || len(p.cmdLine) == 0 {
+			return nil, "", err
+		}
+	}
+
 	// Look in the cache first
 	value, ok := p.vfsCache.GetMaybe(user)
 
@@ -0,0 +1,290 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/fspath"
+	"github.com/rclone/rclone/vfs"
+	"github.com/rclone/rclone/vfs/vfsflags"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/ssh"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// usersHelp contains text describing how to use the users file
+var usersHelp = strings.Replace(`### Users file
+
+If you supply the parameter |--users-file /path/to/users.yaml| then
+rclone will look up the users logging in in that file, each of which
+can have their own remote, root directory and permissions. This is a
+simpler alternative to |--auth-proxy| when the users are known in
+advance.
+
+The file is in YAML, or JSON if it ends in |.json|, and looks like
+this
+
+|||
+users:
+  - user: alice
+    password: "$2y$10$Q3j8sYtV...bcrypt hash...FJ2"
+    remote: "s3:bucket"
+    root: "home/alice"
+  - user: bob
+    authorized_keys:
+      - "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAI... bob@example.com"
+    remote: "/srv/files"
+    read_only: true
+    quota: 10G
+    quota_files: 10000
+|||
+
+Each user can have
+- |user| - the user name (required)
+- |password| - the bcrypt hash of the password, as made by |htpasswd -nB user|
+- |authorized_keys| - SSH public keys in authorized_keys format for |serve sftp|
+- |remote| - the remote to serve, e.g. |s3:bucket| or |/path/to/dir| (required)
+- |root| - the directory in the remote to use as the root for the user
+- |read_only| - set to |true| to stop the user changing anything
+- |quota| - the total size of the files the user can store, e.g. |10G|
+- |quota_files| - the number of files the user can store
+
+A user needs a |password| or |authorized_keys| to log in.
+
+A user's quota is counted in their |root| and replaces the
+|--vfs-quota-size| and |--vfs-quota-files| set for the server. See the
+VFS quota section for how it is enforced.
+
+The file is read again when it changes, so users can be added, changed
+or removed without restarting rclone. If the changed file can't be
+read the error is logged and the previous contents are used.
+
+If |--auth-proxy| is set too then users not in the file are passed to
+the auth proxy program.
+
+`, "|", "`", -1)
+
+// usersKeyPrefix starts the VFS cache keys of users from the users file
+const usersKeyPrefix = "users-file/"
+
+// errUnknownUser is returned if the user isn't in the users file
+var errUnknownUser = errors.New("user not found in users file")
+
+// User is a user in the users file
+type User struct {
+	User           string   `yaml:"user" json:"user"`
+	Password       string   `yaml:"password" json:"password"`
+	AuthorizedKeys []string `yaml:"authorized_keys" json:"authorized_keys"`
+	Remote         string   `yaml:"remote" json:"remote"`
+	Root           string   `yaml:"root" json:"root"`
+	ReadOnly       bool     `yaml:"read_only" json:"read_only"`
+	Quota          string   `yaml:"quota" json:"quota"`
+	QuotaFiles     *int64   `yaml:"quota_files" json:"quota_files"`
+
+	quota fs.SizeSuffix       // parsed Quota
+	keys  map[string]struct{} // authorized keys as sent by the sftp server
+}
+
+// parse checks the user and fills in the parsed fields
+func (u *User) parse() error {
+	if u.User == "" {
+		return errors.New("user with no name")
+	}
+	if u.Remote == "" {
+		return fmt.Errorf("user %q: no remote", u.User)
+	}
+	if u.Password == "" && len(u.AuthorizedKeys) == 0 {
+		return fmt.Errorf("user %q: no password or authorized_keys", u.User)
+	}
+	if u.Password != "" {
+		if _, err := bcrypt.Cost([]byte(u.Password)); err != nil {
+			return fmt.Errorf("user %q: password must be a bcrypt hash: %w", u.User, err)
+		}
+	}
+	u.keys = make(map[string]struct{}, len(u.AuthorizedKeys))
+	for _, line := range u.AuthorizedKeys {
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+		if err != nil {
+			return fmt.Errorf("user %q: bad authorized key: %w", u.User, err)
+		}
+		u.keys[base64.StdEncoding.EncodeToString(key.Marshal())] = struct{}{}
+	}
+	u.quota = -1
+	if u.Quota != "" {
+		if err := u.quota.Set(u.Quota); err != nil {
+			return fmt.Errorf("user %q: bad quota: %w", u.User, err)
+		}
+	}
+	if u.QuotaFiles != nil && *u.QuotaFiles < 0 {
+		return fmt.Errorf("user %q: quota_files can't be negative", u.User)
+	}
+	return nil
+}
+
+// fsString returns the remote and root of the user
+func (u *User) fsString() string {
+	if u.Root == "" {
+		return u.Remote
+	}
+	return fspath.JoinRootPath(u.Remote, u.Root)
+}
+
+// users is the users file, read again when it changes
+type users struct {
+	path     string
+	onChange func(user string) // called with each user changed or removed on reload
+
+	mu       sync.Mutex
+	modTime  time.Time
+	size     int64
+	byName   map[string]*User
+	verified map[string]map[[sha256.Size]byte]struct{} // hashes of passwords which have been checked
+}
+
+// newUsers reads the users file at path
+func newUsers(path string, onChange func(user string)) *users {
+	u := &users{
+		path:     path,
+		onChange: onChange,
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if err := u.reload(); err != nil {
+		fs.Errorf(nil, "Failed to read users file: %v", err)
+	}
+	return u
+}
+
+// readUsers reads and checks the users in the file at path
+func readUsers(path string) (map[string]*User, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Users []*User `yaml:"users" json:"users"`
+	}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(data, &file)
+	} else {
+		err = yaml.UnmarshalStrict(data, &file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %q: %w", path, err)
+	}
+	byName := make(map[string]*User, len(file.Users))
+	for _, user := range file.Users {
+		if err := user.parse(); err != nil {
+			return nil, fmt.Errorf("%q: %w", path, err)
+		}
+		if _, found := byName[user.User]; found {
+			return nil, fmt.Errorf("%q: user %q is in the file more than once", path, user.User)
+		}
+		byName[user.User] = user
+	}
+	return byName, nil
+}
+
+// reload reads the users file again if it has changed - call with the
+// lock held
+func (u *users) reload() error {
+	fi, err := os.Stat(u.path)
+	if err != nil {
+		return err
+	}
+	if !u.modTime.IsZero() && fi.ModTime().Equal(u.modTime) && fi.Size() == u.size {
+		return nil
+	}
+	// Don't read the file again until it changes, even if it is bad
+	u.modTime, u.size = fi.ModTime(), fi.Size()
+	byName, err := readUsers(u.path)
+	if err != nil {
+		return err
+	}
+	for name, old := range u.byName {
+		if user, found := byName[name]; !found || !reflect.DeepEqual(old, user) {
+			u.onChange(name)
+		}
+	}
+	if u.byName != nil {
+		fs.Infof(nil, "Read %d users from changed users file %q", len(byName), u.path)
+	} else {
+		fs.Infof(nil, "Read %d users from users file %q", len(byName), u.path)
+	}
+	u.byName = byName
+	u.verified = map[string]map[[sha256.Size]byte]struct{}{}
+	return nil
+}
+
+// check returns the user if auth is their password or public key
+func (u *users) check(name, auth string, isPublicKey bool) (*User, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if err := u.reload(); err != nil {
+		fs.Errorf(nil, "Failed to read users file: %v", err)
+	}
+	user, found := u.byName[name]
+	if !found {
+		return nil, errUnknownUser
+	}
+	if isPublicKey {
+		if _, found := user.keys[auth]; !found {
+			return nil, errors.New("users file: incorrect public key")
+		}
+		return user, nil
+	}
+	if user.Password == "" {
+		return nil, errors.New("users file: password login not allowed")
+	}
+	// bcrypt is slow so remember the passwords already checked
+	authHash := sha256.Sum256([]byte(auth))
+	for hash := range u.verified[name] {
+		if subtle.ConstantTimeCompare(hash[:], authHash[:]) == 1 {
+			return user, nil
+		}
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(auth)) != nil {
+		return nil, errors.New("users file: incorrect password")
+	}
+	if u.verified[name] == nil {
+		u.verified[name] = map[[sha256.Size]byte]struct{}{}
+	}
+	u.verified[name][authHash] = struct{}{}
+	return user, nil
+}
+
+// callUsers returns the VFS for user from the users file
+func (p *Proxy) callUsers(user *User) (VFS *vfs.VFS, vfsKey string, err error) {
+	vfsKey = usersKeyPrefix + user.User
+	value, err := p.vfsCache.Get(vfsKey, func(key string) (value interface{}, ok bool, err error) {
+		f, err := cache.Get(p.ctx, user.fsString())
+		if err != nil {
+			return nil, false, err
+		}
+		opt := vfsflags.Opt
+		opt.ReadOnly = opt.ReadOnly || user.ReadOnly
+		if user.quota >= 0 {
+			opt.QuotaSize = user.quota
+		}
+		if user.QuotaFiles != nil {
+			opt.QuotaFiles = *user.QuotaFiles
+		}
+		return cacheEntry{vfs: vfs.New(f, &opt)}, true, nil
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("users file: failed to create backend for %q: %w", user.User, err)
+	}
+	return value.(cacheEntry).vfs, vfsKey, nil
+}
@@ -0,0 +1,141 @@
+package proxy
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/ssh"
+)
+
+// writeUsers writes contents to the users file at path, making sure
+// it looks changed
+func writeUsers(t *testing.T, path, contents string) {
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0600))
+	modTime := time.Now().Add(time.Duration(len(contents)) * time.Second)
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func TestUsersFile(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "home", "alice"), 0777))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "home", "alice", "file.txt"), []byte("hello"), 0666))
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	sshPub, err := ssh.NewPublicKey(pub)
+	require.NoError(t, err)
+	authorizedKey := string(ssh.MarshalAuthorizedKey(sshPub))
+	sentKey := base64.StdEncoding.EncodeToString(sshPub.Marshal())
+
+	usersFile := filepath.Join(dir, "users.yaml")
+	writeUsers(t, usersFile, fmt.Sprintf(`users:
+  - user: alice
+    password: %q
+    remote: %q
+    root: home/alice
+  - user: bob
+    authorized_keys:
+      - %q
+    remote: %q
+    read_only: true
+    quota: 1M
+    quota_files: 100
+`, hash, dir, authorizedKey, dir))
+
+	opt := DefaultOpt
+	opt.UsersFile = usersFile
+	p := New(context.Background(), &opt)
+
+	VFS, key, err := p.Call("alice", "secret", false)
+	require.NoError(t, err)
+	assert.Equal(t, "users-file/alice", key)
+	assert.False(t, VFS.Opt.ReadOnly)
+	_, err = VFS.Stat("file.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, VFS, p.Get(key))
+
+	// the password is checked every time
+	_, _, err = p.Call("alice", "wrong", false)
+	assert.ErrorContains(t, err, "incorrect password")
+	_, _, err = p.Call("alice", sentKey, true)
+	assert.ErrorContains(t, err, "incorrect public key")
+
+	VFS, _, err = p.Call("bob", sentKey, true)
+	require.NoError(t, err)
+	assert.True(t, VFS.Opt.ReadOnly)
+	assert.Equal(t, fs.SizeSuffix(1024*1024), VFS.Opt.QuotaSize)
+	assert.Equal(t, int64(100), VFS.Opt.QuotaFiles)
+	_, err = VFS.Stat("home/alice/file.txt")
+	assert.NoError(t, err)
+	_, _, err = p.Call("bob", "secret", false)
+	assert.ErrorContains(t, err, "password login not allowed")
+
+	_, _, err = p.Call("mallory", "secret", false)
+	assert.Equal(t, errUnknownUser, err)
+
+	// changes are read without restarting
+	writeUsers(t, usersFile, fmt.Sprintf(`users:
+  - user: alice
+    password: %q
+    remote: %q
+    read_only: true
+`, hash, dir))
+	_, _, err = p.Call("bob", sentKey, true)
+	assert.Equal(t, errUnknownUser, err)
+	assert.Nil(t, p.Get(key))
+	VFS, _, err = p.Call("alice", "secret", false)
+	require.NoError(t, err)
+	assert.True(t, VFS.Opt.ReadOnly)
+	_, err = VFS.Stat("home/alice/file.txt")
+	assert.NoError(t, err)
+
+	// a bad file keeps the previous users
+	writeUsers(t, usersFile, "users:\n  - user: alice\n    remote: /tmp\n")
+	_, _, err = p.Call("alice", "secret", false)
+	assert.NoError(t, err)
+}
+
+func TestUsersFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	for _, test := range []struct {
+		name     string
+		contents string
+		want     string
+	}{
+		{"NoRemote", "users:\n  - user: a\n    password: x\n", "no remote"},
+		{"NoAuth", "users:\n  - user: a\n    remote: /tmp\n", "no password or authorized_keys"},
+		{"PlainPassword", "users:\n  - user: a\n    remote: /tmp\n    password: potato\n", "bcrypt"},
+		{"BadKey", "users:\n  - user: a\n    remote: /tmp\n    authorized_keys: [potato]\n", "bad authorized key"},
+		{"Duplicate", "users:\n  - user: a\n    remote: /tmp\n    authorized_keys: []\n    password: $2y$04$0123456789012345678901u8F5eRCaG4j6A6DgAV5EUNyU2ssypzS\n  - user: a\n    remote: /tmp\n    password: $2y$04$0123456789012345678901u8F5eRCaG4j6A6DgAV5EUNyU2ssypzS\n", "more than once"},
+		{"NegativeQuotaFiles", "users:\n  - user: a\n    remote: /tmp\n    password: $2y$04$0123456789012345678901u8F5eRCaG4j6A6DgAV5EUNyU2ssypzS\n    quota_files: -1\n", "quota_files"},
+		{"UnknownField", "users:\n  - user: a\n    remote: /tmp\n    pasword: x\n", "pasword"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(dir, test.name+".yaml")
+			require.NoError(t, os.WriteFile(path, []byte(test.contents), 0600))
+			_, err := readUsers(path)
+			assert.ErrorContains(t, err, test.want)
+		})
+	}
+
+	// JSON files are read as JSON
+	path := filepath.Join(dir, "users.json")
+	require.NoError(t, os.WriteFile(path, []byte("{\n\t\"users\": [{\"user\": \"a\", \"remote\": \"/tmp\", \"password\": \"$2y$04$0123456789012345678901u8F5eRCaG4j6A6DgAV5EUNyU2ssypzS\"}]\n}\n"), 0600))
+	users, err := readUsers(path)
+	require.NoError(t, err)
+	assert.Equal(t, "/tmp", users["a"].Remote)
+}
@@ -0,0 +1,48 @@
+package s3
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/rclone/rclone/vfs"
+)
+
+// auditInfoKey is the context key for the vfs.AuditInfo of the request
+type auditInfoKey struct{}
+
+// accessKey returns the access key ID used to sign r or "" if it
+// isn't signed.
+func accessKey(r *http.Request) string {
+	credential := r.URL.Query().Get("X-Amz-Credential")
+	if credential == "" {
+		auth := r.Header.Get("Authorization")
+		i := strings.Index(auth, "Credential=")
+		if i < 0 {
+			return ""
+		}
+		credential = auth[i+len("Credential="):]
+	}
+	accessKey, _, _ := strings.Cut(credential, "/")
+	return accessKey
+}
+
+// auditInfo wraps next so the client making the request is recorded
+// in the audit log.
+func auditInfo(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info := vfs.AuditInfo{
+			User:       accessKey(r),
+			Protocol:   "s3",
+			RemoteAddr: r.RemoteAddr,
+		}
+		r = r.WithContext(context.WithValue(r.Context(), auditInfoKey{}, info))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// session returns the VFS to use for the request in ctx
+func (b *s3Backend) session(ctx context.Context) *vfs.Session {
+	info, _ := ctx.Value(auditInfoKey{}).(vfs.AuditInfo)
+	return b.vfs.Session(info)
+}
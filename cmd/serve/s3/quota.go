@@ -0,0 +1,58 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/rclone/gofakes3"
+	"github.com/rclone/rclone/vfs"
+)
+
+// errQuotaExceeded is the S3 error code returned when an upload would
+// go over the quota
+const errQuotaExceeded gofakes3.ErrorCode = "QuotaExceeded"
+
+// quotaKey is the context key for the flag set by quotaError
+type quotaKey struct{}
+
+// quotaError converts a quota error from the VFS into an S3 error,
+// noting it in ctx so quotaStatus can set the response status.
+//
+// Other errors are returned unchanged.
+func quotaError(ctx context.Context, err error) error {
+	if !errors.Is(err, vfs.ENOSPC) {
+		return err
+	}
+	if exceeded, ok := ctx.Value(quotaKey{}).(*bool); ok {
+		*exceeded = true
+	}
+	return gofakes3.ErrorMessage(errQuotaExceeded, "The upload would exceed the storage quota")
+}
+
+// quotaStatusWriter sets the status for responses to requests which
+// exceeded the quota
+type quotaStatusWriter struct {
+	http.ResponseWriter
+	exceeded *bool
+}
+
+// WriteHeader writes the status, changing it to 507 Insufficient
+// Storage if the quota was exceeded
+func (w quotaStatusWriter) WriteHeader(statusCode int) {
+	if *w.exceeded && statusCode == http.StatusInternalServerError {
+		statusCode = http.StatusInsufficientStorage
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// quotaStatus wraps next so requests which exceed the quota get a 507
+// Insufficient Storage status. This is needed as gofakes3 sends a 500
+// status for error codes it doesn't know.
+func quotaStatus(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		exceeded := new(bool)
+		r = r.WithContext(context.WithValue(r.Context(), quotaKey{}, exceeded))
+		next.ServeHTTP(quotaStatusWriter{ResponseWriter: w, exceeded: exceeded}, r)
+	})
+}
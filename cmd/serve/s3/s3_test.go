@@ -8,6 +8,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net/http"
 	"net/url"
 	"os"
 	"os/exec"
@@ -28,6 +29,7 @@ import (
 	"github.com/rclone/rclone/fstest"
 	httplib "github.com/rclone/rclone/lib/http"
 	"github.com/rclone/rclone/lib/random"
+	"github.com/rclone/rclone/vfs/vfsflags"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -202,3 +204,32 @@ func TestEncodingWithMinioClient(t *testing.T) {
 	}
 
 }
+
+func TestQuota(t *testing.T) {
+	oldOpt := vfsflags.Opt
+	defer func() { vfsflags.Opt = oldOpt }()
+	vfsflags.Opt.QuotaSize = 10
+
+	f, err := fs.NewFs(context.Background(), t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, f.Mkdir(context.Background(), "bucket"))
+
+	endpoint, keyid, keysec := serveS3(f)
+	testURL, _ := url.Parse(endpoint)
+	minioClient, err := minio.New(testURL.Host, &minio.Options{
+		Creds:  credentials.NewStaticV4(keyid, keysec, ""),
+		Secure: false,
+	})
+	require.NoError(t, err)
+
+	put := func(name, contents string) error {
+		_, err := minioClient.PutObject(context.Background(), "bucket", name, strings.NewReader(contents), int64(len(contents)), minio.PutObjectOptions{})
+		return err
+	}
+	require.NoError(t, put("small", "12345"))
+	err = put("large", "1234567890")
+	require.Error(t, err)
+	resp := minio.ToErrorResponse(err)
+	assert.Equal(t, "QuotaExceeded", resp.Code)
+	assert.Equal(t, http.StatusInsufficientStorage, resp.StatusCode)
+}
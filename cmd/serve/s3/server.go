@@ -67,7 +67,7 @@ func newServer(ctx context.Context, f fs.Fs, opt *Options) (s *Server, err error
 		return nil, fmt.Errorf("failed to init server: %w", err)
 	}
 
-	w.handler = w.faker.Server()
+	w.handler = auditInfo(quotaStatus(w.faker.Server()))
 	return w, nil
 }
 
@@ -91,7 +91,7 @@ func prefixParser(p *gofakes3.Prefix) (path, remaining string) {
 }
 
 // FIXME this could be implemented by VFS.MkdirAll()
-func mkdirRecursive(path string, VFS *vfs.VFS) error {
+func mkdirRecursive(path string, VFS *vfs.Session) error {
 	path = strings.Trim(path, "/")
 	dirs := strings.Split(path, "/")
 	dir := ""
@@ -107,7 +107,7 @@ func mkdirRecursive(path string, VFS *vfs.VFS) error {
 	return nil
 }
 
-func rmdirRecursive(p string, VFS *vfs.VFS) {
+func rmdirRecursive(p string, VFS *vfs.Session) {
 	dir := path.Dir(p)
 	if !strings.ContainsAny(dir, "/\\") {
 		// might be bucket(root)
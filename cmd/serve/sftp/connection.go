@@ -9,6 +9,7 @@ import (
 	"io"
 	"net"
 	"os"
+	"path"
 	"regexp"
 	"strings"
 
@@ -47,16 +48,100 @@ func shellUnEscape(str string) string {
 	return str
 }
 
+// shellSplit splits a command line into words in the same way as a
+// POSIX shell would, removing quotes and backslash escapes.
+//
+// This is used for the commands sent by scp and rsync which quote or
+// escape their arguments for the remote shell.
+func shellSplit(command string) (words []string, err error) {
+	var (
+		word    strings.Builder
+		inWord  bool
+		quote   rune
+		escaped bool
+	)
+	for _, r := range command {
+		switch {
+		case escaped:
+			// in double quotes only some characters can be escaped
+			if quote == '"' && !strings.ContainsRune("$`\"\\\n", r) {
+				word.WriteRune('\\')
+			}
+			// a backslash newline is a line continuation
+			if r != '\n' {
+				word.WriteRune(r)
+			}
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case quote == '"':
+			switch r {
+			case '"':
+				quote = 0
+			case '\\':
+				escaped = true
+			default:
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == '\\':
+			escaped = true
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote or escape in %q", command)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// vfsPath converts a path given to scp or rsync into a path in the
+// VFS, which is always relative to the root being served.
+func vfsPath(p string) string {
+	if p == "~" || strings.HasPrefix(p, "~/") {
+		p = p[1:]
+	}
+	p = path.Clean("/" + p)
+	return p[1:]
+}
+
 // Info about the current connection
 type conn struct {
 	vfs      *vfs.VFS
+	session  *vfs.Session
 	handlers sftp.Handlers
 	what     string
 }
 
+// commandSession returns a Session for running the command binary
+// so its operations are recorded in the audit log under its name.
+func (c *conn) commandSession(binary string) *vfs.Session {
+	info := c.session.Info()
+	info.Protocol = binary
+	return c.vfs.Session(info)
+}
+
 // execCommand implements an extremely limited number of commands to
-// interoperate with the rclone sftp backend
-func (c *conn) execCommand(ctx context.Context, out io.Writer, command string) (err error) {
+// interoperate with the rclone sftp backend, scp and rsync
+func (c *conn) execCommand(ctx context.Context, in io.Reader, out io.Writer, command string) (err error) {
 	binary, args := command, ""
 	space := strings.Index(command, " ")
 	if space >= 0 {
@@ -67,23 +152,29 @@ func (c *conn) execCommand(ctx context.Context, out io.Writer, command string) (
 	fs.Debugf(c.what, "exec command: binary = %q, args = %q", binary, args)
 	switch binary {
 	case "df":
-		about := c.vfs.Fs().Features().About
-		if about == nil {
-			return errors.New("df not supported")
-		}
-		usage, err := about(ctx)
-		if err != nil {
-			return fmt.Errorf("about failed: %w", err)
-		}
 		total, used, free := int64(-1), int64(-1), int64(-1)
-		if usage.Total != nil {
-			total = *usage.Total / 1024
-		}
-		if usage.Used != nil {
-			used = *usage.Used / 1024
-		}
-		if usage.Free != nil {
-			free = *usage.Free / 1024
+		if q, ok := c.vfs.Quota(); ok && q.MaxSize >= 0 {
+			// Report the quota rather than the remote
+			total, used, free = c.vfs.Statfs()
+			total, used, free = total/1024, used/1024, free/1024
+		} else {
+			about := c.vfs.Fs().Features().About
+			if about == nil {
+				return errors.New("df not supported")
+			}
+			usage, err := about(ctx)
+			if err != nil {
+				return fmt.Errorf("about failed: %w", err)
+			}
+			if usage.Total != nil {
+				total = *usage.Total / 1024
+			}
+			if usage.Used != nil {
+				used = *usage.Used / 1024
+			}
+			if usage.Free != nil {
+				free = *usage.Free / 1024
+			}
 		}
 		perc := int64(0)
 		if total > 0 && used >= 0 {
@@ -183,6 +274,18 @@ func (c *conn) execCommand(ctx context.Context, out io.Writer, command string) (
 				return fmt.Errorf("send output failed: %w", err)
 			}
 		}
+	case "scp":
+		words, err := shellSplit(command)
+		if err != nil {
+			return err
+		}
+		return runSCP(c.commandSession(binary), in, out, words[1:])
+	case "rsync":
+		words, err := shellSplit(command)
+		if err != nil {
+			return err
+		}
+		return runRsync(c.commandSession(binary), in, out, words[1:])
 	default:
 		return fmt.Errorf("%q not implemented", command)
 	}
@@ -259,7 +362,7 @@ func (c *conn) handleChannel(newChannel ssh.NewChannel) {
 		}
 	} else {
 		var rc = uint32(0)
-		err := c.execCommand(context.TODO(), channel, command.Command)
+		err := c.execCommand(context.TODO(), channel, channel, command.Command)
 		if err != nil {
 			rc = 1
 			_, errPrint := fmt.Fprintf(channel.Stderr(), "%v\n", err)
@@ -307,7 +410,7 @@ func serveStdio(f fs.Fs) error {
 		stdin:  os.Stdin,
 		stdout: os.Stdout,
 	}
-	handlers := newVFSHandler(vfs.New(f, &vfsflags.Opt))
+	handlers := newVFSHandler(vfs.New(f, &vfsflags.Opt).Session(vfs.AuditInfo{Protocol: "sftp"}))
 	return serveChannel(sshChannel, handlers, "stdio")
 }
 
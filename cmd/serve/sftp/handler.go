@@ -15,12 +15,12 @@ import (
 
 // vfsHandler converts the VFS to be served by SFTP
 type vfsHandler struct {
-	*vfs.VFS
+	*vfs.Session
 }
 
 // vfsHandler returns a Handlers object with the test handlers.
-func newVFSHandler(vfs *vfs.VFS) sftp.Handlers {
-	v := vfsHandler{VFS: vfs}
+func newVFSHandler(session *vfs.Session) sftp.Handlers {
+	v := vfsHandler{Session: session}
 	return sftp.Handlers{
 		FileGet:  v,
 		FilePut:  v,
@@ -90,6 +90,37 @@ func (v vfsHandler) Filecmd(r *sftp.Request) error {
 	return nil
 }
 
+// Values used by StatVFS
+const (
+	statVFSBlockSize = 4096 // block size reported
+	statVFSReadOnly  = 0x1  // SSH_FXE_STATVFS_ST_RDONLY flag
+)
+
+// StatVFS returns the space used and available for the "df" command
+// of sftp clients
+func (v vfsHandler) StatVFS(r *sftp.Request) (*sftp.StatVFS, error) {
+	total, _, free := v.Statfs()
+	stat := &sftp.StatVFS{
+		Bsize:   statVFSBlockSize,
+		Frsize:  statVFSBlockSize,
+		Blocks:  uint64(total) / statVFSBlockSize,
+		Bfree:   uint64(free) / statVFSBlockSize,
+		Bavail:  uint64(free) / statVFSBlockSize,
+		Namemax: 255,
+	}
+	if q, ok := v.Quota(); ok && q.MaxFiles >= 0 {
+		stat.Files = uint64(q.MaxFiles)
+		if q.Files < q.MaxFiles {
+			stat.Ffree = uint64(q.MaxFiles - q.Files)
+		}
+		stat.Favail = stat.Ffree
+	}
+	if v.Opt.ReadOnly {
+		stat.Flag |= statVFSReadOnly
+	}
+	return stat, nil
+}
+
 type listerat []os.FileInfo
 
 // Modeled after strings.Reader's ReadAt() implementation
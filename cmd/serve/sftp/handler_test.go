@@ -0,0 +1,45 @@
+//go:build !plan9
+
+package sftp
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/vfs"
+	"github.com/rclone/rclone/vfs/vfscommon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatVFS(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "file.txt"), make([]byte, 3*statVFSBlockSize), 0666))
+	f, err := fs.NewFs(context.Background(), dir)
+	require.NoError(t, err)
+
+	opt := vfscommon.DefaultOpt
+	opt.QuotaSize = 10 * statVFSBlockSize
+	opt.QuotaFiles = 5
+	v := vfsHandler{Session: vfs.New(f, &opt).Session(vfs.AuditInfo{})}
+	defer v.Shutdown()
+
+	// The usage is counted in the background
+	var stat *sftp.StatVFS
+	assert.Eventually(t, func() bool {
+		stat, err = v.StatVFS(nil)
+		require.NoError(t, err)
+		return stat.Ffree == 4
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, uint64(10*statVFSBlockSize), stat.TotalSpace())
+	assert.Equal(t, uint64(7*statVFSBlockSize), stat.FreeSpace())
+	assert.Equal(t, uint64(5), stat.Files)
+	assert.Equal(t, uint64(4), stat.Ffree)
+	assert.Equal(t, uint64(0), stat.Flag)
+}
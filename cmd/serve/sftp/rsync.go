@@ -0,0 +1,1562 @@
+//go:build !plan9
+
+package sftp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/vfs"
+	"golang.org/x/crypto/md4" //nolint:staticcheck // MD4 is what the rsync protocol uses
+)
+
+// This implements the server side of the rsync protocol, version 29,
+// as used by rsync 2.6.4 onwards. Newer clients negotiate down to it.
+//
+// The client runs "rsync --server [--sender] <options> . <paths>"
+// over ssh and then speaks the rsync protocol on stdin/stdout.
+//
+// Only regular files and directories are transferred. Compression,
+// hard links, ACLs, xattrs, --checksum and filter rules when sending
+// are not supported and are rejected.
+
+const (
+	rsyncProtocol   = 29        // the protocol version we speak
+	rsyncChunkSize  = 32 * 1024 // max size of a literal data token
+	rsyncBlockSize  = 700       // the minimum block size
+	rsyncMaxBlock   = 1 << 17   // the maximum block size we choose
+	rsyncMaxName    = 4096      // the maximum length of a file name
+	rsyncSumLength  = md4.Size  // length of the strong checksums
+	rsyncNdxDone    = -1        // index ending a phase
+	rsyncMaxPhase   = 2         // phases in protocol 29
+	rsyncMplexBase  = 7         // added to message tags
+	rsyncMsgData    = 0         // multiplexed data
+	rsyncMsgError   = 3         // multiplexed error message
+	rsyncMsgInfo    = 2         // multiplexed info message
+	rsyncIOErrorGen = 1         // io_error bit for general errors
+	rsyncMaxMessage = 0xFFFFFF  // max length of a multiplexed message
+)
+
+// Flags sent with each file list entry
+const (
+	rsyncXmitTopDir        = 1 << 0
+	rsyncXmitSameMode      = 1 << 1
+	rsyncXmitExtendedFlags = 1 << 2
+	rsyncXmitSameUID       = 1 << 3
+	rsyncXmitSameGID       = 1 << 4
+	rsyncXmitSameName      = 1 << 5
+	rsyncXmitLongName      = 1 << 6
+	rsyncXmitSameTime      = 1 << 7
+	rsyncXmitSameRdevMajor = 1 << 8
+	rsyncXmitHlinked       = 1 << 9
+	rsyncXmitRdevMinor8    = 1 << 11
+)
+
+// Flags sent with the index of each file being transferred
+const (
+	rsyncItemBasisFollows = 1 << 11
+	rsyncItemXnameFollows = 1 << 12
+	rsyncItemIsNew        = 1 << 13
+	rsyncItemTransfer     = 1 << 15
+)
+
+// File types in the modes sent in the file list
+const (
+	rsyncModeTypeMask = 0170000
+	rsyncModeDir      = 0040000
+	rsyncModeReg      = 0100000
+	rsyncModeLink     = 0120000
+	rsyncModeChr      = 0020000
+	rsyncModeBlk      = 0060000
+	rsyncModeFifo     = 0010000
+	rsyncModeSock     = 0140000
+)
+
+// errRsyncPartial is returned if some files couldn't be transferred
+var errRsyncPartial = errors.New("rsync: some files could not be transferred")
+
+// rsyncOptions are the options the client passes to the server
+type rsyncOptions struct {
+	sender         bool // the server sends the files
+	recursive      bool // -r
+	preserveLinks  bool // -l
+	preserveUID    bool // -o
+	preserveGID    bool // -g
+	preserveDevs   bool // -D or --devices
+	preserveSpecs  bool // -D or --specials
+	preserveTimes  bool // -t
+	wholeFile      bool // -W
+	ignoreTimes    bool // -I
+	sizeOnly       bool // --size-only
+	update         bool // -u
+	dryRun         bool // -n
+	numericIDs     bool // --numeric-ids
+	deleteMode     bool // --delete and friends
+	pruneEmptyDirs bool // -m
+	paths          []string
+}
+
+// parseRsyncArgs parses the arguments to "rsync --server"
+func parseRsyncArgs(args []string) (opt rsyncOptions, err error) {
+	if len(args) == 0 || args[0] != "--server" {
+		return opt, errors.New("rsync: only --server mode is supported")
+	}
+	args = args[1:]
+	for len(args) > 0 && args[0] != "." {
+		arg := args[0]
+		args = args[1:]
+		if strings.HasPrefix(arg, "--") {
+			name, _, _ := strings.Cut(arg[2:], "=")
+			switch {
+			case name == "sender":
+				opt.sender = true
+			case name == "size-only":
+				opt.sizeOnly = true
+			case name == "numeric-ids":
+				opt.numericIDs = true
+			case name == "devices":
+				opt.preserveDevs = true
+			case name == "specials":
+				opt.preserveSpecs = true
+			case name == "no-specials":
+				opt.preserveSpecs = false
+			case name == "no-devices":
+				opt.preserveDevs = false
+			case strings.HasPrefix(name, "delete"):
+				opt.deleteMode = true
+			case name == "files-from", name == "from0", name == "append", name == "append-verify",
+				name == "checksum-seed", name == "compress-level", name == "protect-args":
+				return opt, fmt.Errorf("rsync: option --%s is not supported", name)
+			default:
+				fs.Debugf(nil, "rsync: ignoring option %q", arg)
+			}
+			continue
+		}
+		if !strings.HasPrefix(arg, "-") {
+			return opt, fmt.Errorf("rsync: unexpected argument %q", arg)
+		}
+	flags:
+		for _, c := range arg[1:] {
+			switch c {
+			case 'e':
+				// the rest are protocol 30 capabilities
+				break flags
+			case 'r':
+				opt.recursive = true
+			case 'l':
+				opt.preserveLinks = true
+			case 'o':
+				opt.preserveUID = true
+			case 'g':
+				opt.preserveGID = true
+			case 'D':
+				opt.preserveDevs = true
+				opt.preserveSpecs = true
+			case 't':
+				opt.preserveTimes = true
+			case 'W':
+				opt.wholeFile = true
+			case 'I':
+				opt.ignoreTimes = true
+			case 'u':
+				opt.update = true
+			case 'n':
+				opt.dryRun = true
+			case 'm':
+				opt.pruneEmptyDirs = true
+			case 'z', 'c', 'H', 'A', 'X', 's', 'R':
+				return opt, fmt.Errorf("rsync: option -%c is not supported", c)
+			default:
+				// options which only change behaviour we don't implement
+			}
+		}
+	}
+	if len(args) == 0 {
+		return opt, errors.New("rsync: missing \".\" argument")
+	}
+	opt.paths = args[1:]
+	if len(opt.paths) == 0 {
+		opt.paths = []string{"."}
+	}
+	if !opt.sender && len(opt.paths) != 1 {
+		return opt, errors.New("rsync: the receiver needs exactly one destination")
+	}
+	return opt, nil
+}
+
+// rsyncMux writes multiplexed messages to the client
+type rsyncMux struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+// writeMsg writes data to the client as messages with tag
+func (m *rsyncMux) writeMsg(tag int, data []byte) (err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for len(data) > 0 {
+		n := len(data)
+		if n > rsyncMaxMessage {
+			n = rsyncMaxMessage
+		}
+		var header [4]byte
+		binary.LittleEndian.PutUint32(header[:], uint32(rsyncMplexBase+tag)<<24|uint32(n))
+		if _, err = m.out.Write(header[:]); err != nil {
+			return err
+		}
+		if _, err = m.out.Write(data[:n]); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+// Write implements io.Writer sending p as data
+func (m *rsyncMux) Write(p []byte) (int, error) {
+	if err := m.writeMsg(rsyncMsgData, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// rsyncConn reads and writes the primitive types of the rsync
+// protocol.
+//
+// Errors are sticky - after one the reads return zero values and the
+// writes do nothing, so they only need checking at the end of each
+// step with err().
+type rsyncConn struct {
+	opt     rsyncOptions
+	seed    uint32
+	in      *bufio.Reader
+	out     *bufio.Writer
+	mux     *rsyncMux
+	readN   int64 // bytes read
+	written int64 // bytes written
+	rErr    error
+	wErr    error
+
+	mu      sync.Mutex
+	ioError int32 // io_error flags sent to the client
+}
+
+// Read implements io.Reader counting the bytes read
+func (c *rsyncConn) Read(p []byte) (n int, err error) {
+	n, err = c.in.Read(p)
+	c.readN += int64(n)
+	return n, err
+}
+
+// err returns the first error reading or writing
+func (c *rsyncConn) err() error {
+	if c.rErr != nil {
+		return c.rErr
+	}
+	return c.wErr
+}
+
+func (c *rsyncConn) readFull(p []byte) {
+	if c.rErr != nil {
+		for i := range p {
+			p[i] = 0
+		}
+		return
+	}
+	if _, err := io.ReadFull(c, p); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		c.rErr = fmt.Errorf("rsync: read failed: %w", err)
+	}
+}
+
+func (c *rsyncConn) readBytes(n int) []byte {
+	p := make([]byte, n)
+	c.readFull(p)
+	return p
+}
+
+func (c *rsyncConn) readByte() byte {
+	var p [1]byte
+	c.readFull(p[:])
+	return p[0]
+}
+
+func (c *rsyncConn) readShort() uint16 {
+	var p [2]byte
+	c.readFull(p[:])
+	return binary.LittleEndian.Uint16(p[:])
+}
+
+func (c *rsyncConn) readInt() int32 {
+	var p [4]byte
+	c.readFull(p[:])
+	return int32(binary.LittleEndian.Uint32(p[:]))
+}
+
+// readLongint reads a 64 bit int sent as an int if it fits
+func (c *rsyncConn) readLongint() int64 {
+	n := c.readInt()
+	if n != -1 {
+		return int64(n)
+	}
+	var p [8]byte
+	c.readFull(p[:])
+	return int64(binary.LittleEndian.Uint64(p[:]))
+}
+
+// readVstring reads a string sent with a variable length header
+func (c *rsyncConn) readVstring() string {
+	n := int(c.readByte())
+	if n&0x80 != 0 {
+		n = (n&^0x80)<<8 | int(c.readByte())
+	}
+	return string(c.readBytes(n))
+}
+
+func (c *rsyncConn) write(p []byte) {
+	if c.wErr != nil {
+		return
+	}
+	n, err := c.out.Write(p)
+	c.written += int64(n)
+	if err != nil {
+		c.wErr = fmt.Errorf("rsync: write failed: %w", err)
+	}
+}
+
+func (c *rsyncConn) writeByte(b byte) {
+	c.write([]byte{b})
+}
+
+func (c *rsyncConn) writeShort(n uint16) {
+	var p [2]byte
+	binary.LittleEndian.PutUint16(p[:], n)
+	c.write(p[:])
+}
+
+func (c *rsyncConn) writeInt(n int32) {
+	var p [4]byte
+	binary.LittleEndian.PutUint32(p[:], uint32(n))
+	c.write(p[:])
+}
+
+// writeLongint writes a 64 bit int as an int if it fits
+func (c *rsyncConn) writeLongint(n int64) {
+	if n >= 0 && n <= math.MaxInt32 {
+		c.writeInt(int32(n))
+		return
+	}
+	c.writeInt(-1)
+	var p [8]byte
+	binary.LittleEndian.PutUint64(p[:], uint64(n))
+	c.write(p[:])
+}
+
+// flush sends any buffered output to the client
+func (c *rsyncConn) flush() {
+	if c.wErr != nil {
+		return
+	}
+	if err := c.out.Flush(); err != nil {
+		c.wErr = fmt.Errorf("rsync: write failed: %w", err)
+	}
+}
+
+// message sends a message to be shown by the client. It is sent out
+// of band so it can be used while another go routine is writing.
+func (c *rsyncConn) message(tag int, format string, a ...interface{}) {
+	msg := fmt.Sprintf(format, a...)
+	if tag == rsyncMsgError {
+		c.mu.Lock()
+		c.ioError |= rsyncIOErrorGen
+		c.mu.Unlock()
+		fs.Errorf(nil, "%s", msg)
+	}
+	if c.mux != nil {
+		_ = c.mux.writeMsg(tag, []byte(msg+"\n"))
+	}
+}
+
+// rsyncFile is an entry in the file list
+type rsyncFile struct {
+	dir    string // directory part of the name or "" if none
+	base   string // leaf part of the name
+	mode   uint32 // unix mode including the file type
+	size   int64
+	mtime  int64
+	topDir bool   // a directory named on the command line
+	remote string // path of the file in the VFS when sending
+}
+
+// name returns the name of the file relative to the transfer root
+func (f *rsyncFile) name() string {
+	if f.dir == "" {
+		return f.base
+	}
+	return f.dir + "/" + f.base
+}
+
+func (f *rsyncFile) isDir() bool {
+	return f.mode&rsyncModeTypeMask == rsyncModeDir
+}
+
+func (f *rsyncFile) isRegular() bool {
+	return f.mode&rsyncModeTypeMask == rsyncModeReg
+}
+
+// newRsyncFile makes a file list entry called name for node
+func newRsyncFile(name string, remote string, node vfs.Node) *rsyncFile {
+	dir, base := path.Split(name)
+	f := &rsyncFile{
+		dir:    strings.TrimSuffix(dir, "/"),
+		base:   base,
+		mode:   uint32(node.Mode().Perm()),
+		mtime:  node.ModTime().Unix(),
+		remote: remote,
+	}
+	if node.IsDir() {
+		f.mode |= rsyncModeDir
+	} else {
+		f.mode |= rsyncModeReg
+		f.size = node.Size()
+	}
+	return f
+}
+
+// States and types used by rsyncCompare
+const (
+	rsyncStateDir = iota
+	rsyncStateSlash
+	rsyncStateBase
+	rsyncStateTrailing
+	rsyncTypePath = 0
+	rsyncTypeItem = 1
+)
+
+// rsyncCursor walks through the name of a file for rsyncCompare
+type rsyncCursor struct {
+	f     *rsyncFile
+	s     string
+	state int
+	typ   int
+}
+
+// base starts the cursor on the leaf name of the file
+func (c *rsyncCursor) base() {
+	c.typ = rsyncTypeItem
+	if c.f.isDir() {
+		c.typ = rsyncTypePath
+	}
+	c.s = c.f.base
+	if c.typ == rsyncTypePath && c.s == "." {
+		c.typ = rsyncTypeItem
+		c.state = rsyncStateTrailing
+		c.s = ""
+	} else {
+		c.state = rsyncStateBase
+	}
+}
+
+// next moves the cursor on to the next part of the name when the
+// current part is exhausted
+func (c *rsyncCursor) next() {
+	switch c.state {
+	case rsyncStateDir:
+		c.state = rsyncStateSlash
+		c.s = "/"
+	case rsyncStateSlash:
+		c.base()
+	case rsyncStateBase:
+		c.state = rsyncStateTrailing
+		if c.typ == rsyncTypePath {
+			c.s = "/"
+			break
+		}
+		c.typ = rsyncTypeItem
+	case rsyncStateTrailing:
+		c.typ = rsyncTypeItem
+	}
+}
+
+// rsyncCompare compares two file list entries in the same way as
+// f_name_cmp in rsync so both ends sort the file list the same way.
+//
+// Directories sort as if their names have a trailing "/", and files
+// sort before directories in the same directory.
+func rsyncCompare(f1, f2 *rsyncFile) int {
+	c1, c2 := rsyncCursor{f: f1}, rsyncCursor{f: f2}
+	if f1.dir == f2.dir {
+		c1.base()
+		c2.base()
+	} else {
+		for _, c := range []*rsyncCursor{&c1, &c2} {
+			if c.f.dir == "" {
+				c.base()
+			} else {
+				c.typ, c.state, c.s = rsyncTypePath, rsyncStateDir, c.f.dir
+			}
+		}
+	}
+	if c1.typ != c2.typ {
+		if c1.typ == rsyncTypePath {
+			return 1
+		}
+		return -1
+	}
+	for {
+		if c1.s == "" {
+			c1.next()
+			if c2.s != "" && c1.typ != c2.typ {
+				if c1.typ == rsyncTypePath {
+					return 1
+				}
+				return -1
+			}
+		}
+		if c2.s == "" {
+			c2.next()
+			if c1.s != "" && c1.typ != c2.typ {
+				if c1.typ == rsyncTypePath {
+					return 1
+				}
+				return -1
+			}
+		}
+		if c1.s == "" || c2.s == "" {
+			return len(c1.s) - len(c2.s)
+		}
+		if c1.s[0] != c2.s[0] {
+			return int(c1.s[0]) - int(c2.s[0])
+		}
+		c1.s, c2.s = c1.s[1:], c2.s[1:]
+	}
+}
+
+// sortRsyncFiles sorts the file list into the order used by rsync
+func sortRsyncFiles(files []*rsyncFile) {
+	sort.SliceStable(files, func(i, j int) bool {
+		return rsyncCompare(files[i], files[j]) < 0
+	})
+}
+
+// writeFileList sends the file list to the client
+func (c *rsyncConn) writeFileList(files []*rsyncFile) {
+	for _, f := range files {
+		var xflags uint16
+		if f.topDir && f.isDir() {
+			xflags |= rsyncXmitTopDir
+		}
+		name := f.name()
+		if len(name) > 255 {
+			xflags |= rsyncXmitLongName
+		}
+		if xflags == 0 && !f.isDir() {
+			// the flags can't be 0 as that ends the list
+			xflags |= rsyncXmitTopDir
+		}
+		if xflags == 0 {
+			xflags |= rsyncXmitExtendedFlags
+			c.writeShort(xflags)
+		} else {
+			c.writeByte(byte(xflags))
+		}
+		if xflags&rsyncXmitLongName != 0 {
+			c.writeInt(int32(len(name)))
+		} else {
+			c.writeByte(byte(len(name)))
+		}
+		c.write([]byte(name))
+		c.writeLongint(f.size)
+		c.writeInt(int32(f.mtime))
+		c.writeInt(int32(f.mode))
+		if c.opt.preserveUID {
+			c.writeInt(0)
+		}
+		if c.opt.preserveGID {
+			c.writeInt(0)
+		}
+	}
+	c.writeByte(0)
+	// empty uid and gid lists
+	if c.opt.preserveUID && !c.opt.numericIDs {
+		c.writeInt(0)
+	}
+	if c.opt.preserveGID && !c.opt.numericIDs {
+		c.writeInt(0)
+	}
+	c.writeInt(c.getIOError())
+}
+
+// getIOError returns the io_error flags to send to the client
+func (c *rsyncConn) getIOError() int32 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ioError
+}
+
+// readFileList reads the file list sent by the client
+func (c *rsyncConn) readFileList() (files []*rsyncFile, err error) {
+	var (
+		lastName string
+		mode     uint32
+		mtime    int64
+	)
+	for {
+		xflags := uint16(c.readByte())
+		if xflags == 0 || c.rErr != nil {
+			break
+		}
+		if xflags&rsyncXmitExtendedFlags != 0 {
+			xflags |= uint16(c.readByte()) << 8
+		}
+		var l1, l2 int
+		if xflags&rsyncXmitSameName != 0 {
+			l1 = int(c.readByte())
+		}
+		if xflags&rsyncXmitLongName != 0 {
+			l2 = int(c.readInt())
+		} else {
+			l2 = int(c.readByte())
+		}
+		if l1 > len(lastName) || l2 < 0 || l1+l2 > rsyncMaxName {
+			return nil, fmt.Errorf("rsync: bad file name length in file list")
+		}
+		name := lastName[:l1] + string(c.readBytes(l2))
+		lastName = name
+		size := c.readLongint()
+		if xflags&rsyncXmitSameTime == 0 {
+			mtime = int64(c.readInt())
+		}
+		if xflags&rsyncXmitSameMode == 0 {
+			mode = uint32(c.readInt())
+		}
+		if c.opt.preserveUID && xflags&rsyncXmitSameUID == 0 {
+			_ = c.readInt()
+		}
+		if c.opt.preserveGID && xflags&rsyncXmitSameGID == 0 {
+			_ = c.readInt()
+		}
+		fileType := mode & rsyncModeTypeMask
+		isDevice := fileType == rsyncModeChr || fileType == rsyncModeBlk
+		isSpecial := fileType == rsyncModeFifo || fileType == rsyncModeSock
+		if (c.opt.preserveDevs && isDevice) || (c.opt.preserveSpecs && isSpecial) {
+			if xflags&rsyncXmitSameRdevMajor == 0 {
+				_ = c.readInt()
+			}
+			if xflags&rsyncXmitRdevMinor8 != 0 {
+				_ = c.readByte()
+			} else {
+				_ = c.readInt()
+			}
+			size = 0
+		}
+		if c.opt.preserveLinks && fileType == rsyncModeLink {
+			n := int(c.readInt())
+			if n < 0 || n > rsyncMaxName {
+				return nil, fmt.Errorf("rsync: bad symlink length in file list")
+			}
+			_ = c.readBytes(n)
+		}
+		if xflags&rsyncXmitHlinked != 0 {
+			return nil, errors.New("rsync: hard links are not supported")
+		}
+		if clean := path.Clean(name); name != clean || path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return nil, fmt.Errorf("rsync: unsafe file name %q in file list", name)
+		}
+		dir, base := path.Split(name)
+		files = append(files, &rsyncFile{
+			dir:   strings.TrimSuffix(dir, "/"),
+			base:  base,
+			mode:  mode,
+			size:  size,
+			mtime: mtime,
+		})
+	}
+	for _, preserve := range []bool{c.opt.preserveUID, c.opt.preserveGID} {
+		if preserve && !c.opt.numericIDs {
+			// the names of the ids which we don't use
+			for c.readInt() != 0 && c.rErr == nil {
+				_ = c.readBytes(int(c.readByte()))
+			}
+		}
+	}
+	if c.readInt() != 0 {
+		fs.Debugf(nil, "rsync: client had errors reading the files to send")
+	}
+	return files, c.rErr
+}
+
+// rsyncSums are the checksums of the blocks of a basis file
+type rsyncSums struct {
+	count     int32 // number of blocks
+	blength   int32 // block length
+	s2length  int32 // length of the strong checksums
+	remainder int32 // length of the last block if short
+	weak      []uint32
+	strong    [][]byte
+}
+
+// blockLen returns the length of block i
+func (s *rsyncSums) blockLen(i int32) int32 {
+	if i == s.count-1 && s.remainder != 0 {
+		return s.remainder
+	}
+	return s.blength
+}
+
+// rsyncWeakSum returns the rolling checksum of p
+//
+// Note that rsync treats the bytes as signed.
+func rsyncWeakSum(p []byte) (s1, s2 uint32) {
+	for _, b := range p {
+		s1 += uint32(int8(b))
+		s2 += s1
+	}
+	return s1, s2
+}
+
+// strongSum returns the strong checksum of p
+func (c *rsyncConn) strongSum(p []byte) []byte {
+	h := md4.New()
+	_, _ = h.Write(p)
+	if c.seed != 0 {
+		var seed [4]byte
+		binary.LittleEndian.PutUint32(seed[:], c.seed)
+		_, _ = h.Write(seed[:])
+	}
+	return h.Sum(nil)
+}
+
+// newFileSum returns the hash used for the checksum of a whole file
+func (c *rsyncConn) newFileSum() hash.Hash {
+	h := md4.New()
+	var seed [4]byte
+	binary.LittleEndian.PutUint32(seed[:], c.seed)
+	_, _ = h.Write(seed[:])
+	return h
+}
+
+// writeSumHead sends the description of the checksums in sums
+func (c *rsyncConn) writeSumHead(sums *rsyncSums) {
+	c.writeInt(sums.count)
+	c.writeInt(sums.blength)
+	c.writeInt(sums.s2length)
+	c.writeInt(sums.remainder)
+}
+
+// readSumHead reads the description of checksums
+func (c *rsyncConn) readSumHead() (*rsyncSums, error) {
+	sums := &rsyncSums{
+		count:     c.readInt(),
+		blength:   c.readInt(),
+		s2length:  c.readInt(),
+		remainder: c.readInt(),
+	}
+	if c.rErr != nil {
+		return nil, c.rErr
+	}
+	if sums.count < 0 || sums.blength < 0 || sums.blength > 1<<29 ||
+		sums.s2length < 0 || sums.s2length > rsyncSumLength ||
+		sums.remainder < 0 || sums.remainder > sums.blength {
+		return nil, errors.New("rsync: invalid checksum header")
+	}
+	return sums, nil
+}
+
+// writeSums sends the checksums of the basis file in, which is size
+// bytes long. If in is nil there is no basis file.
+func (c *rsyncConn) writeSums(in io.Reader, size int64) error {
+	sums := &rsyncSums{}
+	if in == nil || size <= 0 || c.opt.wholeFile {
+		c.writeSumHead(sums)
+		return nil
+	}
+	blength := int64(rsyncBlockSize)
+	if size > rsyncBlockSize*rsyncBlockSize {
+		blength = int64(math.Sqrt(float64(size))) &^ 7
+		if blength > rsyncMaxBlock {
+			blength = rsyncMaxBlock
+		}
+	}
+	sums.blength = int32(blength)
+	sums.count = int32((size + blength - 1) / blength)
+	sums.remainder = int32(size % blength)
+	sums.s2length = rsyncSumLength
+	c.writeSumHead(sums)
+	block := make([]byte, blength)
+	for i := int32(0); i < sums.count; i++ {
+		n := sums.blockLen(i)
+		if _, err := io.ReadFull(in, block[:n]); err != nil {
+			return fmt.Errorf("failed to read basis file: %w", err)
+		}
+		s1, s2 := rsyncWeakSum(block[:n])
+		c.writeInt(int32(s1&0xFFFF | s2<<16))
+		c.write(c.strongSum(block[:n]))
+	}
+	return nil
+}
+
+// readSums reads the checksums of a basis file
+func (c *rsyncConn) readSums() (*rsyncSums, error) {
+	sums, err := c.readSumHead()
+	if err != nil {
+		return nil, err
+	}
+	for i := int32(0); i < sums.count && c.rErr == nil; i++ {
+		sums.weak = append(sums.weak, uint32(c.readInt()))
+		sums.strong = append(sums.strong, c.readBytes(int(sums.s2length)))
+	}
+	return sums, c.rErr
+}
+
+// writeLiteral sends p as literal data tokens
+func (c *rsyncConn) writeLiteral(p []byte) {
+	for len(p) > 0 {
+		n := len(p)
+		if n > rsyncChunkSize {
+			n = rsyncChunkSize
+		}
+		c.writeInt(int32(n))
+		c.write(p[:n])
+		p = p[n:]
+	}
+}
+
+// sendDelta sends the contents of in to the client as literal data
+// and references to the blocks of its basis file described by sums,
+// followed by the checksum of the whole file.
+func (c *rsyncConn) sendDelta(in io.Reader, sums *rsyncSums) error {
+	fileSum := c.newFileSum()
+	if sums.count == 0 {
+		buf := make([]byte, rsyncChunkSize)
+		for {
+			n, err := io.ReadFull(in, buf)
+			c.writeLiteral(buf[:n])
+			_, _ = fileSum.Write(buf[:n])
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			} else if err != nil {
+				return err
+			}
+		}
+		c.writeInt(0)
+		c.write(fileSum.Sum(nil))
+		return c.err()
+	}
+	blocks := make(map[uint32][]int32, sums.count)
+	for i, sum := range sums.weak {
+		blocks[sum] = append(blocks[sum], int32(i))
+	}
+
+	// data holds the unsent part of the file, with the literal data
+	// waiting to be sent before pos and the block being checked
+	// after it.
+	var (
+		data    = make([]byte, 0, rsyncChunkSize+2*int(sums.blength)+rsyncChunkSize)
+		pos     int
+		eof     bool
+		s1, s2  uint32
+		k       int // length of the block being checked
+		rolling bool
+	)
+	fill := func(n int) error {
+		for len(data) < n && !eof {
+			if cap(data)-len(data) < rsyncChunkSize {
+				data = append(data[:cap(data)], make([]byte, rsyncChunkSize)...)[:len(data)]
+			}
+			m, err := in.Read(data[len(data):cap(data)])
+			data = data[:len(data)+m]
+			if err == io.EOF {
+				eof = true
+			} else if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	// flushLiteral sends the data before end as literal data
+	flushLiteral := func(end int) {
+		c.writeLiteral(data[:end])
+		_, _ = fileSum.Write(data[:end])
+		data = append(data[:0], data[end:]...)
+		pos -= end
+	}
+	for {
+		if err := fill(pos + int(sums.blength) + 1); err != nil {
+			return err
+		}
+		if !rolling {
+			k = len(data) - pos
+			if k > int(sums.blength) {
+				k = int(sums.blength)
+			}
+			if k == 0 {
+				break
+			}
+			s1, s2 = rsyncWeakSum(data[pos : pos+k])
+			rolling = true
+		}
+		if candidates, ok := blocks[s1&0xFFFF|s2<<16]; ok {
+			var strong []byte
+			matched := int32(-1)
+			for _, i := range candidates {
+				if int(sums.blockLen(i)) != k {
+					continue
+				}
+				if strong == nil {
+					strong = c.strongSum(data[pos : pos+k])
+				}
+				if bytes.Equal(strong[:sums.s2length], sums.strong[i]) {
+					matched = i
+					break
+				}
+			}
+			if matched >= 0 {
+				flushLiteral(pos)
+				c.writeInt(-(matched + 1))
+				_, _ = fileSum.Write(data[:k])
+				data = append(data[:0], data[k:]...)
+				rolling = false
+				continue
+			}
+		}
+		// Roll the checksum on by a byte, shrinking the block at
+		// the end of the file
+		old := uint32(int8(data[pos]))
+		s1 -= old
+		s2 -= uint32(k) * old
+		if pos+k < len(data) {
+			s1 += uint32(int8(data[pos+k]))
+			s2 += s1
+		} else {
+			k--
+		}
+		pos++
+		if k == 0 {
+			break
+		}
+		if pos >= rsyncChunkSize {
+			flushLiteral(pos)
+		}
+	}
+	flushLiteral(len(data))
+	c.writeInt(0)
+	c.write(fileSum.Sum(nil))
+	return c.err()
+}
+
+// receiveDelta reads the literal data and block references sent for
+// a file, writing the file to out using blocks from basis described by
+// sums, then checks the checksum of the whole file.
+//
+// It returns an error only if the protocol failed, any error writing
+// out or reading basis is returned in fileErr.
+func (c *rsyncConn) receiveDelta(basis io.ReaderAt, sums *rsyncSums, out io.Writer) (fileErr error, err error) {
+	fileSum := c.newFileSum()
+	buf := make([]byte, rsyncChunkSize)
+	write := func(p []byte) {
+		_, _ = fileSum.Write(p)
+		if fileErr == nil {
+			_, fileErr = out.Write(p)
+		}
+	}
+	for {
+		token := c.readInt()
+		if c.rErr != nil {
+			return fileErr, c.rErr
+		}
+		if token == 0 {
+			break
+		} else if token > 0 {
+			if token > rsyncChunkSize {
+				return fileErr, errors.New("rsync: invalid literal data length")
+			}
+			c.readFull(buf[:token])
+			write(buf[:token])
+			continue
+		}
+		i := -(token + 1)
+		if i >= sums.count {
+			return fileErr, fmt.Errorf("rsync: invalid block %d", i)
+		}
+		block := make([]byte, sums.blockLen(i))
+		if basis == nil {
+			if fileErr == nil {
+				fileErr = errors.New("basis file missing")
+			}
+		} else if _, readErr := basis.ReadAt(block, int64(i)*int64(sums.blength)); readErr != nil && readErr != io.EOF && fileErr == nil {
+			fileErr = fmt.Errorf("failed to read basis file: %w", readErr)
+		}
+		write(block)
+	}
+	sum := c.readBytes(rsyncSumLength)
+	if c.rErr != nil {
+		return fileErr, c.rErr
+	}
+	if fileErr == nil && !bytes.Equal(sum, fileSum.Sum(nil)) {
+		fileErr = errors.New("file failed verification")
+	}
+	return fileErr, nil
+}
+
+// readNdx reads the index of a file and its item flags, skipping the
+// extra information which may follow them.
+func (c *rsyncConn) readNdx() (ndx int32, iflags uint16, extra []byte) {
+	ndx = c.readInt()
+	if ndx == rsyncNdxDone {
+		return ndx, 0, nil
+	}
+	iflags = c.readShort()
+	if iflags&rsyncItemBasisFollows != 0 {
+		extra = append(extra, c.readByte())
+	}
+	if iflags&rsyncItemXnameFollows != 0 {
+		extra = append(extra, vstring(c.readVstring())...)
+	}
+	return ndx, iflags, extra
+}
+
+// vstring encodes s as sent by writeVstring
+func vstring(s string) []byte {
+	var b []byte
+	if len(s) > 0x7F {
+		b = append(b, byte(len(s)>>8)|0x80)
+	}
+	b = append(b, byte(len(s)))
+	return append(b, s...)
+}
+
+// runRsync runs "rsync --server" with args reading from in and
+// writing to out.
+func runRsync(s *vfs.Session, in io.Reader, out io.Writer, args []string) error {
+	opt, err := parseRsyncArgs(args)
+	if err != nil {
+		return err
+	}
+	c := &rsyncConn{
+		opt: opt,
+		in:  bufio.NewReader(in),
+		out: bufio.NewWriter(out),
+	}
+
+	// Exchange protocol versions and send the checksum seed
+	c.writeInt(rsyncProtocol)
+	c.flush()
+	remote := c.readInt()
+	if err = c.err(); err != nil {
+		return err
+	}
+	if remote < rsyncProtocol {
+		return fmt.Errorf("rsync: protocol version %d not supported - need %d or later", remote, rsyncProtocol)
+	}
+	c.seed = uint32(time.Now().Unix())
+	c.writeInt(int32(c.seed))
+	c.flush()
+	if err = c.err(); err != nil {
+		return err
+	}
+
+	// From now on everything sent to the client is multiplexed
+	c.mux = &rsyncMux{out: out}
+	c.out = bufio.NewWriterSize(c.mux, rsyncChunkSize+1024)
+
+	if opt.sender {
+		err = c.sendFiles(s)
+	} else {
+		err = c.receiveFiles(s)
+	}
+	if err != nil {
+		c.message(rsyncMsgError, "%v", err)
+		return err
+	}
+	if c.getIOError() != 0 {
+		return errRsyncPartial
+	}
+	return nil
+}
+
+// readFilterList reads the filter rules sent by the client
+func (c *rsyncConn) readFilterList() (rules []string, err error) {
+	for {
+		n := c.readInt()
+		if n == 0 || c.rErr != nil {
+			break
+		}
+		if n < 0 || n > rsyncMaxName {
+			return nil, errors.New("rsync: invalid filter rule length")
+		}
+		rules = append(rules, string(c.readBytes(int(n))))
+	}
+	return rules, c.rErr
+}
+
+// buildFileList makes the file list for the paths the client asked for
+func (c *rsyncConn) buildFileList(s *vfs.Session) (files []*rsyncFile) {
+	var walk func(prefix string, remote string, dir *vfs.Dir)
+	walk = func(prefix string, remote string, dir *vfs.Dir) {
+		nodes, err := dir.ReadDirAll()
+		if err != nil {
+			c.message(rsyncMsgError, "rsync: opendir %q failed: %v", remote, err)
+			return
+		}
+		for _, node := range nodes {
+			name := path.Join(prefix, node.Name())
+			nodeRemote := path.Join(remote, node.Name())
+			files = append(files, newRsyncFile(name, nodeRemote, node))
+			if node.IsDir() {
+				walk(name, nodeRemote, node.(*vfs.Dir))
+			}
+		}
+	}
+	for _, arg := range c.opt.paths {
+		remote := vfsPath(arg)
+		node, err := s.Stat(remote)
+		if err != nil {
+			c.message(rsyncMsgError, "rsync: link_stat %q failed: %v", arg, err)
+			continue
+		}
+		if !node.IsDir() {
+			files = append(files, newRsyncFile(node.Name(), remote, node))
+			continue
+		}
+		if !c.opt.recursive {
+			c.message(rsyncMsgInfo, "skipping directory %s", arg)
+			continue
+		}
+		// With a trailing slash the contents of the directory
+		// are sent rather than the directory itself
+		name := node.Name()
+		if remote == "" || strings.HasSuffix(arg, "/") || strings.HasSuffix(arg, "/.") || arg == "." {
+			name = "."
+		}
+		f := newRsyncFile(name, remote, node)
+		f.topDir = true
+		files = append(files, f)
+		if name == "." {
+			name = ""
+		}
+		walk(name, remote, node.(*vfs.Dir))
+	}
+	sortRsyncFiles(files)
+	return files
+}
+
+// sendFiles implements the sending side, used when the client
+// downloads files.
+func (c *rsyncConn) sendFiles(s *vfs.Session) error {
+	rules, err := c.readFilterList()
+	if err != nil {
+		return err
+	}
+	if len(rules) > 0 {
+		return fmt.Errorf("rsync: filter rules are not supported: %q", rules)
+	}
+
+	start := time.Now()
+	files := c.buildFileList(s)
+	var totalSize int64
+	for _, f := range files {
+		totalSize += f.size
+	}
+	buildTime := time.Since(start)
+	start = time.Now()
+	c.writeFileList(files)
+	c.flush()
+	xferTime := time.Since(start)
+
+	// Send the files the client asks for
+	for phase := 0; ; {
+		ndx, iflags, extra := c.readNdx()
+		if err = c.err(); err != nil {
+			return err
+		}
+		if ndx == rsyncNdxDone {
+			phase++
+			if phase > rsyncMaxPhase {
+				break
+			}
+			c.writeInt(rsyncNdxDone)
+			c.flush()
+			continue
+		}
+		if ndx < 0 || int(ndx) >= len(files) {
+			return fmt.Errorf("rsync: invalid file index %d", ndx)
+		}
+		f := files[ndx]
+		if iflags&rsyncItemTransfer == 0 || c.opt.dryRun {
+			c.writeInt(ndx)
+			c.writeShort(iflags)
+			c.write(extra)
+			continue
+		}
+		sums, err := c.readSums()
+		if err != nil {
+			return err
+		}
+		if err = c.sendFile(s, f, ndx, iflags, extra, sums); err != nil {
+			return err
+		}
+	}
+	c.writeInt(rsyncNdxDone)
+
+	// Send the stats and wait for the client to finish
+	c.writeLongint(c.readN)
+	c.writeLongint(c.written)
+	c.writeLongint(totalSize)
+	c.writeLongint(buildTime.Milliseconds())
+	c.writeLongint(xferTime.Milliseconds())
+	c.flush()
+	if ndx := c.readInt(); ndx != rsyncNdxDone && c.rErr == nil {
+		return fmt.Errorf("rsync: unexpected final index %d", ndx)
+	}
+	return c.err()
+}
+
+// sendFile sends the file f with index ndx to the client using the
+// checksums of its copy of the file.
+func (c *rsyncConn) sendFile(s *vfs.Session, f *rsyncFile, ndx int32, iflags uint16, extra []byte, sums *rsyncSums) (err error) {
+	fh, err := s.Open(f.remote)
+	if err != nil {
+		// protocol 29 has no way of telling the client the file
+		// isn't coming other than the error
+		c.message(rsyncMsgError, "rsync: send_files failed to open %q: %v", f.remote, err)
+		return nil
+	}
+	defer func() {
+		_ = fh.Close()
+	}()
+	c.writeInt(ndx)
+	c.writeShort(iflags)
+	c.write(extra)
+	c.writeSumHead(sums)
+	in := &rsyncFileReader{in: fh, size: f.size}
+	err = c.sendDelta(in, sums)
+	if in.err != nil {
+		c.message(rsyncMsgError, "rsync: read errors mapping %q: %v", f.remote, in.err)
+	}
+	return err
+}
+
+// rsyncFileReader reads exactly size bytes from in, padding with
+// zeros after an error as the client is expecting the whole file.
+type rsyncFileReader struct {
+	in   io.Reader
+	size int64
+	err  error
+}
+
+func (r *rsyncFileReader) Read(p []byte) (n int, err error) {
+	if r.size <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > r.size {
+		p = p[:r.size]
+	}
+	if r.err == nil {
+		n, r.err = r.in.Read(p)
+		if r.err == io.EOF {
+			r.err = nil
+			if n == 0 {
+				r.err = io.ErrUnexpectedEOF
+			}
+		}
+	}
+	if r.err != nil {
+		for i := range p[n:] {
+			p[n+i] = 0
+		}
+		n = len(p)
+	}
+	r.size -= int64(n)
+	return n, nil
+}
+
+// receiveFiles implements the receiving side, used when the client
+// uploads files.
+func (c *rsyncConn) receiveFiles(s *vfs.Session) error {
+	if c.opt.deleteMode || c.opt.pruneEmptyDirs {
+		rules, err := c.readFilterList()
+		if err != nil {
+			return err
+		}
+		if len(rules) > 0 && c.opt.deleteMode {
+			c.message(rsyncMsgInfo, "rsync: filter rules are not supported - not deleting files")
+			c.opt.deleteMode = false
+		}
+	}
+	files, err := c.readFileList()
+	if err != nil {
+		return err
+	}
+	sortRsyncFiles(files)
+
+	// Work out where the files go. A single file can be renamed,
+	// otherwise the destination is a directory.
+	dest := vfsPath(c.opt.paths[0])
+	destIsDir := true
+	if len(files) == 1 && !files[0].isDir() && !strings.HasSuffix(c.opt.paths[0], "/") {
+		node, err := s.Stat(dest)
+		destIsDir = err == nil && node.IsDir()
+	}
+	target := func(f *rsyncFile) string {
+		if !destIsDir {
+			return dest
+		}
+		return path.Join(dest, f.name())
+	}
+	if destIsDir && !c.opt.dryRun {
+		if err := s.MkdirAll(dest, 0777); err != nil {
+			return fmt.Errorf("rsync: mkdir %q failed: %v", dest, err)
+		}
+	}
+	if c.opt.deleteMode && c.opt.recursive && destIsDir && !c.opt.dryRun {
+		c.deleteExtraneous(s, files, dest, target)
+	}
+
+	// The generator asks the client for the files in a go routine
+	// while they are received here
+	phases := make(chan struct{})
+	generatorDone := make(chan error, 1)
+	go func() {
+		generatorDone <- c.generate(s, files, target, phases)
+	}()
+	err = c.receive(s, files, target, phases)
+	close(phases)
+	if err != nil {
+		return err
+	}
+	return <-generatorDone
+}
+
+// generate asks the client for the files which need transferring
+// with the checksums of any existing file they will replace.
+func (c *rsyncConn) generate(s *vfs.Session, files []*rsyncFile, target func(*rsyncFile) string, phases <-chan struct{}) error {
+	for ndx, f := range files {
+		remote := target(f)
+		if c.opt.dryRun {
+			continue
+		}
+		if f.isDir() {
+			if err := s.MkdirAll(remote, 0777); err != nil {
+				c.message(rsyncMsgError, "rsync: mkdir %q failed: %v", remote, err)
+			}
+			continue
+		}
+		if !f.isRegular() {
+			c.message(rsyncMsgInfo, "skipping non-regular file %q", f.name())
+			continue
+		}
+		iflags := uint16(rsyncItemTransfer)
+		node, err := s.Stat(remote)
+		if err == nil && node.IsDir() {
+			c.message(rsyncMsgError, "rsync: can't replace directory %q with a file", remote)
+			continue
+		} else if err == nil {
+			if c.upToDate(f, node) {
+				continue
+			}
+		} else {
+			iflags |= rsyncItemIsNew
+			node = nil
+		}
+		c.writeInt(int32(ndx))
+		c.writeShort(iflags)
+		if err = c.writeBasisSums(s, remote, node); err != nil {
+			return err
+		}
+		c.flush()
+		if c.wErr != nil {
+			return c.wErr
+		}
+	}
+
+	// Finish the phases when the receiver does. There is never
+	// anything to redo as failed files aren't retried.
+	for phase := 0; phase <= rsyncMaxPhase; phase++ {
+		c.writeInt(rsyncNdxDone)
+		c.flush()
+		if _, ok := <-phases; !ok && phase < rsyncMaxPhase {
+			return c.wErr
+		}
+	}
+
+	// Say goodbye
+	c.writeInt(rsyncNdxDone)
+	c.flush()
+	return c.wErr
+}
+
+// upToDate returns true if node doesn't need replacing with f
+func (c *rsyncConn) upToDate(f *rsyncFile, node vfs.Node) bool {
+	if node.Size() != f.size || c.opt.ignoreTimes {
+		return false
+	}
+	if c.opt.sizeOnly {
+		return true
+	}
+	mtime := node.ModTime().Unix()
+	if c.opt.update && mtime > f.mtime {
+		return true
+	}
+	return mtime == f.mtime
+}
+
+// writeBasisSums sends the checksums of the file at remote found as
+// node or an empty set of checksums if it doesn't exist.
+func (c *rsyncConn) writeBasisSums(s *vfs.Session, remote string, node vfs.Node) error {
+	if node == nil || c.opt.wholeFile {
+		return c.writeSums(nil, 0)
+	}
+	fh, err := s.Open(remote)
+	if err != nil {
+		c.message(rsyncMsgError, "rsync: failed to open basis file %q: %v", remote, err)
+		return c.writeSums(nil, 0)
+	}
+	defer func() {
+		_ = fh.Close()
+	}()
+	// If the file can't be read fill it with zeros, the blocks
+	// won't match and will be sent in full
+	in := &rsyncFileReader{in: fh, size: node.Size()}
+	return c.writeSums(in, node.Size())
+}
+
+// receive reads the files sent by the client
+func (c *rsyncConn) receive(s *vfs.Session, files []*rsyncFile, target func(*rsyncFile) string, phases chan<- struct{}) error {
+	for phase := 0; ; {
+		ndx, iflags, _ := c.readNdx()
+		if c.rErr != nil {
+			return c.rErr
+		}
+		if ndx == rsyncNdxDone {
+			phase++
+			if phase > rsyncMaxPhase {
+				return nil
+			}
+			phases <- struct{}{}
+			continue
+		}
+		if ndx < 0 || int(ndx) >= len(files) {
+			return fmt.Errorf("rsync: invalid file index %d", ndx)
+		}
+		if iflags&rsyncItemTransfer == 0 {
+			continue
+		}
+		sums, err := c.readSumHead()
+		if err != nil {
+			return err
+		}
+		isNew := iflags&rsyncItemIsNew != 0
+		if err = c.receiveFile(s, files[ndx], target(files[ndx]), sums, isNew); err != nil {
+			return err
+		}
+	}
+}
+
+// receiveFile receives the file f into remote using the existing file
+// as the basis if checksums for it were sent.
+//
+// Unless isNew is set, saying the generator didn't find the file, it
+// is written to a temporary file which is renamed over the original
+// when it is complete.
+func (c *rsyncConn) receiveFile(s *vfs.Session, f *rsyncFile, remote string, sums *rsyncSums, isNew bool) (err error) {
+	var basis vfs.Handle
+	if sums.count > 0 {
+		basis, err = s.Open(remote)
+		if err != nil {
+			c.message(rsyncMsgError, "rsync: failed to open basis file %q: %v", remote, err)
+		}
+	}
+	tmp := remote
+	if !isNew {
+		dir, leaf := path.Split(remote)
+		tmp = path.Join(dir, fmt.Sprintf(".%s.%d", leaf, time.Now().UnixNano()))
+	}
+	out, fileErr := s.Create(tmp)
+	var w io.Writer = io.Discard
+	if fileErr == nil {
+		w = out
+	}
+	var basisReader io.ReaderAt
+	if basis != nil {
+		basisReader = basis
+	}
+	writeErr, err := c.receiveDelta(basisReader, sums, w)
+	if basis != nil {
+		_ = basis.Close()
+	}
+	if fileErr == nil {
+		fileErr = writeErr
+		if closeErr := out.Close(); fileErr == nil {
+			fileErr = closeErr
+		}
+		if fileErr == nil && err == nil && tmp != remote {
+			fileErr = s.Rename(tmp, remote)
+		}
+		if fileErr != nil || err != nil {
+			_ = s.Remove(tmp)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if fileErr != nil {
+		c.message(rsyncMsgError, "rsync: failed to receive %q: %v", f.name(), fileErr)
+		return nil
+	}
+	if c.opt.preserveTimes {
+		if err := s.Chtimes(remote, time.Now(), time.Unix(f.mtime, 0)); err != nil {
+			fs.Debugf(remote, "rsync: failed to set modification time: %v", err)
+		}
+	}
+	return nil
+}
+
+// deleteExtraneous removes the files in the destination directories
+// which aren't in the file list, as asked for by --delete.
+func (c *rsyncConn) deleteExtraneous(s *vfs.Session, files []*rsyncFile, dest string, target func(*rsyncFile) string) {
+	wanted := make(map[string]bool, len(files))
+	for _, f := range files {
+		wanted[target(f)] = true
+	}
+	for _, f := range files {
+		if !f.isDir() {
+			continue
+		}
+		dir := target(f)
+		node, err := s.Stat(dir)
+		if err != nil || !node.IsDir() {
+			continue
+		}
+		nodes, err := node.(*vfs.Dir).ReadDirAll()
+		if err != nil {
+			c.message(rsyncMsgError, "rsync: opendir %q failed: %v", dir, err)
+			continue
+		}
+		for _, node := range nodes {
+			remote := path.Join(dir, node.Name())
+			if wanted[remote] {
+				continue
+			}
+			if err := s.RemoveAll(remote); err != nil {
+				c.message(rsyncMsgError, "rsync: delete %q failed: %v", remote, err)
+			} else {
+				c.message(rsyncMsgInfo, "deleting %s", strings.TrimPrefix(strings.TrimPrefix(remote, dest), "/"))
+			}
+		}
+	}
+}
@@ -0,0 +1,390 @@
+//go:build !plan9
+
+package sftp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/vfs"
+	"github.com/rclone/rclone/vfs/vfscommon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRsyncArgs(t *testing.T) {
+	opt, err := parseRsyncArgs([]string{"--server", "--sender", "-vlogDtpre.iLsfxCIvu", "--numeric-ids", ".", "dir/", "file"})
+	require.NoError(t, err)
+	assert.True(t, opt.sender)
+	assert.True(t, opt.recursive)
+	assert.True(t, opt.preserveUID)
+	assert.True(t, opt.preserveTimes)
+	assert.True(t, opt.numericIDs)
+	// options after "e" are capabilities
+	assert.False(t, opt.ignoreTimes)
+	assert.Equal(t, []string{"dir/", "file"}, opt.paths)
+
+	opt, err = parseRsyncArgs([]string{"--server", "-rt", "--delete-after", "."})
+	require.NoError(t, err)
+	assert.False(t, opt.sender)
+	assert.True(t, opt.deleteMode)
+	assert.Equal(t, []string{"."}, opt.paths)
+
+	_, err = parseRsyncArgs([]string{"--server", "-rtz", ".", "dest"})
+	assert.ErrorContains(t, err, "-z is not supported")
+	_, err = parseRsyncArgs([]string{"--daemon"})
+	assert.Error(t, err)
+	_, err = parseRsyncArgs([]string{"--server", "-rt", ".", "a", "b"})
+	assert.Error(t, err)
+}
+
+func TestRsyncSort(t *testing.T) {
+	entry := func(name string, isDir bool) *rsyncFile {
+		dir, base := filepath.Split(name)
+		f := &rsyncFile{dir: filepath.Clean(dir), base: base, mode: rsyncModeReg}
+		if dir == "" {
+			f.dir = ""
+		}
+		if isDir {
+			f.mode = rsyncModeDir
+		}
+		return f
+	}
+	files := []*rsyncFile{
+		entry("b", true),
+		entry("b/z", false),
+		entry("a.txt", false),
+		entry("a", true),
+		entry("a/y", true),
+		entry("a/x", false),
+		entry(".", true),
+		entry("c", false),
+		entry("a/y/1", false),
+	}
+	sortRsyncFiles(files)
+	var got []string
+	for _, f := range files {
+		got = append(got, f.name())
+	}
+	// files sort before directories in each directory
+	assert.Equal(t, []string{".", "a.txt", "c", "a", "a/x", "a/y", "a/y/1", "b", "b/z"}, got)
+}
+
+func TestRsyncDelta(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	basis := make([]byte, 1000000)
+	_, _ = r.Read(basis)
+	// change some bytes and insert some in the middle
+	data := append([]byte{}, basis[:300000]...)
+	data = append(data, []byte("inserted data")...)
+	data = append(data, basis[300000:]...)
+	data[500000] ^= 0xFF
+	data = data[:len(data)-1234]
+
+	for _, test := range []struct {
+		name  string
+		basis []byte
+		data  []byte
+	}{
+		{"changed", basis, data},
+		{"same", basis, basis},
+		{"empty", basis, nil},
+		{"noBasis", nil, data},
+		{"short", []byte("hello"), []byte("hello, world")},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var sumsBuf, deltaBuf bytes.Buffer
+			w := &rsyncConn{seed: 1234, out: bufio.NewWriter(&sumsBuf)}
+			var basisReader io.Reader
+			if test.basis != nil {
+				basisReader = bytes.NewReader(test.basis)
+			}
+			require.NoError(t, w.writeSums(basisReader, int64(len(test.basis))))
+			w.flush()
+
+			// the sender reads the sums and sends the delta
+			sender := &rsyncConn{seed: 1234, in: bufio.NewReader(&sumsBuf), out: bufio.NewWriter(&deltaBuf)}
+			sums, err := sender.readSums()
+			require.NoError(t, err)
+			require.NoError(t, sender.sendDelta(bytes.NewReader(test.data), sums))
+			sender.flush()
+			if test.basis != nil && len(test.data) > 100000 {
+				assert.Less(t, deltaBuf.Len(), len(test.data)/10, "delta should be small")
+			}
+
+			// the receiver rebuilds the file
+			receiver := &rsyncConn{seed: 1234, in: bufio.NewReader(&deltaBuf)}
+			var out bytes.Buffer
+			fileErr, err := receiver.receiveDelta(bytes.NewReader(test.basis), sums, &out)
+			require.NoError(t, err)
+			require.NoError(t, fileErr)
+			assert.True(t, bytes.Equal(test.data, out.Bytes()))
+			assert.Equal(t, 0, deltaBuf.Len())
+		})
+	}
+}
+
+// rsyncDemux reads multiplexed data from the server
+type rsyncDemux struct {
+	t    *testing.T
+	in   io.Reader
+	data []byte
+}
+
+func (d *rsyncDemux) Read(p []byte) (int, error) {
+	for len(d.data) == 0 {
+		var header [4]byte
+		if _, err := io.ReadFull(d.in, header[:]); err != nil {
+			return 0, err
+		}
+		h := binary.LittleEndian.Uint32(header[:])
+		msg := make([]byte, h&0xFFFFFF)
+		if _, err := io.ReadFull(d.in, msg); err != nil {
+			return 0, err
+		}
+		if tag := int(h>>24) - rsyncMplexBase; tag != rsyncMsgData {
+			d.t.Logf("rsync message %d: %s", tag, msg)
+			assert.NotEqual(d.t, rsyncMsgError, tag, string(msg))
+			continue
+		}
+		d.data = msg
+	}
+	n := copy(p, d.data)
+	d.data = d.data[n:]
+	return n, nil
+}
+
+// startRsync runs the rsync server with args returning a connection
+// to it as the client and a channel for the result
+func startRsync(t *testing.T, s *vfs.Session, args []string) (*rsyncConn, <-chan error) {
+	// Use OS pipes as they are buffered like an ssh channel
+	clientIn, serverOut, err := os.Pipe()
+	require.NoError(t, err)
+	serverIn, clientOut, err := os.Pipe()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = clientIn.Close()
+		_ = clientOut.Close()
+		_ = serverIn.Close()
+	})
+	errc := make(chan error, 1)
+	go func() {
+		err := runRsync(s, serverIn, serverOut, args)
+		_ = serverOut.Close()
+		errc <- err
+	}()
+	opt, err := parseRsyncArgs(args)
+	require.NoError(t, err)
+	c := &rsyncConn{
+		opt: opt,
+		in:  bufio.NewReader(clientIn),
+		out: bufio.NewWriter(clientOut),
+	}
+	c.writeInt(31)
+	c.flush()
+	assert.Equal(t, int32(rsyncProtocol), c.readInt())
+	c.seed = uint32(c.readInt())
+	require.NoError(t, c.err())
+	c.in = bufio.NewReader(&rsyncDemux{t: t, in: c.in})
+	return c, errc
+}
+
+func newRsyncTestVFS(t *testing.T) (string, *vfs.Session) {
+	dir := t.TempDir()
+	f, err := fs.NewFs(context.Background(), dir)
+	require.NoError(t, err)
+	opt := vfscommon.DefaultOpt
+	v := vfs.New(f, &opt)
+	t.Cleanup(v.Shutdown)
+	return dir, v.Session(vfs.AuditInfo{})
+}
+
+func TestRsyncDownload(t *testing.T) {
+	dir, s := newRsyncTestVFS(t)
+	r := rand.New(rand.NewSource(2))
+	big := make([]byte, 600000)
+	_, _ = r.Read(big)
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "src", "sub"), 0777))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "src", "big.bin"), big, 0666))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "src", "sub", "small.txt"), []byte("small"), 0666))
+
+	c, errc := startRsync(t, s, []string{"--server", "--sender", "-vlogDtpre.iLsfxC", ".", "src/"})
+
+	// no filter rules
+	c.writeInt(0)
+	c.flush()
+	files, err := c.readFileList()
+	require.NoError(t, err)
+	sortRsyncFiles(files)
+	var names []string
+	for _, f := range files {
+		names = append(names, f.name())
+	}
+	require.Equal(t, []string{".", "big.bin", "sub", "sub/small.txt"}, names)
+	assert.Equal(t, int64(len(big)), files[1].size)
+
+	// ask for the files using an old version of big.bin as a basis
+	basis := append([]byte{}, big...)
+	basis[1000] ^= 0xFF
+	c.writeInt(1)
+	c.writeShort(rsyncItemTransfer)
+	require.NoError(t, c.writeSums(bytes.NewReader(basis), int64(len(basis))))
+	c.writeInt(3)
+	c.writeShort(rsyncItemTransfer | rsyncItemIsNew)
+	require.NoError(t, c.writeSums(nil, 0))
+	c.writeInt(rsyncNdxDone)
+	c.flush()
+
+	got := map[string][]byte{}
+	readBefore := c.readN
+	for phase := 0; ; {
+		ndx, iflags, _ := c.readNdx()
+		require.NoError(t, c.err())
+		if ndx == rsyncNdxDone {
+			phase++
+			if phase > rsyncMaxPhase {
+				break
+			}
+			c.writeInt(rsyncNdxDone)
+			c.flush()
+			continue
+		}
+		assert.NotZero(t, iflags&rsyncItemTransfer)
+		sums, err := c.readSumHead()
+		require.NoError(t, err)
+		var out bytes.Buffer
+		var basisReader io.ReaderAt
+		if sums.count > 0 {
+			basisReader = bytes.NewReader(basis)
+		}
+		fileErr, err := c.receiveDelta(basisReader, sums, &out)
+		require.NoError(t, err)
+		require.NoError(t, fileErr)
+		got[files[ndx].name()] = out.Bytes()
+	}
+	assert.Less(t, c.readN-readBefore, int64(len(big)/10), "should have sent a delta")
+
+	// read the stats and say goodbye
+	for i := 0; i < 5; i++ {
+		_ = c.readLongint()
+	}
+	c.writeInt(rsyncNdxDone)
+	c.flush()
+	require.NoError(t, c.err())
+	require.NoError(t, <-errc)
+
+	assert.True(t, bytes.Equal(big, got["big.bin"]))
+	assert.Equal(t, "small", string(got["sub/small.txt"]))
+}
+
+func TestRsyncUpload(t *testing.T) {
+	dir, s := newRsyncTestVFS(t)
+	r := rand.New(rand.NewSource(3))
+	big := make([]byte, 600000)
+	_, _ = r.Read(big)
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "dest"), 0777))
+	old := append([]byte{}, big...)
+	old[1000] ^= 0xFF
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "dest", "big.bin"), old, 0666))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "dest", "stale.txt"), []byte("stale"), 0666))
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	c, errc := startRsync(t, s, []string{"--server", "-rte.iLsfxC", "--delete", ".", "dest/"})
+
+	local := map[string][]byte{
+		"big.bin":       big,
+		"sub/small.txt": []byte("small"),
+	}
+	files := []*rsyncFile{
+		{base: ".", mode: rsyncModeDir | 0755, mtime: mtime.Unix(), topDir: true},
+		{base: "big.bin", mode: rsyncModeReg | 0644, size: int64(len(big)), mtime: mtime.Unix()},
+		{base: "sub", mode: rsyncModeDir | 0755, mtime: mtime.Unix()},
+		{dir: "sub", base: "small.txt", mode: rsyncModeReg | 0644, size: 5, mtime: mtime.Unix()},
+	}
+	// no filter rules then the file list
+	c.writeInt(0)
+	c.writeFileList(files)
+	c.flush()
+
+	// send the files the server asks for
+	writtenBefore := c.written
+	for phase := 0; ; {
+		ndx, iflags, extra := c.readNdx()
+		require.NoError(t, c.err())
+		if ndx == rsyncNdxDone {
+			phase++
+			if phase > rsyncMaxPhase {
+				break
+			}
+			c.writeInt(rsyncNdxDone)
+			c.flush()
+			continue
+		}
+		sums, err := c.readSums()
+		require.NoError(t, err)
+		c.writeInt(ndx)
+		c.writeShort(iflags)
+		c.write(extra)
+		c.writeSumHead(sums)
+		require.NoError(t, c.sendDelta(bytes.NewReader(local[files[ndx].name()]), sums))
+		c.flush()
+	}
+	c.writeInt(rsyncNdxDone)
+	c.flush()
+	assert.Less(t, c.written-writtenBefore, int64(len(big)/10), "should have sent a delta")
+
+	// the final goodbye
+	assert.Equal(t, int32(rsyncNdxDone), c.readInt())
+	require.NoError(t, c.err())
+	require.NoError(t, <-errc)
+
+	data, err := os.ReadFile(filepath.Join(dir, "dest", "big.bin"))
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(big, data))
+	data, err = os.ReadFile(filepath.Join(dir, "dest", "sub", "small.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "small", string(data))
+	fi, err := os.Stat(filepath.Join(dir, "dest", "sub", "small.txt"))
+	require.NoError(t, err)
+	assert.True(t, fi.ModTime().Equal(mtime))
+	_, err = os.Stat(filepath.Join(dir, "dest", "stale.txt"))
+	assert.True(t, os.IsNotExist(err), "stale file should be deleted")
+
+	// no temporary files left behind
+	entries, err := os.ReadDir(filepath.Join(dir, "dest"))
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
+
+func TestRsyncReceiveFileFailed(t *testing.T) {
+	dir, s := newRsyncTestVFS(t)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "file.txt"), []byte("old"), 0666))
+
+	// the whole file is sent but the connection drops part way
+	var buf bytes.Buffer
+	w := &rsyncConn{out: bufio.NewWriter(&buf)}
+	w.writeInt(3)
+	w.write([]byte("new"))
+	w.flush()
+	c := &rsyncConn{seed: 1234, in: bufio.NewReader(&buf)}
+	err := c.receiveFile(s, &rsyncFile{base: "file.txt"}, "file.txt", &rsyncSums{}, false)
+	require.Error(t, err)
+
+	// the existing file is untouched and nothing is left behind
+	data, err := os.ReadFile(filepath.Join(dir, "file.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "old", string(data))
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
@@ -0,0 +1,402 @@
+//go:build !plan9
+
+package sftp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/vfs"
+)
+
+// errSCPFailed is returned if scp reported any errors to the client
+// so the command exits with a non zero status.
+var errSCPFailed = errors.New("scp: transfer had errors")
+
+// scp implements the server side of the legacy scp protocol as used
+// by `scp -O` and older OpenSSH clients.
+//
+// The client runs "scp -t target" on the server to upload files
+// (the server is the sink) or "scp -f source..." to download them
+// (the server is the source).
+type scp struct {
+	s         *vfs.Session
+	in        *bufio.Reader
+	out       io.Writer
+	recursive bool // -r - directories are transferred
+	preserve  bool // -p - modification times are transferred
+	targetDir bool // -d - the target must be a directory
+	errors    int  // number of errors reported to the client
+}
+
+// runSCP runs the scp command with args reading from in and writing
+// to out.
+func runSCP(s *vfs.Session, in io.Reader, out io.Writer, args []string) error {
+	c := &scp{
+		s:   s,
+		in:  bufio.NewReader(in),
+		out: out,
+	}
+	var sink, source bool
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		arg := args[0]
+		args = args[1:]
+		if arg == "--" {
+			break
+		}
+		for _, opt := range arg[1:] {
+			switch opt {
+			case 't':
+				sink = true
+			case 'f':
+				source = true
+			case 'r':
+				c.recursive = true
+			case 'p':
+				c.preserve = true
+			case 'd':
+				c.targetDir = true
+			case 'v':
+			default:
+				return fmt.Errorf("scp: unsupported option -%c", opt)
+			}
+		}
+	}
+	var err error
+	switch {
+	case sink && !source && len(args) == 1:
+		err = c.sink(vfsPath(args[0]))
+	case source && !sink && len(args) > 0:
+		err = c.source(args)
+	default:
+		return errors.New("scp: usage: scp [-prd] -t target | scp [-pr] -f source...")
+	}
+	if err == nil && c.errors > 0 {
+		err = errSCPFailed
+	}
+	return err
+}
+
+// ack tells the client the last record was received OK
+func (c *scp) ack() error {
+	_, err := c.out.Write([]byte{0})
+	return err
+}
+
+// reportError sends a non fatal error to the client
+func (c *scp) reportError(format string, a ...interface{}) error {
+	c.errors++
+	msg := fmt.Sprintf(format, a...)
+	fs.Errorf(nil, "scp: %s", msg)
+	_, err := fmt.Fprintf(c.out, "\x01scp: %s\n", msg)
+	return err
+}
+
+// fatal sends a fatal error to the client and returns it
+func (c *scp) fatal(format string, a ...interface{}) error {
+	err := fmt.Errorf("scp: "+format, a...)
+	_, _ = fmt.Fprintf(c.out, "\x02%v\n", err)
+	return err
+}
+
+// response reads the client's reply to the last record returning
+// false if the client reported an error.
+func (c *scp) response() (ok bool, err error) {
+	code, err := c.in.ReadByte()
+	if err != nil {
+		return false, err
+	}
+	switch code {
+	case 0:
+		return true, nil
+	case 1, 2:
+		msg, err := c.in.ReadString('\n')
+		if err != nil {
+			return false, err
+		}
+		msg = strings.TrimSuffix(msg, "\n")
+		if code == 2 {
+			return false, fmt.Errorf("scp: client failed: %s", msg)
+		}
+		fs.Errorf(nil, "scp: client reported: %s", msg)
+		return false, nil
+	}
+	return false, fmt.Errorf("scp: unexpected response %q", code)
+}
+
+// sink receives files from the client into target
+func (c *scp) sink(target string) error {
+	targetIsDir := false
+	if node, err := c.s.Stat(target); err == nil {
+		targetIsDir = node.IsDir()
+	}
+	if c.targetDir && !targetIsDir {
+		return c.fatal("%s: Not a directory", target)
+	}
+	if err := c.ack(); err != nil {
+		return err
+	}
+	var mtime time.Time
+	for {
+		line, err := c.in.ReadString('\n')
+		if err == io.EOF && line == "" {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return c.fatal("unexpected <newline>")
+		}
+		switch line[0] {
+		case 1, 2:
+			fs.Errorf(nil, "scp: client reported: %s", line[1:])
+			if line[0] == 2 {
+				return fmt.Errorf("scp: client failed: %s", line[1:])
+			}
+			c.errors++
+			continue
+		case 'E':
+			return c.ack()
+		case 'T':
+			// T<mtime> <usec> <atime> <usec>
+			fields := strings.Fields(line[1:])
+			if len(fields) != 4 {
+				return c.fatal("mtime.sec not present")
+			}
+			sec, err := strconv.ParseInt(fields[0], 10, 64)
+			if err != nil {
+				return c.fatal("mtime.sec not delimited")
+			}
+			usec, _ := strconv.ParseInt(fields[1], 10, 64)
+			mtime = time.Unix(sec, usec*1000)
+			if err := c.ack(); err != nil {
+				return err
+			}
+			continue
+		case 'C', 'D':
+		default:
+			return c.fatal("expected control record")
+		}
+
+		// C<mode> <size> <name> or D<mode> 0 <name>
+		fields := strings.SplitN(line[1:], " ", 3)
+		if len(fields) != 3 {
+			return c.fatal("bad control record %q", line)
+		}
+		size, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil || size < 0 {
+			return c.fatal("size not delimited")
+		}
+		name := fields[2]
+		if name == "" || name == ".." || strings.Contains(name, "/") {
+			return c.fatal("error: unexpected filename: %s", name)
+		}
+		remote := target
+		if targetIsDir {
+			remote = path.Join(target, name)
+		}
+		if line[0] == 'D' {
+			if !c.recursive {
+				return c.fatal("received directory without -r")
+			}
+			if node, err := c.s.Stat(remote); err == nil {
+				if !node.IsDir() {
+					if err := c.reportError("%s: Not a directory", remote); err != nil {
+						return err
+					}
+					continue
+				}
+			} else if err := c.s.Mkdir(remote, 0777); err != nil {
+				if err := c.reportError("%s: %v", remote, err); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := c.sink(remote); err != nil {
+				return err
+			}
+		} else if err := c.sinkFile(remote, size); err != nil {
+			return err
+		}
+		if !mtime.IsZero() {
+			if err := c.s.Chtimes(remote, mtime, mtime); err != nil {
+				fs.Debugf(remote, "scp: failed to set modification time: %v", err)
+			}
+			mtime = time.Time{}
+		}
+	}
+}
+
+// sinkFile receives size bytes from the client into the file remote
+func (c *scp) sinkFile(remote string, size int64) (err error) {
+	fh, err := c.s.Create(remote)
+	if err != nil {
+		// The client won't send the data if we don't ack the record
+		return c.reportError("%s: %v", remote, err)
+	}
+	if err = c.ack(); err != nil {
+		_ = fh.Close()
+		return err
+	}
+	data := &io.LimitedReader{R: c.in, N: size}
+	_, writeErr := io.Copy(fh, data)
+	if writeErr != nil {
+		// Read the rest of the data so we stay in sync
+		_, _ = io.Copy(io.Discard, data)
+	}
+	if data.N > 0 {
+		_ = fh.Close()
+		return io.ErrUnexpectedEOF
+	}
+	if closeErr := fh.Close(); writeErr == nil {
+		writeErr = closeErr
+	}
+	// The client follows the data with its status
+	if _, err = c.response(); err != nil {
+		return err
+	}
+	if writeErr != nil {
+		return c.reportError("%s: %v", remote, writeErr)
+	}
+	return c.ack()
+}
+
+// source sends the files and directories in sources to the client
+func (c *scp) source(sources []string) error {
+	if ok, err := c.response(); err != nil || !ok {
+		return err
+	}
+	for _, source := range sources {
+		remote := vfsPath(source)
+		node, err := c.s.Stat(remote)
+		if err == vfs.ENOENT {
+			if err := c.reportError("%s: No such file or directory", source); err != nil {
+				return err
+			}
+			continue
+		} else if err != nil {
+			if err := c.reportError("%s: %v", source, err); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := c.sourceNode(remote, node); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendTimes sends the modification time of node if -p was set
+// returning false if the client rejected it.
+func (c *scp) sendTimes(node vfs.Node) (ok bool, err error) {
+	if !c.preserve {
+		return true, nil
+	}
+	t := node.ModTime().Unix()
+	if _, err := fmt.Fprintf(c.out, "T%d 0 %d 0\n", t, t); err != nil {
+		return false, err
+	}
+	return c.response()
+}
+
+// sourceNode sends the file or directory node found at remote
+func (c *scp) sourceNode(remote string, node vfs.Node) error {
+	if node.IsDir() {
+		if !c.recursive {
+			return c.reportError("%s: not a regular file", remote)
+		}
+		return c.sourceDir(remote, node.(*vfs.Dir))
+	}
+	if ok, err := c.sendTimes(node); err != nil || !ok {
+		return err
+	}
+	fh, err := c.s.Open(remote)
+	if err != nil {
+		return c.reportError("%s: %v", remote, err)
+	}
+	defer func() {
+		_ = fh.Close()
+	}()
+	size := node.Size()
+	if _, err := fmt.Fprintf(c.out, "C%04o %d %s\n", node.Mode().Perm(), size, node.Name()); err != nil {
+		return err
+	}
+	if ok, err := c.response(); err != nil || !ok {
+		return err
+	}
+	n, readErr := io.Copy(c.out, io.LimitReader(fh, size))
+	if n < size {
+		if readErr == nil {
+			readErr = io.ErrUnexpectedEOF
+		}
+		// The client expects size bytes so pad with zeros
+		if _, err := io.CopyN(c.out, zeroReader{}, size-n); err != nil {
+			return err
+		}
+	}
+	if readErr != nil {
+		if err := c.reportError("%s: %v", remote, readErr); err != nil {
+			return err
+		}
+	} else if err := c.ack(); err != nil {
+		return err
+	}
+	_, err = c.response()
+	return err
+}
+
+// sourceDir sends the directory dir found at remote and its contents
+func (c *scp) sourceDir(remote string, dir *vfs.Dir) error {
+	if ok, err := c.sendTimes(dir); err != nil || !ok {
+		return err
+	}
+	name := dir.Name()
+	if remote == "" {
+		name = "."
+	}
+	if _, err := fmt.Fprintf(c.out, "D%04o 0 %s\n", dir.Mode().Perm(), name); err != nil {
+		return err
+	}
+	if ok, err := c.response(); err != nil || !ok {
+		return err
+	}
+	nodes, err := dir.ReadDirAll()
+	if err != nil {
+		if err := c.reportError("%s: %v", remote, err); err != nil {
+			return err
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Name() < nodes[j].Name()
+	})
+	for _, node := range nodes {
+		if err := c.sourceNode(path.Join(remote, node.Name()), node); err != nil {
+			return err
+		}
+	}
+	if _, err := c.out.Write([]byte("E\n")); err != nil {
+		return err
+	}
+	_, err = c.response()
+	return err
+}
+
+// zeroReader reads an infinite stream of zeros
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
@@ -0,0 +1,96 @@
+//go:build !plan9
+
+package sftp
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShellSplit(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"scp -t -- dir", []string{"scp", "-t", "--", "dir"}},
+		{`scp -f 'with space' "double \"quoted\" \x"`, []string{"scp", "-f", "with space", `double "quoted" \x`}},
+		{`rsync --server . a\ b\$c`, []string{"rsync", "--server", ".", "a b$c"}},
+		{"a  ''  b", []string{"a", "", "b"}},
+	} {
+		got, err := shellSplit(test.in)
+		require.NoError(t, err, test.in)
+		assert.Equal(t, test.want, got, test.in)
+	}
+	_, err := shellSplit("scp -t 'unterminated")
+	assert.Error(t, err)
+}
+
+func TestVFSPath(t *testing.T) {
+	for in, want := range map[string]string{
+		"":           "",
+		".":          "",
+		"~":          "",
+		"~/dir/file": "dir/file",
+		"/dir/":      "dir",
+		"../../etc":  "etc",
+		"a/../b":     "b",
+	} {
+		assert.Equal(t, want, vfsPath(in), in)
+	}
+}
+
+func TestSCPSink(t *testing.T) {
+	dir, s := newRsyncTestVFS(t)
+	in := strings.Join([]string{
+		"D0755 0 sub\n",
+		"C0644 5 file.txt\n", "hello\x00",
+		"E\n",
+		"T1577934245 0 1577934245 0\n",
+		"C0644 3 top.txt\n", "abc\x00",
+		"C0644 1 ../evil\n",
+	}, "")
+	var out bytes.Buffer
+	err := runSCP(s, strings.NewReader(in), &out, []string{"-r", "-p", "-t", "--", "/"})
+	require.Error(t, err)
+	// ack for the start, D, C, data, E, T, C, data then a fatal error
+	assert.Equal(t, strings.Repeat("\x00", 8)+"\x02scp: error: unexpected filename: ../evil\n", out.String())
+
+	data, err := os.ReadFile(filepath.Join(dir, "sub", "file.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+	data, err = os.ReadFile(filepath.Join(dir, "top.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "abc", string(data))
+	fi, err := os.Stat(filepath.Join(dir, "top.txt"))
+	require.NoError(t, err)
+	assert.True(t, fi.ModTime().Equal(time.Unix(1577934245, 0)))
+}
+
+func TestSCPSource(t *testing.T) {
+	dir, s := newRsyncTestVFS(t)
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "sub"), 0777))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "file.txt"), []byte("hello"), 0666))
+
+	// the client acks everything
+	acks := strings.NewReader(strings.Repeat("\x00", 10))
+	var out bytes.Buffer
+	err := runSCP(s, acks, &out, []string{"-r", "-f", "sub", "missing"})
+	assert.Equal(t, errSCPFailed, err)
+	got := out.String()
+	assert.Regexp(t, `^D0[0-7]{3} 0 sub\nC0[0-7]{3} 5 file.txt\nhello\x00E\n\x01scp: missing: No such file or directory\n$`, got)
+
+	// directories need -r
+	acks = strings.NewReader("\x00")
+	out.Reset()
+	err = runSCP(s, acks, &out, []string{"-f", "sub"})
+	assert.Equal(t, errSCPFailed, err)
+	assert.Equal(t, "\x01scp: sub: not a regular file\n", out.String())
+}
@@ -51,7 +51,7 @@ func newServer(ctx context.Context, f fs.Fs, opt *Options) *server {
 		opt:      *opt,
 		waitChan: make(chan struct{}),
 	}
-	if proxyflags.Opt.AuthProxy != "" {
+	if proxyflags.Opt.Enabled() {
 		s.proxy = proxy.New(ctx, &proxyflags.Opt)
 	} else {
 		s.vfs = vfs.New(f, &vfsflags.Opt)
@@ -107,7 +107,12 @@ func (s *server) acceptConnection(nConn net.Conn) {
 		_ = nConn.Close()
 		return
 	}
-	c.handlers = newVFSHandler(c.vfs)
+	c.session = c.vfs.Session(vfs.AuditInfo{
+		User:       sshConn.User(),
+		Protocol:   "sftp",
+		RemoteAddr: nConn.RemoteAddr().String(),
+	})
+	c.handlers = newVFSHandler(c.session)
 
 	// Accept all channels
 	go c.handleChannels(chans)
@@ -133,12 +138,12 @@ func (s *server) serve() (err error) {
 	var authorizedKeysMap map[string]struct{}
 
 	// ensure the user isn't trying to use conflicting flags
-	if proxyflags.Opt.AuthProxy != "" && s.opt.AuthorizedKeys != "" && s.opt.AuthorizedKeys != DefaultOpt.AuthorizedKeys {
-		return errors.New("--auth-proxy and --authorized-keys cannot be used at the same time")
+	if proxyflags.Opt.Enabled() && s.opt.AuthorizedKeys != "" && s.opt.AuthorizedKeys != DefaultOpt.AuthorizedKeys {
+		return errors.New("--auth-proxy or --users-file and --authorized-keys cannot be used at the same time")
 	}
 
 	// Load the authorized keys
-	if s.opt.AuthorizedKeys != "" && proxyflags.Opt.AuthProxy == "" {
+	if s.opt.AuthorizedKeys != "" && !proxyflags.Opt.Enabled() {
 		authKeysFile := env.ShellExpand(s.opt.AuthorizedKeys)
 		authorizedKeysMap, err = loadAuthorizedKeys(authKeysFile)
 		// If user set the flag away from the default then report an error
@@ -149,7 +154,7 @@ func (s *server) serve() (err error) {
 	}
 
 	if !s.opt.NoAuth && len(authorizedKeysMap) == 0 && s.opt.User == "" && s.opt.Pass == "" && s.proxy == nil {
-		return errors.New("no authorization found, use --user/--pass or --authorized-keys or --no-auth or --auth-proxy")
+		return errors.New("no authorization found, use --user/--pass or --authorized-keys or --no-auth or --auth-proxy or --users-file")
 	}
 
 	// An SSH server is represented by a ServerConfig, which holds
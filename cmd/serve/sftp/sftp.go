@@ -71,6 +71,23 @@ The server will respond to a small number of shell commands, mainly
 md5sum, sha1sum and df, which enable it to provide support for checksums
 and the about feature when accessed from an sftp remote.
 
+It also implements the server side of ` + "`scp`" + ` and ` + "`rsync`" + ` so they can
+be used to copy files to and from the remote over ssh, e.g.
+
+    scp -O -P 2022 -r dir user@host:dest
+    rsync -av -e "ssh -p 2022" dir/ user@host:dest/
+
+Recent versions of scp use the SFTP protocol which works anyway, the
+legacy scp protocol is used with ` + "`-O`" + ` or by older clients. Both ` + "`-r`" + `
+and ` + "`-p`" + ` (which only preserves modification times) are supported.
+
+rsync uses protocol version 29 and transfers only regular files and
+directories, sending just the changed blocks of files which exist on
+both sides. The ` + "`--delete`" + ` and ` + "`--dry-run`" + ` flags are supported, but
+compression (` + "`-z`" + `), ` + "`--checksum`" + `, hard links, ACLs, xattrs and
+filter rules when downloading are not. Owners, groups and permissions
+aren't stored on the remote.
+
 Note that this server uses standard 32 KiB packet payload size, which
 means you must not configure the client to expect anything else, e.g.
 with the [chunk_size](/sftp/#sftp-chunk-size) option on an sftp remote.
@@ -83,7 +100,7 @@ Use ` + "`--stats`" + ` to control the stats printing.
 You must provide some means of authentication, either with
 ` + "`--user`/`--pass`" + `, an authorized keys file (specify location with
 ` + "`--authorized-keys`" + ` - the default is the same as ssh), an
-` + "`--auth-proxy`" + `, or set the ` + "`--no-auth`" + ` flag for no
+` + "`--auth-proxy`" + `, a ` + "`--users-file`" + `, or set the ` + "`--no-auth`" + ` flag for no
 authentication when logging in.
 
 If you don't supply a host ` + "`--key`" + ` then rclone will generate rsa, ecdsa
@@ -120,7 +137,7 @@ provided by OpenSSH in this case.
 	},
 	Run: func(command *cobra.Command, args []string) {
 		var f fs.Fs
-		if proxyflags.Opt.AuthProxy == "" {
+		if !proxyflags.Opt.Enabled() {
 			cmd.CheckArgs(1, 1, command, args)
 			f = cmd.NewFsSrc(args)
 		} else {
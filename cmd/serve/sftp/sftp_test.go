@@ -33,6 +33,8 @@ var (
 	_ sftp.FileWriter = vfsHandler{}
 	_ sftp.FileCmder  = vfsHandler{}
 	_ sftp.FileLister = vfsHandler{}
+
+	_ sftp.StatVFSFileCmder = vfsHandler{}
 )
 
 // TestSftp runs the sftp server then runs the unit tests for the
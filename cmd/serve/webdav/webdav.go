@@ -8,10 +8,13 @@ import (
 	"fmt"
 	"mime"
 	"net/http"
+	"net/url"
 	"os"
 	"path"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	chi "github.com/go-chi/chi/v5"
@@ -36,6 +39,7 @@ type Options struct {
 	Auth          libhttp.AuthConfig
 	HTTP          libhttp.Config
 	Template      libhttp.TemplateConfig
+	Share         libhttp.ShareConfig
 	HashName      string
 	HashType      hash.Type
 	DisableGETDir bool
@@ -46,6 +50,7 @@ var DefaultOpt = Options{
 	Auth:          libhttp.DefaultAuthCfg(),
 	HTTP:          libhttp.DefaultCfg(),
 	Template:      libhttp.DefaultTemplateCfg(),
+	Share:         libhttp.DefaultShareCfg(),
 	HashType:      hash.None,
 	DisableGETDir: false,
 }
@@ -62,6 +67,7 @@ func init() {
 	libhttp.AddAuthFlagsPrefix(flagSet, flagPrefix, &Opt.Auth)
 	libhttp.AddHTTPFlagsPrefix(flagSet, flagPrefix, &Opt.HTTP)
 	libhttp.AddTemplateFlagsPrefix(flagSet, "", &Opt.Template)
+	libhttp.AddShareFlagsPrefix(flagSet, flagPrefix, &Opt.Share)
 	vfsflags.AddFlags(flagSet)
 	proxyflags.AddFlags(flagSet)
 	flags.StringVarP(flagSet, &Opt.HashName, "etag-hash", "", "", "Which hash to use for the ETag, or auto or blank for off", "")
@@ -88,6 +94,34 @@ supported hash on the backend or you can use a named hash such as
 "MD5" or "SHA-1". Use the [hashsum](/commands/rclone_hashsum/) command
 to see the full list.
 
+#### Quotas
+
+If a quota is set with ` + "`--vfs-quota-size`" + ` or ` + "`--vfs-quota-files`" + `, or
+for the user in the ` + "`--users-file`" + `, then uploads which would go over it
+fail with 507 Insufficient Storage, and directories have the
+` + "`quota-used-bytes`" + ` and ` + "`quota-available-bytes`" + ` properties from RFC 4331.
+
+Without a quota these properties are filled in from the space used and
+free on the remote if it supports the [about](/commands/rclone_about/)
+command. Any the remote doesn't report are left out. The values are
+cached for ` + "`--dir-cache-time`" + `.
+
+#### Conditional requests
+
+PUT, DELETE and MOVE requests with ` + "`If-Match`" + `, ` + "`If-None-Match`" + ` or
+` + "`If-Unmodified-Since`" + ` headers are checked against the object as it is
+on the remote now, not as it is in the directory cache, so clients can
+notice files which have been changed by others. If the check fails
+then the request fails with 412 Precondition Failed.
+
+Requests which change a file through this server are run one at a
+time for each path, so no other client of the server can change the
+file between the check and the write. Changes made to the remote by
+other programs at the same moment can't be prevented.
+
+The ETag is the hash chosen with ` + "`--etag-hash`" + ` if set, otherwise it
+is made from the modification time and size of the object.
+
 ### Access WebDAV on Windows
 
 WebDAV shared folder can be mapped as a drive on Windows, however the default settings prevent it.
@@ -114,14 +148,14 @@ Create a new DWORD BasicAuthLevel with value 2.
 
 https://learn.microsoft.com/en-us/office/troubleshoot/powerpoint/office-opens-blank-from-sharepoint
 
-` + libhttp.Help(flagPrefix) + libhttp.TemplateHelp(flagPrefix) + libhttp.AuthHelp(flagPrefix) + vfs.Help() + proxy.Help,
+` + libhttp.Help(flagPrefix) + libhttp.TemplateHelp(flagPrefix) + libhttp.AuthHelp(flagPrefix) + libhttp.ShareHelp(flagPrefix) + vfs.Help() + proxy.Help,
 	Annotations: map[string]string{
 		"versionIntroduced": "v1.39",
 		"groups":            "Filter",
 	},
 	RunE: func(command *cobra.Command, args []string) error {
 		var f fs.Fs
-		if proxyflags.Opt.AuthProxy == "" {
+		if !proxyflags.Opt.Enabled() {
 			cmd.CheckArgs(1, 1, command, args)
 			f = cmd.NewFsSrc(args)
 		} else {
@@ -176,6 +210,8 @@ type WebDAV struct {
 	webdavhandler *webdav.Handler
 	proxy         *proxy.Proxy
 	ctx           context.Context // for global config
+	locks         pathLocks       // serialises the writes to each path
+	abouts        aboutCache      // the About of each remote for the quota
 }
 
 // check interface
@@ -184,11 +220,16 @@ var _ webdav.FileSystem = (*WebDAV)(nil)
 // Make a new WebDAV to serve the remote
 func newWebDAV(ctx context.Context, f fs.Fs, opt *Options) (w *WebDAV, err error) {
 	w = &WebDAV{
-		f:   f,
-		ctx: ctx,
-		opt: *opt,
-	}
-	if proxyflags.Opt.AuthProxy != "" {
+		f:      f,
+		ctx:    ctx,
+		opt:    *opt,
+		locks:  pathLocks{locks: map[string]*pathLock{}},
+		abouts: aboutCache{entries: map[string]aboutEntry{}},
+	}
+	if proxyflags.Opt.Enabled() {
+		if opt.Share.Secret != "" {
+			return nil, errors.New("can't use --share-secret with --auth-proxy or --users-file")
+		}
 		w.proxy = proxy.New(ctx, &proxyflags.Opt)
 		// override auth
 		w.opt.Auth.CustomAuthFn = w.auth
@@ -200,6 +241,7 @@ func newWebDAV(ctx context.Context, f fs.Fs, opt *Options) (w *WebDAV, err error
 		libhttp.WithConfig(w.opt.HTTP),
 		libhttp.WithAuth(w.opt.Auth),
 		libhttp.WithTemplate(w.opt.Template),
+		libhttp.WithShare(w.opt.Share),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to init server: %w", err)
@@ -242,20 +284,24 @@ func newWebDAV(ctx context.Context, f fs.Fs, opt *Options) (w *WebDAV, err error
 	return w, nil
 }
 
+// auditInfoKey is the context key for the vfs.AuditInfo of the request
+type auditInfoKey struct{}
+
 // Gets the VFS in use for this request
-func (w *WebDAV) getVFS(ctx context.Context) (VFS *vfs.VFS, err error) {
+func (w *WebDAV) getVFS(ctx context.Context) (VFS *vfs.Session, err error) {
+	info, _ := ctx.Value(auditInfoKey{}).(vfs.AuditInfo)
 	if w._vfs != nil {
-		return w._vfs, nil
+		return w._vfs.Session(info), nil
 	}
 	value := libhttp.CtxGetAuth(ctx)
 	if value == nil {
 		return nil, errors.New("no VFS found in context")
 	}
-	VFS, ok := value.(*vfs.VFS)
+	userVFS, ok := value.(*vfs.VFS)
 	if !ok {
 		return nil, fmt.Errorf("context value is not VFS: %#v", value)
 	}
-	return VFS, nil
+	return userVFS.Session(info), nil
 }
 
 // auth does proxy authorization
@@ -269,14 +315,33 @@ func (w *WebDAV) auth(user, pass string) (value interface{}, err error) {
 
 type webdavRW struct {
 	http.ResponseWriter
-	status int
+	status        int
+	quotaExceeded bool // set if the request failed because of a quota
 }
 
 func (rw *webdavRW) WriteHeader(statusCode int) {
+	// The webdav module doesn't know about quotas so fix the status
+	if rw.quotaExceeded && statusCode >= 400 {
+		statusCode = http.StatusInsufficientStorage
+	}
 	rw.status = statusCode
 	rw.ResponseWriter.WriteHeader(statusCode)
 }
 
+// webdavRWKey is the context key for the *webdavRW of the request
+type webdavRWKey struct{}
+
+// checkQuota notes if err is because a quota was exceeded so the
+// response can say so, returning err
+func checkQuota(ctx context.Context, err error) error {
+	if errors.Is(err, vfs.ENOSPC) {
+		if rw, ok := ctx.Value(webdavRWKey{}).(*webdavRW); ok {
+			rw.quotaExceeded = true
+		}
+	}
+	return err
+}
+
 func (rw *webdavRW) isSuccessfull() bool {
 	return rw.status == 0 || (rw.status >= 200 && rw.status <= 299)
 }
@@ -313,6 +378,124 @@ func (w *WebDAV) postprocess(r *http.Request, remote string) {
 	}
 }
 
+// checkPreconditions evaluates the If-Match, If-None-Match and
+// If-Unmodified-Since headers from RFC 7232 for requests which modify
+// remote. The webdav module doesn't check these for writes so they
+// are checked here against the object freshly read from the backend
+// so changes made by other clients are noticed.
+//
+// It returns http.StatusPreconditionFailed if the request should not
+// go ahead or 0 if it should.
+func (w *WebDAV) checkPreconditions(r *http.Request, remote string) (status int, err error) {
+	switch r.Method {
+	case "PUT", "DELETE", "MOVE":
+	default:
+		return 0, nil
+	}
+	ifMatch := r.Header.Get("If-Match")
+	ifNoneMatch := r.Header.Get("If-None-Match")
+	ifUnmodifiedSince := r.Header.Get("If-Unmodified-Since")
+	if ifMatch == "" && ifNoneMatch == "" && ifUnmodifiedSince == "" {
+		return 0, nil
+	}
+	ctx := r.Context()
+	VFS, err := w.getVFS(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	// Find the current state of remote
+	var (
+		exists  bool
+		modTime time.Time
+		size    int64
+		o       fs.Object
+	)
+	node, err := VFS.Stat(remote)
+	switch {
+	case err == nil:
+		exists, modTime, size = true, node.ModTime(), node.Size()
+		if node.IsDir() {
+			break
+		}
+		o, err = VFS.Fs().NewObject(ctx, node.Path())
+		if err == nil {
+			modTime, size = o.ModTime(ctx), o.Size()
+		} else if errors.Is(err, fs.ErrorObjectNotFound) {
+			// If the VFS has uploaded the file then it has
+			// been removed from the backend, otherwise it is
+			// still being written so use what the VFS knows.
+			o = nil
+			exists = node.DirEntry() == nil
+		} else {
+			return 0, err
+		}
+	case errors.Is(err, vfs.ENOENT):
+		// The directory cache may not know about the object yet
+		o, err = VFS.Fs().NewObject(ctx, remote)
+		if err == nil {
+			exists, modTime, size = true, o.ModTime(ctx), o.Size()
+		} else if !errors.Is(err, fs.ErrorObjectNotFound) && !errors.Is(err, fs.ErrorIsDir) {
+			return 0, err
+		}
+	default:
+		return 0, err
+	}
+	// Only read the ETag if needed as it may need a hash
+	var currentETag string
+	etag := func() string {
+		if currentETag != "" {
+			return currentETag
+		}
+		if o != nil && w.opt.HashType != hash.None {
+			if hash, err := o.Hash(ctx, w.opt.HashType); err == nil && hash != "" {
+				currentETag = `"` + hash + `"`
+				return currentETag
+			}
+		}
+		// This is the ETag the webdav module makes without a hash
+		currentETag = fmt.Sprintf(`"%x%x"`, modTime.UnixNano(), size)
+		return currentETag
+	}
+
+	if ifMatch != "" {
+		if !exists || !etagMatch(ifMatch, etag, false) {
+			return http.StatusPreconditionFailed, nil
+		}
+	} else if ifUnmodifiedSince != "" && exists {
+		t, err := http.ParseTime(ifUnmodifiedSince)
+		if err == nil && modTime.Truncate(time.Second).After(t) {
+			return http.StatusPreconditionFailed, nil
+		}
+	}
+	if ifNoneMatch != "" && exists && etagMatch(ifNoneMatch, etag, true) {
+		return http.StatusPreconditionFailed, nil
+	}
+	return 0, nil
+}
+
+// etagMatch returns true if any of the comma separated entity tags
+// in list match the one returned by etag, using the weak comparison
+// if weak is set.
+func etagMatch(list string, etag func() string, weak bool) bool {
+	for _, tag := range strings.Split(list, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		if strings.HasPrefix(tag, "W/") {
+			if !weak {
+				continue
+			}
+			tag = tag[2:]
+		}
+		if tag == etag() {
+			return true
+		}
+	}
+	return false
+}
+
 func (w *WebDAV) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 	urlPath := r.URL.Path
 	isDir := strings.HasSuffix(urlPath, "/")
@@ -325,6 +508,27 @@ func (w *WebDAV) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 	// return absolute references.
 	r.URL.Path = w.opt.HTTP.BaseURL + r.URL.Path
 	wrw := &webdavRW{ResponseWriter: rw}
+	user, _ := libhttp.CtxGetUser(r.Context())
+	ctx := context.WithValue(r.Context(), webdavRWKey{}, wrw)
+	ctx = context.WithValue(ctx, auditInfoKey{}, vfs.AuditInfo{
+		User:       user,
+		Protocol:   "webdav",
+		RemoteAddr: r.RemoteAddr,
+	})
+	r = r.WithContext(ctx)
+	// Hold the paths changed until the write is done so the
+	// preconditions still hold when it is made
+	for _, lockRemote := range w.writePaths(r, remote) {
+		defer w.locks.lock(lockRemote)()
+	}
+	status, err := w.checkPreconditions(r, remote)
+	if err != nil {
+		serve.Error(remote, rw, "Failed to check preconditions", err)
+		return
+	} else if status != 0 {
+		http.Error(rw, http.StatusText(status), status)
+		return
+	}
 	w.webdavhandler.ServeHTTP(wrw, r)
 
 	if wrw.isSuccessfull() {
@@ -332,6 +536,61 @@ func (w *WebDAV) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// writePaths returns the paths r changes in the order they should be
+// locked, or nil if it doesn't change any.
+func (w *WebDAV) writePaths(r *http.Request, remote string) []string {
+	var paths []string
+	switch r.Method {
+	case "PUT", "DELETE":
+		paths = []string{remote}
+	case "MOVE", "COPY":
+		paths = []string{remote}
+		if u, err := url.Parse(r.Header.Get("Destination")); err == nil && u.Path != "" {
+			dst := strings.Trim(strings.TrimPrefix(u.Path, w.opt.HTTP.BaseURL), "/")
+			if dst != remote {
+				paths = append(paths, dst)
+			}
+		}
+		// Always lock in the same order so requests can't deadlock
+		sort.Strings(paths)
+	}
+	return paths
+}
+
+// pathLocks holds a lock for each path being written
+type pathLocks struct {
+	mu    sync.Mutex
+	locks map[string]*pathLock
+}
+
+// pathLock is a lock on a path and the number of users of it
+type pathLock struct {
+	mu    sync.Mutex
+	users int
+}
+
+// lock locks remote returning a function to unlock it
+func (pl *pathLocks) lock(remote string) (unlock func()) {
+	pl.mu.Lock()
+	l := pl.locks[remote]
+	if l == nil {
+		l = &pathLock{}
+		pl.locks[remote] = l
+	}
+	l.users++
+	pl.mu.Unlock()
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		pl.mu.Lock()
+		l.users--
+		if l.users == 0 {
+			delete(pl.locks, remote)
+		}
+		pl.mu.Unlock()
+	}
+}
+
 // serveDir serves a directory index at dirRemote
 // This is similar to serveDir in serve http.
 func (w *WebDAV) serveDir(rw http.ResponseWriter, r *http.Request, dirRemote string) {
@@ -364,6 +623,9 @@ func (w *WebDAV) serveDir(rw http.ResponseWriter, r *http.Request, dirRemote str
 
 	// Make the entries for display
 	directory := serve.NewDirectory(dirRemote, w.Server.HTMLTemplate())
+	if token, ok := libhttp.CtxGetShare(r.Context()); ok {
+		directory.SetQuery(url.Values{libhttp.ShareParam: {token}})
+	}
 	for _, node := range dirEntries {
 		if vfsflags.Opt.NoModTime {
 			directory.AddHTMLEntry(node.Path(), node.IsDir(), node.Size(), time.Time{})
@@ -400,12 +662,7 @@ func (w *WebDAV) Mkdir(ctx context.Context, name string, perm os.FileMode) (err
 	if err != nil {
 		return err
 	}
-	dir, leaf, err := VFS.StatParent(name)
-	if err != nil {
-		return err
-	}
-	_, err = dir.Mkdir(leaf)
-	return err
+	return VFS.Mkdir(name, perm)
 }
 
 // OpenFile opens a file or a directory
@@ -417,7 +674,7 @@ func (w *WebDAV) OpenFile(ctx context.Context, name string, flags int, perm os.F
 	}
 	f, err := VFS.OpenFile(name, flags, perm)
 	if err != nil {
-		return nil, err
+		return nil, checkQuota(ctx, err)
 	}
 	return Handle{Handle: f, w: w, ctx: ctx}, nil
 }
@@ -429,15 +686,7 @@ func (w *WebDAV) RemoveAll(ctx context.Context, name string) (err error) {
 	if err != nil {
 		return err
 	}
-	node, err := VFS.Stat(name)
-	if err != nil {
-		return err
-	}
-	err = node.RemoveAll()
-	if err != nil {
-		return err
-	}
-	return nil
+	return VFS.RemoveAll(name)
 }
 
 // Rename a file or a directory
@@ -471,6 +720,12 @@ type Handle struct {
 	ctx context.Context
 }
 
+// Write writes to the handle
+func (h Handle) Write(p []byte) (n int, err error) {
+	n, err = h.Handle.Write(p)
+	return n, checkQuota(h.ctx, err)
+}
+
 // Readdir reads directory entries from the handle
 func (h Handle) Readdir(count int) (fis []os.FileInfo, err error) {
 	fis, err = h.Handle.Readdir(count)
@@ -526,9 +781,94 @@ func (h Handle) DeadProps() (map[xml.Name]webdav.Property, error) {
 	property.InnerXML = strconv.AppendInt(nil, h.Handle.Node().ModTime().Unix(), 10)
 	properties[xmlName] = property
 
+	// RFC 4331 quota properties for directories
+	if h.Handle.Node().IsDir() {
+		if VFS, err := h.w.getVFS(h.ctx); err == nil {
+			used, available := h.w.quotaUsage(h.ctx, VFS.VFS)
+			for local, value := range map[string]int64{
+				"quota-used-bytes":      used,
+				"quota-available-bytes": available,
+			} {
+				if value < 0 {
+					continue
+				}
+				xmlName = xml.Name{Space: "DAV:", Local: local}
+				properties[xmlName] = webdav.Property{
+					XMLName:  xmlName,
+					InnerXML: strconv.AppendInt(nil, value, 10),
+				}
+			}
+		}
+	}
+
 	return properties, nil
 }
 
+// quotaUsage returns the used and available bytes for the RFC 4331
+// quota properties. These come from the VFS quota if there is one,
+// otherwise from the About of the remote if it supports it.
+//
+// The values are -1 if they aren't known.
+func (w *WebDAV) quotaUsage(ctx context.Context, VFS *vfs.VFS) (used, available int64) {
+	if q, ok := VFS.Quota(); ok && q.MaxSize >= 0 {
+		available = q.MaxSize - q.Size
+		if available < 0 {
+			available = 0
+		}
+		return q.Size, available
+	}
+	used, available = -1, -1
+	u := w.abouts.get(ctx, VFS)
+	if u == nil {
+		return used, available
+	}
+	if u.Used != nil {
+		used = *u.Used
+	}
+	if u.Free != nil {
+		available = *u.Free
+	} else if u.Total != nil && u.Used != nil {
+		available = *u.Total - *u.Used
+	}
+	return used, available
+}
+
+// aboutCache caches the About of each remote so it isn't read for
+// every directory listed
+type aboutCache struct {
+	mu      sync.Mutex
+	entries map[string]aboutEntry
+}
+
+// aboutEntry is an About read at a given time
+type aboutEntry struct {
+	usage *fs.Usage
+	read  time.Time
+}
+
+// get returns the About of the remote of VFS read within the last
+// --dir-cache-time, or nil if it can't be read.
+func (ac *aboutCache) get(ctx context.Context, VFS *vfs.VFS) *fs.Usage {
+	f := VFS.Fs()
+	doAbout := f.Features().About
+	if doAbout == nil {
+		return nil
+	}
+	key := fs.ConfigString(f)
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	if entry, ok := ac.entries[key]; ok && time.Since(entry.read) < VFS.Opt.DirCacheTime {
+		return entry.usage
+	}
+	usage, err := doAbout(ctx)
+	if err != nil {
+		fs.Errorf(f, "Failed to read quota: %v", err)
+		usage = nil
+	}
+	ac.entries[key] = aboutEntry{usage: usage, read: time.Now()}
+	return usage
+}
+
 // Patch changes modtime of the underlying resources, it returns ok for all properties, the error is from setModtime if any
 // FIXME does not check for invalid property and SetModTime error
 func (h Handle) Patch(proppatches []webdav.Proppatch) ([]webdav.Propstat, error) {
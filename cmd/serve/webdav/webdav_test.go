@@ -14,6 +14,7 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -24,6 +25,7 @@ import (
 	"github.com/rclone/rclone/fs/config/obscure"
 	"github.com/rclone/rclone/fs/filter"
 	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/vfs/vfsflags"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/net/webdav"
@@ -260,3 +262,189 @@ func HelpTestGET(t *testing.T, testURL string) {
 		checkGolden(t, test.Golden, body)
 	}
 }
+
+func TestQuota(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(dir+"/a", []byte("aaa"), 0666))
+	f, err := fs.NewFs(context.Background(), dir)
+	require.NoError(t, err)
+
+	oldOpt := vfsflags.Opt
+	defer func() { vfsflags.Opt = oldOpt }()
+	vfsflags.Opt.QuotaSize = 10
+
+	opt := DefaultOpt
+	opt.HTTP.ListenAddr = []string{testBindAddress}
+	w, err := newWebDAV(context.Background(), f, &opt)
+	require.NoError(t, err)
+	require.NoError(t, w.serve())
+	defer func() {
+		assert.NoError(t, w.Shutdown())
+		w.Wait()
+	}()
+	testURL := w.Server.URLs()[0]
+
+	do := func(method, name, body string) (int, string) {
+		req, err := http.NewRequest(method, testURL+name, strings.NewReader(body))
+		require.NoError(t, err)
+		if method == "PROPFIND" {
+			req.Header.Set("Depth", "0")
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return resp.StatusCode, string(data)
+	}
+
+	status, _ := do("PUT", "b", "bbbbb")
+	assert.Equal(t, http.StatusCreated, status)
+	status, _ = do("PUT", "c", "cccccc")
+	assert.Equal(t, http.StatusInsufficientStorage, status)
+
+	status, body := do("PROPFIND", "", `<?xml version="1.0"?>
+<propfind xmlns="DAV:"><prop><quota-used-bytes/><quota-available-bytes/></prop></propfind>`)
+	assert.Equal(t, http.StatusMultiStatus, status)
+	assert.Contains(t, body, `<D:quota-used-bytes>8</D:quota-used-bytes>`)
+	assert.Contains(t, body, `<D:quota-available-bytes>2</D:quota-available-bytes>`)
+}
+
+func TestQuotaAbout(t *testing.T) {
+	f, err := fs.NewFs(context.Background(), t.TempDir())
+	require.NoError(t, err)
+	require.NotNil(t, f.Features().About)
+
+	opt := DefaultOpt
+	opt.HTTP.ListenAddr = []string{testBindAddress}
+	w, err := newWebDAV(context.Background(), f, &opt)
+	require.NoError(t, err)
+	require.NoError(t, w.serve())
+	defer func() {
+		assert.NoError(t, w.Shutdown())
+		w.Wait()
+	}()
+
+	req, err := http.NewRequest("PROPFIND", w.Server.URLs()[0], strings.NewReader(`<?xml version="1.0"?>
+<propfind xmlns="DAV:"><prop><quota-used-bytes/><quota-available-bytes/></prop></propfind>`))
+	require.NoError(t, err)
+	req.Header.Set("Depth", "0")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusMultiStatus, resp.StatusCode)
+	assert.Regexp(t, `<D:quota-used-bytes>\d+</D:quota-used-bytes>`, string(body))
+	assert.Regexp(t, `<D:quota-available-bytes>\d+</D:quota-available-bytes>`, string(body))
+}
+
+func TestConditionalRequests(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(dir+"/a", []byte("aaa"), 0666))
+	f, err := fs.NewFs(context.Background(), dir)
+	require.NoError(t, err)
+
+	opt := DefaultOpt
+	opt.HTTP.ListenAddr = []string{testBindAddress}
+	opt.HashType = hash.MD5
+	w, err := newWebDAV(context.Background(), f, &opt)
+	require.NoError(t, err)
+	require.NoError(t, w.serve())
+	defer func() {
+		assert.NoError(t, w.Shutdown())
+		w.Wait()
+	}()
+	testURL := w.Server.URLs()[0]
+
+	do := func(method, name, body string, headers ...string) *http.Response {
+		req, err := http.NewRequest(method, testURL+name, strings.NewReader(body))
+		require.NoError(t, err)
+		for i := 0; i < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		_, _ = io.Copy(io.Discard, resp.Body)
+		require.NoError(t, resp.Body.Close())
+		return resp
+	}
+
+	// The ETag is the MD5 of the contents
+	resp := do("HEAD", "a", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	etag := resp.Header.Get("ETag")
+	assert.Equal(t, `"47bce5c74f589f4867dbd57e9ca9f808"`, etag)
+
+	// Create only if it doesn't exist
+	assert.Equal(t, http.StatusPreconditionFailed, do("PUT", "a", "x", "If-None-Match", "*").StatusCode)
+	assert.Equal(t, http.StatusCreated, do("PUT", "b", "b", "If-None-Match", "*").StatusCode)
+	assert.Equal(t, http.StatusPreconditionFailed, do("PUT", "c", "c", "If-Match", "*").StatusCode)
+
+	// Update if unchanged
+	assert.Equal(t, http.StatusPreconditionFailed, do("PUT", "a", "x", "If-Match", `"wrong"`).StatusCode)
+	assert.Equal(t, http.StatusPreconditionFailed, do("PUT", "a", "x", "If-Match", "W/"+etag).StatusCode)
+	assert.Equal(t, http.StatusPreconditionFailed, do("PUT", "a", "x", "If-None-Match", "W/"+etag).StatusCode)
+	assert.Equal(t, http.StatusCreated, do("PUT", "a", "bbb", "If-Match", `"other", `+etag).StatusCode)
+
+	// The old ETag doesn't match any more
+	assert.Equal(t, http.StatusPreconditionFailed, do("DELETE", "a", "", "If-Match", etag).StatusCode)
+	etag = do("HEAD", "a", "").Header.Get("ETag")
+	assert.Equal(t, `"08f8e0260c64418510cefb2b06eee5cd"`, etag)
+
+	// Change the file behind the server's back which the check
+	// must notice even though the directory cache doesn't
+	require.NoError(t, os.WriteFile(dir+"/a", []byte("ccc"), 0666))
+	assert.Equal(t, http.StatusPreconditionFailed, do("DELETE", "a", "", "If-Match", etag).StatusCode)
+
+	// If-Unmodified-Since
+	past := time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+	future := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	assert.Equal(t, http.StatusPreconditionFailed, do("MOVE", "a", "", "Destination", testURL+"d", "If-Unmodified-Since", past).StatusCode)
+	assert.Equal(t, http.StatusCreated, do("MOVE", "a", "", "Destination", testURL+"d", "If-Unmodified-Since", future).StatusCode)
+	_, err = os.Stat(dir + "/d")
+	assert.NoError(t, err)
+
+	// Only one of many racing creates can succeed
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		created int
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if do("PUT", "e", "e", "If-None-Match", "*").StatusCode == http.StatusCreated {
+				mu.Lock()
+				created++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, created)
+	assert.Equal(t, 0, len(w.locks.locks))
+}
+
+func TestPathLocks(t *testing.T) {
+	pl := pathLocks{locks: map[string]*pathLock{}}
+	unlock := pl.lock("a")
+
+	// Other paths aren't blocked
+	pl.lock("b")()
+
+	locked := make(chan struct{})
+	go func() {
+		pl.lock("a")()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+		t.Fatal("path locked twice")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	<-locked
+	assert.Equal(t, 0, len(pl.locks))
+}
@@ -0,0 +1,61 @@
+package sharelink
+
+import (
+	"context"
+
+	"github.com/rclone/rclone/fs/rc"
+	libhttp "github.com/rclone/rclone/lib/http"
+)
+
+func init() {
+	rc.Add(rc.Call{
+		Path:         "serve/sharelink",
+		AuthRequired: true,
+		Fn:           rcShareLink,
+		Title:        "Make signed share links on the running servers",
+		Help: `This makes a link to a path on each running ` + "`serve http` or `serve webdav`" + `
+server started with ` + "`--share-secret`" + `, which can be used without
+logging in to the server.
+
+This takes the following parameters:
+
+- path - the path to share relative to the root of the server, ending in / for a directory (required)
+- expire - the amount of time that the link will be valid, e.g. "1d" (optional, default for ever)
+- maxDownloads - number of times files can be downloaded with the link (optional, default unlimited)
+- password - password needed to use the link (optional)
+
+Returns:
+
+- links - a list of the links, one for each address served
+
+Example:
+
+    rclone rc serve/sharelink path=path/to/file expire=1d
+`,
+	})
+}
+
+// rcShareLink makes share links on the running servers
+func rcShareLink(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	remote, err := in.GetString("path")
+	if err != nil {
+		return nil, err
+	}
+	var opt libhttp.ShareOptions
+	if opt.Expire, err = in.GetDuration("expire"); rc.NotErrParamNotFound(err) {
+		return nil, err
+	}
+	n, err := in.GetInt64("maxDownloads")
+	if rc.NotErrParamNotFound(err) {
+		return nil, err
+	}
+	opt.MaxDownloads = int(n)
+	if opt.Password, err = in.GetString("password"); rc.NotErrParamNotFound(err) {
+		return nil, err
+	}
+	links, err := libhttp.ShareLinks(remote, opt)
+	if err != nil {
+		return nil, err
+	}
+	return rc.Params{"links": links}, nil
+}
@@ -0,0 +1,87 @@
+// Package sharelink provides the sharelink command.
+package sharelink
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/flags"
+	libhttp "github.com/rclone/rclone/lib/http"
+	"github.com/spf13/cobra"
+)
+
+var (
+	secret       = ""
+	expire       = fs.Duration(0)
+	maxDownloads = 0
+	password     = ""
+)
+
+func init() {
+	cmd.Root.AddCommand(commandDefinition)
+	cmdFlags := commandDefinition.Flags()
+	flags.StringVarP(cmdFlags, &secret, "share-secret", "", secret, "Secret the server signs share links with", "")
+	flags.FVarP(cmdFlags, &expire, "expire", "", "The amount of time that the link will be valid - 0 for ever", "")
+	flags.IntVarP(cmdFlags, &maxDownloads, "max-downloads", "", maxDownloads, "Number of times files can be downloaded with the link - 0 for unlimited", "")
+	flags.StringVarP(cmdFlags, &password, "password", "", password, "Password needed to use the link", "")
+}
+
+var commandDefinition = &cobra.Command{
+	Use:   "sharelink url path",
+	Short: `Generate a signed share link for rclone serve http or webdav.`,
+	Long: `rclone sharelink makes a link to a file or directory served by
+` + "`rclone serve http` or `rclone serve webdav`" + ` which can be used without
+logging in to the server, for any remote.
+
+The server must be run with ` + "`--share-secret`" + ` and the same secret given
+to this command. The url is the address of the server, including any
+` + "`--baseurl`" + `, and the path is relative to the root of the server.
+
+    rclone sharelink --share-secret SECRET http://example.com:8080/ path/to/file
+    rclone sharelink --share-secret SECRET --expire 1d http://example.com:8080/ path/to/folder/
+    rclone sharelink --share-secret SECRET --max-downloads 3 --password pw http://example.com:8080/ path/to/file
+
+A path ending in ` + "`/`" + ` makes a link to the whole directory.
+
+The link stops working after the ` + "`--expire`" + ` time, or after files
+have been downloaded ` + "`--max-downloads`" + ` times, if set. If
+` + "`--password`" + ` is set the password must be given, with any user name,
+when the link is used.
+
+Links are signed, not stored, so the server doesn't need to be running
+to make them and they can't be removed individually. Change the
+secret to stop all links made with it working.
+
+Links can also be made on a running server with the
+[serve/sharelink](/rc/#serve-sharelink) rc command.
+`,
+	Annotations: map[string]string{
+		"versionIntroduced": "v1.67",
+	},
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(2, 2, command, args)
+		cmd.Run(false, false, command, func() error {
+			if secret == "" {
+				return errors.New("need --share-secret to sign the link")
+			}
+			link, err := libhttp.NewShareLink(args[0], secret, args[1], shareOptions())
+			if err != nil {
+				return err
+			}
+			fmt.Println(link)
+			return nil
+		})
+	},
+}
+
+// shareOptions returns the options for the link from the flags
+func shareOptions() libhttp.ShareOptions {
+	return libhttp.ShareOptions{
+		Expire:       time.Duration(expire),
+		MaxDownloads: maxDownloads,
+		Password:     password,
+	}
+}
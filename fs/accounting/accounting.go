@@ -62,7 +62,8 @@ type Account struct {
 	withBuf  bool          // is using a buffered in
 	checking bool          // set if attached transfer is checking
 
-	tokenBucket buckets // per file bandwidth limiter (may be nil)
+	tokenBucket  buckets       // per file bandwidth limiter (may be nil)
+	remoteLimits []remoteLimit // per remote bandwidth limiters
 
 	values accountValues
 }
@@ -347,6 +348,9 @@ func (acc *Account) accountRead(n int) {
 	acc.stats.Bytes(int64(n))
 
 	TokenBucket.LimitBandwidth(TokenBucketSlotAccounting, n)
+	for _, limit := range acc.remoteLimits {
+		limit.tb.LimitBandwidth(limit.slot, n)
+	}
 	acc.limitPerFileBandwidth(n)
 }
 
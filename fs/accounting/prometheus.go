@@ -19,6 +19,7 @@ type RcloneCollector struct {
 	deletes          *prometheus.Desc
 	deletedDirs      *prometheus.Desc
 	renames          *prometheus.Desc
+	hardLinks        *prometheus.Desc
 	fatalError       *prometheus.Desc
 	retryError       *prometheus.Desc
 }
@@ -59,6 +60,10 @@ func NewRcloneCollector(ctx context.Context) *RcloneCollector {
 			"Total number of files renamed",
 			nil, nil,
 		),
+		hardLinks: prometheus.NewDesc(namespace+"files_hard_linked_total",
+			"Total number of files hard linked",
+			nil, nil,
+		),
 		fatalError: prometheus.NewDesc(namespace+"fatal_error",
 			"Whether a fatal error has occurred",
 			nil, nil,
@@ -80,6 +85,7 @@ func (c *RcloneCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- c.deletes
 	ch <- c.deletedDirs
 	ch <- c.renames
+	ch <- c.hardLinks
 	ch <- c.fatalError
 	ch <- c.retryError
 }
@@ -97,6 +103,7 @@ func (c *RcloneCollector) Collect(ch chan<- prometheus.Metric) {
 	ch <- prometheus.MustNewConstMetric(c.deletes, prometheus.CounterValue, float64(s.deletes))
 	ch <- prometheus.MustNewConstMetric(c.deletedDirs, prometheus.CounterValue, float64(s.deletedDirs))
 	ch <- prometheus.MustNewConstMetric(c.renames, prometheus.CounterValue, float64(s.renames))
+	ch <- prometheus.MustNewConstMetric(c.hardLinks, prometheus.CounterValue, float64(s.hardLinks))
 	ch <- prometheus.MustNewConstMetric(c.fatalError, prometheus.GaugeValue, bool2Float(s.fatalError))
 	ch <- prometheus.MustNewConstMetric(c.retryError, prometheus.GaugeValue, bool2Float(s.retryError))
 
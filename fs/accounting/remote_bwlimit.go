@@ -0,0 +1,134 @@
+package accounting
+
+import (
+	"context"
+	"sync"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/rc"
+)
+
+// remoteTokenBuckets holds the per remote bandwidth limiters
+var remoteTokenBuckets = remoteBuckets{
+	buckets: make(map[string]*tokenBucket),
+}
+
+func init() {
+	fs.SetRemoteBwLimit = remoteTokenBuckets.set
+}
+
+// remoteBuckets holds a token bucket for each remote with a bandwidth
+// limit, keyed on the name of the remote
+type remoteBuckets struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+// remoteLimit is a per remote limiter which applies to a transfer
+type remoteLimit struct {
+	tb   *tokenBucket
+	slot TokenBucketSlot
+}
+
+// set the bandwidth timetable for the remote called name
+//
+// NewFs calls this each time the remote is made. If the remote
+// already has a limiter with the same timetable then it is left alone
+// so any changes made with core/bwlimit are kept, otherwise the
+// limiter is restarted with the new timetable.
+func (rb *remoteBuckets) set(name string, timetable fs.BwTimetable) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	tb := rb.buckets[name]
+	if tb == nil {
+		tb = &tokenBucket{logObj: name}
+		rb.buckets[name] = tb
+	}
+	tb.mu.Lock()
+	if tb.timetable != nil && tb.timetable.String() == timetable.String() {
+		tb.mu.Unlock()
+		return
+	}
+	tb._stopTicker()
+	tb.curr._setOff()
+	tb.prev._setOff()
+	tb.toggledOff = false
+	tb.timetable = timetable
+	tb._start(timetable)
+	tb.mu.Unlock()
+	tb.startTicker(timetable)
+}
+
+// reset removes all the limiters stopping their tickers
+func (rb *remoteBuckets) reset() {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	for name, tb := range rb.buckets {
+		tb.mu.Lock()
+		tb._stopTicker()
+		tb.mu.Unlock()
+		delete(rb.buckets, name)
+	}
+}
+
+// get the limiter for the remote called name or nil if it hasn't
+// got one, making it if create is set
+func (rb *remoteBuckets) get(name string, create bool) *tokenBucket {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	tb := rb.buckets[name]
+	if tb == nil && create {
+		tb = &tokenBucket{logObj: name}
+		rb.buckets[name] = tb
+	}
+	return tb
+}
+
+// limits returns the limiters which apply to a transfer from srcFs
+// to dstFs, either of which may be nil.
+//
+// The upload limit of dstFs and the download limit of srcFs apply as
+// do those of any remotes they wrap.
+func (rb *remoteBuckets) limits(srcFs, dstFs fs.Fs) (limits []remoteLimit) {
+	add := func(f fs.Fs, slot TokenBucketSlot) {
+		for f != nil {
+			if tb := rb.get(f.Name(), false); tb != nil {
+				limits = append(limits, remoteLimit{tb: tb, slot: slot})
+			}
+			unwrap := f.Features().UnWrap
+			if unwrap == nil {
+				break
+			}
+			f = unwrap()
+		}
+	}
+	add(srcFs, TokenBucketSlotTransportRx)
+	add(dstFs, TokenBucketSlotTransportTx)
+	return limits
+}
+
+// rates returns the current rate for each remote with a limiter
+func (rb *remoteBuckets) rates() map[string]string {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	rates := make(map[string]string, len(rb.buckets))
+	for name, tb := range rb.buckets {
+		_, bp := tb.limits()
+		rates[name] = bp.String()
+	}
+	return rates
+}
+
+// read and set the bandwidth limits of the remote in the fs parameter
+func (rb *remoteBuckets) rcBwlimit(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	f, err := rc.GetFs(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	tb := rb.get(f.Name(), in["rate"] != nil)
+	if tb == nil {
+		// Report an unlimited remote without making a limiter
+		tb = &tokenBucket{}
+	}
+	return tb.rcBwlimit(ctx, in)
+}
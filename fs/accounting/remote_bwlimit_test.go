@@ -0,0 +1,123 @@
+package accounting
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/fstest/mockfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoteBwLimit(t *testing.T) {
+	ctx := context.Background()
+
+	// Register mockfs temporarily
+	oldRegistry := fs.Registry
+	mockfs.Register()
+	defer func() {
+		fs.Registry = oldRegistry
+		remoteTokenBuckets.reset()
+	}()
+
+	// Making the remote should start its limiter
+	f, err := fs.NewFs(ctx, ":mockfs,bwlimit='1M:2M':/tmp")
+	require.NoError(t, err)
+	tb := remoteTokenBuckets.get(f.Name(), false)
+	require.NotNil(t, tb)
+	_, bp := tb.limits()
+	assert.Equal(t, fs.BwPair{Tx: fs.Mebi, Rx: 2 * fs.Mebi}, bp)
+
+	// Remote without a limit
+	other, err := fs.NewFs(ctx, ":mockfs:/tmp")
+	require.NoError(t, err)
+	assert.Nil(t, remoteTokenBuckets.get(other.Name(), false))
+
+	// Check the right directions are limited
+	limits := remoteTokenBuckets.limits(f, other)
+	assert.Equal(t, []remoteLimit{{tb: tb, slot: TokenBucketSlotTransportRx}}, limits)
+	limits = remoteTokenBuckets.limits(other, f)
+	assert.Equal(t, []remoteLimit{{tb: tb, slot: TokenBucketSlotTransportTx}}, limits)
+	assert.Nil(t, remoteTokenBuckets.limits(other, nil))
+
+	call := rc.Calls.Get("core/bwlimit")
+	require.NotNil(t, call)
+
+	// Query the remote
+	out, err := call.Fn(ctx, rc.Params{"fs": ":mockfs,bwlimit='1M:2M':/tmp"})
+	require.NoError(t, err)
+	assert.Equal(t, rc.Params{
+		"bytesPerSecond":   int64(2097152),
+		"bytesPerSecondTx": int64(1048576),
+		"bytesPerSecondRx": int64(2097152),
+		"rate":             "1Mi:2Mi",
+	}, out)
+
+	// Set a remote which didn't have a limit
+	out, err = call.Fn(ctx, rc.Params{"fs": ":mockfs:/tmp", "rate": "10M:off"})
+	require.NoError(t, err)
+	assert.Equal(t, rc.Params{
+		"bytesPerSecond":   int64(-1),
+		"bytesPerSecondTx": int64(10485760),
+		"bytesPerSecondRx": int64(-1),
+		"rate":             "10Mi:off",
+	}, out)
+	assert.NotNil(t, remoteTokenBuckets.get(other.Name(), false))
+
+	// Query the global limit which lists the remotes
+	out, err = call.Fn(ctx, rc.Params{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		f.Name():     "1Mi:2Mi",
+		other.Name(): "10Mi:off",
+	}, out["remotes"])
+	assert.Equal(t, "off", out["rate"])
+
+	// Making the remote again keeps the limit set with rc
+	_, err = call.Fn(ctx, rc.Params{"fs": ":mockfs,bwlimit='1M:2M':/tmp", "rate": "3M"})
+	require.NoError(t, err)
+	remoteTokenBuckets.set(f.Name(), fs.BwTimetable{{Bandwidth: fs.BwPair{Tx: fs.Mebi, Rx: 2 * fs.Mebi}}})
+	_, bp = tb.limits()
+	assert.Equal(t, fs.BwPair{Tx: 3 * fs.Mebi, Rx: 3 * fs.Mebi}, bp)
+}
+
+func TestRemoteBwLimitSet(t *testing.T) {
+	rb := remoteBuckets{buckets: make(map[string]*tokenBucket)}
+	defer rb.reset()
+
+	// A timetable with more than one entry starts a ticker
+	var timetable fs.BwTimetable
+	require.NoError(t, timetable.Set("00:00,1M 23:59,1M"))
+	rb.set("remote", timetable)
+	tb := rb.get("remote", false)
+	require.NotNil(t, tb)
+	tb.mu.Lock()
+	stop := tb.stop
+	tb.mu.Unlock()
+	require.NotNil(t, stop)
+
+	// A new timetable replaces the limit and the ticker
+	require.NoError(t, timetable.Set("2M"))
+	rb.set("remote", timetable)
+	assert.Equal(t, tb, rb.get("remote", false))
+	_, bp := tb.limits()
+	assert.Equal(t, fs.BwPair{Tx: 2 * fs.Mebi, Rx: 2 * fs.Mebi}, bp)
+	tb.mu.Lock()
+	assert.Nil(t, tb.stop)
+	tb.mu.Unlock()
+	_, open := <-stop
+	assert.False(t, open)
+
+	// Resetting stops the ticker and removes the limiter
+	require.NoError(t, timetable.Set("00:00,1M 23:59,1M"))
+	rb.set("remote", timetable)
+	tb.mu.Lock()
+	stop = tb.stop
+	tb.mu.Unlock()
+	rb.reset()
+	_, open = <-stop
+	assert.False(t, open)
+	assert.Nil(t, rb.get("remote", false))
+}
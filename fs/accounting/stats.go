@@ -51,6 +51,7 @@ type StatsInfo struct {
 	deletes             int64
 	deletesSize         int64
 	deletedDirs         int64
+	hardLinks           int64
 	inProgress          *inProgress
 	startedTransfers    []*Transfer   // currently active transfers
 	oldTimeRanges       timeRanges    // a merged list of time ranges for the transfers
@@ -113,6 +114,7 @@ func (s *StatsInfo) RemoteStats() (out rc.Params, err error) {
 	out["deletes"] = s.deletes
 	out["deletedDirs"] = s.deletedDirs
 	out["renames"] = s.renames
+	out["hardLinks"] = s.hardLinks
 	out["elapsedTime"] = time.Since(s.startTime).Seconds()
 	out["serverSideCopies"] = s.serverSideCopies
 	out["serverSideCopyBytes"] = s.serverSideCopyBytes
@@ -469,6 +471,9 @@ func (s *StatsInfo) String() string {
 		if s.renames != 0 {
 			_, _ = fmt.Fprintf(buf, "Renamed:       %10d\n", s.renames)
 		}
+		if s.hardLinks != 0 {
+			_, _ = fmt.Fprintf(buf, "Hard linked:   %10d\n", s.hardLinks)
+		}
 		if s.transfers != 0 || ts.totalTransfers != 0 {
 			_, _ = fmt.Fprintf(buf, "Transferred:   %10d / %d, %s\n",
 				s.transfers, ts.totalTransfers, percent(s.transfers, ts.totalTransfers))
@@ -677,7 +682,15 @@ func (s *StatsInfo) Renames(renames int64) int64 {
 	return s.renames
 }
 
-// ResetCounters sets the counters (bytes, checks, errors, transfers, deletes, renames) to 0 and resets lastError, fatalError and retryError
+// HardLinks updates the stats for hard links created
+func (s *StatsInfo) HardLinks(hardLinks int64) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hardLinks += hardLinks
+	return s.hardLinks
+}
+
+// ResetCounters sets the counters (bytes, checks, errors, transfers, deletes, renames, hard links) to 0 and resets lastError, fatalError and retryError
 func (s *StatsInfo) ResetCounters() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -693,6 +706,7 @@ func (s *StatsInfo) ResetCounters() {
 	s.deletesSize = 0
 	s.deletedDirs = 0
 	s.renames = 0
+	s.hardLinks = 0
 	s.startedTransfers = nil
 	s.oldDuration = 0
 
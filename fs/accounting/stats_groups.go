@@ -94,6 +94,7 @@ Returns the following values:
 	"errors": number of errors,
 	"eta": estimated time in seconds until the group completes,
 	"fatalError": boolean whether there has been at least one fatal error,
+	"hardLinks": number of files hard linked instead of transferred,
 	"lastError": last error string,
 	"renames" : number of files renamed,
 	"retryError": boolean showing whether there has been at least one non-NoRetryError,
@@ -384,6 +385,7 @@ func (sg *statsGroups) sum(ctx context.Context) *StatsInfo {
 			sum.transferring.merge(stats.transferring)
 			sum.transferQueueSize += stats.transferQueueSize
 			sum.renames += stats.renames
+			sum.hardLinks += stats.hardLinks
 			sum.renameQueue += stats.renameQueue
 			sum.renameQueueSize += stats.renameQueueSize
 			sum.deletes += stats.deletes
@@ -35,6 +35,9 @@ type tokenBucket struct {
 	prev       buckets
 	toggledOff bool
 	currLimit  fs.BwTimeSlot
+	logObj     any            // object to log against - nil for the global limiter
+	stop       chan struct{}  // close to stop the ticker - nil if not running
+	timetable  fs.BwTimetable // timetable set for a remote - nil if not set
 }
 
 // Return true if limit is disabled
@@ -101,30 +104,54 @@ func (tb *tokenBucket) StartTokenBucket(ctx context.Context) {
 	tb.mu.Lock()
 	defer tb.mu.Unlock()
 	ci := fs.GetConfig(ctx)
-	tb.currLimit = ci.BwLimit.LimitAt(time.Now())
-	if tb.currLimit.Bandwidth.IsSet() {
-		tb.curr = newTokenBucket(tb.currLimit.Bandwidth)
-		fs.Infof(nil, "Starting bandwidth limiter at %v Byte/s", &tb.currLimit.Bandwidth)
-	}
+	tb._start(ci.BwLimit)
 
 	// Start the SIGUSR2 signal handler to toggle bandwidth.
 	// This function does nothing in windows systems.
 	tb.startSignalHandler()
 }
 
+// Start the token bucket at the current limit in the timetable
+//
+// Call with lock held
+func (tb *tokenBucket) _start(timetable fs.BwTimetable) {
+	tb.currLimit = timetable.LimitAt(time.Now())
+	if tb.currLimit.Bandwidth.IsSet() {
+		tb.curr = newTokenBucket(tb.currLimit.Bandwidth)
+		fs.Infof(tb.logObj, "Starting bandwidth limiter at %v Byte/s", &tb.currLimit.Bandwidth)
+	}
+}
+
 // StartTokenTicker creates a ticker to update the bandwidth limiter every minute.
 func (tb *tokenBucket) StartTokenTicker(ctx context.Context) {
 	ci := fs.GetConfig(ctx)
+	tb.startTicker(ci.BwLimit)
+}
+
+// startTicker creates a ticker to update the bandwidth limiter every
+// minute from the timetable passed in.
+func (tb *tokenBucket) startTicker(timetable fs.BwTimetable) {
 	// If the timetable has a single entry or was not specified, we don't need
 	// a ticker to update the bandwidth.
-	if len(ci.BwLimit) <= 1 {
+	if len(timetable) <= 1 {
 		return
 	}
 
 	ticker := time.NewTicker(time.Minute)
+	stop := make(chan struct{})
+	tb.mu.Lock()
+	tb._stopTicker()
+	tb.stop = stop
+	tb.mu.Unlock()
 	go func() {
-		for range ticker.C {
-			limitNow := ci.BwLimit.LimitAt(time.Now())
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+			limitNow := timetable.LimitAt(time.Now())
 			tb.mu.Lock()
 
 			if tb.currLimit.Bandwidth != limitNow.Bandwidth {
@@ -142,14 +169,14 @@ func (tb *tokenBucket) StartTokenTicker(ctx context.Context) {
 				if limitNow.Bandwidth.IsSet() {
 					*targetBucket = newTokenBucket(limitNow.Bandwidth)
 					if tb.toggledOff {
-						fs.Logf(nil, "Scheduled bandwidth change. "+
+						fs.Logf(tb.logObj, "Scheduled bandwidth change. "+
 							"Limit will be set to %v Byte/s when toggled on again.", &limitNow.Bandwidth)
 					} else {
-						fs.Logf(nil, "Scheduled bandwidth change. Limit set to %v Byte/s", &limitNow.Bandwidth)
+						fs.Logf(tb.logObj, "Scheduled bandwidth change. Limit set to %v Byte/s", &limitNow.Bandwidth)
 					}
 				} else {
 					targetBucket._setOff()
-					fs.Logf(nil, "Scheduled bandwidth change. Bandwidth limits disabled")
+					fs.Logf(tb.logObj, "Scheduled bandwidth change. Bandwidth limits disabled")
 				}
 
 				tb.currLimit = limitNow
@@ -160,6 +187,16 @@ func (tb *tokenBucket) StartTokenTicker(ctx context.Context) {
 	}()
 }
 
+// Stop the ticker if it is running
+//
+// Call with lock held
+func (tb *tokenBucket) _stopTicker() {
+	if tb.stop != nil {
+		close(tb.stop)
+		tb.stop = nil
+	}
+}
+
 // LimitBandwidth sleeps for the correct amount of time for the passage
 // of n bytes according to the current bandwidth limit
 func (tb *tokenBucket) LimitBandwidth(i TokenBucketSlot, n int) {
@@ -182,11 +219,29 @@ func (tb *tokenBucket) SetBwLimit(bandwidth fs.BwPair) {
 	defer tb.mu.Unlock()
 	if bandwidth.IsSet() {
 		tb.curr = newTokenBucket(bandwidth)
-		fs.Logf(nil, "Bandwidth limit set to %v", bandwidth)
+		fs.Logf(tb.logObj, "Bandwidth limit set to %v", bandwidth)
 	} else {
 		tb.curr._setOff()
-		fs.Logf(nil, "Bandwidth limit reset to unlimited")
+		fs.Logf(tb.logObj, "Bandwidth limit reset to unlimited")
+	}
+}
+
+// limits returns the current bandwidth limits with -1 for unlimited
+func (tb *tokenBucket) limits() (bytesPerSecond int64, bp fs.BwPair) {
+	tb.mu.RLock()
+	defer tb.mu.RUnlock()
+	bytesPerSecond = -1
+	if tb.curr[TokenBucketSlotAccounting] != nil {
+		bytesPerSecond = int64(tb.curr[TokenBucketSlotAccounting].Limit())
+	}
+	bp = fs.BwPair{Tx: -1, Rx: -1}
+	if tb.curr[TokenBucketSlotTransportTx] != nil {
+		bp.Tx = fs.SizeSuffix(tb.curr[TokenBucketSlotTransportTx].Limit())
 	}
+	if tb.curr[TokenBucketSlotTransportRx] != nil {
+		bp.Rx = fs.SizeSuffix(tb.curr[TokenBucketSlotTransportRx].Limit())
+	}
+	return bytesPerSecond, bp
 }
 
 // read and set the bandwidth limits
@@ -207,19 +262,7 @@ func (tb *tokenBucket) rcBwlimit(ctx context.Context, in rc.Params) (out rc.Para
 		bw := bws[0]
 		tb.SetBwLimit(bw.Bandwidth)
 	}
-	tb.mu.RLock()
-	bytesPerSecond := int64(-1)
-	if tb.curr[TokenBucketSlotAccounting] != nil {
-		bytesPerSecond = int64(tb.curr[TokenBucketSlotAccounting].Limit())
-	}
-	var bp = fs.BwPair{Tx: -1, Rx: -1}
-	if tb.curr[TokenBucketSlotTransportTx] != nil {
-		bp.Tx = fs.SizeSuffix(tb.curr[TokenBucketSlotTransportTx].Limit())
-	}
-	if tb.curr[TokenBucketSlotTransportRx] != nil {
-		bp.Rx = fs.SizeSuffix(tb.curr[TokenBucketSlotTransportRx].Limit())
-	}
-	tb.mu.RUnlock()
+	bytesPerSecond, bp := tb.limits()
 	out = rc.Params{
 		"rate":             bp.String(),
 		"bytesPerSecond":   bytesPerSecond,
@@ -234,7 +277,17 @@ func init() {
 	rc.Add(rc.Call{
 		Path: "core/bwlimit",
 		Fn: func(ctx context.Context, in rc.Params) (out rc.Params, err error) {
-			return TokenBucket.rcBwlimit(ctx, in)
+			if in["fs"] != nil {
+				return remoteTokenBuckets.rcBwlimit(ctx, in)
+			}
+			out, err = TokenBucket.rcBwlimit(ctx, in)
+			if err != nil {
+				return out, err
+			}
+			if remotes := remoteTokenBuckets.rates(); len(remotes) > 0 {
+				out["remotes"] = remotes
+			}
+			return out, nil
 		},
 		Title: "Set the bandwidth limit.",
 		Help: `
@@ -281,6 +334,22 @@ except only one bandwidth may be specified.
 
 In either case "rate" is returned as a human-readable string, and
 "bytesPerSecond" is returned as a number.
+
+If any remotes have their own bandwidth limit, set with the bwlimit
+option in their config or connection string, then the query also
+returns a "remotes" object mapping the remote name to its rate.
+
+Pass the "fs" parameter to query or set the limit for a single remote
+instead of the global limit. This is independent of the global limit
+and any bwlimit timetable for the remote will carry on adjusting it.
+
+    rclone rc core/bwlimit fs=nas: rate=10M:off
+    {
+        "bytesPerSecond": -1,
+        "bytesPerSecondTx": 10485760,
+        "bytesPerSecondRx": -1,
+        "rate": "10Mi:off"
+    }
 `,
 	})
 }
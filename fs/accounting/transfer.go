@@ -152,6 +152,7 @@ func (tr *Transfer) Account(ctx context.Context, in io.ReadCloser) *Account {
 	tr.mu.Lock()
 	if tr.acc == nil {
 		tr.acc = newAccountSizeName(ctx, tr.stats, in, tr.size, tr.remote)
+		tr.acc.remoteLimits = remoteTokenBuckets.limits(tr.srcFs, tr.dstFs)
 	} else {
 		tr.acc.UpdateReader(ctx, in)
 	}
@@ -9,6 +9,12 @@ import (
 	"time"
 )
 
+// SetRemoteBwLimit is called by NewFs with the name of the remote
+// and its timetable if the bwlimit option is set in its config.
+//
+// It is replaced by the accounting package which does the limiting.
+var SetRemoteBwLimit = func(name string, bwlimit BwTimetable) {}
+
 // BwPair represents an upload and a download bandwidth
 type BwPair struct {
 	Tx SizeSuffix // upload bandwidth
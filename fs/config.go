@@ -154,6 +154,8 @@ type ConfigInfo struct {
 	Inplace                    bool // Download directly to destination file instead of atomic download to temp/rename
 	PartialSuffix              string
 	MetadataMapper             SpaceSepList
+	HardLinks                  bool // Recreate hard links found in the source on the destination
+	ArchiveBrowse              bool // Show archives in sources as directories
 }
 
 // NewConfig creates a new config with everything set to the default
@@ -39,6 +39,7 @@ type Features struct {
 	NoMultiThreading         bool // set if can't have multiplethreads on one download open
 	Overlay                  bool // this wraps one or more backends to add functionality
 	ChunkWriterDoesntSeek    bool // set if the chunk writer doesn't need to read the data more than once
+	SparseFiles              bool // can leave holes in uploaded files as described by a SparseOption
 
 	// Purge all files in the directory specified
 	//
@@ -80,6 +81,15 @@ type Features struct {
 	// If destination exists then return fs.ErrorDirExists
 	DirMove func(ctx context.Context, src Fs, srcRemote, dstRemote string) error
 
+	// HardLink makes a hard link to src at remote.
+	//
+	// Any existing object at remote is replaced.
+	//
+	// It returns the destination Object and a possible error
+	//
+	// If it isn't possible then return fs.ErrorCantHardLink
+	HardLink func(ctx context.Context, src Object, remote string) (Object, error)
+
 	// MkdirMetadata makes the directory passed in as dir.
 	//
 	// It shouldn't return an error if it already exists.
@@ -288,6 +298,9 @@ func (ft *Features) Fill(ctx context.Context, f Fs) *Features {
 	if do, ok := f.(DirMover); ok {
 		ft.DirMove = do.DirMove
 	}
+	if do, ok := f.(HardLinker); ok {
+		ft.HardLink = do.HardLink
+	}
 	if do, ok := f.(MkdirMetadataer); ok {
 		ft.MkdirMetadata = do.MkdirMetadata
 	}
@@ -382,6 +395,7 @@ func (ft *Features) Mask(ctx context.Context, f Fs) *Features {
 	ft.FilterAware = ft.FilterAware && mask.FilterAware
 	ft.PartialUploads = ft.PartialUploads && mask.PartialUploads
 	ft.NoMultiThreading = ft.NoMultiThreading && mask.NoMultiThreading
+	ft.SparseFiles = ft.SparseFiles && mask.SparseFiles
 	// ft.Overlay = ft.Overlay && mask.Overlay don't propagate Overlay
 
 	if mask.Purge == nil {
@@ -396,6 +410,9 @@ func (ft *Features) Mask(ctx context.Context, f Fs) *Features {
 	if mask.DirMove == nil {
 		ft.DirMove = nil
 	}
+	if mask.HardLink == nil {
+		ft.HardLink = nil
+	}
 	if mask.MkdirMetadata == nil {
 		ft.MkdirMetadata = nil
 	}
@@ -530,6 +547,18 @@ type DirMover interface {
 	DirMove(ctx context.Context, src Fs, srcRemote, dstRemote string) error
 }
 
+// HardLinker is an optional interface for Fs
+type HardLinker interface {
+	// HardLink makes a hard link to src at remote.
+	//
+	// Any existing object at remote is replaced.
+	//
+	// It returns the destination Object and a possible error
+	//
+	// If it isn't possible then return fs.ErrorCantHardLink
+	HardLink(ctx context.Context, src Object, remote string) (Object, error)
+}
+
 // MkdirMetadataer is an optional interface for Fs
 type MkdirMetadataer interface {
 	// MkdirMetadata makes the directory passed in as dir.
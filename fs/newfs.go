@@ -6,6 +6,7 @@ import (
 	"context"
 	"crypto/md5"
 	"encoding/base64"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
@@ -39,6 +40,13 @@ func NewFs(ctx context.Context, path string) (Fs, error) {
 	if err != nil {
 		return nil, err
 	}
+	var bwlimit BwTimetable
+	if value, ok := config.Get(optBwLimit.Name); ok && value != "" {
+		err = bwlimit.Set(value)
+		if err != nil {
+			return nil, fmt.Errorf("bad bwlimit for remote %q: %w", configName, err)
+		}
+	}
 	overridden := fsInfo.Options.Overridden(config)
 	if len(overridden) > 0 {
 		extraConfig := overridden.String()
@@ -67,6 +75,9 @@ func NewFs(ctx context.Context, path string) (Fs, error) {
 	f, err := fsInfo.NewFs(ctx, configName, fsPath, config)
 	if f != nil && (err == nil || err == ErrorIsFile) {
 		addReverse(f, fsInfo)
+		if len(bwlimit) > 0 {
+			SetRemoteBwLimit(f.Name(), bwlimit)
+		}
 	}
 	return f, err
 }
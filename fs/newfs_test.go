@@ -43,3 +43,35 @@ func TestNewFs(t *testing.T) {
 	assert.Equal(t, ":mockfs{S_NHG}:/tmp", fs.ConfigString(f3))
 	assert.Equal(t, ":mockfs,potato='true':/tmp", fs.ConfigStringFull(f3))
 }
+
+func TestNewFsBwLimit(t *testing.T) {
+	ctx := context.Background()
+
+	// Register mockfs temporarily
+	oldRegistry := fs.Registry
+	mockfs.Register()
+	oldSetRemoteBwLimit := fs.SetRemoteBwLimit
+	var gotName string
+	var gotBwLimit fs.BwTimetable
+	fs.SetRemoteBwLimit = func(name string, bwlimit fs.BwTimetable) {
+		gotName, gotBwLimit = name, bwlimit
+	}
+	defer func() {
+		fs.Registry = oldRegistry
+		fs.SetRemoteBwLimit = oldSetRemoteBwLimit
+	}()
+
+	f, err := fs.NewFs(ctx, ":mockfs:/tmp")
+	require.NoError(t, err)
+	assert.Equal(t, "", gotName)
+
+	f, err = fs.NewFs(ctx, ":mockfs,bwlimit='1M:2M':/tmp")
+	require.NoError(t, err)
+	assert.Equal(t, f.Name(), gotName)
+	require.Equal(t, 1, len(gotBwLimit))
+	assert.Equal(t, fs.BwPair{Tx: fs.Mebi, Rx: 2 * fs.Mebi}, gotBwLimit[0].Bandwidth)
+
+	_, err = fs.NewFs(ctx, ":mockfs,bwlimit=potato:/tmp")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "bad bwlimit")
+}
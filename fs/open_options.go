@@ -277,6 +277,38 @@ func (o MetadataOption) Mandatory() bool {
 	return false
 }
 
+// Extent describes a region of an object
+type Extent struct {
+	Offset int64 // start of the region
+	Length int64 // length of the region in bytes
+}
+
+// SparseOption defines an Option which describes the holes in the
+// source of an upload.
+//
+// The data passed to Put or Update is still the whole object with
+// the holes reading as zeros. Backends which can write sparse files
+// may use this to leave holes in the destination instead of writing
+// the zeros.
+type SparseOption struct {
+	Holes []Extent // the holes in the object in ascending order
+}
+
+// Header formats the option as an http header
+func (o *SparseOption) Header() (key string, value string) {
+	return "", ""
+}
+
+// String formats the option into human-readable form
+func (o *SparseOption) String() string {
+	return fmt.Sprintf("SparseOption(%d holes)", len(o.Holes))
+}
+
+// Mandatory returns whether the option must be parsed or can be ignored
+func (o *SparseOption) Mandatory() bool {
+	return false
+}
+
 // MetadataAsOpenOptions fetch any metadata to set as open options
 func MetadataAsOpenOptions(ctx context.Context) (options []OpenOption) {
 	ci := GetConfig(ctx)
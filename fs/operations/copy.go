@@ -224,6 +224,24 @@ func (c *copy) updateOrPut(ctx context.Context, in io.ReadCloser, uploadOptions
 	return actionTaken, newDst, err
 }
 
+// Returns the holes in the source if it is sparse and the destination
+// can preserve them, or nil otherwise.
+func (c *copy) holes(ctx context.Context) []fs.Extent {
+	if !c.dstFeatures.SparseFiles {
+		return nil
+	}
+	do, ok := c.src.(fs.Holer)
+	if !ok {
+		return nil
+	}
+	holes, err := do.Holes(ctx)
+	if err != nil {
+		fs.Debugf(c.src, "Failed to read holes: %v", err)
+		return nil
+	}
+	return holes
+}
+
 // Do a manual copy by reading the bytes and writing them
 func (c *copy) manualCopy(ctx context.Context) (actionTaken string, newDst fs.Object, err error) {
 	// Remove partial files on premature exit
@@ -242,6 +260,10 @@ func (c *copy) manualCopy(ctx context.Context) (actionTaken string, newDst fs.Ob
 	if c.ci.MetadataSet != nil {
 		uploadOptions = append(uploadOptions, fs.MetadataOption(c.ci.MetadataSet))
 	}
+	holes := c.holes(ctx)
+	if len(holes) > 0 {
+		uploadOptions = append(uploadOptions, &fs.SparseOption{Holes: holes})
+	}
 
 	// Options for the download
 	downloadOptions := []fs.OpenOption{c.hashOption}
@@ -249,7 +271,9 @@ func (c *copy) manualCopy(ctx context.Context) (actionTaken string, newDst fs.Ob
 		downloadOptions = append(downloadOptions, option)
 	}
 
-	if doMultiThreadCopy(ctx, c.f, c.src) {
+	if len(holes) > 0 {
+		fs.Debugf(c.src, "Not using multi-thread copy to preserve %d holes", len(holes))
+	} else if doMultiThreadCopy(ctx, c.f, c.src) {
 		return c.multiThreadCopy(ctx, uploadOptions)
 	}
 
@@ -497,6 +497,47 @@ func move(ctx context.Context, fdst fs.Fs, dst fs.Object, remote string, src fs.
 	return newDst, DeleteFile(ctx, src)
 }
 
+// HardLink makes a hard link on fdst at src.Remote() to target, which
+// must be an object already on fdst, replacing dst if it exists.
+//
+// src is the source object which would otherwise be copied.
+//
+// It returns fs.ErrorCantHardLink if the link couldn't be made so
+// the caller can fall back to copying src.
+func HardLink(ctx context.Context, fdst fs.Fs, dst fs.Object, src fs.Object, target fs.Object) (newDst fs.Object, err error) {
+	doHardLink := fdst.Features().HardLink
+	if doHardLink == nil || !SameConfig(target.Fs(), fdst) {
+		return nil, fs.ErrorCantHardLink
+	}
+	tr := accounting.Stats(ctx).NewCheckingTransfer(src, "hard linking")
+	defer func() {
+		switch {
+		case err == nil:
+			accounting.Stats(ctx).HardLinks(1)
+			tr.Done(ctx, nil)
+		case errors.Is(err, fs.ErrorCantHardLink):
+			// Not an error as the caller will copy instead
+			tr.Done(ctx, nil)
+		default:
+			tr.Done(ctx, err)
+		}
+	}()
+	if SkipDestructive(ctx, src, "hard link") {
+		return dst, nil
+	}
+	newDst, err = doHardLink(ctx, target, src.Remote())
+	switch {
+	case err == nil:
+		fs.Infof(newDst, "Hard linked to %v", target)
+	case errors.Is(err, fs.ErrorCantHardLink):
+		fs.Debugf(src, "Can't hard link to %v", target)
+	default:
+		err = fs.CountError(err)
+		fs.Errorf(src, "Couldn't hard link to %v: %v", target, err)
+	}
+	return newDst, err
+}
+
 // CanServerSideMove returns true if fdst support server-side moves or
 // server-side copies
 //
@@ -27,6 +27,20 @@ var optDescription = Option{
 	Advanced: true,
 }
 
+// optBwLimit is the per remote bandwidth limit option
+var optBwLimit = Option{
+	Name: "bwlimit",
+	Help: `Bandwidth limit for this remote.
+
+This limits the bandwidth of transfers to and from this remote
+independently of the global --bwlimit. It takes the same
+upload:download and timetable format as --bwlimit. The upload limit
+applies when this remote is the destination and the download limit
+applies when it is the source.`,
+	Default:  "",
+	Advanced: true,
+}
+
 // RegInfo provides information about a filesystem
 type RegInfo struct {
 	// Name of this fs
@@ -291,7 +305,7 @@ func Register(info *RegInfo) {
 	if info.Prefix == "" {
 		info.Prefix = info.Name
 	}
-	info.Options = append(info.Options, optDescription)
+	info.Options = append(info.Options, optBwLimit, optDescription)
 	Registry = append(Registry, info)
 	for _, alias := range info.Aliases {
 		// Copy the info block and rename and hide the alias and options
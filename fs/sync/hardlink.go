@@ -0,0 +1,132 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/operations"
+)
+
+// hardLinks keeps track of hard linked source objects so they can be
+// recreated as hard links on the destination with --hard-links
+type hardLinks struct {
+	mu    sync.Mutex
+	links map[string]*hardLink // keyed on HardLinkID
+}
+
+// hardLink is the first destination object seen for a HardLinkID
+type hardLink struct {
+	done chan struct{} // closed when dst is valid
+	dst  fs.Object     // object to link to or nil if the transfer failed
+}
+
+// newHardLinks makes a new hard link tracker
+func newHardLinks() *hardLinks {
+	return &hardLinks{
+		links: make(map[string]*hardLink),
+	}
+}
+
+// hardLinkID returns the hard link ID of src or "" if it hasn't got one
+func hardLinkID(src fs.Object) string {
+	do, ok := src.(fs.HardLinkIDer)
+	if !ok {
+		return ""
+	}
+	return do.HardLinkID()
+}
+
+// get returns the hardLink for src or nil if src isn't hard linked.
+//
+// If first is set then the caller is the first to see this hard link
+// and must call set when the destination object is known.
+func (h *hardLinks) get(src fs.Object) (link *hardLink, first bool) {
+	id := hardLinkID(src)
+	if id == "" {
+		return nil, false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	link, found := h.links[id]
+	if found {
+		return link, false
+	}
+	link = &hardLink{
+		done: make(chan struct{}),
+	}
+	h.links[id] = link
+	return link, true
+}
+
+// existing records that dst is already an up to date copy of src so
+// later hard links to src can link to it.
+func (h *hardLinks) existing(src, dst fs.Object) {
+	link, first := h.get(src)
+	if first {
+		link.set(dst)
+	}
+}
+
+// set the destination object and wake up any waiters
+func (l *hardLink) set(dst fs.Object) {
+	l.dst = dst
+	close(l.done)
+}
+
+// wait for the destination object to be set returning it or nil if
+// the context was cancelled or the first transfer failed.
+func (l *hardLink) wait(ctx context.Context) fs.Object {
+	select {
+	case <-l.done:
+		return l.dst
+	case <-ctx.Done():
+		return nil
+	}
+}
+
+// copy src to fdst, making a hard link instead if src is hard linked
+// to a source object which has already been transferred.
+func (s *syncCopyMove) copy(ctx context.Context, fdst fs.Fs, dst, src fs.Object) (newDst fs.Object, err error) {
+	if s.hardLinks == nil {
+		return operations.Copy(ctx, fdst, dst, src.Remote(), src)
+	}
+	link, first := s.hardLinks.get(src)
+	if link == nil {
+		return operations.Copy(ctx, fdst, dst, src.Remote(), src)
+	}
+	if first {
+		newDst, err = operations.Copy(ctx, fdst, dst, src.Remote(), src)
+		if err != nil {
+			link.set(nil)
+		} else {
+			link.set(newDst)
+		}
+		return newDst, err
+	}
+	target := link.wait(ctx)
+	if target != nil {
+		newDst, err = operations.HardLink(ctx, fdst, dst, src, target)
+		if !errors.Is(err, fs.ErrorCantHardLink) {
+			return newDst, err
+		}
+	}
+	return operations.Copy(ctx, fdst, dst, src.Remote(), src)
+}
+
+// move src to fdst, making a hard link instead if src is hard linked
+// to a source object which has already been transferred and deleting
+// src afterwards.
+func (s *syncCopyMove) move(ctx context.Context, fdst fs.Fs, dst, src fs.Object) (newDst fs.Object, err error) {
+	if s.hardLinks == nil || operations.CanServerSideMove(fdst) && operations.SameConfig(src.Fs(), fdst) {
+		// Server-side moves preserve hard links already
+		return operations.MoveTransfer(ctx, fdst, dst, src.Remote(), src)
+	}
+	newDst, err = s.copy(ctx, fdst, dst, src)
+	if err != nil {
+		fs.Errorf(src, "Not deleting source as copy failed: %v", err)
+		return newDst, err
+	}
+	return newDst, operations.DeleteFile(ctx, src)
+}
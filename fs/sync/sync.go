@@ -94,6 +94,7 @@ type syncCopyMove struct {
 	setDirModTimes         []setDirModTime        // directories that need their modtime set
 	setDirModTimesMaxLevel int                    // max level of the directories to set
 	modifiedDirs           map[string]struct{}    // dirs with changed contents (if s.setDirModTimeAfter)
+	hardLinks              *hardLinks             // hard links seen if --hard-links is in use
 }
 
 // For keeping track of delayed modtime sets
@@ -264,6 +265,13 @@ func newSyncCopyMove(ctx context.Context, fdst, fsrc fs.Fs, deleteMode fs.Delete
 			s.noTraverse = false
 		}
 	}
+	if ci.HardLinks {
+		if fdst.Features().HardLink == nil {
+			fs.Errorf(fdst, "Ignoring --hard-links as the destination does not support hard links")
+		} else {
+			s.hardLinks = newHardLinks()
+		}
+	}
 	// Make Fs for --backup-dir if required
 	if ci.BackupDir != "" || ci.Suffix != "" {
 		var err error
@@ -431,6 +439,10 @@ func (s *syncCopyMove) pairChecker(in *pipe, out *pipe, fraction int, wg *sync.W
 					}
 				}
 			} else {
+				// Remember up to date destinations so hard links can be made to them
+				if s.hardLinks != nil && pair.Dst != nil {
+					s.hardLinks.existing(src, pair.Dst)
+				}
 				// If moving need to delete the files we don't need to copy
 				if s.DoMove {
 					// Delete src if no error on copy
@@ -492,13 +504,13 @@ func (s *syncCopyMove) pairCopyOrMove(ctx context.Context, in *pipe, fdst fs.Fs,
 		dst := pair.Dst
 		if s.DoMove {
 			if src != dst {
-				_, err = operations.MoveTransfer(ctx, fdst, dst, src.Remote(), src)
+				_, err = s.move(ctx, fdst, dst, src)
 			} else {
 				// src == dst signals delete the src
 				err = operations.DeleteFile(ctx, src)
 			}
 		} else {
-			_, err = operations.Copy(ctx, fdst, dst, src.Remote(), src)
+			_, err = s.copy(ctx, fdst, dst, src)
 		}
 		s.processError(err)
 		if err != nil {
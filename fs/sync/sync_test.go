@@ -10,6 +10,7 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"path"
 	"runtime"
 	"sort"
 	"strings"
@@ -234,6 +235,49 @@ func TestCopyCheckFirst(t *testing.T) {
 	r.CheckRemoteItems(t, file1)
 }
 
+// Now with --hard-links
+func TestCopyHardLinks(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+	if r.Fremote.Features().HardLink == nil {
+		t.Skip("Can't test hard links on this remote")
+	}
+
+	ci.HardLinks = true
+
+	file1 := r.WriteFile("one/hello world", "hello world", t1)
+	file2 := fstest.NewItem("two/hello world", "hello world", t1)
+	file3 := r.WriteFile("three/hello world", "hello world", t1)
+	require.NoError(t, os.MkdirAll(path.Join(r.LocalName, "two"), 0777))
+	require.NoError(t, os.Link(path.Join(r.LocalName, file1.Path), path.Join(r.LocalName, file2.Path)))
+
+	hardLinkID := func(f fs.Fs, remote string) string {
+		o, err := f.NewObject(ctx, remote)
+		require.NoError(t, err)
+		do, ok := o.(fs.HardLinkIDer)
+		require.True(t, ok)
+		return do.HardLinkID()
+	}
+	if hardLinkID(r.Flocal, file1.Path) == "" {
+		t.Skip("Can't read hard links on this OS")
+	}
+
+	accounting.GlobalStats().ResetCounters()
+	err := CopyDir(ctx, r.Fremote, r.Flocal, false)
+	require.NoError(t, err)
+
+	r.CheckLocalItems(t, file1, file2, file3)
+	r.CheckRemoteItems(t, file1, file2, file3)
+
+	id1 := hardLinkID(r.Fremote, file1.Path)
+	assert.NotEqual(t, "", id1)
+	assert.Equal(t, id1, hardLinkID(r.Fremote, file2.Path))
+	assert.Equal(t, "", hardLinkID(r.Fremote, file3.Path))
+	assert.Equal(t, int64(1), accounting.GlobalStats().HardLinks(0))
+	assert.Equal(t, int64(2), accounting.GlobalStats().GetTransfers())
+}
+
 // Now with --no-traverse
 func TestSyncNoTraverse(t *testing.T) {
 	ctx := context.Background()
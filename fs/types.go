@@ -173,6 +173,31 @@ type ParentIDer interface {
 	ParentID() string
 }
 
+// HardLinkIDer is an optional interface for Object
+type HardLinkIDer interface {
+	// HardLinkID returns an ID which is shared by all the Objects
+	// which are hard links to the same data, or "" if the Object
+	// isn't hard linked to anything else.
+	HardLinkID() string
+}
+
+// Holer is an optional interface for Object
+type Holer interface {
+	// Holes returns the regions of the Object which are holes,
+	// that is regions which read as zeros but have no data stored
+	// for them, in ascending order. It returns nil if the Object
+	// isn't sparse.
+	Holes(ctx context.Context) ([]Extent, error)
+}
+
+// InPlaceWriter is an optional interface for Object
+type InPlaceWriter interface {
+	// WriteAt overwrites the bytes of the Object at offset off
+	// with p without changing its size or modification time. It
+	// returns an error if the write would extend the Object.
+	WriteAt(ctx context.Context, p []byte, off int64) error
+}
+
 // ObjectUnWrapper is an optional interface for Object
 type ObjectUnWrapper interface {
 	// UnWrap returns the Object that this Object is wrapping or
@@ -0,0 +1,219 @@
+// Package archive contains the archive formats and readers shared by
+// the archive backend and the archive command.
+package archive
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/chunkedreader"
+)
+
+// Sizes of the chunks read from archives. The first chunk after a
+// seek is small as indexes are mostly read in small pieces.
+const (
+	InitialChunkSize = 64 * 1024
+	MaxChunkSize     = 16 * 1024 * 1024
+)
+
+// Format of an archive
+type Format int
+
+// Archive formats
+const (
+	FormatNone Format = iota
+	FormatZip
+	FormatTar
+	FormatTarGz
+	FormatTarZstd
+	Format7z
+)
+
+// Extensions maps file name extensions to archive formats
+var Extensions = []struct {
+	Ext    string
+	Format Format
+}{
+	{".zip", FormatZip},
+	{".tar", FormatTar},
+	{".tar.gz", FormatTarGz},
+	{".tgz", FormatTarGz},
+	{".tar.zst", FormatTarZstd},
+	{".tzst", FormatTarZstd},
+	{".7z", Format7z},
+}
+
+// FormatOf returns the format of an archive from its name or
+// FormatNone if it isn't the name of an archive
+func FormatOf(name string) Format {
+	lower := strings.ToLower(name)
+	for _, e := range Extensions {
+		if strings.HasSuffix(lower, e.Ext) && len(lower) > len(e.Ext) {
+			return e.Format
+		}
+	}
+	return FormatNone
+}
+
+// CleanName returns the name of a member of an archive cleaned of
+// leading slashes and ".." so it can't escape the destination, or ""
+// if it should be ignored
+func CleanName(name string) string {
+	name = path.Clean("/" + strings.ReplaceAll(name, "\\", "/"))
+	if name == "/" {
+		return ""
+	}
+	return name[1:]
+}
+
+// Compress returns a writer compressing to out for the compressed
+// tar formats or out itself
+func Compress(f Format, out io.Writer) (io.WriteCloser, error) {
+	switch f {
+	case FormatTarGz:
+		return gzip.NewWriter(out), nil
+	case FormatTarZstd:
+		return zstd.NewWriter(out)
+	}
+	return nopWriteCloser{out}, nil
+}
+
+// nopWriteCloser adds a Close method which does nothing to a writer
+type nopWriteCloser struct {
+	io.Writer
+}
+
+// Close does nothing
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// Decompress returns a reader decompressing in for the compressed
+// tar formats or in itself
+func Decompress(f Format, in io.Reader) (io.ReadCloser, error) {
+	switch f {
+	case FormatTarGz:
+		return gzip.NewReader(in)
+	case FormatTarZstd:
+		zr, err := zstd.NewReader(in)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	}
+	return io.NopCloser(in), nil
+}
+
+// ZipMethodZstd is the zip compression method for zstd
+const ZipMethodZstd = 93
+
+// zstdDecompressor is a zip.Decompressor for zstd
+func zstdDecompressor(in io.Reader) io.ReadCloser {
+	zr, err := zstd.NewReader(in)
+	if err != nil {
+		return io.NopCloser(errorReader{err})
+	}
+	return zr.IOReadCloser()
+}
+
+// errorReader returns err from every read
+type errorReader struct {
+	err error
+}
+
+// Read returns the error
+func (r errorReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
+
+// ZipDecompressor returns the decompressor for the zip compression
+// method or nil if it isn't supported
+func ZipDecompressor(method uint16) zip.Decompressor {
+	switch method {
+	case zip.Store:
+		return io.NopCloser
+	case zip.Deflate:
+		return flate.NewReader
+	case ZipMethodZstd:
+		return zstdDecompressor
+	}
+	return nil
+}
+
+// RegisterZipDecompressors registers the decompressors archive/zip
+// doesn't have built in with zr
+func RegisterZipDecompressors(zr *zip.Reader) {
+	zr.RegisterDecompressor(ZipMethodZstd, zstdDecompressor)
+}
+
+// ReaderAt reads an object at random offsets using a chunked reader
+type ReaderAt struct {
+	mu  sync.Mutex
+	ctx context.Context // for the reads made
+	o   fs.Object
+	cr  *chunkedreader.ChunkedReader // nil if not open
+	pos int64                        // offset cr will read from next
+}
+
+// NewReaderAt makes a ReaderAt for o
+func NewReaderAt(ctx context.Context, o fs.Object) *ReaderAt {
+	return &ReaderAt{ctx: ctx, o: o}
+}
+
+// ReadAt reads len(p) bytes from offset off
+//
+// Reads following on from the previous one carry on using the same
+// chunked reader.
+func (r *ReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if off >= r.o.Size() {
+		return 0, io.EOF
+	}
+	if r.cr == nil {
+		r.cr = chunkedreader.New(r.ctx, r.o, InitialChunkSize, MaxChunkSize)
+		r.pos = 0
+	}
+	if off != r.pos {
+		if _, err = r.cr.RangeSeek(r.ctx, off, io.SeekStart, -1); err != nil {
+			if errors.Is(err, chunkedreader.ErrorInvalidSeek) {
+				err = io.EOF
+			}
+			return 0, err
+		}
+	}
+	n, err = io.ReadFull(r.cr, p)
+	r.pos = off + int64(n)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// SetContext sets the context used for the reads from now on
+func (r *ReaderAt) SetContext(ctx context.Context) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ctx = ctx
+}
+
+// Close closes the chunked reader. It is opened again if needed by
+// another read.
+func (r *ReaderAt) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cr != nil {
+		_ = r.cr.Close()
+		r.cr = nil
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/rclone/rclone/fstest/mockobject"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatOf(t *testing.T) {
+	for name, want := range map[string]Format{
+		"a.zip":     FormatZip,
+		"dir/a.TAR": FormatTar,
+		"a.tar.gz":  FormatTarGz,
+		"a.tgz":     FormatTarGz,
+		"a.tar.zst": FormatTarZstd,
+		"a.tzst":    FormatTarZstd,
+		"a.7z":      Format7z,
+		"a.txt":     FormatNone,
+		".zip":      FormatNone,
+	} {
+		assert.Equal(t, want, FormatOf(name), name)
+	}
+}
+
+func TestCleanName(t *testing.T) {
+	for in, want := range map[string]string{
+		"a/b.txt":       "a/b.txt",
+		"./a/b.txt":     "a/b.txt",
+		"../../etc/pwd": "etc/pwd",
+		"/abs/file":     "abs/file",
+		`dir\file`:      "dir/file",
+		"./":            "",
+	} {
+		assert.Equal(t, want, CleanName(in), in)
+	}
+}
+
+func TestCompressDecompress(t *testing.T) {
+	for _, f := range []Format{FormatTar, FormatTarGz, FormatTarZstd} {
+		var buf bytes.Buffer
+		cw, err := Compress(f, &buf)
+		require.NoError(t, err)
+		_, err = cw.Write([]byte("hello"))
+		require.NoError(t, err)
+		require.NoError(t, cw.Close())
+
+		dr, err := Decompress(f, &buf)
+		require.NoError(t, err)
+		data, err := io.ReadAll(dr)
+		require.NoError(t, err)
+		require.NoError(t, dr.Close())
+		assert.Equal(t, "hello", string(data))
+	}
+}
+
+func TestZipZstd(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	zw.RegisterCompressor(ZipMethodZstd, func(out io.Writer) (io.WriteCloser, error) {
+		return zstd.NewWriter(out)
+	})
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: "a.txt", Method: ZipMethodZstd})
+	require.NoError(t, err)
+	_, err = w.Write([]byte("hello zstd"))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	RegisterZipDecompressors(zr)
+	rc, err := zr.File[0].Open()
+	require.NoError(t, err)
+	data, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+	assert.Equal(t, "hello zstd", string(data))
+
+	assert.NotNil(t, ZipDecompressor(zip.Store))
+	assert.NotNil(t, ZipDecompressor(zip.Deflate))
+	assert.NotNil(t, ZipDecompressor(ZipMethodZstd))
+	assert.Nil(t, ZipDecompressor(99))
+}
+
+func TestReaderAt(t *testing.T) {
+	ctx := context.Background()
+	contents := strings.Repeat("0123456789", 1000)
+	o := mockobject.New("a.zip").WithContent([]byte(contents), mockobject.SeekModeRegular)
+	ra := NewReaderAt(ctx, o)
+
+	p := make([]byte, 5)
+	for _, off := range []int64{0, 5, 1234, 3} {
+		n, err := ra.ReadAt(p, off)
+		require.NoError(t, err)
+		assert.Equal(t, 5, n)
+		assert.Equal(t, contents[off:off+5], string(p))
+	}
+
+	n, err := ra.ReadAt(p, int64(len(contents))-2)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, "89", string(p[:n]))
+
+	_, err = ra.ReadAt(p, int64(len(contents)))
+	assert.Equal(t, io.EOF, err)
+
+	// reads carry on after Close
+	require.NoError(t, ra.Close())
+	n, err = ra.ReadAt(p, 10)
+	require.NoError(t, err)
+	assert.Equal(t, "01234", string(p[:n]))
+	require.NoError(t, ra.Close())
+}
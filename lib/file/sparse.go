@@ -0,0 +1,120 @@
+package file
+
+import (
+	"io"
+
+	"github.com/rclone/rclone/fs"
+)
+
+// SparseFile is the interface needed to write a sparse file.
+//
+// It is satisfied by *os.File and *sftp.File.
+type SparseFile interface {
+	io.Writer
+	io.Seeker
+	Truncate(size int64) error
+}
+
+// SparseWriter writes a stream to a SparseFile leaving holes where
+// the stream is known to have them.
+//
+// Data which falls in a hole is only skipped if it is all zeros so if
+// the source has changed since the holes were read the data will
+// still be written correctly.
+type SparseWriter struct {
+	out     SparseFile
+	holes   []fs.Extent
+	pos     int64 // position in the input stream
+	filePos int64 // position of the file pointer in out
+}
+
+// NewSparseWriter returns a SparseWriter which writes to out which
+// should be empty and positioned at the start.
+//
+// holes should be in ascending order as returned by fs.Holer.
+func NewSparseWriter(out SparseFile, holes []fs.Extent) *SparseWriter {
+	return &SparseWriter{
+		out:   out,
+		holes: holes,
+	}
+}
+
+// hole returns the number of bytes from the current position to the
+// end of the hole it is in or 0 if it isn't in a hole.
+func (w *SparseWriter) hole() int64 {
+	for len(w.holes) > 0 {
+		h := w.holes[0]
+		if w.pos < h.Offset {
+			return 0
+		}
+		if w.pos < h.Offset+h.Length {
+			return h.Offset + h.Length - w.pos
+		}
+		w.holes = w.holes[1:]
+	}
+	return 0
+}
+
+// isZero returns true if p is all zeros
+func isZero(p []byte) bool {
+	for _, c := range p {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Write writes p to the file, skipping over any holes
+func (w *SparseWriter) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		var chunk []byte
+		holeLeft := w.hole()
+		if holeLeft > 0 {
+			if holeLeft > int64(len(p)) {
+				holeLeft = int64(len(p))
+			}
+			chunk = p[:holeLeft]
+			if isZero(chunk) {
+				w.pos += holeLeft
+				n += int(holeLeft)
+				p = p[holeLeft:]
+				continue
+			}
+		} else {
+			chunk = p
+			if len(w.holes) > 0 {
+				toHole := w.holes[0].Offset - w.pos
+				if toHole < int64(len(chunk)) {
+					chunk = chunk[:toHole]
+				}
+			}
+		}
+		if w.filePos != w.pos {
+			_, err = w.out.Seek(w.pos, io.SeekStart)
+			if err != nil {
+				return n, err
+			}
+			w.filePos = w.pos
+		}
+		written, err := w.out.Write(chunk)
+		w.pos += int64(written)
+		w.filePos += int64(written)
+		n += written
+		if err != nil {
+			return n, err
+		}
+		p = p[written:]
+	}
+	return n, nil
+}
+
+// Close extends the file to the correct size if it ended in a hole.
+//
+// It doesn't close the underlying file.
+func (w *SparseWriter) Close() error {
+	if w.filePos != w.pos {
+		return w.out.Truncate(w.pos)
+	}
+	return nil
+}
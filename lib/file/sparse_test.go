@@ -0,0 +1,80 @@
+package file
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingFile is a SparseFile which records the writes
+type recordingFile struct {
+	bytes.Buffer
+	seeks     []int64
+	truncated int64
+}
+
+func (f *recordingFile) Seek(offset int64, whence int) (int64, error) {
+	f.seeks = append(f.seeks, offset)
+	return offset, nil
+}
+
+func (f *recordingFile) Truncate(size int64) error {
+	f.truncated = size
+	return nil
+}
+
+func TestSparseWriterSkips(t *testing.T) {
+	data := make([]byte, 100)
+	for i := 0; i < 10; i++ {
+		data[i] = 1
+		data[50+i] = 1
+	}
+	// data[90:100] is a hole but isn't zero so must be written
+	data[95] = 1
+	holes := []fs.Extent{{Offset: 10, Length: 40}, {Offset: 60, Length: 20}, {Offset: 90, Length: 10}}
+
+	var out recordingFile
+	w := NewSparseWriter(&out, holes)
+	n, err := w.Write(data)
+	require.NoError(t, err)
+	assert.Equal(t, len(data), n)
+	require.NoError(t, w.Close())
+
+	assert.Equal(t, []int64{50, 80}, out.seeks)
+	assert.Equal(t, int64(0), out.truncated)
+	want := append(append(append([]byte{}, data[:10]...), data[50:60]...), data[80:]...)
+	assert.Equal(t, want, out.Bytes())
+}
+
+func TestSparseWriterFile(t *testing.T) {
+	dir := t.TempDir()
+	data := make([]byte, 4*65536)
+	for i := range data[:65536] {
+		data[i] = byte(i)
+		data[2*65536+i] = byte(i)
+	}
+	holes := []fs.Extent{{Offset: 65536, Length: 65536}, {Offset: 3 * 65536, Length: 65536}}
+
+	f, err := os.Create(filepath.Join(dir, "sparse"))
+	require.NoError(t, err)
+	w := NewSparseWriter(f, holes)
+	// Write in odd sized pieces to check the boundaries
+	n, err := io.CopyBuffer(w, struct{ io.Reader }{bytes.NewReader(data)}, make([]byte, 4097))
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(data)), n)
+	require.NoError(t, w.Close())
+	fi, err := f.Stat()
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(data)), fi.Size())
+	require.NoError(t, f.Close())
+
+	got, err := os.ReadFile(filepath.Join(dir, "sparse"))
+	require.NoError(t, err)
+	assert.Equal(t, data, got)
+}
@@ -38,6 +38,39 @@ Use ` + "`--{{ .Prefix }}realm`" + ` to set the authentication realm.
 
 Use ` + "`--{{ .Prefix }}salt`" + ` to change the password hashing salt from the default.
 
+#### OpenID Connect
+
+Instead users can be authenticated with an OpenID Connect provider,
+such as Keycloak, Dex, Google or Microsoft Entra ID, by setting
+` + "`--{{ .Prefix }}oidc-issuer`" + ` to the issuer URL of the provider.
+
+Requests with an ` + "`Authorization: Bearer`" + ` header have the JWT in it
+checked against the keys the provider publishes, and the issuer,
+audience and expiry of the token checked. The audience defaults to the
+client ID and can be set with ` + "`--{{ .Prefix }}oidc-audience`" + `. One of
+these must be set so tokens issued for other clients of the provider
+aren't accepted. To check
+tokens without contacting the provider, for example in tests, give the
+keys in a JSON Web Key Set file with ` + "`--{{ .Prefix }}oidc-jwks /path/to/jwks.json`" + `.
+
+If ` + "`--{{ .Prefix }}oidc-client-id` and `--{{ .Prefix }}oidc-client-secret`" + ` are set then
+browsers without a token are sent to log in at the provider, which
+returns them to ` + "`/.oidc/callback`" + ` on the server. Register this as a
+redirect URL with the provider, or set the URL the provider should use
+with ` + "`--{{ .Prefix }}oidc-redirect-url`" + ` if the server is behind a proxy.
+Logins last as long as the ID token returned, or until the server is
+restarted.
+
+The login cookies are only sent over HTTPS if the server uses TLS or
+the redirect URL starts with ` + "`https://`" + `. If the server is behind a
+proxy which terminates TLS set ` + "`--{{ .Prefix }}oidc-secure-cookie`" + ` so
+they are never sent unencrypted.
+
+The user name is taken from the ` + "`sub`" + ` claim of the token, or the claim
+set with ` + "`--{{ .Prefix }}oidc-user-claim`" + `, e.g. ` + "`preferred_username` or `email`" + `.
+With ` + "`--auth-proxy`" + ` this user name is passed to the proxy program
+with an empty password.
+
 `
 	tmpl, err := template.New("auth help").Parse(help)
 	if err != nil {
@@ -71,6 +104,21 @@ type AuthConfig struct {
 	BasicPass    string       // password for BasicUser
 	Salt         string       // password hashing salt
 	CustomAuthFn CustomAuthFn `json:"-"` // custom Auth (not set by command line flags)
+
+	OIDCIssuer       string   // OpenID Connect issuer URL
+	OIDCClientID     string   // OpenID Connect client ID for browser logins
+	OIDCClientSecret string   // OpenID Connect client secret for browser logins
+	OIDCRedirectURL  string   // URL the provider returns browsers to
+	OIDCJWKS         string   // URL or file of the keys tokens are signed with
+	OIDCAudience     string   // audience tokens must be issued for
+	OIDCUserClaim    string   // claim holding the user name
+	OIDCScopes       []string // scopes requested when logging in
+	OIDCSecureCookie bool     // always set the Secure flag on login cookies
+}
+
+// usingOIDC returns true if OpenID Connect is configured
+func (cfg *AuthConfig) usingOIDC() bool {
+	return cfg.OIDCIssuer != "" || cfg.OIDCJWKS != ""
 }
 
 // AddFlagsPrefix adds flags to the flag set for AuthConfig
@@ -80,6 +128,15 @@ func (cfg *AuthConfig) AddFlagsPrefix(flagSet *pflag.FlagSet, prefix string) {
 	flags.StringVarP(flagSet, &cfg.BasicUser, prefix+"user", "", cfg.BasicUser, "User name for authentication", prefix)
 	flags.StringVarP(flagSet, &cfg.BasicPass, prefix+"pass", "", cfg.BasicPass, "Password for authentication", prefix)
 	flags.StringVarP(flagSet, &cfg.Salt, prefix+"salt", "", cfg.Salt, "Password hashing salt", prefix)
+	flags.StringVarP(flagSet, &cfg.OIDCIssuer, prefix+"oidc-issuer", "", cfg.OIDCIssuer, "OpenID Connect issuer URL to authenticate users with", prefix)
+	flags.StringVarP(flagSet, &cfg.OIDCClientID, prefix+"oidc-client-id", "", cfg.OIDCClientID, "OpenID Connect client ID for logging in with a browser", prefix)
+	flags.StringVarP(flagSet, &cfg.OIDCClientSecret, prefix+"oidc-client-secret", "", cfg.OIDCClientSecret, "OpenID Connect client secret for logging in with a browser", prefix)
+	flags.StringVarP(flagSet, &cfg.OIDCRedirectURL, prefix+"oidc-redirect-url", "", cfg.OIDCRedirectURL, "URL the OpenID Connect provider returns browsers to - blank to work it out", prefix)
+	flags.StringVarP(flagSet, &cfg.OIDCJWKS, prefix+"oidc-jwks", "", cfg.OIDCJWKS, "URL or file of the keys tokens are signed with - blank to use the issuer's", prefix)
+	flags.StringVarP(flagSet, &cfg.OIDCAudience, prefix+"oidc-audience", "", cfg.OIDCAudience, "Audience tokens must be issued for - blank to use the client ID", prefix)
+	flags.StringVarP(flagSet, &cfg.OIDCUserClaim, prefix+"oidc-user-claim", "", cfg.OIDCUserClaim, "Token claim to use as the user name", prefix)
+	flags.StringArrayVarP(flagSet, &cfg.OIDCScopes, prefix+"oidc-scope", "", cfg.OIDCScopes, "Scopes to request when logging in with a browser", prefix)
+	flags.BoolVarP(flagSet, &cfg.OIDCSecureCookie, prefix+"oidc-secure-cookie", "", cfg.OIDCSecureCookie, "Only send login cookies over HTTPS, e.g. behind a proxy terminating TLS", prefix)
 }
 
 // AddAuthFlagsPrefix adds flags to the flag set for AuthConfig
@@ -90,6 +147,8 @@ func AddAuthFlagsPrefix(flagSet *pflag.FlagSet, prefix string, cfg *AuthConfig)
 // DefaultAuthCfg returns a new config which can be customized by command line flags
 func DefaultAuthCfg() AuthConfig {
 	return AuthConfig{
-		Salt: "dlPL2MqE",
+		Salt:          "dlPL2MqE",
+		OIDCUserClaim: "sub",
+		OIDCScopes:    []string{"openid", "profile", "email"},
 	}
 }
@@ -13,6 +13,7 @@ const (
 	ctxKeyPublicURL
 	ctxKeyUnixSock
 	ctxKeyUser
+	ctxKeyShare
 )
 
 // NewBaseContext initializes the context for all requests, adding info for use in middleware and handlers
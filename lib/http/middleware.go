@@ -67,6 +67,11 @@ func basicAuth(authenticator *LoggedBasicAuth) func(next http.Handler) http.Hand
 				next.ServeHTTP(w, r)
 				return
 			}
+			// skip auth for share links
+			if IsShared(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
 
 			username := authenticator.CheckAuth(r)
 			if username == "" {
@@ -83,6 +88,11 @@ func basicAuth(authenticator *LoggedBasicAuth) func(next http.Handler) http.Hand
 func MiddlewareAuthCertificateUser() Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// skip auth for share links
+			if IsShared(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
 			for _, cert := range r.TLS.PeerCertificates {
 				if cert.Subject.CommonName != "" {
 					r = r.WithContext(context.WithValue(r.Context(), ctxKeyUser, cert.Subject.CommonName))
@@ -133,6 +143,11 @@ func MiddlewareAuthCustom(fn CustomAuthFn, realm string, userFromContext bool) M
 				next.ServeHTTP(w, r)
 				return
 			}
+			// skip auth for share links
+			if IsShared(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
 
 			user, pass, ok := parseAuthorization(r)
 			if !ok && userFromContext {
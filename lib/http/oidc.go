@@ -0,0 +1,579 @@
+package http
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/rclone/rclone/fs"
+	"golang.org/x/oauth2"
+)
+
+const (
+	oidcCallbackPath  = "/.oidc/callback"     // where the provider sends browsers back to
+	oidcStateCookie   = "rclone_oidc_state"   // holds the state of a login in progress
+	oidcSessionCookie = "rclone_oidc_session" // holds the user logged in
+	oidcKeysMinAge    = time.Minute           // minimum time between fetches of the keys
+	oidcLoginTimeout  = 10 * time.Minute      // time allowed to log in at the provider
+	oidcMaxBody       = 1024 * 1024           // largest discovery or keys document read
+)
+
+// oidcSigningMethods are the token signing methods accepted
+var oidcSigningMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// errOIDCNoCredentials is returned if the request has no token or session
+var errOIDCNoCredentials = errors.New("no credentials")
+
+// oidcDiscovery is the part of the provider's discovery document used
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcProvider authenticates users with an OpenID Connect provider
+type oidcProvider struct {
+	cfg        AuthConfig
+	baseURL    string
+	client     *http.Client
+	sessionKey []byte // signs session cookies, so they end with the server
+
+	mu          sync.Mutex
+	discovery   *oidcDiscovery
+	keys        map[string]interface{} // public keys by key ID
+	keysFetched time.Time
+}
+
+// newOIDCProvider makes a provider for the OIDC options in cfg on a
+// server with the given base URL
+func newOIDCProvider(cfg AuthConfig, baseURL string) (*oidcProvider, error) {
+	if cfg.OIDCIssuer == "" && cfg.OIDCJWKS == "" {
+		return nil, errors.New("need --oidc-issuer or --oidc-jwks to use OpenID Connect")
+	}
+	if cfg.OIDCUserClaim == "" {
+		cfg.OIDCUserClaim = "sub"
+	}
+	// The openid scope is needed to be returned an ID token
+	hasOpenID := false
+	for _, scope := range cfg.OIDCScopes {
+		hasOpenID = hasOpenID || scope == "openid"
+	}
+	if !hasOpenID {
+		cfg.OIDCScopes = append([]string{"openid"}, cfg.OIDCScopes...)
+	}
+	if cfg.OIDCAudience == "" {
+		cfg.OIDCAudience = cfg.OIDCClientID
+	}
+	// Without an audience tokens issued for any client would be accepted
+	if cfg.OIDCAudience == "" {
+		return nil, errors.New("need --oidc-audience or --oidc-client-id to check the audience of tokens")
+	}
+	p := &oidcProvider{
+		cfg:        cfg,
+		baseURL:    baseURL,
+		client:     &http.Client{Timeout: time.Minute},
+		sessionKey: make([]byte, 32),
+	}
+	if _, err := rand.Read(p.sessionKey); err != nil {
+		return nil, fmt.Errorf("failed to make OIDC session key: %w", err)
+	}
+	return p, nil
+}
+
+// canLogin returns true if browsers can be sent to log in
+func (p *oidcProvider) canLogin() bool {
+	return p.cfg.OIDCIssuer != "" && p.cfg.OIDCClientID != ""
+}
+
+// fetch reads the document at url or, if it isn't a URL, from the file
+func (p *oidcProvider) fetch(ctx context.Context, url string) ([]byte, error) {
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return os.ReadFile(url)
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer fs.CheckClose(resp.Body, &err)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch %q: %s", url, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, oidcMaxBody))
+}
+
+// getDiscovery reads the issuer's discovery document if not read
+// already - call with the lock held
+func (p *oidcProvider) getDiscovery(ctx context.Context) (*oidcDiscovery, error) {
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+	issuer := strings.TrimRight(p.cfg.OIDCIssuer, "/")
+	data, err := p.fetch(ctx, issuer+"/.well-known/openid-configuration")
+	if err != nil {
+		return nil, fmt.Errorf("OIDC discovery failed: %w", err)
+	}
+	var d oidcDiscovery
+	if err = json.Unmarshal(data, &d); err != nil {
+		return nil, fmt.Errorf("OIDC discovery failed: %w", err)
+	}
+	if strings.TrimRight(d.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("OIDC discovery failed: issuer %q doesn't match %q", d.Issuer, p.cfg.OIDCIssuer)
+	}
+	p.discovery = &d
+	return p.discovery, nil
+}
+
+// jwk is a JSON Web Key
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// bigInt decodes a base64url encoded big endian number
+func bigInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil || len(data) == 0 {
+		return nil, errors.New("bad number in key")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+// publicKey returns the public key k holds
+func (k *jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := bigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := bigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("bad RSA exponent in key")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := bigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := bigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("EC key point isn't on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// parseJWKS returns the signing keys in the JSON Web Key Set in data
+// by key ID
+func parseJWKS(data []byte) (map[string]interface{}, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS: %w", err)
+	}
+	keys := make(map[string]interface{}, len(set.Keys))
+	for i := range set.Keys {
+		k := &set.Keys[i]
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			fs.Debugf(nil, "OIDC: ignoring key %q: %v", k.Kid, err)
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no usable keys in JWKS")
+	}
+	return keys, nil
+}
+
+// getKey returns the key with ID kid, fetching the keys if they
+// haven't been or the key isn't known, in case they have been rotated.
+//
+// If kid is empty and there is only one key then that is returned.
+func (p *oidcProvider) getKey(ctx context.Context, kid string) (interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	if time.Since(p.keysFetched) < oidcKeysMinAge {
+		return nil, fmt.Errorf("unknown key ID %q", kid)
+	}
+	// Don't fetch the keys again too often, even if that fails
+	p.keysFetched = time.Now()
+	url := p.cfg.OIDCJWKS
+	if url == "" {
+		d, err := p.getDiscovery(ctx)
+		if err != nil {
+			return nil, err
+		}
+		url = d.JWKSURI
+	}
+	data, err := p.fetch(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS: %w", err)
+	}
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return nil, err
+	}
+	p.keys = keys
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key ID %q", kid)
+}
+
+// lookupKey finds kid in the keys already read - call with the lock held
+func (p *oidcProvider) lookupKey(kid string) (interface{}, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+// validate checks the signature and claims of the JWT in raw,
+// returning the user name it is for and when it expires.
+//
+// If nonce is set the token must have been issued with it.
+func (p *oidcProvider) validate(ctx context.Context, raw string, nonce string) (user string, expires time.Time, err error) {
+	parser := jwt.Parser{ValidMethods: oidcSigningMethods}
+	claims := jwt.MapClaims{}
+	_, err = parser.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.getKey(ctx, kid)
+	})
+	if err != nil {
+		return "", expires, err
+	}
+	if p.cfg.OIDCIssuer != "" && strings.TrimRight(fmt.Sprint(claims["iss"]), "/") != strings.TrimRight(p.cfg.OIDCIssuer, "/") {
+		return "", expires, errors.New("token has the wrong issuer")
+	}
+	if !claims.VerifyAudience(p.cfg.OIDCAudience, true) {
+		return "", expires, errors.New("token has the wrong audience")
+	}
+	if nonce != "" && claims["nonce"] != nonce {
+		return "", expires, errors.New("token has the wrong nonce")
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return "", expires, errors.New("token has no expiry")
+	}
+	user, _ = claims[p.cfg.OIDCUserClaim].(string)
+	if user == "" {
+		return "", expires, fmt.Errorf("token has no %q claim", p.cfg.OIDCUserClaim)
+	}
+	return user, time.Unix(int64(exp), 0), nil
+}
+
+// sign returns the signature for a cookie value
+func (p *oidcProvider) sign(value string) string {
+	mac := hmac.New(sha256.New, p.sessionKey)
+	_, _ = mac.Write([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// secureCookies returns true if cookies should only be sent over
+// HTTPS, which they should if the browser uses HTTPS even if the
+// server is behind a proxy which terminates TLS
+func (p *oidcProvider) secureCookies(r *http.Request) bool {
+	return r.TLS != nil || p.cfg.OIDCSecureCookie || strings.HasPrefix(p.cfg.OIDCRedirectURL, "https://")
+}
+
+// setCookie sets a signed cookie holding value until expires
+func (p *oidcProvider) setCookie(w http.ResponseWriter, r *http.Request, name, value string, expires time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value + "." + p.sign(name+"="+value),
+		Path:     p.baseURL + "/",
+		Expires:  expires,
+		Secure:   p.secureCookies(r),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// getCookie returns the value of a cookie set with setCookie
+func (p *oidcProvider) getCookie(r *http.Request, name string) (string, bool) {
+	c, err := r.Cookie(name)
+	if err != nil {
+		return "", false
+	}
+	i := strings.LastIndex(c.Value, ".")
+	if i < 0 {
+		return "", false
+	}
+	value, sig := c.Value[:i], c.Value[i+1:]
+	if !hmac.Equal([]byte(sig), []byte(p.sign(name+"="+value))) {
+		return "", false
+	}
+	return value, true
+}
+
+// clearCookie removes a cookie set with setCookie
+func (p *oidcProvider) clearCookie(w http.ResponseWriter, name string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:   name,
+		Path:   p.baseURL + "/",
+		MaxAge: -1,
+	})
+}
+
+// authenticate returns the user the request is from, from a bearer
+// token or the session of a browser which has logged in.
+func (p *oidcProvider) authenticate(r *http.Request) (string, error) {
+	if scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+		user, _, err := p.validate(r.Context(), strings.TrimSpace(token), "")
+		return user, err
+	}
+	session, ok := p.getCookie(r, oidcSessionCookie)
+	if !ok {
+		return "", errOIDCNoCredentials
+	}
+	encodedUser, expiry, _ := strings.Cut(session, ".")
+	user, err := base64.RawURLEncoding.DecodeString(encodedUser)
+	if err != nil {
+		return "", errOIDCNoCredentials
+	}
+	exp, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil || time.Now().Unix() >= exp {
+		return "", errOIDCNoCredentials
+	}
+	return string(user), nil
+}
+
+// oauthConfig returns the config for the authorization code flow -
+// call with the lock held
+func (p *oidcProvider) oauthConfig(ctx context.Context, r *http.Request) (*oauth2.Config, error) {
+	d, err := p.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+	redirectURL := p.cfg.OIDCRedirectURL
+	if redirectURL == "" {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		redirectURL = scheme + "://" + r.Host + p.baseURL + oidcCallbackPath
+	}
+	return &oauth2.Config{
+		ClientID:     p.cfg.OIDCClientID,
+		ClientSecret: p.cfg.OIDCClientSecret,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  d.AuthorizationEndpoint,
+			TokenURL: d.TokenEndpoint,
+		},
+		RedirectURL: redirectURL,
+		Scopes:      p.cfg.OIDCScopes,
+	}, nil
+}
+
+// randomString returns a random string for use as a state or nonce
+func randomString() (string, error) {
+	data := make([]byte, 16)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(data), nil
+}
+
+// login sends the browser to log in at the provider
+func (p *oidcProvider) login(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	config, err := p.oauthConfig(r.Context(), r)
+	p.mu.Unlock()
+	if err != nil {
+		fs.Errorf(nil, "OIDC login failed: %v", err)
+		http.Error(w, "Login failed", http.StatusInternalServerError)
+		return
+	}
+	state, err := randomString()
+	if err != nil {
+		fs.Errorf(nil, "OIDC login failed: %v", err)
+		http.Error(w, "Login failed", http.StatusInternalServerError)
+		return
+	}
+	nonce, err := randomString()
+	if err != nil {
+		fs.Errorf(nil, "OIDC login failed: %v", err)
+		http.Error(w, "Login failed", http.StatusInternalServerError)
+		return
+	}
+	returnTo := base64.RawURLEncoding.EncodeToString([]byte(p.baseURL + r.URL.RequestURI()))
+	p.setCookie(w, r, oidcStateCookie, state+"."+nonce+"."+returnTo, time.Now().Add(oidcLoginTimeout))
+	http.Redirect(w, r, config.AuthCodeURL(state, oauth2.SetAuthURLParam("nonce", nonce)), http.StatusFound)
+}
+
+// callback finishes logging in when the provider sends the browser back
+func (p *oidcProvider) callback(w http.ResponseWriter, r *http.Request) {
+	fail := func(err error) {
+		fs.Infof(r.URL.Path, "%s: OIDC login failed: %v", r.RemoteAddr, err)
+		http.Error(w, "Login failed", http.StatusUnauthorized)
+	}
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		fail(fmt.Errorf("provider returned %s: %s", e, q.Get("error_description")))
+		return
+	}
+	value, ok := p.getCookie(r, oidcStateCookie)
+	parts := strings.SplitN(value, ".", 3)
+	if !ok || len(parts) != 3 {
+		fail(errors.New("login not in progress"))
+		return
+	}
+	state, nonce := parts[0], parts[1]
+	returnTo, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !strings.HasPrefix(string(returnTo), "/") || strings.HasPrefix(string(returnTo), "//") {
+		returnTo = []byte(p.baseURL + "/")
+	}
+	if subtle.ConstantTimeCompare([]byte(q.Get("state")), []byte(state)) != 1 {
+		fail(errors.New("state doesn't match"))
+		return
+	}
+	p.mu.Lock()
+	config, err := p.oauthConfig(r.Context(), r)
+	p.mu.Unlock()
+	if err != nil {
+		fail(err)
+		return
+	}
+	ctx := context.WithValue(r.Context(), oauth2.HTTPClient, p.client)
+	token, err := config.Exchange(ctx, q.Get("code"))
+	if err != nil {
+		fail(err)
+		return
+	}
+	idToken, _ := token.Extra("id_token").(string)
+	if idToken == "" {
+		fail(errors.New("no id_token returned"))
+		return
+	}
+	user, expires, err := p.validate(r.Context(), idToken, nonce)
+	if err != nil {
+		fail(err)
+		return
+	}
+	fs.Infof(nil, "OIDC: %s logged in from %s", user, r.RemoteAddr)
+	p.clearCookie(w, oidcStateCookie)
+	session := base64.RawURLEncoding.EncodeToString([]byte(user)) + "." + strconv.FormatInt(expires.Unix(), 10)
+	p.setCookie(w, r, oidcSessionCookie, session, expires)
+	http.Redirect(w, r, string(returnTo), http.StatusFound)
+}
+
+// wantsHTML returns true if the request looks like it is from a browser
+func wantsHTML(r *http.Request) bool {
+	return r.Method == http.MethodGet && strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+// MiddlewareAuthOIDC instantiates middleware that authenticates users
+// with an OpenID Connect provider.
+//
+// Requests with a bearer token are checked against the provider's
+// keys. Browsers without one are sent to log in at the provider if a
+// client ID is configured.
+func MiddlewareAuthOIDC(cfg AuthConfig, baseURL string) (Middleware, error) {
+	p, err := newOIDCProvider(cfg, baseURL)
+	if err != nil {
+		return nil, err
+	}
+	fs.Infof(nil, "Using OpenID Connect for authentication")
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// skip auth for unix socket
+			if IsUnixSocket(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			// skip auth for CORS preflight
+			if r.Method == "OPTIONS" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			// skip auth for share links
+			if IsShared(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if r.URL.Path == oidcCallbackPath && p.canLogin() {
+				p.callback(w, r)
+				return
+			}
+
+			user, err := p.authenticate(r)
+			if err == nil {
+				ctx := context.WithValue(r.Context(), ctxKeyUser, user)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+			if err != errOIDCNoCredentials {
+				fs.Infof(r.URL.Path, "%s: Unauthorized request: %v", r.RemoteAddr, err)
+			} else if p.canLogin() && wantsHTML(r) {
+				p.login(w, r)
+				return
+			}
+			code := http.StatusUnauthorized
+			w.Header().Set("Content-Type", "text/plain")
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm=%q`, cfg.Realm))
+			http.Error(w, http.StatusText(code), code)
+		})
+	}, nil
+}
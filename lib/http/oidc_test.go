@@ -0,0 +1,328 @@
+package http
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testJWKS returns a JSON Web Key Set holding key with ID kid
+func testJWKS(t *testing.T, kid string, key *rsa.PrivateKey) []byte {
+	enc := func(n *big.Int) string {
+		return base64.RawURLEncoding.EncodeToString(n.Bytes())
+	}
+	data, err := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": kid,
+			"use": "sig",
+			"n":   enc(key.N),
+			"e":   enc(big.NewInt(int64(key.E))),
+		}},
+	})
+	require.NoError(t, err)
+	return data
+}
+
+// testJWT returns a token for claims signed with key
+func testJWT(t *testing.T, kid string, key *rsa.PrivateKey, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	raw, err := token.SignedString(key)
+	require.NoError(t, err)
+	return raw
+}
+
+func TestParseJWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	keys, err := parseJWKS(testJWKS(t, "rsa", rsaKey))
+	require.NoError(t, err)
+	assert.Equal(t, &rsaKey.PublicKey, keys["rsa"])
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	data, err := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "EC",
+			"kid": "ec",
+			"crv": "P-256",
+			"x":   base64.RawURLEncoding.EncodeToString(ecKey.X.Bytes()),
+			"y":   base64.RawURLEncoding.EncodeToString(ecKey.Y.Bytes()),
+		}, {
+			"kty": "RSA",
+			"kid": "enc",
+			"use": "enc",
+		}, {
+			"kty": "oct",
+			"kid": "secret",
+		}},
+	})
+	require.NoError(t, err)
+	keys, err = parseJWKS(data)
+	require.NoError(t, err)
+	assert.Len(t, keys, 1)
+	assert.Equal(t, &ecKey.PublicKey, keys["ec"])
+
+	_, err = parseJWKS([]byte(`{"keys":[]}`))
+	assert.Error(t, err)
+}
+
+func TestMiddlewareAuthOIDCBearer(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	jwks := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(jwks, testJWKS(t, "key1", key), 0666))
+
+	auth := DefaultAuthCfg()
+	auth.Realm = "test"
+	auth.OIDCJWKS = jwks
+	auth.OIDCAudience = "rclone"
+	auth.OIDCUserClaim = "preferred_username"
+	s, err := NewServer(context.Background(), WithConfig(Config{ListenAddr: []string{"127.0.0.1:0"}}), WithAuth(auth))
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, s.Shutdown())
+	}()
+	assert.True(t, s.UsingAuth())
+	s.Router().Mount("/", testAuthUserHandler())
+	s.Serve()
+	url := testGetServerURL(t, s)
+
+	get := func(token string) (*http.Response, string) {
+		req, err := http.NewRequest("GET", url, nil)
+		require.NoError(t, err)
+		req.Header.Set("Accept", "text/html")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return resp, string(body)
+	}
+
+	claims := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"sub":                "1234",
+			"preferred_username": "alice",
+			"aud":                "rclone",
+			"exp":                time.Now().Add(time.Hour).Unix(),
+		}
+	}
+
+	// no token isn't sent to log in without a client ID
+	resp, _ := get("")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, `Bearer realm="test"`, resp.Header.Get("WWW-Authenticate"))
+
+	resp, body := get(testJWT(t, "key1", key, claims()))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "alice", body)
+
+	for name, change := range map[string]func(jwt.MapClaims){
+		"Expired":  func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() },
+		"NoExpiry": func(c jwt.MapClaims) { delete(c, "exp") },
+		"Audience": func(c jwt.MapClaims) { c["aud"] = "other" },
+		"NoUser":   func(c jwt.MapClaims) { delete(c, "preferred_username") },
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := claims()
+			change(c)
+			resp, _ := get(testJWT(t, "key1", key, c))
+			assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		})
+	}
+
+	t.Run("WrongKey", func(t *testing.T) {
+		other, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		resp, _ := get(testJWT(t, "key1", other, claims()))
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		resp, _ = get(testJWT(t, "key2", other, claims()))
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	t.Run("HMAC", func(t *testing.T) {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims())
+		token.Header["kid"] = "key1"
+		raw, err := token.SignedString([]byte("secret"))
+		require.NoError(t, err)
+		resp, _ := get(raw)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+}
+
+func TestMiddlewareAuthOIDCLogin(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	// A minimal provider which logs everyone in as bob
+	var nonce string
+	mux := http.NewServeMux()
+	provider := httptest.NewServer(mux)
+	defer provider.Close()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 provider.URL,
+			"authorization_endpoint": provider.URL + "/auth",
+			"token_endpoint":         provider.URL + "/token",
+			"jwks_uri":               provider.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(testJWKS(t, "key1", key))
+	})
+	mux.HandleFunc("/auth", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		assert.Equal(t, "client", q.Get("client_id"))
+		assert.Contains(t, q.Get("scope"), "openid")
+		nonce = q.Get("nonce")
+		http.Redirect(w, r, q.Get("redirect_uri")+"?"+url.Values{"code": {"abc"}, "state": {q.Get("state")}}.Encode(), http.StatusFound)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "abc", r.PostForm.Get("code"))
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"id_token": testJWT(t, "key1", key, jwt.MapClaims{
+				"iss":   provider.URL,
+				"sub":   "bob",
+				"aud":   "client",
+				"nonce": nonce,
+				"exp":   time.Now().Add(time.Hour).Unix(),
+			}),
+		})
+	})
+
+	auth := DefaultAuthCfg()
+	auth.OIDCIssuer = provider.URL
+	auth.OIDCClientID = "client"
+	auth.OIDCClientSecret = "secret"
+	s, err := NewServer(context.Background(), WithConfig(Config{ListenAddr: []string{"127.0.0.1:0"}, BaseURL: "/base"}), WithAuth(auth))
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, s.Shutdown())
+	}()
+	s.Router().Mount("/", testAuthUserHandler())
+	s.Serve()
+	serverURL := testGetServerURL(t, s)
+
+	jar, err := cookiejar.New(nil)
+	require.NoError(t, err)
+	client := &http.Client{Jar: jar}
+	get := func(target string) (*http.Response, string) {
+		req, err := http.NewRequest("GET", target, nil)
+		require.NoError(t, err)
+		req.Header.Set("Accept", "text/html")
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return resp, string(body)
+	}
+
+	// the browser is sent to log in and back to the page
+	resp, body := get(serverURL + "dir/?sort=name")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "bob", body)
+	assert.Equal(t, "/base/dir/", resp.Request.URL.Path)
+	assert.Equal(t, "sort=name", resp.Request.URL.RawQuery)
+
+	// the session is kept without logging in again
+	nonce = ""
+	resp, body = get(serverURL + "other")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "bob", body)
+	assert.Equal(t, "/base/other", resp.Request.URL.Path)
+
+	// a callback with the wrong state fails
+	resp, _ = get(serverURL + ".oidc/callback?code=abc&state=wrong")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	// a forged session is ignored
+	u, err := url.Parse(serverURL)
+	require.NoError(t, err)
+	jar.SetCookies(u, []*http.Cookie{{Name: oidcSessionCookie, Value: base64.RawURLEncoding.EncodeToString([]byte("mallory")) + ".9999999999.bad", Path: "/base/"}})
+	req, err := http.NewRequest("GET", serverURL, nil)
+	require.NoError(t, err)
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestOIDCNotWithBasic(t *testing.T) {
+	auth := DefaultAuthCfg()
+	auth.OIDCJWKS = "jwks.json"
+	auth.BasicUser = "user"
+	_, err := NewServer(context.Background(), WithConfig(Config{ListenAddr: []string{"127.0.0.1:0"}}), WithAuth(auth))
+	assert.Error(t, err)
+}
+
+func TestOIDCNeedsAudience(t *testing.T) {
+	auth := DefaultAuthCfg()
+	auth.OIDCJWKS = "jwks.json"
+	_, err := NewServer(context.Background(), WithConfig(Config{ListenAddr: []string{"127.0.0.1:0"}}), WithAuth(auth))
+	assert.ErrorContains(t, err, "audience")
+
+	for _, set := range []func(){
+		func() { auth.OIDCAudience = "rclone" },
+		func() { auth.OIDCAudience, auth.OIDCClientID = "", "client" },
+	} {
+		set()
+		p, err := newOIDCProvider(auth, "")
+		require.NoError(t, err)
+		assert.NotEqual(t, "", p.cfg.OIDCAudience)
+	}
+}
+
+func TestOIDCSecureCookie(t *testing.T) {
+	auth := DefaultAuthCfg()
+	auth.OIDCJWKS = "jwks.json"
+	auth.OIDCAudience = "rclone"
+	secure := func(auth AuthConfig, r *http.Request) bool {
+		p, err := newOIDCProvider(auth, "")
+		require.NoError(t, err)
+		w := httptest.NewRecorder()
+		p.setCookie(w, r, oidcSessionCookie, "value", time.Now().Add(time.Hour))
+		cookies := w.Result().Cookies()
+		require.Len(t, cookies, 1)
+		return cookies[0].Secure
+	}
+
+	plain := httptest.NewRequest("GET", "http://example.com/", nil)
+	assert.False(t, secure(auth, plain))
+	assert.True(t, secure(auth, httptest.NewRequest("GET", "https://example.com/", nil)))
+
+	// behind a proxy terminating TLS
+	proxied := auth
+	proxied.OIDCSecureCookie = true
+	assert.True(t, secure(proxied, plain))
+	proxied = auth
+	proxied.OIDCRedirectURL = "https://example.com/.oidc/callback"
+	assert.True(t, secure(proxied, plain))
+}
@@ -37,6 +37,7 @@ type Directory struct {
 	Breadcrumb   []Crumb
 	Sort         string
 	Order        string
+	Writable     bool // whether entries can be uploaded, deleted and renamed
 }
 
 // Crumb is a breadcrumb entry
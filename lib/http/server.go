@@ -165,6 +165,7 @@ type Server struct {
 	auth         AuthConfig
 	cfg          Config
 	template     *TemplateConfig
+	share        ShareConfig
 	htmlTemplate *template.Template
 	usingAuth    bool // set if we are using auth middleware
 	atexitHandle atexit.FnHandle
@@ -194,6 +195,13 @@ func WithTemplate(cfg TemplateConfig) Option {
 	}
 }
 
+// WithShare option allows share links signed with the secret in cfg
+func WithShare(cfg ShareConfig) Option {
+	return func(s *Server) {
+		s.share = cfg
+	}
+}
+
 // NewServer instantiates a new http server using provided listeners and options
 // This function is provided if the default http server does not meet a services requirements and should not generally be used
 // A http server can listen using multiple listeners. For example, a listener for port 80, and a listener for port 443.
@@ -240,7 +248,17 @@ func NewServer(ctx context.Context, options ...Option) (*Server, error) {
 
 	s.mux.Use(MiddlewareCORS(s.cfg.AllowOrigin))
 
-	s.initAuth()
+	if s.share.Secret != "" {
+		if err := checkShareSecret(s.share.Secret); err != nil {
+			return nil, err
+		}
+		s.mux.Use(MiddlewareShare(s.share.Secret))
+	}
+
+	err = s.initAuth()
+	if err != nil {
+		return nil, err
+	}
 
 	for _, addr := range s.cfg.ListenAddr {
 		var url string
@@ -296,9 +314,25 @@ func NewServer(ctx context.Context, options ...Option) (*Server, error) {
 	return s, nil
 }
 
-func (s *Server) initAuth() {
+func (s *Server) initAuth() error {
 	s.usingAuth = false
 
+	if s.auth.usingOIDC() {
+		if s.auth.HtPasswd != "" || s.auth.BasicUser != "" {
+			return errors.New("can't use OpenID Connect with --htpasswd or --user")
+		}
+		oidc, err := MiddlewareAuthOIDC(s.auth, s.cfg.BaseURL)
+		if err != nil {
+			return err
+		}
+		s.usingAuth = true
+		s.mux.Use(oidc)
+		if s.auth.CustomAuthFn != nil {
+			s.mux.Use(MiddlewareAuthCustom(s.auth.CustomAuthFn, s.auth.Realm, true))
+		}
+		return nil
+	}
+
 	authCertificateUserEnabled := s.tlsConfig != nil && s.tlsConfig.ClientAuth != tls.NoClientCert && s.auth.HtPasswd == "" && s.auth.BasicUser == ""
 	if authCertificateUserEnabled {
 		s.usingAuth = true
@@ -308,20 +342,21 @@ func (s *Server) initAuth() {
 	if s.auth.CustomAuthFn != nil {
 		s.usingAuth = true
 		s.mux.Use(MiddlewareAuthCustom(s.auth.CustomAuthFn, s.auth.Realm, authCertificateUserEnabled))
-		return
+		return nil
 	}
 
 	if s.auth.HtPasswd != "" {
 		s.usingAuth = true
 		s.mux.Use(MiddlewareAuthHtpasswd(s.auth.HtPasswd, s.auth.Realm))
-		return
+		return nil
 	}
 
 	if s.auth.BasicUser != "" {
 		s.usingAuth = true
 		s.mux.Use(MiddlewareAuthBasic(s.auth.BasicUser, s.auth.BasicPass, s.auth.Realm, s.auth.Salt))
-		return
+		return nil
 	}
+	return nil
 }
 
 func (s *Server) initTemplate() error {
@@ -424,6 +459,11 @@ func (s *Server) Serve() {
 	}
 	// Install an atexit handler to shutdown gracefully
 	s.atexitHandle = atexit.Register(func() { _ = s.Shutdown() })
+	if s.share.Secret != "" {
+		shareServers.mu.Lock()
+		shareServers.servers[s] = struct{}{}
+		shareServers.mu.Unlock()
+	}
 }
 
 // Wait blocks while the server is serving requests
@@ -446,6 +486,9 @@ func (s *Server) Shutdown() error {
 		atexit.Unregister(s.atexitHandle)
 		s.atexitHandle = nil
 	}
+	shareServers.mu.Lock()
+	delete(shareServers.servers, s)
+	shareServers.mu.Unlock()
 	for _, ii := range s.instances {
 		expiry := time.Now().Add(gracefulShutdownTime)
 		ctx, cancel := context.WithDeadline(context.Background(), expiry)
@@ -0,0 +1,353 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/flags"
+	"github.com/rclone/rclone/lib/rest"
+	"github.com/spf13/pflag"
+)
+
+// ShareParam is the URL query parameter holding a share token
+const ShareParam = "share"
+
+// minShareSecret is the shortest share secret allowed
+const minShareSecret = 16
+
+// ShareHelp returns text describing share links to add to the command help.
+func ShareHelp(prefix string) string {
+	help := `#### Share links
+
+Use ` + "`--{{ .Prefix }}share-secret`" + ` to allow links to files and directories to
+be shared with people who can't log in to the server. The links are
+signed with the secret so anyone with the secret can make them, and
+they stop working if the secret is changed.
+
+A link is made for a path with ` + "`rclone sharelink`" + `, or with the
+[serve/sharelink](/rc/#serve-sharelink) rc command on a running server,
+and can be limited with
+
+- ` + "`--expire`" + ` - the time after which the link stops working
+- ` + "`--max-downloads`" + ` - the number of times files can be downloaded with it
+- ` + "`--password`" + ` - a password which must be given, with any user name,
+  when the link is used
+
+A link to a directory, made from a path ending in ` + "`/`" + `, gives access to
+everything in the directory. Links only allow files to be downloaded
+and directories listed, not changed.
+
+Every request for a file counts as a download, including requests for
+part of it as made by video players when seeking or by download
+managers when resuming, so set ` + "`--max-downloads`" + ` with this in mind.
+Fetching a thumbnail doesn't count.
+
+Share links don't need any state on the server so the number of
+downloads is counted in memory and starts again if the server is
+restarted.
+
+`
+	tmpl, err := template.New("share help").Parse(help)
+	if err != nil {
+		log.Fatal("Fatal error parsing template", err)
+	}
+
+	data := struct {
+		Prefix string
+	}{
+		Prefix: prefix,
+	}
+	buf := &bytes.Buffer{}
+	err = tmpl.Execute(buf, data)
+	if err != nil {
+		log.Fatal("Fatal error executing template", err)
+	}
+	return buf.String()
+}
+
+// ShareConfig contains options for share links
+type ShareConfig struct {
+	Secret string // Secret used to sign share links
+}
+
+// AddFlagsPrefix adds flags for share links
+func (cfg *ShareConfig) AddFlagsPrefix(flagSet *pflag.FlagSet, prefix string) {
+	flags.StringVarP(flagSet, &cfg.Secret, prefix+"share-secret", "", cfg.Secret, "Secret used to sign share links - blank to disable them", prefix)
+}
+
+// AddShareFlagsPrefix adds flags for share links
+func AddShareFlagsPrefix(flagSet *pflag.FlagSet, prefix string, cfg *ShareConfig) {
+	cfg.AddFlagsPrefix(flagSet, prefix)
+}
+
+// DefaultShareCfg returns a new config which can be customized by command line flags
+func DefaultShareCfg() ShareConfig {
+	return ShareConfig{}
+}
+
+// ShareOptions limits what a share link can be used for
+type ShareOptions struct {
+	Expire       time.Duration // how long the link works for, 0 for ever
+	MaxDownloads int           // number of downloads allowed, 0 for unlimited
+	Password     string        // password needed to use the link, if set
+}
+
+// sharePayload is the signed part of a share token
+type sharePayload struct {
+	Path         string `json:"p"`           // path shared, ending in / for a directory
+	Expire       int64  `json:"e,omitempty"` // unix time the link expires, 0 for never
+	MaxDownloads int    `json:"n,omitempty"` // number of downloads allowed, 0 for unlimited
+	Password     bool   `json:"w,omitempty"` // set if a password is needed
+	ID           string `json:"i"`           // random ID to count downloads against
+}
+
+// isDir returns true if the payload shares a directory
+func (p *sharePayload) isDir() bool {
+	return p.Path == "" || strings.HasSuffix(p.Path, "/")
+}
+
+// allows returns true if the payload gives access to remote
+func (p *sharePayload) allows(remote string) bool {
+	for _, segment := range strings.Split(remote, "/") {
+		if segment == ".." {
+			return false
+		}
+	}
+	if !p.isDir() {
+		return remote == p.Path
+	}
+	return strings.HasPrefix(remote+"/", p.Path)
+}
+
+// shareSign returns the signature for the encoded payload and password
+func shareSign(secret, payload, password string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write([]byte(payload))
+	_, _ = mac.Write([]byte{0})
+	_, _ = mac.Write([]byte(password))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// checkShareSecret checks the secret is usable for signing
+func checkShareSecret(secret string) error {
+	if len(secret) < minShareSecret {
+		return fmt.Errorf("share secret must be at least %d characters long", minShareSecret)
+	}
+	return nil
+}
+
+// NewShareToken makes a token, signed with secret, giving access to
+// remote with the limits in opt.
+//
+// If remote ends in "/" the token gives access to everything in the
+// directory.
+func NewShareToken(secret, remote string, opt ShareOptions) (string, error) {
+	if err := checkShareSecret(secret); err != nil {
+		return "", err
+	}
+	if opt.Expire < 0 || opt.MaxDownloads < 0 {
+		return "", errors.New("share expiry and maximum downloads can't be negative")
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("failed to make share ID: %w", err)
+	}
+	p := sharePayload{
+		Path:         strings.TrimLeft(remote, "/"),
+		MaxDownloads: opt.MaxDownloads,
+		Password:     opt.Password != "",
+		ID:           hex.EncodeToString(id),
+	}
+	if opt.Expire > 0 {
+		p.Expire = time.Now().Add(opt.Expire).Unix()
+	}
+	data, err := json.Marshal(&p)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + shareSign(secret, payload, opt.Password), nil
+}
+
+// NewShareLink makes a link to remote on the server at baseURL,
+// signed with secret, with the limits in opt.
+func NewShareLink(baseURL, secret, remote string, opt ShareOptions) (string, error) {
+	token, err := NewShareToken(secret, remote, opt)
+	if err != nil {
+		return "", err
+	}
+	remote = strings.TrimLeft(remote, "/")
+	return strings.TrimRight(baseURL, "/") + "/" + rest.URLPathEscape(remote) + "?" + ShareParam + "=" + token, nil
+}
+
+// Errors returned when checking share tokens
+var (
+	errShareInvalid  = errors.New("invalid share link")
+	errSharePassword = errors.New("share link needs a password")
+	errShareExpired  = errors.New("share link has expired")
+	errShareUsedUp   = errors.New("share link has reached its download limit")
+)
+
+// parseShareToken checks the signature on token using password and
+// returns the payload
+func parseShareToken(secret, token, password string) (*sharePayload, error) {
+	payload, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, errShareInvalid
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, errShareInvalid
+	}
+	var p sharePayload
+	if err = json.Unmarshal(data, &p); err != nil {
+		return nil, errShareInvalid
+	}
+	if !p.Password {
+		password = ""
+	}
+	if !hmac.Equal([]byte(sig), []byte(shareSign(secret, payload, password))) {
+		// A wrong password can't be told apart from a forged token
+		if p.Password {
+			return nil, errSharePassword
+		}
+		return nil, errShareInvalid
+	}
+	if p.Expire != 0 && time.Now().Unix() >= p.Expire {
+		return nil, errShareExpired
+	}
+	return &p, nil
+}
+
+// shareDownloads counts the downloads made with each share token
+type shareDownloads struct {
+	mu    sync.Mutex
+	count map[string]int
+}
+
+// add counts a download for p returning false if it is over the limit
+func (d *shareDownloads) add(p *sharePayload) bool {
+	if p.MaxDownloads == 0 {
+		return true
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.count[p.ID] >= p.MaxDownloads {
+		return false
+	}
+	d.count[p.ID]++
+	return true
+}
+
+// isDownload returns true if r downloads a file
+//
+// Every GET of a file counts, including Range requests, as any range
+// can be used to fetch the whole file. Thumbnails and transcoded
+// videos made by the serve commands with ?thumb= and ?transcode=
+// aren't downloads of the file so aren't counted.
+func isDownload(r *http.Request) bool {
+	if r.Method != http.MethodGet || strings.HasSuffix(r.URL.Path, "/") {
+		return false
+	}
+	query := r.URL.Query()
+	return !query.Has("thumb") && !query.Has("transcode")
+}
+
+// MiddlewareShare instantiates middleware that lets requests with a
+// share token signed with secret in the URL skip authentication.
+//
+// Requests without a token are passed on unchanged.
+func MiddlewareShare(secret string) Middleware {
+	downloads := &shareDownloads{count: map[string]int{}}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := r.URL.Query().Get(ShareParam)
+			if token == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				http.Error(w, "Share links are read only", http.StatusMethodNotAllowed)
+				return
+			}
+			_, password, _ := parseAuthorization(r)
+			p, err := parseShareToken(secret, token, password)
+			if err == nil && !p.allows(strings.TrimLeft(r.URL.Path, "/")) {
+				err = errShareInvalid
+			}
+			if err == nil && isDownload(r) && !downloads.add(p) {
+				err = errShareUsedUp
+			}
+			if err != nil {
+				fs.Infof(r.URL.Path, "%s: Share link refused: %v", r.RemoteAddr, err)
+				code := http.StatusForbidden
+				switch err {
+				case errSharePassword:
+					code = http.StatusUnauthorized
+					w.Header().Set("WWW-Authenticate", `Basic realm="rclone share", charset="UTF-8"`)
+				case errShareExpired, errShareUsedUp:
+					code = http.StatusGone
+				}
+				http.Error(w, err.Error(), code)
+				return
+			}
+			ctx := context.WithValue(r.Context(), ctxKeyShare, token)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// IsShared checks if this request was allowed by a share token
+func IsShared(r *http.Request) bool {
+	_, ok := CtxGetShare(r.Context())
+	return ok
+}
+
+// CtxGetShare returns the share token the request was allowed by
+func CtxGetShare(ctx context.Context) (string, bool) {
+	v, ok := ctx.Value(ctxKeyShare).(string)
+	return v, ok
+}
+
+// shareServers are the running servers which allow share links
+var shareServers = struct {
+	mu      sync.Mutex
+	servers map[*Server]struct{}
+}{
+	servers: map[*Server]struct{}{},
+}
+
+// ShareLinks makes links to remote on every running server which
+// allows share links, with the limits in opt.
+func ShareLinks(remote string, opt ShareOptions) (links []string, err error) {
+	shareServers.mu.Lock()
+	defer shareServers.mu.Unlock()
+	for s := range shareServers.servers {
+		for _, u := range s.URLs() {
+			link, err := NewShareLink(u, s.share.Secret, remote, opt)
+			if err != nil {
+				return nil, err
+			}
+			links = append(links, link)
+		}
+	}
+	if len(links) == 0 {
+		return nil, errors.New("no servers running with --share-secret")
+	}
+	return links, nil
+}
@@ -0,0 +1,135 @@
+package http
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testShareSecret = "0123456789abcdef"
+
+func TestShareToken(t *testing.T) {
+	_, err := NewShareToken("short", "file.txt", ShareOptions{})
+	assert.Error(t, err)
+
+	token, err := NewShareToken(testShareSecret, "/dir/", ShareOptions{Password: "pw"})
+	require.NoError(t, err)
+
+	p, err := parseShareToken(testShareSecret, token, "pw")
+	require.NoError(t, err)
+	assert.Equal(t, "dir/", p.Path)
+	assert.True(t, p.allows("dir"))
+	assert.True(t, p.allows("dir/sub/file.txt"))
+	assert.False(t, p.allows("dirx/file.txt"))
+	assert.False(t, p.allows("dir/../secret.txt"))
+
+	_, err = parseShareToken(testShareSecret, token, "wrong")
+	assert.Equal(t, errSharePassword, err)
+	_, err = parseShareToken("fedcba9876543210", token, "pw")
+	assert.Equal(t, errSharePassword, err)
+
+	// changing the payload breaks the signature
+	payload, sig, _ := strings.Cut(token, ".")
+	_, err = parseShareToken(testShareSecret, payload[:len(payload)-2]+"."+sig, "pw")
+	assert.Equal(t, errShareInvalid, err)
+
+	// tokens without a password ignore any password given
+	token, err = NewShareToken(testShareSecret, "file.txt", ShareOptions{})
+	require.NoError(t, err)
+	p, err = parseShareToken(testShareSecret, token, "user-password")
+	require.NoError(t, err)
+	assert.True(t, p.allows("file.txt"))
+	assert.False(t, p.allows("file.txt/x"))
+	assert.False(t, p.allows("other.txt"))
+}
+
+func TestMiddlewareShare(t *testing.T) {
+	s, err := NewServer(context.Background(),
+		WithConfig(Config{ListenAddr: []string{"127.0.0.1:0"}, BaseURL: "/base"}),
+		WithAuth(AuthConfig{Realm: "test", BasicUser: "test", BasicPass: "test"}),
+		WithShare(ShareConfig{Secret: testShareSecret}),
+	)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, s.Shutdown())
+	}()
+
+	expected := []byte("secret-page")
+	s.Router().Mount("/", testEchoHandler(expected))
+	s.Serve()
+	url := testGetServerURL(t, s)
+
+	get := func(link, method, password string, header ...string) *http.Response {
+		req, err := http.NewRequest(method, link, nil)
+		require.NoError(t, err)
+		if password != "" {
+			req.SetBasicAuth("anyone", password)
+		}
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		return resp
+	}
+
+	// no token still needs auth
+	assert.Equal(t, http.StatusUnauthorized, get(url+"file.txt", "GET", "").StatusCode)
+
+	link, err := NewShareLink(url, testShareSecret, "file.txt", ShareOptions{MaxDownloads: 2})
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(link, url+"file.txt?share="), link)
+	assert.Equal(t, http.StatusOK, get(link, "GET", "").StatusCode)
+	assert.Equal(t, http.StatusOK, get(link, "HEAD", "").StatusCode)
+	assert.Equal(t, http.StatusOK, get(link+"&thumb=", "GET", "").StatusCode)
+	assert.Equal(t, http.StatusMethodNotAllowed, get(link, "PUT", "").StatusCode)
+	assert.Equal(t, http.StatusForbidden, get(strings.Replace(link, "file.txt", "other.txt", 1), "GET", "").StatusCode)
+	// range requests count too as they can fetch the whole file
+	assert.Equal(t, http.StatusOK, get(link, "GET", "", "Range", "bytes=-100").StatusCode)
+	assert.Equal(t, http.StatusGone, get(link, "GET", "", "Range", "bytes=1-").StatusCode)
+	assert.Equal(t, http.StatusGone, get(link, "GET", "").StatusCode)
+	assert.Equal(t, http.StatusForbidden, get(link+"x", "GET", "").StatusCode)
+
+	link, err = NewShareLink(url, testShareSecret, "dir/", ShareOptions{Password: "pw"})
+	require.NoError(t, err)
+	resp := get(link, "GET", "")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("WWW-Authenticate"), "rclone share")
+	assert.Equal(t, http.StatusUnauthorized, get(link, "GET", "wrong").StatusCode)
+	assert.Equal(t, http.StatusOK, get(link, "GET", "pw").StatusCode)
+	assert.Equal(t, http.StatusOK, get(strings.Replace(link, "dir/", "dir/sub/file.txt", 1), "GET", "pw").StatusCode)
+
+	assert.Equal(t, http.StatusForbidden, get(url+"file.txt?share=potato", "GET", "").StatusCode)
+
+	// links are made for the running server
+	links, err := ShareLinks("file.txt", ShareOptions{})
+	require.NoError(t, err)
+	require.Len(t, links, 1)
+	assert.True(t, strings.HasPrefix(links[0], url+"file.txt?share="), links[0])
+	assert.Equal(t, http.StatusOK, get(links[0], "GET", "").StatusCode)
+}
+
+func TestShareExpired(t *testing.T) {
+	data, err := json.Marshal(&sharePayload{Path: "file.txt", Expire: time.Now().Add(-time.Minute).Unix()})
+	require.NoError(t, err)
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	token := payload + "." + shareSign(testShareSecret, payload, "")
+	_, err = parseShareToken(testShareSecret, token, "")
+	assert.Equal(t, errShareExpired, err)
+}
+
+func TestHelpPrefixShare(t *testing.T) {
+	for _, prefix := range []string{"rc-", "metrics-"} {
+		t.Run(prefix, func(t *testing.T) {
+			assert.Contains(t, ShareHelp(prefix), prefix)
+		})
+	}
+}
@@ -0,0 +1,384 @@
+package vfs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+)
+
+// Operations recorded in the audit log
+const (
+	AuditOpen   = "open"
+	AuditRead   = "read"
+	AuditWrite  = "write"
+	AuditRename = "rename"
+	AuditDelete = "delete"
+	AuditMkdir  = "mkdir"
+	AuditScan   = "scan"
+)
+
+// auditBufferSize is the number of entries kept for the vfs/audit rc call
+const auditBufferSize = 1000
+
+// AuditInfo describes the client using a Session for the audit log
+type AuditInfo struct {
+	User       string // user name, if known
+	Protocol   string // protocol being served, e.g. "sftp"
+	RemoteAddr string // address of the client, if known
+}
+
+// AuditEntry is an entry in the audit log
+type AuditEntry struct {
+	Seq        uint64    `json:"seq"`
+	Time       time.Time `json:"time"`
+	User       string    `json:"user,omitempty"`
+	Protocol   string    `json:"protocol,omitempty"`
+	RemoteAddr string    `json:"remoteAddr,omitempty"`
+	Fs         string    `json:"fs"`
+	Op         string    `json:"op"`
+	Path       string    `json:"path"`
+	NewPath    string    `json:"newPath,omitempty"`
+	Bytes      int64     `json:"bytes,omitempty"`
+	Result     string    `json:"result,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// auditLog writes audit entries to the destinations in --vfs-audit-log
+type auditLog struct {
+	writers []io.Writer
+	rc      bool // set if entries are kept for the vfs/audit rc call
+}
+
+// The audit logs in use keyed on the --vfs-audit-log value
+var (
+	auditLogsMu sync.Mutex
+	auditLogs   = map[string]*auditLog{}
+)
+
+// The audit entries kept for the vfs/audit rc call
+var auditBuffer struct {
+	mu      sync.Mutex
+	seq     uint64
+	entries []AuditEntry
+}
+
+// getAuditLog returns the audit log for the destinations in spec,
+// opening it if necessary.
+//
+// spec is a comma separated list of file names, "syslog" and "rc".
+func getAuditLog(spec string) (*auditLog, error) {
+	auditLogsMu.Lock()
+	defer auditLogsMu.Unlock()
+	if a, found := auditLogs[spec]; found {
+		return a, nil
+	}
+	a := &auditLog{}
+	for _, dest := range strings.Split(spec, ",") {
+		dest = strings.TrimSpace(dest)
+		switch dest {
+		case "":
+		case "rc":
+			a.rc = true
+		case "syslog":
+			w, err := newAuditSyslog()
+			if err != nil {
+				return nil, fmt.Errorf("failed to open syslog for audit log: %w", err)
+			}
+			a.writers = append(a.writers, w)
+		default:
+			f, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+			if err != nil {
+				return nil, fmt.Errorf("failed to open audit log: %w", err)
+			}
+			a.writers = append(a.writers, f)
+		}
+	}
+	auditLogs[spec] = a
+	return a, nil
+}
+
+// add writes entry to the audit log
+func (a *auditLog) add(entry AuditEntry) {
+	// Hold the lock while writing so the entries are in order
+	auditBuffer.mu.Lock()
+	defer auditBuffer.mu.Unlock()
+	auditBuffer.seq++
+	entry.Seq = auditBuffer.seq
+	if a.rc {
+		if len(auditBuffer.entries) >= auditBufferSize {
+			auditBuffer.entries = append(auditBuffer.entries[:0], auditBuffer.entries[1:]...)
+		}
+		auditBuffer.entries = append(auditBuffer.entries, entry)
+	}
+	if len(a.writers) == 0 {
+		return
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		fs.Errorf(nil, "Failed to encode audit log entry: %v", err)
+		return
+	}
+	data = append(data, '\n')
+	for _, w := range a.writers {
+		if _, err := w.Write(data); err != nil {
+			fs.Errorf(nil, "Failed to write audit log: %v", err)
+		}
+	}
+}
+
+// auditSince returns the entries kept for the rc after seq and the
+// sequence number of the last entry
+func auditSince(seq uint64) (entries []AuditEntry, last uint64) {
+	auditBuffer.mu.Lock()
+	defer auditBuffer.mu.Unlock()
+	entries = []AuditEntry{}
+	for _, entry := range auditBuffer.entries {
+		if entry.Seq > seq {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, auditBuffer.seq
+}
+
+// openAuditLog opens the audit log set with --vfs-audit-log
+func (vfs *VFS) openAuditLog() {
+	if vfs.Opt.AuditLog == "" {
+		return
+	}
+	a, err := getAuditLog(vfs.Opt.AuditLog)
+	if err != nil {
+		// Carrying on without the audit log could lose records
+		log.Fatalf("Failed to start audit log: %v", err)
+	}
+	vfs.auditLog = a
+}
+
+// newAuditEntry returns an entry for the audit log
+func (vfs *VFS) newAuditEntry(info *AuditInfo, op, path string) AuditEntry {
+	return AuditEntry{
+		Time:       time.Now(),
+		User:       info.User,
+		Protocol:   info.Protocol,
+		RemoteAddr: info.RemoteAddr,
+		Fs:         fs.ConfigString(vfs.f),
+		Op:         op,
+		Path:       path,
+	}
+}
+
+// audit records an operation in the audit log if there is one
+func (vfs *VFS) audit(info *AuditInfo, op, path, newPath string, bytes int64, err error) {
+	if vfs.auditLog == nil {
+		return
+	}
+	entry := vfs.newAuditEntry(info, op, path)
+	entry.NewPath = newPath
+	entry.Bytes = bytes
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	vfs.auditLog.add(entry)
+}
+
+// auditScan records the result of the upload hook in the audit log if
+// there is one
+func (vfs *VFS) auditScan(info *AuditInfo, path string, bytes int64, result, message string) {
+	if vfs.auditLog == nil {
+		return
+	}
+	entry := vfs.newAuditEntry(info, AuditScan, path)
+	entry.Bytes = bytes
+	entry.Result = result
+	entry.Error = message
+	vfs.auditLog.add(entry)
+}
+
+// setUploader remembers info as the client which last wrote path so
+// the upload hook can record it in the audit log
+func (vfs *VFS) setUploader(path string, info AuditInfo) {
+	if vfs.auditLog == nil || vfs.uploadHookFn() == nil {
+		return
+	}
+	vfs.uploaders.Store(path, info)
+}
+
+// uploader returns the client which last wrote path, forgetting it
+func (vfs *VFS) uploader(path string) (info AuditInfo) {
+	if value, ok := vfs.uploaders.LoadAndDelete(path); ok {
+		info = value.(AuditInfo)
+	}
+	return info
+}
+
+// Session is a VFS being used by a single client, which records
+// what the client does in the audit log set with --vfs-audit-log.
+//
+// Servers should use the methods of the Session rather than those of
+// the nodes so the operations are recorded.
+type Session struct {
+	*VFS
+	info AuditInfo
+}
+
+// Session returns a Session for the client described by info
+func (vfs *VFS) Session(info AuditInfo) *Session {
+	return &Session{VFS: vfs, info: info}
+}
+
+// Info returns the description of the client using the Session
+func (s *Session) Info() AuditInfo {
+	return s.info
+}
+
+// OpenFile opens the named file recording it and the bytes read and
+// written when it is closed in the audit log.
+func (s *Session) OpenFile(name string, flags int, perm os.FileMode) (Handle, error) {
+	fh, err := s.VFS.OpenFile(name, flags, perm)
+	if s.auditLog == nil || (err == nil && fh.Node().IsDir()) {
+		return fh, err
+	}
+	name = strings.Trim(name, "/")
+	s.audit(&s.info, AuditOpen, name, "", 0, err)
+	if err != nil {
+		return nil, err
+	}
+	return &auditHandle{Handle: fh, s: s, path: name, flags: flags}, nil
+}
+
+// Open opens the named file for reading
+func (s *Session) Open(name string) (Handle, error) {
+	return s.OpenFile(name, os.O_RDONLY, 0)
+}
+
+// Create creates or truncates the named file
+func (s *Session) Create(name string) (Handle, error) {
+	return s.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+// Rename oldName to newName
+func (s *Session) Rename(oldName, newName string) error {
+	err := s.VFS.Rename(oldName, newName)
+	s.audit(&s.info, AuditRename, strings.Trim(oldName, "/"), strings.Trim(newName, "/"), 0, err)
+	return err
+}
+
+// Remove removes the named file or empty directory
+func (s *Session) Remove(name string) error {
+	err := s.VFS.Remove(name)
+	s.audit(&s.info, AuditDelete, strings.Trim(name, "/"), "", 0, err)
+	return err
+}
+
+// RemoveAll removes the named file or directory and its contents
+func (s *Session) RemoveAll(name string) error {
+	node, err := s.VFS.Stat(name)
+	if err == nil {
+		err = node.RemoveAll()
+	}
+	s.audit(&s.info, AuditDelete, strings.Trim(name, "/"), "", 0, err)
+	return err
+}
+
+// Mkdir creates a new directory
+func (s *Session) Mkdir(name string, perm os.FileMode) error {
+	err := s.VFS.Mkdir(name, perm)
+	s.audit(&s.info, AuditMkdir, strings.Trim(name, "/"), "", 0, err)
+	return err
+}
+
+// MkdirAll creates a new directory and any parents needed
+func (s *Session) MkdirAll(name string, perm os.FileMode) error {
+	err := s.VFS.MkdirAll(name, perm)
+	s.audit(&s.info, AuditMkdir, strings.Trim(name, "/"), "", 0, err)
+	return err
+}
+
+// auditHandle counts the bytes read and written through a Handle so
+// they can be recorded in the audit log when it is closed
+type auditHandle struct {
+	Handle
+	s       *Session
+	path    string
+	flags   int
+	read    atomic.Int64
+	written atomic.Int64
+	closed  atomic.Bool
+}
+
+// Read reads from the handle
+func (fh *auditHandle) Read(p []byte) (n int, err error) {
+	n, err = fh.Handle.Read(p)
+	fh.read.Add(int64(n))
+	return n, err
+}
+
+// ReadAt reads from the handle at off
+func (fh *auditHandle) ReadAt(p []byte, off int64) (n int, err error) {
+	n, err = fh.Handle.ReadAt(p, off)
+	fh.read.Add(int64(n))
+	return n, err
+}
+
+// Write writes to the handle
+func (fh *auditHandle) Write(p []byte) (n int, err error) {
+	n, err = fh.Handle.Write(p)
+	fh.written.Add(int64(n))
+	return n, err
+}
+
+// WriteAt writes to the handle at off
+func (fh *auditHandle) WriteAt(p []byte, off int64) (n int, err error) {
+	n, err = fh.Handle.WriteAt(p, off)
+	fh.written.Add(int64(n))
+	return n, err
+}
+
+// WriteString writes s to the handle
+func (fh *auditHandle) WriteString(s string) (n int, err error) {
+	n, err = fh.Handle.WriteString(s)
+	fh.written.Add(int64(n))
+	return n, err
+}
+
+// done records the reads and writes in the audit log the first time
+// it is called
+func (fh *auditHandle) done(err error) {
+	if fh.closed.Swap(true) {
+		return
+	}
+	read, written := fh.read.Load(), fh.written.Load()
+	accessMode := fh.flags & accessModeMask
+	if read > 0 || accessMode == os.O_RDONLY {
+		fh.s.audit(&fh.s.info, AuditRead, fh.path, "", read, err)
+	}
+	if written > 0 || accessMode == os.O_WRONLY || fh.flags&os.O_TRUNC != 0 {
+		fh.s.setUploader(fh.path, fh.s.info)
+		fh.s.audit(&fh.s.info, AuditWrite, fh.path, "", written, err)
+	}
+}
+
+// Close closes the handle
+func (fh *auditHandle) Close() error {
+	err := fh.Handle.Close()
+	if errors.Is(err, ECLOSED) {
+		return err
+	}
+	fh.done(err)
+	return err
+}
+
+// Release closes the handle if it hasn't been closed already
+func (fh *auditHandle) Release() error {
+	err := fh.Handle.Release()
+	fh.done(err)
+	return err
+}
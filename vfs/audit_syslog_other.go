@@ -0,0 +1,13 @@
+//go:build windows || nacl || plan9
+
+package vfs
+
+import (
+	"errors"
+	"io"
+)
+
+// newAuditSyslog returns a writer sending the audit log to syslog
+func newAuditSyslog() (io.Writer, error) {
+	return nil, errors.New("syslog not supported on this platform")
+}
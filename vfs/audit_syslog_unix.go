@@ -0,0 +1,13 @@
+//go:build !windows && !nacl && !plan9
+
+package vfs
+
+import (
+	"io"
+	"log/syslog"
+)
+
+// newAuditSyslog returns a writer sending the audit log to syslog
+func newAuditSyslog() (io.Writer, error) {
+	return syslog.New(syslog.LOG_INFO|syslog.LOG_AUTHPRIV, "rclone-audit")
+}
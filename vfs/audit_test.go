@@ -0,0 +1,103 @@
+package vfs
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rclone/rclone/vfs/vfscommon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVFSAudit(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "audit.log")
+	opt := vfscommon.DefaultOpt
+	opt.CacheMode = vfscommon.CacheModeWrites
+	opt.WriteBack = 0
+	opt.AuditLog = logFile + ",rc"
+	_, vfs := newTestVFSOpt(t, &opt)
+
+	_, since := auditSince(0)
+	s := vfs.Session(AuditInfo{User: "alice", Protocol: "sftp", RemoteAddr: "192.0.2.1:1234"})
+
+	require.NoError(t, s.Mkdir("dir", 0777))
+	fh, err := s.Create("dir/file")
+	require.NoError(t, err)
+	_, err = fh.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, fh.Close())
+
+	fh, err = s.Open("dir/file")
+	require.NoError(t, err)
+	buf := make([]byte, 3)
+	_, err = fh.Read(buf)
+	require.NoError(t, err)
+	require.NoError(t, fh.Close())
+
+	require.NoError(t, s.Rename("dir/file", "dir/file2"))
+	require.NoError(t, s.Remove("dir/file2"))
+	assert.Error(t, s.Remove("dir/potato"))
+
+	// Operations not done through the session aren't recorded
+	require.NoError(t, vfs.Mkdir("other", 0777))
+
+	type op struct {
+		Op      string
+		Path    string
+		NewPath string
+		Bytes   int64
+		Error   bool
+	}
+	want := []op{
+		{Op: AuditMkdir, Path: "dir"},
+		{Op: AuditOpen, Path: "dir/file"},
+		{Op: AuditWrite, Path: "dir/file", Bytes: 5},
+		{Op: AuditOpen, Path: "dir/file"},
+		{Op: AuditRead, Path: "dir/file", Bytes: 3},
+		{Op: AuditRename, Path: "dir/file", NewPath: "dir/file2"},
+		{Op: AuditDelete, Path: "dir/file2"},
+		{Op: AuditDelete, Path: "dir/potato", Error: true},
+	}
+
+	check := func(entries []AuditEntry) {
+		t.Helper()
+		var got []op
+		for _, entry := range entries {
+			assert.Equal(t, "alice", entry.User)
+			assert.Equal(t, "sftp", entry.Protocol)
+			assert.Equal(t, "192.0.2.1:1234", entry.RemoteAddr)
+			got = append(got, op{
+				Op:      entry.Op,
+				Path:    entry.Path,
+				NewPath: entry.NewPath,
+				Bytes:   entry.Bytes,
+				Error:   entry.Error != "",
+			})
+		}
+		assert.Equal(t, want, got)
+	}
+
+	// Check the entries kept for the rc
+	entries, last := auditSince(since)
+	check(entries)
+	assert.Equal(t, entries[len(entries)-1].Seq, last)
+
+	// Check the entries written to the file
+	in, err := os.Open(logFile)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, in.Close())
+	}()
+	entries = nil
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		var entry AuditEntry
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		entries = append(entries, entry)
+	}
+	require.NoError(t, scanner.Err())
+	check(entries)
+}
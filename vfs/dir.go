@@ -969,6 +969,9 @@ func (d *Dir) Create(name string, flags int) (*File, error) {
 	if d.vfs.Opt.ReadOnly {
 		return nil, EROFS
 	}
+	if err = d.vfs.quota.add(0, 1); err != nil {
+		return nil, err
+	}
 	if err = d.SetModTime(time.Now()); err != nil {
 		fs.Errorf(d, "Dir.Create failed to set modtime on parent dir: %v", err)
 		return nil, err
@@ -1103,6 +1106,13 @@ func (d *Dir) Rename(oldName, newName string, destDir *Dir) error {
 		fs.Errorf(oldPath, "Dir.Rename error: %v", err)
 		return err
 	}
+	// A file renamed over another file replaces it
+	replacedSize := int64(-1)
+	if _, ok := oldNode.(*File); ok {
+		if node, err := destDir.stat(newName); err == nil && node != oldNode && node.IsFile() {
+			replacedSize = nonNegative(node.Size())
+		}
+	}
 	switch x := oldNode.DirEntry().(type) {
 	case nil:
 		if oldFile, ok := oldNode.(*File); ok {
@@ -1156,6 +1166,9 @@ func (d *Dir) Rename(oldName, newName string, destDir *Dir) error {
 	// Show moved - delete from old dir and add to new
 	d.delObject(oldName)
 	destDir.addObject(oldNode)
+	if replacedSize >= 0 {
+		_ = d.vfs.quota.add(-replacedSize, -1)
+	}
 	if err = d.SetModTime(time.Now()); err != nil {
 		fs.Errorf(d, "Dir.Rename failed to set modtime on parent dir: %v", err)
 		return err
@@ -20,6 +20,7 @@ const (
 	EBADF
 	EROFS
 	ENOSYS
+	ENOSPC
 )
 
 // Errors which have exact counterparts in os
@@ -38,6 +39,7 @@ var errorNames = []string{
 	EBADF:     "Bad file descriptor",
 	EROFS:     "Read only file system",
 	ENOSYS:    "Function not implemented",
+	ENOSPC:    "No space left on device",
 }
 
 // Error renders the error as a string
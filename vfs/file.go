@@ -609,6 +609,9 @@ func (f *File) Remove() (err error) {
 		return EROFS
 	}
 
+	// Read the size before it goes from the cache
+	size := f.Size()
+
 	// Remove the object from the cache
 	wasWriting := false
 	if d.vfs.cache != nil && d.vfs.cache.Exists(f.Path()) {
@@ -636,6 +639,7 @@ func (f *File) Remove() (err error) {
 	// called with File.mu released when there is no error removing the underlying file
 	if err == nil {
 		d.delObject(f.Name())
+		_ = d.vfs.quota.add(-size, -1)
 	}
 	return err
 }
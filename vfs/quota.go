@@ -0,0 +1,171 @@
+package vfs
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/operations"
+)
+
+// quota limits the bytes and files stored in the VFS
+//
+// The usage is counted with operations.Count in the background when
+// the VFS starts and then kept up to date as files are written and
+// removed. It is counted again every --vfs-quota-interval to pick up
+// changes made outside the VFS.
+type quota struct {
+	f        fs.Fs
+	maxSize  int64         // bytes allowed, -1 for unlimited
+	maxFiles int64         // files allowed, -1 for unlimited
+	interval time.Duration // time between counts of the usage
+
+	mu        sync.Mutex
+	counted   time.Time // when the usage was last counted, zero if never
+	counting  bool      // set while counting
+	size      int64     // bytes in use
+	files     int64     // files in use
+	countSize int64     // changes to size made while counting
+	countFile int64     // changes to files made while counting
+}
+
+// QuotaUsage describes the usage of a VFS with a quota
+type QuotaUsage struct {
+	Size     int64 // bytes in use
+	Files    int64 // files in use
+	MaxSize  int64 // bytes allowed, -1 for unlimited
+	MaxFiles int64 // files allowed, -1 for unlimited
+}
+
+// newQuota returns a quota for the options or nil if there isn't one
+//
+// The usage starts being counted in the background.
+func newQuota(vfs *VFS) *quota {
+	if vfs.Opt.QuotaSize < 0 && vfs.Opt.QuotaFiles < 0 {
+		return nil
+	}
+	q := &quota{
+		f:        vfs.f,
+		maxSize:  int64(vfs.Opt.QuotaSize),
+		maxFiles: vfs.Opt.QuotaFiles,
+		interval: vfs.Opt.QuotaInterval,
+	}
+	q.mu.Lock()
+	q._startCount()
+	q.mu.Unlock()
+	return q
+}
+
+// _startCount starts counting the usage in the background
+//
+// call with the lock held
+func (q *quota) _startCount() {
+	q.counting = true
+	q.countSize, q.countFile = 0, 0
+	go q.doCount()
+}
+
+// doCount sets the usage from the remote
+//
+// call with counting set by the caller
+func (q *quota) doCount() {
+	files, size, _, err := operations.Count(context.Background(), q.f)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.counting = false
+	q.counted = time.Now()
+	if err != nil {
+		fs.Errorf(q.f, "Failed to count usage for quota: %v", err)
+		return
+	}
+	// Changes made while counting may or may not have been seen
+	// so count them again rather than losing them
+	q.size = size + q.countSize
+	q.files = files + q.countFile
+	fs.Debugf(q.f, "Counted usage for quota: %d bytes in %d files", q.size, q.files)
+}
+
+// count sets the usage from the remote, waiting for any count in
+// progress to finish first
+func (q *quota) count() {
+	q.mu.Lock()
+	for q.counting {
+		q.mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		q.mu.Lock()
+	}
+	q.counting = true
+	q.countSize, q.countFile = 0, 0
+	q.mu.Unlock()
+	q.doCount()
+}
+
+// _update starts counting the usage again in the background if it is
+// time to
+//
+// call with the lock held
+func (q *quota) _update() {
+	if q.interval > 0 && !q.counting && time.Since(q.counted) >= q.interval {
+		q._startCount()
+	}
+}
+
+// add size bytes and files files to the usage returning ENOSPC if
+// that takes it over the quota
+//
+// size and files may be negative to release space, which always
+// succeeds. Until the usage has been counted for the first time the
+// quota isn't known to be exceeded so the changes are just recorded.
+func (q *quota) add(size, files int64) error {
+	if q == nil || (size == 0 && files == 0) {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q._update()
+	counted := !q.counted.IsZero()
+	if counted && size > 0 && q.maxSize >= 0 && q.size+size > q.maxSize {
+		fs.Debugf(q.f, "Quota of %d bytes exceeded", q.maxSize)
+		return ENOSPC
+	}
+	if counted && files > 0 && q.maxFiles >= 0 && q.files+files > q.maxFiles {
+		fs.Debugf(q.f, "Quota of %d files exceeded", q.maxFiles)
+		return ENOSPC
+	}
+	q.size += size
+	q.files += files
+	if q.counting {
+		q.countSize += size
+		q.countFile += files
+	}
+	if q.size < 0 {
+		q.size = 0
+	}
+	if q.files < 0 {
+		q.files = 0
+	}
+	return nil
+}
+
+// usage returns the current usage
+func (q *quota) usage() QuotaUsage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q._update()
+	return QuotaUsage{
+		Size:     q.size,
+		Files:    q.files,
+		MaxSize:  q.maxSize,
+		MaxFiles: q.maxFiles,
+	}
+}
+
+// Quota returns the usage of the VFS and whether it has a quota set
+// with --vfs-quota-size or --vfs-quota-files
+func (vfs *VFS) Quota() (usage QuotaUsage, ok bool) {
+	if vfs.quota == nil {
+		return usage, false
+	}
+	return vfs.quota.usage(), true
+}
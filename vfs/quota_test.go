@@ -0,0 +1,97 @@
+package vfs
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/vfs/vfscommon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeQuotaFile writes contents to name in vfs
+func writeQuotaFile(vfs *VFS, name, contents string) error {
+	fh, err := vfs.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0777)
+	if err != nil {
+		return err
+	}
+	_, err = fh.Write([]byte(contents))
+	closeErr := fh.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+func TestVFSQuota(t *testing.T) {
+	for _, cacheMode := range []vfscommon.CacheMode{vfscommon.CacheModeOff, vfscommon.CacheModeWrites} {
+		t.Run(cacheMode.String(), func(t *testing.T) {
+			opt := vfscommon.DefaultOpt
+			opt.CacheMode = cacheMode
+			opt.WriteBack = 0
+			opt.QuotaSize = 10
+			opt.QuotaFiles = 2
+			r, vfs := newTestVFSOpt(t, &opt)
+			r.WriteObject(context.Background(), "a", "aaa", time.Now())
+
+			checkUsage := func(size, files int64) {
+				t.Helper()
+				usage, ok := vfs.Quota()
+				require.True(t, ok)
+				assert.Equal(t, QuotaUsage{Size: size, Files: files, MaxSize: 10, MaxFiles: 2}, usage)
+			}
+
+			// the usage is counted when the VFS starts, so count it
+			// again to see the file written to the remote
+			vfs.quota.count()
+			checkUsage(3, 1)
+
+			require.NoError(t, writeQuotaFile(vfs, "b", "bbbbb"))
+			checkUsage(8, 2)
+
+			// too many files
+			assert.Equal(t, ENOSPC, writeQuotaFile(vfs, "c", ""))
+			checkUsage(8, 2)
+
+			// too many bytes
+			fh, err := vfs.OpenFile("b", os.O_WRONLY|os.O_TRUNC, 0777)
+			require.NoError(t, err)
+			_, err = fh.Write([]byte("12345678"))
+			assert.Equal(t, ENOSPC, err)
+			_ = fh.Close()
+
+			// overwriting releases the old contents
+			require.NoError(t, writeQuotaFile(vfs, "b", "1234567"))
+			checkUsage(10, 2)
+
+			total, used, free := vfs.Statfs()
+			assert.Equal(t, []int64{10, 10, 0}, []int64{total, used, free})
+
+			require.NoError(t, vfs.Remove("a"))
+			checkUsage(7, 1)
+
+			// renaming over a file releases the file replaced
+			require.NoError(t, writeQuotaFile(vfs, "c", "cc"))
+			checkUsage(9, 2)
+			require.NoError(t, vfs.Rename("c", "b"))
+			checkUsage(2, 1)
+
+			// changes made outside the VFS are found when counted again
+			if cacheMode == vfscommon.CacheModeOff {
+				r.WriteObject(context.Background(), "d", "d", time.Now())
+				vfs.quota.count()
+				checkUsage(3, 2)
+			}
+		})
+	}
+}
+
+func TestVFSNoQuota(t *testing.T) {
+	_, vfs := newTestVFS(t)
+	assert.Nil(t, vfs.quota)
+	_, ok := vfs.Quota()
+	assert.False(t, ok)
+	assert.NoError(t, vfs.quota.add(1, 1))
+}
@@ -437,3 +437,55 @@ func rcStats(ctx context.Context, in rc.Params) (out rc.Params, err error) {
 	}
 	return vfs.Stats(), nil
 }
+
+func init() {
+	rc.Add(rc.Call{
+		Path:  "vfs/audit",
+		Title: "Read the audit log of file operations.",
+		Help: `
+This returns the entries in the audit log if "rc" is one of the
+destinations in --vfs-audit-log.
+
+The last 1000 entries are kept. Each has a sequence number "seq" so
+the log can be followed by passing the "last" value returned as the
+"since" parameter of the next call.
+
+    rclone rc vfs/audit since=1234
+
+Returns
+
+    {
+        "entries": [
+            {
+                "seq": 1235,
+                "time": "2024-06-01T12:00:00.000000000Z",
+                "user": "alice",
+                "protocol": "sftp",
+                "remoteAddr": "192.0.2.1:50912",
+                "fs": "s3:bucket",
+                "op": "write",
+                "path": "dir/file.txt",
+                "bytes": 1024
+            }
+        ],
+        "last": 1235
+    }
+`,
+		Fn: rcAudit,
+	})
+}
+
+func rcAudit(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	since, err := in.GetInt64("since")
+	if err != nil && !rc.IsErrParamNotFound(err) {
+		return nil, err
+	}
+	if since < 0 {
+		return nil, errors.New("since must not be negative")
+	}
+	entries, last := auditSince(uint64(since))
+	return rc.Params{
+		"entries": entries,
+		"last":    last,
+	}, nil
+}
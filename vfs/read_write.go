@@ -345,6 +345,15 @@ func (fh *RWFileHandle) _writeAt(b []byte, off int64, release bool) (n int, err
 		off = fh.offset
 	}
 	fh.writeCalled = true
+	// Reserve the space for any growth of the file
+	quota := fh.file.VFS().quota
+	size := fh._size()
+	grow := off + int64(len(b)) - size
+	if grow > 0 {
+		if err = quota.add(grow, 0); err != nil {
+			return n, err
+		}
+	}
 	if release {
 		// Do the writing with fh.mu unlocked
 		fh.mu.Unlock()
@@ -353,6 +362,10 @@ func (fh *RWFileHandle) _writeAt(b []byte, off int64, release bool) (n int, err
 	if release {
 		fh.mu.Lock()
 	}
+	if grow > 0 && n < len(b) {
+		// Give back the space not written
+		_ = quota.add(-(grow - nonNegative(off+int64(n)-size)), 0)
+	}
 	if err != nil {
 		return n, err
 	}
@@ -390,11 +403,20 @@ func (fh *RWFileHandle) WriteString(s string) (n int, err error) {
 //
 // Call with mutex held
 func (fh *RWFileHandle) _truncate(size int64) (err error) {
-	if size == fh._size() {
+	oldSize := fh._size()
+	if size == oldSize {
 		return nil
 	}
+	quota := fh.file.VFS().quota
+	if err = quota.add(size-oldSize, 0); err != nil {
+		return err
+	}
 	fh.file.setSize(size)
-	return fh.item.Truncate(size)
+	err = fh.item.Truncate(size)
+	if err != nil {
+		_ = quota.add(oldSize-size, 0)
+	}
+	return err
 }
 
 // Truncate file to given size
@@ -0,0 +1,224 @@
+package vfs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/vfs/vfscache"
+)
+
+// Results of the upload hook recorded in the audit log
+const (
+	ScanOK          = "ok"
+	ScanRejected    = "rejected"
+	ScanQuarantined = "quarantined"
+	ScanFailed      = "failed"
+)
+
+// clamdChunkSize is the size of the chunks the file is sent to clamd in
+const clamdChunkSize = 64 * 1024
+
+// uploadHookFn returns the function to check files before they are
+// uploaded or nil if there isn't one.
+func (vfs *VFS) uploadHookFn() vfscache.UploadHookFn {
+	if vfs.Opt.UploadHook == "" && vfs.Opt.UploadClamd == "" {
+		return nil
+	}
+	return vfs.uploadHook
+}
+
+// uploadHook checks the cache file at osPath for name before it is
+// uploaded, rejecting it if any of the checks fail.
+func (vfs *VFS) uploadHook(ctx context.Context, name string, osPath string) error {
+	var size int64
+	if fi, err := os.Stat(osPath); err == nil {
+		size = fi.Size()
+	}
+	info := vfs.uploader(name)
+	reason, err := vfs.scanUpload(ctx, name, osPath)
+	if err != nil {
+		vfs.auditScan(&info, name, size, ScanFailed, err.Error())
+		return err
+	}
+	if reason == "" {
+		fs.Debugf(name, "Upload hook: accepted file")
+		vfs.auditScan(&info, name, size, ScanOK, "")
+		return nil
+	}
+	result := ScanRejected
+	if vfs.Opt.UploadQuarantine != "" {
+		if err := quarantine(vfs.Opt.UploadQuarantine, name, osPath); err != nil {
+			fs.Errorf(name, "Upload hook: failed to quarantine file: %v", err)
+		} else {
+			result = ScanQuarantined
+		}
+	}
+	fs.Errorf(name, "Upload hook: %s file: %s", result, reason)
+	vfs.auditScan(&info, name, size, result, reason)
+	vfs.discardUpload(name, size)
+	return fmt.Errorf("%w: %s", vfscache.ErrUploadRejected, reason)
+}
+
+// scanUpload runs the checks on osPath returning a reason if the
+// file should be rejected or an error if a check couldn't be run.
+func (vfs *VFS) scanUpload(ctx context.Context, name string, osPath string) (reason string, err error) {
+	if vfs.Opt.UploadClamd != "" {
+		reason, err = clamdScan(ctx, vfs.Opt.UploadClamd, osPath)
+		if reason != "" || err != nil {
+			return reason, err
+		}
+	}
+	if vfs.Opt.UploadHook != "" {
+		reason, err = runUploadHook(ctx, strings.Fields(vfs.Opt.UploadHook), name, osPath)
+	}
+	return reason, err
+}
+
+// runUploadHook runs the command in cmdLine with osPath appended.
+//
+// Like clamscan an exit code of 0 accepts the file, 1 rejects it and
+// anything else is an error.
+func runUploadHook(ctx context.Context, cmdLine []string, name string, osPath string) (reason string, err error) {
+	cmd := exec.CommandContext(ctx, cmdLine[0], append(cmdLine[1:], osPath)...)
+	cmd.Env = append(os.Environ(), "RCLONE_UPLOAD_NAME="+name)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	fs.Debugf(name, "Upload hook: running %v", cmd.Args)
+	err = cmd.Run()
+	if err == nil {
+		return "", nil
+	}
+	message := strings.TrimSpace(out.String())
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		if message == "" {
+			message = "rejected by upload hook"
+		}
+		return message, nil
+	}
+	return "", fmt.Errorf("upload hook %v failed: %q: %w", cmdLine, message, err)
+}
+
+// clamdScan sends the file at osPath to the clamd at addr with the
+// INSTREAM command, returning the name of the signature found if any.
+//
+// addr is either host:port or the path to a unix socket.
+func clamdScan(ctx context.Context, addr string, osPath string) (reason string, err error) {
+	network := "tcp"
+	if strings.HasPrefix(addr, "unix:") || strings.HasPrefix(addr, "/") {
+		network, addr = "unix", strings.TrimPrefix(addr, "unix:")
+	}
+	in, err := os.Open(osPath)
+	if err != nil {
+		return "", err
+	}
+	defer fs.CheckClose(in, &err)
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, addr)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to clamd: %w", err)
+	}
+	defer fs.CheckClose(conn, &err)
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	// Send the file in length prefixed chunks ending with an empty one
+	w := bufio.NewWriter(conn)
+	if _, err = w.WriteString("zINSTREAM\x00"); err != nil {
+		return "", fmt.Errorf("failed to write to clamd: %w", err)
+	}
+	buf := make([]byte, clamdChunkSize)
+	for {
+		n, readErr := in.Read(buf)
+		if n > 0 {
+			if err = binary.Write(w, binary.BigEndian, uint32(n)); err == nil {
+				_, err = w.Write(buf[:n])
+			}
+			if err != nil {
+				return "", fmt.Errorf("failed to write to clamd: %w", err)
+			}
+		}
+		if readErr == io.EOF {
+			break
+		} else if readErr != nil {
+			return "", readErr
+		}
+	}
+	if err = binary.Write(w, binary.BigEndian, uint32(0)); err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to write to clamd: %w", err)
+	}
+
+	// Read the reply which is "stream: OK", "stream: <signature>
+	// FOUND" or "<message> ERROR"
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("failed to read from clamd: %w", err)
+	}
+	reply = strings.TrimSpace(strings.TrimRight(reply, "\x00"))
+	reply = strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case reply == "OK":
+		return "", nil
+	case strings.HasSuffix(reply, " FOUND"):
+		return strings.TrimSuffix(reply, " FOUND"), nil
+	}
+	return "", fmt.Errorf("clamd scan failed: %q", reply)
+}
+
+// quarantine copies the file at osPath to name in the directory dir
+func quarantine(dir string, name string, osPath string) (err error) {
+	dst := filepath.Join(dir, filepath.FromSlash(name))
+	if err = os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+		return err
+	}
+	in, err := os.Open(osPath)
+	if err != nil {
+		return err
+	}
+	defer fs.CheckClose(in, &err)
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer fs.CheckClose(out, &err)
+	_, err = io.Copy(out, in)
+	return err
+}
+
+// discardUpload removes the changes to the file name of size from the
+// directory listings as it won't be uploaded.
+//
+// If the file was new it disappears, otherwise it goes back to the
+// object on the remote.
+func (vfs *VFS) discardUpload(name string, size int64) {
+	node, err := vfs.Stat(name)
+	if err != nil {
+		return
+	}
+	file, ok := node.(*File)
+	if !ok {
+		return
+	}
+	if o, ok := file.DirEntry().(fs.Object); ok {
+		_ = vfs.quota.add(nonNegative(o.Size())-size, 0)
+		return
+	}
+	file.Dir().delObject(file.Name())
+	_ = vfs.quota.add(-size, -1)
+}
@@ -0,0 +1,128 @@
+package vfs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/rclone/rclone/vfs/vfscache"
+	"github.com/rclone/rclone/vfs/vfscommon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serveClamd runs a fake clamd on a random port which finds a virus
+// in any file containing "EICAR", returning its address.
+func serveClamd(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = l.Close()
+	})
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			r := bufio.NewReader(conn)
+			command, err := r.ReadString(0)
+			if err != nil || command != "zINSTREAM\x00" {
+				_, _ = conn.Write([]byte("UNKNOWN COMMAND\x00"))
+				_ = conn.Close()
+				continue
+			}
+			var data []byte
+			for {
+				var size uint32
+				if err := binary.Read(r, binary.BigEndian, &size); err != nil || size == 0 {
+					break
+				}
+				chunk := make([]byte, size)
+				if _, err := io.ReadFull(r, chunk); err != nil {
+					break
+				}
+				data = append(data, chunk...)
+			}
+			reply := "stream: OK\x00"
+			if bytes.Contains(data, []byte("EICAR")) {
+				reply = "stream: Eicar-Signature FOUND\x00"
+			}
+			_, _ = conn.Write([]byte(reply))
+			_ = conn.Close()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestClamdScan(t *testing.T) {
+	addr := serveClamd(t)
+	dir := t.TempDir()
+
+	clean := filepath.Join(dir, "clean")
+	require.NoError(t, os.WriteFile(clean, bytes.Repeat([]byte("potato"), 100000), 0600))
+	reason, err := clamdScan(context.Background(), addr, clean)
+	require.NoError(t, err)
+	assert.Equal(t, "", reason)
+
+	infected := filepath.Join(dir, "infected")
+	require.NoError(t, os.WriteFile(infected, []byte("X5O!P%@AP EICAR"), 0600))
+	reason, err = clamdScan(context.Background(), addr, infected)
+	require.NoError(t, err)
+	assert.Equal(t, "Eicar-Signature", reason)
+}
+
+func TestRunUploadHook(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("needs sh")
+	}
+	osPath := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(osPath, []byte("hello"), 0600))
+	ctx := context.Background()
+
+	reason, err := runUploadHook(ctx, []string{"sh", "-c", "exit 0"}, "file", osPath)
+	require.NoError(t, err)
+	assert.Equal(t, "", reason)
+
+	reason, err = runUploadHook(ctx, []string{"sh", "-c", `echo "bad $RCLONE_UPLOAD_NAME"; exit 1`}, "file", osPath)
+	require.NoError(t, err)
+	assert.Equal(t, "bad file", reason)
+
+	_, err = runUploadHook(ctx, []string{"sh", "-c", "exit 2"}, "file", osPath)
+	assert.Error(t, err)
+}
+
+func TestVFSUploadHook(t *testing.T) {
+	quarantineDir := t.TempDir()
+	opt := vfscommon.DefaultOpt
+	opt.CacheMode = vfscommon.CacheModeOff // should be raised to writes
+	opt.WriteBack = 0
+	opt.UploadClamd = serveClamd(t)
+	opt.UploadQuarantine = quarantineDir
+	r, vfs := newTestVFSOpt(t, &opt)
+	assert.Equal(t, vfscommon.CacheModeWrites, vfs.Opt.CacheMode)
+
+	require.NoError(t, writeQuotaFile(vfs, "clean", "hello"))
+	require.NoError(t, vfs.Mkdir("dir", 0777))
+	assert.ErrorIs(t, writeQuotaFile(vfs, "dir/infected", "EICAR"), vfscache.ErrUploadRejected)
+
+	// Only the clean file is uploaded and visible
+	_, err := vfs.Stat("dir/infected")
+	assert.Equal(t, ENOENT, err)
+	_, err = r.Fremote.NewObject(context.Background(), "dir/infected")
+	assert.Error(t, err)
+	_, err = r.Fremote.NewObject(context.Background(), "clean")
+	assert.NoError(t, err)
+
+	// The infected file is in quarantine
+	data, err := os.ReadFile(filepath.Join(quarantineDir, "dir", "infected"))
+	require.NoError(t, err)
+	assert.Equal(t, "EICAR", string(data))
+}
@@ -181,6 +181,9 @@ type VFS struct {
 	usageMu     sync.Mutex
 	usageTime   time.Time
 	usage       *fs.Usage
+	quota       *quota    // nil if no quota set
+	auditLog    *auditLog // nil if no audit log
+	uploaders   sync.Map  // path to AuditInfo of the last writer for the upload hook
 	pollChan    chan time.Duration
 	inUse       atomic.Int32 // count of number of opens
 }
@@ -226,6 +229,8 @@ func New(f fs.Fs, opt *vfscommon.Options) *VFS {
 
 	// Create root directory
 	vfs.root = newDir(vfs, f, nil, fsDir)
+	vfs.quota = newQuota(vfs)
+	vfs.openAuditLog()
 
 	// Start polling function
 	features := vfs.f.Features()
@@ -290,6 +295,9 @@ func (vfs *VFS) Stats() (out rc.Params) {
 	if vfs.cache != nil {
 		out["diskCache"] = vfs.cache.Stats()
 	}
+	if q, ok := vfs.Quota(); ok {
+		out["quota"] = q
+	}
 	return out
 }
 
@@ -318,7 +326,7 @@ func (vfs *VFS) SetCacheMode(cacheMode vfscommon.CacheMode) {
 	vfs.cache = nil
 	if cacheMode > vfscommon.CacheModeOff {
 		ctx, cancel := context.WithCancel(context.Background())
-		cache, err := vfscache.New(ctx, vfs.f, &vfs.Opt, vfs.AddVirtual) // FIXME pass on context or get from Opt?
+		cache, err := vfscache.New(ctx, vfs.f, &vfs.Opt, vfs.AddVirtual, vfs.uploadHookFn()) // FIXME pass on context or get from Opt?
 		if err != nil {
 			fs.Errorf(nil, "Failed to create vfs cache - disabling: %v", err)
 			vfs.Opt.CacheMode = vfscommon.CacheModeOff
@@ -650,6 +658,14 @@ func (vfs *VFS) Statfs() (total, used, free int64) {
 		total = int64(vfs.Opt.DiskSpaceTotalSize)
 	}
 
+	// Report the quota instead of the remote if there is one
+	if q, ok := vfs.Quota(); ok && q.MaxSize >= 0 {
+		total, used, free = q.MaxSize, q.Size, q.MaxSize-q.Size
+		if free < 0 {
+			free = 0
+		}
+	}
+
 	total, used, free = fillInMissingSizes(total, used, free, unknownFreeBytes)
 	return
 }
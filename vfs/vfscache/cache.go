@@ -51,6 +51,7 @@ type Cache struct {
 	hashOption *fs.HashesOption     // corresponding OpenOption
 	writeback  *writeback.WriteBack // holds Items for writeback
 	avFn       AddVirtualFn         // if set, can be called to add dir entries
+	uhFn       UploadHookFn         // if set, called to check files before upload
 
 	mu            sync.Mutex       // protects the following variables
 	cond          sync.Cond        // cond lock for synchronous cache cleaning
@@ -72,11 +73,23 @@ type Cache struct {
 // go into the directory tree.
 type AddVirtualFn func(remote string, size int64, isDir bool) error
 
+// UploadHookFn if set is called with the name of a file and the path
+// of its cache file before it is uploaded.
+//
+// If it returns an error wrapping ErrUploadRejected then the file is
+// discarded without being uploaded, otherwise if it returns an error
+// the upload is retried later.
+type UploadHookFn func(ctx context.Context, name string, osPath string) error
+
+// ErrUploadRejected should be wrapped by the errors returned from an
+// UploadHookFn to reject a file
+var ErrUploadRejected = errors.New("upload rejected")
+
 // New creates a new cache hierarchy for fremote
 //
 // This starts background goroutines which can be cancelled with the
 // context passed in.
-func New(ctx context.Context, fremote fs.Fs, opt *vfscommon.Options, avFn AddVirtualFn) (*Cache, error) {
+func New(ctx context.Context, fremote fs.Fs, opt *vfscommon.Options, avFn AddVirtualFn, uhFn UploadHookFn) (*Cache, error) {
 	// Get cache root path.
 	// We need it in two variants: OS path as an absolute path with UNC prefix,
 	// OS-specific path separators, and encoded with OS-specific encoder. Standard path
@@ -127,6 +140,7 @@ func New(ctx context.Context, fremote fs.Fs, opt *vfscommon.Options, avFn AddVir
 		hashOption: hashOption,
 		writeback:  writeback.New(ctx, opt),
 		avFn:       avFn,
+		uhFn:       uhFn,
 	}
 
 	// load in the cache and metadata off disk
@@ -589,6 +589,21 @@ func (item *Item) _store(ctx context.Context, storeFn StoreFn) (err error) {
 	// Object has disappeared if cacheObj == nil
 	if cacheObj != nil {
 		o, name := item.o, item.name
+		if item.c.uhFn != nil {
+			item.mu.Unlock()
+			err = item.c.uhFn(ctx, name, item.c.toOSPath(name))
+			item.mu.Lock()
+			if errors.Is(err, ErrUploadRejected) {
+				// Discard the changes so the file reverts to the
+				// remote object if there is one
+				item.info.clean()
+				item._removeFile("upload rejected")
+				item._removeMeta("upload rejected")
+				return fmt.Errorf("vfs cache: %w", err)
+			} else if err != nil {
+				return fmt.Errorf("vfs cache: upload hook failed: %w", err)
+			}
+		}
 		item.mu.Unlock()
 		o, err := operations.Copy(ctx, item.c.fremote, o, name, cacheObj)
 		item.mu.Lock()
@@ -729,7 +744,13 @@ func (item *Item) Close(storeFn StoreFn) (err error) {
 			id := item.writeBackID
 			item.mu.Unlock()
 			item.c.writeback.Add(id, item.name, item.modified, func(ctx context.Context) error {
-				return item.store(ctx, storeFn)
+				err := item.store(ctx, storeFn)
+				if errors.Is(err, ErrUploadRejected) {
+					// Don't retry rejected files
+					fs.Errorf(item.name, "%v", err)
+					return nil
+				}
+				return err
 			})
 			item.mu.Lock()
 		}
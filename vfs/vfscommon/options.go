@@ -38,6 +38,13 @@ type Options struct {
 	UsedIsSize         bool          // if true, use the `rclone size` algorithm for Used size
 	FastFingerprint    bool          // if set use fast fingerprints
 	DiskSpaceTotalSize fs.SizeSuffix
+	QuotaSize          fs.SizeSuffix // max bytes stored, -1 for unlimited
+	QuotaFiles         int64         // max files stored, -1 for unlimited
+	QuotaInterval      time.Duration // time between counting the usage for the quota
+	AuditLog           string        // where to write the audit log, blank for none
+	UploadHook         string        // command to check files before upload, blank for none
+	UploadClamd        string        // address of clamd to scan files before upload, blank for none
+	UploadQuarantine   string        // local directory for files rejected by the upload hook
 }
 
 // DefaultOpt is the default values uses for Opt
@@ -68,6 +75,9 @@ var DefaultOpt = Options{
 	ReadAhead:          0 * fs.Mebi,
 	UsedIsSize:         false,
 	DiskSpaceTotalSize: -1,
+	QuotaSize:          -1,
+	QuotaFiles:         -1,
+	QuotaInterval:      time.Hour,
 }
 
 // Init the options, making sure everything is within range
@@ -79,4 +89,9 @@ func (opt *Options) Init() {
 	// Make sure directories are returned as directories
 	opt.DirPerms |= os.ModeDir
 
+	// Files can only be checked before upload if they are cached
+	if (opt.UploadHook != "" || opt.UploadClamd != "") && opt.CacheMode < CacheModeWrites {
+		fs.Logf(nil, "Using --vfs-cache-mode writes as needed by --vfs-upload-hook and --vfs-upload-clamd")
+		opt.CacheMode = CacheModeWrites
+	}
 }
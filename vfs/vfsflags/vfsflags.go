@@ -43,5 +43,12 @@ func AddFlags(flagSet *pflag.FlagSet) {
 	flags.BoolVarP(flagSet, &Opt.UsedIsSize, "vfs-used-is-size", "", Opt.UsedIsSize, "Use the `rclone size` algorithm for Used size", "VFS")
 	flags.BoolVarP(flagSet, &Opt.FastFingerprint, "vfs-fast-fingerprint", "", Opt.FastFingerprint, "Use fast (less accurate) fingerprints for change detection", "VFS")
 	flags.FVarP(flagSet, &Opt.DiskSpaceTotalSize, "vfs-disk-space-total-size", "", "Specify the total space of disk", "VFS")
+	flags.FVarP(flagSet, &Opt.QuotaSize, "vfs-quota-size", "", "Max total size of files which can be stored ('off' is unlimited)", "VFS")
+	flags.Int64VarP(flagSet, &Opt.QuotaFiles, "vfs-quota-files", "", Opt.QuotaFiles, "Max number of files which can be stored (-1 is unlimited)", "VFS")
+	flags.DurationVarP(flagSet, &Opt.QuotaInterval, "vfs-quota-interval", "", Opt.QuotaInterval, "Interval to count the usage again for the quota (set 0 to disable)", "VFS")
+	flags.StringVarP(flagSet, &Opt.AuditLog, "vfs-audit-log", "", Opt.AuditLog, "Write an audit log of file operations to these comma separated files, syslog or rc", "VFS")
+	flags.StringVarP(flagSet, &Opt.UploadHook, "vfs-upload-hook", "", Opt.UploadHook, "Command to check files with before they are uploaded", "VFS")
+	flags.StringVarP(flagSet, &Opt.UploadClamd, "vfs-upload-clamd", "", Opt.UploadClamd, "Address of clamd to scan files with before they are uploaded (host:port or socket path)", "VFS")
+	flags.StringVarP(flagSet, &Opt.UploadQuarantine, "vfs-upload-quarantine", "", Opt.UploadQuarantine, "Local directory to copy files rejected by the upload checks into", "VFS")
 	platformFlags(flagSet)
 }
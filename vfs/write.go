@@ -27,6 +27,7 @@ type WriteFileHandle struct {
 	writeCalled bool // set the first time Write() is called
 	opened      bool
 	truncated   bool
+	oldSize     int64 // size of the file being replaced or -1 if none
 }
 
 // Check interfaces
@@ -64,6 +65,12 @@ func (fh *WriteFileHandle) openPending() (err error) {
 		fs.Errorf(fh.remote, "WriteFileHandle: Can't open for write without O_TRUNC on existing file without --vfs-cache-mode >= writes")
 		return EPERM
 	}
+	// The space of the old contents is released once they have been
+	// replaced
+	fh.oldSize = -1
+	if fh.file.exists() {
+		fh.oldSize = nonNegative(fh.file.Size())
+	}
 	var pipeReader *io.PipeReader
 	pipeReader, fh.pipeWriter = io.Pipe()
 	go func() {
@@ -140,7 +147,12 @@ func (fh *WriteFileHandle) writeAt(p []byte, off int64) (n int, err error) {
 		return 0, err
 	}
 	fh.writeCalled = true
+	quota := fh.file.VFS().quota
+	if err = quota.add(int64(len(p)), 0); err != nil {
+		return 0, err
+	}
 	n, err = fh.pipeWriter.Write(p)
+	_ = quota.add(int64(n-len(p)), 0)
 	fh.offset += int64(n)
 	fh.file.setSize(fh.offset)
 	if err != nil {
@@ -200,13 +212,20 @@ func (fh *WriteFileHandle) close() (err error) {
 	}
 	writeCloseErr := fh.pipeWriter.Close()
 	err = <-fh.result
+	quota := fh.file.VFS().quota
 	if err == nil {
 		fh.file.setObject(fh.o)
 		err = writeCloseErr
+		if fh.oldSize > 0 {
+			_ = quota.add(-fh.oldSize, 0)
+		}
 	} else {
 		// Remove vfs file entry when no object is present
 		if fh.file.getObject() == nil {
 			_ = fh.file.Remove()
+		} else {
+			// The old contents are still there so release the new
+			_ = quota.add(-fh.offset, 0)
 		}
 	}
 	return err